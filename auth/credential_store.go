@@ -5,10 +5,12 @@ package auth
 import (
 	"encoding/json"
 	"io"
+	"log"
 	"os"
+	"strings"
 	"sync"
 
-	"golang.org/x/crypto/bcrypt"
+	"github.com/rqlite/rqlite/secret"
 )
 
 const (
@@ -36,6 +38,21 @@ const (
 	PermBackup = "backup"
 	// PermLoad means user can load a SQLite dump into a node.
 	PermLoad = "load"
+	// PermMaintenance means user can place a node in, and take it out of,
+	// maintenance mode.
+	PermMaintenance = "maintenance"
+	// PermCA means user can rotate the CA used for node-to-node encryption.
+	PermCA = "ca"
+	// PermFK means user can enable and disable foreign key constraints.
+	PermFK = "fk"
+	// PermJoinTokens means user can create, list, and revoke join tokens.
+	PermJoinTokens = "join-tokens"
+	// PermRiskyWrites means user can confirm risky writes, when confirmation
+	// is required.
+	PermRiskyWrites = "risky-writes"
+	// PermUnredacted means user sees the columns otherwise redacted from
+	// query responses.
+	PermUnredacted = "unredacted"
 )
 
 // BasicAuther is the interface an object must support to return basic auth information.
@@ -85,15 +102,42 @@ type Credential struct {
 	Username string   `json:"username,omitempty"`
 	Password string   `json:"password,omitempty"`
 	Perms    []string `json:"perms,omitempty"`
+
+	// Tables, if set, limits the query perm of the user to read-only queries
+	// of the named tables.
+	Tables []string `json:"tables,omitempty"`
 }
 
 // CredentialsStore stores authentication and authorization information for all users.
 type CredentialsStore struct {
+	mu    sync.RWMutex
 	store map[string]string
 	perms map[string]map[string]bool
+	creds []*Credential
+	refs  map[string]bool // Whether each password is a reference to a secret.
+
+	// path is the file from which the store was loaded, if any. fileMu
+	// serializes writes to it.
+	path   string
+	fileMu sync.Mutex
+
+	// tables holds the tables to which the query perm of each user is
+	// limited. Users with an unlimited query perm have no entry.
+	tables map[string]map[string]bool
 
 	UseCache  bool
 	hashCache *HashCache
+
+	// Hasher, if set, is used to rehash any password whose hash was created
+	// by another algorithm, or with other parameters, when the password is
+	// next successfully checked. If the store was loaded from a file, the
+	// file is rewritten with the new hash.
+	Hasher Hasher
+
+	// hashers are the Hashers used to verify hashed passwords.
+	hashers []Hasher
+
+	logger *log.Logger
 }
 
 // NewCredentialsStore returns a new instance of a CredentialStore.
@@ -101,8 +145,12 @@ func NewCredentialsStore() *CredentialsStore {
 	return &CredentialsStore{
 		store:     make(map[string]string),
 		perms:     make(map[string]map[string]bool),
+		tables:    make(map[string]map[string]bool),
+		refs:      make(map[string]bool),
 		hashCache: NewHashCache(),
 		UseCache:  true,
+		hashers:   []Hasher{NewBcryptHasher(), NewArgon2idHasher()},
+		logger:    log.New(os.Stderr, "[auth] ", log.LstdFlags),
 	}
 }
 
@@ -115,6 +163,7 @@ func NewCredentialsStoreFromFile(path string) (*CredentialsStore, error) {
 	defer f.Close()
 
 	c := NewCredentialsStore()
+	c.path = path
 	return c, c.Load(f)
 }
 
@@ -127,17 +176,36 @@ func (c *CredentialsStore) Load(r io.Reader) error {
 		return err
 	}
 
-	var cred Credential
 	for dec.More() {
+		var cred Credential
 		err := dec.Decode(&cred)
 		if err != nil {
 			return err
 		}
-		c.store[cred.Username] = cred.Password
+		// The password may be a reference to a secret held elsewhere, in
+		// which case the reference, not the secret, is saved.
+		pw, err := secret.Resolve(cred.Password)
+		if err != nil {
+			return err
+		}
+		c.store[cred.Username] = pw
+		c.refs[cred.Username] = pw != cred.Password
+		c.creds = append(c.creds, &cred)
 		c.perms[cred.Username] = make(map[string]bool, len(cred.Perms))
 		for _, p := range cred.Perms {
 			c.perms[cred.Username][p] = true
 		}
+		delete(c.tables, cred.Username)
+
+		// A limited query perm is held separately, so that it is not
+		// mistaken for the unlimited perm.
+		if len(cred.Tables) > 0 && c.perms[cred.Username][PermQuery] {
+			delete(c.perms[cred.Username], PermQuery)
+			c.tables[cred.Username] = make(map[string]bool, len(cred.Tables))
+			for _, t := range cred.Tables {
+				c.tables[cred.Username][strings.ToLower(t)] = true
+			}
+		}
 	}
 
 	// Read closing bracket.
@@ -151,7 +219,7 @@ func (c *CredentialsStore) Load(r io.Reader) error {
 
 // Check returns true if the password is correct for the given username.
 func (c *CredentialsStore) Check(username, password string) bool {
-	pw, ok := c.store[username]
+	pw, ok := c.Password(username)
 	if !ok {
 		return false
 	}
@@ -170,21 +238,124 @@ func (c *CredentialsStore) Check(username, password string) bool {
 
 	// Next, what's in the file may be hashed, so hash the given password
 	// and compare.
-	if bcrypt.CompareHashAndPassword([]byte(pw), []byte(password)) != nil {
+	h := c.hasherFor(pw)
+	if h == nil || !h.Verify(pw, password) {
 		return false
 	}
 
 	// It's good -- cache that result for this user.
 	c.hashCache.Store(username, password)
+	c.rehash(username, pw, password)
 	return true
 }
 
 // Password returns the password for the given user.
 func (c *CredentialsStore) Password(username string) (string, bool) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
 	pw, ok := c.store[username]
 	return pw, ok
 }
 
+// Save writes the credentials to w, in the format read by Load.
+func (c *CredentialsStore) Save(w io.Writer) error {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	b, err := json.MarshalIndent(c.creds, "", "  ")
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(append(b, '\n'))
+	return err
+}
+
+// hasherFor returns the Hasher which created hash, or nil if hash was not
+// created by any supported algorithm.
+func (c *CredentialsStore) hasherFor(hash string) Hasher {
+	for _, h := range c.hashers {
+		if h.Match(hash) {
+			return h
+		}
+	}
+	return nil
+}
+
+// rehash replaces hash, the hash of the given password, with one created by
+// the Hasher of the store, if the Hasher would not have created hash.
+// Plaintext passwords, and passwords referencing secrets held elsewhere,
+// are never rehashed.
+func (c *CredentialsStore) rehash(username, hash, password string) {
+	if c.Hasher == nil || !c.Hasher.NeedsRehash(hash) {
+		return
+	}
+	c.mu.RLock()
+	ref := c.refs[username]
+	c.mu.RUnlock()
+	if ref {
+		return
+	}
+	newHash, err := c.Hasher.Hash(password)
+	if err != nil {
+		c.logger.Printf("failed to rehash password of user %s: %s", username, err.Error())
+		return
+	}
+
+	c.mu.Lock()
+	// The password may have been rehashed since it was checked.
+	if c.store[username] != hash {
+		c.mu.Unlock()
+		return
+	}
+	c.store[username] = newHash
+	for _, cred := range c.creds {
+		if cred.Username == username {
+			cred.Password = newHash
+		}
+	}
+	c.mu.Unlock()
+
+	if c.path == "" {
+		return
+	}
+	if err := c.saveFile(); err != nil {
+		c.logger.Printf("failed to save rehashed password of user %s to %s: %s", username, c.path, err.Error())
+		return
+	}
+	c.logger.Printf("rehashed password of user %s", username)
+}
+
+// saveFile saves the credentials to the file from which they were loaded,
+// such that the file contains either its previous contents, or the
+// credentials, should the save fail.
+func (c *CredentialsStore) saveFile() error {
+	c.fileMu.Lock()
+	defer c.fileMu.Unlock()
+
+	fi, err := os.Stat(c.path)
+	if err != nil {
+		return err
+	}
+	tmp := c.path + ".tmp"
+	f, err := os.OpenFile(tmp, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, fi.Mode().Perm())
+	if err != nil {
+		return err
+	}
+	if err := c.Save(f); err != nil {
+		f.Close()
+		os.Remove(tmp)
+		return err
+	}
+	if err := f.Close(); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	if err := os.Rename(tmp, c.path); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	return nil
+}
+
 // CheckRequest returns true if b contains a valid username and password.
 func (c *CredentialsStore) CheckRequest(b BasicAuther) bool {
 	username, password, ok := b.BasicAuth()
@@ -254,6 +425,43 @@ func (c *CredentialsStore) AA(username, password, perm string) bool {
 	return c.HasAnyPerm(username, perm, PermAll)
 }
 
+// AAQuery authenticates and checks authorization for a query which reads the
+// given tables. If AA permits the query perm it returns true. Otherwise, the
+// query is permitted only if the query perm of AllUsers, or of the user, is
+// limited to tables which include every table given. A nil tables means the
+// query is not read-only, and so is not permitted by a limited query perm.
+func (c *CredentialsStore) AAQuery(username, password string, tables []string) bool {
+	if c.AA(username, password, PermQuery) {
+		return true
+	}
+	if tables == nil {
+		return false
+	}
+
+	if c.tablesPermitted(AllUsers, tables) {
+		return true
+	}
+	if username == "" || !c.Check(username, password) {
+		return false
+	}
+	return c.tablesPermitted(username, tables)
+}
+
+// tablesPermitted returns true if username has a limited query perm which
+// permits reading every one of the given tables.
+func (c *CredentialsStore) tablesPermitted(username string, tables []string) bool {
+	m, ok := c.tables[username]
+	if !ok {
+		return false
+	}
+	for _, t := range tables {
+		if !m[strings.ToLower(t)] {
+			return false
+		}
+	}
+	return true
+}
+
 // HasPermRequest returns true if the username returned by b has the givem perm.
 // It does not perform any password checking, but if there is no username
 // in the request, it returns false.
@@ -595,6 +595,197 @@ func Test_AuthPermsAllUsers(t *testing.T) {
 	}
 }
 
+func Test_AuthPermsAAQuery(t *testing.T) {
+	const jsonStream = `
+		[
+			{
+				"username": "username1",
+				"password": "password1",
+				"perms": ["query"]
+			},
+			{
+				"username": "username2",
+				"password": "password2",
+				"perms": ["query", "status"],
+				"tables": ["foo", "Bar"]
+			},
+			{
+				"username": "*",
+				"perms": ["query", "status"],
+				"tables": ["pub"]
+			}
+		]
+	`
+
+	store := NewCredentialsStore()
+	if err := store.Load(strings.NewReader(jsonStream)); err != nil {
+		t.Fatalf("failed to load credentials: %s", err.Error())
+	}
+
+	// A limited query perm is not the query perm.
+	if store.AA("username2", "password2", "query") {
+		t.Fatalf("username2 has unlimited query perm")
+	}
+	if !store.AA("username2", "password2", "status") {
+		t.Fatalf("username2 does not have status perm")
+	}
+	if store.AA("", "", "query") {
+		t.Fatalf("anonymous user has unlimited query perm")
+	}
+
+	if !store.AAQuery("username1", "password1", nil) {
+		t.Fatalf("username1 cannot query")
+	}
+	if !store.AAQuery("username1", "password1", []string{"qux"}) {
+		t.Fatalf("username1 cannot query qux")
+	}
+	if store.AAQuery("username1", "wrong", []string{"qux"}) {
+		t.Fatalf("username1 can query with wrong password")
+	}
+
+	if !store.AAQuery("username2", "password2", []string{"foo", "bar"}) {
+		t.Fatalf("username2 cannot query foo and bar")
+	}
+	if !store.AAQuery("username2", "password2", []string{"pub"}) {
+		t.Fatalf("username2 cannot query pub via *")
+	}
+	if !store.AAQuery("username2", "password2", []string{}) {
+		t.Fatalf("username2 cannot query no tables")
+	}
+	if store.AAQuery("username2", "password2", []string{"foo", "qux"}) {
+		t.Fatalf("username2 can query qux")
+	}
+	if store.AAQuery("username2", "password2", nil) {
+		t.Fatalf("username2 can make query which is not read-only")
+	}
+	if store.AAQuery("username2", "wrong", []string{"foo"}) {
+		t.Fatalf("username2 can query with wrong password")
+	}
+
+	if !store.AAQuery("", "", []string{"PUB"}) {
+		t.Fatalf("anonymous user cannot query pub")
+	}
+	if store.AAQuery("", "", []string{"foo"}) {
+		t.Fatalf("anonymous user can query foo")
+	}
+	if store.AAQuery("", "", nil) {
+		t.Fatalf("anonymous user can make query which is not read-only")
+	}
+}
+
+func Test_AuthPermsAAQueryNilStore(t *testing.T) {
+	var store *CredentialsStore
+	if !store.AAQuery("username1", "password1", nil) {
+		t.Fatalf("nil store didn't return true for AAQuery")
+	}
+}
+
+func Test_AuthRehash(t *testing.T) {
+	bcryptHash, err := mustNewHasher(t, "bcrypt:cost=4").Hash("password1")
+	if err != nil {
+		t.Fatalf("failed to hash password: %s", err.Error())
+	}
+	path := mustWriteTempFile(t, `
+		[
+			{
+				"username": "username1",
+				"password": "`+bcryptHash+`",
+				"perms": ["query"],
+				"tables": ["foo"]
+			},
+			{
+				"username": "username2",
+				"password": "password2"
+			}
+		]
+	`)
+
+	store, err := NewCredentialsStoreFromFile(path)
+	if err != nil {
+		t.Fatalf("failed to load credentials: %s", err.Error())
+	}
+	store.Hasher = mustNewHasher(t, "argon2id:t=1,m=64,p=1")
+
+	if store.Check("username1", "wrong") {
+		t.Fatalf("wrong password accepted")
+	}
+	if pw, _ := store.Password("username1"); pw != bcryptHash {
+		t.Fatalf("password rehashed after failed check")
+	}
+	if !store.Check("username1", "password1") {
+		t.Fatalf("bcrypt hashed password not accepted")
+	}
+	pw, _ := store.Password("username1")
+	if !strings.HasPrefix(pw, "$argon2id$") {
+		t.Fatalf("password not rehashed, got %s", pw)
+	}
+
+	// Plaintext passwords are not rehashed.
+	if !store.Check("username2", "password2") {
+		t.Fatalf("plaintext password not accepted")
+	}
+	if pw, _ := store.Password("username2"); pw != "password2" {
+		t.Fatalf("plaintext password rehashed")
+	}
+
+	// The rehashed password must be saved, along with everything else.
+	store, err = NewCredentialsStoreFromFile(path)
+	if err != nil {
+		t.Fatalf("failed to reload credentials: %s", err.Error())
+	}
+	store.UseCache = false
+	if pw, _ := store.Password("username1"); !strings.HasPrefix(pw, "$argon2id$") {
+		t.Fatalf("rehashed password not saved, got %s", pw)
+	}
+	if !store.Check("username1", "password1") {
+		t.Fatalf("rehashed password not accepted")
+	}
+	if store.AAQuery("username1", "password1", nil) || !store.AAQuery("username1", "password1", []string{"foo"}) {
+		t.Fatalf("tables not saved")
+	}
+	if !store.Check("username2", "password2") {
+		t.Fatalf("plaintext password not saved")
+	}
+}
+
+func Test_AuthPasswordReference(t *testing.T) {
+	os.Setenv("RQLITE_TEST_PASSWORD", "password1")
+	defer os.Unsetenv("RQLITE_TEST_PASSWORD")
+
+	const jsonStream = `
+		[
+			{
+				"username": "username1",
+				"password": "env://RQLITE_TEST_PASSWORD",
+				"perms": ["foo"]
+			}
+		]
+	`
+	store := NewCredentialsStore()
+	if err := store.Load(strings.NewReader(jsonStream)); err != nil {
+		t.Fatalf("failed to load credentials: %s", err.Error())
+	}
+	if !store.Check("username1", "password1") {
+		t.Fatalf("referenced password not accepted")
+	}
+	if store.Check("username1", "env://RQLITE_TEST_PASSWORD") {
+		t.Fatalf("reference accepted as password")
+	}
+
+	// The reference, not the secret, is saved.
+	var b strings.Builder
+	if err := store.Save(&b); err != nil {
+		t.Fatalf("failed to save credentials: %s", err.Error())
+	}
+	if !strings.Contains(b.String(), "env://RQLITE_TEST_PASSWORD") || strings.Contains(b.String(), "password1") {
+		t.Fatalf("secret saved instead of reference: %s", b.String())
+	}
+
+	if err := NewCredentialsStore().Load(strings.NewReader(`[{"username": "username1", "password": "env://RQLITE_TEST_UNSET"}]`)); err == nil {
+		t.Fatalf("loaded credentials referencing unset secret")
+	}
+}
+
 func mustWriteTempFile(t *testing.T, s string) string {
 	f, err := os.CreateTemp(t.TempDir(), "rqlite-test")
 	if err != nil {
@@ -0,0 +1,269 @@
+package auth
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/bcrypt"
+)
+
+const (
+	// HashBcrypt is the name of the bcrypt password hashing algorithm.
+	HashBcrypt = "bcrypt"
+	// HashArgon2id is the name of the argon2id password hashing algorithm.
+	HashArgon2id = "argon2id"
+)
+
+// Hasher hashes passwords, and verifies passwords against hashes.
+type Hasher interface {
+	// Hash returns the encoded hash of password.
+	Hash(password string) (string, error)
+
+	// Match returns whether hash was created by the algorithm of the Hasher.
+	Match(hash string) bool
+
+	// Verify returns whether password matches hash.
+	Verify(hash, password string) bool
+
+	// NeedsRehash returns whether hash was created by another algorithm,
+	// or with parameters other than those of the Hasher.
+	NeedsRehash(hash string) bool
+}
+
+// BcryptHasher hashes passwords using bcrypt.
+type BcryptHasher struct {
+	Cost int
+}
+
+// NewBcryptHasher returns a BcryptHasher using the default cost.
+func NewBcryptHasher() *BcryptHasher {
+	return &BcryptHasher{Cost: bcrypt.DefaultCost}
+}
+
+// Hash implements Hasher.
+func (b *BcryptHasher) Hash(password string) (string, error) {
+	h, err := bcrypt.GenerateFromPassword([]byte(password), b.Cost)
+	if err != nil {
+		return "", err
+	}
+	return string(h), nil
+}
+
+// Match implements Hasher.
+func (b *BcryptHasher) Match(hash string) bool {
+	_, err := bcrypt.Cost([]byte(hash))
+	return err == nil
+}
+
+// Verify implements Hasher.
+func (b *BcryptHasher) Verify(hash, password string) bool {
+	return bcrypt.CompareHashAndPassword([]byte(hash), []byte(password)) == nil
+}
+
+// NeedsRehash implements Hasher.
+func (b *BcryptHasher) NeedsRehash(hash string) bool {
+	cost, err := bcrypt.Cost([]byte(hash))
+	return err != nil || cost != b.Cost
+}
+
+// Argon2idHasher hashes passwords using argon2id. Hashes are encoded in the
+// format used by the reference implementation, for example
+// $argon2id$v=19$m=65536,t=3,p=4$<salt>$<key>.
+type Argon2idHasher struct {
+	Time    uint32 // Number of passes over the memory.
+	Memory  uint32 // Memory used, in KiB.
+	Threads uint8  // Degree of parallelism.
+	KeyLen  uint32 // Length of the derived key, in bytes.
+	SaltLen uint32 // Length of the random salt, in bytes.
+}
+
+// NewArgon2idHasher returns an Argon2idHasher using the parameters
+// recommended by RFC 9106 for memory-constrained environments.
+func NewArgon2idHasher() *Argon2idHasher {
+	return &Argon2idHasher{
+		Time:    3,
+		Memory:  64 * 1024,
+		Threads: 4,
+		KeyLen:  32,
+		SaltLen: 16,
+	}
+}
+
+// Hash implements Hasher.
+func (a *Argon2idHasher) Hash(password string) (string, error) {
+	salt := make([]byte, a.SaltLen)
+	if _, err := rand.Read(salt); err != nil {
+		return "", err
+	}
+	key := argon2.IDKey([]byte(password), salt, a.Time, a.Memory, a.Threads, a.KeyLen)
+	return fmt.Sprintf("$%s$v=%d$m=%d,t=%d,p=%d$%s$%s", HashArgon2id, argon2.Version,
+		a.Memory, a.Time, a.Threads,
+		base64.RawStdEncoding.EncodeToString(salt),
+		base64.RawStdEncoding.EncodeToString(key)), nil
+}
+
+// Match implements Hasher.
+func (a *Argon2idHasher) Match(hash string) bool {
+	_, err := decodeArgon2id(hash)
+	return err == nil
+}
+
+// Verify implements Hasher.
+func (a *Argon2idHasher) Verify(hash, password string) bool {
+	h, err := decodeArgon2id(hash)
+	if err != nil {
+		return false
+	}
+	key := argon2.IDKey([]byte(password), h.salt, h.Time, h.Memory, h.Threads, uint32(len(h.key)))
+	return subtle.ConstantTimeCompare(key, h.key) == 1
+}
+
+// NeedsRehash implements Hasher.
+func (a *Argon2idHasher) NeedsRehash(hash string) bool {
+	h, err := decodeArgon2id(hash)
+	if err != nil {
+		return true
+	}
+	return h.Time != a.Time || h.Memory != a.Memory || h.Threads != a.Threads ||
+		uint32(len(h.key)) != a.KeyLen || uint32(len(h.salt)) != a.SaltLen
+}
+
+// argon2idHash is a decoded argon2id hash.
+type argon2idHash struct {
+	Argon2idHasher
+	salt []byte
+	key  []byte
+}
+
+func decodeArgon2id(hash string) (*argon2idHash, error) {
+	parts := strings.Split(hash, "$")
+	if len(parts) != 6 || parts[0] != "" || parts[1] != HashArgon2id {
+		return nil, errors.New("not an argon2id hash")
+	}
+	if parts[2] != fmt.Sprintf("v=%d", argon2.Version) {
+		return nil, fmt.Errorf("unsupported argon2id version %s", parts[2])
+	}
+
+	h := &argon2idHash{}
+	params, err := parseHashParams(parts[3])
+	if err != nil {
+		return nil, err
+	}
+	if err := h.setParams(params); err != nil {
+		return nil, err
+	}
+	if h.Time == 0 || h.Memory == 0 || h.Threads == 0 {
+		return nil, errors.New("missing argon2id parameters")
+	}
+	if h.salt, err = base64.RawStdEncoding.DecodeString(parts[4]); err != nil {
+		return nil, err
+	}
+	if h.key, err = base64.RawStdEncoding.DecodeString(parts[5]); err != nil {
+		return nil, err
+	}
+	if len(h.key) == 0 {
+		return nil, errors.New("empty argon2id key")
+	}
+	return h, nil
+}
+
+// setParams sets the parameters of a from those given, keyed by the names
+// used in encoded hashes.
+func (a *Argon2idHasher) setParams(params map[string]uint64) error {
+	for k, v := range params {
+		switch k {
+		case "t":
+			if v > 1<<32-1 {
+				return fmt.Errorf("argon2id time %d out of range", v)
+			}
+			a.Time = uint32(v)
+		case "m":
+			if v > 1<<32-1 {
+				return fmt.Errorf("argon2id memory %d out of range", v)
+			}
+			a.Memory = uint32(v)
+		case "p":
+			if v > 255 {
+				return fmt.Errorf("argon2id parallelism %d out of range", v)
+			}
+			a.Threads = uint8(v)
+		case "keylen":
+			a.KeyLen = uint32(v)
+		case "saltlen":
+			a.SaltLen = uint32(v)
+		default:
+			return fmt.Errorf("unknown argon2id parameter %q", k)
+		}
+	}
+	return nil
+}
+
+// NewHasher returns the Hasher described by spec, which is the name of an
+// algorithm, optionally followed by a colon and comma-separated parameters.
+// For example "bcrypt:cost=12", or "argon2id:t=3,m=65536,p=4". Parameters
+// not given take their default values.
+func NewHasher(spec string) (Hasher, error) {
+	name, p := spec, ""
+	if i := strings.Index(spec, ":"); i >= 0 {
+		name, p = spec[:i], spec[i+1:]
+	}
+	params, err := parseHashParams(p)
+	if err != nil {
+		return nil, err
+	}
+
+	switch name {
+	case HashBcrypt:
+		h := NewBcryptHasher()
+		for k, v := range params {
+			if k != "cost" {
+				return nil, fmt.Errorf("unknown bcrypt parameter %q", k)
+			}
+			h.Cost = int(v)
+		}
+		if h.Cost < bcrypt.MinCost || h.Cost > bcrypt.MaxCost {
+			return nil, fmt.Errorf("bcrypt cost must be between %d and %d", bcrypt.MinCost, bcrypt.MaxCost)
+		}
+		return h, nil
+	case HashArgon2id:
+		h := NewArgon2idHasher()
+		if err := h.setParams(params); err != nil {
+			return nil, err
+		}
+		if h.Time < 1 || h.Threads < 1 || h.Memory < 8*uint32(h.Threads) {
+			return nil, errors.New("argon2id requires t and p of at least 1, and m of at least 8*p")
+		}
+		if h.KeyLen < 16 || h.SaltLen < 8 {
+			return nil, errors.New("argon2id requires keylen of at least 16, and saltlen of at least 8")
+		}
+		return h, nil
+	default:
+		return nil, fmt.Errorf("unknown password hashing algorithm %q", name)
+	}
+}
+
+// parseHashParams parses comma-separated key=value pairs with integer values.
+func parseHashParams(s string) (map[string]uint64, error) {
+	params := make(map[string]uint64)
+	if s == "" {
+		return params, nil
+	}
+	for _, kv := range strings.Split(s, ",") {
+		i := strings.Index(kv, "=")
+		if i < 0 {
+			return nil, fmt.Errorf("malformed hash parameter %q", kv)
+		}
+		v, err := strconv.ParseUint(kv[i+1:], 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("malformed hash parameter %q", kv)
+		}
+		params[kv[:i]] = v
+	}
+	return params, nil
+}
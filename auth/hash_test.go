@@ -0,0 +1,107 @@
+package auth
+
+import (
+	"strings"
+	"testing"
+)
+
+func Test_NewHasher(t *testing.T) {
+	for _, spec := range []string{
+		"bcrypt",
+		"bcrypt:cost=12",
+		"argon2id",
+		"argon2id:t=2,m=19456,p=1",
+		"argon2id:t=1,m=64,p=1,keylen=16,saltlen=8",
+	} {
+		if _, err := NewHasher(spec); err != nil {
+			t.Fatalf("failed to create hasher for %s: %s", spec, err.Error())
+		}
+	}
+
+	for _, spec := range []string{
+		"",
+		"md5",
+		"bcrypt:cost=99",
+		"bcrypt:time=3",
+		"argon2id:t=0",
+		"argon2id:p=300",
+		"argon2id:m=4,p=1",
+		"argon2id:t",
+		"argon2id:t=x",
+	} {
+		if _, err := NewHasher(spec); err == nil {
+			t.Fatalf("created hasher for invalid spec %q", spec)
+		}
+	}
+}
+
+func Test_Argon2idHasher(t *testing.T) {
+	h := mustNewHasher(t, "argon2id:t=1,m=64,p=1")
+	hash, err := h.Hash("secret")
+	if err != nil {
+		t.Fatalf("failed to hash password: %s", err.Error())
+	}
+	if !strings.HasPrefix(hash, "$argon2id$v=19$m=64,t=1,p=1$") {
+		t.Fatalf("wrong hash format: %s", hash)
+	}
+	if !h.Match(hash) {
+		t.Fatalf("hasher does not match its own hash")
+	}
+	if !h.Verify(hash, "secret") {
+		t.Fatalf("failed to verify correct password")
+	}
+	if h.Verify(hash, "wrong") {
+		t.Fatalf("verified wrong password")
+	}
+	if h.NeedsRehash(hash) {
+		t.Fatalf("hash created with hasher parameters needs rehash")
+	}
+	if !mustNewHasher(t, "argon2id:t=2,m=64,p=1").NeedsRehash(hash) {
+		t.Fatalf("hash created with other parameters does not need rehash")
+	}
+
+	// Hashes created elsewhere are verified using their own parameters.
+	other, err := mustNewHasher(t, "argon2id:t=2,m=128,p=2").Hash("secret")
+	if err != nil {
+		t.Fatalf("failed to hash password: %s", err.Error())
+	}
+	if !h.Verify(other, "secret") {
+		t.Fatalf("failed to verify hash created with other parameters")
+	}
+
+	bcryptHash, err := mustNewHasher(t, "bcrypt:cost=4").Hash("secret")
+	if err != nil {
+		t.Fatalf("failed to hash password: %s", err.Error())
+	}
+	if h.Match(bcryptHash) || h.Verify(bcryptHash, "secret") || !h.NeedsRehash(bcryptHash) {
+		t.Fatalf("argon2id hasher accepted bcrypt hash")
+	}
+}
+
+func Test_BcryptHasher(t *testing.T) {
+	h := mustNewHasher(t, "bcrypt:cost=4")
+	hash, err := h.Hash("secret")
+	if err != nil {
+		t.Fatalf("failed to hash password: %s", err.Error())
+	}
+	if !h.Match(hash) || !h.Verify(hash, "secret") || h.Verify(hash, "wrong") {
+		t.Fatalf("bcrypt hasher failed to verify its own hash")
+	}
+	if h.NeedsRehash(hash) {
+		t.Fatalf("hash created with hasher cost needs rehash")
+	}
+	if !mustNewHasher(t, "bcrypt:cost=5").NeedsRehash(hash) {
+		t.Fatalf("hash created with other cost does not need rehash")
+	}
+	if h.Match("secret") {
+		t.Fatalf("bcrypt hasher matched plaintext password")
+	}
+}
+
+func mustNewHasher(t *testing.T, spec string) Hasher {
+	h, err := NewHasher(spec)
+	if err != nil {
+		t.Fatalf("failed to create hasher for %s: %s", spec, err.Error())
+	}
+	return h
+}
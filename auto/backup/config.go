@@ -9,13 +9,21 @@ import (
 	"github.com/rqlite/rqlite/aws"
 )
 
+// DefaultFullEvery is the default number of incremental uploads made
+// between full uploads.
+const DefaultFullEvery = 24
+
 // Config is the config file format for the upload service
 type Config struct {
-	Version    int              `json:"version"`
-	Type       auto.StorageType `json:"type"`
-	NoCompress bool             `json:"no_compress,omitempty"`
-	Interval   auto.Duration    `json:"interval"`
-	Sub        json.RawMessage  `json:"sub"`
+	Version     int              `json:"version"`
+	Type        auto.StorageType `json:"type"`
+	NoCompress  bool             `json:"no_compress,omitempty"`
+	Interval    auto.Duration    `json:"interval"`
+	Schedule    string           `json:"schedule,omitempty"`
+	RateLimit   int64            `json:"rate_limit,omitempty"`
+	Incremental bool             `json:"incremental,omitempty"`
+	FullEvery   int              `json:"full_every,omitempty"`
+	Sub         json.RawMessage  `json:"sub"`
 }
 
 // Unmarshal unmarshals the config file and returns the config and subconfig
@@ -30,6 +38,10 @@ func Unmarshal(data []byte) (*Config, *aws.S3Config, error) {
 		return nil, nil, auto.ErrInvalidVersion
 	}
 
+	if cfg.Incremental && cfg.FullEvery == 0 {
+		cfg.FullEvery = DefaultFullEvery
+	}
+
 	s3cfg := &aws.S3Config{}
 	err = json.Unmarshal(cfg.Sub, s3cfg)
 	if err != nil {
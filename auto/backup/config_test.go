@@ -180,6 +180,44 @@ func TestUnmarshal(t *testing.T) {
 			},
 			expectedErr: nil,
 		},
+		{
+			name: "ValidS3CompatibleConfig",
+			input: []byte(`
+			{
+				"version": 1,
+				"type": "s3",
+				"interval": "1h",
+				"sub": {
+					"endpoint": "https://minio.example.com:9000",
+					"access_key_id": "test_id",
+					"secret_access_key": "test_secret",
+					"region": "us-east-1",
+					"bucket": "test_bucket",
+					"path": "test/path",
+					"force_path_style": true,
+					"ca_cert": "/etc/ssl/minio-ca.pem",
+					"part_size": 67108864
+				}
+			}
+			`),
+			expectedCfg: &Config{
+				Version:  1,
+				Type:     "s3",
+				Interval: auto.Duration(time.Hour),
+			},
+			expectedS3: &aws.S3Config{
+				Endpoint:        "https://minio.example.com:9000",
+				AccessKeyID:     "test_id",
+				SecretAccessKey: "test_secret",
+				Region:          "us-east-1",
+				Bucket:          "test_bucket",
+				Path:            "test/path",
+				ForcePathStyle:  true,
+				CACert:          "/etc/ssl/minio-ca.pem",
+				PartSize:        64 * 1024 * 1024,
+			},
+			expectedErr: nil,
+		},
 		{
 			name: "InvalidVersion",
 			input: []byte(`
@@ -0,0 +1,196 @@
+package backup
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/rqlite/rqlite/auto"
+)
+
+// KeyedStorageClient is a StorageClient which can also upload to, and delete,
+// objects other than its own, as required by incremental uploads.
+type KeyedStorageClient interface {
+	StorageClient
+	Key() string
+	UploadTo(ctx context.Context, key string, reader io.Reader) error
+	Delete(ctx context.Context, key string) error
+}
+
+// ErrNotKeyedStorageClient is returned if incremental uploads are requested
+// but the storage client does not support them.
+var ErrNotKeyedStorageClient = errors.New("storage client does not support incremental uploads")
+
+// incrementalState tracks the chain of uploads made in incremental mode.
+type incrementalState struct {
+	client    KeyedStorageClient
+	fullEvery int
+
+	// pageIndex is the index of the database as of the last upload. If nil
+	// the next upload will be a full upload.
+	pageIndex *auto.PageIndex
+
+	// manifest describes the chain of uploads currently in storage.
+	manifest *auto.Manifest
+
+	// generation distinguishes the objects of one chain from those of another.
+	generation string
+}
+
+func (i *incrementalState) stats() map[string]interface{} {
+	chainLen := 0
+	if i.manifest != nil {
+		chainLen = 1 + len(i.manifest.Deltas)
+	}
+	return map[string]interface{}{
+		"full_every":   i.fullEvery,
+		"chain_length": chainLen,
+	}
+}
+
+// SetIncremental enables incremental uploads. Rather than uploading the
+// entire database each time, only the pages changed since the previous
+// upload are uploaded, as a delta. A full upload is made first, and after
+// every fullEvery deltas. A manifest, stored alongside the uploads, lists
+// the full upload and the deltas which must be applied to it, in order, to
+// restore the database. It must be called before Start.
+func (u *Uploader) SetIncremental(fullEvery int) error {
+	kc, ok := u.storageClient.(KeyedStorageClient)
+	if !ok {
+		return ErrNotKeyedStorageClient
+	}
+	if fullEvery < 0 {
+		return fmt.Errorf("invalid full upload frequency %d", fullEvery)
+	}
+	u.incremental = &incrementalState{
+		client:    kc,
+		fullEvery: fullEvery,
+	}
+	return nil
+}
+
+// resetIncremental ensures the next incremental upload is a full upload.
+func (u *Uploader) resetIncremental() {
+	if u.incremental != nil {
+		u.incremental.pageIndex = nil
+	}
+}
+
+// errFullRequired is returned when a delta cannot be created, and a full
+// upload must be made instead.
+var errFullRequired = errors.New("full upload required")
+
+func (u *Uploader) uploadIncremental(ctx context.Context, dbPath string) error {
+	inc := u.incremental
+	if inc.pageIndex != nil && len(inc.manifest.Deltas) < inc.fullEvery {
+		err := u.uploadDelta(ctx, dbPath)
+		if !errors.Is(err, errFullRequired) {
+			return err
+		}
+		u.logger.Printf("%s, making full upload", err.Error())
+	}
+	return u.uploadFull(ctx, dbPath)
+}
+
+func (u *Uploader) uploadDelta(ctx context.Context, dbPath string) error {
+	inc := u.incremental
+	deltaPath, err := tempFilename()
+	if err != nil {
+		return err
+	}
+	defer os.Remove(deltaPath)
+
+	fd, err := os.Create(deltaPath)
+	if err != nil {
+		return err
+	}
+	idx, n, err := auto.WriteDelta(fd, dbPath, inc.pageIndex)
+	fd.Close()
+	if err != nil {
+		return fmt.Errorf("%w: failed to create delta: %s", errFullRequired, err.Error())
+	}
+	if n == 0 && idx.NumPages() == inc.pageIndex.NumPages() {
+		stats.Add(numUploadsSkipped, 1)
+		return nil
+	}
+	if err := u.compressIfNeeded(deltaPath); err != nil {
+		return err
+	}
+
+	key := fmt.Sprintf("%s.%s.delta-%d", inc.client.Key(), inc.generation, len(inc.manifest.Deltas)+1)
+	if err := u.uploadFile(ctx, deltaPath, func(ctx context.Context, r io.Reader) error {
+		return inc.client.UploadTo(ctx, key, r)
+	}); err != nil {
+		return err
+	}
+
+	m := &auto.Manifest{
+		Version: auto.ManifestVersion,
+		Full:    inc.manifest.Full,
+		Deltas:  append(append([]string{}, inc.manifest.Deltas...), key),
+	}
+	if err := u.uploadManifest(ctx, m); err != nil {
+		return err
+	}
+	inc.manifest = m
+	inc.pageIndex = idx
+	stats.Add(numDeltaUploads, 1)
+	return nil
+}
+
+func (u *Uploader) uploadFull(ctx context.Context, dbPath string) error {
+	inc := u.incremental
+	idx, err := auto.NewPageIndex(dbPath)
+	if err != nil {
+		return err
+	}
+	if err := u.compressIfNeeded(dbPath); err != nil {
+		return err
+	}
+
+	generation := strconv.FormatInt(time.Now().UnixNano(), 10)
+	key := fmt.Sprintf("%s.%s.full", inc.client.Key(), generation)
+	if err := u.uploadFile(ctx, dbPath, func(ctx context.Context, r io.Reader) error {
+		return inc.client.UploadTo(ctx, key, r)
+	}); err != nil {
+		return err
+	}
+
+	m := &auto.Manifest{
+		Version: auto.ManifestVersion,
+		Full:    key,
+	}
+	if err := u.uploadManifest(ctx, m); err != nil {
+		return err
+	}
+	prev := inc.manifest
+	inc.manifest = m
+	inc.pageIndex = idx
+	inc.generation = generation
+	stats.Add(numFullUploads, 1)
+
+	// The previous chain is no longer referenced by the manifest.
+	if prev != nil {
+		for _, k := range append([]string{prev.Full}, prev.Deltas...) {
+			if err := inc.client.Delete(ctx, k); err != nil {
+				u.logger.Printf("failed to delete superseded upload: %s", err.Error())
+			}
+		}
+	}
+	return nil
+}
+
+func (u *Uploader) uploadManifest(ctx context.Context, m *auto.Manifest) error {
+	b, err := json.Marshal(m)
+	if err != nil {
+		return err
+	}
+	inc := u.incremental
+	return inc.client.UploadTo(ctx, auto.ManifestKey(inc.client.Key()), bytes.NewReader(b))
+}
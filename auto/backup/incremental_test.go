@@ -0,0 +1,151 @@
+package backup
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"expvar"
+	"io"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/rqlite/rqlite/auto"
+)
+
+func Test_UploaderIncrementalNotKeyed(t *testing.T) {
+	uploader := NewUploader(&mockStorageClient{}, &mockDataProvider{}, 0, UploadNoCompress)
+	if err := uploader.SetIncremental(2); err != ErrNotKeyedStorageClient {
+		t.Fatalf("expected ErrNotKeyedStorageClient, got %v", err)
+	}
+}
+
+func Test_UploaderIncremental(t *testing.T) {
+	ResetStats()
+	sc := newMockKeyedStorageClient("db")
+	db := fakeSQLiteFile(512, 4)
+	dp := &mockBytesProvider{data: db}
+	uploader := NewUploader(sc, dp, 0, UploadNoCompress)
+	if err := uploader.SetIncremental(2); err != nil {
+		t.Fatalf("failed to enable incremental uploads: %s", err.Error())
+	}
+	ctx := context.Background()
+
+	// First upload is a full upload.
+	if err := uploader.upload(ctx); err != nil {
+		t.Fatalf("failed to upload: %s", err.Error())
+	}
+	m := sc.mustManifest(t)
+	if !strings.HasSuffix(m.Full, ".full") || len(m.Deltas) != 0 {
+		t.Fatalf("unexpected manifest after first upload: %+v", m)
+	}
+	if !bytes.Equal(sc.objects[m.Full], db) {
+		t.Fatalf("full upload does not match database")
+	}
+	firstFull := m.Full
+
+	// Unchanged data is not uploaded.
+	if err := uploader.upload(ctx); err != nil {
+		t.Fatalf("failed to upload: %s", err.Error())
+	}
+	if exp, got := int64(1), stats.Get(numUploadsSkipped).(*expvar.Int).Value(); exp != got {
+		t.Fatalf("expected %d skipped uploads, got %d", exp, got)
+	}
+
+	// Next two uploads are deltas, containing only the changed page.
+	for i := 1; i <= 2; i++ {
+		db[512*i] = 'x'
+		if err := uploader.upload(ctx); err != nil {
+			t.Fatalf("failed to upload: %s", err.Error())
+		}
+		m = sc.mustManifest(t)
+		if m.Full != firstFull || len(m.Deltas) != i {
+			t.Fatalf("unexpected manifest after delta upload %d: %+v", i, m)
+		}
+		if sz := len(sc.objects[m.Deltas[i-1]]); sz >= len(db) {
+			t.Fatalf("delta upload is not smaller than database: %d bytes", sz)
+		}
+	}
+
+	// The next upload starts a new chain, and the old chain is deleted.
+	db[512*3] = 'x'
+	if err := uploader.upload(ctx); err != nil {
+		t.Fatalf("failed to upload: %s", err.Error())
+	}
+	m = sc.mustManifest(t)
+	if m.Full == firstFull || len(m.Deltas) != 0 {
+		t.Fatalf("unexpected manifest after new full upload: %+v", m)
+	}
+	if exp, got := 2, len(sc.objects); exp != got {
+		t.Fatalf("expected %d objects in storage, got %d", exp, got)
+	}
+	if exp, got := int64(2), stats.Get(numFullUploads).(*expvar.Int).Value(); exp != got {
+		t.Fatalf("expected %d full uploads, got %d", exp, got)
+	}
+	if exp, got := int64(2), stats.Get(numDeltaUploads).(*expvar.Int).Value(); exp != got {
+		t.Fatalf("expected %d delta uploads, got %d", exp, got)
+	}
+}
+
+type mockKeyedStorageClient struct {
+	key     string
+	objects map[string][]byte
+}
+
+func newMockKeyedStorageClient(key string) *mockKeyedStorageClient {
+	return &mockKeyedStorageClient{
+		key:     key,
+		objects: make(map[string][]byte),
+	}
+}
+
+func (mc *mockKeyedStorageClient) Upload(ctx context.Context, reader io.Reader) error {
+	return mc.UploadTo(ctx, mc.key, reader)
+}
+
+func (mc *mockKeyedStorageClient) UploadTo(ctx context.Context, key string, reader io.Reader) error {
+	b, err := io.ReadAll(reader)
+	if err != nil {
+		return err
+	}
+	mc.objects[key] = b
+	return nil
+}
+
+func (mc *mockKeyedStorageClient) Delete(ctx context.Context, key string) error {
+	delete(mc.objects, key)
+	return nil
+}
+
+func (mc *mockKeyedStorageClient) Key() string {
+	return mc.key
+}
+
+func (mc *mockKeyedStorageClient) String() string {
+	return "mockKeyedStorageClient"
+}
+
+func (mc *mockKeyedStorageClient) mustManifest(t *testing.T) *auto.Manifest {
+	t.Helper()
+	m, err := auto.ParseManifest(mc.objects[auto.ManifestKey(mc.key)])
+	if err != nil {
+		t.Fatalf("failed to parse manifest: %s", err.Error())
+	}
+	return m
+}
+
+type mockBytesProvider struct {
+	data []byte
+}
+
+func (mp *mockBytesProvider) Provide(path string) error {
+	return os.WriteFile(path, mp.data, 0644)
+}
+
+// fakeSQLiteFile returns data with a SQLite header and the given page size.
+func fakeSQLiteFile(pageSize, numPages int) []byte {
+	b := make([]byte, pageSize*numPages)
+	copy(b, "SQLite format 3\x00")
+	binary.BigEndian.PutUint16(b[16:18], uint16(pageSize))
+	return b
+}
@@ -9,6 +9,8 @@ import (
 	"log"
 	"os"
 	"time"
+
+	"github.com/rqlite/rqlite/auto"
 )
 
 // StorageClient is an interface for uploading data to a storage service.
@@ -31,6 +33,9 @@ const (
 	numUploadsOK      = "num_uploads_ok"
 	numUploadsFail    = "num_uploads_fail"
 	numUploadsSkipped = "num_uploads_skipped"
+	numUploadsDelayed = "num_uploads_delayed"
+	numFullUploads    = "num_full_uploads"
+	numDeltaUploads   = "num_delta_uploads"
 	totalUploadBytes  = "total_upload_bytes"
 	lastUploadBytes   = "last_upload_bytes"
 
@@ -38,6 +43,10 @@ const (
 	UploadNoCompress = false
 )
 
+// scheduleCheckInterval is how often an upload delayed until the schedule
+// window opens is retried. Schedules have a resolution of one minute.
+var scheduleCheckInterval = time.Minute
+
 func init() {
 	stats = expvar.NewMap("uploader")
 	ResetStats()
@@ -49,6 +58,9 @@ func ResetStats() {
 	stats.Add(numUploadsOK, 0)
 	stats.Add(numUploadsFail, 0)
 	stats.Add(numUploadsSkipped, 0)
+	stats.Add(numUploadsDelayed, 0)
+	stats.Add(numFullUploads, 0)
+	stats.Add(numDeltaUploads, 0)
 	stats.Add(totalUploadBytes, 0)
 	stats.Add(lastUploadBytes, 0)
 }
@@ -59,6 +71,9 @@ type Uploader struct {
 	dataProvider  DataProvider
 	interval      time.Duration
 	compress      bool
+	rateLimiter   *auto.RateLimiter
+	schedule      *auto.Schedule
+	incremental   *incrementalState
 
 	logger             *log.Logger
 	lastUploadTime     time.Time
@@ -82,32 +97,77 @@ func NewUploader(storageClient StorageClient, dataProvider DataProvider, interva
 	}
 }
 
+// SetRateLimit limits uploads to the given number of bytes per second. Zero
+// means no limit. It must be called before Start.
+func (u *Uploader) SetRateLimit(bytesPerSec int64) {
+	u.rateLimiter = nil
+	if bytesPerSec > 0 {
+		u.rateLimiter = auto.NewRateLimiter(bytesPerSec)
+	}
+}
+
+// SetSchedule restricts uploads to the given schedule window. An upload due
+// outside the window is delayed until the window next opens. It must be
+// called before Start.
+func (u *Uploader) SetSchedule(schedule *auto.Schedule) {
+	u.schedule = schedule
+}
+
 // Start starts the Uploader service.
 func (u *Uploader) Start(ctx context.Context, isUploadEnabled func() bool) {
 	if isUploadEnabled == nil {
 		isUploadEnabled = func() bool { return true }
 	}
 
-	u.logger.Printf("starting upload to %s every %s", u.storageClient, u.interval)
+	if u.schedule != nil {
+		u.logger.Printf("starting upload to %s every %s, within schedule '%s'", u.storageClient, u.interval, u.schedule)
+	} else {
+		u.logger.Printf("starting upload to %s every %s", u.storageClient, u.interval)
+	}
 	ticker := time.NewTicker(u.interval)
 	defer ticker.Stop()
 
+	// scheduleC fires while an upload is waiting for the schedule window.
+	var scheduleC <-chan time.Time
+	var scheduleTicker *time.Ticker
+	defer func() {
+		if scheduleTicker != nil {
+			scheduleTicker.Stop()
+		}
+	}()
+
 	for {
 		select {
 		case <-ctx.Done():
 			u.logger.Println("upload service shutting down")
 			return
 		case <-ticker.C:
-			if !isUploadEnabled() {
-				// Reset the lastSum so that the next time we're enabled upload will
-				// happen. We do this to be conservative, as we don't know what was
-				// happening while upload was disabled.
-				u.lastSum = nil
-				continue
-			}
-			if err := u.upload(ctx); err != nil {
-				u.logger.Printf("failed to upload to %s: %v", u.storageClient, err)
+		case <-scheduleC:
+		}
+
+		if !isUploadEnabled() {
+			// Reset the lastSum so that the next time we're enabled upload will
+			// happen. We do this to be conservative, as we don't know what was
+			// happening while upload was disabled.
+			u.lastSum = nil
+			u.resetIncremental()
+			continue
+		}
+		if u.schedule != nil && !u.schedule.Matches(time.Now()) {
+			if scheduleTicker == nil {
+				stats.Add(numUploadsDelayed, 1)
+				scheduleTicker = time.NewTicker(scheduleCheckInterval)
+				scheduleC = scheduleTicker.C
 			}
+			continue
+		}
+		if scheduleTicker != nil {
+			scheduleTicker.Stop()
+			scheduleTicker, scheduleC = nil, nil
+		}
+
+		if err := u.upload(ctx); err != nil {
+			u.logger.Printf("failed to upload to %s: %v", u.storageClient, err)
 		}
 	}
 }
@@ -122,6 +182,15 @@ func (u *Uploader) Stats() (map[string]interface{}, error) {
 		"last_upload_duration": u.lastUploadDuration.String(),
 		"last_upload_sum":      u.lastSum.String(),
 	}
+	if u.schedule != nil {
+		status["upload_schedule"] = u.schedule.String()
+	}
+	if u.rateLimiter != nil {
+		status["upload_rate_limit"] = u.rateLimiter.String()
+	}
+	if u.incremental != nil {
+		status["incremental"] = u.incremental.stats()
+	}
 	return status, nil
 }
 
@@ -136,6 +205,9 @@ func (u *Uploader) upload(ctx context.Context) error {
 	if err := u.dataProvider.Provide(filetoUpload); err != nil {
 		return err
 	}
+	if u.incremental != nil {
+		return u.uploadIncremental(ctx, filetoUpload)
+	}
 	if err := u.compressIfNeeded(filetoUpload); err != nil {
 		return err
 	}
@@ -149,19 +221,32 @@ func (u *Uploader) upload(ctx context.Context) error {
 		return nil
 	}
 
-	fd, err := os.Open(filetoUpload)
+	if err := u.uploadFile(ctx, filetoUpload, u.storageClient.Upload); err != nil {
+		return err
+	}
+	u.lastSum = sum
+	return nil
+}
+
+// uploadFile uploads the file at path using the given upload function, and
+// records the upload in the stats.
+func (u *Uploader) uploadFile(ctx context.Context, path string, upload func(context.Context, io.Reader) error) error {
+	fd, err := os.Open(path)
 	if err != nil {
 		return err
 	}
 	defer fd.Close()
 
 	cr := &countingReader{reader: fd}
+	var r io.Reader = cr
+	if u.rateLimiter != nil {
+		r = auto.NewRateLimitedReader(ctx, cr, u.rateLimiter)
+	}
 	startTime := time.Now()
-	err = u.storageClient.Upload(ctx, cr)
+	err = upload(ctx, r)
 	if err != nil {
 		stats.Add(numUploadsFail, 1)
 	} else {
-		u.lastSum = sum
 		stats.Add(numUploadsOK, 1)
 		stats.Add(totalUploadBytes, cr.count)
 		stats.Get(lastUploadBytes).(*expvar.Int).Set(cr.count)
@@ -11,6 +11,8 @@ import (
 	"sync/atomic"
 	"testing"
 	"time"
+
+	"github.com/rqlite/rqlite/auto"
 )
 
 func Test_NewUploader(t *testing.T) {
@@ -261,6 +263,93 @@ func Test_UploaderEnabledTrue(t *testing.T) {
 	}
 }
 
+func Test_UploaderScheduleClosed(t *testing.T) {
+	ResetStats()
+
+	sc := &mockStorageClient{}
+	dp := &mockDataProvider{data: "my upload data"}
+	uploader := NewUploader(sc, dp, 100*time.Millisecond, UploadNoCompress)
+
+	// A window which is never open now -- it's always last month.
+	lastMonth := time.Now().AddDate(0, -1, 0).Month()
+	schedule, err := auto.ParseSchedule(fmt.Sprintf("* * * %d *", lastMonth))
+	if err != nil {
+		t.Fatalf("failed to parse schedule: %s", err.Error())
+	}
+	uploader.SetSchedule(schedule)
+	ctx, cancel := context.WithCancel(context.Background())
+
+	go uploader.Start(ctx, nil)
+	time.Sleep(time.Second)
+	defer cancel()
+
+	if exp, got := int64(0), stats.Get(numUploadsOK).(*expvar.Int); exp != got.Value() {
+		t.Errorf("expected numUploadsOK to be %d, got %d", exp, got)
+	}
+	if exp, got := int64(1), stats.Get(numUploadsDelayed).(*expvar.Int); exp != got.Value() {
+		t.Errorf("expected numUploadsDelayed to be %d, got %d", exp, got)
+	}
+}
+
+func Test_UploaderScheduleOpen(t *testing.T) {
+	ResetStats()
+
+	var wg sync.WaitGroup
+	wg.Add(1)
+	sc := &mockStorageClient{
+		uploadFn: func(ctx context.Context, reader io.Reader) error {
+			defer wg.Done()
+			return nil
+		},
+	}
+	dp := &mockDataProvider{data: "my upload data"}
+	uploader := NewUploader(sc, dp, 100*time.Millisecond, UploadNoCompress)
+	schedule, err := auto.ParseSchedule("* * * * *")
+	if err != nil {
+		t.Fatalf("failed to parse schedule: %s", err.Error())
+	}
+	uploader.SetSchedule(schedule)
+	ctx, cancel := context.WithCancel(context.Background())
+
+	go uploader.Start(ctx, nil)
+	defer cancel()
+	wg.Wait()
+}
+
+func Test_UploaderRateLimit(t *testing.T) {
+	ResetStats()
+	var uploadedData []byte
+	var uploadDuration time.Duration
+
+	var wg sync.WaitGroup
+	wg.Add(1)
+	sc := &mockStorageClient{
+		uploadFn: func(ctx context.Context, reader io.Reader) error {
+			defer wg.Done()
+			start := time.Now()
+			var err error
+			uploadedData, err = io.ReadAll(reader)
+			uploadDuration = time.Since(start)
+			return err
+		},
+	}
+	dp := &mockDataProvider{data: "my upload data"}
+	uploader := NewUploader(sc, dp, 100*time.Millisecond, UploadNoCompress)
+	uploader.SetRateLimit(10)
+	ctx, cancel := context.WithCancel(context.Background())
+
+	go uploader.Start(ctx, nil)
+	defer cancel()
+	wg.Wait()
+
+	if exp, got := "my upload data", string(uploadedData); exp != got {
+		t.Errorf("expected uploadedData to be %s, got %s", exp, got)
+	}
+	if uploadDuration < time.Second {
+		t.Errorf("expected rate-limited upload to take at least 1s, took %s", uploadDuration)
+	}
+}
+
 func Test_UploaderStats(t *testing.T) {
 	sc := &mockStorageClient{}
 	dp := &mockDataProvider{data: "my upload data"}
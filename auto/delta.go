@@ -0,0 +1,187 @@
+package auto
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+)
+
+// deltaMagic identifies a delta file.
+var deltaMagic = []byte("RQDELTA1")
+
+// ErrNotDelta is returned when data is not in the delta format.
+var ErrNotDelta = errors.New("not a delta")
+
+// ManifestVersion is the version of the incremental backup manifest format.
+const ManifestVersion = 1
+
+// Manifest describes an incremental backup chain. Restoring the database
+// involves downloading the full backup, and then applying each delta, in
+// order.
+type Manifest struct {
+	Version int      `json:"version"`
+	Full    string   `json:"full"`
+	Deltas  []string `json:"deltas,omitempty"`
+}
+
+// ManifestKey returns the key of the incremental backup manifest, given
+// the key configured for backups.
+func ManifestKey(key string) string {
+	return key + ".manifest"
+}
+
+// ParseManifest parses a Manifest, checking that it is supported.
+func ParseManifest(b []byte) (*Manifest, error) {
+	m := &Manifest{}
+	if err := json.Unmarshal(b, m); err != nil {
+		return nil, fmt.Errorf("failed to parse manifest: %s", err.Error())
+	}
+	if m.Version > ManifestVersion {
+		return nil, ErrInvalidVersion
+	}
+	if m.Full == "" {
+		return nil, errors.New("manifest does not name a full backup")
+	}
+	return m, nil
+}
+
+// PageIndex records a hash of each page of a SQLite database file, so the
+// pages changed since can later be determined.
+type PageIndex struct {
+	PageSize int
+	hashes   [][sha256.Size]byte
+}
+
+// NumPages returns the number of pages in the database.
+func (p *PageIndex) NumPages() int {
+	return len(p.hashes)
+}
+
+// NewPageIndex returns the PageIndex for the SQLite database at path.
+func NewPageIndex(path string) (*PageIndex, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	pageSize, err := sqlitePageSize(f)
+	if err != nil {
+		return nil, err
+	}
+	idx := &PageIndex{PageSize: pageSize}
+	buf := make([]byte, pageSize)
+	for {
+		if _, err := io.ReadFull(f, buf); err != nil {
+			if err == io.EOF {
+				return idx, nil
+			}
+			return nil, err
+		}
+		idx.hashes = append(idx.hashes, sha256.Sum256(buf))
+	}
+}
+
+// WriteDelta writes to w the pages of the SQLite database at path which have
+// changed since prev was created. It returns the PageIndex of the database,
+// and the number of pages written. If nothing has changed, nothing is written.
+func WriteDelta(w io.Writer, path string, prev *PageIndex) (*PageIndex, int, error) {
+	idx, err := NewPageIndex(path)
+	if err != nil {
+		return nil, 0, err
+	}
+	if idx.PageSize != prev.PageSize {
+		return nil, 0, fmt.Errorf("page size changed from %d to %d", prev.PageSize, idx.PageSize)
+	}
+
+	var changed []uint32
+	for i := range idx.hashes {
+		if i >= len(prev.hashes) || idx.hashes[i] != prev.hashes[i] {
+			changed = append(changed, uint32(i))
+		}
+	}
+	if len(changed) == 0 && idx.NumPages() == prev.NumPages() {
+		return idx, 0, nil
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer f.Close()
+
+	if _, err := w.Write(deltaMagic); err != nil {
+		return nil, 0, err
+	}
+	hdr := []uint32{uint32(idx.PageSize), uint32(idx.NumPages()), uint32(len(changed))}
+	if err := binary.Write(w, binary.BigEndian, hdr); err != nil {
+		return nil, 0, err
+	}
+	buf := make([]byte, idx.PageSize)
+	for _, pgno := range changed {
+		if _, err := f.ReadAt(buf, int64(pgno)*int64(idx.PageSize)); err != nil {
+			return nil, 0, err
+		}
+		if err := binary.Write(w, binary.BigEndian, pgno); err != nil {
+			return nil, 0, err
+		}
+		if _, err := w.Write(buf); err != nil {
+			return nil, 0, err
+		}
+	}
+	return idx, len(changed), nil
+}
+
+// ApplyDelta applies the delta read from r to the SQLite database file f.
+func ApplyDelta(f *os.File, r io.Reader) error {
+	magic := make([]byte, len(deltaMagic))
+	if _, err := io.ReadFull(r, magic); err != nil || !bytes.Equal(magic, deltaMagic) {
+		return ErrNotDelta
+	}
+	var hdr [3]uint32
+	if err := binary.Read(r, binary.BigEndian, &hdr); err != nil {
+		return fmt.Errorf("failed to read delta header: %s", err.Error())
+	}
+	pageSize, numPages, numChanged := int64(hdr[0]), int64(hdr[1]), hdr[2]
+
+	buf := make([]byte, pageSize)
+	for i := uint32(0); i < numChanged; i++ {
+		var pgno uint32
+		if err := binary.Read(r, binary.BigEndian, &pgno); err != nil {
+			return fmt.Errorf("failed to read delta page: %s", err.Error())
+		}
+		if _, err := io.ReadFull(r, buf); err != nil {
+			return fmt.Errorf("failed to read delta page: %s", err.Error())
+		}
+		if _, err := f.WriteAt(buf, int64(pgno)*pageSize); err != nil {
+			return err
+		}
+	}
+	return f.Truncate(numPages * pageSize)
+}
+
+// sqlitePageSize returns the page size recorded in the header of a SQLite
+// database file. f is left positioned at the start of the file.
+func sqlitePageSize(f io.ReadSeeker) (int, error) {
+	hdr := make([]byte, 18)
+	if _, err := io.ReadFull(f, hdr); err != nil {
+		return 0, fmt.Errorf("failed to read SQLite header: %s", err.Error())
+	}
+	if _, err := f.Seek(0, io.SeekStart); err != nil {
+		return 0, err
+	}
+	if !bytes.HasPrefix(hdr, []byte("SQLite format 3\x00")) {
+		return 0, errors.New("not a SQLite database")
+	}
+	sz := int(binary.BigEndian.Uint16(hdr[16:18]))
+	if sz == 1 {
+		// The value 1 represents a page size of 65536.
+		sz = 65536
+	}
+	return sz, nil
+}
@@ -0,0 +1,138 @@
+package auto
+
+import (
+	"bytes"
+	"encoding/binary"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func Test_DeltaRoundTrip(t *testing.T) {
+	dir := t.TempDir()
+	base := fakeSQLiteFile(512, 4)
+
+	for name, modify := range map[string]func([]byte) []byte{
+		"changed": func(b []byte) []byte {
+			b[2*512+10] = 'x'
+			return b
+		},
+		"grown": func(b []byte) []byte {
+			b[512] = 'y'
+			return append(b, bytes.Repeat([]byte{'z'}, 512)...)
+		},
+		"shrunk": func(b []byte) []byte {
+			return b[:2*512]
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			basePath := mustWriteFile(t, filepath.Join(dir, name+"-base"), base)
+			prev, err := NewPageIndex(basePath)
+			if err != nil {
+				t.Fatalf("failed to create page index: %s", err.Error())
+			}
+
+			next := modify(append([]byte{}, base...))
+			nextPath := mustWriteFile(t, filepath.Join(dir, name+"-next"), next)
+			var delta bytes.Buffer
+			idx, _, err := WriteDelta(&delta, nextPath, prev)
+			if err != nil {
+				t.Fatalf("failed to write delta: %s", err.Error())
+			}
+			if exp, got := len(next)/512, idx.NumPages(); exp != got {
+				t.Fatalf("wrong number of pages in index, exp %d, got %d", exp, got)
+			}
+
+			f, err := os.OpenFile(basePath, os.O_RDWR, 0644)
+			if err != nil {
+				t.Fatalf("failed to open base: %s", err.Error())
+			}
+			defer f.Close()
+			if err := ApplyDelta(f, &delta); err != nil {
+				t.Fatalf("failed to apply delta: %s", err.Error())
+			}
+			got, err := os.ReadFile(basePath)
+			if err != nil {
+				t.Fatalf("failed to read base: %s", err.Error())
+			}
+			if !bytes.Equal(got, next) {
+				t.Fatalf("database after applying delta does not match")
+			}
+		})
+	}
+}
+
+func Test_DeltaUnchanged(t *testing.T) {
+	path := mustWriteFile(t, filepath.Join(t.TempDir(), "db"), fakeSQLiteFile(1024, 3))
+	prev, err := NewPageIndex(path)
+	if err != nil {
+		t.Fatalf("failed to create page index: %s", err.Error())
+	}
+	var delta bytes.Buffer
+	_, n, err := WriteDelta(&delta, path, prev)
+	if err != nil {
+		t.Fatalf("failed to write delta: %s", err.Error())
+	}
+	if n != 0 || delta.Len() != 0 {
+		t.Fatalf("expected empty delta, got %d pages, %d bytes", n, delta.Len())
+	}
+}
+
+func Test_DeltaPageSizeChanged(t *testing.T) {
+	dir := t.TempDir()
+	prev, err := NewPageIndex(mustWriteFile(t, filepath.Join(dir, "a"), fakeSQLiteFile(1024, 2)))
+	if err != nil {
+		t.Fatalf("failed to create page index: %s", err.Error())
+	}
+	path := mustWriteFile(t, filepath.Join(dir, "b"), fakeSQLiteFile(512, 4))
+	if _, _, err := WriteDelta(&bytes.Buffer{}, path, prev); err == nil {
+		t.Fatalf("expected error when page size changes")
+	}
+}
+
+func Test_ApplyDeltaNotDelta(t *testing.T) {
+	f, err := os.CreateTemp(t.TempDir(), "db")
+	if err != nil {
+		t.Fatalf("failed to create file: %s", err.Error())
+	}
+	defer f.Close()
+	if err := ApplyDelta(f, bytes.NewReader([]byte("not a delta at all"))); err != ErrNotDelta {
+		t.Fatalf("expected ErrNotDelta, got %v", err)
+	}
+}
+
+func Test_ParseManifest(t *testing.T) {
+	m, err := ParseManifest([]byte(`{"version":1,"full":"k.1.full","deltas":["k.1.delta-1"]}`))
+	if err != nil {
+		t.Fatalf("failed to parse manifest: %s", err.Error())
+	}
+	if m.Full != "k.1.full" || len(m.Deltas) != 1 || m.Deltas[0] != "k.1.delta-1" {
+		t.Fatalf("unexpected manifest: %+v", m)
+	}
+	if _, err := ParseManifest([]byte(`{"version":2,"full":"k"}`)); err != ErrInvalidVersion {
+		t.Fatalf("expected ErrInvalidVersion, got %v", err)
+	}
+	if _, err := ParseManifest([]byte(`{"version":1}`)); err == nil {
+		t.Fatalf("expected error for manifest without full backup")
+	}
+}
+
+// fakeSQLiteFile returns data with a SQLite header and the given page size,
+// which is sufficient for page indexing.
+func fakeSQLiteFile(pageSize, numPages int) []byte {
+	b := make([]byte, pageSize*numPages)
+	for i := range b {
+		b[i] = byte(i / pageSize)
+	}
+	copy(b, "SQLite format 3\x00")
+	binary.BigEndian.PutUint16(b[16:18], uint16(pageSize))
+	return b
+}
+
+func mustWriteFile(t *testing.T, path string, b []byte) string {
+	t.Helper()
+	if err := os.WriteFile(path, b, 0644); err != nil {
+		t.Fatalf("failed to write file: %s", err.Error())
+	}
+	return path
+}
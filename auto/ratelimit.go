@@ -0,0 +1,99 @@
+package auto
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"sync"
+	"time"
+)
+
+// RateLimiter limits the rate at which bytes are transferred. It is safe for
+// concurrent use.
+type RateLimiter struct {
+	bytesPerSec int64
+
+	mu   sync.Mutex
+	next time.Time
+}
+
+// NewRateLimiter returns a RateLimiter allowing bytesPerSec bytes to be
+// transferred each second.
+func NewRateLimiter(bytesPerSec int64) *RateLimiter {
+	return &RateLimiter{
+		bytesPerSec: bytesPerSec,
+	}
+}
+
+// String returns a string representation of the rate limit.
+func (r *RateLimiter) String() string {
+	return fmt.Sprintf("%d bytes/s", r.bytesPerSec)
+}
+
+// Wait accounts for the transfer of n bytes, blocking until doing so would
+// not exceed the rate limit, or until the context is done.
+func (r *RateLimiter) Wait(ctx context.Context, n int) error {
+	r.mu.Lock()
+	now := time.Now()
+	if r.next.Before(now) {
+		r.next = now
+	}
+	r.next = r.next.Add(time.Duration(int64(n) * int64(time.Second) / r.bytesPerSec))
+	d := r.next.Sub(now)
+	r.mu.Unlock()
+
+	if d <= 0 {
+		return nil
+	}
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-t.C:
+		return nil
+	}
+}
+
+// NewRateLimitedReader returns a reader which reads from r no faster than
+// the given RateLimiter allows.
+func NewRateLimitedReader(ctx context.Context, r io.Reader, l *RateLimiter) io.Reader {
+	return &rateLimitedReader{ctx: ctx, r: r, l: l}
+}
+
+type rateLimitedReader struct {
+	ctx context.Context
+	r   io.Reader
+	l   *RateLimiter
+}
+
+// Read implements io.Reader.
+func (r *rateLimitedReader) Read(p []byte) (int, error) {
+	n, err := r.r.Read(p)
+	if n > 0 {
+		if werr := r.l.Wait(r.ctx, n); werr != nil {
+			return n, werr
+		}
+	}
+	return n, err
+}
+
+// NewRateLimitedWriterAt returns a WriterAt which writes to w no faster than
+// the given RateLimiter allows.
+func NewRateLimitedWriterAt(ctx context.Context, w io.WriterAt, l *RateLimiter) io.WriterAt {
+	return &rateLimitedWriterAt{ctx: ctx, w: w, l: l}
+}
+
+type rateLimitedWriterAt struct {
+	ctx context.Context
+	w   io.WriterAt
+	l   *RateLimiter
+}
+
+// WriteAt implements io.WriterAt.
+func (w *rateLimitedWriterAt) WriteAt(p []byte, off int64) (int, error) {
+	if err := w.l.Wait(w.ctx, len(p)); err != nil {
+		return 0, err
+	}
+	return w.w.WriteAt(p, off)
+}
@@ -0,0 +1,40 @@
+package auto
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"testing"
+	"time"
+)
+
+func Test_RateLimitedReader(t *testing.T) {
+	data := bytes.Repeat([]byte("a"), 2000)
+	r := NewRateLimitedReader(context.Background(), bytes.NewReader(data), NewRateLimiter(1000))
+
+	start := time.Now()
+	b, err := io.ReadAll(r)
+	if err != nil {
+		t.Fatalf("failed to read: %s", err.Error())
+	}
+	if !bytes.Equal(b, data) {
+		t.Fatalf("read data does not match")
+	}
+	if d := time.Since(start); d < 1900*time.Millisecond {
+		t.Fatalf("reading 2000 bytes at 1000 bytes/s took only %s", d)
+	}
+}
+
+func Test_RateLimiterCancel(t *testing.T) {
+	l := NewRateLimiter(1)
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+
+	start := time.Now()
+	if err := l.Wait(ctx, 1000); err != context.DeadlineExceeded {
+		t.Fatalf("expected context.DeadlineExceeded, got %v", err)
+	}
+	if d := time.Since(start); d > 5*time.Second {
+		t.Fatalf("cancelled wait took %s", d)
+	}
+}
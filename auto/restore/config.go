@@ -16,6 +16,8 @@ type Config struct {
 	Type              auto.StorageType `json:"type"`
 	Timeout           auto.Duration    `json:"timeout,omitempty"`
 	ContinueOnFailure bool             `json:"continue_on_failure,omitempty"`
+	RateLimit         int64            `json:"rate_limit,omitempty"`
+	Incremental       bool             `json:"incremental,omitempty"`
 	Sub               json.RawMessage  `json:"sub"`
 }
 
@@ -10,6 +10,8 @@ import (
 	"log"
 	"os"
 	"time"
+
+	"github.com/rqlite/rqlite/auto"
 )
 
 // StorageClient is an interface for downloading data from a storage service.
@@ -46,6 +48,8 @@ func ResetStats() {
 
 type Downloader struct {
 	storageClient StorageClient
+	rateLimiter   *auto.RateLimiter
+	incremental   bool
 	logger        *log.Logger
 }
 
@@ -56,36 +60,69 @@ func NewDownloader(storageClient StorageClient) *Downloader {
 	}
 }
 
+// SetRateLimit limits downloads to the given number of bytes per second. Zero
+// means no limit.
+func (d *Downloader) SetRateLimit(bytesPerSec int64) {
+	d.rateLimiter = nil
+	if bytesPerSec > 0 {
+		d.rateLimiter = auto.NewRateLimiter(bytesPerSec)
+	}
+}
+
 func (d *Downloader) Do(ctx context.Context, w io.Writer, timeout time.Duration) (err error) {
-	var cw *countingWriterAt
+	var n int64
 	defer func() {
 		if err == nil {
 			stats.Add(numDownloadsOK, 1)
-			if cw != nil {
-				stats.Add(numDownloadBytes, int64(cw.count))
-			}
+			stats.Add(numDownloadBytes, n)
 		} else {
 			stats.Add(numDownloadsFail, 1)
 		}
 	}()
 
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	if d.incremental {
+		return d.doIncremental(ctx, w, &n)
+	}
+
 	// Create a temporary file for the download.
-	f, err := os.CreateTemp("", "rqlite-downloader")
+	f, err := d.download(ctx, d.storageClient.Download, &n)
 	if err != nil {
 		return err
 	}
 	defer os.Remove(f.Name())
 	defer f.Close()
+	return decompressTo(w, f)
+}
 
-	ctx, cancel := context.WithTimeout(ctx, timeout)
-	defer cancel()
-
-	cw = &countingWriterAt{writerAt: f}
-	err = d.storageClient.Download(ctx, cw)
+// download downloads data to a temporary file, using the given download
+// function, adding the number of bytes downloaded to n. The caller is
+// responsible for removing the file.
+func (d *Downloader) download(ctx context.Context, download func(context.Context, io.WriterAt) error, n *int64) (*os.File, error) {
+	f, err := os.CreateTemp("", "rqlite-downloader")
 	if err != nil {
-		return err
+		return nil, err
+	}
+
+	cw := &countingWriterAt{writerAt: f}
+	var wa io.WriterAt = cw
+	if d.rateLimiter != nil {
+		wa = auto.NewRateLimitedWriterAt(ctx, cw, d.rateLimiter)
 	}
+	if err := download(ctx, wa); err != nil {
+		f.Close()
+		os.Remove(f.Name())
+		return nil, err
+	}
+	*n += cw.count
+	return f, nil
+}
 
+// decompressTo writes the data in f to w, decompressing it if it is gzip
+// compressed.
+func decompressTo(w io.Writer, f *os.File) error {
 	// Check if the download data is gzip compressed.
 	compressed, err := isGzip(f)
 	if err != nil {
@@ -0,0 +1,116 @@
+package restore
+
+import (
+	"compress/gzip"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+
+	"github.com/rqlite/rqlite/auto"
+)
+
+// KeyedStorageClient is a StorageClient which can also download objects
+// other than its own, as required to restore incremental backups.
+type KeyedStorageClient interface {
+	StorageClient
+	Key() string
+	DownloadFrom(ctx context.Context, key string, writer io.WriterAt) error
+}
+
+// ErrNotKeyedStorageClient is returned if an incremental restore is requested
+// but the storage client does not support it.
+var ErrNotKeyedStorageClient = errors.New("storage client does not support incremental restores")
+
+// SetIncremental sets whether the data to download is an incremental backup,
+// in which case the backup manifest is downloaded first, followed by the full
+// backup and each delta it lists. The deltas are applied, in order, to the
+// full backup to restore the database.
+func (d *Downloader) SetIncremental(incremental bool) error {
+	if _, ok := d.storageClient.(KeyedStorageClient); incremental && !ok {
+		return ErrNotKeyedStorageClient
+	}
+	d.incremental = incremental
+	return nil
+}
+
+func (d *Downloader) doIncremental(ctx context.Context, w io.Writer, n *int64) error {
+	kc := d.storageClient.(KeyedStorageClient)
+	downloadFrom := func(key string) (*os.File, error) {
+		return d.download(ctx, func(ctx context.Context, wa io.WriterAt) error {
+			return kc.DownloadFrom(ctx, key, wa)
+		}, n)
+	}
+
+	mf, err := downloadFrom(auto.ManifestKey(kc.Key()))
+	if err != nil {
+		return err
+	}
+	b, err := ioutil.ReadAll(mf)
+	mf.Close()
+	os.Remove(mf.Name())
+	if err != nil {
+		return err
+	}
+	m, err := auto.ParseManifest(b)
+	if err != nil {
+		return err
+	}
+
+	// Restore the full backup to a working file, and apply each delta to it.
+	db, err := os.CreateTemp("", "rqlite-downloader-db")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(db.Name())
+	defer db.Close()
+
+	ff, err := downloadFrom(m.Full)
+	if err != nil {
+		return err
+	}
+	err = decompressTo(db, ff)
+	ff.Close()
+	os.Remove(ff.Name())
+	if err != nil {
+		return err
+	}
+
+	for i, key := range m.Deltas {
+		if err := d.applyDelta(db, key, downloadFrom); err != nil {
+			return fmt.Errorf("failed to apply delta %d of %d: %s", i+1, len(m.Deltas), err.Error())
+		}
+	}
+
+	if _, err := db.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+	_, err = io.Copy(w, db)
+	return err
+}
+
+func (d *Downloader) applyDelta(db *os.File, key string, downloadFrom func(string) (*os.File, error)) error {
+	df, err := downloadFrom(key)
+	if err != nil {
+		return err
+	}
+	defer os.Remove(df.Name())
+	defer df.Close()
+
+	compressed, err := isGzip(df)
+	if err != nil {
+		return err
+	}
+	var r io.Reader = df
+	if compressed {
+		gzr, err := gzip.NewReader(df)
+		if err != nil {
+			return err
+		}
+		defer gzr.Close()
+		r = gzr
+	}
+	return auto.ApplyDelta(db, r)
+}
@@ -0,0 +1,151 @@
+package restore
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/rqlite/rqlite/auto"
+)
+
+func Test_DownloaderIncrementalNotKeyed(t *testing.T) {
+	d := NewDownloader(&mockStorageClient{})
+	if err := d.SetIncremental(true); err != ErrNotKeyedStorageClient {
+		t.Fatalf("expected ErrNotKeyedStorageClient, got %v", err)
+	}
+	if err := d.SetIncremental(false); err != nil {
+		t.Fatalf("unexpected error disabling incremental restore: %s", err.Error())
+	}
+}
+
+func Test_DownloaderIncremental(t *testing.T) {
+	dir := t.TempDir()
+	sc := &mockKeyedStorageClient{key: "db", objects: make(map[string][]byte)}
+
+	// Full backup, compressed.
+	db := fakeSQLiteFile(512, 3)
+	sc.objects["db.1.full"] = mustGzip(t, db)
+	idx, err := auto.NewPageIndex(mustWriteFile(t, filepath.Join(dir, "full"), db))
+	if err != nil {
+		t.Fatalf("failed to create page index: %s", err.Error())
+	}
+
+	// First delta changes a page, and is compressed.
+	db[512+1] = 'a'
+	idx, delta := mustDelta(t, filepath.Join(dir, "delta-1"), db, idx)
+	sc.objects["db.1.delta-1"] = mustGzip(t, delta)
+
+	// Second delta grows the database, and is not compressed.
+	db = append(db, bytes.Repeat([]byte{'b'}, 512)...)
+	_, delta = mustDelta(t, filepath.Join(dir, "delta-2"), db, idx)
+	sc.objects["db.1.delta-2"] = delta
+
+	m, err := json.Marshal(&auto.Manifest{
+		Version: auto.ManifestVersion,
+		Full:    "db.1.full",
+		Deltas:  []string{"db.1.delta-1", "db.1.delta-2"},
+	})
+	if err != nil {
+		t.Fatalf("failed to marshal manifest: %s", err.Error())
+	}
+	sc.objects["db.manifest"] = m
+
+	d := NewDownloader(sc)
+	if err := d.SetIncremental(true); err != nil {
+		t.Fatalf("failed to enable incremental restore: %s", err.Error())
+	}
+	var buf bytes.Buffer
+	if err := d.Do(context.Background(), &buf, 5*time.Second); err != nil {
+		t.Fatalf("failed to restore: %s", err.Error())
+	}
+	if !bytes.Equal(buf.Bytes(), db) {
+		t.Fatalf("restored database does not match")
+	}
+}
+
+func Test_DownloaderIncrementalMissingDelta(t *testing.T) {
+	sc := &mockKeyedStorageClient{key: "db", objects: map[string][]byte{
+		"db.manifest": []byte(`{"version":1,"full":"db.1.full","deltas":["db.1.delta-1"]}`),
+		"db.1.full":   fakeSQLiteFile(512, 1),
+	}}
+	d := NewDownloader(sc)
+	if err := d.SetIncremental(true); err != nil {
+		t.Fatalf("failed to enable incremental restore: %s", err.Error())
+	}
+	if err := d.Do(context.Background(), &bytes.Buffer{}, 5*time.Second); err == nil {
+		t.Fatalf("expected error restoring with missing delta")
+	}
+}
+
+type mockKeyedStorageClient struct {
+	key     string
+	objects map[string][]byte
+}
+
+func (m *mockKeyedStorageClient) Download(ctx context.Context, writer io.WriterAt) error {
+	return m.DownloadFrom(ctx, m.key, writer)
+}
+
+func (m *mockKeyedStorageClient) DownloadFrom(ctx context.Context, key string, writer io.WriterAt) error {
+	b, ok := m.objects[key]
+	if !ok {
+		return fmt.Errorf("no such key %s", key)
+	}
+	_, err := writer.WriteAt(b, 0)
+	return err
+}
+
+func (m *mockKeyedStorageClient) Key() string {
+	return m.key
+}
+
+func (m *mockKeyedStorageClient) String() string {
+	return "mockKeyedStorageClient"
+}
+
+func mustDelta(t *testing.T, path string, db []byte, prev *auto.PageIndex) (*auto.PageIndex, []byte) {
+	t.Helper()
+	var buf bytes.Buffer
+	idx, _, err := auto.WriteDelta(&buf, mustWriteFile(t, path, db), prev)
+	if err != nil {
+		t.Fatalf("failed to write delta: %s", err.Error())
+	}
+	return idx, buf.Bytes()
+}
+
+func mustGzip(t *testing.T, b []byte) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	gw := gzip.NewWriter(&buf)
+	if _, err := gw.Write(b); err != nil {
+		t.Fatalf("failed to compress: %s", err.Error())
+	}
+	if err := gw.Close(); err != nil {
+		t.Fatalf("failed to compress: %s", err.Error())
+	}
+	return buf.Bytes()
+}
+
+func mustWriteFile(t *testing.T, path string, b []byte) string {
+	t.Helper()
+	if err := os.WriteFile(path, b, 0644); err != nil {
+		t.Fatalf("failed to write file: %s", err.Error())
+	}
+	return path
+}
+
+// fakeSQLiteFile returns data with a SQLite header and the given page size.
+func fakeSQLiteFile(pageSize, numPages int) []byte {
+	b := make([]byte, pageSize*numPages)
+	copy(b, "SQLite format 3\x00")
+	binary.BigEndian.PutUint16(b[16:18], uint16(pageSize))
+	return b
+}
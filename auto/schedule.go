@@ -0,0 +1,143 @@
+package auto
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Schedule is a window of time, described by a cron expression, during which
+// an automatic operation may run. The expression has the standard five
+// fields -- minute, hour, day of month, month, and day of week -- each of
+// which may be '*', a value, a range 'a-b', a list 'a,b,c', or any of these
+// with a step, such as '*/15' or '0-30/10'. For example "* 1-4 * * *" is the
+// window from 01:00 to 04:59 every day, and "* * * * 0,6" is all of every
+// weekend.
+type Schedule struct {
+	expr string
+
+	minute uint64
+	hour   uint64
+	dom    uint64
+	month  uint64
+	dow    uint64
+
+	// domStar and dowStar record whether the day-of-month and day-of-week
+	// fields are unrestricted, which affects how they are combined.
+	domStar bool
+	dowStar bool
+}
+
+type scheduleField struct {
+	name     string
+	min, max int
+}
+
+var scheduleFields = []scheduleField{
+	{"minute", 0, 59},
+	{"hour", 0, 23},
+	{"day of month", 1, 31},
+	{"month", 1, 12},
+	{"day of week", 0, 7},
+}
+
+// ParseSchedule parses a cron expression and returns the Schedule.
+func ParseSchedule(expr string) (*Schedule, error) {
+	fields := strings.Fields(expr)
+	if len(fields) != len(scheduleFields) {
+		return nil, fmt.Errorf("schedule %q must have %d fields", expr, len(scheduleFields))
+	}
+
+	var bits [5]uint64
+	for i, f := range fields {
+		b, err := parseScheduleField(f, scheduleFields[i])
+		if err != nil {
+			return nil, fmt.Errorf("schedule %q: %s", expr, err.Error())
+		}
+		bits[i] = b
+	}
+
+	// Both 0 and 7 mean Sunday.
+	if bits[4]&(1<<7) != 0 {
+		bits[4] |= 1
+	}
+
+	return &Schedule{
+		expr:    expr,
+		minute:  bits[0],
+		hour:    bits[1],
+		dom:     bits[2],
+		month:   bits[3],
+		dow:     bits[4],
+		domStar: fields[2] == "*",
+		dowStar: fields[4] == "*",
+	}, nil
+}
+
+// Matches returns whether the given time falls within the schedule window.
+func (s *Schedule) Matches(t time.Time) bool {
+	if s.minute&(1<<uint(t.Minute())) == 0 ||
+		s.hour&(1<<uint(t.Hour())) == 0 ||
+		s.month&(1<<uint(t.Month())) == 0 {
+		return false
+	}
+
+	domOK := s.dom&(1<<uint(t.Day())) != 0
+	dowOK := s.dow&(1<<uint(t.Weekday())) != 0
+	if s.domStar || s.dowStar {
+		return domOK && dowOK
+	}
+	// Following cron, if both day fields are restricted either may match.
+	return domOK || dowOK
+}
+
+// String returns the cron expression of the Schedule.
+func (s *Schedule) String() string {
+	return s.expr
+}
+
+// parseScheduleField parses a single field of a cron expression, returning
+// the set of matching values as a bitmask.
+func parseScheduleField(field string, sf scheduleField) (uint64, error) {
+	var bits uint64
+	for _, part := range strings.Split(field, ",") {
+		rng, step := part, 1
+		if i := strings.Index(part, "/"); i >= 0 {
+			var err error
+			rng = part[:i]
+			step, err = strconv.Atoi(part[i+1:])
+			if err != nil || step <= 0 {
+				return 0, fmt.Errorf("invalid step in %s field: %q", sf.name, part)
+			}
+		}
+
+		lo, hi := sf.min, sf.max
+		if rng != "*" {
+			var err error
+			bounds := strings.SplitN(rng, "-", 2)
+			lo, err = strconv.Atoi(bounds[0])
+			if err != nil {
+				return 0, fmt.Errorf("invalid value in %s field: %q", sf.name, part)
+			}
+			hi = lo
+			if len(bounds) == 2 {
+				hi, err = strconv.Atoi(bounds[1])
+				if err != nil {
+					return 0, fmt.Errorf("invalid value in %s field: %q", sf.name, part)
+				}
+			} else if step != 1 {
+				// As in cron, "a/n" means from a to the maximum, in steps of n.
+				hi = sf.max
+			}
+		}
+		if lo < sf.min || hi > sf.max || lo > hi {
+			return 0, fmt.Errorf("%s field out of range %d-%d: %q", sf.name, sf.min, sf.max, part)
+		}
+
+		for v := lo; v <= hi; v += step {
+			bits |= 1 << uint(v)
+		}
+	}
+	return bits, nil
+}
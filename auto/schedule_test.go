@@ -0,0 +1,67 @@
+package auto
+
+import (
+	"testing"
+	"time"
+)
+
+func Test_ParseScheduleInvalid(t *testing.T) {
+	for _, expr := range []string{
+		"",
+		"* * * *",
+		"* * * * * *",
+		"60 * * * *",
+		"* 24 * * *",
+		"* * 0 * *",
+		"* * * 13 *",
+		"* * * * 8",
+		"5-1 * * * *",
+		"*/0 * * * *",
+		"a * * * *",
+	} {
+		if _, err := ParseSchedule(expr); err == nil {
+			t.Fatalf("expected error parsing %q", expr)
+		}
+	}
+}
+
+func Test_ScheduleMatches(t *testing.T) {
+	// 2023-06-04 was a Sunday.
+	sunday := time.Date(2023, 6, 4, 2, 30, 0, 0, time.UTC)
+	monday := sunday.AddDate(0, 0, 1)
+
+	for _, tt := range []struct {
+		expr string
+		t    time.Time
+		exp  bool
+	}{
+		{"* * * * *", sunday, true},
+		{"30 2 * * *", sunday, true},
+		{"31 2 * * *", sunday, false},
+		{"* 1-4 * * *", sunday, true},
+		{"* 3-4 * * *", sunday, false},
+		{"*/15 * * * *", sunday, true},
+		{"*/20 * * * *", sunday, false},
+		{"10/20 * * * *", sunday, true},
+		{"* * * * 0", sunday, true},
+		{"* * * * 7", sunday, true},
+		{"* * * * 0,6", monday, false},
+		{"* * * * 1-5", monday, true},
+		{"* * * 6 *", sunday, true},
+		{"* * * 7 *", sunday, false},
+		{"* * 4 * *", sunday, true},
+		{"* * 4 * *", monday, false},
+		// If both day fields are restricted, either may match.
+		{"* * 5 * 0", sunday, true},
+		{"* * 5 * 0", monday, true},
+		{"* * 6 * 0", monday, false},
+	} {
+		s, err := ParseSchedule(tt.expr)
+		if err != nil {
+			t.Fatalf("failed to parse %q: %s", tt.expr, err.Error())
+		}
+		if got := s.Matches(tt.t); got != tt.exp {
+			t.Fatalf("schedule %q at %s: expected %v, got %v", tt.expr, tt.t, tt.exp, got)
+		}
+	}
+}
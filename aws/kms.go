@@ -0,0 +1,31 @@
+package aws
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/kms"
+)
+
+// KMSDecrypt decrypts ciphertext, encrypted by AWS KMS, in the given region.
+// If region is empty, the region is taken from the environment. Credentials
+// are found using the default AWS credential chain.
+func KMSDecrypt(ctx context.Context, region string, ciphertext []byte) ([]byte, error) {
+	cfg := &aws.Config{}
+	if region != "" {
+		cfg.Region = aws.String(region)
+	}
+	sess, err := session.NewSession(cfg)
+	if err != nil {
+		return nil, err
+	}
+	out, err := kms.New(sess).DecryptWithContext(ctx, &kms.DecryptInput{
+		CiphertextBlob: ciphertext,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to decrypt with KMS: %w", err)
+	}
+	return out.Plaintext, nil
+}
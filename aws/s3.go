@@ -4,12 +4,15 @@ import (
 	"context"
 	"fmt"
 	"io"
+	"net/http"
 
 	"github.com/aws/aws-sdk-go/aws"
 	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/aws/request"
 	"github.com/aws/aws-sdk-go/aws/session"
 	"github.com/aws/aws-sdk-go/service/s3"
 	"github.com/aws/aws-sdk-go/service/s3/s3manager"
+	"github.com/rqlite/rqlite/rtls"
 )
 
 // S3Config is the subconfig for the S3 storage type
@@ -20,25 +23,58 @@ type S3Config struct {
 	SecretAccessKey string `json:"secret_access_key"`
 	Bucket          string `json:"bucket"`
 	Path            string `json:"path"`
+	ForcePathStyle  bool   `json:"force_path_style,omitempty"`
+	CACert          string `json:"ca_cert,omitempty"`
+	PartSize        int64  `json:"part_size,omitempty"`
+}
+
+// ClientOpts returns the S3 client options set in the config.
+func (c *S3Config) ClientOpts() *S3ClientOpts {
+	return &S3ClientOpts{
+		ForcePathStyle: c.ForcePathStyle,
+		CACertFile:     c.CACert,
+		PartSize:       c.PartSize,
+	}
+}
+
+// S3ClientOpts are options for creating an S3Client, useful when working
+// with S3-compatible stores such as MinIO or Ceph.
+type S3ClientOpts struct {
+	// ForcePathStyle requests path-style addressing (endpoint/bucket/key)
+	// instead of virtual-hosted-style addressing (bucket.endpoint/key).
+	ForcePathStyle bool
+
+	// CACertFile is the path to a PEM-encoded CA certificate bundle used
+	// to verify the endpoint's certificate. If not set, the system roots
+	// are used.
+	CACertFile string
+
+	// PartSize is the size, in bytes, of each part of a multipart upload
+	// or download. If zero, the AWS SDK default is used.
+	PartSize int64
 }
 
 // S3Client is a client for uploading data to S3.
 type S3Client struct {
-	endpoint  string
-	region    string
-	accessKey string
-	secretKey string
-	bucket    string
-	key       string
+	endpoint       string
+	region         string
+	accessKey      string
+	secretKey      string
+	bucket         string
+	key            string
+	forcePathStyle bool
+	partSize       int64
+	httpClient     *http.Client
 
 	// These fields are used for testing via dependency injection.
 	uploader   uploader
 	downloader downloader
+	deleter    deleter
 }
 
-// NewS3Client returns an instance of an S3Client.
-func NewS3Client(endpoint, region, accessKey, secretKey, bucket, key string) *S3Client {
-	return &S3Client{
+// NewS3Client returns an instance of an S3Client. opts may be nil.
+func NewS3Client(endpoint, region, accessKey, secretKey, bucket, key string, opts *S3ClientOpts) (*S3Client, error) {
+	c := &S3Client{
 		endpoint:  endpoint,
 		region:    region,
 		accessKey: accessKey,
@@ -46,6 +82,26 @@ func NewS3Client(endpoint, region, accessKey, secretKey, bucket, key string) *S3
 		bucket:    bucket,
 		key:       key,
 	}
+	if opts == nil {
+		return c, nil
+	}
+
+	if opts.PartSize != 0 && opts.PartSize < s3manager.MinUploadPartSize {
+		return nil, fmt.Errorf("part size must be at least %d bytes", s3manager.MinUploadPartSize)
+	}
+	c.forcePathStyle = opts.ForcePathStyle
+	c.partSize = opts.PartSize
+
+	if opts.CACertFile != "" {
+		tlsConfig, err := rtls.CreateClientConfig("", "", opts.CACertFile, false, false)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create TLS config for S3 client: %w", err)
+		}
+		tn := http.DefaultTransport.(*http.Transport).Clone()
+		tn.TLSClientConfig = tlsConfig
+		c.httpClient = &http.Client{Transport: tn}
+	}
+	return c, nil
 }
 
 // String returns a string representation of the S3Client.
@@ -53,8 +109,18 @@ func (s *S3Client) String() string {
 	return fmt.Sprintf("s3://%s/%s", s.bucket, s.key)
 }
 
+// Key returns the S3 key of the object the client uploads and downloads.
+func (s *S3Client) Key() string {
+	return s.key
+}
+
 // Upload uploads data to S3.
 func (s *S3Client) Upload(ctx context.Context, reader io.Reader) error {
+	return s.UploadTo(ctx, s.key, reader)
+}
+
+// UploadTo uploads data to S3, to the object with the given key.
+func (s *S3Client) UploadTo(ctx context.Context, key string, reader io.Reader) error {
 	sess, err := s.createSession()
 	if err != nil {
 		return err
@@ -63,18 +129,22 @@ func (s *S3Client) Upload(ctx context.Context, reader io.Reader) error {
 	// If an uploader was not provided, use a real S3 uploader.
 	var uploader uploader
 	if s.uploader == nil {
-		uploader = s3manager.NewUploader(sess)
+		uploader = s3manager.NewUploader(sess, func(u *s3manager.Uploader) {
+			if s.partSize != 0 {
+				u.PartSize = s.partSize
+			}
+		})
 	} else {
 		uploader = s.uploader
 	}
 
 	_, err = uploader.UploadWithContext(ctx, &s3manager.UploadInput{
 		Bucket: aws.String(s.bucket),
-		Key:    aws.String(s.key),
+		Key:    aws.String(key),
 		Body:   reader,
 	})
 	if err != nil {
-		return fmt.Errorf("failed to upload to %v: %w", s, err)
+		return fmt.Errorf("failed to upload to s3://%s/%s: %w", s.bucket, key, err)
 	}
 
 	return nil
@@ -82,6 +152,11 @@ func (s *S3Client) Upload(ctx context.Context, reader io.Reader) error {
 
 // Download downloads data from S3.
 func (s *S3Client) Download(ctx context.Context, writer io.WriterAt) error {
+	return s.DownloadFrom(ctx, s.key, writer)
+}
+
+// DownloadFrom downloads data from S3, from the object with the given key.
+func (s *S3Client) DownloadFrom(ctx context.Context, key string, writer io.WriterAt) error {
 	sess, err := s.createSession()
 	if err != nil {
 		return err
@@ -90,28 +165,61 @@ func (s *S3Client) Download(ctx context.Context, writer io.WriterAt) error {
 	// If a downloader was not provided, use a real S3 downloader.
 	var downloader downloader
 	if s.downloader == nil {
-		downloader = s3manager.NewDownloader(sess)
+		downloader = s3manager.NewDownloader(sess, func(d *s3manager.Downloader) {
+			if s.partSize != 0 {
+				d.PartSize = s.partSize
+			}
+		})
 	} else {
 		downloader = s.downloader
 	}
 
 	_, err = downloader.DownloadWithContext(ctx, writer, &s3.GetObjectInput{
 		Bucket: aws.String(s.bucket),
-		Key:    aws.String(s.key),
+		Key:    aws.String(key),
 	})
 	if err != nil {
-		return fmt.Errorf("failed to download from %v: %w", s, err)
+		return fmt.Errorf("failed to download from s3://%s/%s: %w", s.bucket, key, err)
 	}
 
 	return nil
 }
 
-func (s *S3Client) createSession() (*session.Session, error) {
-	sess, err := session.NewSession(&aws.Config{
-		Endpoint:    aws.String(s.endpoint),
-		Region:      aws.String(s.region),
-		Credentials: credentials.NewStaticCredentials(s.accessKey, s.secretKey, ""),
+// Delete deletes the object with the given key from S3.
+func (s *S3Client) Delete(ctx context.Context, key string) error {
+	// If a deleter was not provided, use a real S3 service client.
+	var deleter deleter
+	if s.deleter == nil {
+		sess, err := s.createSession()
+		if err != nil {
+			return err
+		}
+		deleter = s3.New(sess)
+	} else {
+		deleter = s.deleter
+	}
+
+	_, err := deleter.DeleteObjectWithContext(ctx, &s3.DeleteObjectInput{
+		Bucket: aws.String(s.bucket),
+		Key:    aws.String(key),
 	})
+	if err != nil {
+		return fmt.Errorf("failed to delete s3://%s/%s: %w", s.bucket, key, err)
+	}
+	return nil
+}
+
+func (s *S3Client) createSession() (*session.Session, error) {
+	cfg := &aws.Config{
+		Endpoint:         aws.String(s.endpoint),
+		Region:           aws.String(s.region),
+		Credentials:      credentials.NewStaticCredentials(s.accessKey, s.secretKey, ""),
+		S3ForcePathStyle: aws.Bool(s.forcePathStyle),
+	}
+	if s.httpClient != nil {
+		cfg.HTTPClient = s.httpClient
+	}
+	sess, err := session.NewSession(cfg)
 	if err != nil {
 		return nil, fmt.Errorf("failed to create S3 session: %w", err)
 	}
@@ -125,3 +233,7 @@ type uploader interface {
 type downloader interface {
 	DownloadWithContext(ctx aws.Context, w io.WriterAt, input *s3.GetObjectInput, opts ...func(*s3manager.Downloader)) (n int64, err error)
 }
+
+type deleter interface {
+	DeleteObjectWithContext(ctx aws.Context, input *s3.DeleteObjectInput, opts ...request.Option) (*s3.DeleteObjectOutput, error)
+}
@@ -3,18 +3,27 @@ package aws
 import (
 	"bytes"
 	"context"
+	"encoding/pem"
 	"fmt"
 	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
 	"strings"
 	"testing"
 
 	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/request"
 	"github.com/aws/aws-sdk-go/service/s3"
 	"github.com/aws/aws-sdk-go/service/s3/s3manager"
 )
 
 func Test_NewS3Client(t *testing.T) {
-	c := NewS3Client("endpoint1", "region1", "access", "secret", "bucket2", "key3")
+	c, err := NewS3Client("endpoint1", "region1", "access", "secret", "bucket2", "key3", nil)
+	if err != nil {
+		t.Fatalf("failed to create S3 client: %s", err.Error())
+	}
 	if c.region != "region1" {
 		t.Fatalf("expected region to be %q, got %q", "region1", c.region)
 	}
@@ -32,8 +41,76 @@ func Test_NewS3Client(t *testing.T) {
 	}
 }
 
+func Test_NewS3ClientOpts(t *testing.T) {
+	c, err := NewS3Client("endpoint1", "region1", "access", "secret", "bucket2", "key3", &S3ClientOpts{
+		ForcePathStyle: true,
+		PartSize:       s3manager.MinUploadPartSize * 2,
+	})
+	if err != nil {
+		t.Fatalf("failed to create S3 client: %s", err.Error())
+	}
+	if !c.forcePathStyle {
+		t.Fatalf("expected forcePathStyle to be true")
+	}
+	if c.partSize != s3manager.MinUploadPartSize*2 {
+		t.Fatalf("expected partSize to be %d, got %d", s3manager.MinUploadPartSize*2, c.partSize)
+	}
+	if c.httpClient != nil {
+		t.Fatalf("expected no custom HTTP client")
+	}
+
+	_, err = NewS3Client("endpoint1", "region1", "access", "secret", "bucket2", "key3", &S3ClientOpts{
+		PartSize: 1024,
+	})
+	if err == nil {
+		t.Fatalf("expected error for too-small part size")
+	}
+
+	_, err = NewS3Client("endpoint1", "region1", "access", "secret", "bucket2", "key3", &S3ClientOpts{
+		CACertFile: "/does/not/exist.pem",
+	})
+	if err == nil {
+		t.Fatalf("expected error for missing CA certificate file")
+	}
+}
+
+func Test_NewS3ClientCACert(t *testing.T) {
+	srv := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer srv.Close()
+
+	caFile, err := ioutil.TempFile("", "rqlite-s3-ca")
+	if err != nil {
+		t.Fatalf("failed to create CA file: %s", err.Error())
+	}
+	defer os.Remove(caFile.Name())
+	if err := pem.Encode(caFile, &pem.Block{Type: "CERTIFICATE", Bytes: srv.Certificate().Raw}); err != nil {
+		t.Fatalf("failed to write CA file: %s", err.Error())
+	}
+	caFile.Close()
+
+	c, err := NewS3Client(srv.URL, "region1", "access", "secret", "bucket2", "key3", &S3ClientOpts{
+		CACertFile: caFile.Name(),
+	})
+	if err != nil {
+		t.Fatalf("failed to create S3 client: %s", err.Error())
+	}
+	if c.httpClient == nil {
+		t.Fatalf("expected custom HTTP client")
+	}
+	resp, err := c.httpClient.Get(srv.URL)
+	if err != nil {
+		t.Fatalf("failed to connect to server using custom CA: %s", err.Error())
+	}
+	resp.Body.Close()
+}
+
 func Test_S3Client_String(t *testing.T) {
-	c := NewS3Client("endpoint1", "region1", "access", "secret", "bucket2", "key3")
+	c, err := NewS3Client("endpoint1", "region1", "access", "secret", "bucket2", "key3", nil)
+	if err != nil {
+		t.Fatalf("failed to create S3 client: %s", err.Error())
+	}
 	if c.String() != "s3://bucket2/key3" {
 		t.Fatalf("expected String() to be %q, got %q", "s3://bucket2/key3", c.String())
 	}
@@ -197,6 +274,59 @@ func TestS3ClientDownloadFail(t *testing.T) {
 	}
 }
 
+func TestS3ClientUploadToKey(t *testing.T) {
+	var uploadedKey string
+	client := &S3Client{
+		bucket: "your-bucket",
+		key:    "your/key/path",
+		uploader: &mockUploader{
+			uploadFn: func(ctx aws.Context, input *s3manager.UploadInput, opts ...func(*s3manager.Uploader)) (*s3manager.UploadOutput, error) {
+				uploadedKey = *input.Key
+				return &s3manager.UploadOutput{}, nil
+			},
+		},
+	}
+
+	if err := client.UploadTo(context.Background(), "your/key/path.manifest", strings.NewReader("data")); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if exp, got := "your/key/path.manifest", uploadedKey; exp != got {
+		t.Fatalf("expected key to be %q, got %q", exp, got)
+	}
+}
+
+func TestS3ClientDelete(t *testing.T) {
+	var deletedKey string
+	client := &S3Client{
+		bucket: "your-bucket",
+		key:    "your/key/path",
+		deleter: &mockDeleter{
+			deleteFn: func(ctx aws.Context, input *s3.DeleteObjectInput, opts ...request.Option) (*s3.DeleteObjectOutput, error) {
+				if *input.Bucket != "your-bucket" {
+					t.Errorf("expected bucket to be %q, got %q", "your-bucket", *input.Bucket)
+				}
+				deletedKey = *input.Key
+				return &s3.DeleteObjectOutput{}, nil
+			},
+		},
+	}
+
+	if err := client.Delete(context.Background(), "your/key/path.1.full"); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if exp, got := "your/key/path.1.full", deletedKey; exp != got {
+		t.Fatalf("expected key to be %q, got %q", exp, got)
+	}
+}
+
+type mockDeleter struct {
+	deleteFn func(ctx aws.Context, input *s3.DeleteObjectInput, opts ...request.Option) (*s3.DeleteObjectOutput, error)
+}
+
+func (m *mockDeleter) DeleteObjectWithContext(ctx aws.Context, input *s3.DeleteObjectInput, opts ...request.Option) (*s3.DeleteObjectOutput, error) {
+	return m.deleteFn(ctx, input, opts...)
+}
+
 type mockDownloader struct {
 	downloadFn func(ctx aws.Context, w io.WriterAt, input *s3.GetObjectInput, opts ...func(*s3manager.Downloader)) (n int64, err error)
 }
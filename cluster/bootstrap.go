@@ -41,6 +41,10 @@ type Bootstrapper struct {
 
 	username string
 	password string
+	token    string
+
+	collations []string
+	icu        bool
 
 	logger   *log.Logger
 	Interval time.Duration
@@ -63,6 +67,24 @@ func (b *Bootstrapper) SetBasicAuth(username, password string) {
 	b.username, b.password = username, password
 }
 
+// SetJoinToken sets the join token presented by any attempt to join an
+// existing cluster.
+func (b *Bootstrapper) SetJoinToken(token string) {
+	b.token = token
+}
+
+// SetCollations sets the collations reported by any attempt to join an
+// existing cluster.
+func (b *Bootstrapper) SetCollations(collations []string) {
+	b.collations = collations
+}
+
+// SetICU sets whether any attempt to join an existing cluster reports that
+// this node supports ICU.
+func (b *Bootstrapper) SetICU(icu bool) {
+	b.icu = icu
+}
+
 // Boot performs the bootstrapping process for this node. This means it will
 // ensure this node becomes part of a cluster. It does this by either joining
 // an existing cluster by explicitly joining it through one of these nodes,
@@ -106,6 +128,9 @@ func (b *Bootstrapper) Boot(id, raftAddr string, done func() bool, timeout time.
 			// Try an explicit join first. Joining an existing cluster is always given priority
 			// over trying to form a new cluster.
 			b.joiner.SetBasicAuth(b.username, b.password)
+			b.joiner.SetToken(b.token)
+			b.joiner.SetCollations(b.collations)
+			b.joiner.SetICU(b.icu)
 			if j, err := b.joiner.Do(targets, id, raftAddr, true); err == nil {
 				b.logger.Printf("succeeded directly joining cluster via node at %s", j)
 				return nil
@@ -33,6 +33,8 @@ type Client struct {
 	localNodeAddr string
 	localServ     *Service
 
+	signer *Signer
+
 	mu            sync.RWMutex
 	poolInitialSz int
 	pools         map[string]pool.Pool
@@ -64,6 +66,14 @@ func (c *Client) SetLocal(nodeAddr string, serv *Service) error {
 	return nil
 }
 
+// SetSigner sets the Signer the client uses to sign every command it sends.
+// If not set, commands are sent unsigned.
+func (c *Client) SetSigner(s *Signer) {
+	c.lMu.Lock()
+	defer c.lMu.Unlock()
+	c.signer = s
+}
+
 // GetNodeAPIAddr retrieves the API Address for the node at nodeAddr
 func (c *Client) GetNodeAPIAddr(nodeAddr string, timeout time.Duration) (string, error) {
 	c.lMu.RLock()
@@ -91,10 +101,40 @@ func (c *Client) GetNodeAPIAddr(nodeAddr string, timeout time.Duration) (string,
 	return a.Url, nil
 }
 
+// GetNodeInfo retrieves information about the node at the given Raft address.
+func (c *Client) GetNodeInfo(nodeAddr string, timeout time.Duration) (*NodeInfo, error) {
+	c.lMu.RLock()
+	defer c.lMu.RUnlock()
+	if c.localNodeAddr == nodeAddr && c.localServ != nil {
+		return c.localServ.GetNodeInfo(), nil
+	}
+
+	command := &Command{
+		Type: Command_COMMAND_TYPE_GET_NODE_INFO,
+	}
+	p, err := c.retry(command, nodeAddr, timeout)
+	if err != nil {
+		return nil, err
+	}
+
+	ni := &NodeInfo{}
+	if err := proto.Unmarshal(p, ni); err != nil {
+		return nil, fmt.Errorf("protobuf unmarshal: %w", err)
+	}
+	return ni, nil
+}
+
 // Execute performs an Execute on a remote node. If username is an empty string
 // no credential information will be included in the Execute request to the
 // remote node.
 func (c *Client) Execute(er *command.ExecuteRequest, nodeAddr string, creds *Credentials, timeout time.Duration) ([]*command.ExecuteResult, error) {
+	results, _, err := c.ExecuteWithIndex(er, nodeAddr, creds, timeout)
+	return results, err
+}
+
+// ExecuteWithIndex is like Execute, but also returns the index of the Raft
+// log entry which carried the request on the remote node.
+func (c *Client) ExecuteWithIndex(er *command.ExecuteRequest, nodeAddr string, creds *Credentials, timeout time.Duration) ([]*command.ExecuteResult, uint64, error) {
 	command := &Command{
 		Type: Command_COMMAND_TYPE_EXECUTE,
 		Request: &Command_ExecuteRequest{
@@ -104,19 +144,19 @@ func (c *Client) Execute(er *command.ExecuteRequest, nodeAddr string, creds *Cre
 	}
 	p, err := c.retry(command, nodeAddr, timeout)
 	if err != nil {
-		return nil, err
+		return nil, 0, err
 	}
 
 	a := &CommandExecuteResponse{}
 	err = proto.Unmarshal(p, a)
 	if err != nil {
-		return nil, err
+		return nil, 0, err
 	}
 
 	if a.Error != "" {
-		return nil, errors.New(a.Error)
+		return nil, 0, errors.New(a.Error)
 	}
-	return a.Results, nil
+	return a.Results, a.RaftIndex, nil
 }
 
 // Query performs a Query on a remote node.
@@ -147,6 +187,14 @@ func (c *Client) Query(qr *command.QueryRequest, nodeAddr string, creds *Credent
 
 // Request performs an ExecuteQuery on a remote node.
 func (c *Client) Request(r *command.ExecuteQueryRequest, nodeAddr string, creds *Credentials, timeout time.Duration) ([]*command.ExecuteQueryResponse, error) {
+	results, _, err := c.RequestWithIndex(r, nodeAddr, creds, timeout)
+	return results, err
+}
+
+// RequestWithIndex is like Request, but also returns the index of the Raft
+// log entry which carried the request on the remote node. The index is 0 if
+// the request did not go through the Raft log.
+func (c *Client) RequestWithIndex(r *command.ExecuteQueryRequest, nodeAddr string, creds *Credentials, timeout time.Duration) ([]*command.ExecuteQueryResponse, uint64, error) {
 	command := &Command{
 		Type: Command_COMMAND_TYPE_REQUEST,
 		Request: &Command_ExecuteQueryRequest{
@@ -156,19 +204,19 @@ func (c *Client) Request(r *command.ExecuteQueryRequest, nodeAddr string, creds
 	}
 	p, err := c.retry(command, nodeAddr, timeout)
 	if err != nil {
-		return nil, err
+		return nil, 0, err
 	}
 
 	a := &CommandRequestResponse{}
 	err = proto.Unmarshal(p, a)
 	if err != nil {
-		return nil, err
+		return nil, 0, err
 	}
 
 	if a.Error != "" {
-		return nil, errors.New(a.Error)
+		return nil, 0, errors.New(a.Error)
 	}
-	return a.Response, nil
+	return a.Response, a.RaftIndex, nil
 }
 
 // Backup retrieves a backup from a remote node and writes to the io.Writer
@@ -249,7 +297,7 @@ func (c *Client) RemoveNode(rn *command.RemoveNodeRequest, nodeAddr string, cred
 		},
 		Credentials: creds,
 	}
-	if err := writeCommand(conn, command, timeout); err != nil {
+	if err := c.writeCommand(conn, command, timeout); err != nil {
 		handleConnError(conn)
 		return err
 	}
@@ -287,7 +335,7 @@ func (c *Client) Notify(nr *command.NotifyRequest, nodeAddr string, timeout time
 			NotifyRequest: nr,
 		},
 	}
-	if err := writeCommand(conn, command, timeout); err != nil {
+	if err := c.writeCommand(conn, command, timeout); err != nil {
 		handleConnError(conn)
 		return err
 	}
@@ -326,7 +374,7 @@ func (c *Client) Join(jr *command.JoinRequest, nodeAddr string, timeout time.Dur
 		},
 	}
 
-	if err := writeCommand(conn, command, timeout); err != nil {
+	if err := c.writeCommand(conn, command, timeout); err != nil {
 		handleConnError(conn)
 		return err
 	}
@@ -349,6 +397,52 @@ func (c *Client) Join(jr *command.JoinRequest, nodeAddr string, timeout time.Dur
 	return nil
 }
 
+// Probe sends a payload of the given size to a remote node, returning the time
+// taken for the node to receive it and reply. Probes are never retried, so
+// that the time returned is that of a single exchange.
+func (c *Client) Probe(nodeAddr string, size int, timeout time.Duration) (time.Duration, error) {
+	conn, err := c.dial(nodeAddr, c.timeout)
+	if err != nil {
+		return 0, err
+	}
+	defer conn.Close()
+
+	// Create the request.
+	command := &Command{
+		Type: Command_COMMAND_TYPE_PROBE,
+		Request: &Command_ProbeRequest{
+			ProbeRequest: &ProbeRequest{Payload: make([]byte, size)},
+		},
+	}
+
+	start := time.Now()
+	if err := c.writeCommand(conn, command, timeout); err != nil {
+		handleConnError(conn)
+		return 0, err
+	}
+
+	p, err := readResponse(conn, timeout)
+	if err != nil {
+		handleConnError(conn)
+		return 0, err
+	}
+	elapsed := time.Since(start)
+
+	a := &CommandProbeResponse{}
+	err = proto.Unmarshal(p, a)
+	if err != nil {
+		return 0, err
+	}
+
+	if a.Error != "" {
+		return 0, errors.New(a.Error)
+	}
+	if a.Size != int64(size) {
+		return 0, fmt.Errorf("probe of %d bytes received as %d bytes", size, a.Size)
+	}
+	return elapsed, nil
+}
+
 // Stats returns stats on the Client instance
 func (c *Client) Stats() (map[string]interface{}, error) {
 	c.mu.RLock()
@@ -430,7 +524,7 @@ func (c *Client) retry(command *Command, nodeAddr string, timeout time.Duration)
 			}
 			defer conn.Close()
 
-			if errInner = writeCommand(conn, command, timeout); errInner != nil {
+			if errInner = c.writeCommand(conn, command, timeout); errInner != nil {
 				handleConnError(conn)
 				return nil, errInner
 			}
@@ -454,8 +548,18 @@ func (c *Client) retry(command *Command, nodeAddr string, timeout time.Duration)
 	return p, nil
 }
 
-func writeCommand(conn net.Conn, c *Command, timeout time.Duration) error {
-	p, err := proto.Marshal(c)
+func (c *Client) writeCommand(conn net.Conn, command *Command, timeout time.Duration) error {
+	c.lMu.RLock()
+	signer := c.signer
+	c.lMu.RUnlock()
+
+	var p []byte
+	var err error
+	if signer != nil {
+		p, err = signer.Sign(command)
+	} else {
+		p, err = proto.Marshal(command)
+	}
 	if err != nil {
 		return fmt.Errorf("command marshal: %w", err)
 	}
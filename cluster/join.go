@@ -25,6 +25,11 @@ var (
 	// ErrJoinFailed is returned when a node fails to join a cluster
 	ErrJoinFailed = errors.New("failed to join cluster")
 
+	// ErrJoinConflict is returned when a node is refused membership of a
+	// cluster because another member is live with the same ID. Retrying
+	// will not succeed.
+	ErrJoinConflict = errors.New("node ID conflicts with live member of cluster")
+
 	// ErrNotifyFailed is returned when a node fails to notify another node
 	ErrNotifyFailed = errors.New("failed to notify node")
 )
@@ -39,6 +44,10 @@ type Joiner struct {
 	username string
 	password string
 
+	token      string
+	collations []string
+	icu        bool
+
 	client *http.Client
 
 	logger *log.Logger
@@ -87,10 +96,34 @@ func (j *Joiner) SetBasicAuth(username, password string) {
 	j.username, j.password = username, password
 }
 
+// SetToken sets the join token presented by any join attempt, which the
+// cluster may require before allowing the node to join.
+func (j *Joiner) SetToken(token string) {
+	j.token = token
+}
+
+// Token returns the join token presented by any join attempt.
+func (j *Joiner) Token() string {
+	return j.token
+}
+
+// SetCollations sets the collations this node reports to the cluster, which
+// refuses the node membership if it lacks any collation the cluster has.
+func (j *Joiner) SetCollations(collations []string) {
+	j.collations = collations
+}
+
+// SetICU sets whether this node reports that it supports ICU. The cluster
+// refuses the node membership unless it matches the cluster.
+func (j *Joiner) SetICU(icu bool) {
+	j.icu = icu
+}
+
 // Do makes the actual join request. If any of the join addresses do not contain a
 // protocol, both http:// and https:// are tried for that address. If the join is successful
 // with any address, the Join URL of the node that joined is returned. Otherwise, an error
-// is returned.
+// is returned. If another member of the cluster is live with the same ID, an error wrapping
+// ErrJoinConflict is returned at once, without further attempts.
 func (j *Joiner) Do(joinAddrs []string, id, addr string, voter bool) (string, error) {
 	if id == "" {
 		return "", ErrNodeIDRequired
@@ -105,6 +138,9 @@ func (j *Joiner) Do(joinAddrs []string, id, addr string, voter bool) (string, er
 				// Success!
 				return joinee, nil
 			}
+			if errors.Is(err, ErrJoinConflict) {
+				return "", err
+			}
 			j.logger.Printf("failed to join via node at %s: %s", a, err)
 		}
 		if i+1 < j.numAttempts {
@@ -119,11 +155,21 @@ func (j *Joiner) Do(joinAddrs []string, id, addr string, voter bool) (string, er
 
 func (j *Joiner) join(joinAddr, id, addr string, voter bool) (string, error) {
 	fullAddr := fmt.Sprintf("%s/join", joinAddr)
-	reqBody, err := json.Marshal(map[string]interface{}{
+	body := map[string]interface{}{
 		"id":    id,
 		"addr":  addr,
 		"voter": voter,
-	})
+	}
+	if j.token != "" {
+		body["token"] = j.token
+	}
+	if len(j.collations) > 0 {
+		body["collations"] = j.collations
+	}
+	if j.icu {
+		body["icu"] = true
+	}
+	reqBody, err := json.Marshal(body)
 	if err != nil {
 		return "", err
 	}
@@ -169,6 +215,8 @@ func (j *Joiner) join(joinAddr, id, addr string, voter bool) (string, error) {
 				return "", ErrInvalidRedirect
 			}
 			continue
+		case http.StatusConflict:
+			return "", fmt.Errorf("%w: %s", ErrJoinConflict, strings.TrimSpace(string(respB)))
 		default:
 			return "", fmt.Errorf("%s: (%s)", resp.Status, string(respB))
 		}
@@ -3,10 +3,12 @@ package cluster
 import (
 	"crypto/tls"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"net/http"
 	"net/http/httptest"
+	"strings"
 	"testing"
 	"time"
 
@@ -205,6 +207,66 @@ func Test_SingleJoinOKBasicAuth(t *testing.T) {
 	}
 }
 
+func Test_SingleJoinOKToken(t *testing.T) {
+	var body map[string]interface{}
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		b, err := io.ReadAll(r.Body)
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		if err := json.Unmarshal(b, &body); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+	}))
+	defer ts.Close()
+
+	joiner := NewJoiner("127.0.0.1", numAttempts, attemptInterval, nil)
+	if _, err := joiner.Do([]string{ts.URL}, "id0", "127.0.0.1:9090", true); err != nil {
+		t.Fatalf("failed to join a single node: %s", err.Error())
+	}
+	if _, ok := body["token"]; ok {
+		t.Fatalf("token supplied though none set")
+	}
+
+	joiner.SetToken("token1")
+	if _, err := joiner.Do([]string{ts.URL}, "id0", "127.0.0.1:9090", true); err != nil {
+		t.Fatalf("failed to join a single node: %s", err.Error())
+	}
+	if got, exp := body["token"], "token1"; got != exp {
+		t.Fatalf("wrong token supplied, exp %s, got %v", exp, got)
+	}
+}
+
+func Test_SingleJoinOKCollations(t *testing.T) {
+	var body map[string]interface{}
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body = nil
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+	}))
+	defer ts.Close()
+
+	joiner := NewJoiner("127.0.0.1", numAttempts, attemptInterval, nil)
+	if _, err := joiner.Do([]string{ts.URL}, "id0", "127.0.0.1:9090", true); err != nil {
+		t.Fatalf("failed to join a single node: %s", err.Error())
+	}
+	if _, ok := body["collations"]; ok {
+		t.Fatalf("collations supplied though none set")
+	}
+
+	joiner.SetCollations([]string{"UNICODE", "UNICODE_CI"})
+	if _, err := joiner.Do([]string{ts.URL}, "id0", "127.0.0.1:9090", true); err != nil {
+		t.Fatalf("failed to join a single node: %s", err.Error())
+	}
+	if got, exp := fmt.Sprint(body["collations"]), "[UNICODE UNICODE_CI]"; got != exp {
+		t.Fatalf("wrong collations supplied, exp %s, got %s", exp, got)
+	}
+}
+
 func Test_SingleJoinZeroAttempts(t *testing.T) {
 	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		t.Fatalf("handler should not have been called")
@@ -230,6 +292,27 @@ func Test_SingleJoinFail(t *testing.T) {
 	}
 }
 
+func Test_SingleJoinConflict(t *testing.T) {
+	var n int
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n++
+		http.Error(w, "node ID is in use by another live node", http.StatusConflict)
+	}))
+	defer ts.Close()
+
+	joiner := NewJoiner("", 3, attemptInterval, nil)
+	_, err := joiner.Do([]string{ts.URL}, "id0", "127.0.0.1:9090", true)
+	if !errors.Is(err, ErrJoinConflict) {
+		t.Fatalf("wrong error returned for conflicting join: %v", err)
+	}
+	if !strings.Contains(err.Error(), "in use by another live node") {
+		t.Fatalf("error does not include reason for conflict: %s", err.Error())
+	}
+	if n != 1 {
+		t.Fatalf("conflicting join retried, made %d attempts", n)
+	}
+}
+
 func Test_DoubleJoinOK(t *testing.T) {
 	ts1 := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 	}))
@@ -0,0 +1,213 @@
+package cluster
+
+import (
+	"expvar"
+	"log"
+	"os"
+	"sort"
+	"sync"
+	"time"
+)
+
+// peerStats holds the latest measurements of each other node in the cluster,
+// keyed by Raft address.
+var peerStats *expvar.Map
+
+func init() {
+	peerStats = expvar.NewMap("cluster_peers")
+}
+
+// NodeLister returns the Raft addresses of the other nodes in the cluster.
+type NodeLister func() ([]string, error)
+
+// LatencyProber periodically measures the round-trip time from this node to
+// every other node in the cluster and, optionally, the bandwidth available
+// to each. Results are also published as expvar stats.
+type LatencyProber struct {
+	client   *Client
+	nodes    NodeLister
+	interval time.Duration
+	timeout  time.Duration
+
+	// BandwidthProbeSize is the size of the payload sent to each node to
+	// measure the bandwidth available to it. If 0, bandwidth is not measured.
+	BandwidthProbeSize int
+
+	// WarnLatency is the round-trip time above which a warning is logged,
+	// as the node is then likely to miss Raft heartbeats. If 0, no warnings
+	// are logged.
+	WarnLatency time.Duration
+
+	mu        sync.RWMutex
+	latencies map[string]*NodeLatency
+	slow      map[string]bool // Nodes currently above WarnLatency.
+
+	closeCh chan struct{}
+	doneCh  chan struct{}
+
+	logger *log.Logger
+}
+
+// NewLatencyProber returns a LatencyProber which measures the round-trip time
+// to the nodes listed by nodes every interval.
+func NewLatencyProber(client *Client, nodes NodeLister, interval, timeout time.Duration) *LatencyProber {
+	return &LatencyProber{
+		client:    client,
+		nodes:     nodes,
+		interval:  interval,
+		timeout:   timeout,
+		latencies: make(map[string]*NodeLatency),
+		slow:      make(map[string]bool),
+		logger:    log.New(os.Stderr, "[cluster-prober] ", log.LstdFlags),
+	}
+}
+
+// Start starts probing.
+func (p *LatencyProber) Start() {
+	p.closeCh = make(chan struct{})
+	p.doneCh = make(chan struct{})
+	go func() {
+		defer close(p.doneCh)
+		tck := time.NewTicker(p.interval)
+		defer tck.Stop()
+		for {
+			select {
+			case <-tck.C:
+				p.probe()
+			case <-p.closeCh:
+				return
+			}
+		}
+	}()
+}
+
+// Stop stops probing.
+func (p *LatencyProber) Stop() {
+	close(p.closeCh)
+	<-p.doneCh
+}
+
+// Latencies returns the round-trip time to, and bandwidth available to, each
+// node which answered its last probe, sorted by address.
+func (p *LatencyProber) Latencies() []*NodeLatency {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	lats := make([]*NodeLatency, 0, len(p.latencies))
+	for _, l := range p.latencies {
+		lats = append(lats, &NodeLatency{Addr: l.Addr, Rtt: l.Rtt, Bandwidth: l.Bandwidth})
+	}
+	sort.Slice(lats, func(i, j int) bool { return lats[i].Addr < lats[j].Addr })
+	return lats
+}
+
+// probe measures each node, concurrently. Nodes which do not answer, or which
+// are no longer in the cluster, are forgotten.
+func (p *LatencyProber) probe() {
+	addrs, err := p.nodes()
+	if err != nil {
+		p.logger.Printf("failed to list nodes to probe: %s", err.Error())
+		return
+	}
+
+	var mu sync.Mutex
+	latencies := make(map[string]*NodeLatency, len(addrs))
+	var wg sync.WaitGroup
+	for _, addr := range addrs {
+		wg.Add(1)
+		go func(addr string) {
+			defer wg.Done()
+			l, err := p.measure(addr)
+			if err != nil {
+				stats.Add(numLatencyProbeFailures, 1)
+				return
+			}
+			mu.Lock()
+			latencies[addr] = l
+			mu.Unlock()
+		}(addr)
+	}
+	wg.Wait()
+	stats.Add(numLatencyProbes, 1)
+
+	p.mu.Lock()
+	p.latencies = latencies
+	p.mu.Unlock()
+	p.warn(latencies)
+	publishPeerStats(latencies)
+}
+
+// measure measures the round-trip time to the node at addr with an empty
+// probe and then, if enabled, the bandwidth available to it. Bandwidth is the
+// size of the larger probe divided by the time taken to send it, less the
+// round-trip time.
+func (p *LatencyProber) measure(addr string) (*NodeLatency, error) {
+	rtt, err := p.client.Probe(addr, 0, p.timeout)
+	if err != nil {
+		return nil, err
+	}
+	l := &NodeLatency{Addr: addr, Rtt: rtt.Nanoseconds()}
+	if p.BandwidthProbeSize == 0 {
+		return l, nil
+	}
+
+	d, err := p.client.Probe(addr, p.BandwidthProbeSize, p.timeout)
+	if err != nil {
+		return nil, err
+	}
+	if d > rtt {
+		l.Bandwidth = int64(float64(p.BandwidthProbeSize) / (d - rtt).Seconds())
+	}
+	return l, nil
+}
+
+// warn logs a warning for each node whose round-trip time has risen above
+// WarnLatency, and notes those which have since recovered.
+func (p *LatencyProber) warn(latencies map[string]*NodeLatency) {
+	if p.WarnLatency == 0 {
+		return
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for addr, l := range latencies {
+		rtt := time.Duration(l.Rtt)
+		if rtt > p.WarnLatency && !p.slow[addr] {
+			p.slow[addr] = true
+			stats.Add(numLatencyWarnings, 1)
+			p.logger.Printf("round-trip time to node %s is %s, above %s, so may cause spurious Raft elections",
+				addr, rtt, p.WarnLatency)
+		} else if rtt <= p.WarnLatency && p.slow[addr] {
+			delete(p.slow, addr)
+			p.logger.Printf("round-trip time to node %s is %s, back below %s", addr, rtt, p.WarnLatency)
+		}
+	}
+	for addr := range p.slow {
+		if _, ok := latencies[addr]; !ok {
+			delete(p.slow, addr)
+		}
+	}
+}
+
+// publishPeerStats replaces the expvar stats of each node with latencies.
+func publishPeerStats(latencies map[string]*NodeLatency) {
+	var gone []string
+	peerStats.Do(func(kv expvar.KeyValue) {
+		if _, ok := latencies[kv.Key]; !ok {
+			gone = append(gone, kv.Key)
+		}
+	})
+	for _, addr := range gone {
+		peerStats.Delete(addr)
+	}
+	for addr, l := range latencies {
+		m := new(expvar.Map).Init()
+		rtt := new(expvar.Float)
+		rtt.Set(time.Duration(l.Rtt).Seconds())
+		m.Set("rtt", rtt)
+		if l.Bandwidth > 0 {
+			bw := new(expvar.Int)
+			bw.Set(l.Bandwidth)
+			m.Set("bandwidth", bw)
+		}
+		peerStats.Set(addr, m)
+	}
+}
@@ -0,0 +1,132 @@
+package cluster
+
+import (
+	"errors"
+	"expvar"
+	"testing"
+	"time"
+)
+
+func Test_NewServiceGetNodeInfo(t *testing.T) {
+	ml := mustNewMockTransport()
+	s := New(ml, mustNewMockDatabase(), mustNewMockManager(), mustNewMockCredentialStore())
+	if err := s.Open(); err != nil {
+		t.Fatalf("failed to open cluster service")
+	}
+	defer s.Close()
+	s.SetAPIAddr("foo")
+
+	c := NewClient(ml, 30*time.Second)
+	ni, err := c.GetNodeInfo(s.Addr(), 5*time.Second)
+	if err != nil {
+		t.Fatalf("failed to get node info: %s", err)
+	}
+	if ni.ApiUrl != "http://foo" || ni.Version != "" {
+		t.Fatalf("wrong node info without info function: %v", ni)
+	}
+
+	s.SetNodeInfoFunc(func() *NodeInfo {
+		return &NodeInfo{
+			Version:      "v1.2.3",
+			Locality:     "us-east-1a",
+			AppliedIndex: 7,
+			Latencies:    []*NodeLatency{{Addr: "bar:4002", Rtt: 1000}},
+		}
+	})
+	ni, err = c.GetNodeInfo(s.Addr(), 5*time.Second)
+	if err != nil {
+		t.Fatalf("failed to get node info: %s", err)
+	}
+	if ni.ApiUrl != "http://foo" || ni.Version != "v1.2.3" || ni.Locality != "us-east-1a" ||
+		ni.AppliedIndex != 7 || len(ni.Latencies) != 1 || ni.Latencies[0].Rtt != 1000 {
+		t.Fatalf("wrong node info: %v", ni)
+	}
+}
+
+func Test_LatencyProber(t *testing.T) {
+	ml := mustNewMockTransport()
+	s := New(ml, mustNewMockDatabase(), mustNewMockManager(), mustNewMockCredentialStore())
+	if err := s.Open(); err != nil {
+		t.Fatalf("failed to open cluster service")
+	}
+	defer s.Close()
+
+	c := NewClient(ml, 30*time.Second)
+	var listErr error
+	nodes := func() ([]string, error) {
+		return []string{s.Addr(), "127.0.0.1:0"}, listErr
+	}
+	p := NewLatencyProber(c, nodes, time.Hour, time.Second)
+
+	p.probe()
+	lats := p.Latencies()
+	if len(lats) != 1 || lats[0].Addr != s.Addr() || lats[0].Rtt <= 0 {
+		t.Fatalf("wrong latencies: %v", lats)
+	}
+
+	// Latencies are kept if the nodes cannot be listed.
+	listErr = errors.New("no nodes")
+	p.probe()
+	if len(p.Latencies()) != 1 {
+		t.Fatalf("latencies lost when nodes could not be listed")
+	}
+
+	p.Start()
+	p.Stop()
+}
+
+func Test_LatencyProberBandwidth(t *testing.T) {
+	ml := mustNewMockTransport()
+	s := New(ml, mustNewMockDatabase(), mustNewMockManager(), mustNewMockCredentialStore())
+	if err := s.Open(); err != nil {
+		t.Fatalf("failed to open cluster service")
+	}
+	defer s.Close()
+
+	c := NewClient(ml, 30*time.Second)
+	nodes := func() ([]string, error) {
+		return []string{s.Addr()}, nil
+	}
+	p := NewLatencyProber(c, nodes, time.Hour, time.Second)
+	p.BandwidthProbeSize = 1024 * 1024
+	p.WarnLatency = time.Nanosecond
+
+	warnings := stats.Get(numLatencyWarnings).(*expvar.Int).Value()
+	p.probe()
+	lats := p.Latencies()
+	if len(lats) != 1 || lats[0].Rtt <= 0 || lats[0].Bandwidth <= 0 {
+		t.Fatalf("wrong latencies: %v", lats)
+	}
+	if exp, got := warnings+1, stats.Get(numLatencyWarnings).(*expvar.Int).Value(); exp != got {
+		t.Fatalf("wrong number of latency warnings, exp %d, got %d", exp, got)
+	}
+	if peerStats.Get(s.Addr()) == nil {
+		t.Fatalf("node missing from peer stats")
+	}
+
+	// A node still above the threshold is not warned about again.
+	p.probe()
+	if exp, got := warnings+1, stats.Get(numLatencyWarnings).(*expvar.Int).Value(); exp != got {
+		t.Fatalf("wrong number of latency warnings, exp %d, got %d", exp, got)
+	}
+}
+
+func Test_ClientProbe(t *testing.T) {
+	ml := mustNewMockTransport()
+	s := New(ml, mustNewMockDatabase(), mustNewMockManager(), mustNewMockCredentialStore())
+	if err := s.Open(); err != nil {
+		t.Fatalf("failed to open cluster service")
+	}
+	defer s.Close()
+
+	c := NewClient(ml, 30*time.Second)
+	for _, sz := range []int{0, 100, 1024 * 1024} {
+		d, err := c.Probe(s.Addr(), sz, 5*time.Second)
+		if err != nil {
+			t.Fatalf("failed to probe with %d bytes: %s", sz, err)
+		}
+		if d <= 0 {
+			t.Fatalf("wrong probe duration for %d bytes: %s", sz, d)
+		}
+	}
+}
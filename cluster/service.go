@@ -25,6 +25,7 @@ var stats *expvar.Map
 const (
 	numGetNodeAPIRequest  = "num_get_node_api_req"
 	numGetNodeAPIResponse = "num_get_node_api_resp"
+	numGetNodeInfoRequest = "num_get_node_info_req"
 	numExecuteRequest     = "num_execute_req"
 	numQueryRequest       = "num_query_req"
 	numRequestRequest     = "num_request_req"
@@ -33,7 +34,14 @@ const (
 	numRemoveNodeRequest  = "num_remove_node_req"
 	numNotifyRequest      = "num_notify_req"
 	numJoinRequest        = "num_join_req"
+	numProbeRequest       = "num_probe_req"
 	numClientRetries      = "num_client_retries"
+	numBadSignatures      = "num_bad_signatures"
+
+	// Latency prober stats for this package.
+	numLatencyProbes        = "num_latency_probes"
+	numLatencyProbeFailures = "num_latency_probe_failures"
+	numLatencyWarnings      = "num_latency_warnings"
 
 	// Client stats for this package.
 	numGetNodeAPIRequestLocal = "num_get_node_api_req_local"
@@ -51,6 +59,7 @@ func init() {
 	stats = expvar.NewMap("cluster")
 	stats.Add(numGetNodeAPIRequest, 0)
 	stats.Add(numGetNodeAPIResponse, 0)
+	stats.Add(numGetNodeInfoRequest, 0)
 	stats.Add(numExecuteRequest, 0)
 	stats.Add(numQueryRequest, 0)
 	stats.Add(numRequestRequest, 0)
@@ -60,7 +69,12 @@ func init() {
 	stats.Add(numGetNodeAPIRequestLocal, 0)
 	stats.Add(numNotifyRequest, 0)
 	stats.Add(numJoinRequest, 0)
+	stats.Add(numProbeRequest, 0)
 	stats.Add(numClientRetries, 0)
+	stats.Add(numBadSignatures, 0)
+	stats.Add(numLatencyProbes, 0)
+	stats.Add(numLatencyProbeFailures, 0)
+	stats.Add(numLatencyWarnings, 0)
 }
 
 // Dialer is the interface dialers must implement.
@@ -76,12 +90,20 @@ type Database interface {
 	// to return rows.
 	Execute(er *command.ExecuteRequest) ([]*command.ExecuteResult, error)
 
+	// ExecuteWithIndex is like Execute, but also returns the index of the
+	// Raft log entry which carried the request.
+	ExecuteWithIndex(er *command.ExecuteRequest) ([]*command.ExecuteResult, uint64, error)
+
 	// Query executes a slice of queries, each of which returns rows.
 	Query(qr *command.QueryRequest) ([]*command.QueryRows, error)
 
 	// Request processes a request that can both executes and queries.
 	Request(rr *command.ExecuteQueryRequest) ([]*command.ExecuteQueryResponse, error)
 
+	// RequestWithIndex is like Request, but also returns the index of the
+	// Raft log entry which carried the request, or 0 if there was none.
+	RequestWithIndex(rr *command.ExecuteQueryRequest) ([]*command.ExecuteQueryResponse, uint64, error)
+
 	// Backup writes a backup of the database to the writer.
 	Backup(br *command.BackupRequest, dst io.Writer) error
 
@@ -106,6 +128,10 @@ type Manager interface {
 type CredentialStore interface {
 	// AA authenticates and checks authorization for the given perm.
 	AA(username, password, perm string) bool
+
+	// AAQuery authenticates and checks authorization for a query which
+	// reads the given tables. A nil tables means the query is not read-only.
+	AAQuery(username, password string, tables []string) bool
 }
 
 // Transport is the interface the network layer must provide.
@@ -127,6 +153,10 @@ type Service struct {
 	mu      sync.RWMutex
 	https   bool   // Serving HTTPS?
 	apiAddr string // host:port this node serves the HTTP API.
+	signer  *Signer
+	audit   *log.Logger
+
+	nodeInfoFn func() *NodeInfo // Returns information about this node.
 
 	logger *log.Logger
 }
@@ -175,6 +205,50 @@ func (s *Service) SetAPIAddr(addr string) {
 	s.apiAddr = addr
 }
 
+// SetSigner sets the Signer used to verify received commands. Once set,
+// commands which are not signed with the cluster's key are refused.
+func (s *Service) SetSigner(signer *Signer) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.signer = signer
+}
+
+// EnableAudit tells the cluster service whether to log each command, received
+// from another node, which changes the database or cluster. The log records the
+// node which sent the command and the user on whose behalf it was sent.
+func (s *Service) EnableAudit(b bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if b {
+		s.audit = log.New(os.Stderr, "[cluster-audit] ", log.LstdFlags)
+	} else {
+		s.audit = nil
+	}
+}
+
+// SetNodeInfoFunc sets the function which returns information about this
+// node, such as its version and locality, served to other nodes so that the
+// topology of the cluster may be shown.
+func (s *Service) SetNodeInfoFunc(f func() *NodeInfo) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.nodeInfoFn = f
+}
+
+// GetNodeInfo returns information about the node running this service.
+func (s *Service) GetNodeInfo() *NodeInfo {
+	s.mu.RLock()
+	f := s.nodeInfoFn
+	s.mu.RUnlock()
+
+	ni := &NodeInfo{}
+	if f != nil {
+		ni = f()
+	}
+	ni.ApiUrl = s.GetNodeAPIURL()
+	return ni
+}
+
 // GetAPIAddr returns the previously-set API address
 func (s *Service) GetAPIAddr() string {
 	s.mu.RLock()
@@ -197,10 +271,14 @@ func (s *Service) GetNodeAPIURL() string {
 
 // Stats returns status of the Service.
 func (s *Service) Stats() (map[string]interface{}, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
 	st := map[string]interface{}{
 		"addr":     s.addr.String(),
 		"https":    strconv.FormatBool(s.https),
 		"api_addr": s.apiAddr,
+		"signed":   s.signer != nil,
+		"audit":    s.audit != nil,
 	}
 
 	return st, nil
@@ -231,6 +309,24 @@ func (s *Service) checkCommandPerm(c *Command, perm string) bool {
 	return s.credentialStore.AA(username, password, perm)
 }
 
+// checkCommandQuery checks that the command is authorized to execute the
+// given queries, either through the query perm, or through a query perm
+// limited to the tables the queries read.
+func (s *Service) checkCommandQuery(c *Command, queries []*command.Statement) bool {
+	if s.credentialStore == nil {
+		return true
+	}
+
+	username := ""
+	password := ""
+	if c.Credentials != nil {
+		username = c.Credentials.GetUsername()
+		password = c.Credentials.GetPassword()
+	}
+	tables, _ := command.ReadTables(queries)
+	return s.credentialStore.AAQuery(username, password, tables)
+}
+
 func (s *Service) checkCommandPermAll(c *Command, perms ...string) bool {
 	if s.credentialStore == nil {
 		return true
@@ -250,6 +346,65 @@ func (s *Service) checkCommandPermAll(c *Command, perms ...string) bool {
 	return true
 }
 
+// auditCommand logs, if auditing is enabled, the receipt of the command c. If
+// c was signed, sig is its signature.
+func (s *Service) auditCommand(conn net.Conn, c *Command, sig *Signature, authorized bool) {
+	s.mu.RLock()
+	audit := s.audit
+	s.mu.RUnlock()
+	if audit == nil {
+		return
+	}
+
+	node := "unknown"
+	if sig != nil {
+		node = sig.NodeId
+	}
+	username := c.GetCredentials().GetUsername()
+	if username == "" {
+		username = "<anonymous>"
+	}
+	result := "authorized"
+	if !authorized {
+		result = "unauthorized"
+	}
+	audit.Printf("%s from node %s at %s for user %s: %s",
+		c.Type, node, conn.RemoteAddr(), username, result)
+}
+
+// errorResponse returns the encoded response to a command of type t, which
+// reports the given error.
+func errorResponse(t Command_Type, msg string) ([]byte, error) {
+	var m proto.Message
+	switch t {
+	case Command_COMMAND_TYPE_EXECUTE:
+		m = &CommandExecuteResponse{Error: msg}
+	case Command_COMMAND_TYPE_QUERY:
+		m = &CommandQueryResponse{Error: msg}
+	case Command_COMMAND_TYPE_REQUEST:
+		m = &CommandRequestResponse{Error: msg}
+	case Command_COMMAND_TYPE_BACKUP:
+		p, err := proto.Marshal(&CommandBackupResponse{Error: msg})
+		if err != nil {
+			return nil, err
+		}
+		return gzCompress(p)
+	case Command_COMMAND_TYPE_LOAD:
+		m = &CommandLoadResponse{Error: msg}
+	case Command_COMMAND_TYPE_REMOVE_NODE:
+		m = &CommandRemoveNodeResponse{Error: msg}
+	case Command_COMMAND_TYPE_NOTIFY:
+		m = &CommandNotifyResponse{Error: msg}
+	case Command_COMMAND_TYPE_JOIN:
+		m = &CommandJoinResponse{Error: msg}
+	case Command_COMMAND_TYPE_PROBE:
+		m = &CommandProbeResponse{Error: msg}
+	default:
+		return nil, fmt.Errorf("no error response for command type %s", t)
+	}
+	return proto.Marshal(m)
+}
+
 func (s *Service) handleConn(conn net.Conn) {
 	defer conn.Close()
 
@@ -273,6 +428,24 @@ func (s *Service) handleConn(conn net.Conn) {
 			conn.Close()
 		}
 
+		var sig *Signature
+		s.mu.RLock()
+		signer := s.signer
+		s.mu.RUnlock()
+		if signer != nil {
+			sig, err = signer.Verify(p)
+			if err != nil {
+				stats.Add(numBadSignatures, 1)
+				s.logger.Printf("refused %s from %s: %s", c.Type, conn.RemoteAddr(), err.Error())
+				p, err = errorResponse(c.Type, err.Error())
+				if err != nil {
+					return
+				}
+				writeBytesWithLength(conn, p)
+				continue
+			}
+		}
+
 		switch c.Type {
 		case Command_COMMAND_TYPE_GET_NODE_API_URL:
 			stats.Add(numGetNodeAPIRequest, 1)
@@ -285,6 +458,14 @@ func (s *Service) handleConn(conn net.Conn) {
 			writeBytesWithLength(conn, p)
 			stats.Add(numGetNodeAPIResponse, 1)
 
+		case Command_COMMAND_TYPE_GET_NODE_INFO:
+			stats.Add(numGetNodeInfoRequest, 1)
+			p, err = proto.Marshal(s.GetNodeInfo())
+			if err != nil {
+				conn.Close()
+			}
+			writeBytesWithLength(conn, p)
+
 		case Command_COMMAND_TYPE_EXECUTE:
 			stats.Add(numExecuteRequest, 1)
 
@@ -293,14 +474,17 @@ func (s *Service) handleConn(conn net.Conn) {
 			if er == nil {
 				resp.Error = "ExecuteRequest is nil"
 			} else if !s.checkCommandPerm(c, auth.PermExecute) {
+				s.auditCommand(conn, c, sig, false)
 				resp.Error = "unauthorized"
 			} else {
-				res, err := s.db.Execute(er)
+				s.auditCommand(conn, c, sig, true)
+				res, idx, err := s.db.ExecuteWithIndex(er)
 				if err != nil {
 					resp.Error = err.Error()
 				} else {
 					resp.Results = make([]*command.ExecuteResult, len(res))
 					copy(resp.Results, res)
+					resp.RaftIndex = idx
 				}
 			}
 
@@ -318,7 +502,7 @@ func (s *Service) handleConn(conn net.Conn) {
 			qr := c.GetQueryRequest()
 			if qr == nil {
 				resp.Error = "QueryRequest is nil"
-			} else if !s.checkCommandPerm(c, auth.PermQuery) {
+			} else if !s.checkCommandQuery(c, qr.GetRequest().GetStatements()) {
 				resp.Error = "unauthorized"
 			} else {
 				res, err := s.db.Query(qr)
@@ -345,14 +529,17 @@ func (s *Service) handleConn(conn net.Conn) {
 			if rr == nil {
 				resp.Error = "RequestRequest is nil"
 			} else if !s.checkCommandPermAll(c, auth.PermQuery, auth.PermExecute) {
+				s.auditCommand(conn, c, sig, false)
 				resp.Error = "unauthorized"
 			} else {
-				res, err := s.db.Request(rr)
+				s.auditCommand(conn, c, sig, true)
+				res, idx, err := s.db.RequestWithIndex(rr)
 				if err != nil {
 					resp.Error = err.Error()
 				} else {
 					resp.Response = make([]*command.ExecuteQueryResponse, len(res))
 					copy(resp.Response, res)
+					resp.RaftIndex = idx
 				}
 			}
 
@@ -371,8 +558,10 @@ func (s *Service) handleConn(conn net.Conn) {
 			if br == nil {
 				resp.Error = "BackupRequest is nil"
 			} else if !s.checkCommandPerm(c, auth.PermBackup) {
+				s.auditCommand(conn, c, sig, false)
 				resp.Error = "unauthorized"
 			} else {
+				s.auditCommand(conn, c, sig, true)
 				buf := new(bytes.Buffer)
 				if err := s.db.Backup(br, buf); err != nil {
 					resp.Error = err.Error()
@@ -403,8 +592,10 @@ func (s *Service) handleConn(conn net.Conn) {
 			if lr == nil {
 				resp.Error = "LoadRequest is nil"
 			} else if !s.checkCommandPerm(c, auth.PermLoad) {
+				s.auditCommand(conn, c, sig, false)
 				resp.Error = "unauthorized"
 			} else {
+				s.auditCommand(conn, c, sig, true)
 				if err := s.db.Load(lr); err != nil {
 					resp.Error = fmt.Sprintf("remote node failed to load: %s", err.Error())
 				}
@@ -424,8 +615,10 @@ func (s *Service) handleConn(conn net.Conn) {
 			if rn == nil {
 				resp.Error = "LoadRequest is nil"
 			} else if !s.checkCommandPerm(c, auth.PermRemove) {
+				s.auditCommand(conn, c, sig, false)
 				resp.Error = "unauthorized"
 			} else {
+				s.auditCommand(conn, c, sig, true)
 				if err := s.mgr.Remove(rn); err != nil {
 					resp.Error = err.Error()
 				}
@@ -445,6 +638,7 @@ func (s *Service) handleConn(conn net.Conn) {
 			if nr == nil {
 				resp.Error = "NotifyRequest is nil"
 			} else {
+				s.auditCommand(conn, c, sig, true)
 				if err := s.mgr.Notify(nr); err != nil {
 					resp.Error = err.Error()
 				}
@@ -464,11 +658,29 @@ func (s *Service) handleConn(conn net.Conn) {
 			if jr == nil {
 				resp.Error = "JoinRequest is nil"
 			} else {
+				s.auditCommand(conn, c, sig, true)
 				if err := s.mgr.Join(jr); err != nil {
 					resp.Error = err.Error()
 				}
 			}
 
+			p, err = proto.Marshal(resp)
+			if err != nil {
+				conn.Close()
+			}
+			writeBytesWithLength(conn, p)
+
+		case Command_COMMAND_TYPE_PROBE:
+			stats.Add(numProbeRequest, 1)
+			resp := &CommandProbeResponse{}
+
+			pr := c.GetProbeRequest()
+			if pr == nil {
+				resp.Error = "ProbeRequest is nil"
+			} else {
+				resp.Size = int64(len(pr.Payload))
+			}
+
 			p, err = proto.Marshal(resp)
 			if err != nil {
 				conn.Close()
@@ -72,6 +72,19 @@ func Test_ServiceExecute(t *testing.T) {
 		t.Fatalf("unexpected results for execute, expected %s, got %s", exp, got)
 	}
 
+	db.raftIndex = 42
+	res, idx, err := c.ExecuteWithIndex(executeRequestFromString("some SQL"), s.Addr(), NO_CREDS, longWait)
+	if err != nil {
+		t.Fatalf("failed to execute query: %s", err.Error())
+	}
+	if exp, got := `[{"last_insert_id":1234,"rows_affected":5678}]`, asJSON(res); exp != got {
+		t.Fatalf("unexpected results for execute, expected %s, got %s", exp, got)
+	}
+	if idx != 42 {
+		t.Fatalf("unexpected Raft index for execute, expected 42, got %d", idx)
+	}
+	db.raftIndex = 0
+
 	db.executeFn = func(er *command.ExecuteRequest) ([]*command.ExecuteResult, error) {
 		if er.Request.Statements[0].Sql != "some SQL" {
 			t.Fatalf("incorrect SQL statement received")
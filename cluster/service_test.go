@@ -415,12 +415,18 @@ type mockDatabase struct {
 	requestFn func(rr *command.ExecuteQueryRequest) ([]*command.ExecuteQueryResponse, error)
 	backupFn  func(br *command.BackupRequest, dst io.Writer) error
 	loadFn    func(lr *command.LoadRequest) error
+	raftIndex uint64
 }
 
 func (m *mockDatabase) Execute(er *command.ExecuteRequest) ([]*command.ExecuteResult, error) {
 	return m.executeFn(er)
 }
 
+func (m *mockDatabase) ExecuteWithIndex(er *command.ExecuteRequest) ([]*command.ExecuteResult, uint64, error) {
+	res, err := m.Execute(er)
+	return res, m.raftIndex, err
+}
+
 func (m *mockDatabase) Query(qr *command.QueryRequest) ([]*command.QueryRows, error) {
 	return m.queryFn(qr)
 }
@@ -432,6 +438,11 @@ func (m *mockDatabase) Request(rr *command.ExecuteQueryRequest) ([]*command.Exec
 	return m.requestFn(rr)
 }
 
+func (m *mockDatabase) RequestWithIndex(rr *command.ExecuteQueryRequest) ([]*command.ExecuteQueryResponse, uint64, error) {
+	res, err := m.Request(rr)
+	return res, m.raftIndex, err
+}
+
 func (m *mockDatabase) Backup(br *command.BackupRequest, dst io.Writer) error {
 	if m.backupFn == nil {
 		return nil
@@ -523,6 +534,10 @@ func (m *mockCredentialStore) AA(username, password, perm string) bool {
 	return m.HasPermOK
 }
 
+func (m *mockCredentialStore) AAQuery(username, password string, tables []string) bool {
+	return m.AA(username, password, "query")
+}
+
 func mustNewMockCredentialStore() *mockCredentialStore {
 	return &mockCredentialStore{HasPermOK: true}
 }
@@ -0,0 +1,166 @@
+package cluster
+
+import (
+	"testing"
+	"time"
+
+	"github.com/rqlite/rqlite/command"
+	"google.golang.org/protobuf/proto"
+)
+
+func Test_NewSignerShortKey(t *testing.T) {
+	if _, err := NewSigner("node1", []byte("short")); err == nil {
+		t.Fatalf("created signer with short key")
+	}
+}
+
+func Test_SignerSignVerify(t *testing.T) {
+	key := []byte("0123456789abcdef")
+	s1 := mustNewSigner(t, "node1", key)
+	s2 := mustNewSigner(t, "node2", key)
+
+	c := &Command{
+		Type: Command_COMMAND_TYPE_EXECUTE,
+		Request: &Command_ExecuteRequest{
+			ExecuteRequest: executeRequestFromString("INSERT INTO foo VALUES(1)"),
+		},
+		Credentials: &Credentials{Username: "bob", Password: "secret"},
+	}
+	p, err := s1.Sign(c)
+	if err != nil {
+		t.Fatalf("failed to sign command: %s", err.Error())
+	}
+
+	// A signed command decodes as the original command, plus its signature.
+	d := &Command{}
+	if err := proto.Unmarshal(p, d); err != nil {
+		t.Fatalf("failed to decode signed command: %s", err.Error())
+	}
+	if d.Signature == nil || d.Signature.NodeId != "node1" {
+		t.Fatalf("signed command has wrong signature: %v", d.Signature)
+	}
+	d.Signature = nil
+	if !proto.Equal(c, d) {
+		t.Fatalf("signed command does not decode as original")
+	}
+
+	sig, err := s2.Verify(p)
+	if err != nil {
+		t.Fatalf("failed to verify signed command: %s", err.Error())
+	}
+	if sig.NodeId != "node1" {
+		t.Fatalf("wrong node ID in signature, exp node1, got %s", sig.NodeId)
+	}
+	if _, err := s2.Verify(p); err != ErrSignatureReplayed {
+		t.Fatalf("replayed command not refused, got %v", err)
+	}
+}
+
+func Test_SignerVerifyRefused(t *testing.T) {
+	key := []byte("0123456789abcdef")
+	s1 := mustNewSigner(t, "node1", key)
+	s2 := mustNewSigner(t, "node2", key)
+	other := mustNewSigner(t, "node3", []byte("fedcba9876543210"))
+
+	c := &Command{
+		Type: Command_COMMAND_TYPE_EXECUTE,
+		Request: &Command_ExecuteRequest{
+			ExecuteRequest: executeRequestFromString("INSERT INTO foo VALUES(1)"),
+		},
+		Credentials: &Credentials{Username: "bob", Password: "secret"},
+	}
+
+	p, err := proto.Marshal(c)
+	if err != nil {
+		t.Fatalf("failed to marshal command: %s", err.Error())
+	}
+	if _, err := s2.Verify(p); err != ErrUnsigned {
+		t.Fatalf("unsigned command not refused, got %v", err)
+	}
+
+	p, err = other.Sign(c)
+	if err != nil {
+		t.Fatalf("failed to sign command: %s", err.Error())
+	}
+	if _, err := s2.Verify(p); err != ErrBadSignature {
+		t.Fatalf("command signed with other key not refused, got %v", err)
+	}
+
+	// Changing the user on whose behalf the command is sent invalidates
+	// the signature.
+	p, err = s1.Sign(c)
+	if err != nil {
+		t.Fatalf("failed to sign command: %s", err.Error())
+	}
+	signed, _, err := splitSignature(p)
+	if err != nil {
+		t.Fatalf("failed to split signature: %s", err.Error())
+	}
+	forged := proto.Clone(c).(*Command)
+	forged.Credentials.Username = "alice"
+	fp, err := proto.Marshal(forged)
+	if err != nil {
+		t.Fatalf("failed to marshal command: %s", err.Error())
+	}
+	fp = append(fp, p[len(signed):]...)
+	if _, err := s2.Verify(fp); err != ErrBadSignature {
+		t.Fatalf("forged command not refused, got %v", err)
+	}
+
+	// Signatures are only accepted for a limited time.
+	s1.now = func() time.Time { return time.Now().Add(-time.Hour) }
+	p, err = s1.Sign(c)
+	if err != nil {
+		t.Fatalf("failed to sign command: %s", err.Error())
+	}
+	if _, err := s2.Verify(p); err != ErrSignatureExpired {
+		t.Fatalf("expired command not refused, got %v", err)
+	}
+}
+
+func Test_ServiceSigned(t *testing.T) {
+	ln, mux := mustNewMux()
+	defer ln.Close()
+	go mux.Serve()
+	tn := mux.Listen(1)
+	db := mustNewMockDatabase()
+	s := New(tn, db, mustNewMockManager(), mustNewMockCredentialStore())
+	if err := s.Open(); err != nil {
+		t.Fatalf("failed to open cluster service: %s", err.Error())
+	}
+	defer s.Close()
+
+	key := []byte("0123456789abcdef")
+	s.SetSigner(mustNewSigner(t, "leader", key))
+	s.EnableAudit(true)
+	db.executeFn = func(er *command.ExecuteRequest) ([]*command.ExecuteResult, error) {
+		return []*command.ExecuteResult{{RowsAffected: 1}}, nil
+	}
+
+	// Commands from a node without the key are refused.
+	c := NewClient(mustNewDialer(1, false, false), 30*time.Second)
+	if _, err := c.Execute(executeRequestFromString("some SQL"), s.Addr(), NO_CREDS, longWait); err == nil || err.Error() != ErrUnsigned.Error() {
+		t.Fatalf("unsigned command not refused, got %v", err)
+	}
+	c.SetSigner(mustNewSigner(t, "follower", []byte("fedcba9876543210")))
+	if _, err := c.Execute(executeRequestFromString("some SQL"), s.Addr(), NO_CREDS, longWait); err == nil || err.Error() != ErrBadSignature.Error() {
+		t.Fatalf("command signed with wrong key not refused, got %v", err)
+	}
+
+	c.SetSigner(mustNewSigner(t, "follower", key))
+	res, err := c.Execute(executeRequestFromString("some SQL"), s.Addr(), NO_CREDS, longWait)
+	if err != nil {
+		t.Fatalf("failed to execute signed command: %s", err.Error())
+	}
+	if exp, got := `[{"rows_affected":1}]`, asJSON(res); exp != got {
+		t.Fatalf("unexpected results for execute, expected %s, got %s", exp, got)
+	}
+}
+
+func mustNewSigner(t *testing.T, nodeID string, key []byte) *Signer {
+	s, err := NewSigner(nodeID, key)
+	if err != nil {
+		t.Fatalf("failed to create signer: %s", err.Error())
+	}
+	return s
+}
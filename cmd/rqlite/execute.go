@@ -1,6 +1,7 @@
 package main
 
 import (
+	"context"
 	"fmt"
 	"io"
 	"io/ioutil"
@@ -41,25 +42,30 @@ func executeWithClient(ctx *cli.Context, client *cl.Client, timer bool, stmt str
 		return err
 	}
 
-	resp, err := client.Execute(u, requestData)
-
 	var hcr error
-	if err != nil {
-		// If the error is HostChangedError, it should be propagated back to the caller to handle
-		// accordingly (change prompt display), but we should still assume that the request succeeded on some
-		// host and not treat it as an error.
-		err, ok := err.(*cl.HostChangedError)
-		if !ok {
-			return err
+	var resp *http.Response
+	var response []byte
+	err := runWithProgress(func(ctx context.Context) error {
+		var err error
+		resp, err = client.ExecuteContext(ctx, u, requestData)
+		if err != nil {
+			// If the error is HostChangedError, it should be propagated back to the caller to handle
+			// accordingly (change prompt display), but we should still assume that the request succeeded on some
+			// host and not treat it as an error.
+			err, ok := err.(*cl.HostChangedError)
+			if !ok {
+				return err
+			}
+			hcr = err
 		}
-		hcr = err
-	}
+		defer resp.Body.Close()
 
-	response, err := ioutil.ReadAll(resp.Body)
+		response, err = ioutil.ReadAll(resp.Body)
+		return err
+	})
 	if err != nil {
 		return err
 	}
-	defer resp.Body.Close()
 
 	if resp.StatusCode != http.StatusOK {
 		return fmt.Errorf("server responded with %s: %s", resp.Status, response)
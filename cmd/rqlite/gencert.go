@@ -0,0 +1,282 @@
+package main
+
+import (
+	"crypto/rsa"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/mkideal/cli"
+	"github.com/rqlite/rqlite/rtls"
+)
+
+// caName is the name of the CA certificate and key files written by gencert.
+const caName = "ca"
+
+type gencertArgT struct {
+	cli.Helper
+	Out     string `cli:"o,out" usage:"directory to write certificates and keys to" dft:"."`
+	Name    string `cli:"n,name" usage:"common name of the certificate, also used to name the files written"`
+	Hosts   string `cli:"H,hosts" usage:"comma separated list of DNS names and IP addresses the certificate is valid for"`
+	Nodes   string `cli:"nodes" usage:"comma separated list of node DNS names or IP addresses (cluster only)"`
+	Clients string `cli:"clients" usage:"comma separated list of client names (cluster only)" dft:"client"`
+	CACert  string `cli:"ca-cert" usage:"path to CA certificate used for signing, defaults to ca.crt in the output directory"`
+	CAKey   string `cli:"ca-key" usage:"path to CA private key used for signing, defaults to ca.key in the output directory"`
+	Days    int    `cli:"d,days" usage:"number of days the certificates are valid for" dft:"365"`
+	KeySize int    `cli:"k,key-size" usage:"size of generated RSA keys, in bits" dft:"2048"`
+	Force   bool   `cli:"f,force" usage:"overwrite existing files" dft:"false"`
+}
+
+var gencertHelp = `Usage: rqlite gencert <command> [options]
+
+Generate X.509 certificates and keys for securing a rqlite cluster.
+
+Commands:
+  ca         Create a CA certificate and key
+  server     Create a node certificate, signed by the CA, for HTTPS and node-to-node encryption
+  client     Create a client certificate, signed by the CA, for mutual TLS
+  cluster    Create a CA, a certificate for each node, and client certificates, in one step
+
+Run 'rqlite gencert <command> -h' for the options of each command.
+`
+
+// gencert runs the gencert command with the given arguments, which start
+// with "gencert", and returns the exit status.
+func gencert(args []string) int {
+	if len(args) < 2 || strings.HasPrefix(args[1], "-") {
+		fmt.Print(gencertHelp)
+		if len(args) < 2 {
+			return 1
+		}
+		return 0
+	}
+
+	var fn func(ctx *cli.Context, argv *gencertArgT) error
+	switch args[1] {
+	case "ca":
+		fn = gencertCA
+	case "server":
+		fn = gencertServer
+	case "client":
+		fn = gencertClient
+	case "cluster":
+		fn = gencertCluster
+	default:
+		fmt.Printf("unknown gencert command %s\n\n%s", args[1], gencertHelp)
+		return 1
+	}
+
+	status := 0
+	cli.SetUsageStyle(cli.ManualStyle)
+	if rc := cli.RunWithArgs(new(gencertArgT), append([]string{"rqlite gencert " + args[1]}, args[2:]...),
+		func(ctx *cli.Context) error {
+			argv := ctx.Argv().(*gencertArgT)
+			if argv.Help {
+				ctx.WriteUsage()
+				return nil
+			}
+			err := func() error {
+				if argv.Days <= 0 {
+					return errors.New("days must be greater than 0")
+				}
+				if err := os.MkdirAll(argv.Out, 0755); err != nil {
+					return err
+				}
+				return fn(ctx, argv)
+			}()
+			if err != nil {
+				ctx.String("%s %v\n", ctx.Color().Red("ERR!"), err)
+				status = 1
+			}
+			return nil
+		}); rc != 0 {
+		return rc
+	}
+	return status
+}
+
+func gencertCA(ctx *cli.Context, argv *gencertArgT) error {
+	name := argv.Name
+	if name == "" {
+		name = "rqlite CA"
+	}
+	_, _, err := writeCA(ctx, argv, name)
+	return err
+}
+
+func gencertServer(ctx *cli.Context, argv *gencertArgT) error {
+	if argv.Name == "" {
+		return errors.New("name is required")
+	}
+	if argv.Hosts == "" {
+		return errors.New("at least one host is required")
+	}
+	caCert, caKey, err := readCA(argv)
+	if err != nil {
+		return err
+	}
+	return writeCert(ctx, argv, argv.Name, splitList(argv.Hosts), caCert, caKey,
+		[]x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth})
+}
+
+func gencertClient(ctx *cli.Context, argv *gencertArgT) error {
+	if argv.Name == "" {
+		return errors.New("name is required")
+	}
+	caCert, caKey, err := readCA(argv)
+	if err != nil {
+		return err
+	}
+	return writeCert(ctx, argv, argv.Name, splitList(argv.Hosts), caCert, caKey,
+		[]x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth})
+}
+
+func gencertCluster(ctx *cli.Context, argv *gencertArgT) error {
+	nodes := splitList(argv.Nodes)
+	if len(nodes) == 0 {
+		return errors.New("at least one node is required")
+	}
+
+	var caCert *x509.Certificate
+	var caKey *rsa.PrivateKey
+	var err error
+	if argv.CACert != "" || argv.CAKey != "" {
+		caCert, caKey, err = readCA(argv)
+	} else {
+		caCert, caKey, err = writeCA(ctx, argv, "rqlite CA")
+	}
+	if err != nil {
+		return err
+	}
+
+	// Every node certificate is also valid for any additional hosts, such as
+	// the name of a load balancer in front of the cluster.
+	extra := splitList(argv.Hosts)
+	for _, n := range nodes {
+		if err := writeCert(ctx, argv, n, append([]string{n}, extra...), caCert, caKey,
+			[]x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth}); err != nil {
+			return err
+		}
+	}
+	for _, c := range splitList(argv.Clients) {
+		if err := writeCert(ctx, argv, c, nil, caCert, caKey,
+			[]x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth}); err != nil {
+			return err
+		}
+	}
+
+	caPath := filepath.Join(argv.Out, caName+".crt")
+	if argv.CACert != "" {
+		caPath = argv.CACert
+	}
+	ctx.String("\nStart each node with, for example:\n\n")
+	ctx.String("  rqlited -http-cert %s -http-key %s -http-ca-cert %s \\\n",
+		filepath.Join(argv.Out, nodes[0]+".crt"), filepath.Join(argv.Out, nodes[0]+".key"), caPath)
+	ctx.String("    -node-cert %s -node-key %s -node-ca-cert %s -node-verify-client ...\n",
+		filepath.Join(argv.Out, nodes[0]+".crt"), filepath.Join(argv.Out, nodes[0]+".key"), caPath)
+	return nil
+}
+
+// readCA reads the CA certificate and key used to sign certificates.
+func readCA(argv *gencertArgT) (*x509.Certificate, *rsa.PrivateKey, error) {
+	certPath := argv.CACert
+	if certPath == "" {
+		certPath = filepath.Join(argv.Out, caName+".crt")
+	}
+	keyPath := argv.CAKey
+	if keyPath == "" {
+		keyPath = filepath.Join(argv.Out, caName+".key")
+	}
+	certPEM, err := os.ReadFile(certPath)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to read CA certificate: %s", err)
+	}
+	keyPEM, err := os.ReadFile(keyPath)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to read CA key: %s", err)
+	}
+	cert, key, err := rtls.ParseCertAndKey(certPEM, keyPEM)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to parse CA: %s", err)
+	}
+	if !cert.IsCA {
+		return nil, nil, fmt.Errorf("%s is not a CA certificate", certPath)
+	}
+	return cert, key, nil
+}
+
+// writeCA creates a CA certificate and key, and writes them to the output
+// directory.
+func writeCA(ctx *cli.Context, argv *gencertArgT, name string) (*x509.Certificate, *rsa.PrivateKey, error) {
+	certPEM, keyPEM, err := rtls.GenerateCACert(pkix.Name{CommonName: name}, validity(argv), argv.KeySize)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to generate CA: %s", err)
+	}
+	if err := writeCertFiles(ctx, argv, caName, certPEM, keyPEM); err != nil {
+		return nil, nil, err
+	}
+	return rtls.ParseCertAndKey(certPEM, keyPEM)
+}
+
+// writeCert creates a certificate, signed by the CA, and writes it and its
+// key to the output directory.
+func writeCert(ctx *cli.Context, argv *gencertArgT, name string, hosts []string,
+	caCert *x509.Certificate, caKey *rsa.PrivateKey, usage []x509.ExtKeyUsage) error {
+	var dnsNames []string
+	var ips []net.IP
+	for _, h := range hosts {
+		if ip := net.ParseIP(h); ip != nil {
+			ips = append(ips, ip)
+		} else {
+			dnsNames = append(dnsNames, h)
+		}
+	}
+	certPEM, keyPEM, err := rtls.GenerateCertWithSANs(pkix.Name{CommonName: name}, validity(argv), argv.KeySize,
+		caCert, caKey, dnsNames, ips, usage)
+	if err != nil {
+		return fmt.Errorf("failed to generate certificate for %s: %s", name, err)
+	}
+	return writeCertFiles(ctx, argv, name, certPEM, keyPEM)
+}
+
+// writeCertFiles writes <name>.crt and <name>.key to the output directory.
+// Existing files are only overwritten if forced.
+func writeCertFiles(ctx *cli.Context, argv *gencertArgT, name string, certPEM, keyPEM []byte) error {
+	certPath := filepath.Join(argv.Out, name+".crt")
+	keyPath := filepath.Join(argv.Out, name+".key")
+	if !argv.Force {
+		for _, p := range []string{certPath, keyPath} {
+			if _, err := os.Stat(p); err == nil {
+				return fmt.Errorf("%s already exists, use --force to overwrite", p)
+			}
+		}
+	}
+	if err := os.WriteFile(keyPath, keyPEM, 0600); err != nil {
+		return err
+	}
+	if err := os.WriteFile(certPath, certPEM, 0644); err != nil {
+		return err
+	}
+	ctx.String("wrote %s\nwrote %s\n", certPath, keyPath)
+	return nil
+}
+
+func validity(argv *gencertArgT) time.Duration {
+	return time.Duration(argv.Days) * 24 * time.Hour
+}
+
+func splitList(s string) []string {
+	var l []string
+	for _, e := range strings.Split(s, ",") {
+		if e = strings.TrimSpace(e); e != "" {
+			l = append(l, e)
+		}
+	}
+	return l
+}
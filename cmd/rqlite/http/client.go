@@ -1,6 +1,7 @@
 package http
 
 import (
+	"context"
 	"fmt"
 	"io"
 	"log"
@@ -52,6 +53,9 @@ type Client struct {
 	// currentHost keeps track of the last available host
 	currentHost int
 	maxRedirect int
+
+	// hedge, if set, enables hedging of queries
+	hedge *hedger
 }
 
 // NewClient creates a default client that sends `execute` and query `requests` against the
@@ -104,22 +108,41 @@ func WithBasicAuth(creds string) ConfigFunc {
 
 // Query sends GET requests to one of the hosts known to the client.
 func (c *Client) Query(url url.URL) (*http.Response, error) {
-	return c.execRequest(http.MethodGet, url, nil)
+	return c.QueryContext(context.Background(), url)
+}
+
+// QueryContext sends GET requests to one of the hosts known to the client. If
+// the context is cancelled the request is aborted, and no other hosts are tried.
+func (c *Client) QueryContext(ctx context.Context, url url.URL) (*http.Response, error) {
+	return c.execRequest(ctx, http.MethodGet, url, nil)
 }
 
 // Execute sends POST requests to one of the hosts known to the client
 func (c *Client) Execute(url url.URL, body io.Reader) (*http.Response, error) {
-	return c.execRequest(http.MethodPost, url, body)
+	return c.ExecuteContext(context.Background(), url, body)
+}
+
+// ExecuteContext sends POST requests to one of the hosts known to the client. If
+// the context is cancelled the request is aborted, and no other hosts are tried.
+func (c *Client) ExecuteContext(ctx context.Context, url url.URL, body io.Reader) (*http.Response, error) {
+	return c.execRequest(ctx, http.MethodPost, url, body)
 }
 
-func (c *Client) execRequest(method string, url url.URL, body io.Reader) (*http.Response, error) {
+func (c *Client) execRequest(ctx context.Context, method string, url url.URL, body io.Reader) (*http.Response, error) {
+	if c.hedgeable(method, url) {
+		return c.hedgedRequest(ctx, method, url)
+	}
+	return c.tryHosts(ctx, method, url, body)
+}
+
+func (c *Client) tryHosts(ctx context.Context, method string, url url.URL, body io.Reader) (*http.Response, error) {
 	triedHosts := 0
 	for triedHosts < len(c.hosts) {
 		host := c.hosts[c.currentHost]
 		url.Scheme = c.scheme
 		url.Host = host
 		urlStr := url.String()
-		resp, err := c.requestFollowRedirect(method, urlStr, body)
+		resp, err := c.requestFollowRedirect(ctx, method, urlStr, body)
 
 		// Found a responsive node
 		if err == nil {
@@ -129,6 +152,11 @@ func (c *Client) execRequest(method string, url url.URL, body io.Reader) (*http.
 			return resp, nil
 		}
 
+		// A cancelled request says nothing about the availability of the host.
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+
 		// If we did too many redirects, we will consider the host as unavailable as well,
 		// and we will retry the request from another host
 		if err == ErrTooManyRedirects {
@@ -148,10 +176,10 @@ func (c *Client) nextHost() {
 	c.currentHost = (c.currentHost + 1) % len(c.hosts)
 }
 
-func (c *Client) requestFollowRedirect(method string, urlStr string, body io.Reader) (*http.Response, error) {
+func (c *Client) requestFollowRedirect(ctx context.Context, method string, urlStr string, body io.Reader) (*http.Response, error) {
 	nRedirects := 0
 	for {
-		req, err := http.NewRequest(method, urlStr, body)
+		req, err := http.NewRequestWithContext(ctx, method, urlStr, body)
 		if err != nil {
 			return nil, err
 		}
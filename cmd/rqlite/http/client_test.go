@@ -1,10 +1,13 @@
 package http
 
 import (
+	"context"
+	"io"
 	"net/http"
 	"net/http/httptest"
 	"net/url"
 	"testing"
+	"time"
 )
 
 func TestClient_QueryWhenAllAvailable(t *testing.T) {
@@ -162,3 +165,166 @@ func TestClient_BasicAuthIsForwarded(t *testing.T) {
 		t.Errorf("expected unauthorized status")
 	}
 }
+
+func TestClient_QueryContextCancelled(t *testing.T) {
+	node1 := httptest.NewServer(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		<-request.Context().Done()
+	}))
+	defer node1.Close()
+
+	node2Called := false
+	node2 := httptest.NewServer(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		node2Called = true
+		writer.WriteHeader(http.StatusOK)
+	}))
+	defer node2.Close()
+
+	httpClient := http.DefaultClient
+
+	u1, _ := url.Parse(node1.URL)
+	u2, _ := url.Parse(node2.URL)
+	client := NewClient(httpClient, []string{u1.Host, u2.Host})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() {
+		time.Sleep(100 * time.Millisecond)
+		cancel()
+	}()
+	_, err := client.QueryContext(ctx, url.URL{
+		Path: "/",
+	})
+	if err != context.Canceled {
+		t.Fatalf("expected context.Canceled, got %v", err)
+	}
+	if node2Called {
+		t.Fatalf("cancelled request should not be retried on another host")
+	}
+}
+
+func TestClient_QueryHedged(t *testing.T) {
+	node1 := httptest.NewServer(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		select {
+		case <-request.Context().Done():
+		case <-time.After(5 * time.Second):
+		}
+		writer.Write([]byte("node1"))
+	}))
+	defer node1.Close()
+
+	node2 := httptest.NewServer(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		writer.Write([]byte("node2"))
+	}))
+	defer node2.Close()
+
+	u1, _ := url.Parse(node1.URL)
+	u2, _ := url.Parse(node2.URL)
+	client := NewClient(http.DefaultClient, []string{u1.Host, u2.Host}, WithHedging(95))
+
+	start := time.Now()
+	res, err := client.Query(url.URL{
+		Path:     "/",
+		RawQuery: "level=none",
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer res.Body.Close()
+	if time.Since(start) > 2*time.Second {
+		t.Fatalf("hedged query was not answered by second host")
+	}
+	b, err := io.ReadAll(res.Body)
+	if err != nil {
+		t.Fatalf("failed to read response body: %v", err)
+	}
+	if string(b) != "node2" {
+		t.Fatalf("expected response from second host, got %s", b)
+	}
+	if client.currentHost != 0 {
+		t.Fatalf("hedged query should not change current host")
+	}
+}
+
+func TestClient_QueryNotHedged(t *testing.T) {
+	node1 := httptest.NewServer(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		time.Sleep(300 * time.Millisecond)
+		writer.WriteHeader(http.StatusOK)
+	}))
+	defer node1.Close()
+
+	node2Called := false
+	node2 := httptest.NewServer(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		node2Called = true
+		writer.WriteHeader(http.StatusOK)
+	}))
+	defer node2.Close()
+
+	u1, _ := url.Parse(node1.URL)
+	u2, _ := url.Parse(node2.URL)
+	client := NewClient(http.DefaultClient, []string{u1.Host, u2.Host}, WithHedging(95))
+
+	res, err := client.Query(url.URL{
+		Path:     "/",
+		RawQuery: "level=weak",
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	res.Body.Close()
+	if node2Called {
+		t.Fatalf("query with level weak should not be hedged")
+	}
+}
+
+func TestClient_QueryHedgedPrimaryUnavailable(t *testing.T) {
+	node1 := httptest.NewServer(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		writer.WriteHeader(http.StatusOK)
+	}))
+	node1.Close()
+
+	node2 := httptest.NewServer(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		writer.WriteHeader(http.StatusOK)
+	}))
+	defer node2.Close()
+
+	u1, _ := url.Parse(node1.URL)
+	u2, _ := url.Parse(node2.URL)
+	client := NewClient(http.DefaultClient, []string{u1.Host, u2.Host}, WithHedging(95))
+
+	res, err := client.Query(url.URL{
+		Path:     "/",
+		RawQuery: "level=none",
+	})
+	hcer, ok := err.(*HostChangedError)
+	if !ok {
+		t.Fatalf("expected HostChangedError, got %v", err)
+	}
+	res.Body.Close()
+	if hcer.NewHost != u2.Host {
+		t.Fatalf("unexpected new host, expected %s got %s", u2.Host, hcer.NewHost)
+	}
+	if client.currentHost != 1 {
+		t.Fatalf("expected current host to change to second host")
+	}
+}
+
+func TestHedger_Delay(t *testing.T) {
+	h := newHedger(90)
+	if got, exp := h.delay(), defaultHedgeDelay; got != exp {
+		t.Fatalf("wrong default delay, got %s, exp %s", got, exp)
+	}
+	for i := 1; i <= 200; i++ {
+		h.record(time.Duration(i) * time.Millisecond)
+	}
+	// Only the most recent 100 latencies, 101ms to 200ms, are used.
+	if got, exp := h.delay(), 191*time.Millisecond; got != exp {
+		t.Fatalf("wrong delay, got %s, exp %s", got, exp)
+	}
+
+	h = newHedger(50)
+	for i := 0; i < hedgeMinSamples; i++ {
+		h.record(time.Microsecond)
+	}
+	if got, exp := h.delay(), minHedgeDelay; got != exp {
+		t.Fatalf("wrong minimum delay, got %s, exp %s", got, exp)
+	}
+}
@@ -0,0 +1,215 @@
+package http
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/url"
+	"sort"
+	"sync"
+	"time"
+)
+
+const (
+	// hedgeSamples is the number of recent query latencies used to compute
+	// the hedging delay.
+	hedgeSamples = 100
+
+	// hedgeMinSamples is the number of latencies which must be recorded
+	// before the hedging delay is based on them.
+	hedgeMinSamples = 10
+
+	// defaultHedgeDelay is the hedging delay used until enough latencies
+	// have been recorded.
+	defaultHedgeDelay = 100 * time.Millisecond
+
+	// minHedgeDelay is the lower bound on the hedging delay, so that fast
+	// clusters are not sent every query twice.
+	minHedgeDelay = 5 * time.Millisecond
+)
+
+// WithHedging enables hedging of queries with read consistency level "none".
+// If the host a query is sent to has not responded within the given
+// percentile (for example 95) of recently-observed query latencies, the
+// query is also sent to the next host, and the first successful response
+// is used. Hedging has no effect unless the client has more than one host.
+func WithHedging(percentile float64) ConfigFunc {
+	return func(client *Client) {
+		client.hedge = newHedger(percentile)
+	}
+}
+
+// hedger tracks query latencies and computes the hedging delay.
+type hedger struct {
+	percentile float64
+
+	mu        sync.Mutex
+	latencies []time.Duration
+	next      int
+}
+
+func newHedger(percentile float64) *hedger {
+	return &hedger{
+		percentile: percentile,
+		latencies:  make([]time.Duration, 0, hedgeSamples),
+	}
+}
+
+// record adds a query latency to the set of recent latencies.
+func (h *hedger) record(d time.Duration) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if len(h.latencies) < hedgeSamples {
+		h.latencies = append(h.latencies, d)
+		return
+	}
+	h.latencies[h.next] = d
+	h.next = (h.next + 1) % hedgeSamples
+}
+
+// delay returns how long to wait for a response before hedging a query.
+func (h *hedger) delay() time.Duration {
+	h.mu.Lock()
+	if len(h.latencies) < hedgeMinSamples {
+		h.mu.Unlock()
+		return defaultHedgeDelay
+	}
+	l := make([]time.Duration, len(h.latencies))
+	copy(l, h.latencies)
+	h.mu.Unlock()
+
+	sort.Slice(l, func(i, j int) bool { return l[i] < l[j] })
+	idx := int(float64(len(l)) * h.percentile / 100)
+	if idx >= len(l) {
+		idx = len(l) - 1
+	}
+	if idx < 0 {
+		idx = 0
+	}
+	if l[idx] < minHedgeDelay {
+		return minHedgeDelay
+	}
+	return l[idx]
+}
+
+// hedgeable returns whether a request may be hedged.
+func (c *Client) hedgeable(method string, u url.URL) bool {
+	return c.hedge != nil && len(c.hosts) > 1 && method == http.MethodGet &&
+		u.Query().Get("level") == "none"
+}
+
+// hedgeResult is the outcome of a single attempt of a hedged request.
+type hedgeResult struct {
+	host    int
+	resp    *http.Response
+	err     error
+	latency time.Duration
+	cancel  context.CancelFunc
+}
+
+// hedgedRequest sends the request to the current host and, if no response
+// is received within the hedging delay, to the next host as well. The first
+// successful response is returned. If both attempts fail, the request is
+// retried across all hosts as normal.
+func (c *Client) hedgedRequest(ctx context.Context, method string, u url.URL) (*http.Response, error) {
+	primary := c.currentHost
+	secondary := (primary + 1) % len(c.hosts)
+	results := make(chan *hedgeResult, 2)
+	cancels := make(map[int]context.CancelFunc, 2)
+
+	send := func(host int) {
+		actx, cancel := context.WithCancel(ctx)
+		cancels[host] = cancel
+		au := u
+		au.Scheme = c.scheme
+		au.Host = c.hosts[host]
+		go func() {
+			start := time.Now()
+			resp, err := c.requestFollowRedirect(actx, method, au.String(), nil)
+			results <- &hedgeResult{
+				host:    host,
+				resp:    resp,
+				err:     err,
+				latency: time.Since(start),
+				cancel:  cancel,
+			}
+		}()
+	}
+
+	send(primary)
+	outstanding := 1
+	timer := time.NewTimer(c.hedge.delay())
+	defer timer.Stop()
+
+	var primaryFailed bool
+	for outstanding > 0 {
+		select {
+		case <-timer.C:
+			if outstanding == 1 && !primaryFailed {
+				send(secondary)
+				outstanding++
+			}
+		case r := <-results:
+			outstanding--
+			if r.err != nil {
+				r.cancel()
+				if r.resp != nil {
+					r.resp.Body.Close()
+				}
+				if r.host == primary {
+					primaryFailed = true
+					// Don't wait for the hedging delay if the primary is unavailable.
+					if timer.Stop() {
+						send(secondary)
+						outstanding++
+					}
+				}
+				continue
+			}
+
+			c.hedge.record(r.latency)
+			for h, cancel := range cancels {
+				if h != r.host {
+					cancel()
+				}
+			}
+			r.resp.Body = &cancelOnClose{ReadCloser: r.resp.Body, cancel: r.cancel}
+			go discardHedgeResults(results, outstanding)
+			if primaryFailed {
+				c.currentHost = secondary
+				return r.resp, &HostChangedError{NewHost: c.hosts[secondary]}
+			}
+			return r.resp, nil
+		}
+	}
+
+	if ctx.Err() != nil {
+		return nil, ctx.Err()
+	}
+	return c.tryHosts(ctx, method, u, nil)
+}
+
+// discardHedgeResults releases the responses of the n attempts of a hedged
+// request which lost.
+func discardHedgeResults(results <-chan *hedgeResult, n int) {
+	for i := 0; i < n; i++ {
+		r := <-results
+		if r.resp != nil {
+			r.resp.Body.Close()
+		}
+	}
+}
+
+// cancelOnClose is a response body which cancels the context of the request
+// which produced it, once the body is closed.
+type cancelOnClose struct {
+	io.ReadCloser
+	cancel context.CancelFunc
+}
+
+// Close closes the body and cancels the request context.
+func (c *cancelOnClose) Close() error {
+	err := c.ReadCloser.Close()
+	c.cancel()
+	return err
+}
@@ -22,21 +22,24 @@ import (
 	"github.com/rqlite/rqlite/cmd"
 	"github.com/rqlite/rqlite/cmd/rqlite/history"
 	httpcl "github.com/rqlite/rqlite/cmd/rqlite/http"
+	"github.com/rqlite/rqlite/cmd/rqlite/profile"
 )
 
 const maxRedirect = 21
 
 type argT struct {
 	cli.Helper
-	Alternatives string `cli:"a,alternatives" usage:"comma separated list of 'host:port' pairs to use as fallback"`
-	Protocol     string `cli:"s,scheme" usage:"protocol scheme (http or https)" dft:"http"`
-	Host         string `cli:"H,host" usage:"rqlited host address" dft:"127.0.0.1"`
-	Port         uint16 `cli:"p,port" usage:"rqlited host port" dft:"4001"`
-	Prefix       string `cli:"P,prefix" usage:"rqlited HTTP URL prefix" dft:"/"`
-	Insecure     bool   `cli:"i,insecure" usage:"do not verify rqlited HTTPS certificate" dft:"false"`
-	CACert       string `cli:"c,ca-cert" usage:"path to trusted X.509 root CA certificate"`
-	Credentials  string `cli:"u,user" usage:"set basic auth credentials in form username:password"`
-	Version      bool   `cli:"v,version" usage:"display CLI version"`
+	Alternatives string  `cli:"a,alternatives" usage:"comma separated list of 'host:port' pairs to use as fallback"`
+	Protocol     string  `cli:"s,scheme" usage:"protocol scheme (http or https)" dft:"http"`
+	Host         string  `cli:"H,host" usage:"rqlited host address" dft:"127.0.0.1"`
+	Port         uint16  `cli:"p,port" usage:"rqlited host port" dft:"4001"`
+	Prefix       string  `cli:"P,prefix" usage:"rqlited HTTP URL prefix" dft:"/"`
+	Insecure     bool    `cli:"i,insecure" usage:"do not verify rqlited HTTPS certificate" dft:"false"`
+	CACert       string  `cli:"c,ca-cert" usage:"path to trusted X.509 root CA certificate"`
+	Credentials  string  `cli:"u,user" usage:"set basic auth credentials in form username:password"`
+	Profile      string  `cli:"profile" usage:"name of connection profile in ~/.rqliterc to use"`
+	Hedge        float64 `cli:"hedge" usage:"also send 'none' consistency queries to an alternative host if no response within this percentile of recent latencies, e.g. 95"`
+	Version      bool    `cli:"v,version" usage:"display CLI version"`
 }
 
 var cliHelp = []string{
@@ -50,6 +53,8 @@ var cliHelp = []string{
 	`.ready                              Show ready status for connected node`,
 	`.restore <file>                     Restore the database from a SQLite database file or dump file`,
 	`.nodes                              Show connection status of all nodes in cluster`,
+	`.once <file>                        Write the results of the next query to a file`,
+	`.output [<file>]                    Write query results to a file, or to the terminal if no file given`,
 	`.schema                             Show CREATE statements for all tables`,
 	`.status                             Show status and diagnostic information for connected node`,
 	`.sysdump <file>                     Dump system diagnostics to a file for offline analysis`,
@@ -59,6 +64,10 @@ var cliHelp = []string{
 }
 
 func main() {
+	if len(os.Args) > 1 && os.Args[1] == "gencert" {
+		os.Exit(gencert(os.Args[1:]))
+	}
+
 	cli.SetUsageStyle(cli.ManualStyle)
 	cli.Run(new(argT), func(ctx *cli.Context) error {
 		argv := ctx.Argv().(*argT)
@@ -73,6 +82,18 @@ func main() {
 			return nil
 		}
 
+		if argv.Profile != "" {
+			if err := applyProfile(ctx, argv); err != nil {
+				ctx.String("%s %v\n", ctx.Color().Red("ERR!"), err)
+				return nil
+			}
+		}
+
+		if argv.Hedge < 0 || argv.Hedge > 100 {
+			ctx.String("%s %v\n", ctx.Color().Red("ERR!"), "hedge percentile must be between 0 and 100")
+			return nil
+		}
+
 		httpClient, err := getHTTPClient(argv)
 		if err != nil {
 			ctx.String("%s %v\n", ctx.Color().Red("ERR!"), err)
@@ -115,10 +136,26 @@ func main() {
 		}
 
 		hosts := createHostList(argv)
-		client := httpcl.NewClient(httpClient, hosts,
+		clientOpts := []httpcl.ConfigFunc{
 			httpcl.WithScheme(argv.Protocol),
 			httpcl.WithBasicAuth(argv.Credentials),
-			httpcl.WithPrefix(argv.Prefix))
+			httpcl.WithPrefix(argv.Prefix),
+		}
+		if argv.Hedge > 0 {
+			clientOpts = append(clientOpts, httpcl.WithHedging(argv.Hedge))
+		}
+		client := httpcl.NewClient(httpClient, hosts, clientOpts...)
+
+		// Query results are written to the terminal, unless redirected.
+		out := &output{}
+		defer out.Close()
+		query := func(stmt string) error {
+			err := queryWithClient(ctx, out.Writer(ctx), client, timer, consistency, stmt)
+			if doneErr := out.Done(); err == nil {
+				err = doneErr
+			}
+			return err
+		}
 
 	FOR_READ:
 		for {
@@ -152,11 +189,11 @@ func main() {
 				}
 				err = setConsistency(line[index+1:], &consistency)
 			case ".TABLES":
-				err = queryWithClient(ctx, client, timer, consistency, `SELECT name FROM sqlite_master WHERE type="table"`)
+				err = query(`SELECT name FROM sqlite_master WHERE type="table"`)
 			case ".INDEXES":
-				err = queryWithClient(ctx, client, timer, consistency, `SELECT sql FROM sqlite_master WHERE type="index"`)
+				err = query(`SELECT sql FROM sqlite_master WHERE type="index"`)
 			case ".SCHEMA":
-				err = queryWithClient(ctx, client, timer, consistency, `SELECT sql FROM sqlite_master`)
+				err = query(`SELECT sql FROM sqlite_master`)
 			case ".TIMER":
 				err = toggleTimer(line[index+1:], &timer)
 			case ".STATUS":
@@ -187,6 +224,18 @@ func main() {
 					break
 				}
 				err = sysdump(ctx, line[index+1:], argv)
+			case ".OUTPUT":
+				if index == -1 || index == len(line)-1 {
+					err = out.Set("", false)
+					break
+				}
+				err = out.Set(line[index+1:], false)
+			case ".ONCE":
+				if index == -1 || index == len(line)-1 {
+					err = fmt.Errorf("please specify an output file for the next query")
+					break
+				}
+				err = out.Set(line[index+1:], true)
 			case ".DUMP":
 				if index == -1 || index == len(line)-1 {
 					err = fmt.Errorf("please specify an output file for the SQL text")
@@ -198,7 +247,7 @@ func main() {
 			case ".QUIT", "QUIT", "EXIT", ".EXIT":
 				break FOR_READ
 			case "SELECT", "PRAGMA":
-				err = queryWithClient(ctx, client, timer, consistency, line)
+				err = query(line)
 			default:
 				err = executeWithClient(ctx, client, timer, line)
 			}
@@ -225,6 +274,54 @@ func main() {
 	})
 }
 
+// applyProfile sets connection options from the named profile. Options
+// explicitly set on the command line take precedence over the profile.
+func applyProfile(ctx *cli.Context, argv *argT) error {
+	path, err := profile.Path()
+	if err != nil {
+		return err
+	}
+	p, err := profile.Load(path, argv.Profile)
+	if err != nil {
+		if err == profile.ErrNotFound {
+			return fmt.Errorf("profile '%s' not found in %s", argv.Profile, path)
+		}
+		return err
+	}
+
+	if p.Alternatives != "" && !ctx.IsSet("-a", "--alternatives") {
+		argv.Alternatives = p.Alternatives
+	}
+	if p.Scheme != "" && !ctx.IsSet("-s", "--scheme") {
+		argv.Protocol = p.Scheme
+	}
+	if p.Host != "" && !ctx.IsSet("-H", "--host") {
+		argv.Host = p.Host
+	}
+	if p.Port != 0 && !ctx.IsSet("-p", "--port") {
+		argv.Port = p.Port
+	}
+	if p.Prefix != "" && !ctx.IsSet("-P", "--prefix") {
+		argv.Prefix = p.Prefix
+	}
+	if p.Insecure && !ctx.IsSet("-i", "--insecure") {
+		argv.Insecure = p.Insecure
+	}
+	if p.CACert != "" && !ctx.IsSet("-c", "--ca-cert") {
+		argv.CACert = p.CACert
+	}
+	if !ctx.IsSet("-u", "--user") {
+		creds, err := p.Credentials()
+		if err != nil {
+			return err
+		}
+		if creds != "" {
+			argv.Credentials = creds
+		}
+	}
+	return nil
+}
+
 func toggleTimer(op string, flag *bool) error {
 	if op != "on" && op != "off" {
 		return fmt.Errorf("invalid option '%s'. Use 'on' or 'off' (default)", op)
@@ -0,0 +1,68 @@
+package main
+
+import (
+	"io"
+	"os"
+	"strings"
+
+	"github.com/mkideal/cli"
+)
+
+// output manages where query results are written. By default results are
+// written to the terminal, but they may be redirected to a file using .output
+// or, for a single query only, .once.
+type output struct {
+	f    *os.File
+	once bool
+}
+
+// Set redirects query results to the file at path, truncating any existing
+// file. If once is true the redirection applies only to the next query. An
+// empty path, or "stdout", restores output to the terminal.
+func (o *output) Set(path string, once bool) error {
+	if err := o.Close(); err != nil {
+		return err
+	}
+
+	path = strings.TrimSpace(path)
+	if path == "" || path == "stdout" {
+		return nil
+	}
+
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	o.f = f
+	o.once = once
+	return nil
+}
+
+// Writer returns the writer to which the next query results should be written.
+func (o *output) Writer(ctx *cli.Context) io.Writer {
+	if o.f == nil {
+		return ctx
+	}
+	return o.f
+}
+
+// Done must be called after query results have been written. If output was
+// redirected for a single query only, output is restored to the terminal.
+func (o *output) Done() error {
+	if !o.once {
+		return nil
+	}
+	return o.Close()
+}
+
+// Close closes any file output is redirected to, and restores output
+// to the terminal.
+func (o *output) Close() error {
+	if o.f == nil {
+		return nil
+	}
+	err := o.f.Close()
+	o.f = nil
+	o.once = false
+	return err
+}
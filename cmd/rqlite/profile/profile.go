@@ -0,0 +1,107 @@
+// Package profile supports named connection profiles for the rqlite CLI.
+//
+// Profiles are stored as a JSON object in ~/.rqliterc, keyed by profile
+// name. For example:
+//
+//	{
+//	    "prod": {
+//	        "host": "db.example.com",
+//	        "port": 4001,
+//	        "scheme": "https",
+//	        "ca_cert": "/etc/ssl/rqlite-ca.pem",
+//	        "username": "bob",
+//	        "password_env": "RQLITE_PROD_PASSWORD"
+//	    }
+//	}
+//
+// Passwords should not be stored in the file. Instead password_env names
+// an environment variable from which the password is read at connect time.
+package profile
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+)
+
+const profileFile = ".rqliterc"
+
+var (
+	// ErrNotFound is returned when a requested profile does not exist.
+	ErrNotFound = errors.New("profile not found")
+)
+
+// Profile represents a named set of connection settings.
+type Profile struct {
+	Alternatives string `json:"alternatives,omitempty"`
+	Scheme       string `json:"scheme,omitempty"`
+	Host         string `json:"host,omitempty"`
+	Port         uint16 `json:"port,omitempty"`
+	Prefix       string `json:"prefix,omitempty"`
+	Insecure     bool   `json:"insecure,omitempty"`
+	CACert       string `json:"ca_cert,omitempty"`
+	Username     string `json:"username,omitempty"`
+	Password     string `json:"password,omitempty"`
+	PasswordEnv  string `json:"password_env,omitempty"`
+}
+
+// Credentials returns the Basic Auth credentials for the profile, in the
+// form username:password. If no username is set, an empty string is returned.
+// If the profile names a password environment variable, that variable must
+// be set.
+func (p *Profile) Credentials() (string, error) {
+	if p.Username == "" {
+		return "", nil
+	}
+	pw := p.Password
+	if p.PasswordEnv != "" {
+		v, ok := os.LookupEnv(p.PasswordEnv)
+		if !ok {
+			return "", fmt.Errorf("password environment variable %s is not set", p.PasswordEnv)
+		}
+		pw = v
+	}
+	return fmt.Sprintf("%s:%s", p.Username, pw), nil
+}
+
+// Path returns the full path to the profile file.
+func Path() (string, error) {
+	hdir, err := os.UserHomeDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(hdir, profileFile), nil
+}
+
+// Read reads all profiles from the reader.
+func Read(r io.Reader) (map[string]*Profile, error) {
+	profiles := make(map[string]*Profile)
+	dec := json.NewDecoder(r)
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&profiles); err != nil {
+		return nil, err
+	}
+	return profiles, nil
+}
+
+// Load returns the profile with the given name from the profile file at path.
+func Load(path, name string) (*Profile, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	profiles, err := Read(f)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %s", path, err.Error())
+	}
+	p, ok := profiles[name]
+	if !ok || p == nil {
+		return nil, ErrNotFound
+	}
+	return p, nil
+}
@@ -0,0 +1,86 @@
+package profile
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func Test_Read(t *testing.T) {
+	profiles, err := Read(strings.NewReader(`
+{
+	"prod": {
+		"host": "db.example.com",
+		"port": 4011,
+		"scheme": "https",
+		"insecure": true
+	},
+	"dev": {
+		"host": "localhost"
+	}
+}`))
+	if err != nil {
+		t.Fatalf("failed to read profiles: %s", err.Error())
+	}
+	if got, exp := len(profiles), 2; got != exp {
+		t.Fatalf("wrong number of profiles, exp %d, got %d", exp, got)
+	}
+
+	p := profiles["prod"]
+	if p.Host != "db.example.com" || p.Port != 4011 || p.Scheme != "https" || !p.Insecure {
+		t.Fatalf("prod profile not parsed correctly: %+v", p)
+	}
+	p = profiles["dev"]
+	if p.Host != "localhost" || p.Port != 0 || p.Scheme != "" || p.Insecure {
+		t.Fatalf("dev profile not parsed correctly: %+v", p)
+	}
+}
+
+func Test_ReadUnknownField(t *testing.T) {
+	_, err := Read(strings.NewReader(`{"prod": {"hostname": "db.example.com"}}`))
+	if err == nil {
+		t.Fatalf("expected error for unknown field")
+	}
+}
+
+func Test_Credentials(t *testing.T) {
+	p := &Profile{}
+	if c, err := p.Credentials(); err != nil || c != "" {
+		t.Fatalf("expected no credentials, got %s, %v", c, err)
+	}
+
+	p = &Profile{Username: "bob", Password: "secret"}
+	if c, err := p.Credentials(); err != nil || c != "bob:secret" {
+		t.Fatalf("wrong credentials, got %s, %v", c, err)
+	}
+
+	p = &Profile{Username: "bob", Password: "secret", PasswordEnv: "RQLITE_TEST_PROFILE_PW"}
+	if _, err := p.Credentials(); err == nil {
+		t.Fatalf("expected error for unset password environment variable")
+	}
+	os.Setenv("RQLITE_TEST_PROFILE_PW", "fromenv")
+	defer os.Unsetenv("RQLITE_TEST_PROFILE_PW")
+	if c, err := p.Credentials(); err != nil || c != "bob:fromenv" {
+		t.Fatalf("wrong credentials, got %s, %v", c, err)
+	}
+}
+
+func Test_Load(t *testing.T) {
+	path := filepath.Join(t.TempDir(), profileFile)
+	if err := os.WriteFile(path, []byte(`{"prod": {"host": "db.example.com"}}`), 0600); err != nil {
+		t.Fatalf("failed to write profile file: %s", err.Error())
+	}
+
+	p, err := Load(path, "prod")
+	if err != nil {
+		t.Fatalf("failed to load profile: %s", err.Error())
+	}
+	if p.Host != "db.example.com" {
+		t.Fatalf("wrong host, got %s", p.Host)
+	}
+
+	if _, err := Load(path, "staging"); err != ErrNotFound {
+		t.Fatalf("expected ErrNotFound, got %v", err)
+	}
+}
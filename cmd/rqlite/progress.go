@@ -0,0 +1,78 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/signal"
+	"strings"
+	"time"
+)
+
+const (
+	// progressDelay is how long a request must be in flight before
+	// progress is displayed.
+	progressDelay = 500 * time.Millisecond
+
+	// progressInterval is how often progress is updated.
+	progressInterval = 100 * time.Millisecond
+)
+
+// errCancelled is returned when the user cancels an in-flight request.
+var errCancelled = errors.New("request cancelled")
+
+var spinnerFrames = []rune{'|', '/', '-', '\\'}
+
+// runWithProgress calls f, displaying an elapsed-time spinner on stderr if f has
+// not returned within progressDelay. If the user presses Ctrl-C while f is
+// running, the context passed to f is cancelled so any HTTP request made with
+// it is aborted, and errCancelled is returned. Ctrl-C does not exit the CLI.
+func runWithProgress(f func(ctx context.Context) error) error {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	sigCh := make(chan os.Signal, 1)
+	signal.Notify(sigCh, os.Interrupt)
+	defer signal.Stop(sigCh)
+
+	doneCh := make(chan error, 1)
+	go func() {
+		doneCh <- f(ctx)
+	}()
+
+	start := time.Now()
+	tck := time.NewTicker(progressInterval)
+	defer tck.Stop()
+
+	var frame, width int
+	clear := func() {
+		if width > 0 {
+			fmt.Fprintf(os.Stderr, "\r%s\r", strings.Repeat(" ", width))
+			width = 0
+		}
+	}
+
+	for {
+		select {
+		case err := <-doneCh:
+			clear()
+			if ctx.Err() != nil {
+				return errCancelled
+			}
+			return err
+		case <-sigCh:
+			cancel()
+		case <-tck.C:
+			elapsed := time.Since(start)
+			if elapsed < progressDelay || ctx.Err() != nil {
+				continue
+			}
+			msg := fmt.Sprintf("%c running %.1fs (Ctrl-C to cancel)",
+				spinnerFrames[frame%len(spinnerFrames)], elapsed.Seconds())
+			fmt.Fprintf(os.Stderr, "\r%s", msg)
+			width = len(msg)
+			frame++
+		}
+	}
+}
@@ -1,7 +1,9 @@
 package main
 
 import (
+	"context"
 	"fmt"
+	"io"
 	"io/ioutil"
 	"net/http"
 	"net/url"
@@ -80,7 +82,7 @@ type queryResponse struct {
 	Time    float64 `json:"time"`
 }
 
-func queryWithClient(ctx *cli.Context, client *cl.Client, timer bool, consistency, query string) error {
+func queryWithClient(ctx *cli.Context, w io.Writer, client *cl.Client, timer bool, consistency, query string) error {
 	queryStr := url.Values{}
 	queryStr.Set("level", consistency)
 	queryStr.Set("q", query)
@@ -92,25 +94,30 @@ func queryWithClient(ctx *cli.Context, client *cl.Client, timer bool, consistenc
 		RawQuery: queryStr.Encode(),
 	}
 
-	resp, err := client.Query(u)
-
 	var hcr error
-	if err != nil {
-		// If the error is HostChangedError, it should be propagated back to the caller to handle
-		// accordingly (change prompt display), but we should still assume that the request succeeded on some
-		// host and not treat it as an error.
-		err, ok := err.(*cl.HostChangedError)
-		if !ok {
-			return err
+	var resp *http.Response
+	var response []byte
+	err := runWithProgress(func(ctx context.Context) error {
+		var err error
+		resp, err = client.QueryContext(ctx, u)
+		if err != nil {
+			// If the error is HostChangedError, it should be propagated back to the caller to handle
+			// accordingly (change prompt display), but we should still assume that the request succeeded on some
+			// host and not treat it as an error.
+			err, ok := err.(*cl.HostChangedError)
+			if !ok {
+				return err
+			}
+			hcr = err
 		}
-		hcr = err
-	}
+		defer resp.Body.Close()
 
-	response, err := ioutil.ReadAll(resp.Body)
+		response, err = ioutil.ReadAll(resp.Body)
+		return err
+	})
 	if err != nil {
 		return err
 	}
-	defer resp.Body.Close()
 
 	if resp.StatusCode != http.StatusOK {
 		return fmt.Errorf("server responded with %s: %s", resp.Status, response)
@@ -132,7 +139,7 @@ func queryWithClient(ctx *cli.Context, client *cl.Client, timer bool, consistenc
 	if err := result.validate(); err != nil {
 		return err
 	}
-	textutil.WriteTable(ctx, result, headerRender)
+	textutil.WriteTable(w, result, headerRender)
 
 	if timer {
 		fmt.Printf("Run Time: %f seconds\n", result.Time)
@@ -0,0 +1,341 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/hex"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/rqlite/rqlite/cluster"
+	"github.com/rqlite/rqlite/command"
+	"github.com/rqlite/rqlite/rtls"
+	"github.com/rqlite/rqlite/store"
+	"github.com/rqlite/rqlite/tcp"
+)
+
+// caTrustFile is the file, in the data directory, holding the CA certificates
+// trusted by the node as a result of CA rotation. It allows a node restarted
+// during, or after, a rotation to connect to the rest of the cluster before
+// it has caught up with the Raft log.
+const caTrustFile = "node-ca-trust.pem"
+
+// caRotator implements CA rotation for node-to-node encryption. The state
+// of the rotation is distributed through the Raft log, and each node updates
+// the CAs it trusts as that state is applied.
+type caRotator struct {
+	cfg     *Config
+	str     *store.Store
+	rotator *rtls.Rotator
+	dialer  *tcp.Dialer
+	logger  *log.Logger
+}
+
+// newNodeRotator returns the Rotator holding the certificate and trusted CAs
+// used for node-to-node encryption, restoring any trust established by CA
+// rotation.
+func newNodeRotator(cfg *Config) (*rtls.Rotator, error) {
+	r, err := rtls.NewRotator(cfg.NodeX509Cert, cfg.NodeX509Key, cfg.NodeX509CACert)
+	if err != nil {
+		return nil, err
+	}
+	b, err := os.ReadFile(filepath.Join(cfg.DataPath, caTrustFile))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return r, nil
+		}
+		return nil, err
+	}
+	cas, err := rtls.ParseCerts(b)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load CA certificates in %s: %s", caTrustFile, err)
+	}
+	r.SetCAs(cas)
+	return r, nil
+}
+
+func newCARotator(cfg *Config, str *store.Store, rotator *rtls.Rotator, tlsConfig *tls.Config) *caRotator {
+	return &caRotator{
+		cfg:     cfg,
+		str:     str,
+		rotator: rotator,
+		dialer:  tcp.NewDialer(cluster.MuxClusterHeader, tlsConfig),
+		logger:  log.New(os.Stderr, "[ca-rotation] ", log.LstdFlags),
+	}
+}
+
+// BeginCARotation implements httpd.CARotator.
+func (c *caRotator) BeginCARotation(ca []byte) error {
+	cas, err := rtls.ParseCerts(ca)
+	if err != nil {
+		return err
+	}
+	for _, cert := range cas {
+		if !cert.IsCA {
+			return fmt.Errorf("%s is not a CA certificate", cert.Subject)
+		}
+	}
+	return c.str.BeginCARotation(ca)
+}
+
+// InstallCertificate implements httpd.CARotator.
+func (c *caRotator) InstallCertificate(cert, key []byte) error {
+	certs, err := rtls.ParseCerts(cert)
+	if err != nil {
+		return err
+	}
+	if _, err := tls.X509KeyPair(cert, key); err != nil {
+		return err
+	}
+	for _, usage := range []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth} {
+		if err := c.rotator.Verify(certs[0], usage); err != nil {
+			return fmt.Errorf("certificate not issued by a trusted CA for %s: %s", usageName(usage), err)
+		}
+	}
+	if !c.cfg.NoNodeVerify {
+		host, _, err := net.SplitHostPort(c.cfg.RaftAdv)
+		if err != nil {
+			return err
+		}
+		if err := certs[0].VerifyHostname(host); err != nil {
+			return err
+		}
+	}
+
+	// Replace the configured files, so the node presents the certificate
+	// when restarted.
+	if err := writeFileAtomic(c.cfg.NodeX509Key, key, 0600); err != nil {
+		return err
+	}
+	if err := writeFileAtomic(c.cfg.NodeX509Cert, cert, 0644); err != nil {
+		return err
+	}
+	if err := c.rotator.SetCertificate(cert, key); err != nil {
+		return err
+	}
+	c.logger.Printf("installed node certificate issued by %s, serial %s", certs[0].Issuer, certs[0].SerialNumber)
+	return nil
+}
+
+// RetireCA implements httpd.CARotator.
+func (c *caRotator) RetireCA(force bool) error {
+	r := c.str.CARotation()
+	if r.GetPhase() != command.CARotation_PHASE_TRANSITION {
+		return store.ErrNoCARotation
+	}
+	if !force {
+		newCAs, err := rtls.ParseCerts(r.Ca)
+		if err != nil {
+			return err
+		}
+		nodes, err := c.nodeCertificates()
+		if err != nil {
+			return err
+		}
+		for _, n := range nodes {
+			if n.err != nil {
+				return fmt.Errorf("failed to check certificate of node %s: %s", n.id, n.err)
+			}
+			if !issuedBy(n.cert, newCAs) {
+				return fmt.Errorf("node %s does not present a certificate issued by the new CA", n.id)
+			}
+		}
+	}
+	return c.str.RetireCA()
+}
+
+// CancelCARotation implements httpd.CARotator.
+func (c *caRotator) CancelCARotation() error {
+	return c.str.CancelCARotation()
+}
+
+// CAStatus implements httpd.CARotator.
+func (c *caRotator) CAStatus() (map[string]interface{}, error) {
+	r := c.str.CARotation()
+	status := map[string]interface{}{
+		"phase": strings.ToLower(strings.TrimPrefix(r.GetPhase().String(), "PHASE_")),
+	}
+	var trusted []map[string]interface{}
+	for _, ca := range c.rotator.CAs() {
+		trusted = append(trusted, certInfo(ca))
+	}
+	status["trusted_cas"] = trusted
+
+	var newCAs []*x509.Certificate
+	if r.GetPhase() == command.CARotation_PHASE_TRANSITION {
+		var err error
+		newCAs, err = rtls.ParseCerts(r.Ca)
+		if err != nil {
+			return nil, err
+		}
+		var infos []map[string]interface{}
+		for _, ca := range newCAs {
+			infos = append(infos, certInfo(ca))
+		}
+		status["new_cas"] = infos
+	}
+
+	nodeCerts, err := c.nodeCertificates()
+	if err != nil {
+		return nil, err
+	}
+	nodes := make(map[string]interface{})
+	for _, n := range nodeCerts {
+		m := map[string]interface{}{
+			"addr": n.addr,
+		}
+		if n.err != nil {
+			m["error"] = n.err.Error()
+		} else {
+			m["certificate"] = certInfo(n.cert)
+			if newCAs != nil {
+				m["reissued"] = issuedBy(n.cert, newCAs)
+			}
+		}
+		nodes[n.id] = m
+	}
+	status["nodes"] = nodes
+	return status, nil
+}
+
+// apply updates the CAs trusted by the node to reflect the state of CA
+// rotation. It is called by the Store as that state changes.
+func (c *caRotator) apply(r *command.CARotation) {
+	var cas []*x509.Certificate
+	var err error
+	switch r.GetPhase() {
+	case command.CARotation_PHASE_TRANSITION:
+		old := c.rotator.ConfiguredCAs()
+		if len(r.RetiringCa) > 0 {
+			old, err = rtls.ParseCerts(r.RetiringCa)
+			if err != nil {
+				break
+			}
+		}
+		var newCAs []*x509.Certificate
+		newCAs, err = rtls.ParseCerts(r.Ca)
+		cas = append(old, newCAs...)
+	case command.CARotation_PHASE_COMPLETE:
+		cas, err = rtls.ParseCerts(r.Ca)
+	}
+	if err != nil {
+		c.logger.Printf("failed to apply CA rotation: %s", err.Error())
+		return
+	}
+	c.rotator.SetCAs(cas)
+	c.logger.Printf("CA rotation phase is %s, trusting %d CA certificate(s)", r.GetPhase(), len(c.rotator.CAs()))
+
+	path := filepath.Join(c.cfg.DataPath, caTrustFile)
+	if cas == nil {
+		err = os.Remove(path)
+		if os.IsNotExist(err) {
+			err = nil
+		}
+	} else {
+		var b bytes.Buffer
+		for _, ca := range cas {
+			pem.Encode(&b, &pem.Block{Type: "CERTIFICATE", Bytes: ca.Raw})
+		}
+		err = writeFileAtomic(path, b.Bytes(), 0644)
+	}
+	if err != nil {
+		c.logger.Printf("failed to persist CA trust: %s", err.Error())
+	}
+}
+
+type nodeCertificate struct {
+	id   string
+	addr string
+	cert *x509.Certificate
+	err  error
+}
+
+// nodeCertificates returns the certificate presented by each node in the
+// cluster.
+func (c *caRotator) nodeCertificates() ([]*nodeCertificate, error) {
+	servers, err := c.str.Nodes()
+	if err != nil {
+		return nil, err
+	}
+	var certs []*nodeCertificate
+	for _, srv := range servers {
+		n := &nodeCertificate{id: srv.ID, addr: srv.Addr}
+		if srv.ID == c.str.ID() {
+			n.cert = c.rotator.Certificate()
+		} else {
+			n.cert, n.err = c.peerCertificate(srv.Addr)
+		}
+		if n.err == nil && n.cert == nil {
+			n.err = errors.New("no certificate presented")
+		}
+		certs = append(certs, n)
+	}
+	return certs, nil
+}
+
+func (c *caRotator) peerCertificate(addr string) (*x509.Certificate, error) {
+	conn, err := c.dialer.Dial(addr, c.cfg.ClusterConnectTimeout)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	tc, ok := conn.(*tls.Conn)
+	if !ok {
+		return nil, errors.New("connection not encrypted")
+	}
+	certs := tc.ConnectionState().PeerCertificates
+	if len(certs) == 0 {
+		return nil, nil
+	}
+	return certs[0], nil
+}
+
+func issuedBy(cert *x509.Certificate, cas []*x509.Certificate) bool {
+	for _, ca := range cas {
+		if cert.CheckSignatureFrom(ca) == nil {
+			return true
+		}
+	}
+	return false
+}
+
+func certInfo(cert *x509.Certificate) map[string]interface{} {
+	fp := sha256.Sum256(cert.Raw)
+	return map[string]interface{}{
+		"subject":     cert.Subject.String(),
+		"issuer":      cert.Issuer.String(),
+		"serial":      cert.SerialNumber.String(),
+		"not_after":   cert.NotAfter.Format(time.RFC3339),
+		"fingerprint": hex.EncodeToString(fp[:]),
+	}
+}
+
+func usageName(usage x509.ExtKeyUsage) string {
+	if usage == x509.ExtKeyUsageServerAuth {
+		return "server authentication"
+	}
+	return "client authentication"
+}
+
+// writeFileAtomic writes b to path, such that path contains either its
+// previous contents, or b, should the write fail.
+func writeFileAtomic(path string, b []byte, perm os.FileMode) error {
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, b, perm); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	return nil
+}
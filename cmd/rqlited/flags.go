@@ -28,6 +28,11 @@ const (
 	RaftAddrFlag    = "raft-addr"
 	RaftAdvAddrFlag = "raft-adv-addr"
 
+	RaftTimingProfileNone  = ""
+	RaftTimingProfileLAN   = "lan"
+	RaftTimingProfileCloud = "cloud"
+	RaftTimingProfileWAN   = "wan"
+
 	HTTPx509CertFlag = "http-cert"
 	HTTPx509KeyFlag  = "http-key"
 	NodeX509CertFlag = "node-cert"
@@ -54,12 +59,72 @@ type Config struct {
 	// AuthFile is the path to the authentication file. May not be set.
 	AuthFile string `filepath:"true"`
 
+	// AuthHash is the password hashing algorithm, and its parameters, with
+	// which hashed passwords in the authentication file are rehashed when
+	// next used. May not be set.
+	AuthHash string
+
+	// AuthLockoutThreshold is the number of consecutive authentication
+	// failures after which a username, or IP address, is locked out. Zero
+	// disables lockouts.
+	AuthLockoutThreshold int
+
+	// AuthLockout is the initial lockout, which doubles with each further
+	// failure.
+	AuthLockout time.Duration
+
+	// AuthLockoutMax is the maximum lockout.
+	AuthLockoutMax time.Duration
+
+	// UserMaxQueries is the number of queries each user may have in flight.
+	// 0 disables the limit.
+	UserMaxQueries int
+
+	// UserQueryWait is how long a query beyond the limit waits to be made.
+	UserQueryWait time.Duration
+
+	// ParseCacheSize is the number of request bodies whose parsed statements
+	// are cached. 0 disables the cache.
+	ParseCacheSize int
+
+	// TemplatesFile is the path to the query templates file. May not be set.
+	TemplatesFile string `filepath:"true"`
+
+	// IPFilterFile is the path to the file of CIDR allow and deny lists for
+	// the HTTP and Raft listeners. May not be set.
+	IPFilterFile string `filepath:"true"`
+
+	// RiskyWrites sets how requests holding risky writes, such as a DELETE
+	// without a WHERE clause, are handled: allow, warn, or confirm.
+	RiskyWrites string
+
+	// RedactColumns is a comma-delimited list of columns stripped from query
+	// responses for users without the unredacted permission.
+	RedactColumns string
+
+	// RestrictedAPI disables the database endpoints, so that the database
+	// may be accessed only by invoking query templates.
+	RestrictedAPI bool
+
+	// GraphQL enables the GraphQL endpoint.
+	GraphQL bool
+
+	// REST enables the REST endpoints for each table.
+	REST bool
+
 	// AutoBackupFile is the path to the auto-backup file. May not be set.
 	AutoBackupFile string `filepath:"true"`
 
 	// AutoRestoreFile is the path to the auto-restore file. May not be set.
 	AutoRestoreFile string `filepath:"true"`
 
+	// OnStartSQLFile is the path to a file of SQL executed once by the cluster,
+	// when it first forms. May not be set.
+	OnStartSQLFile string `filepath:"true"`
+
+	// EventsWebhookURL is the URL to which storage events are POSTed. May not be set.
+	EventsWebhookURL string
+
 	// HTTPx509CACert is the path to the CA certficate file for when this node verifies
 	// other certificates for any HTTP communications. May not be set.
 	HTTPx509CACert string `filepath:"true"`
@@ -99,6 +164,14 @@ type Config struct {
 	// NodeID is the Raft ID for the node.
 	NodeID string
 
+	// nodeIDDefaulted is whether NodeID was not set explicitly, and so
+	// defaulted to the advertised Raft address.
+	nodeIDDefaulted bool
+
+	// NodeLocality is the location of the node, such as its availability
+	// zone, as shown in the cluster topology. May not be set.
+	NodeLocality string
+
 	// RaftAddr is the bind network address for the Raft server.
 	RaftAddr string
 
@@ -123,6 +196,14 @@ type Config struct {
 	// JoinInterval is the time between retrying failed join operations.
 	JoinInterval time.Duration
 
+	// JoinToken is the join token presented when joining a cluster, which
+	// may be a secret reference. May not be set.
+	JoinToken string
+
+	// JoinTokenRequired requires nodes joining the cluster via this node,
+	// while it is the Leader, to present a join token.
+	JoinTokenRequired bool
+
 	// BootstrapExpect is the minimum number of nodes required for a bootstrap.
 	BootstrapExpect int
 
@@ -144,6 +225,10 @@ type Config struct {
 	// PprofEnabled enables Go PProf information. Defaults to true.
 	PprofEnabled bool
 
+	// HTTPSessionConsistency enables read-your-writes consistency for HTTP
+	// client sessions.
+	HTTPSessionConsistency bool
+
 	// OnDisk enables on-disk mode.
 	OnDisk bool
 
@@ -156,18 +241,74 @@ type Config struct {
 	// FKConstraints enables SQLite foreign key constraints.
 	FKConstraints bool
 
+	// DBSizeInterval is the interval at which the size of the database,
+	// and of each of its tables, is measured.
+	DBSizeInterval time.Duration
+
+	// SQLiteBusyTimeout is how long SQLite waits for a lock before a statement
+	// fails because the database is locked. Zero means the driver default.
+	SQLiteBusyTimeout time.Duration
+
+	// SQLiteBusyRetries is the number of times a statement which fails because
+	// the database is locked is retried.
+	SQLiteBusyRetries int
+
+	// SQLiteBusyRetryDelay is the delay before a statement which failed because
+	// the database is locked is first retried.
+	SQLiteBusyRetryDelay time.Duration
+
+	// SQLiteMinVersion is the oldest version of SQLite run by any node in the
+	// cluster. DDL which that version cannot apply is rejected. May not be set.
+	SQLiteMinVersion string
+
+	// AllowNonDeterministicTriggers allows triggers whose effects may differ
+	// from node to node to be created.
+	AllowNonDeterministicTriggers bool
+
 	// RaftLogLevel sets the minimum logging level for the Raft subsystem.
 	RaftLogLevel string
 
 	// RaftNonVoter controls whether this node is a voting, read-only node.
 	RaftNonVoter bool
 
+	// RaftNonVoterPromote controls whether a non-voting node requests promotion
+	// to voter once it has caught up with the Leader.
+	RaftNonVoterPromote bool
+
 	// RaftSnapThreshold is the number of outstanding log entries that trigger snapshot.
 	RaftSnapThreshold uint64
 
 	// RaftSnapInterval sets the threshold check interval.
 	RaftSnapInterval time.Duration
 
+	// RaftMaxEntrySize is the maximum size of an execute request written to
+	// a single Raft log entry. Larger requests are split across entries.
+	RaftMaxEntrySize int
+
+	// WriteMaxBacklog is the number of writes the Leader may have waiting to
+	// be applied before further writes are refused. 0 means no maximum.
+	WriteMaxBacklog int
+
+	// RaftSnapRetain is the number of snapshots retained by the node.
+	RaftSnapRetain int
+
+	// RaftSnapArchiveDir is the directory to which each snapshot is copied
+	// once persisted. It must exist, so that an unmounted network volume is
+	// not mistaken for its mount point.
+	RaftSnapArchiveDir string `filepath:"true"`
+
+	// RaftSnapArchiveRetain is the number of snapshots retained in the
+	// archive directory. Zero means all are retained.
+	RaftSnapArchiveRetain int
+
+	// RaftSnapSendMax is the number of snapshots the node may send to other
+	// nodes concurrently. Zero means no limit.
+	RaftSnapSendMax int
+
+	// RaftSnapSendRate is the rate, in bytes per second, at which each snapshot
+	// is sent to another node. Zero means no limit.
+	RaftSnapSendRate int64
+
 	// RaftLeaderLeaseTimeout sets the leader lease timeout.
 	RaftLeaderLeaseTimeout time.Duration
 
@@ -177,6 +318,22 @@ type Config struct {
 	// RaftElectionTimeout sets the election timeout.
 	RaftElectionTimeout time.Duration
 
+	// RaftCommitTimeout sets the time without an Apply operation before
+	// the Leader sends an AppendEntries RPC to followers.
+	RaftCommitTimeout time.Duration
+
+	// RaftMaxAppendEntries sets the maximum number of log entries sent in
+	// a single AppendEntries RPC, pacing how quickly lagging followers catch up.
+	RaftMaxAppendEntries int
+
+	// RaftTimingProfile selects a preset for Raft timing. Explicitly-set
+	// timing flags take precedence over the preset.
+	RaftTimingProfile string
+
+	// RaftRecover requests recovery of the node's Raft state at startup. It
+	// must be set to the node's ID, as confirmation.
+	RaftRecover string
+
 	// RaftApplyTimeout sets the Log-apply timeout.
 	RaftApplyTimeout time.Duration
 
@@ -206,6 +363,21 @@ type Config struct {
 	// the cluster, for non-Raft communications.
 	ClusterConnectTimeout time.Duration
 
+	// ClusterProbeInterval is the interval at which the round-trip time to,
+	// and bandwidth available to, each other node is measured.
+	ClusterProbeInterval time.Duration
+
+	// ClusterProbeBytes is the size of the payload sent to each other node to
+	// measure bandwidth. If 0, bandwidth is not measured.
+	ClusterProbeBytes int
+
+	// ClusterSigningKey is the key, shared by all nodes, used to sign commands
+	// sent between nodes. It may be a reference to a secret. May not be set.
+	ClusterSigningKey string
+
+	// ClusterAudit enables logging of commands received from other nodes.
+	ClusterAudit bool
+
 	// WriteQueueCap is the default capacity of Execute queues
 	WriteQueueCap int
 
@@ -219,6 +391,10 @@ type Config struct {
 	// WriteQueueTx controls whether writes from the queue are done within a transaction.
 	WriteQueueTx bool
 
+	// WriteQueueCoalesce is a comma-delimited list of tables whose idempotent
+	// upserts are coalesced within each batch of queued writes.
+	WriteQueueCoalesce string
+
 	// CompressionSize sets request query size for compression attempt
 	CompressionSize int
 
@@ -232,6 +408,71 @@ type Config struct {
 	MemProfile string
 }
 
+// raftTiming is a set of Raft timing values, tuned for a given network.
+type raftTiming struct {
+	heartbeatTimeout   time.Duration
+	electionTimeout    time.Duration
+	leaderLeaseTimeout time.Duration
+	commitTimeout      time.Duration
+	maxAppendEntries   int
+}
+
+// raftTimingProfiles are the Raft timing presets. The LAN profile matches
+// the Raft defaults. The cloud and WAN profiles tolerate progressively
+// higher, and more variable, round-trip times between nodes, trading
+// slower failure detection for fewer spurious elections.
+var raftTimingProfiles = map[string]raftTiming{
+	RaftTimingProfileLAN: {
+		heartbeatTimeout:   time.Second,
+		electionTimeout:    time.Second,
+		leaderLeaseTimeout: 500 * time.Millisecond,
+		commitTimeout:      50 * time.Millisecond,
+		maxAppendEntries:   64,
+	},
+	RaftTimingProfileCloud: {
+		heartbeatTimeout:   2 * time.Second,
+		electionTimeout:    2 * time.Second,
+		leaderLeaseTimeout: time.Second,
+		commitTimeout:      100 * time.Millisecond,
+		maxAppendEntries:   128,
+	},
+	RaftTimingProfileWAN: {
+		heartbeatTimeout:   5 * time.Second,
+		electionTimeout:    5 * time.Second,
+		leaderLeaseTimeout: 2500 * time.Millisecond,
+		commitTimeout:      250 * time.Millisecond,
+		maxAppendEntries:   512,
+	},
+}
+
+// applyRaftTimingProfile sets the Raft timing configuration from the
+// selected profile. Any flag named in set is left unchanged.
+func (c *Config) applyRaftTimingProfile(set map[string]bool) error {
+	if c.RaftTimingProfile == RaftTimingProfileNone {
+		return nil
+	}
+	p, ok := raftTimingProfiles[c.RaftTimingProfile]
+	if !ok {
+		return fmt.Errorf("unknown Raft timing profile '%s'", c.RaftTimingProfile)
+	}
+	if !set["raft-timeout"] {
+		c.RaftHeartbeatTimeout = p.heartbeatTimeout
+	}
+	if !set["raft-election-timeout"] {
+		c.RaftElectionTimeout = p.electionTimeout
+	}
+	if !set["raft-leader-lease-timeout"] {
+		c.RaftLeaderLeaseTimeout = p.leaderLeaseTimeout
+	}
+	if !set["raft-commit-timeout"] {
+		c.RaftCommitTimeout = p.commitTimeout
+	}
+	if !set["raft-max-append-entries"] {
+		c.RaftMaxAppendEntries = p.maxAppendEntries
+	}
+	return nil
+}
+
 // Validate checks the configuration for internal consistency, and activates
 // important rqlite policies. It must be called at least once on a Config
 // object before the Config object is used. It is OK to call more than
@@ -241,6 +482,28 @@ func (c *Config) Validate() error {
 		return errors.New("-on-disk-path is set, but -on-disk is not")
 	}
 
+	if c.RaftSnapRetain < 1 {
+		return errors.New("-raft-snap-retain must be at least 1")
+	}
+	if c.SQLiteBusyTimeout < 0 || c.SQLiteBusyRetries < 0 || c.SQLiteBusyRetryDelay < 0 {
+		return errors.New("-sqlite-busy-timeout, -sqlite-busy-retries and -sqlite-busy-retry-delay must not be negative")
+	}
+	if c.RaftMaxEntrySize < 0 {
+		return errors.New("-raft-max-entry-size must not be negative")
+	}
+	if c.WriteMaxBacklog < 0 {
+		return errors.New("-write-max-backlog must not be negative")
+	}
+	if c.RaftSnapArchiveRetain < 0 {
+		return errors.New("-raft-snap-archive-retain must not be negative")
+	}
+	if c.RaftSnapSendMax < 0 {
+		return errors.New("-raft-snap-send-max must not be negative")
+	}
+	if c.RaftSnapSendRate < 0 {
+		return errors.New("-raft-snap-send-rate must not be negative")
+	}
+
 	dataPath, err := filepath.Abs(c.DataPath)
 	if err != nil {
 		return fmt.Errorf("failed to determine absolute data path: %s", err.Error())
@@ -260,10 +523,34 @@ func (c *Config) Validate() error {
 
 	}
 
+	if c.AuthHash != "" && c.AuthFile == "" {
+		return errors.New("-auth-hash is set, but -auth is not")
+	}
+
+	if c.AuthLockoutThreshold < 0 {
+		return errors.New("-auth-lockout-threshold must not be negative")
+	}
+	if c.AuthLockoutThreshold > 0 && (c.AuthLockout <= 0 || c.AuthLockoutMax < c.AuthLockout) {
+		return errors.New("-auth-lockout must be positive, and no greater than -auth-lockout-max")
+	}
+	if c.UserMaxQueries < 0 {
+		return errors.New("-user-max-queries must not be negative")
+	}
+	if c.ParseCacheSize < 0 {
+		return errors.New("-http-parse-cache must not be negative")
+	}
+
 	if c.RaftAddr == c.HTTPAddr {
 		return errors.New("HTTP and Raft addresses must differ")
 	}
 
+	if c.EventsWebhookURL != "" {
+		u, err := url.Parse(c.EventsWebhookURL)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return errors.New("events webhook URL must be a valid HTTP or HTTPS URL")
+		}
+	}
+
 	// Enforce policies regarding addresses
 	if c.RaftAdv == "" {
 		c.RaftAdv = c.RaftAddr
@@ -275,6 +562,11 @@ func (c *Config) Validate() error {
 	// Node ID policy
 	if c.NodeID == "" {
 		c.NodeID = c.RaftAdv
+		c.nodeIDDefaulted = true
+	}
+
+	if c.RaftRecover != "" && !c.nodeIDDefaulted && c.RaftRecover != c.NodeID {
+		return fmt.Errorf("-raft-recover must be set to this node's ID (%s) to confirm recovery", c.NodeID)
 	}
 
 	// Perfom some address validity checks.
@@ -316,6 +608,16 @@ func (c *Config) Validate() error {
 	if c.BootstrapExpect > 0 && c.RaftNonVoter {
 		return errors.New("bootstrapping only applicable to voting nodes")
 	}
+	if c.RaftNonVoterPromote && !c.RaftNonVoter {
+		return errors.New("-raft-non-voter-promote is set, but -raft-non-voter is not")
+	}
+
+	if c.RaftMaxAppendEntries < 0 {
+		return errors.New("-raft-max-append-entries must not be negative")
+	}
+	if c.RaftLeaderLeaseTimeout > c.RaftHeartbeatTimeout {
+		return errors.New("Raft leader lease timeout must not exceed heartbeat timeout")
+	}
 
 	// Join parameters OK?
 	if c.JoinAddr != "" {
@@ -335,10 +637,23 @@ func (c *Config) Validate() error {
 			}
 		}
 	}
+	if c.ClusterProbeInterval <= 0 {
+		return errors.New("-cluster-probe-int must be positive")
+	}
+	if c.ClusterProbeBytes < 0 {
+		return errors.New("-cluster-probe-bytes cannot be negative")
+	}
+
 	if c.JoinSrcIP != "" && net.ParseIP(c.JoinSrcIP) == nil {
 		return fmt.Errorf("invalid join source IP address: %s", c.JoinSrcIP)
 	}
 
+	switch c.RiskyWrites {
+	case "allow", "warn", "confirm":
+	default:
+		return fmt.Errorf("risky writes mode must be one of allow, warn, or confirm")
+	}
+
 	// Valid disco mode?
 	switch c.DiscoMode {
 	case "":
@@ -367,6 +682,36 @@ func (c *Config) JoinAddresses() []string {
 	return strings.Split(c.JoinAddr, ",")
 }
 
+// RedactedColumns returns the columns to redact from query responses. Returns
+// nil if no columns were set.
+func (c *Config) RedactedColumns() []string {
+	if c.RedactColumns == "" {
+		return nil
+	}
+	var cols []string
+	for _, col := range strings.Split(c.RedactColumns, ",") {
+		if col = strings.TrimSpace(col); col != "" {
+			cols = append(cols, col)
+		}
+	}
+	return cols
+}
+
+// WriteQueueCoalesceTables returns the tables whose upserts are coalesced in
+// the write queue. Returns nil if no tables were set.
+func (c *Config) WriteQueueCoalesceTables() []string {
+	if c.WriteQueueCoalesce == "" {
+		return nil
+	}
+	var tables []string
+	for _, t := range strings.Split(c.WriteQueueCoalesce, ",") {
+		if t = strings.TrimSpace(t); t != "" {
+			tables = append(tables, t)
+		}
+	}
+	return tables
+}
+
 // HTTPURL returns the fully-formed, advertised HTTP API address for this config, including
 // protocol, host and port.
 func (c *Config) HTTPURL() string {
@@ -441,6 +786,7 @@ func ParseFlags(name, desc string, build *BuildInfo) (*Config, error) {
 	showVersion := false
 
 	flag.StringVar(&config.NodeID, "node-id", "", "Unique name for node. If not set, set to advertised Raft address")
+	flag.StringVar(&config.NodeLocality, "node-locality", "", "Location of node, such as its availability zone, shown in the cluster topology")
 	flag.StringVar(&config.HTTPAddr, HTTPAddrFlag, "localhost:4001", "HTTP server bind address. To enable HTTPS, set X.509 certificate and key")
 	flag.StringVar(&config.HTTPAdv, HTTPAdvAddrFlag, "", "Advertised HTTP address. If not set, same as HTTP server bind")
 	flag.BoolVar(&config.TLS1011, "tls1011", false, "Support deprecated TLS versions 1.0 and 1.1")
@@ -456,8 +802,24 @@ func ParseFlags(name, desc string, build *BuildInfo) (*Config, error) {
 	flag.BoolVar(&config.NoNodeVerify, "node-no-verify", false, "Skip verification of any node-node certificate")
 	flag.BoolVar(&config.NodeVerifyClient, "node-verify-client", false, "Enable mutual TLS for node-to-node communication")
 	flag.StringVar(&config.AuthFile, "auth", "", "Path to authentication and authorization file. If not set, not enabled")
+	flag.StringVar(&config.AuthHash, "auth-hash", "", "Password hashing algorithm and parameters, such as argon2id:t=3,m=65536,p=4 or bcrypt:cost=12, to which hashed passwords are migrated when next used. If not set, not enabled")
+	flag.IntVar(&config.AuthLockoutThreshold, "auth-lockout-threshold", 10, "Consecutive authentication failures after which a username or IP address is locked out. 0 disables lockouts")
+	flag.DurationVar(&config.AuthLockout, "auth-lockout", time.Second, "Initial authentication lockout, doubled with each further failure")
+	flag.DurationVar(&config.AuthLockoutMax, "auth-lockout-max", 5*time.Minute, "Maximum authentication lockout")
+	flag.IntVar(&config.UserMaxQueries, "user-max-queries", 0, "Maximum queries each user may have in flight on this node. 0 disables the limit")
+	flag.IntVar(&config.ParseCacheSize, "http-parse-cache", 0, "Number of request bodies whose parsed statements are cached, so repeated requests are parsed once. 0 disables the cache")
+	flag.DurationVar(&config.UserQueryWait, "user-query-wait", 5*time.Second, "How long a query beyond the per-user limit waits before being refused")
+	flag.StringVar(&config.TemplatesFile, "http-templates", "", "Path to query templates file. If not set, no templates may be invoked")
+	flag.StringVar(&config.IPFilterFile, "ip-filter", "", "Path to JSON file of CIDR allow and deny lists for the HTTP and Raft listeners. Reloaded on SIGHUP")
+	flag.StringVar(&config.RiskyWrites, "http-risky-writes", "allow", "Handling of risky writes, such as DELETE without WHERE: allow, warn in responses, or confirm, refusing them unless confirmed by a user with the risky-writes permission")
+	flag.StringVar(&config.RedactColumns, "http-redact-columns", "", "Comma-delimited list of columns stripped from query responses, unless the user has the unredacted permission")
+	flag.BoolVar(&config.RestrictedAPI, "http-restricted", false, "Disable /db/, /graphql and REST endpoints, allowing database access only via query templates")
+	flag.BoolVar(&config.GraphQL, "http-graphql", false, "Serve GraphQL queries and mutations of the database tables at /graphql")
+	flag.BoolVar(&config.REST, "http-rest", false, "Serve REST endpoints for each database table at /api/<table>")
 	flag.StringVar(&config.AutoBackupFile, "auto-backup", "", "Path to automatic backup configuration file. If not set, not enabled")
 	flag.StringVar(&config.AutoRestoreFile, "auto-restore", "", "Path to automatic restore configuration file. If not set, not enabled")
+	flag.StringVar(&config.OnStartSQLFile, "on-start-sql", "", "Path to file of SQL, such as a schema, executed once by the cluster when it first forms. If not set, not enabled")
+	flag.StringVar(&config.EventsWebhookURL, "events-webhook", "", "URL to which storage events are POSTed as JSON. If not set, not enabled")
 	flag.StringVar(&config.RaftAddr, RaftAddrFlag, "localhost:4002", "Raft communication bind address")
 	flag.StringVar(&config.RaftAdv, RaftAdvAddrFlag, "", "Advertised Raft communication address. If not set, same as Raft bind")
 	flag.StringVar(&config.JoinSrcIP, "join-source-ip", "", "Set source IP address during HTTP Join request")
@@ -465,6 +827,8 @@ func ParseFlags(name, desc string, build *BuildInfo) (*Config, error) {
 	flag.StringVar(&config.JoinAs, "join-as", "", "Username in authentication file to join as. If not set, joins anonymously")
 	flag.IntVar(&config.JoinAttempts, "join-attempts", 5, "Number of join attempts to make")
 	flag.DurationVar(&config.JoinInterval, "join-interval", 3*time.Second, "Period between join attempts")
+	flag.StringVar(&config.JoinToken, "join-token", "", "Join token to present when joining a cluster. May be a secret reference")
+	flag.BoolVar(&config.JoinTokenRequired, "join-token-required", false, "Require nodes joining the cluster to present a join token")
 	flag.IntVar(&config.BootstrapExpect, "bootstrap-expect", 0, "Minimum number of nodes required for a bootstrap")
 	flag.DurationVar(&config.BootstrapExpectTimeout, "bootstrap-expect-timeout", 120*time.Second, "Maximum time for bootstrap process")
 	flag.StringVar(&config.DiscoMode, "disco-mode", "", "Choose clustering discovery mode. If not set, no node discovery is performed")
@@ -472,17 +836,36 @@ func ParseFlags(name, desc string, build *BuildInfo) (*Config, error) {
 	flag.StringVar(&config.DiscoConfig, "disco-config", "", "Set discovery config, or path to cluster discovery config file")
 	flag.BoolVar(&config.Expvar, "expvar", true, "Serve expvar data on HTTP server")
 	flag.BoolVar(&config.PprofEnabled, "pprof", true, "Serve pprof data on HTTP server")
+	flag.BoolVar(&config.HTTPSessionConsistency, "http-session-consistency", false, "Upgrade reads so clients see their own writes, tracked by cookie or header")
 	flag.BoolVar(&config.OnDisk, "on-disk", false, "Use an on-disk SQLite database")
 	flag.StringVar(&config.OnDiskPath, "on-disk-path", "", "Path for SQLite on-disk database file. If not set, use file in data directory")
 	flag.BoolVar(&config.OnDiskStartup, "on-disk-startup", false, "Do not initialize on-disk database in memory first at startup")
-	flag.BoolVar(&config.FKConstraints, "fk", false, "Enable SQLite foreign key constraints")
+	flag.BoolVar(&config.FKConstraints, "fk", false, "Enable SQLite foreign key constraints, until set for the cluster via the /fk endpoint")
+	flag.DurationVar(&config.DBSizeInterval, "db-size-int", time.Minute, "Interval at which the database and table sizes served at /db/size are measured. Use 0s to measure on each request")
+	flag.DurationVar(&config.SQLiteBusyTimeout, "sqlite-busy-timeout", 0, "How long SQLite waits for a lock before a statement fails. Use 0s for the default")
+	flag.IntVar(&config.SQLiteBusyRetries, "sqlite-busy-retries", 0, "Number of times a statement which failed because the database was locked is retried")
+	flag.DurationVar(&config.SQLiteBusyRetryDelay, "sqlite-busy-retry-delay", 10*time.Millisecond, "Delay before first retrying a statement which failed because the database was locked, doubling with each retry")
+	flag.StringVar(&config.SQLiteMinVersion, "sqlite-min-version", "", "If set, reject DDL, such as STRICT tables, which this version of SQLite cannot apply. Set to the oldest version run by any node")
+	flag.BoolVar(&config.AllowNonDeterministicTriggers, "allow-nondeterministic-triggers", false, "If set, allow triggers which call random() or read the current time, and so may leave nodes holding different data, to be created")
 	flag.BoolVar(&showVersion, "version", false, "Show version information and exit")
 	flag.BoolVar(&config.RaftNonVoter, "raft-non-voter", false, "Configure as non-voting node")
+	flag.BoolVar(&config.RaftNonVoterPromote, "raft-non-voter-promote", false, "Promote this non-voting node to voter once it has caught up with the Leader")
 	flag.DurationVar(&config.RaftHeartbeatTimeout, "raft-timeout", time.Second, "Raft heartbeat timeout")
 	flag.DurationVar(&config.RaftElectionTimeout, "raft-election-timeout", time.Second, "Raft election timeout")
+	flag.DurationVar(&config.RaftCommitTimeout, "raft-commit-timeout", 0, "Raft commit timeout. Use 0s for Raft default")
+	flag.IntVar(&config.RaftMaxAppendEntries, "raft-max-append-entries", 0, "Maximum log entries per Raft AppendEntries request. Use 0 for Raft default")
+	flag.StringVar(&config.RaftTimingProfile, "raft-timing-profile", RaftTimingProfileNone, "Raft timing preset, one of 'lan', 'cloud', or 'wan'. Explicitly-set timing flags override the preset")
+	flag.StringVar(&config.RaftRecover, "raft-recover", "", "Recover Raft state at startup, salvaging what is readable. Set to this node's ID to confirm")
 	flag.DurationVar(&config.RaftApplyTimeout, "raft-apply-timeout", 10*time.Second, "Raft apply timeout")
 	flag.Uint64Var(&config.RaftSnapThreshold, "raft-snap", 8192, "Number of outstanding log entries that trigger snapshot")
 	flag.DurationVar(&config.RaftSnapInterval, "raft-snap-int", 30*time.Second, "Snapshot threshold check interval")
+	flag.IntVar(&config.RaftMaxEntrySize, "raft-max-entry-size", 0, "Maximum size in bytes of a Raft log entry, larger execute requests are split across entries. 0 means no maximum")
+	flag.IntVar(&config.WriteMaxBacklog, "write-max-backlog", 0, "Maximum writes the Leader may have waiting to be applied, before refusing further writes. 0 means no maximum")
+	flag.IntVar(&config.RaftSnapRetain, "raft-snap-retain", 2, "Number of snapshots retained by the node")
+	flag.StringVar(&config.RaftSnapArchiveDir, "raft-snap-archive-dir", "", "If set, existing directory to which each snapshot is copied once persisted")
+	flag.IntVar(&config.RaftSnapArchiveRetain, "raft-snap-archive-retain", 0, "Number of snapshots retained in the archive directory, 0 retains all")
+	flag.IntVar(&config.RaftSnapSendMax, "raft-snap-send-max", 0, "Maximum number of snapshots sent to other nodes concurrently. 0 means no limit")
+	flag.Int64Var(&config.RaftSnapSendRate, "raft-snap-send-rate", 0, "Maximum rate, in bytes per second, at which each snapshot is sent to another node. 0 means no limit")
 	flag.DurationVar(&config.RaftLeaderLeaseTimeout, "raft-leader-lease-timeout", 0, "Raft leader lease timeout. Use 0s for Raft default")
 	flag.BoolVar(&config.RaftStepdownOnShutdown, "raft-shutdown-stepdown", true, "Stepdown as leader before shutting down. Enabled by default")
 	flag.BoolVar(&config.RaftShutdownOnRemove, "raft-remove-shutdown", false, "Shutdown Raft if node removed")
@@ -492,10 +875,15 @@ func ParseFlags(name, desc string, build *BuildInfo) (*Config, error) {
 	flag.DurationVar(&config.RaftReapNodeTimeout, "raft-reap-node-timeout", 0*time.Hour, "Time after which a non-reachable voting node will be reaped. If not set, no reaping takes place")
 	flag.DurationVar(&config.RaftReapReadOnlyNodeTimeout, "raft-reap-read-only-node-timeout", 0*time.Hour, "Time after which a non-reachable non-voting node will be reaped. If not set, no reaping takes place")
 	flag.DurationVar(&config.ClusterConnectTimeout, "cluster-connect-timeout", 30*time.Second, "Timeout for initial connection to other nodes")
+	flag.DurationVar(&config.ClusterProbeInterval, "cluster-probe-int", 10*time.Second, "Interval at which latency and bandwidth to other nodes are measured")
+	flag.IntVar(&config.ClusterProbeBytes, "cluster-probe-bytes", 256*1024, "Size of payload sent to other nodes to measure bandwidth. If 0, bandwidth is not measured")
+	flag.StringVar(&config.ClusterSigningKey, "cluster-signing-key", "", "Key, shared by all nodes, used to sign commands sent between nodes. May be a secret reference. If not set, commands are not signed")
+	flag.BoolVar(&config.ClusterAudit, "cluster-audit", false, "Log each command received from another node which changes the database or cluster")
 	flag.IntVar(&config.WriteQueueCap, "write-queue-capacity", 1024, "Write queue capacity")
 	flag.IntVar(&config.WriteQueueBatchSz, "write-queue-batch-size", 128, "Write queue batch size")
 	flag.DurationVar(&config.WriteQueueTimeout, "write-queue-timeout", 50*time.Millisecond, "Write queue timeout")
 	flag.BoolVar(&config.WriteQueueTx, "write-queue-tx", false, "Use a transaction when writing from queue")
+	flag.StringVar(&config.WriteQueueCoalesce, "write-queue-coalesce", "", "Comma-delimited list of tables whose repeated upserts of a row are coalesced within each batch of queued writes")
 	flag.IntVar(&config.CompressionSize, "compression-size", 150, "Request query size for Raft log compression attempt")
 	flag.IntVar(&config.CompressionBatch, "compression-batch", 5, "Request batch threshold for Raft log compression attempt")
 	flag.StringVar(&config.CPUProfile, "cpu-profile", "", "Path to file for CPU profiling information")
@@ -527,6 +915,15 @@ func ParseFlags(name, desc string, build *BuildInfo) (*Config, error) {
 		}
 	})
 
+	// Apply any Raft timing preset to those flags not set explicitly.
+	setFlags := make(map[string]bool)
+	flag.Visit(func(f *flag.Flag) {
+		setFlags[f.Name] = true
+	})
+	if err := config.applyRaftTimingProfile(setFlags); err != nil {
+		errorExit(1, err.Error())
+	}
+
 	// Ensure the data path is set.
 	if flag.NArg() < 1 {
 		errorExit(1, "no data directory set")
@@ -0,0 +1,105 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/rqlite/rqlite/tcp"
+)
+
+// ipFilterLists are the allow and deny lists of a single listener.
+type ipFilterLists struct {
+	Allow []string `json:"allow"`
+	Deny  []string `json:"deny"`
+}
+
+// ipFilterConfig is the contents of the IP filter file. A listener which is
+// not configured accepts connections from any address.
+type ipFilterConfig struct {
+	HTTP ipFilterLists `json:"http"`
+	Raft ipFilterLists `json:"raft"`
+}
+
+// ipFilters are the filters of the HTTP and Raft listeners.
+type ipFilters struct {
+	path string
+	http *tcp.IPFilter
+	raft *tcp.IPFilter
+}
+
+// newIPFilters returns the filters of the HTTP and Raft listeners, loaded
+// from the file at path.
+func newIPFilters(path string) (*ipFilters, error) {
+	f := &ipFilters{
+		path: path,
+		http: tcp.NewIPFilter("http"),
+		raft: tcp.NewIPFilter("raft"),
+	}
+	if err := f.load(); err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+// load sets the lists of the filters from the file. Neither filter is changed
+// if the file is invalid.
+func (f *ipFilters) load() error {
+	b, err := ioutil.ReadFile(f.path)
+	if err != nil {
+		return err
+	}
+	var cfg ipFilterConfig
+	if err := json.Unmarshal(b, &cfg); err != nil {
+		return fmt.Errorf("failed to parse IP filter file %s: %s", f.path, err.Error())
+	}
+
+	// Check both sets of lists before changing either filter.
+	if err := tcp.ValidateIPLists(cfg.HTTP.Allow, cfg.HTTP.Deny); err != nil {
+		return fmt.Errorf("invalid HTTP IP filter: %s", err.Error())
+	}
+	if err := tcp.ValidateIPLists(cfg.Raft.Allow, cfg.Raft.Deny); err != nil {
+		return fmt.Errorf("invalid Raft IP filter: %s", err.Error())
+	}
+	if err := f.http.Set(cfg.HTTP.Allow, cfg.HTTP.Deny); err != nil {
+		return err
+	}
+	return f.raft.Set(cfg.Raft.Allow, cfg.Raft.Deny)
+}
+
+// reloadOnHangup reloads the filters whenever the process receives SIGHUP.
+// A file which fails to load leaves the filters unchanged.
+func (f *ipFilters) reloadOnHangup() {
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	go func() {
+		for range hup {
+			if err := f.load(); err != nil {
+				log.Printf("failed to reload IP filters, keeping previous lists: %s", err.Error())
+				continue
+			}
+			log.Printf("IP filters reloaded from %s", f.path)
+		}
+	}()
+}
+
+// Stats returns the status of the filters.
+func (f *ipFilters) Stats() (map[string]interface{}, error) {
+	h, err := f.http.Stats()
+	if err != nil {
+		return nil, err
+	}
+	r, err := f.raft.Stats()
+	if err != nil {
+		return nil, err
+	}
+	return map[string]interface{}{
+		"path": f.path,
+		"http": h,
+		"raft": r,
+	}, nil
+}
@@ -2,11 +2,14 @@
 package main
 
 import (
+	"bytes"
 	"context"
 	"crypto/tls"
+	"encoding/json"
 	"fmt"
 	"log"
 	"net"
+	"net/http"
 	"os"
 	"os/signal"
 	"runtime"
@@ -19,15 +22,18 @@ import (
 	"github.com/rqlite/rqlite-disco-clients/dnssrv"
 	etcd "github.com/rqlite/rqlite-disco-clients/etcd"
 	"github.com/rqlite/rqlite/auth"
+	"github.com/rqlite/rqlite/auto"
 	"github.com/rqlite/rqlite/auto/backup"
 	"github.com/rqlite/rqlite/auto/restore"
 	"github.com/rqlite/rqlite/aws"
 	"github.com/rqlite/rqlite/cluster"
 	"github.com/rqlite/rqlite/cmd"
+	"github.com/rqlite/rqlite/command"
 	"github.com/rqlite/rqlite/db"
 	"github.com/rqlite/rqlite/disco"
 	httpd "github.com/rqlite/rqlite/http"
 	"github.com/rqlite/rqlite/rtls"
+	"github.com/rqlite/rqlite/secret"
 	"github.com/rqlite/rqlite/store"
 	"github.com/rqlite/rqlite/tcp"
 )
@@ -44,6 +50,19 @@ const logo = `
 
 `
 
+const (
+	eventsWebhookChanLen = 64
+	eventsWebhookTimeout = 5 * time.Second
+
+	promoteCheckInterval = time.Second
+
+	// Round-trip times to other nodes above the Raft heartbeat timeout,
+	// divided by latencyWarnDivisor, are warned about.
+	latencyWarnDivisor = 4
+
+	nodeIDCheckTimeout = 5 * time.Second
+)
+
 const name = `rqlited`
 const desc = `rqlite is a lightweight, distributed relational database, which uses SQLite as its
 storage engine. It provides an easy-to-use, fault-tolerant store for relational data.
@@ -81,12 +100,38 @@ func main() {
 	// Start requested profiling.
 	startProfile(cfg.CPUProfile, cfg.MemProfile)
 
+	// Establish the node's identity before anything depends on it.
+	if err := resolveNodeIdentity(cfg); err != nil {
+		log.Fatalf("failed to establish node identity: %s", err.Error())
+	}
+
+	// Load any IP filters, so that both listeners are filtered from the start.
+	var ipFilts *ipFilters
+	if cfg.IPFilterFile != "" {
+		ipFilts, err = newIPFilters(cfg.IPFilterFile)
+		if err != nil {
+			log.Fatalf("failed to load IP filters: %s", err.Error())
+		}
+		ipFilts.reloadOnHangup()
+		log.Printf("IP filters loaded from %s", cfg.IPFilterFile)
+	}
+
 	// Create internode network mux and configure.
 	muxLn, err := net.Listen("tcp", cfg.RaftAddr)
 	if err != nil {
 		log.Fatalf("failed to listen on %s: %s", cfg.RaftAddr, err.Error())
 	}
-	mux, err := startNodeMux(cfg, muxLn)
+	if ipFilts != nil {
+		muxLn = ipFilts.raft.Listener(muxLn)
+	}
+	var nodeRotator *rtls.Rotator
+	if cfg.NodeX509Cert != "" {
+		nodeRotator, err = newNodeRotator(cfg)
+		if err != nil {
+			log.Fatalf("failed to load node-to-node certificates: %s", err.Error())
+		}
+	}
+	mux, err := startNodeMux(cfg, muxLn, nodeRotator)
 	if err != nil {
 		log.Fatalf("failed to start node mux: %s", err.Error())
 	}
@@ -99,6 +144,10 @@ func main() {
 		log.Fatalf("failed to create store: %s", err.Error())
 	}
 
+	// Forward storage events, if requested. Do this before opening the store so
+	// that any snapshot installed at startup is reported.
+	startEventsWebhook(mainCtx, cfg, str)
+
 	// Install the auto-restore file, if necessary.
 	if cfg.AutoRestoreFile != "" {
 		log.Printf("auto-restore requested, initiating download")
@@ -129,8 +178,13 @@ func main() {
 		log.Fatalf("failed to get credential store: %s", err.Error())
 	}
 
+	signer, err := clusterSigner(cfg)
+	if err != nil {
+		log.Fatalf("failed to create cluster signer: %s", err.Error())
+	}
+
 	// Create cluster service now, so nodes will be able to learn information about each other.
-	clstrServ, err := clusterService(cfg, mux.Listen(cluster.MuxClusterHeader), str, str, credStr)
+	clstrServ, err := clusterService(cfg, mux.Listen(cluster.MuxClusterHeader), str, str, credStr, signer)
 	if err != nil {
 		log.Fatalf("failed to create cluster service: %s", err.Error())
 	}
@@ -141,11 +195,28 @@ func main() {
 	// We want to start the HTTP server as soon as possible, so the node is responsive and external
 	// systems can see that it's running. We still have to open the Store though, so the node won't
 	// be able to do much until that happens however.
-	clstrClient, err := createClusterClient(cfg, clstrServ)
+	dialerTLSConfig, err := createClusterTLSConfig(cfg, nodeRotator)
+	if err != nil {
+		log.Fatalf("failed to create TLS config for cluster dialer: %s", err.Error())
+	}
+	clstrClient, err := createClusterClient(cfg, clstrServ, dialerTLSConfig, signer)
 	if err != nil {
 		log.Fatalf("failed to create cluster client: %s", err.Error())
 	}
-	httpServ, err := startHTTPService(cfg, str, clstrClient, credStr)
+	prober := startLatencyProber(cfg, str, clstrServ, clstrClient)
+	str.NodeIDAt = func(addr string) (string, error) {
+		ni, err := clstrClient.GetNodeInfo(addr, nodeIDCheckTimeout)
+		if err != nil {
+			return "", err
+		}
+		return ni.NodeId, nil
+	}
+	var caRot *caRotator
+	if nodeRotator != nil {
+		caRot = newCARotator(cfg, str, nodeRotator, dialerTLSConfig)
+		str.CARotationFunc = caRot.apply
+	}
+	httpServ, err := startHTTPService(cfg, str, clstrClient, credStr, caRot, ipFilts)
 	if err != nil {
 		log.Fatalf("failed to start HTTP server: %s", err.Error())
 	}
@@ -159,6 +230,9 @@ func main() {
 	// Register remaining status providers.
 	httpServ.RegisterStatus("cluster", clstrServ)
 	httpServ.RegisterStatus("network", tcp.NetworkReporter{})
+	if ipFilts != nil {
+		httpServ.RegisterStatus("ip_filter", ipFilts)
+	}
 
 	// Prepare the cluster-joiner
 	joiner, err := createJoiner(cfg, credStr)
@@ -171,10 +245,18 @@ func main() {
 	if err != nil {
 		log.Fatalf("failed to get nodes %s", err.Error())
 	}
+	if err := checkNodeIDInUse(cfg, nodes, clstrClient); err != nil {
+		log.Fatalf("refusing to run: %s", err.Error())
+	}
 	if err := createCluster(cfg, len(nodes) > 0, joiner, str, httpServ, credStr); err != nil {
 		log.Fatalf("clustering failure: %s", err.Error())
 	}
 
+	// Request promotion to voter once caught up, if requested.
+	if cfg.RaftNonVoterPromote {
+		go promoteWhenCaughtUp(mainCtx, cfg, str, joiner, clstrClient)
+	}
+
 	// Tell the user the node is ready for HTTP, giving some advice on how to connect.
 	log.Printf("node HTTP API available at %s", cfg.HTTPURL())
 	h, p, _ := net.SplitHostPort(cfg.HTTPAdv)
@@ -220,6 +302,7 @@ func main() {
 	}
 
 	backupSrvCancel()
+	prober.Stop()
 	if err := str.Close(true); err != nil {
 		log.Printf("failed to close store: %s", err.Error())
 	}
@@ -229,6 +312,42 @@ func main() {
 	log.Println("rqlite server stopped")
 }
 
+// startEventsWebhook POSTs, as JSON, each storage event emitted by the store
+// to the configured webhook URL. Events are dropped if the webhook cannot keep up.
+func startEventsWebhook(ctx context.Context, cfg *Config, str *store.Store) {
+	if cfg.EventsWebhookURL == "" {
+		return
+	}
+
+	ch := make(chan *store.Event, eventsWebhookChanLen)
+	str.RegisterEventChannel(ch)
+	client := &http.Client{Timeout: eventsWebhookTimeout}
+	go func() {
+		for {
+			select {
+			case e := <-ch:
+				b, err := json.Marshal(e)
+				if err != nil {
+					log.Printf("failed to marshal storage event: %s", err.Error())
+					continue
+				}
+				resp, err := client.Post(cfg.EventsWebhookURL, "application/json", bytes.NewReader(b))
+				if err != nil {
+					log.Printf("failed to POST storage event to webhook: %s", err.Error())
+					continue
+				}
+				resp.Body.Close()
+				if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+					log.Printf("storage events webhook responded with %s", resp.Status)
+				}
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	log.Printf("storage events will be sent to %s", cfg.EventsWebhookURL)
+}
+
 func startAutoBackups(ctx context.Context, cfg *Config, str *store.Store) (*backup.Uploader, error) {
 	if cfg.AutoBackupFile == "" {
 		return nil, nil
@@ -243,13 +362,43 @@ func startAutoBackups(ctx context.Context, cfg *Config, str *store.Store) (*back
 	if err != nil {
 		return nil, fmt.Errorf("failed to parse auto-backup file: %s", err.Error())
 	}
-	sc := aws.NewS3Client(s3cfg.Endpoint, s3cfg.Region, s3cfg.AccessKeyID, s3cfg.SecretAccessKey,
-		s3cfg.Bucket, s3cfg.Path)
+	if err := resolveS3Secrets(s3cfg); err != nil {
+		return nil, fmt.Errorf("failed to parse auto-backup file: %s", err.Error())
+	}
+	sc, err := aws.NewS3Client(s3cfg.Endpoint, s3cfg.Region, s3cfg.AccessKeyID, s3cfg.SecretAccessKey,
+		s3cfg.Bucket, s3cfg.Path, s3cfg.ClientOpts())
+	if err != nil {
+		return nil, fmt.Errorf("failed to create aws S3 client: %s", err.Error())
+	}
 	u := backup.NewUploader(sc, str, time.Duration(uCfg.Interval), !uCfg.NoCompress)
+	u.SetRateLimit(uCfg.RateLimit)
+	if uCfg.Incremental {
+		if err := u.SetIncremental(uCfg.FullEvery); err != nil {
+			return nil, fmt.Errorf("failed to enable incremental auto-backups: %s", err.Error())
+		}
+	}
+	if uCfg.Schedule != "" {
+		schedule, err := auto.ParseSchedule(uCfg.Schedule)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse auto-backup schedule: %s", err.Error())
+		}
+		u.SetSchedule(schedule)
+	}
 	go u.Start(ctx, nil)
 	return u, nil
 }
 
+// resolveS3Secrets replaces any references to secrets in the S3 credentials
+// with the secrets themselves.
+func resolveS3Secrets(s3cfg *aws.S3Config) error {
+	var err error
+	if s3cfg.AccessKeyID, err = secret.Resolve(s3cfg.AccessKeyID); err != nil {
+		return err
+	}
+	s3cfg.SecretAccessKey, err = secret.Resolve(s3cfg.SecretAccessKey)
+	return err
+}
+
 // downloadRestoreFile downloads the auto-restore file from the given URL, and returns the path to
 // the downloaded file. If the download fails, and the file is marked as continue-on-failure, then
 // the error is returned, but errOK is set to true. If the download fails, and the file is not
@@ -274,9 +423,19 @@ func downloadRestoreFile(ctx context.Context, cfgPath string) (path string, errO
 	if err != nil {
 		return "", false, fmt.Errorf("failed to parse auto-restore file: %s", err.Error())
 	}
-	sc := aws.NewS3Client(s3cfg.Endpoint, s3cfg.Region, s3cfg.AccessKeyID, s3cfg.SecretAccessKey,
-		s3cfg.Bucket, s3cfg.Path)
+	if err := resolveS3Secrets(s3cfg); err != nil {
+		return "", false, fmt.Errorf("failed to parse auto-restore file: %s", err.Error())
+	}
+	sc, err := aws.NewS3Client(s3cfg.Endpoint, s3cfg.Region, s3cfg.AccessKeyID, s3cfg.SecretAccessKey,
+		s3cfg.Bucket, s3cfg.Path, s3cfg.ClientOpts())
+	if err != nil {
+		return "", false, fmt.Errorf("failed to create aws S3 client: %s", err.Error())
+	}
 	d := restore.NewDownloader(sc)
+	d.SetRateLimit(dCfg.RateLimit)
+	if err := d.SetIncremental(dCfg.Incremental); err != nil {
+		return "", false, fmt.Errorf("failed to enable incremental auto-restore: %s", err.Error())
+	}
 
 	// Create a temporary file to download to.
 	f, err = os.CreateTemp("", "rqlite-restore")
@@ -293,6 +452,12 @@ func downloadRestoreFile(ctx context.Context, cfgPath string) (path string, errO
 }
 
 func createStore(cfg *Config, ln *tcp.Layer) (*store.Store, error) {
+	db.SetBusyPolicy(db.BusyPolicy{
+		Timeout:    cfg.SQLiteBusyTimeout,
+		MaxRetries: cfg.SQLiteBusyRetries,
+		Delay:      cfg.SQLiteBusyRetryDelay,
+	})
+
 	dbConf := store.NewDBConfig(!cfg.OnDisk)
 	dbConf.OnDiskPath = cfg.OnDiskPath
 	dbConf.FKConstraints = cfg.FKConstraints
@@ -311,9 +476,43 @@ func createStore(cfg *Config, ln *tcp.Layer) (*store.Store, error) {
 	str.ShutdownOnRemove = cfg.RaftShutdownOnRemove
 	str.SnapshotThreshold = cfg.RaftSnapThreshold
 	str.SnapshotInterval = cfg.RaftSnapInterval
+	str.SnapshotSendMax = cfg.RaftSnapSendMax
+	str.SnapshotSendRate = cfg.RaftSnapSendRate
+	str.DBSizeInterval = cfg.DBSizeInterval
+	str.MaxEntrySize = cfg.RaftMaxEntrySize
+	str.MaxApplyBacklog = cfg.WriteMaxBacklog
+	str.JoinTokenRequired = cfg.JoinTokenRequired
+	if cfg.SQLiteMinVersion != "" {
+		if _, err := command.ParseSQLiteVersion(cfg.SQLiteMinVersion); err != nil {
+			return nil, fmt.Errorf("invalid -sqlite-min-version: %s", err.Error())
+		}
+		str.MinSQLiteVersion = cfg.SQLiteMinVersion
+	}
+	str.AllowNonDeterministicTriggers = cfg.AllowNonDeterministicTriggers
+	if cfg.OnStartSQLFile != "" {
+		b, err := os.ReadFile(cfg.OnStartSQLFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read -on-start-sql file: %s", err.Error())
+		}
+		str.StartSQL = string(b)
+	}
+	str.SnapshotRetain = cfg.RaftSnapRetain
+	if cfg.RaftSnapArchiveDir != "" {
+		archiver, err := store.NewDirSnapshotArchiver(cfg.RaftSnapArchiveDir, cfg.RaftSnapArchiveRetain)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create snapshot archiver: %s", err.Error())
+		}
+		str.SnapshotArchiver = archiver
+	}
 	str.LeaderLeaseTimeout = cfg.RaftLeaderLeaseTimeout
 	str.HeartbeatTimeout = cfg.RaftHeartbeatTimeout
 	str.ElectionTimeout = cfg.RaftElectionTimeout
+	str.CommitTimeout = cfg.RaftCommitTimeout
+	str.MaxAppendEntries = cfg.RaftMaxAppendEntries
+	if cfg.RaftRecover != "" {
+		str.RecoveryMode = true
+		log.Printf("Raft recovery requested, remove -raft-recover before the next restart")
+	}
 	str.ApplyTimeout = cfg.RaftApplyTimeout
 	str.BootstrapExpect = cfg.BootstrapExpect
 	str.ReapTimeout = cfg.RaftReapNodeTimeout
@@ -344,6 +543,14 @@ func createDiscoService(cfg *Config, str *store.Store) (*disco.Service, error) {
 		if err != nil {
 			return nil, fmt.Errorf("create Consul config: %s", err.Error())
 		}
+		if consulCfg.Token, err = secret.Resolve(consulCfg.Token); err != nil {
+			return nil, fmt.Errorf("create Consul config: %s", err.Error())
+		}
+		if consulCfg.BasicAuth != nil {
+			if consulCfg.BasicAuth.Password, err = secret.Resolve(consulCfg.BasicAuth.Password); err != nil {
+				return nil, fmt.Errorf("create Consul config: %s", err.Error())
+			}
+		}
 
 		c, err = consul.New(cfg.DiscoKey, consulCfg)
 		if err != nil {
@@ -355,6 +562,9 @@ func createDiscoService(cfg *Config, str *store.Store) (*disco.Service, error) {
 		if err != nil {
 			return nil, fmt.Errorf("create etcd config: %s", err.Error())
 		}
+		if etcdCfg.Password, err = secret.Resolve(etcdCfg.Password); err != nil {
+			return nil, fmt.Errorf("create etcd config: %s", err.Error())
+		}
 
 		c, err = etcd.New(cfg.DiscoKey, etcdCfg)
 		if err != nil {
@@ -367,7 +577,7 @@ func createDiscoService(cfg *Config, str *store.Store) (*disco.Service, error) {
 	return disco.NewService(c, str), nil
 }
 
-func startHTTPService(cfg *Config, str *store.Store, cltr *cluster.Client, credStr *auth.CredentialsStore) (*httpd.Service, error) {
+func startHTTPService(cfg *Config, str *store.Store, cltr *cluster.Client, credStr *auth.CredentialsStore, caRot *caRotator, ipFilts *ipFilters) (*httpd.Service, error) {
 	// Create HTTP server and load authentication information.
 	s := httpd.New(cfg.HTTPAddr, str, cltr, credStr)
 
@@ -378,10 +588,37 @@ func startHTTPService(cfg *Config, str *store.Store, cltr *cluster.Client, credS
 	s.ClientVerify = cfg.HTTPVerifyClient
 	s.Expvar = cfg.Expvar
 	s.Pprof = cfg.PprofEnabled
+	s.AuthFailureThreshold = cfg.AuthLockoutThreshold
+	s.AuthLockout = cfg.AuthLockout
+	s.AuthMaxLockout = cfg.AuthLockoutMax
+	s.MaxUserQueries = cfg.UserMaxQueries
+	s.UserQueryWait = cfg.UserQueryWait
+	s.ParseCacheSize = cfg.ParseCacheSize
+	s.SessionConsistency = cfg.HTTPSessionConsistency
+	s.RestrictedAPI = cfg.RestrictedAPI
+	s.RiskyWrites = cfg.RiskyWrites
+	s.RedactedColumns = cfg.RedactedColumns()
+	s.GraphQL = cfg.GraphQL
+	s.REST = cfg.REST
+	if caRot != nil {
+		s.CARotator = caRot
+	}
+	if ipFilts != nil {
+		s.IPFilter = ipFilts.http
+	}
+	if cfg.TemplatesFile != "" {
+		templates, err := httpd.NewTemplateStoreFromFile(cfg.TemplatesFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load query templates: %s", err.Error())
+		}
+		s.Templates = templates
+	}
 	s.DefaultQueueCap = cfg.WriteQueueCap
 	s.DefaultQueueBatchSz = cfg.WriteQueueBatchSz
 	s.DefaultQueueTimeout = cfg.WriteQueueTimeout
 	s.DefaultQueueTx = cfg.WriteQueueTx
+	s.QueueCoalesceTables = cfg.WriteQueueCoalesceTables()
+	s.NodeID = cfg.NodeID
 	s.BuildInfo = map[string]interface{}{
 		"commit":     cmd.Commit,
 		"branch":     cmd.Branch,
@@ -394,7 +631,7 @@ func startHTTPService(cfg *Config, str *store.Store, cltr *cluster.Client, credS
 
 // startNodeMux starts the TCP mux on the given listener, which should be already
 // bound to the relevant interface.
-func startNodeMux(cfg *Config, ln net.Listener) (*tcp.Mux, error) {
+func startNodeMux(cfg *Config, ln net.Listener, rotator *rtls.Rotator) (*tcp.Mux, error) {
 	var err error
 	adv := tcp.NameAddress{
 		Address: cfg.RaftAdv,
@@ -414,8 +651,13 @@ func startNodeMux(cfg *Config, ln net.Listener) (*tcp.Mux, error) {
 			b.WriteString(", mutual TLS enabled")
 		}
 		log.Println(b.String())
-		mux, err = tcp.NewTLSMux(ln, adv, cfg.NodeX509Cert, cfg.NodeX509Key, cfg.NodeX509CACert,
-			cfg.NoNodeVerify, cfg.NodeVerifyClient)
+		var tlsConfig *tls.Config
+		tlsConfig, err = rtls.CreateConfig(cfg.NodeX509Cert, cfg.NodeX509Key, cfg.NodeX509CACert,
+			cfg.NoNodeVerify, cfg.NodeVerifyClient, false)
+		if err != nil {
+			return nil, fmt.Errorf("cannot create TLS config: %s", err)
+		}
+		mux, err = tcp.NewTLSMuxWithConfig(ln, adv, rotator.Config(tlsConfig))
 	} else {
 		mux, err = tcp.NewMux(ln, adv)
 	}
@@ -431,7 +673,17 @@ func credentialStore(cfg *Config) (*auth.CredentialsStore, error) {
 	if cfg.AuthFile == "" {
 		return nil, nil
 	}
-	return auth.NewCredentialsStoreFromFile(cfg.AuthFile)
+	cs, err := auth.NewCredentialsStoreFromFile(cfg.AuthFile)
+	if err != nil {
+		return nil, err
+	}
+	if cfg.AuthHash != "" {
+		cs.Hasher, err = auth.NewHasher(cfg.AuthHash)
+		if err != nil {
+			return nil, fmt.Errorf("invalid -auth-hash: %s", err.Error())
+		}
+	}
+	return cs, nil
 }
 
 func createJoiner(cfg *Config, credStr *auth.CredentialsStore) (*cluster.Joiner, error) {
@@ -447,31 +699,179 @@ func createJoiner(cfg *Config, credStr *auth.CredentialsStore) (*cluster.Joiner,
 		}
 		joiner.SetBasicAuth(cfg.JoinAs, pw)
 	}
+	token, err := secret.Resolve(cfg.JoinToken)
+	if err != nil {
+		return nil, fmt.Errorf("invalid -join-token: %s", err.Error())
+	}
+	joiner.SetToken(token)
+	joiner.SetCollations(db.Collations())
+	joiner.SetICU(db.ICUSupported)
 	return joiner, nil
 }
 
-func clusterService(cfg *Config, tn cluster.Transport, db cluster.Database, mgr cluster.Manager, credStr *auth.CredentialsStore) (*cluster.Service, error) {
+// clusterSigner returns the Signer for commands sent between nodes, or nil if
+// commands are not signed.
+func clusterSigner(cfg *Config) (*cluster.Signer, error) {
+	if cfg.ClusterSigningKey == "" {
+		return nil, nil
+	}
+	key, err := secret.Resolve(cfg.ClusterSigningKey)
+	if err != nil {
+		return nil, err
+	}
+	return cluster.NewSigner(cfg.NodeID, []byte(key))
+}
+
+func clusterService(cfg *Config, tn cluster.Transport, db cluster.Database, mgr cluster.Manager, credStr *auth.CredentialsStore, signer *cluster.Signer) (*cluster.Service, error) {
 	c := cluster.New(tn, db, mgr, credStr)
 	c.SetAPIAddr(cfg.HTTPAdv)
 	c.EnableHTTPS(cfg.HTTPx509Cert != "" && cfg.HTTPx509Key != "") // Conditions met for an HTTPS API
+	if signer != nil {
+		c.SetSigner(signer)
+	}
+	c.EnableAudit(cfg.ClusterAudit)
 	if err := c.Open(); err != nil {
 		return nil, err
 	}
 	return c, nil
 }
 
-func createClusterClient(cfg *Config, clstr *cluster.Service) (*cluster.Client, error) {
-	var dialerTLSConfig *tls.Config
-	var err error
-	if cfg.NodeX509Cert != "" || cfg.NodeX509CACert != "" {
-		dialerTLSConfig, err = rtls.CreateClientConfig(cfg.NodeX509Cert, cfg.NodeX509Key,
-			cfg.NodeX509CACert, cfg.NoNodeVerify, cfg.TLS1011)
+// resolveNodeIdentity sets the node's ID to that persisted in its data
+// directory, or persists the ID if the data directory is new. A node whose ID
+// was not set explicitly keeps the ID it was first given, even if its Raft
+// address changes.
+func resolveNodeIdentity(cfg *Config) error {
+	ident, err := store.ReadIdentity(cfg.DataPath)
+	if err != nil {
+		return err
+	}
+	if ident == nil {
+		_, err := store.WriteIdentity(cfg.DataPath, cfg.NodeID)
+		return err
+	}
+
+	if ident.ID != cfg.NodeID {
+		if !cfg.nodeIDDefaulted {
+			return fmt.Errorf("data directory %s belongs to node %s, but -node-id is %s. If the node's ID is to change, delete %s",
+				cfg.DataPath, ident.ID, cfg.NodeID, store.IdentityPath(cfg.DataPath))
+		}
+		log.Printf("using node ID %s from data directory, rather than Raft address %s", ident.ID, cfg.RaftAdv)
+		cfg.NodeID = ident.ID
+	}
+	if cfg.RaftRecover != "" && cfg.RaftRecover != cfg.NodeID {
+		return fmt.Errorf("-raft-recover must be set to this node's ID (%s) to confirm recovery", cfg.NodeID)
+	}
+	return nil
+}
+
+// checkNodeIDInUse returns an error if another node is live with this node's
+// ID, at the address the cluster configuration records for it. This happens
+// if the data directory was copied from that node, such as by cloning a VM.
+func checkNodeIDInUse(cfg *Config, nodes []*store.Server, clstrClient *cluster.Client) error {
+	for _, n := range nodes {
+		if n.ID != cfg.NodeID || n.Addr == cfg.RaftAdv {
+			continue
+		}
+		ni, err := clstrClient.GetNodeInfo(n.Addr, nodeIDCheckTimeout)
+		if err == nil && ni.NodeId == cfg.NodeID {
+			return fmt.Errorf("node %s is live at %s, so cannot also run at %s. Was data directory %s copied from it?",
+				n.ID, n.Addr, cfg.RaftAdv, cfg.DataPath)
+		}
+	}
+	return nil
+}
+
+// startLatencyProber starts measuring the round-trip time to, and bandwidth
+// available to, the other nodes in the cluster, and has the cluster service serve those measurements, along
+// with other information about this node, for the cluster topology.
+func startLatencyProber(cfg *Config, str *store.Store, clstrServ *cluster.Service, clstrClient *cluster.Client) *cluster.LatencyProber {
+	nodes := func() ([]string, error) {
+		servers, err := str.Nodes()
 		if err != nil {
-			return nil, fmt.Errorf("failed to create TLS config for cluster dialer: %s", err.Error())
+			return nil, err
 		}
+		var addrs []string
+		for _, srv := range servers {
+			if srv.Addr != cfg.RaftAdv {
+				addrs = append(addrs, srv.Addr)
+			}
+		}
+		return addrs, nil
 	}
+	prober := cluster.NewLatencyProber(clstrClient, nodes, cfg.ClusterProbeInterval, cfg.ClusterConnectTimeout)
+	prober.BandwidthProbeSize = cfg.ClusterProbeBytes
+	prober.WarnLatency = cfg.RaftHeartbeatTimeout / latencyWarnDivisor
+	clstrServ.SetNodeInfoFunc(func() *cluster.NodeInfo {
+		return &cluster.NodeInfo{
+			NodeId:        str.ID(),
+			Version:       cmd.Version,
+			SqliteVersion: db.DBVersion,
+			Locality:      cfg.NodeLocality,
+			AppliedIndex:  str.AppliedIndex(),
+			Latencies:     prober.Latencies(),
+		}
+	})
+	prober.Start()
+	return prober
+}
+
+// promoteWhenCaughtUp waits until this non-voting node has caught up with the
+// Leader, and then asks the Leader to promote it to a voter. It retries until
+// the promotion succeeds, or the context is cancelled.
+func promoteWhenCaughtUp(ctx context.Context, cfg *Config, str *store.Store, joiner *cluster.Joiner, clstrClient *cluster.Client) {
+	tck := time.NewTicker(promoteCheckInterval)
+	defer tck.Stop()
+	for {
+		select {
+		case <-tck.C:
+			if !str.CaughtUp(cfg.RaftHeartbeatTimeout * 2) {
+				continue
+			}
+			leaderAddr, err := str.LeaderAddr()
+			if err != nil || leaderAddr == "" {
+				continue
+			}
+			apiAddr, err := clstrClient.GetNodeAPIAddr(leaderAddr, cfg.ClusterConnectTimeout)
+			if err != nil {
+				log.Printf("failed to get Leader API address for promotion: %s", err.Error())
+				continue
+			}
+			if _, err := joiner.Do([]string{apiAddr}, str.ID(), cfg.RaftAdv, true); err != nil {
+				log.Printf("failed to request promotion to voter: %s", err.Error())
+				continue
+			}
+			log.Printf("node caught up with Leader and promoted to voter")
+			return
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// createClusterTLSConfig returns the TLS configuration used to dial other
+// nodes, or nil if node-to-node encryption is disabled. If rotator is set, it
+// supplies the certificate and trusted CAs.
+func createClusterTLSConfig(cfg *Config, rotator *rtls.Rotator) (*tls.Config, error) {
+	if cfg.NodeX509Cert == "" && cfg.NodeX509CACert == "" {
+		return nil, nil
+	}
+	tlsConfig, err := rtls.CreateClientConfig(cfg.NodeX509Cert, cfg.NodeX509Key,
+		cfg.NodeX509CACert, cfg.NoNodeVerify, cfg.TLS1011)
+	if err != nil {
+		return nil, err
+	}
+	if rotator != nil {
+		tlsConfig = rotator.Config(tlsConfig)
+	}
+	return tlsConfig, nil
+}
+
+func createClusterClient(cfg *Config, clstr *cluster.Service, dialerTLSConfig *tls.Config, signer *cluster.Signer) (*cluster.Client, error) {
 	clstrDialer := tcp.NewDialer(cluster.MuxClusterHeader, dialerTLSConfig)
 	clstrClient := cluster.NewClient(clstrDialer, cfg.ClusterConnectTimeout)
+	if signer != nil {
+		clstrClient.SetSigner(signer)
+	}
 	if err := clstrClient.SetLocal(cfg.RaftAdv, clstr); err != nil {
 		return nil, fmt.Errorf("failed to set cluster client local parameters: %s", err.Error())
 	}
@@ -529,6 +929,9 @@ func createCluster(cfg *Config, hasPeers bool, joiner *cluster.Joiner, str *stor
 			}
 			bs.SetBasicAuth(cfg.JoinAs, pw)
 		}
+		bs.SetJoinToken(joiner.Token())
+		bs.SetCollations(db.Collations())
+		bs.SetICU(db.ICUSupported)
 		return bs.Boot(str.ID(), cfg.RaftAdv, isClustered, cfg.BootstrapExpectTimeout)
 	}
 
@@ -578,6 +981,9 @@ func createCluster(cfg *Config, hasPeers bool, joiner *cluster.Joiner, str *stor
 			}
 			bs.SetBasicAuth(cfg.JoinAs, pw)
 		}
+		bs.SetJoinToken(joiner.Token())
+		bs.SetCollations(db.Collations())
+		bs.SetICU(db.ICUSupported)
 		httpServ.RegisterStatus("disco", provider)
 		return bs.Boot(str.ID(), cfg.RaftAdv, isClustered, cfg.BootstrapExpectTimeout)
 
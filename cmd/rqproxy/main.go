@@ -0,0 +1,113 @@
+// Command rqproxy is an HTTP proxy fronting several rqlite clusters.
+
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"runtime"
+	"strings"
+	"time"
+
+	"github.com/rqlite/rqlite/cmd"
+	"github.com/rqlite/rqlite/proxy"
+	"github.com/rqlite/rqlite/rtls"
+)
+
+const name = `rqproxy`
+const desc = `rqproxy fronts several rqlite clusters with a single HTTP endpoint.`
+
+// clusterFlags collects the clusters passed with repeated -cluster flags.
+type clusterFlags []*proxy.Cluster
+
+func (c *clusterFlags) String() string {
+	names := make([]string, 0, len(*c))
+	for _, cl := range *c {
+		names = append(names, cl.Name)
+	}
+	return strings.Join(names, ",")
+}
+
+func (c *clusterFlags) Set(s string) error {
+	cl, err := proxy.ParseCluster(s)
+	if err != nil {
+		return err
+	}
+	*c = append(*c, cl)
+	return nil
+}
+
+var httpAddr string
+var x509Cert string
+var x509Key string
+var x509CACert string
+var noVerify bool
+var timeout time.Duration
+var clusters clusterFlags
+var showVersion bool
+
+func init() {
+	flag.StringVar(&httpAddr, "http-addr", "localhost:4000", "HTTP server bind address")
+	flag.StringVar(&x509Cert, "http-cert", "", "Path to X.509 certificate for HTTPS")
+	flag.StringVar(&x509Key, "http-key", "", "Path to X.509 private key for HTTPS")
+	flag.StringVar(&x509CACert, "http-ca-cert", "", "Path to X.509 CA certificate used to verify the HTTPS certificates of cluster nodes")
+	flag.BoolVar(&noVerify, "http-no-verify", false, "Skip verification of the HTTPS certificates of cluster nodes")
+	flag.DurationVar(&timeout, "timeout", 30*time.Second, "Timeout for requests to cluster nodes")
+	flag.Var(&clusters, "cluster", "Cluster to front, as name=addr[,addr...]. May be repeated")
+	flag.BoolVar(&showVersion, "version", false, "Show version information and exit")
+	flag.Usage = func() {
+		fmt.Fprintf(os.Stderr, "\n%s\n\n", desc)
+		fmt.Fprintf(os.Stderr, "Usage: %s [arguments]\n", name)
+		flag.PrintDefaults()
+	}
+}
+
+func main() {
+	flag.Parse()
+
+	if showVersion {
+		fmt.Printf("%s %s %s %s %s (commit %s, branch %s)\n",
+			name, cmd.Version, runtime.GOOS, runtime.GOARCH, runtime.Version(), cmd.Commit, cmd.Branch)
+		os.Exit(0)
+	}
+	if len(clusters) == 0 {
+		fmt.Fprintf(os.Stderr, "at least one -cluster is required\n")
+		flag.Usage()
+		os.Exit(1)
+	}
+
+	log.SetFlags(log.LstdFlags)
+	log.SetOutput(os.Stderr)
+	log.SetPrefix(fmt.Sprintf("[%s] ", name))
+
+	tlsConfig, err := rtls.CreateClientConfig("", "", x509CACert, noVerify, false)
+	if err != nil {
+		log.Fatalf("failed to create TLS configuration: %s", err.Error())
+	}
+	client := &http.Client{
+		Timeout: timeout,
+		Transport: &http.Transport{
+			Proxy:           http.ProxyFromEnvironment,
+			TLSClientConfig: tlsConfig,
+		},
+	}
+	p, err := proxy.New(clusters, client)
+	if err != nil {
+		log.Fatalf("failed to create proxy: %s", err.Error())
+	}
+	for _, c := range clusters {
+		log.Printf("fronting cluster %s at /%s/, nodes %s", c.Name, c.Name, strings.Join(c.Addrs, ", "))
+	}
+
+	if x509Cert != "" || x509Key != "" {
+		log.Printf("serving HTTPS on %s", httpAddr)
+		err = http.ListenAndServeTLS(httpAddr, x509Cert, x509Key, p)
+	} else {
+		log.Printf("serving HTTP on %s", httpAddr)
+		err = http.ListenAndServe(httpAddr, p)
+	}
+	log.Fatalf("failed to serve: %s", err.Error())
+}
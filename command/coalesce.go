@@ -0,0 +1,230 @@
+package command
+
+import (
+	"encoding/hex"
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/rqlite/sql"
+)
+
+// CoalesceUpserts returns the statements without each upsert to one of the
+// given tables, named in lower case, which a later upsert of the same row
+// overwrites, and the number of statements removed. Only upserts of the form
+//
+//	INSERT INTO t (k, a, b) VALUES (?, ?, ?) ON CONFLICT (k) DO UPDATE SET a = excluded.a, b = excluded.b
+//
+// which set every inserted column to the inserted value, and whose values
+// are all literals or bound parameters, are coalesced, as the row they leave
+// does not depend on any earlier upsert of it. An upsert is kept if any other
+// statement mentioning its table, or controlling a transaction, lies between
+// it and the later upsert.
+func CoalesceUpserts(stmts []*Statement, tables map[string]bool) ([]*Statement, int) {
+	// The index of the latest upsert of each row, by table and row.
+	latest := make(map[string]map[string]int)
+	drop := make([]bool, len(stmts))
+	n := 0
+	for i, stmt := range stmts {
+		if ContainsTransactionControl([]*Statement{stmt}) {
+			latest = make(map[string]map[string]int)
+			continue
+		}
+		if table, row, ok := idempotentUpsert(stmt, tables); ok {
+			rows, ok := latest[table]
+			if !ok {
+				rows = make(map[string]int)
+				latest[table] = rows
+			}
+			if j, ok := rows[row]; ok {
+				drop[j] = true
+				n++
+			}
+			rows[row] = i
+			continue
+		}
+		for table := range latest {
+			if mentions(stmt.Sql, table) {
+				delete(latest, table)
+			}
+		}
+	}
+	if n == 0 {
+		return stmts, 0
+	}
+
+	kept := make([]*Statement, 0, len(stmts)-n)
+	for i, stmt := range stmts {
+		if !drop[i] {
+			kept = append(kept, stmt)
+		}
+	}
+	return kept, n
+}
+
+// idempotentUpsert returns the table, and a key identifying the row, of stmt
+// if it is an upsert to one of tables which CoalesceUpserts may coalesce.
+func idempotentUpsert(stmt *Statement, tables map[string]bool) (string, string, bool) {
+	p := sql.NewParser(strings.NewReader(stmt.Sql))
+	s, err := p.ParseStatement()
+	if err != nil {
+		return "", "", false
+	}
+	if _, err := p.ParseStatement(); err != io.EOF {
+		return "", "", false
+	}
+	ins, ok := s.(*sql.InsertStatement)
+	if !ok || ins.WithClause != nil || ins.Select != nil || len(ins.ValueLists) != 1 ||
+		ins.Replace.IsValid() || ins.InsertOr.IsValid() {
+		return "", "", false
+	}
+	table := strings.ToLower(sql.IdentName(ins.Table))
+	if !tables[table] {
+		return "", "", false
+	}
+	u := ins.UpsertClause
+	if u == nil || len(u.Columns) == 0 || u.WhereExpr != nil || !u.DoUpdate.IsValid() || u.UpdateWhereExpr != nil {
+		return "", "", false
+	}
+	values := ins.ValueLists[0].Exprs
+	if len(ins.Columns) == 0 || len(ins.Columns) != len(values) {
+		return "", "", false
+	}
+
+	// Every inserted column must be either part of the conflict target, or
+	// set to its inserted value.
+	columns := make(map[string]int, len(ins.Columns))
+	for i, c := range ins.Columns {
+		columns[strings.ToLower(sql.IdentName(c))] = i
+	}
+	var key []int
+	isKey := make(map[string]bool)
+	for _, ic := range u.Columns {
+		id, ok := ic.X.(*sql.Ident)
+		if !ok {
+			return "", "", false
+		}
+		name := strings.ToLower(id.Name)
+		i, ok := columns[name]
+		if !ok || isKey[name] {
+			return "", "", false
+		}
+		isKey[name] = true
+		key = append(key, i)
+	}
+	set := make(map[string]bool)
+	for _, a := range u.Assignments {
+		ref, ok := a.Expr.(*sql.QualifiedRef)
+		if !ok || len(a.Columns) != 1 || !strings.EqualFold(sql.IdentName(ref.Table), "excluded") {
+			return "", "", false
+		}
+		name := strings.ToLower(sql.IdentName(a.Columns[0]))
+		if !strings.EqualFold(sql.IdentName(ref.Column), name) || isKey[name] {
+			return "", "", false
+		}
+		set[name] = true
+	}
+	for name := range columns {
+		if !isKey[name] && !set[name] {
+			return "", "", false
+		}
+	}
+
+	// Every value must be a literal or a bound parameter, and the values of
+	// the conflict target must identify a single row.
+	parts := make([]string, len(values))
+	positional := 0
+	for i, v := range values {
+		switch e := v.(type) {
+		case *sql.NumberLit:
+			parts[i] = "ln:" + e.Value
+		case *sql.StringLit:
+			parts[i] = "ls:" + e.Value
+		case *sql.BlobLit:
+			parts[i] = "lx:" + e.Value
+		case *sql.BoolLit:
+			parts[i] = "lb:" + strconv.FormatBool(e.Value)
+		case *sql.NullLit:
+			parts[i] = ""
+		case *sql.BindExpr:
+			param, ok := bindParameter(stmt.Parameters, e.Name, &positional)
+			if !ok {
+				return "", "", false
+			}
+			parts[i] = parameterKey(param)
+		default:
+			return "", "", false
+		}
+	}
+	var row []string
+	for _, i := range key {
+		// NULLs never conflict, so each upsert of one inserts a row.
+		if parts[i] == "" {
+			return "", "", false
+		}
+		row = append(row, strconv.Quote(parts[i]))
+	}
+	return table, strings.Join(row, ","), true
+}
+
+// bindParameter returns the parameter bound to the parameter named name,
+// where *positional is the number of positional parameters already bound.
+func bindParameter(params []*Parameter, name string, positional *int) (*Parameter, bool) {
+	if name == "?" {
+		if *positional >= len(params) {
+			return nil, false
+		}
+		for _, p := range params {
+			if p.Name != "" {
+				return nil, false
+			}
+		}
+		p := params[*positional]
+		*positional++
+		return p, true
+	}
+	if len(name) < 2 || !strings.ContainsAny(name[:1], ":@$") {
+		return nil, false
+	}
+	for _, p := range params {
+		if p.Name == name[1:] {
+			return p, true
+		}
+	}
+	return nil, false
+}
+
+// parameterKey returns a key identifying the value of p, or the empty string
+// if it is NULL.
+func parameterKey(p *Parameter) string {
+	switch v := p.GetValue().(type) {
+	case *Parameter_I:
+		return "pi:" + strconv.FormatInt(v.I, 10)
+	case *Parameter_D:
+		return "pd:" + strconv.FormatFloat(v.D, 'g', -1, 64)
+	case *Parameter_B:
+		return "pb:" + strconv.FormatBool(v.B)
+	case *Parameter_Y:
+		return "py:" + hex.EncodeToString(v.Y)
+	case *Parameter_S:
+		return "ps:" + v.S
+	}
+	return ""
+}
+
+// mentions returns whether s names the given table, or anything else of the
+// same name.
+func mentions(s, table string) bool {
+	scanner := sql.NewScanner(strings.NewReader(s))
+	for {
+		_, tok, lit := scanner.Scan()
+		switch tok {
+		case sql.EOF:
+			return false
+		case sql.IDENT, sql.QIDENT, sql.STRING:
+			if strings.EqualFold(lit, table) {
+				return true
+			}
+		}
+	}
+}
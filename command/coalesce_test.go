@@ -0,0 +1,144 @@
+package command
+
+import (
+	"testing"
+)
+
+func Test_CoalesceUpserts(t *testing.T) {
+	const upsert = `INSERT INTO metrics (host, name, value) VALUES (?, ?, ?) ON CONFLICT (host, name) DO UPDATE SET value = excluded.value`
+	up := func(host, name string, value float64) *Statement {
+		return &Statement{
+			Sql: upsert,
+			Parameters: []*Parameter{
+				{Value: &Parameter_S{S: host}},
+				{Value: &Parameter_S{S: name}},
+				{Value: &Parameter_D{D: value}},
+			},
+		}
+	}
+	tables := map[string]bool{"metrics": true}
+
+	for _, tt := range []struct {
+		name  string
+		stmts []*Statement
+		kept  []int // Indexes of the statements kept.
+	}{
+		{
+			name:  "repeated upserts of a row",
+			stmts: []*Statement{up("a", "cpu", 1), up("a", "cpu", 2), up("a", "cpu", 3)},
+			kept:  []int{2},
+		},
+		{
+			name:  "upserts of different rows",
+			stmts: []*Statement{up("a", "cpu", 1), up("b", "cpu", 2), up("a", "mem", 3), up("b", "cpu", 4)},
+			kept:  []int{0, 2, 3},
+		},
+		{
+			name:  "other statement mentioning the table",
+			stmts: []*Statement{up("a", "cpu", 1), {Sql: `DELETE FROM metrics WHERE host = 'a'`}, up("a", "cpu", 2)},
+			kept:  []int{0, 1, 2},
+		},
+		{
+			name:  "other statement not mentioning the table",
+			stmts: []*Statement{up("a", "cpu", 1), {Sql: `INSERT INTO events VALUES (1)`}, up("a", "cpu", 2)},
+			kept:  []int{1, 2},
+		},
+		{
+			name:  "transaction control",
+			stmts: []*Statement{up("a", "cpu", 1), {Sql: `BEGIN`}, up("a", "cpu", 2), up("a", "cpu", 3), {Sql: `COMMIT`}},
+			kept:  []int{0, 1, 3, 4},
+		},
+		{
+			name: "literal values",
+			stmts: []*Statement{
+				{Sql: `INSERT INTO metrics (host, name, value) VALUES ('a', 'cpu', 1) ON CONFLICT (host, name) DO UPDATE SET value = excluded.value`},
+				{Sql: `INSERT INTO Metrics (host, name, value) VALUES ('a', 'cpu', 2) ON CONFLICT (host, name) DO UPDATE SET value = excluded.value`},
+			},
+			kept: []int{1},
+		},
+		{
+			name: "named parameters of another row",
+			stmts: []*Statement{
+				{
+					Sql:        `INSERT INTO metrics (host, name, value) VALUES (:h, :n, :v) ON CONFLICT (host, name) DO UPDATE SET value = excluded.value`,
+					Parameters: []*Parameter{{Name: "v", Value: &Parameter_I{I: 1}}, {Name: "n", Value: &Parameter_S{S: "cpu"}}, {Name: "h", Value: &Parameter_S{S: "b"}}},
+				},
+				up("a", "cpu", 2),
+			},
+			kept: []int{0, 1},
+		},
+		{
+			name: "named parameters of the same row",
+			stmts: []*Statement{
+				up("a", "cpu", 1),
+				{
+					Sql:        `INSERT INTO metrics (host, name, value) VALUES (:h, :n, :v) ON CONFLICT (host, name) DO UPDATE SET value = excluded.value`,
+					Parameters: []*Parameter{{Name: "v", Value: &Parameter_I{I: 1}}, {Name: "n", Value: &Parameter_S{S: "cpu"}}, {Name: "h", Value: &Parameter_S{S: "a"}}},
+				},
+				{
+					Sql:        `INSERT INTO metrics (host, name, value) VALUES (:h, :n, :v) ON CONFLICT (host, name) DO UPDATE SET value = excluded.value`,
+					Parameters: []*Parameter{{Name: "h", Value: &Parameter_S{S: "a"}}, {Name: "n", Value: &Parameter_S{S: "cpu"}}, {Name: "v", Value: &Parameter_I{I: 2}}},
+				},
+			},
+			kept: []int{2},
+		},
+		{
+			name: "accumulating upserts",
+			stmts: []*Statement{
+				{Sql: `INSERT INTO metrics (host, name, value) VALUES ('a', 'cpu', 1) ON CONFLICT (host, name) DO UPDATE SET value = value + excluded.value`},
+				{Sql: `INSERT INTO metrics (host, name, value) VALUES ('a', 'cpu', 1) ON CONFLICT (host, name) DO UPDATE SET value = value + excluded.value`},
+			},
+			kept: []int{0, 1},
+		},
+		{
+			name: "upserts leaving columns unset",
+			stmts: []*Statement{
+				{Sql: `INSERT INTO metrics (host, name, value, unit) VALUES ('a', 'cpu', 1, 'pc') ON CONFLICT (host, name) DO UPDATE SET value = excluded.value`},
+				{Sql: `INSERT INTO metrics (host, name, value, unit) VALUES ('a', 'cpu', 1, 'ms') ON CONFLICT (host, name) DO UPDATE SET value = excluded.value`},
+			},
+			kept: []int{0, 1},
+		},
+		{
+			name: "upserts of NULL keys",
+			stmts: []*Statement{
+				{Sql: `INSERT INTO metrics (host, name, value) VALUES (NULL, 'cpu', 1) ON CONFLICT (host, name) DO UPDATE SET value = excluded.value`},
+				{Sql: `INSERT INTO metrics (host, name, value) VALUES (NULL, 'cpu', 2) ON CONFLICT (host, name) DO UPDATE SET value = excluded.value`},
+			},
+			kept: []int{0, 1},
+		},
+		{
+			name: "upserts with conditions",
+			stmts: []*Statement{
+				{Sql: `INSERT INTO metrics (host, name, value) VALUES ('a', 'cpu', 1) ON CONFLICT (host, name) DO UPDATE SET value = excluded.value WHERE value < excluded.value`},
+				{Sql: `INSERT INTO metrics (host, name, value) VALUES ('a', 'cpu', 2) ON CONFLICT (host, name) DO UPDATE SET value = excluded.value WHERE value < excluded.value`},
+			},
+			kept: []int{0, 1},
+		},
+		{
+			name: "upserts of computed values",
+			stmts: []*Statement{
+				{Sql: `INSERT INTO metrics (host, name, value) VALUES ('a', 'cpu', (SELECT MAX(v) FROM samples)) ON CONFLICT (host, name) DO UPDATE SET value = excluded.value`},
+				{Sql: `INSERT INTO metrics (host, name, value) VALUES ('a', 'cpu', 2) ON CONFLICT (host, name) DO UPDATE SET value = excluded.value`},
+			},
+			kept: []int{0, 1},
+		},
+		{
+			name: "upserts of other tables",
+			stmts: []*Statement{
+				{Sql: `INSERT INTO other (host, name, value) VALUES ('a', 'cpu', 1) ON CONFLICT (host, name) DO UPDATE SET value = excluded.value`},
+				{Sql: `INSERT INTO other (host, name, value) VALUES ('a', 'cpu', 2) ON CONFLICT (host, name) DO UPDATE SET value = excluded.value`},
+			},
+			kept: []int{0, 1},
+		},
+	} {
+		got, n := CoalesceUpserts(tt.stmts, tables)
+		if n != len(tt.stmts)-len(tt.kept) || len(got) != len(tt.kept) {
+			t.Fatalf("%s: wrong number of statements kept, exp %d, got %d (%d removed)", tt.name, len(tt.kept), len(got), n)
+		}
+		for i, k := range tt.kept {
+			if got[i] != tt.stmts[k] {
+				t.Fatalf("%s: wrong statement kept at %d, exp statement %d", tt.name, i, k)
+			}
+		}
+	}
+}
@@ -0,0 +1,60 @@
+package command
+
+import (
+	"strings"
+
+	"github.com/rqlite/sql"
+)
+
+// builtinCollations are the collations built into SQLite, which every node
+// supports.
+var builtinCollations = map[string]bool{
+	"BINARY": true,
+	"NOCASE": true,
+	"RTRIM":  true,
+}
+
+// Collations returns the names, upper-cased, of the collations named by the
+// COLLATE clauses of s, other than those built into SQLite, in the order in
+// which they are first named.
+func Collations(s string) []string {
+	var names []string
+	seen := make(map[string]bool)
+	collate := false
+	scanner := sql.NewScanner(strings.NewReader(s))
+	for {
+		_, tok, lit := scanner.Scan()
+		if tok == sql.EOF {
+			return names
+		}
+		if collate && (tok == sql.IDENT || tok == sql.QIDENT || tok == sql.STRING) {
+			name := strings.ToUpper(lit)
+			if !builtinCollations[name] && !seen[name] {
+				seen[name] = true
+				names = append(names, name)
+			}
+		}
+		collate = tok == sql.IDENT && strings.EqualFold(lit, "COLLATE")
+	}
+}
+
+// LoadsCollation returns whether any of the statements calls
+// icu_load_collation(), which registers a collation with only the connection
+// executing it.
+func LoadsCollation(stmts []*Statement) bool {
+	for _, stmt := range stmts {
+		scanner := sql.NewScanner(strings.NewReader(stmt.Sql))
+		fn := false
+		for {
+			_, tok, lit := scanner.Scan()
+			if tok == sql.EOF {
+				break
+			}
+			if fn && tok == sql.LP {
+				return true
+			}
+			fn = tok == sql.IDENT && strings.EqualFold(lit, "icu_load_collation")
+		}
+	}
+	return false
+}
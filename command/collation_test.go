@@ -0,0 +1,40 @@
+package command
+
+import (
+	"reflect"
+	"testing"
+)
+
+func Test_Collations(t *testing.T) {
+	for _, tt := range []struct {
+		sql        string
+		collations []string
+	}{
+		{`CREATE TABLE foo (id INTEGER, name TEXT)`, nil},
+		{`CREATE TABLE foo (name TEXT COLLATE NOCASE, code TEXT COLLATE binary)`, nil},
+		{`CREATE TABLE foo (name TEXT COLLATE unicode_ci)`, []string{"UNICODE_CI"}},
+		{`CREATE TABLE foo (name TEXT COLLATE "Unicode_CI_AI", other TEXT COLLATE 'unicode_ci_ai')`, []string{"UNICODE_CI_AI"}},
+		{`CREATE INDEX foo_name ON foo (name COLLATE unicode, id); CREATE TABLE bar (x TEXT COLLATE NOCASE)`, []string{"UNICODE"}},
+		{`SELECT * FROM foo ORDER BY name COLLATE unicode_ci, id COLLATE unicode`, []string{"UNICODE_CI", "UNICODE"}},
+		{`SELECT 'COLLATE unicode' FROM foo`, nil},
+	} {
+		if got := Collations(tt.sql); !reflect.DeepEqual(got, tt.collations) {
+			t.Fatalf("wrong collations for %s, exp %v, got %v", tt.sql, tt.collations, got)
+		}
+	}
+}
+
+func Test_LoadsCollation(t *testing.T) {
+	for sql, exp := range map[string]bool{
+		`SELECT icu_load_collation('de_DE', 'german')`:                             true,
+		`SELECT ICU_LOAD_COLLATION ('de_DE', 'german')`:                            true,
+		`INSERT INTO foo VALUES(1); SELECT icu_load_collation('tr_TR', 'turkish')`: true,
+		`INSERT INTO foo(icu_load_collation) VALUES(1)`:                            false,
+		`SELECT 'icu_load_collation(x)'`:                                           false,
+		`CREATE TABLE foo (name TEXT COLLATE unicode_ci)`:                          false,
+	} {
+		if got := LoadsCollation([]*Statement{{Sql: sql}}); got != exp {
+			t.Fatalf("wrong result for %s, exp %v, got %v", sql, exp, got)
+		}
+	}
+}
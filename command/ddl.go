@@ -0,0 +1,66 @@
+package command
+
+import (
+	"strings"
+)
+
+// IsDDL returns whether the SQL, which may hold more than one statement,
+// changes the schema of the database.
+func IsDDL(s string) bool {
+	for _, toks := range scanStatements(s) {
+		switch toks[0] {
+		case "CREATE", "ALTER", "DROP":
+			return true
+		}
+	}
+	return false
+}
+
+// ContainsTransactionControl returns whether any of the statements begins,
+// ends or otherwise controls a transaction.
+func ContainsTransactionControl(stmts []*Statement) bool {
+	for _, stmt := range stmts {
+		for _, toks := range scanStatements(stmt.Sql) {
+			switch toks[0] {
+			case "BEGIN", "COMMIT", "END", "ROLLBACK", "SAVEPOINT", "RELEASE":
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// ContainsDDL returns whether any of the statements changes the schema of the
+// database.
+func ContainsDDL(stmts []*Statement) bool {
+	for _, stmt := range stmts {
+		if IsDDL(stmt.Sql) {
+			return true
+		}
+	}
+	return false
+}
+
+// InsertBeforeCommit returns the SQL s, which may hold more than one
+// statement, with the SQL ins inserted before its final statement, if that
+// statement commits a transaction. Otherwise it returns s and false.
+func InsertBeforeCommit(s, ins string) (string, bool) {
+	t := strings.TrimRight(s, " \t\r\n;")
+	i := strings.LastIndex(t, ";")
+	if i < 0 {
+		return s, false
+	}
+	// The final statement is scanned in the context of the whole of s, since
+	// the semicolon found may instead end a statement in the body of a
+	// trigger.
+	stmts := scanStatements(t)
+	if len(stmts) < 2 {
+		return s, false
+	}
+	switch strings.Join(stmts[len(stmts)-1], " ") {
+	case "COMMIT", "COMMIT TRANSACTION", "END", "END TRANSACTION":
+	default:
+		return s, false
+	}
+	return t[:i+1] + "\n" + ins + ";" + s[i+1:], true
+}
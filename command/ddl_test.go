@@ -0,0 +1,100 @@
+package command
+
+import (
+	"testing"
+)
+
+func Test_IsDDL(t *testing.T) {
+	for _, tt := range []struct {
+		sql string
+		exp bool
+	}{
+		{`CREATE TABLE foo (id INTEGER PRIMARY KEY)`, true},
+		{`create index foo_name on foo(name)`, true},
+		{`ALTER TABLE foo ADD COLUMN age INTEGER`, true},
+		{`DROP TABLE foo`, true},
+		{`INSERT INTO foo(name) VALUES("fiona"); DROP VIEW bar`, true},
+		{`INSERT INTO foo(name) VALUES("CREATE TABLE")`, false},
+		{`UPDATE foo SET name="drop" WHERE id=1`, false},
+		{`SELECT * FROM foo`, false},
+		{``, false},
+	} {
+		if got := IsDDL(tt.sql); got != tt.exp {
+			t.Fatalf("wrong result for %q, exp %v, got %v", tt.sql, tt.exp, got)
+		}
+	}
+}
+
+func Test_ContainsDDL(t *testing.T) {
+	stmts := []*Statement{
+		{Sql: `INSERT INTO foo(name) VALUES("fiona")`},
+		{Sql: `SELECT * FROM foo`},
+	}
+	if ContainsDDL(stmts) {
+		t.Fatalf("statements without DDL reported as containing DDL")
+	}
+	stmts = append(stmts, &Statement{Sql: `CREATE TABLE bar (id INTEGER)`})
+	if !ContainsDDL(stmts) {
+		t.Fatalf("statements with DDL not reported as containing DDL")
+	}
+}
+
+func Test_ContainsTransactionControl(t *testing.T) {
+	stmts := []*Statement{
+		{Sql: `CREATE TABLE foo (id INTEGER)`},
+		{Sql: `INSERT INTO foo(name) VALUES("BEGIN")`},
+	}
+	if ContainsTransactionControl(stmts) {
+		t.Fatalf("statements without transaction control reported as containing it")
+	}
+	stmts = append(stmts, &Statement{Sql: `CREATE TRIGGER trig AFTER INSERT ON foo BEGIN DELETE FROM bar; END`})
+	if ContainsTransactionControl(stmts) {
+		t.Fatalf("trigger body reported as containing transaction control")
+	}
+	stmts = append(stmts, &Statement{Sql: `BEGIN; DROP TABLE foo; COMMIT;`})
+	if !ContainsTransactionControl(stmts) {
+		t.Fatalf("statements with transaction control not reported as containing it")
+	}
+}
+
+func Test_InsertBeforeCommit(t *testing.T) {
+	for _, tt := range []struct {
+		sql string
+		exp string
+		ok  bool
+	}{
+		{
+			"BEGIN TRANSACTION;\nCREATE TABLE foo (id INTEGER);\nCOMMIT;\n",
+			"BEGIN TRANSACTION;\nCREATE TABLE foo (id INTEGER);\nDELETE FROM bar;\nCOMMIT;\n",
+			true,
+		},
+		{
+			"BEGIN; CREATE TABLE foo (id INTEGER); end transaction",
+			"BEGIN; CREATE TABLE foo (id INTEGER);\nDELETE FROM bar; end transaction",
+			true,
+		},
+		{"BEGIN; CREATE TABLE foo (id INTEGER)", "", false},
+		{"COMMIT", "", false},
+		{`INSERT INTO foo(name) VALUES("x;COMMIT")`, "", false},
+		{"CREATE TRIGGER trig AFTER INSERT ON foo BEGIN DELETE FROM bar; END", "", false},
+		{
+			"BEGIN;\nCREATE TRIGGER trig AFTER INSERT ON foo BEGIN UPDATE foo SET x = CASE WHEN NEW.x THEN 1 END; END;\nEND;",
+			"BEGIN;\nCREATE TRIGGER trig AFTER INSERT ON foo BEGIN UPDATE foo SET x = CASE WHEN NEW.x THEN 1 END; END;\nDELETE FROM bar;\nEND;",
+			true,
+		},
+	} {
+		got, ok := InsertBeforeCommit(tt.sql, "DELETE FROM bar")
+		if ok != tt.ok {
+			t.Fatalf("wrong result for %q, exp %v, got %v", tt.sql, tt.ok, ok)
+		}
+		if !ok {
+			if got != tt.sql {
+				t.Fatalf("SQL %q changed though nothing inserted, got %q", tt.sql, got)
+			}
+			continue
+		}
+		if got != tt.exp {
+			t.Fatalf("wrong SQL for %q\nexp: %q\ngot: %q", tt.sql, tt.exp, got)
+		}
+	}
+}
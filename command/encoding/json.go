@@ -5,6 +5,7 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
+	"strings"
 
 	"github.com/rqlite/rqlite/command"
 )
@@ -188,11 +189,16 @@ func NewValuesFromQueryValues(dest [][]interface{}, v []*command.Values) error {
 // and ExecuteQueryRequests.
 type Encoder struct {
 	Associative bool
+
+	// JSONColumns, if set, encodes the values of columns declared as JSON or
+	// JSONB as JSON, rather than as strings. Values which are not valid JSON
+	// are still encoded as strings.
+	JSONColumns bool
 }
 
 // JSONMarshal implements the marshal interface
 func (e *Encoder) JSONMarshal(i interface{}) ([]byte, error) {
-	return jsonMarshal(i, noEscapeEncode, e.Associative)
+	return jsonMarshal(i, noEscapeEncode, e)
 }
 
 // JSONMarshalIndent implements the marshal indent interface
@@ -206,7 +212,7 @@ func (e *Encoder) JSONMarshalIndent(i interface{}, prefix, indent string) ([]byt
 		json.Indent(&out, b, prefix, indent)
 		return out.Bytes(), nil
 	}
-	return jsonMarshal(i, f, e.Associative)
+	return jsonMarshal(i, f, e)
 }
 
 func noEscapeEncode(i interface{}) ([]byte, error) {
@@ -219,9 +225,61 @@ func noEscapeEncode(i interface{}) ([]byte, error) {
 	return bytes.TrimRight(buf.Bytes(), "\n"), nil
 }
 
+// IsJSONType returns whether a column of the given declared type holds JSON.
+func IsJSONType(t string) bool {
+	t = strings.ToLower(t)
+	return t == "json" || t == "jsonb"
+}
+
+// structureJSON replaces the string values of JSON columns in r, which must
+// have been created from QueryRows, with the JSON they hold.
+func structureJSON(r interface{}) {
+	switch v := r.(type) {
+	case *Rows:
+		for i, t := range v.Types {
+			if !IsJSONType(t) {
+				continue
+			}
+			for _, row := range v.Values {
+				if i < len(row) {
+					row[i] = jsonValue(row[i])
+				}
+			}
+		}
+	case *AssociativeRows:
+		for c, t := range v.Types {
+			if !IsJSONType(t) {
+				continue
+			}
+			for _, row := range v.Rows {
+				if val, ok := row[c]; ok {
+					row[c] = jsonValue(val)
+				}
+			}
+		}
+	}
+}
+
+// jsonValue returns v as raw JSON, if it is a string holding valid JSON.
+func jsonValue(v interface{}) interface{} {
+	s, ok := v.(string)
+	if !ok || !json.Valid([]byte(s)) {
+		return v
+	}
+	return json.RawMessage(s)
+}
+
 type marshalFunc func(i interface{}) ([]byte, error)
 
-func jsonMarshal(i interface{}, f marshalFunc, assoc bool) ([]byte, error) {
+func jsonMarshal(i interface{}, f marshalFunc, e *Encoder) ([]byte, error) {
+	assoc := e.Associative
+	structure := func(r interface{}) interface{} {
+		if e.JSONColumns {
+			structureJSON(r)
+		}
+		return r
+	}
+
 	switch v := i.(type) {
 	case *command.ExecuteResult:
 		r, err := NewResultFromExecuteResult(v)
@@ -245,20 +303,20 @@ func jsonMarshal(i interface{}, f marshalFunc, assoc bool) ([]byte, error) {
 			if err != nil {
 				return nil, err
 			}
-			return f(r)
+			return f(structure(r))
 		} else {
 			r, err := NewRowsFromQueryRows(v)
 			if err != nil {
 				return nil, err
 			}
-			return f(r)
+			return f(structure(r))
 		}
 	case *command.ExecuteQueryResponse:
 		r, err := NewResultRowsFromExecuteQueryResponse(v)
 		if err != nil {
 			return nil, err
 		}
-		return f(r)
+		return f(structure(r))
 	case []*command.QueryRows:
 		var err error
 
@@ -269,6 +327,7 @@ func jsonMarshal(i interface{}, f marshalFunc, assoc bool) ([]byte, error) {
 				if err != nil {
 					return nil, err
 				}
+				structure(rows[j])
 			}
 			return f(rows)
 		} else {
@@ -278,6 +337,7 @@ func jsonMarshal(i interface{}, f marshalFunc, assoc bool) ([]byte, error) {
 				if err != nil {
 					return nil, err
 				}
+				structure(rows[j])
 			}
 			return f(rows)
 		}
@@ -289,7 +349,7 @@ func jsonMarshal(i interface{}, f marshalFunc, assoc bool) ([]byte, error) {
 				if err != nil {
 					return nil, err
 				}
-				res[j] = r
+				res[j] = structure(r)
 			}
 			return f(res)
 		} else {
@@ -299,7 +359,7 @@ func jsonMarshal(i interface{}, f marshalFunc, assoc bool) ([]byte, error) {
 				if err != nil {
 					return nil, err
 				}
-				res[j] = r
+				res[j] = structure(r)
 			}
 			return f(res)
 		}
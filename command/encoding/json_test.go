@@ -596,3 +596,54 @@ func Test_MarshalExecuteQueryAssociativeResponse(t *testing.T) {
 		})
 	}
 }
+
+func Test_MarshalQueryRowsJSONColumns(t *testing.T) {
+	values := []*command.Parameter{
+		{Value: &command.Parameter_I{I: 1}},
+		{Value: &command.Parameter_S{S: `{"a": [1, 2]}`}},
+		{Value: &command.Parameter_S{S: `not json`}},
+		{Value: &command.Parameter_S{S: `{"b": true}`}},
+	}
+	r := &command.QueryRows{
+		Columns: []string{"id", "doc", "bad", "text"},
+		Types:   []string{"integer", "json", "JSONB", "text"},
+		Values:  []*command.Values{{Parameters: values}},
+	}
+
+	enc := Encoder{}
+	b, err := enc.JSONMarshal([]*command.QueryRows{r})
+	if err != nil {
+		t.Fatalf("failed to marshal QueryRows: %s", err.Error())
+	}
+	if exp, got := `[{"columns":["id","doc","bad","text"],"types":["integer","json","JSONB","text"],"values":[[1,"{\"a\": [1, 2]}","not json","{\"b\": true}"]]}]`, string(b); exp != got {
+		t.Fatalf("failed to marshal QueryRows: exp %s, got %s", exp, got)
+	}
+
+	enc = Encoder{JSONColumns: true}
+	b, err = enc.JSONMarshal([]*command.QueryRows{r})
+	if err != nil {
+		t.Fatalf("failed to marshal QueryRows: %s", err.Error())
+	}
+	if exp, got := `[{"columns":["id","doc","bad","text"],"types":["integer","json","JSONB","text"],"values":[[1,{"a":[1,2]},"not json","{\"b\": true}"]]}]`, string(b); exp != got {
+		t.Fatalf("failed to marshal QueryRows with JSON columns: exp %s, got %s", exp, got)
+	}
+
+	enc = Encoder{JSONColumns: true, Associative: true}
+	b, err = enc.JSONMarshal(r)
+	if err != nil {
+		t.Fatalf("failed to marshal QueryRows: %s", err.Error())
+	}
+	if exp, got := `{"types":{"bad":"JSONB","doc":"json","id":"integer","text":"text"},"rows":[{"bad":"not json","doc":{"a":[1,2]},"id":1,"text":"{\"b\": true}"}]}`, string(b); exp != got {
+		t.Fatalf("failed to marshal associative QueryRows with JSON columns: exp %s, got %s", exp, got)
+	}
+
+	eqr := []*command.ExecuteQueryResponse{{Result: &command.ExecuteQueryResponse_Q{Q: r}}}
+	enc = Encoder{JSONColumns: true}
+	b, err = enc.JSONMarshal(eqr)
+	if err != nil {
+		t.Fatalf("failed to marshal ExecuteQueryResponse: %s", err.Error())
+	}
+	if exp, got := `[{"columns":["id","doc","bad","text"],"types":["integer","json","JSONB","text"],"values":[[1,{"a":[1,2]},"not json","{\"b\": true}"]]}]`, string(b); exp != got {
+		t.Fatalf("failed to marshal ExecuteQueryResponse with JSON columns: exp %s, got %s", exp, got)
+	}
+}
@@ -0,0 +1,236 @@
+package command
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/rqlite/sql"
+)
+
+// SQLiteFeature is a feature of SQLite DDL which is not supported by every
+// version of SQLite.
+type SQLiteFeature struct {
+	Name    string // Description of the feature.
+	Version string // Version of SQLite which introduced the feature.
+}
+
+var (
+	// FeatureRenameColumn is ALTER TABLE ... RENAME COLUMN.
+	FeatureRenameColumn = SQLiteFeature{"ALTER TABLE RENAME COLUMN", "3.25.0"}
+
+	// FeatureGeneratedColumns is generated columns in CREATE TABLE.
+	FeatureGeneratedColumns = SQLiteFeature{"CREATE TABLE with generated columns", "3.31.0"}
+
+	// FeatureDropColumn is ALTER TABLE ... DROP COLUMN.
+	FeatureDropColumn = SQLiteFeature{"ALTER TABLE DROP COLUMN", "3.35.0"}
+
+	// FeatureStrictTables is STRICT tables.
+	FeatureStrictTables = SQLiteFeature{"CREATE TABLE ... STRICT", "3.37.0"}
+)
+
+// ParseSQLiteVersion parses a SQLite version, such as 3.37.0. The patch
+// version may be omitted.
+func ParseSQLiteVersion(v string) ([3]int, error) {
+	var ver [3]int
+	parts := strings.Split(strings.TrimSpace(v), ".")
+	if len(parts) < 2 || len(parts) > 3 {
+		return ver, fmt.Errorf("invalid SQLite version %q", v)
+	}
+	for i, p := range parts {
+		n, err := strconv.Atoi(p)
+		if err != nil || n < 0 {
+			return ver, fmt.Errorf("invalid SQLite version %q", v)
+		}
+		ver[i] = n
+	}
+	return ver, nil
+}
+
+// CompareSQLiteVersions returns -1, 0 or 1 as SQLite version a is less than,
+// equal to, or greater than version b.
+func CompareSQLiteVersions(a, b string) (int, error) {
+	va, err := ParseSQLiteVersion(a)
+	if err != nil {
+		return 0, err
+	}
+	vb, err := ParseSQLiteVersion(b)
+	if err != nil {
+		return 0, err
+	}
+	for i := range va {
+		if va[i] < vb[i] {
+			return -1, nil
+		} else if va[i] > vb[i] {
+			return 1, nil
+		}
+	}
+	return 0, nil
+}
+
+// CheckSQLiteVersion returns an error if any of the statements uses a feature
+// of SQLite DDL which is not supported by version minVersion of SQLite.
+func CheckSQLiteVersion(stmts []*Statement, minVersion string) error {
+	if _, err := ParseSQLiteVersion(minVersion); err != nil {
+		return err
+	}
+	for _, stmt := range stmts {
+		for _, f := range SQLiteFeatures(stmt.Sql) {
+			if c, err := CompareSQLiteVersions(f.Version, minVersion); err != nil {
+				return err
+			} else if c > 0 {
+				return fmt.Errorf("%s requires SQLite %s, but nodes may run SQLite %s",
+					f.Name, f.Version, minVersion)
+			}
+		}
+	}
+	return nil
+}
+
+// SQLiteFeatures returns the version-dependent features of SQLite DDL used
+// by the SQL, which may hold more than one statement.
+func SQLiteFeatures(s string) []SQLiteFeature {
+	var features []SQLiteFeature
+	for _, toks := range scanStatements(s) {
+		if len(toks) < 2 {
+			continue
+		}
+		switch toks[0] {
+		case "CREATE":
+			features = append(features, createTableFeatures(toks)...)
+		case "ALTER":
+			features = append(features, alterTableFeatures(toks)...)
+		}
+	}
+	return features
+}
+
+// createTableFeatures returns the features used by a CREATE TABLE statement,
+// given as tokens.
+func createTableFeatures(toks []string) []SQLiteFeature {
+	i := 1
+	if toks[i] == "TEMP" || toks[i] == "TEMPORARY" {
+		i++
+	}
+	if i >= len(toks) || toks[i] != "TABLE" {
+		return nil
+	}
+
+	var features []SQLiteFeature
+	generated, strict := false, false
+	depth := 0
+	for ; i < len(toks); i++ {
+		switch toks[i] {
+		case "(":
+			depth++
+		case ")":
+			depth--
+		case "GENERATED":
+			// A generated column is introduced by GENERATED ALWAYS AS, or
+			// simply AS, among the column definitions.
+			generated = generated || (depth == 1 && i+1 < len(toks) && toks[i+1] == "ALWAYS")
+		case "AS":
+			generated = generated || (depth == 1 && i+1 < len(toks) && toks[i+1] == "(")
+		case "STRICT":
+			// Table options follow the column definitions.
+			strict = strict || depth == 0
+		}
+	}
+	if generated {
+		features = append(features, FeatureGeneratedColumns)
+	}
+	if strict {
+		features = append(features, FeatureStrictTables)
+	}
+	return features
+}
+
+// alterTableFeatures returns the features used by an ALTER TABLE statement,
+// given as tokens.
+func alterTableFeatures(toks []string) []SQLiteFeature {
+	if toks[1] != "TABLE" {
+		return nil
+	}
+	for i := 2; i < len(toks); i++ {
+		switch toks[i] {
+		case "DROP":
+			return []SQLiteFeature{FeatureDropColumn}
+		case "RENAME":
+			// Renaming the table itself is supported by every version.
+			if i+1 < len(toks) && toks[i+1] != "TO" {
+				return []SQLiteFeature{FeatureRenameColumn}
+			}
+			return nil
+		case "ADD":
+			return nil
+		}
+	}
+	return nil
+}
+
+// scanStatements splits s into statements, each given as a sequence of
+// tokens. Keywords and unquoted identifiers are upper-cased, and quoted
+// identifiers and literals are replaced by placeholders, so that they are
+// never mistaken for keywords. The body of a trigger, between BEGIN and END,
+// holds statements of its own, so the semicolons within it are kept as
+// tokens, rather than ending the statement creating the trigger.
+func scanStatements(s string) [][]string {
+	var stmts [][]string
+	var toks []string
+	body, cases := false, 0
+	scanner := sql.NewScanner(strings.NewReader(s))
+	for {
+		_, tok, lit := scanner.Scan()
+		switch tok {
+		case sql.EOF, sql.SEMI:
+			if tok == sql.SEMI && body {
+				toks = append(toks, ";")
+				continue
+			}
+			if len(toks) > 0 {
+				stmts = append(stmts, toks)
+				toks = nil
+			}
+			body, cases = false, 0
+			if tok == sql.EOF {
+				return stmts
+			}
+			continue
+		case sql.LP:
+			lit = "("
+		case sql.RP:
+			lit = ")"
+		case sql.QIDENT:
+			lit = "<ident>"
+		case sql.STRING, sql.BLOB, sql.INTEGER, sql.FLOAT, sql.BIND:
+			lit = "<literal>"
+		default:
+			lit = strings.ToUpper(lit)
+		}
+		if createsTrigger(toks) {
+			switch {
+			case tok == sql.BEGIN:
+				body = true
+			case tok == sql.CASE:
+				cases++
+			case tok == sql.END && cases > 0:
+				cases--
+			case tok == sql.END:
+				body = false
+			}
+		}
+		toks = append(toks, lit)
+	}
+}
+
+// createsTrigger returns whether the tokens begin a statement which creates a
+// trigger.
+func createsTrigger(toks []string) bool {
+	if len(toks) < 2 || toks[0] != "CREATE" {
+		return false
+	}
+	if toks[1] == "TEMP" || toks[1] == "TEMPORARY" {
+		return len(toks) > 2 && toks[2] == "TRIGGER"
+	}
+	return toks[1] == "TRIGGER"
+}
@@ -0,0 +1,88 @@
+package command
+
+import (
+	"reflect"
+	"testing"
+)
+
+func Test_ParseSQLiteVersion(t *testing.T) {
+	for _, tt := range []struct {
+		v   string
+		exp [3]int
+		ok  bool
+	}{
+		{"3.37.0", [3]int{3, 37, 0}, true},
+		{"3.31", [3]int{3, 31, 0}, true},
+		{" 3.42.1 ", [3]int{3, 42, 1}, true},
+		{"3", [3]int{}, false},
+		{"3.x.0", [3]int{}, false},
+		{"3.1.2.3", [3]int{}, false},
+		{"", [3]int{}, false},
+	} {
+		v, err := ParseSQLiteVersion(tt.v)
+		if (err == nil) != tt.ok {
+			t.Fatalf("wrong result parsing %q, exp ok %v, got err %v", tt.v, tt.ok, err)
+		}
+		if tt.ok && v != tt.exp {
+			t.Fatalf("wrong version for %q, exp %v, got %v", tt.v, tt.exp, v)
+		}
+	}
+
+	if c, err := CompareSQLiteVersions("3.9.0", "3.31.0"); err != nil || c != -1 {
+		t.Fatalf("wrong comparison of versions, got %d, %v", c, err)
+	}
+	if c, err := CompareSQLiteVersions("3.37", "3.37.0"); err != nil || c != 0 {
+		t.Fatalf("wrong comparison of versions, got %d, %v", c, err)
+	}
+}
+
+func Test_SQLiteFeatures(t *testing.T) {
+	for _, tt := range []struct {
+		sql string
+		exp []SQLiteFeature
+	}{
+		{`SELECT 1`, nil},
+		{`CREATE TABLE foo (id INTEGER PRIMARY KEY, name TEXT)`, nil},
+		{`CREATE TABLE foo AS SELECT * FROM bar`, nil},
+		{`CREATE TABLE foo (id INTEGER, d INTEGER DEFAULT (CAST(1 AS INTEGER)))`, nil},
+		{`CREATE TABLE foo (a INTEGER, b INTEGER GENERATED ALWAYS AS (a*2) STORED)`, []SQLiteFeature{FeatureGeneratedColumns}},
+		{`create table foo (a integer, b integer as (a*2))`, []SQLiteFeature{FeatureGeneratedColumns}},
+		{`CREATE TABLE foo (id INTEGER) STRICT`, []SQLiteFeature{FeatureStrictTables}},
+		{`CREATE TEMP TABLE foo (id INTEGER) WITHOUT ROWID, STRICT`, []SQLiteFeature{FeatureStrictTables}},
+		{`CREATE TABLE foo (strict INTEGER, "GENERATED" TEXT)`, nil},
+		{`CREATE TABLE foo (a INTEGER, b AS (a+1)) STRICT`, []SQLiteFeature{FeatureGeneratedColumns, FeatureStrictTables}},
+		{`INSERT INTO foo VALUES('CREATE TABLE foo (id INTEGER) STRICT')`, nil},
+		{`ALTER TABLE foo RENAME TO bar`, nil},
+		{`ALTER TABLE foo RENAME COLUMN a TO b`, []SQLiteFeature{FeatureRenameColumn}},
+		{`ALTER TABLE foo RENAME a TO b`, []SQLiteFeature{FeatureRenameColumn}},
+		{`ALTER TABLE foo ADD COLUMN bar TEXT`, nil},
+		{`ALTER TABLE foo DROP COLUMN bar`, []SQLiteFeature{FeatureDropColumn}},
+		{`SELECT 1; ALTER TABLE foo DROP bar`, []SQLiteFeature{FeatureDropColumn}},
+	} {
+		if got := SQLiteFeatures(tt.sql); !reflect.DeepEqual(got, tt.exp) {
+			t.Fatalf("wrong features for %s, exp %v, got %v", tt.sql, tt.exp, got)
+		}
+	}
+}
+
+func Test_CheckSQLiteVersion(t *testing.T) {
+	stmts := []*Statement{
+		{Sql: `CREATE TABLE foo (a INTEGER, b INTEGER AS (a*2))`},
+		{Sql: `ALTER TABLE foo DROP COLUMN b`},
+	}
+	if err := CheckSQLiteVersion(stmts, "3.35.0"); err != nil {
+		t.Fatalf("unexpected error checking statements: %s", err)
+	}
+	if err := CheckSQLiteVersion(stmts, "3.31.1"); err == nil {
+		t.Fatalf("expected error checking DROP COLUMN against 3.31.1")
+	}
+	if err := CheckSQLiteVersion(stmts[:1], "3.31.1"); err != nil {
+		t.Fatalf("unexpected error checking statements: %s", err)
+	}
+	if err := CheckSQLiteVersion(stmts, "3.30"); err == nil {
+		t.Fatalf("expected error checking generated columns against 3.30")
+	}
+	if err := CheckSQLiteVersion(stmts, "bad"); err == nil {
+		t.Fatalf("expected error for invalid version")
+	}
+}
@@ -0,0 +1,62 @@
+package command
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/rqlite/sql"
+)
+
+// RiskyWrite describes a statement which is likely to change much more of the
+// database than its author intended.
+type RiskyWrite struct {
+	// Statement is the index of the statement within its request.
+	Statement int    `json:"statement"`
+	Reason    string `json:"reason"`
+}
+
+// RiskyWrites returns the risky writes among the statements: DELETEs and
+// UPDATEs without a WHERE clause, and DROP TABLEs. The SQL of each Statement
+// is checked up to the first part which cannot be parsed, which SQLite will
+// refuse anyway.
+func RiskyWrites(stmts []*Statement) []*RiskyWrite {
+	var risky []*RiskyWrite
+	for i, stmt := range stmts {
+		p := sql.NewParser(strings.NewReader(stmt.Sql))
+		for {
+			s, err := p.ParseStatement()
+			if err != nil {
+				break
+			}
+			if reason := riskyReason(s); reason != "" {
+				risky = append(risky, &RiskyWrite{Statement: i, Reason: reason})
+			}
+		}
+	}
+	return risky
+}
+
+// riskyReason returns why the statement s is risky, or the empty string if it
+// is not.
+func riskyReason(s sql.Statement) string {
+	switch n := s.(type) {
+	case *sql.DeleteStatement:
+		if n.WhereExpr == nil {
+			return fmt.Sprintf("DELETE without WHERE clause deletes every row of %s", tableName(n.Table))
+		}
+	case *sql.UpdateStatement:
+		if n.WhereExpr == nil {
+			return fmt.Sprintf("UPDATE without WHERE clause updates every row of %s", tableName(n.Table))
+		}
+	case *sql.DropTableStatement:
+		return fmt.Sprintf("DROP TABLE drops %s", sql.IdentName(n.Name))
+	}
+	return ""
+}
+
+func tableName(t *sql.QualifiedTableName) string {
+	if t == nil {
+		return ""
+	}
+	return sql.IdentName(t.Name)
+}
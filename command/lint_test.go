@@ -0,0 +1,36 @@
+package command
+
+import (
+	"testing"
+)
+
+func Test_RiskyWrites(t *testing.T) {
+	for _, tt := range []struct {
+		sql    string
+		reason string
+	}{
+		{`DELETE FROM foo`, "DELETE without WHERE clause deletes every row of foo"},
+		{`DELETE FROM foo WHERE id = 1`, ""},
+		{`UPDATE "Foo" SET name = 'fiona'`, "UPDATE without WHERE clause updates every row of Foo"},
+		{`UPDATE foo SET name = 'fiona' WHERE id = 1`, ""},
+		{`DROP TABLE IF EXISTS foo`, "DROP TABLE drops foo"},
+		{`SELECT 1; DELETE FROM foo`, "DELETE without WHERE clause deletes every row of foo"},
+		{`INSERT INTO foo VALUES(1)`, ""},
+		{`SELECT * FROM foo`, ""},
+		{`DELETE FROM`, ""},
+	} {
+		risky := RiskyWrites([]*Statement{{Sql: `INSERT INTO foo VALUES(0)`}, {Sql: tt.sql}})
+		if tt.reason == "" {
+			if len(risky) != 0 {
+				t.Fatalf("%s flagged as risky: %s", tt.sql, risky[0].Reason)
+			}
+			continue
+		}
+		if len(risky) != 1 {
+			t.Fatalf("%s not flagged as risky", tt.sql)
+		}
+		if risky[0].Statement != 1 || risky[0].Reason != tt.reason {
+			t.Fatalf("wrong risky write for %s, exp %s, got %d %s", tt.sql, tt.reason, risky[0].Statement, risky[0].Reason)
+		}
+	}
+}
@@ -26,6 +26,11 @@ func Rewrite(stmts []*Statement, r bool) error {
 		if err != nil {
 			continue
 		}
+		// RANDOM in the body of a trigger must be evaluated each time the
+		// trigger fires, not once when the trigger is created.
+		if _, ok := s.(*sql.CreateTriggerStatement); ok {
+			continue
+		}
 		s, f, err := rw.Do(s)
 		if err != nil || !f {
 			continue
@@ -63,6 +63,7 @@ func Test_Rewrites(t *testing.T) {
 		`SELECT title FROM albums ORDER BY RANDOM()`, `SELECT title FROM albums ORDER BY RANDOM\(\)`,
 		`SELECT RANDOM()`, `SELECT -?[0-9]+`,
 		`CREATE TABLE tbl (col1 TEXT, ts DATETIME DEFAULT CURRENT_TIMESTAMP)`, `CREATE TABLE tbl \(col1 TEXT, ts DATETIME DEFAULT CURRENT_TIMESTAMP\)`,
+		`CREATE TRIGGER trig AFTER INSERT ON foo BEGIN INSERT INTO bar VALUES (RANDOM()); END`, `CREATE TRIGGER trig AFTER INSERT ON foo BEGIN INSERT INTO bar VALUES \(RANDOM\(\)\); END`,
 	}
 	for i := 0; i < len(testSQLs)-1; i += 2 {
 		stmts := []*Statement{
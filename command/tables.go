@@ -0,0 +1,98 @@
+package command
+
+import (
+	"io"
+	"strings"
+
+	"github.com/rqlite/sql"
+)
+
+// ReadTables returns the names of the tables read by the statements, if every
+// statement is a SELECT which only reads tables. Otherwise it returns false,
+// including when a statement cannot be parsed.
+func ReadTables(stmts []*Statement) ([]string, bool) {
+	seen := make(map[string]bool)
+	tables := []string{}
+	for _, stmt := range stmts {
+		p := sql.NewParser(strings.NewReader(stmt.Sql))
+		s, err := p.ParseStatement()
+		if err != nil {
+			return nil, false
+		}
+		sel, ok := s.(*sql.SelectStatement)
+		if !ok {
+			return nil, false
+		}
+		// Only a single statement may be present in the SQL.
+		if _, err := p.ParseStatement(); err != io.EOF {
+			return nil, false
+		}
+
+		v := &tableVisitor{}
+		if err := sql.Walk(v, sel); err != nil {
+			return nil, false
+		}
+		for _, t := range v.tables {
+			if !seen[t] {
+				seen[t] = true
+				tables = append(tables, t)
+			}
+		}
+	}
+	return tables, true
+}
+
+// tableVisitor collects the names of the tables referenced by a statement,
+// ignoring references to common table expressions in scope.
+type tableVisitor struct {
+	ctes   [][]string
+	tables []string
+}
+
+// Visit implements sql.Visitor.
+func (v *tableVisitor) Visit(node sql.Node) (sql.Visitor, error) {
+	switch n := node.(type) {
+	case *sql.SelectStatement:
+		var names []string
+		if n.WithClause != nil {
+			for _, cte := range n.WithClause.CTEs {
+				names = append(names, strings.ToLower(sql.IdentName(cte.TableName)))
+			}
+		}
+		v.ctes = append(v.ctes, names)
+
+		// sql.Walk does not descend into common table expressions.
+		if n.WithClause != nil {
+			for _, cte := range n.WithClause.CTEs {
+				if err := sql.Walk(v, cte.Select); err != nil {
+					return nil, err
+				}
+			}
+		}
+	case *sql.QualifiedTableName:
+		name := strings.ToLower(sql.IdentName(n.Name))
+		if !v.isCTE(name) {
+			v.tables = append(v.tables, name)
+		}
+	}
+	return v, nil
+}
+
+// VisitEnd implements sql.Visitor.
+func (v *tableVisitor) VisitEnd(node sql.Node) error {
+	if _, ok := node.(*sql.SelectStatement); ok {
+		v.ctes = v.ctes[:len(v.ctes)-1]
+	}
+	return nil
+}
+
+func (v *tableVisitor) isCTE(name string) bool {
+	for _, names := range v.ctes {
+		for _, n := range names {
+			if n == name {
+				return true
+			}
+		}
+	}
+	return false
+}
@@ -0,0 +1,54 @@
+package command
+
+import (
+	"reflect"
+	"testing"
+)
+
+func Test_ReadTables(t *testing.T) {
+	for _, tt := range []struct {
+		sql    string
+		tables []string
+		ok     bool
+	}{
+		{`SELECT 1`, []string{}, true},
+		{`SELECT * FROM foo`, []string{"foo"}, true},
+		{`SELECT * FROM "Foo" AS f`, []string{"foo"}, true},
+		{`SELECT * FROM foo JOIN bar ON foo.id = bar.id`, []string{"foo", "bar"}, true},
+		{`SELECT * FROM foo WHERE EXISTS (SELECT 1 FROM bar)`, []string{"foo", "bar"}, true},
+		{`SELECT * FROM (SELECT * FROM foo)`, []string{"foo"}, true},
+		{`SELECT * FROM foo UNION SELECT * FROM bar`, []string{"foo", "bar"}, true},
+		{`WITH c AS (SELECT * FROM foo) SELECT * FROM c`, []string{"foo"}, true},
+		{`SELECT * FROM foo; DELETE FROM foo`, nil, false},
+		{`INSERT INTO foo VALUES(1)`, nil, false},
+		{`DELETE FROM foo`, nil, false},
+		{`SELECT * FROM`, nil, false},
+	} {
+		tables, ok := ReadTables([]*Statement{{Sql: tt.sql}})
+		if ok != tt.ok {
+			t.Fatalf("wrong result for %s, exp %v, got %v", tt.sql, tt.ok, ok)
+		}
+		if !reflect.DeepEqual(tables, tt.tables) {
+			t.Fatalf("wrong tables for %s, exp %v, got %v", tt.sql, tt.tables, tables)
+		}
+	}
+}
+
+func Test_ReadTablesMulti(t *testing.T) {
+	stmts := []*Statement{
+		{Sql: `SELECT * FROM foo`},
+		{Sql: `SELECT * FROM bar JOIN foo`},
+	}
+	tables, ok := ReadTables(stmts)
+	if !ok {
+		t.Fatalf("statements not read-only")
+	}
+	if exp := []string{"foo", "bar"}; !reflect.DeepEqual(tables, exp) {
+		t.Fatalf("wrong tables, exp %v, got %v", exp, tables)
+	}
+
+	stmts = append(stmts, &Statement{Sql: `UPDATE foo SET id = 1`})
+	if _, ok := ReadTables(stmts); ok {
+		t.Fatalf("statements with update considered read-only")
+	}
+}
@@ -0,0 +1,211 @@
+package command
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/rqlite/sql"
+)
+
+// NonDeterministicTrigger describes a trigger whose effects may differ from
+// node to node, since each node fires the trigger as it applies a write.
+type NonDeterministicTrigger struct {
+	// Statement is the index of the statement, within its request, which
+	// creates the trigger.
+	Statement int      `json:"statement"`
+	Name      string   `json:"name"`
+	Reasons   []string `json:"reasons"`
+}
+
+// nonDeterministicFuncs are the SQLite functions whose results may differ
+// from node to node, even though every node applies the same writes.
+var nonDeterministicFuncs = map[string]string{
+	"random":            "calls random(), which returns a different value on each node",
+	"randomblob":        "calls randomblob(), which returns a different value on each node",
+	"changes":           "calls changes(), which depends on the history of the connection of each node",
+	"total_changes":     "calls total_changes(), which depends on the history of the connection of each node",
+	"last_insert_rowid": "calls last_insert_rowid(), which depends on the history of the connection of each node",
+}
+
+// timeFuncs are the SQLite date and time functions, which read the current
+// time of each node if called without a time value, or with 'now'.
+var timeFuncs = map[string]bool{
+	"date": true, "time": true, "datetime": true, "julianday": true,
+	"unixepoch": true, "strftime": true, "timediff": true,
+}
+
+// NonDeterministicTriggers returns the triggers, created by any of the
+// statements, whose effects may differ from node to node.
+func NonDeterministicTriggers(stmts []*Statement) []*NonDeterministicTrigger {
+	var triggers []*NonDeterministicTrigger
+	for i, stmt := range stmts {
+		for _, t := range scanTriggers(stmt.Sql) {
+			if len(t.Reasons) > 0 {
+				t.Statement = i
+				triggers = append(triggers, t)
+			}
+		}
+	}
+	return triggers
+}
+
+// TriggerNonDeterminism returns why the effects of the trigger created by the
+// SQL s may differ from node to node, or nil if they may not.
+func TriggerNonDeterminism(s string) []string {
+	var reasons []string
+	for _, t := range scanTriggers(s) {
+		reasons = append(reasons, t.Reasons...)
+	}
+	return reasons
+}
+
+// token is a token read by the SQL scanner.
+type token struct {
+	tok sql.Token
+	lit string
+}
+
+// scanTriggers returns each trigger created by the SQL s, which may hold more
+// than one statement, with the reasons, if any, it is not deterministic. The
+// SQL is scanned, rather than parsed, so that triggers are found in any SQL
+// SQLite accepts, such as dumps. The scan is conservative: a trigger may be
+// reported which, as written, would in fact have the same effects on every
+// node.
+func scanTriggers(s string) []*NonDeterministicTrigger {
+	var toks []token
+	scanner := sql.NewScanner(strings.NewReader(s))
+	for {
+		_, tok, lit := scanner.Scan()
+		if tok == sql.EOF {
+			break
+		}
+		toks = append(toks, token{tok, lit})
+	}
+
+	var triggers []*NonDeterministicTrigger
+	for i := 0; i < len(toks); i++ {
+		if toks[i].tok != sql.CREATE {
+			continue
+		}
+		j := i + 1
+		if j < len(toks) && (toks[j].tok == sql.TEMP || strings.EqualFold(toks[j].lit, "TEMPORARY")) {
+			j++
+		}
+		if j >= len(toks) || toks[j].tok != sql.TRIGGER {
+			continue
+		}
+		j++
+		if j+2 < len(toks) && toks[j].tok == sql.IF && toks[j+1].tok == sql.NOT && toks[j+2].tok == sql.EXISTS {
+			j += 3
+		}
+		if j+2 < len(toks) && toks[j+1].tok == sql.DOT {
+			j += 2
+		}
+		if j >= len(toks) {
+			break
+		}
+		t := &NonDeterministicTrigger{Name: toks[j].lit}
+
+		// The trigger ends at the END closing its body. CASE expressions
+		// also end with END.
+		end := len(toks)
+		begun, cases := false, 0
+		for k := j + 1; k < len(toks); k++ {
+			switch toks[k].tok {
+			case sql.BEGIN:
+				begun = true
+			case sql.CASE:
+				cases++
+			case sql.END:
+				if cases > 0 {
+					cases--
+				} else if begun {
+					end = k
+				}
+			}
+			if end < len(toks) {
+				break
+			}
+		}
+		t.Reasons = nonDeterminism(toks[j+1 : end])
+		triggers = append(triggers, t)
+		i = end
+	}
+	return triggers
+}
+
+// nonDeterminism returns the reasons the tokens of a trigger may have effects
+// which differ from node to node.
+func nonDeterminism(toks []token) []string {
+	var reasons []string
+	seen := make(map[string]bool)
+	add := func(r string) {
+		if !seen[r] {
+			seen[r] = true
+			reasons = append(reasons, r)
+		}
+	}
+
+	for i, t := range toks {
+		switch t.tok {
+		case sql.CURRENT_TIME, sql.CURRENT_DATE, sql.CURRENT_TIMESTAMP:
+			add(fmt.Sprintf("reads %s, the current time of each node", strings.ToUpper(t.lit)))
+			continue
+		case sql.IDENT:
+		default:
+			continue
+		}
+		if i+1 >= len(toks) || toks[i+1].tok != sql.LP {
+			continue
+		}
+		name := strings.ToLower(t.lit)
+		if r, ok := nonDeterministicFuncs[name]; ok {
+			add(r)
+			continue
+		}
+		if !timeFuncs[name] {
+			continue
+		}
+		if readsNow(name, toks[i+2:]) {
+			add(fmt.Sprintf("calls %s() with the current time of each node", name))
+		}
+	}
+	return reasons
+}
+
+// readsNow returns whether a call of the named time function, whose arguments
+// begin toks, reads the current time.
+func readsNow(name string, toks []token) bool {
+	var args [][]token
+	var arg []token
+	depth := 0
+	for _, t := range toks {
+		if t.tok == sql.LP {
+			depth++
+		} else if t.tok == sql.RP {
+			if depth == 0 {
+				break
+			}
+			depth--
+		}
+		if t.tok == sql.COMMA && depth == 0 {
+			args = append(args, arg)
+			arg = nil
+			continue
+		}
+		arg = append(arg, t)
+		if t.tok == sql.STRING && strings.EqualFold(strings.TrimSpace(t.lit), "now") {
+			return true
+		}
+	}
+	if len(arg) > 0 {
+		args = append(args, arg)
+	}
+
+	// The time value is the first argument, except of strftime, which takes
+	// the format first. Without a time value, the current time is used.
+	if name == "strftime" {
+		return len(args) < 2
+	}
+	return len(args) == 0
+}
@@ -0,0 +1,68 @@
+package command
+
+import (
+	"reflect"
+	"testing"
+)
+
+func Test_TriggerNonDeterminism(t *testing.T) {
+	for _, tt := range []struct {
+		sql string
+		exp []string
+	}{
+		{
+			sql: `CREATE TRIGGER trig AFTER INSERT ON foo BEGIN UPDATE bar SET n = n + 1; END`,
+		},
+		{
+			sql: `INSERT INTO foo VALUES (random(), datetime('now'))`,
+		},
+		{
+			sql: `CREATE TRIGGER trig AFTER INSERT ON foo BEGIN INSERT INTO bar VALUES (datetime(NEW.ts, '+1 day'), strftime('%s', NEW.ts)); END`,
+		},
+		{
+			sql: `CREATE TRIGGER trig AFTER INSERT ON foo BEGIN INSERT INTO bar VALUES (RANDOM()); END`,
+			exp: []string{"calls random(), which returns a different value on each node"},
+		},
+		{
+			sql: `CREATE TEMP TRIGGER IF NOT EXISTS main.trig AFTER UPDATE ON foo WHEN randomblob(4) IS NOT NULL BEGIN SELECT 1; END`,
+			exp: []string{"calls randomblob(), which returns a different value on each node"},
+		},
+		{
+			sql: `CREATE TRIGGER trig AFTER UPDATE ON foo BEGIN UPDATE foo SET updated = CURRENT_TIMESTAMP WHERE id = NEW.id; END`,
+			exp: []string{"reads CURRENT_TIMESTAMP, the current time of each node"},
+		},
+		{
+			sql: `CREATE TRIGGER trig AFTER INSERT ON foo BEGIN INSERT INTO log VALUES (datetime('now'), date(), strftime('%s'), last_insert_rowid()); END`,
+			exp: []string{
+				"calls datetime() with the current time of each node",
+				"calls date() with the current time of each node",
+				"calls strftime() with the current time of each node",
+				"calls last_insert_rowid(), which depends on the history of the connection of each node",
+			},
+		},
+		{
+			// CASE expressions end with END, as the trigger does.
+			sql: `CREATE TRIGGER trig AFTER INSERT ON foo BEGIN UPDATE foo SET x = CASE WHEN NEW.x > 0 THEN 1 ELSE 0 END; INSERT INTO bar VALUES (changes()); END; INSERT INTO foo VALUES (random())`,
+			exp: []string{"calls changes(), which depends on the history of the connection of each node"},
+		},
+	} {
+		if got := TriggerNonDeterminism(tt.sql); !reflect.DeepEqual(tt.exp, got) {
+			t.Fatalf("wrong reasons for %s\nexp: %v\ngot: %v", tt.sql, tt.exp, got)
+		}
+	}
+}
+
+func Test_NonDeterministicTriggers(t *testing.T) {
+	stmts := []*Statement{
+		{Sql: `CREATE TABLE foo (id INTEGER, ts TEXT)`},
+		{Sql: `CREATE TRIGGER safe AFTER INSERT ON foo BEGIN DELETE FROM bar; END`},
+		{Sql: "PRAGMA foreign_keys=OFF;\nBEGIN TRANSACTION;\nCREATE TRIGGER \"unsafe\" AFTER INSERT ON foo BEGIN UPDATE foo SET ts = time('now'); END;\nCOMMIT;"},
+	}
+	triggers := NonDeterministicTriggers(stmts)
+	if len(triggers) != 1 {
+		t.Fatalf("wrong number of non-deterministic triggers, exp 1, got %d", len(triggers))
+	}
+	if triggers[0].Statement != 2 || triggers[0].Name != "unsafe" || len(triggers[0].Reasons) != 1 {
+		t.Fatalf("wrong non-deterministic trigger: %+v", triggers[0])
+	}
+}
@@ -0,0 +1,211 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/rqlite/go-sqlite3"
+)
+
+const (
+	numBusyReads         = "busy_reads"
+	numBusyReadRetries   = "busy_read_retries"
+	numBusyReadFailures  = "busy_read_failures"
+	busyReadWait         = "busy_read_wait_us"
+	numBusyWrites        = "busy_writes"
+	numBusyWriteRetries  = "busy_write_retries"
+	numBusyWriteFailures = "busy_write_failures"
+	busyWriteWait        = "busy_write_wait_us"
+
+	// maxBusyRetryDelay is the longest delay between retries of a statement
+	// which found the database locked.
+	maxBusyRetryDelay = time.Second
+
+	// maxBusyLogSQL is the length at which SQL is truncated when logged.
+	maxBusyLogSQL = 100
+)
+
+// BusyPolicy controls the retrying of statements which fail because the
+// database is locked, that is with SQLITE_BUSY or SQLITE_LOCKED. The policy
+// applies to every database opened by the process.
+type BusyPolicy struct {
+	// Timeout is how long SQLite waits for a lock before a statement fails
+	// with SQLITE_BUSY. Zero means the default of the driver, 5 seconds. It
+	// applies only to databases opened after the policy is set.
+	Timeout time.Duration
+
+	// MaxRetries is the number of times a statement is retried. Zero means
+	// a statement is never retried.
+	MaxRetries int
+
+	// Delay is the delay before the first retry. It doubles with each
+	// subsequent retry, up to a maximum of one second.
+	Delay time.Duration
+}
+
+var (
+	busyPolicyMu sync.RWMutex
+	busyPolicy   BusyPolicy
+
+	busyLogger = log.New(os.Stderr, "[db] ", log.LstdFlags)
+)
+
+// SetBusyPolicy sets the policy for retrying statements which fail because
+// the database is locked.
+func SetBusyPolicy(p BusyPolicy) {
+	busyPolicyMu.Lock()
+	defer busyPolicyMu.Unlock()
+	busyPolicy = p
+}
+
+// busyTimeoutOpts returns the DSN options which set the busy timeout of a
+// connection, if any.
+func busyTimeoutOpts() []string {
+	if t := getBusyPolicy().Timeout; t > 0 {
+		return []string{fmt.Sprintf("_busy_timeout=%d", t.Milliseconds())}
+	}
+	return nil
+}
+
+func getBusyPolicy() BusyPolicy {
+	busyPolicyMu.RLock()
+	defer busyPolicyMu.RUnlock()
+	return busyPolicy
+}
+
+// isBusy returns whether err is the result of the database being locked.
+func isBusy(err error) bool {
+	var se sqlite3.Error
+	if !errors.As(err, &se) {
+		return false
+	}
+	return se.Code == sqlite3.ErrBusy || se.Code == sqlite3.ErrLocked
+}
+
+// transientErrors are the SQLite errors which may not recur if the operation
+// which failed is retried.
+var transientErrors = []sqlite3.ErrNo{
+	sqlite3.ErrBusy,
+	sqlite3.ErrLocked,
+	sqlite3.ErrNomem,
+	sqlite3.ErrIoErr,
+	sqlite3.ErrFull,
+}
+
+// IsTransientError returns whether err is an SQLite error which may not recur
+// if the operation which failed is retried, such as the database being locked
+// or the disk being full.
+func IsTransientError(err error) bool {
+	var se sqlite3.Error
+	if !errors.As(err, &se) {
+		return false
+	}
+	for _, code := range transientErrors {
+		if se.Code == code {
+			return true
+		}
+	}
+	return false
+}
+
+// IsTransientErrorMessage returns whether msg, the error of a statement
+// result, is the message of an error for which IsTransientError returns true.
+func IsTransientErrorMessage(msg string) bool {
+	if msg == "" {
+		return false
+	}
+	for _, code := range transientErrors {
+		if strings.HasPrefix(msg, code.Error()) {
+			return true
+		}
+	}
+	return false
+}
+
+// busyConn returns a connection from pool, retrying according to the busy
+// policy if the database is locked, since opening a connection may need to
+// read the database.
+func busyConn(pool *sql.DB, write bool) (*sql.Conn, error) {
+	var conn *sql.Conn
+	err := retryBusy(write, "", func() error {
+		var err error
+		conn, err = pool.Conn(context.Background())
+		return err
+	})
+	return conn, err
+}
+
+// retryBusy calls f, which executes the statement stmt, retrying it according
+// to the busy policy for as long as it fails because the database is locked.
+// It returns the error returned by the final call. The number of operations
+// finding the database locked, the retries, and the time spent waiting for
+// the lock, are recorded separately for reads and writes. stmt may be empty
+// if f does not execute a statement.
+func retryBusy(write bool, stmt string, f func() error) error {
+	var policy BusyPolicy
+	var retries int
+	var wait, delay time.Duration
+	for {
+		start := time.Now()
+		err := f()
+		if !isBusy(err) {
+			if retries > 0 {
+				recordBusy(write, stmt, retries, wait, nil)
+			}
+			return err
+		}
+		wait += time.Since(start)
+
+		if retries == 0 {
+			policy = getBusyPolicy()
+			delay = policy.Delay
+		}
+		if retries >= policy.MaxRetries {
+			recordBusy(write, stmt, retries, wait, err)
+			return err
+		}
+
+		time.Sleep(delay)
+		wait += delay
+		if delay *= 2; delay > maxBusyRetryDelay {
+			delay = maxBusyRetryDelay
+		}
+		retries++
+	}
+}
+
+// recordBusy records the outcome of a statement which found the database
+// locked. err is the error with which it finally failed, if any.
+func recordBusy(write bool, stmt string, retries int, wait time.Duration, err error) {
+	numBusy, numRetries, numFailures, waitStat := numBusyReads, numBusyReadRetries, numBusyReadFailures, busyReadWait
+	op := "read"
+	if write {
+		numBusy, numRetries, numFailures, waitStat = numBusyWrites, numBusyWriteRetries, numBusyWriteFailures, busyWriteWait
+		op = "write"
+	}
+	stats.Add(numBusy, 1)
+	stats.Add(numRetries, int64(retries))
+	stats.Add(waitStat, wait.Microseconds())
+
+	result := "succeeded"
+	if err != nil {
+		stats.Add(numFailures, 1)
+		result = "failed"
+	}
+	msg := fmt.Sprintf("database locked: op=%s retries=%d wait=%s result=%s",
+		op, retries, wait, result)
+	if stmt != "" {
+		if len(stmt) > maxBusyLogSQL {
+			stmt = stmt[:maxBusyLogSQL] + "..."
+		}
+		msg += fmt.Sprintf(" stmt=%q", stmt)
+	}
+	busyLogger.Print(msg)
+}
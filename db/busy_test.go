@@ -0,0 +1,134 @@
+package db
+
+import (
+	"context"
+	"expvar"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/rqlite/go-sqlite3"
+)
+
+func Test_IsBusy(t *testing.T) {
+	if isBusy(nil) {
+		t.Fatalf("nil error is busy")
+	}
+	if isBusy(os.ErrNotExist) {
+		t.Fatalf("non-SQLite error is busy")
+	}
+}
+
+func Test_IsTransientError(t *testing.T) {
+	if IsTransientError(nil) {
+		t.Fatalf("nil error is transient")
+	}
+	if IsTransientError(os.ErrNotExist) {
+		t.Fatalf("non-SQLite error is transient")
+	}
+	if !IsTransientError(sqlite3.Error{Code: sqlite3.ErrFull}) {
+		t.Fatalf("full disk is not transient")
+	}
+	if IsTransientError(sqlite3.Error{Code: sqlite3.ErrConstraint}) {
+		t.Fatalf("constraint violation is transient")
+	}
+
+	if IsTransientErrorMessage("") {
+		t.Fatalf("empty message is transient")
+	}
+	if !IsTransientErrorMessage("database or disk is full") {
+		t.Fatalf("full disk message is not transient")
+	}
+	if IsTransientErrorMessage("UNIQUE constraint failed: foo.id") {
+		t.Fatalf("constraint violation message is transient")
+	}
+}
+
+func Test_BusyRetries(t *testing.T) {
+	SetBusyPolicy(BusyPolicy{
+		Timeout:    time.Millisecond,
+		MaxRetries: 100,
+		Delay:      5 * time.Millisecond,
+	})
+	defer SetBusyPolicy(BusyPolicy{})
+	ResetStats()
+
+	db, path := mustCreateDatabase()
+	defer db.Close()
+	defer os.Remove(path)
+	if _, err := db.ExecuteStringStmt("CREATE TABLE foo (id INTEGER NOT NULL PRIMARY KEY, name TEXT)"); err != nil {
+		t.Fatalf("failed to create table: %s", err.Error())
+	}
+
+	// lock takes an exclusive lock on the database, using another
+	// connection, and returns a function which releases it.
+	lock := func() func() {
+		lockDB, err := Open(path, false)
+		if err != nil {
+			t.Fatalf("failed to open database: %s", err.Error())
+		}
+		conn, err := lockDB.rwDB.Conn(context.Background())
+		if err != nil {
+			t.Fatalf("failed to get connection: %s", err.Error())
+		}
+		if _, err := conn.ExecContext(context.Background(), "BEGIN EXCLUSIVE"); err != nil {
+			t.Fatalf("failed to lock database: %s", err.Error())
+		}
+		return func() {
+			if _, err := conn.ExecContext(context.Background(), "COMMIT"); err != nil {
+				t.Fatalf("failed to unlock database: %s", err.Error())
+			}
+			conn.Close()
+			lockDB.Close()
+		}
+	}
+	statValue := func(name string) int64 {
+		return stats.Get(name).(*expvar.Int).Value()
+	}
+
+	// A write must succeed once the lock is released.
+	unlock := lock()
+	time.AfterFunc(50*time.Millisecond, unlock)
+	r, err := db.ExecuteStringStmt(`INSERT INTO foo(name) VALUES("fiona")`)
+	if err != nil {
+		t.Fatalf("failed to insert record: %s", err.Error())
+	}
+	if exp, got := `[{"last_insert_id":1,"rows_affected":1}]`, asJSON(r); exp != got {
+		t.Fatalf("unexpected results for insert, expected %s, got %s", exp, got)
+	}
+	if statValue(numBusyWrites) != 1 || statValue(numBusyWriteRetries) == 0 || statValue(busyWriteWait) == 0 {
+		t.Fatalf("busy write not recorded: %s", stats.String())
+	}
+	if statValue(numBusyWriteFailures) != 0 {
+		t.Fatalf("busy write recorded as failed: %s", stats.String())
+	}
+
+	// As must a read.
+	unlock = lock()
+	time.AfterFunc(50*time.Millisecond, unlock)
+	q, err := db.QueryStringStmt(`SELECT COUNT(*) FROM foo`)
+	if err != nil {
+		t.Fatalf("failed to query table: %s", err.Error())
+	}
+	if exp, got := `[{"columns":["COUNT(*)"],"types":[""],"values":[[1]]}]`, asJSON(q); exp != got {
+		t.Fatalf("unexpected results for query, expected %s, got %s", exp, got)
+	}
+	if statValue(numBusyReads) != 1 || statValue(numBusyReadRetries) == 0 {
+		t.Fatalf("busy read not recorded: %s", stats.String())
+	}
+
+	// Without retries, the write fails.
+	SetBusyPolicy(BusyPolicy{Timeout: time.Millisecond})
+	unlock = lock()
+	defer unlock()
+	r, err = db.ExecuteStringStmt(`INSERT INTO foo(name) VALUES("fiona")`)
+	if err != nil {
+		t.Fatalf("failed to insert record: %s", err.Error())
+	}
+	if exp, got := `[{"error":"database is locked"}]`, asJSON(r); exp != got {
+		t.Fatalf("unexpected results for insert, expected %s, got %s", exp, got)
+	}
+	if statValue(numBusyWrites) != 2 || statValue(numBusyWriteFailures) != 1 {
+		t.Fatalf("failed busy write not recorded: %s", stats.String())
+	}
+}
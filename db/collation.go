@@ -0,0 +1,115 @@
+package db
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/rqlite/go-sqlite3"
+	"golang.org/x/text/collate"
+	"golang.org/x/text/language"
+)
+
+// driverName is the name of the SQLite driver through which every database is
+// opened, so that each connection has the registered collations.
+const driverName = "rqlite-sqlite3"
+
+var (
+	// ErrCollationName is returned when a collation is registered under a name
+	// which SQLite cannot use.
+	ErrCollationName = errors.New("invalid collation name")
+
+	// ErrCollationExists is returned when a collation is registered under
+	// the name of a collation already registered, or built into SQLite.
+	ErrCollationExists = errors.New("collation already registered")
+)
+
+// collationName matches the names permitted for collations.
+var collationName = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// CollationFunc returns a function comparing two strings, returning -1, 0, or
+// +1 if the first sorts before, with, or after the second. Each connection to
+// a database calls it once, so the comparison function need only be safe for
+// use by one goroutine at a time.
+type CollationFunc func() func(a, b string) int
+
+var (
+	collationsMu sync.RWMutex
+	collations   = map[string]CollationFunc{
+		// UNICODE orders strings by the Unicode Collation Algorithm,
+		// independent of any language.
+		"UNICODE": unicodeCollation(),
+
+		// UNICODE_CI orders as UNICODE, ignoring case.
+		"UNICODE_CI": unicodeCollation(collate.IgnoreCase),
+
+		// UNICODE_CI_AI orders as UNICODE, ignoring case and diacritics, so
+		// that "resume", "Résumé" and "RESUMÉ" are equal.
+		"UNICODE_CI_AI": unicodeCollation(collate.IgnoreCase, collate.IgnoreDiacritics, collate.IgnoreWidth),
+	}
+)
+
+func init() {
+	sql.Register(driverName, &sqlite3.SQLiteDriver{
+		ConnectHook: registerCollations,
+	})
+}
+
+func unicodeCollation(opts ...collate.Option) CollationFunc {
+	return func() func(a, b string) int {
+		return collate.New(language.Und, opts...).CompareString
+	}
+}
+
+// RegisterCollation registers a collation under name, so that every database
+// opened afterwards may use it, as in COLLATE name. Every node of a cluster
+// must register the same collations, ordering strings identically, or nodes
+// may order, and index, the same data differently. A node missing a collation
+// registered with the Leader may not join the cluster.
+func RegisterCollation(name string, fn CollationFunc) error {
+	if !collationName.MatchString(name) {
+		return fmt.Errorf("%w: %q", ErrCollationName, name)
+	}
+	name = strings.ToUpper(name)
+	if name == "BINARY" || name == "NOCASE" || name == "RTRIM" {
+		return fmt.Errorf("%w: %s", ErrCollationExists, name)
+	}
+
+	collationsMu.Lock()
+	defer collationsMu.Unlock()
+	if _, ok := collations[name]; ok {
+		return fmt.Errorf("%w: %s", ErrCollationExists, name)
+	}
+	collations[name] = fn
+	return nil
+}
+
+// Collations returns the names, upper-cased and sorted, of the registered
+// collations.
+func Collations() []string {
+	collationsMu.RLock()
+	defer collationsMu.RUnlock()
+	names := make([]string, 0, len(collations))
+	for name := range collations {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// registerCollations registers each registered collation with a new
+// connection.
+func registerCollations(conn *sqlite3.SQLiteConn) error {
+	collationsMu.RLock()
+	defer collationsMu.RUnlock()
+	for name, fn := range collations {
+		if err := conn.RegisterCollation(name, fn()); err != nil {
+			return fmt.Errorf("registering collation %s: %s", name, err.Error())
+		}
+	}
+	return nil
+}
@@ -0,0 +1,95 @@
+package db
+
+import (
+	"errors"
+	"os"
+	"strings"
+	"testing"
+)
+
+func Test_Collations(t *testing.T) {
+	for _, inmem := range []bool{false, true} {
+		var db *DB
+		if inmem {
+			db = mustCreateInMemoryDatabase()
+		} else {
+			var path string
+			db, path = mustCreateDatabase()
+			defer os.Remove(path)
+		}
+		defer db.Close()
+
+		mustExecute(db, `CREATE TABLE foo (id INTEGER NOT NULL PRIMARY KEY, name TEXT COLLATE unicode_ci_ai)`)
+		mustExecute(db, `INSERT INTO foo(id, name) VALUES(1, 'resume'), (2, 'Résumé'), (3, 'apple'), (4, 'Zebra'), (5, 'éclair')`)
+
+		for q, exp := range map[string]string{
+			`SELECT id FROM foo WHERE name = 'RESUMÉ' ORDER BY id`:     `[[1],[2]]`,
+			`SELECT id FROM foo ORDER BY name, id`:                     `[[3],[5],[1],[2],[4]]`,
+			`SELECT id FROM foo ORDER BY name COLLATE BINARY`:          `[[2],[4],[3],[1],[5]]`,
+			`SELECT id FROM foo ORDER BY name COLLATE unicode_ci DESC`: `[[4],[2],[1],[5],[3]]`,
+		} {
+			r, err := db.QueryStringStmt(q)
+			if err != nil {
+				t.Fatalf("failed to query %s: %s", q, err.Error())
+			}
+			if got := asJSON(r[0].Values); got != exp {
+				t.Fatalf("wrong results for %s\nexp: %s\ngot: %s", q, exp, got)
+			}
+		}
+
+		// Connections of a copy of the database, such as a node restored from
+		// a snapshot, have the collations too.
+		b, err := db.Serialize()
+		if err != nil {
+			t.Fatalf("failed to serialize database: %s", err.Error())
+		}
+		cp, err := DeserializeIntoMemory(b, false)
+		if err != nil {
+			t.Fatalf("failed to deserialize database: %s", err.Error())
+		}
+		defer cp.Close()
+		mustExecute(cp, `INSERT INTO foo(id, name) VALUES(6, 'ECLAIR')`)
+		r, err := cp.QueryStringStmt(`SELECT COUNT(*) FROM foo WHERE name = 'eclair'`)
+		if err != nil {
+			t.Fatalf("failed to query copy: %s", err.Error())
+		}
+		if exp, got := `[[2]]`, asJSON(r[0].Values); exp != got {
+			t.Fatalf("wrong results from copy\nexp: %s\ngot: %s", exp, got)
+		}
+	}
+}
+
+func Test_RegisterCollation(t *testing.T) {
+	if err := RegisterCollation("reverse_test", func() func(a, b string) int {
+		return func(a, b string) int { return -strings.Compare(a, b) }
+	}); err != nil {
+		t.Fatalf("failed to register collation: %s", err.Error())
+	}
+	for name, exp := range map[string]error{
+		"REVERSE_TEST": ErrCollationExists,
+		"unicode":      ErrCollationExists,
+		"nocase":       ErrCollationExists,
+		"bad name":     ErrCollationName,
+		"":             ErrCollationName,
+	} {
+		err := RegisterCollation(name, func() func(a, b string) int { return strings.Compare })
+		if !errors.Is(err, exp) {
+			t.Fatalf("wrong error registering %q, exp %v, got %v", name, exp, err)
+		}
+	}
+	if exp, got := "REVERSE_TEST,UNICODE,UNICODE_CI,UNICODE_CI_AI", strings.Join(Collations(), ","); exp != got {
+		t.Fatalf("wrong collations, exp %s, got %s", exp, got)
+	}
+
+	db := mustCreateInMemoryDatabase()
+	defer db.Close()
+	mustExecute(db, `CREATE TABLE foo (name TEXT)`)
+	mustExecute(db, `INSERT INTO foo(name) VALUES('a'), ('c'), ('b')`)
+	r, err := db.QueryStringStmt(`SELECT name FROM foo ORDER BY name COLLATE reverse_test`)
+	if err != nil {
+		t.Fatalf("failed to query: %s", err.Error())
+	}
+	if exp, got := `[["c"],["b"],["a"]]`, asJSON(r[0].Values); exp != got {
+		t.Fatalf("wrong results\nexp: %s\ngot: %s", exp, got)
+	}
+}
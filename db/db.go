@@ -5,6 +5,7 @@ package db
 import (
 	"context"
 	"database/sql"
+	"errors"
 	"expvar"
 	"fmt"
 	"io"
@@ -12,6 +13,7 @@ import (
 	"os"
 	"strconv"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/rqlite/go-sqlite3"
@@ -29,11 +31,32 @@ const (
 	numETx             = "execute_transactions"
 	numQTx             = "query_transactions"
 	numRTx             = "request_transactions"
+	numDryRuns         = "dry_runs"
+	numPTx             = "execute_partial_transactions"
+	numStmtRollbacks   = "statement_rollbacks"
+	numRemoteScans     = "remote_table_scans"
+	numRemoteRows      = "remote_table_rows"
 )
 
+// ErrParameterSetsQuery is returned when a query supplies multiple sets
+// of parameters. Parameter sets are only supported for execution.
+var ErrParameterSetsQuery = errors.New("parameter sets not supported for queries")
+
+// ErrTableNotFound is returned when a table to be dumped does not exist.
+var ErrTableNotFound = errors.New("table not found")
+
 // DBVersion is the SQLite version.
 var DBVersion string
 
+// ManagedTablePrefix begins the name of each table managed by rqlite itself,
+// rather than by users. Such tables are omitted from dumps.
+const ManagedTablePrefix = "_rqlite_"
+
+// IsManagedTable returns whether the named table is managed by rqlite itself.
+func IsManagedTable(name string) bool {
+	return strings.HasPrefix(name, ManagedTablePrefix)
+}
+
 // stats captures stats for the DB layer.
 var stats *expvar.Map
 
@@ -55,6 +78,20 @@ func ResetStats() {
 	stats.Add(numETx, 0)
 	stats.Add(numQTx, 0)
 	stats.Add(numRTx, 0)
+	stats.Add(numDryRuns, 0)
+	stats.Add(numPTx, 0)
+	stats.Add(numStmtRollbacks, 0)
+	stats.Add(numRemoteScans, 0)
+	stats.Add(numRemoteRows, 0)
+	stats.Add(numBusyReads, 0)
+	stats.Add(numBusyReadRetries, 0)
+	stats.Add(numBusyReadFailures, 0)
+	stats.Add(busyReadWait, 0)
+	stats.Add(numBusyWrites, 0)
+	stats.Add(numBusyWriteRetries, 0)
+	stats.Add(numBusyWriteFailures, 0)
+	stats.Add(busyWriteWait, 0)
+	tableStats.Init()
 }
 
 // DB is the SQL database.
@@ -68,6 +105,11 @@ type DB struct {
 
 	rwDSN string // DSN used for read-write connection
 	roDSN string // DSN used for read-only connections
+
+	remotesMu  sync.RWMutex
+	remotes    map[string]*remoteSchema // Remote databases, keyed by schema.
+	remotesGen int
+	remDB      *sql.DB // Database connection for reads of remote databases.
 }
 
 // PoolStats represents connection pool statistics
@@ -108,19 +150,22 @@ func IsValidSQLiteData(b []byte) bool {
 // Open opens a file-based database, creating it if it does not exist. After this
 // function returns, an actual SQLite file will always exist.
 func Open(dbPath string, fkEnabled bool) (*DB, error) {
-	rwDSN := fmt.Sprintf("file:%s?_fk=%s", dbPath, strconv.FormatBool(fkEnabled))
-	rwDB, err := sql.Open("sqlite3", rwDSN)
+	rwOpts := append([]string{
+		fmt.Sprintf("_fk=%s", strconv.FormatBool(fkEnabled)),
+	}, busyTimeoutOpts()...)
+	rwDSN := fmt.Sprintf("file:%s?%s", dbPath, strings.Join(rwOpts, "&"))
+	rwDB, err := sql.Open(driverName, rwDSN)
 	if err != nil {
 		return nil, err
 	}
 
-	roOpts := []string{
+	roOpts := append([]string{
 		"mode=ro",
 		fmt.Sprintf("_fk=%s", strconv.FormatBool(fkEnabled)),
-	}
+	}, busyTimeoutOpts()...)
 
 	roDSN := fmt.Sprintf("file:%s?%s", dbPath, strings.Join(roOpts, "&"))
-	roDB, err := sql.Open("sqlite3", roDSN)
+	roDB, err := sql.Open(driverName, roDSN)
 	if err != nil {
 		return nil, err
 	}
@@ -148,17 +193,21 @@ func Open(dbPath string, fkEnabled bool) (*DB, error) {
 
 // OpenInMemory returns a new in-memory database.
 func OpenInMemory(fkEnabled bool) (*DB, error) {
-	inMemPath := fmt.Sprintf("file:/%s", randomString())
+	return openInMemory(fmt.Sprintf("file:/%s", randomString()), fkEnabled)
+}
 
-	rwOpts := []string{
+// openInMemory opens the in-memory database at inMemPath, creating it if
+// it does not exist.
+func openInMemory(inMemPath string, fkEnabled bool) (*DB, error) {
+	rwOpts := append([]string{
 		"mode=rw",
 		"vfs=memdb",
 		"_txlock=immediate",
 		fmt.Sprintf("_fk=%s", strconv.FormatBool(fkEnabled)),
-	}
+	}, busyTimeoutOpts()...)
 
 	rwDSN := fmt.Sprintf("%s?%s", inMemPath, strings.Join(rwOpts, "&"))
-	rwDB, err := sql.Open("sqlite3", rwDSN)
+	rwDB, err := sql.Open(driverName, rwDSN)
 	if err != nil {
 		return nil, err
 	}
@@ -170,15 +219,15 @@ func OpenInMemory(fkEnabled bool) (*DB, error) {
 	rwDB.SetMaxIdleConns(1)
 	rwDB.SetMaxOpenConns(1)
 
-	roOpts := []string{
+	roOpts := append([]string{
 		"mode=ro",
 		"vfs=memdb",
 		"_txlock=deferred",
 		fmt.Sprintf("_fk=%s", strconv.FormatBool(fkEnabled)),
-	}
+	}, busyTimeoutOpts()...)
 
 	roDSN := fmt.Sprintf("%s?%s", inMemPath, strings.Join(roOpts, "&"))
-	roDB, err := sql.Open("sqlite3", roDSN)
+	roDB, err := sql.Open(driverName, roDSN)
 	if err != nil {
 		return nil, err
 	}
@@ -229,7 +278,7 @@ func LoadIntoMemory(dbPath string, fkEnabled bool) (*DB, error) {
 // until after this function returns.
 func DeserializeIntoMemory(b []byte, fkEnabled bool) (retDB *DB, retErr error) {
 	// Get a plain-ol' in-memory database.
-	tmpDB, err := sql.Open("sqlite3", ":memory:")
+	tmpDB, err := sql.Open(driverName, ":memory:")
 	if err != nil {
 		return nil, fmt.Errorf("DeserializeIntoMemory: %s", err.Error())
 	}
@@ -282,12 +331,47 @@ func DeserializeIntoMemory(b []byte, fkEnabled bool) (retDB *DB, retErr error) {
 
 // Close closes the underlying database connection.
 func (db *DB) Close() error {
+	if err := db.closeRemotePool(); err != nil {
+		return err
+	}
 	if err := db.rwDB.Close(); err != nil {
 		return err
 	}
 	return db.roDB.Close()
 }
 
+// SetFKEnabled enables or disables Foreign Key constraints. Since the setting
+// is made on each connection to the database, the connections are replaced
+// with connections using the new setting. Not safe to call while other
+// operations are happening with the database.
+func (db *DB) SetFKEnabled(enabled bool) error {
+	if enabled == db.fkEnabled {
+		return nil
+	}
+
+	// An in-memory database exists only while a connection to it is open,
+	// so the new connections must be opened before the old are closed.
+	var newDB *DB
+	var err error
+	if db.memory {
+		newDB, err = openInMemory(strings.SplitN(db.rwDSN, "?", 2)[0], enabled)
+	} else {
+		newDB, err = Open(db.path, enabled)
+	}
+	if err != nil {
+		return err
+	}
+	if err := db.Close(); err != nil {
+		newDB.Close()
+		return err
+	}
+	// Remote databases remain attached, so are not replaced.
+	db.fkEnabled = newDB.fkEnabled
+	db.rwDB, db.roDB = newDB.rwDB, newDB.roDB
+	db.rwDSN, db.roDSN = newDB.rwDSN, newDB.roDSN
+	return nil
+}
+
 // Stats returns status and diagnostics for the database.
 func (db *DB) Stats() (map[string]interface{}, error) {
 	copts, err := db.CompileOptions()
@@ -314,6 +398,9 @@ func (db *DB) Stats() (map[string]interface{}, error) {
 		"rw_dsn":          db.rwDSN,
 		"ro_dsn":          db.roDSN,
 		"conn_pool_stats": connPoolStats,
+		"tables":          AllTableStats(),
+		"collations":      Collations(),
+		"icu":             ICUSupported,
 	}
 
 	stats["path"] = db.path
@@ -417,7 +504,7 @@ func (db *DB) ExecuteStringStmt(query string) ([]*command.ExecuteResult, error)
 // Execute executes queries that modify the database.
 func (db *DB) Execute(req *command.Request, xTime bool) ([]*command.ExecuteResult, error) {
 	stats.Add(numExecutions, int64(len(req.Statements)))
-	conn, err := db.rwDB.Conn(context.Background())
+	conn, err := busyConn(db.rwDB, true)
 	if err != nil {
 		return nil, err
 	}
@@ -427,6 +514,7 @@ func (db *DB) Execute(req *command.Request, xTime bool) ([]*command.ExecuteResul
 
 type execer interface {
 	ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error)
+	PrepareContext(ctx context.Context, query string) (*sql.Stmt, error)
 }
 
 func (db *DB) executeWithConn(req *command.Request, xTime bool, conn *sql.Conn) ([]*command.ExecuteResult, error) {
@@ -434,8 +522,12 @@ func (db *DB) executeWithConn(req *command.Request, xTime bool, conn *sql.Conn)
 
 	var execer execer
 	var tx *sql.Tx
-	if req.Transaction {
-		stats.Add(numETx, 1)
+	if req.Transaction || req.Partial {
+		if req.Partial {
+			stats.Add(numPTx, 1)
+		} else {
+			stats.Add(numETx, 1)
+		}
 		tx, err = conn.BeginTx(context.Background(), nil)
 		if err != nil {
 			return nil, err
@@ -449,8 +541,12 @@ func (db *DB) executeWithConn(req *command.Request, xTime bool, conn *sql.Conn)
 	} else {
 		execer = conn
 	}
+	if req.Partial {
+		return db.executePartial(req, xTime, tx)
+	}
 
 	var allResults []*command.ExecuteResult
+	var tableWrites []*tableWrite
 
 	// handleError sets the error field on the given result. It returns
 	// whether the caller should continue processing or break.
@@ -461,6 +557,7 @@ func (db *DB) executeWithConn(req *command.Request, xTime bool, conn *sql.Conn)
 		if tx != nil {
 			tx.Rollback()
 			tx = nil
+			tableWrites = nil
 			return false
 		}
 		return true
@@ -481,15 +578,67 @@ func (db *DB) executeWithConn(req *command.Request, xTime bool, conn *sql.Conn)
 			break
 		}
 		allResults = append(allResults, result)
+		if tw, ok := newTableWrite(stmt, result.RowsAffected); ok {
+			tableWrites = append(tableWrites, tw)
+		}
 	}
 
 	if tx != nil {
 		err = tx.Commit()
 	}
+	if err == nil {
+		recordTableWrites(tableWrites)
+	}
 	return allResults, err
 }
 
+// stmtSavepoint is the savepoint under which each statement of a partial
+// request is executed.
+const stmtSavepoint = "rqlite_stmt"
+
+// executePartial executes each statement of req under its own savepoint of
+// the transaction tx, so that a statement which fails is rolled back alone,
+// while those which succeed are committed together.
+func (db *DB) executePartial(req *command.Request, xTime bool, tx *sql.Tx) ([]*command.ExecuteResult, error) {
+	var allResults []*command.ExecuteResult
+	var tableWrites []*tableWrite
+	for _, stmt := range req.Statements {
+		if stmt.Sql == "" {
+			continue
+		}
+
+		if _, err := tx.ExecContext(context.Background(), "SAVEPOINT "+stmtSavepoint); err != nil {
+			return allResults, err
+		}
+		result, err := db.executeStmtWithConn(stmt, xTime, tx)
+		if err != nil {
+			stats.Add(numExecutionErrors, 1)
+			stats.Add(numStmtRollbacks, 1)
+			if _, err := tx.ExecContext(context.Background(), "ROLLBACK TO "+stmtSavepoint); err != nil {
+				// SQLite rolls back the entire transaction after some errors.
+				return allResults, fmt.Errorf("failed to roll back statement: %s", err.Error())
+			}
+		} else if tw, ok := newTableWrite(stmt, result.RowsAffected); ok {
+			tableWrites = append(tableWrites, tw)
+		}
+		if _, err := tx.ExecContext(context.Background(), "RELEASE "+stmtSavepoint); err != nil {
+			return allResults, err
+		}
+		allResults = append(allResults, result)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return allResults, err
+	}
+	recordTableWrites(tableWrites)
+	return allResults, nil
+}
+
 func (db *DB) executeStmtWithConn(stmt *command.Statement, xTime bool, e execer) (*command.ExecuteResult, error) {
+	if len(stmt.ParameterSets) > 0 {
+		return db.executeBulkStmtWithConn(stmt, xTime, e)
+	}
+
 	result := &command.ExecuteResult{}
 	start := time.Now()
 
@@ -499,7 +648,12 @@ func (db *DB) executeStmtWithConn(stmt *command.Statement, xTime bool, e execer)
 		return result, nil
 	}
 
-	r, err := e.ExecContext(context.Background(), stmt.Sql, parameters...)
+	var r sql.Result
+	err = retryBusy(true, stmt.Sql, func() error {
+		var err error
+		r, err = e.ExecContext(context.Background(), stmt.Sql, parameters...)
+		return err
+	})
 	if err != nil {
 		result.Error = err.Error()
 		return result, err
@@ -528,6 +682,60 @@ func (db *DB) executeStmtWithConn(stmt *command.Statement, xTime bool, e execer)
 	return result, nil
 }
 
+// executeBulkStmtWithConn prepares the statement once, and then executes it
+// for each set of parameters. Rows affected is the total across all sets, and
+// the last insert ID is that of the final execution.
+func (db *DB) executeBulkStmtWithConn(stmt *command.Statement, xTime bool, e execer) (*command.ExecuteResult, error) {
+	result := &command.ExecuteResult{}
+	start := time.Now()
+
+	ps, err := e.PrepareContext(context.Background(), stmt.Sql)
+	if err != nil {
+		result.Error = err.Error()
+		return result, err
+	}
+	defer ps.Close()
+
+	for i := range stmt.ParameterSets {
+		parameters, err := parametersToValues(stmt.ParameterSets[i].Parameters)
+		if err != nil {
+			result.Error = err.Error()
+			return result, nil
+		}
+
+		var r sql.Result
+		err = retryBusy(true, stmt.Sql, func() error {
+			var err error
+			r, err = ps.ExecContext(context.Background(), parameters...)
+			return err
+		})
+		if err != nil {
+			err = fmt.Errorf("parameter set %d: %s", i, err.Error())
+			result.Error = err.Error()
+			return result, err
+		}
+
+		lid, err := r.LastInsertId()
+		if err != nil {
+			result.Error = err.Error()
+			return result, err
+		}
+		result.LastInsertId = lid
+
+		ra, err := r.RowsAffected()
+		if err != nil {
+			result.Error = err.Error()
+			return result, err
+		}
+		result.RowsAffected += ra
+	}
+
+	if xTime {
+		result.Time = time.Since(start).Seconds()
+	}
+	return result, nil
+}
+
 // QueryStringStmt executes a single query that return rows, but don't modify database.
 func (db *DB) QueryStringStmt(query string) ([]*command.QueryRows, error) {
 	r := &command.Request{
@@ -543,7 +751,7 @@ func (db *DB) QueryStringStmt(query string) ([]*command.QueryRows, error) {
 // Query executes queries that return rows, but don't modify the database.
 func (db *DB) Query(req *command.Request, xTime bool) ([]*command.QueryRows, error) {
 	stats.Add(numQueries, int64(len(req.Statements)))
-	conn, err := db.roDB.Conn(context.Background())
+	conn, err := busyConn(db.roDB, false)
 	if err != nil {
 		return nil, err
 	}
@@ -582,7 +790,7 @@ func (db *DB) queryWithConn(req *command.Request, xTime bool, conn *sql.Conn) ([
 		var rows *command.QueryRows
 		var err error
 
-		readOnly, err := db.StmtReadOnly(sql)
+		readOnly, err := stmtReadOnlyWithConn(sql, conn)
 		if err != nil {
 			stats.Add(numQueryErrors, 1)
 			rows = &command.QueryRows{
@@ -620,6 +828,12 @@ func (db *DB) queryStmtWithConn(stmt *command.Statement, xTime bool, q queryer)
 	rows := &command.QueryRows{}
 	start := time.Now()
 
+	if len(stmt.ParameterSets) > 0 {
+		stats.Add(numQueryErrors, 1)
+		rows.Error = ErrParameterSetsQuery.Error()
+		return rows, nil
+	}
+
 	parameters, err := parametersToValues(stmt.Parameters)
 	if err != nil {
 		stats.Add(numQueryErrors, 1)
@@ -627,28 +841,72 @@ func (db *DB) queryStmtWithConn(stmt *command.Statement, xTime bool, q queryer)
 		return rows, nil
 	}
 
-	rs, err := q.QueryContext(context.Background(), stmt.Sql, parameters...)
-	if err != nil {
+	var columns, types []string
+	var values []*command.Values
+	err = retryBusy(false, stmt.Sql, func() error {
+		var err error
+		columns, types, values, err = readRows(q, stmt.Sql, parameters)
+		return err
+	})
+	var se *statementError
+	if errors.As(err, &se) {
 		stats.Add(numQueryErrors, 1)
-		rows.Error = err.Error()
+		rows.Values = values
+		rows.Error = se.Error()
 		return rows, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	if xTime {
+		rows.Time = time.Since(start).Seconds()
+	}
+
+	rows.Columns = columns
+	rows.Types = types
+	rows.Values = values
+	return rows, nil
+}
+
+// statementError is an error executing a statement, as opposed to an error
+// reading its results.
+type statementError struct {
+	err error
+}
+
+func (e *statementError) Error() string {
+	return e.err.Error()
+}
+
+func (e *statementError) Unwrap() error {
+	return e.err
+}
+
+// readRows executes the query, returning the columns, column types and
+// values of the rows it returns. If executing the query fails, the error is
+// a *statementError, and any rows read before the failure are returned.
+func readRows(q queryer, query string, parameters []interface{}) ([]string, []string, []*command.Values, error) {
+	rs, err := q.QueryContext(context.Background(), query, parameters...)
+	if err != nil {
+		return nil, nil, nil, &statementError{err}
 	}
 	defer rs.Close()
 
 	columns, err := rs.Columns()
 	if err != nil {
-		return nil, err
+		return nil, nil, nil, err
 	}
 
 	types, err := rs.ColumnTypes()
 	if err != nil {
-		return nil, err
+		return nil, nil, nil, err
 	}
 	xTypes := make([]string, len(types))
 	for i := range types {
 		xTypes[i] = strings.ToLower(types[i].DatabaseTypeName())
 	}
 
+	var values []*command.Values
 	for rs.Next() {
 		dest := make([]interface{}, len(columns))
 		ptrs := make([]interface{}, len(dest))
@@ -656,31 +914,22 @@ func (db *DB) queryStmtWithConn(stmt *command.Statement, xTime bool, q queryer)
 			ptrs[i] = &dest[i]
 		}
 		if err := rs.Scan(ptrs...); err != nil {
-			return nil, err
+			return nil, nil, nil, err
 		}
 		params, err := normalizeRowValues(dest, xTypes)
 		if err != nil {
-			return nil, err
+			return nil, nil, nil, err
 		}
-		rows.Values = append(rows.Values, &command.Values{
+		values = append(values, &command.Values{
 			Parameters: params,
 		})
 	}
 
 	// Check for errors from iterating over rows.
 	if err := rs.Err(); err != nil {
-		stats.Add(numQueryErrors, 1)
-		rows.Error = err.Error()
-		return rows, nil
+		return nil, nil, values, &statementError{err}
 	}
-
-	if xTime {
-		rows.Time = time.Since(start).Seconds()
-	}
-
-	rows.Columns = columns
-	rows.Types = xTypes
-	return rows, nil
+	return columns, xTypes, values, nil
 }
 
 // RequestStringStmts processes a request that can contain both executes and queries.
@@ -697,7 +946,7 @@ func (db *DB) RequestStringStmts(stmts []string) ([]*command.ExecuteQueryRespons
 // Request processes a request that can contain both executes and queries.
 func (db *DB) Request(req *command.Request, xTime bool) ([]*command.ExecuteQueryResponse, error) {
 	stats.Add(numRequests, int64(len(req.Statements)))
-	conn, err := db.rwDB.Conn(context.Background())
+	conn, err := busyConn(db.rwDB, true)
 	if err != nil {
 		return nil, err
 	}
@@ -720,12 +969,15 @@ func (db *DB) Request(req *command.Request, xTime bool) ([]*command.ExecuteQuery
 		execer = conn
 	}
 
+	var tableWrites []*tableWrite
+
 	// abortOnError indicates whether the caller should continue
 	// processing or break.
 	abortOnError := func(err error) bool {
 		if err != nil && tx != nil {
 			tx.Rollback()
 			tx = nil
+			tableWrites = nil
 			return true
 		}
 		return false
@@ -760,12 +1012,20 @@ func (db *DB) Request(req *command.Request, xTime bool) ([]*command.ExecuteQuery
 			if abortOnError(opErr) {
 				break
 			}
+			if opErr == nil {
+				if tw, ok := newTableWrite(stmt, result.RowsAffected); ok {
+					tableWrites = append(tableWrites, tw)
+				}
+			}
 		}
 	}
 
 	if tx != nil {
 		err = tx.Commit()
 	}
+	if err == nil {
+		recordTableWrites(tableWrites)
+	}
 	return eqResponse, err
 }
 
@@ -864,7 +1124,7 @@ func (db *DB) Dump(w io.Writer) error {
 			stmt = `DELETE FROM "sqlite_sequence";`
 		} else if table == "sqlite_stat1" {
 			stmt = `ANALYZE "sqlite_master";`
-		} else if strings.HasPrefix(table, "sqlite_") {
+		} else if strings.HasPrefix(table, "sqlite_") || IsManagedTable(table) {
 			continue
 		} else {
 			stmt = v.Parameters[2].GetS()
@@ -923,10 +1183,97 @@ func (db *DB) Dump(w io.Writer) error {
 	return nil
 }
 
+// DumpTable returns the SQL statements which recreate a single table: its
+// schema, its rows, and its indexes and triggers. Other objects, including
+// views which select from the table, are not included.
+func (db *DB) DumpTable(table string) ([]string, error) {
+	conn, err := db.roDB.Conn(context.Background())
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	// Convenience function to convert a query, with a single string
+	// parameter, to protobuf.
+	commReq := func(query, param string) *command.Request {
+		stmt := &command.Statement{Sql: query}
+		if param != "" {
+			stmt.Parameters = []*command.Parameter{
+				{Value: &command.Parameter_S{S: param}},
+			}
+		}
+		return &command.Request{Statements: []*command.Statement{stmt}}
+	}
+	queryOne := func(query, param string) (*command.QueryRows, error) {
+		rows, err := db.queryWithConn(commReq(query, param), false, conn)
+		if err != nil {
+			return nil, err
+		}
+		if rows[0].Error != "" {
+			return nil, errors.New(rows[0].Error)
+		}
+		return rows[0], nil
+	}
+
+	if strings.HasPrefix(strings.ToLower(table), "sqlite_") {
+		return nil, ErrTableNotFound
+	}
+	row, err := queryOne(`SELECT "sql" FROM "sqlite_master" WHERE "type" == 'table' AND "name" == ?`, table)
+	if err != nil {
+		return nil, err
+	}
+	if len(row.Values) == 0 {
+		return nil, ErrTableNotFound
+	}
+	stmts := []string{row.Values[0].Parameters[0].GetS()}
+
+	tableIdent := strings.Replace(table, `"`, `""`, -1)
+	r, err := queryOne(fmt.Sprintf(`PRAGMA table_info("%s")`, tableIdent), "")
+	if err != nil {
+		return nil, err
+	}
+	var columnNames []string
+	for _, w := range r.Values {
+		columnNames = append(columnNames, fmt.Sprintf(`'||quote("%s")||'`,
+			strings.Replace(w.Parameters[1].GetS(), `"`, `""`, -1)))
+	}
+	r, err = queryOne(fmt.Sprintf(`SELECT 'INSERT INTO "%s" VALUES(%s)' FROM "%s"`,
+		strings.Replace(tableIdent, `'`, `''`, -1),
+		strings.Join(columnNames, ","),
+		tableIdent), "")
+	if err != nil {
+		return nil, err
+	}
+	for _, x := range r.Values {
+		stmts = append(stmts, x.Parameters[0].GetS())
+	}
+
+	r, err = queryOne(`SELECT "sql" FROM "sqlite_master"
+			  WHERE "sql" NOT NULL AND "type" IN ('index', 'trigger') AND "tbl_name" == ?`, table)
+	if err != nil {
+		return nil, err
+	}
+	for _, v := range r.Values {
+		stmts = append(stmts, v.Parameters[0].GetS())
+	}
+	return stmts, nil
+}
+
 // StmtReadOnly returns whether the given SQL statement is read-only.
 // As per https://www.sqlite.org/c3ref/stmt_readonly.html, this function
 // may not return 100% correct results, but should cover most scenarios.
 func (db *DB) StmtReadOnly(sql string) (bool, error) {
+	conn, err := busyConn(db.roDB, false)
+	if err != nil {
+		return false, err
+	}
+	defer conn.Close()
+	return stmtReadOnlyWithConn(sql, conn)
+}
+
+// stmtReadOnlyWithConn returns whether the given SQL statement is read-only,
+// preparing it with the given connection.
+func stmtReadOnlyWithConn(sql string, conn *sql.Conn) (bool, error) {
 	var readOnly bool
 	f := func(driverConn interface{}) error {
 		c := driverConn.(*sqlite3.SQLiteConn)
@@ -940,12 +1287,7 @@ func (db *DB) StmtReadOnly(sql string) (bool, error) {
 		return nil
 	}
 
-	conn, err := db.roDB.Conn(context.Background())
-	if err != nil {
-		return false, err
-	}
-	defer conn.Close()
-	if err := conn.Raw(f); err != nil {
+	if err := retryBusy(false, sql, func() error { return conn.Raw(f) }); err != nil {
 		return false, err
 	}
 	return readOnly, nil
@@ -1120,8 +1462,10 @@ func normalizeRowValues(row []interface{}, types []string) ([]*command.Parameter
 			}
 		case []byte:
 			if isTextType(types[i]) {
-				values[i].Value = &command.Parameter_S{
-					S: string(val),
+				values[i] = &command.Parameter{
+					Value: &command.Parameter_S{
+						S: string(val),
+					},
 				}
 			} else {
 				values[i] = &command.Parameter{
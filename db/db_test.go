@@ -3,10 +3,12 @@ package db
 import (
 	"database/sql"
 	"errors"
+	"expvar"
 	"fmt"
 	"io/ioutil"
 	"os"
 	"path"
+	"reflect"
 	"strings"
 	"sync"
 	"testing"
@@ -219,6 +221,60 @@ func Test_TableCreationInMemoryFK(t *testing.T) {
 	}
 }
 
+// Test_SetFKEnabled ensures foreign key constraints can be enabled and
+// disabled on an open database, without losing its contents.
+func Test_SetFKEnabled(t *testing.T) {
+	onDisk, path := mustCreateDatabase()
+	defer os.Remove(path)
+
+	for _, db := range []*DB{mustCreateInMemoryDatabase(), onDisk} {
+		defer db.Close()
+		for _, stmt := range []string{
+			"CREATE TABLE foo (id INTEGER NOT NULL PRIMARY KEY, name TEXT)",
+			"CREATE TABLE bar (fooid INTEGER NOT NULL PRIMARY KEY, FOREIGN KEY(fooid) REFERENCES foo(id))",
+		} {
+			if _, err := db.ExecuteStringStmt(stmt); err != nil {
+				t.Fatalf("failed to create table: %s", err.Error())
+			}
+		}
+
+		if err := db.SetFKEnabled(true); err != nil {
+			t.Fatalf("failed to enable FK constraints: %s", err.Error())
+		}
+		if !db.FKEnabled() {
+			t.Fatal("FK constraints not marked as enabled")
+		}
+		r, err := db.ExecuteStringStmt("INSERT INTO bar(fooid) VALUES(1)")
+		if err != nil {
+			t.Fatalf("failed to insert record: %s", err.Error())
+		}
+		if exp, got := `[{"error":"FOREIGN KEY constraint failed"}]`, asJSON(r); exp != got {
+			t.Fatalf("unexpected results for insert, expected %s, got %s", exp, got)
+		}
+		q, err := db.QueryStringStmt("PRAGMA foreign_keys")
+		if err != nil {
+			t.Fatalf("failed to query FK setting: %s", err.Error())
+		}
+		if exp, got := `[{"columns":["foreign_keys"],"types":[""],"values":[[1]]}]`, asJSON(q); exp != got {
+			t.Fatalf("unexpected results for query, expected %s, got %s", exp, got)
+		}
+
+		if err := db.SetFKEnabled(false); err != nil {
+			t.Fatalf("failed to disable FK constraints: %s", err.Error())
+		}
+		if db.FKEnabled() {
+			t.Fatal("FK constraints marked as enabled")
+		}
+		r, err = db.ExecuteStringStmt("INSERT INTO bar(fooid) VALUES(1)")
+		if err != nil {
+			t.Fatalf("failed to insert record: %s", err.Error())
+		}
+		if exp, got := `[{"last_insert_id":1,"rows_affected":1}]`, asJSON(r); exp != got {
+			t.Fatalf("unexpected results for insert, expected %s, got %s", exp, got)
+		}
+	}
+}
+
 func Test_SQLiteMasterTable(t *testing.T) {
 	db, path := mustCreateDatabase()
 	defer db.Close()
@@ -1012,6 +1068,86 @@ func Test_SimpleTwoParameterizedStatements(t *testing.T) {
 	}
 }
 
+func Test_SimpleParameterSetsStatements(t *testing.T) {
+	db, path := mustCreateDatabase()
+	defer db.Close()
+	defer os.Remove(path)
+
+	_, err := db.ExecuteStringStmt("CREATE TABLE foo (id INTEGER NOT NULL PRIMARY KEY, name TEXT)")
+	if err != nil {
+		t.Fatalf("failed to create table: %s", err.Error())
+	}
+
+	names := []string{"fiona", "sinead", "declan"}
+	stmt := &command.Statement{
+		Sql: "INSERT INTO foo(name) VALUES(?)",
+	}
+	for _, n := range names {
+		stmt.ParameterSets = append(stmt.ParameterSets, &command.Values{
+			Parameters: []*command.Parameter{
+				{
+					Value: &command.Parameter_S{
+						S: n,
+					},
+				},
+			},
+		})
+	}
+	req := &command.Request{
+		Statements: []*command.Statement{stmt},
+	}
+
+	r, err := db.Execute(req, false)
+	if err != nil {
+		t.Fatalf("failed to insert records: %s", err.Error())
+	}
+	if exp, got := `[{"last_insert_id":3,"rows_affected":3}]`, asJSON(r); exp != got {
+		t.Fatalf("unexpected results for execute\nexp: %s\ngot: %s", exp, got)
+	}
+
+	q, err := db.QueryStringStmt(`SELECT * FROM foo`)
+	if err != nil {
+		t.Fatalf("failed to query table: %s", err.Error())
+	}
+	if exp, got := `[{"columns":["id","name"],"types":["integer","text"],"values":[[1,"fiona"],[2,"sinead"],[3,"declan"]]}]`, asJSON(q); exp != got {
+		t.Fatalf("unexpected results for query\nexp: %s\ngot: %s", exp, got)
+	}
+
+	// An error in any set should roll back the whole request, if a transaction.
+	stmt.Sql = "INSERT INTO foo(id, name) VALUES(4, ?)"
+	req.Transaction = true
+	r, err = db.Execute(req, false)
+	if err != nil {
+		t.Fatalf("failed to execute request: %s", err.Error())
+	}
+	if exp, got := `[{"last_insert_id":4,"rows_affected":1,"error":"parameter set 1: UNIQUE constraint failed: foo.id"}]`, asJSON(r); exp != got {
+		t.Fatalf("unexpected results for execute\nexp: %s\ngot: %s", exp, got)
+	}
+	q, err = db.QueryStringStmt(`SELECT COUNT(*) FROM foo`)
+	if err != nil {
+		t.Fatalf("failed to query table: %s", err.Error())
+	}
+	if exp, got := `[{"columns":["COUNT(*)"],"types":[""],"values":[[3]]}]`, asJSON(q); exp != got {
+		t.Fatalf("unexpected results for query\nexp: %s\ngot: %s", exp, got)
+	}
+
+	// Parameter sets are not supported for queries.
+	q, err = db.Query(&command.Request{
+		Statements: []*command.Statement{
+			{
+				Sql:           "SELECT * FROM foo WHERE name=?",
+				ParameterSets: stmt.ParameterSets,
+			},
+		},
+	}, false)
+	if err != nil {
+		t.Fatalf("failed to query table: %s", err.Error())
+	}
+	if exp, got := `[{"error":"parameter sets not supported for queries"}]`, asJSON(q); exp != got {
+		t.Fatalf("unexpected results for query\nexp: %s\ngot: %s", exp, got)
+	}
+}
+
 func Test_SimpleNilParameterizedStatements(t *testing.T) {
 	db, path := mustCreateDatabase()
 	defer db.Close()
@@ -1565,6 +1701,65 @@ func Test_PartialFailTransaction(t *testing.T) {
 	}
 }
 
+func Test_PartialExecute(t *testing.T) {
+	db, path := mustCreateDatabase()
+	defer db.Close()
+	defer os.Remove(path)
+
+	_, err := db.ExecuteStringStmt("CREATE TABLE foo (id INTEGER NOT NULL PRIMARY KEY, name TEXT)")
+	if err != nil {
+		t.Fatalf("failed to create table: %s", err.Error())
+	}
+
+	ResetStats()
+	req := &command.Request{
+		Partial: true,
+		Statements: []*command.Statement{
+			{
+				Sql: `INSERT INTO foo(id, name) VALUES(1, "fiona")`,
+			},
+			{
+				Sql: `INSERT INTO foo(id, name) VALUES(2, "fiona"), (1, "declan")`,
+			},
+			{
+				Sql: `INSERT INTO foo(id, name) VALUES(3, "fiona")`,
+			},
+		},
+	}
+	r, err := db.Execute(req, false)
+	if err != nil {
+		t.Fatalf("failed to insert records: %s", err.Error())
+	}
+	if exp, got := `[{"last_insert_id":1,"rows_affected":1},{"error":"UNIQUE constraint failed: foo.id"},{"last_insert_id":3,"rows_affected":1}]`, asJSON(r); exp != got {
+		t.Fatalf("unexpected results for execute\nexp: %s\ngot: %s", exp, got)
+	}
+	ro, err := db.QueryStringStmt(`SELECT * FROM foo`)
+	if err != nil {
+		t.Fatalf("failed to query table: %s", err.Error())
+	}
+	if exp, got := `[{"columns":["id","name"],"types":["integer","text"],"values":[[1,"fiona"],[3,"fiona"]]}]`, asJSON(ro); exp != got {
+		t.Fatalf("unexpected results for query\nexp: %s\ngot: %s", exp, got)
+	}
+	if exp, got := int64(1), stats.Get(numPTx).(*expvar.Int).Value(); exp != got {
+		t.Fatalf("unexpected number of partial transactions, exp %d, got %d", exp, got)
+	}
+	if exp, got := int64(1), stats.Get(numStmtRollbacks).(*expvar.Int).Value(); exp != got {
+		t.Fatalf("unexpected number of statement rollbacks, exp %d, got %d", exp, got)
+	}
+
+	// No transaction remains open afterwards.
+	r, err = db.ExecuteStringStmt("BEGIN")
+	if err != nil {
+		t.Fatalf("failed to begin transaction: %s", err.Error())
+	}
+	if r[0].Error != "" {
+		t.Fatalf("failed to begin transaction after partial execute: %s", r[0].Error)
+	}
+	if _, err := db.ExecuteStringStmt("ROLLBACK"); err != nil {
+		t.Fatalf("failed to roll back transaction: %s", err.Error())
+	}
+}
+
 func Test_Backup(t *testing.T) {
 	db, path := mustCreateDatabase()
 	defer db.Close()
@@ -1821,6 +2016,33 @@ func Test_Dump(t *testing.T) {
 	}
 }
 
+func Test_DumpManagedTable(t *testing.T) {
+	db, path := mustCreateDatabase()
+	defer db.Close()
+	defer os.Remove(path)
+
+	dump := `PRAGMA foreign_keys=OFF;
+BEGIN TRANSACTION;
+CREATE TABLE foo (id integer not null primary key, name text);
+INSERT INTO "foo" VALUES(1,'fiona');
+COMMIT;
+`
+	if _, err := db.ExecuteStringStmt(dump); err != nil {
+		t.Fatalf("failed to load dump: %s", err.Error())
+	}
+	if _, err := db.ExecuteStringStmt(`CREATE TABLE ` + ManagedTablePrefix + `bar (id integer)`); err != nil {
+		t.Fatalf("failed to create managed table: %s", err.Error())
+	}
+
+	var b strings.Builder
+	if err := db.Dump(&b); err != nil {
+		t.Fatalf("failed to dump database: %s", err.Error())
+	}
+	if b.String() != dump {
+		t.Fatalf("managed table included in dump: %s", b.String())
+	}
+}
+
 func Test_DumpMemory(t *testing.T) {
 	db, path := mustCreateDatabase()
 	defer db.Close()
@@ -1846,6 +2068,47 @@ func Test_DumpMemory(t *testing.T) {
 	}
 }
 
+func Test_DumpTable(t *testing.T) {
+	db := mustCreateInMemoryDatabase()
+	defer db.Close()
+
+	mustExecute(db, `CREATE TABLE foo (id INTEGER NOT NULL PRIMARY KEY, "it's" TEXT)`)
+	mustExecute(db, `CREATE INDEX foo_idx ON foo("it's")`)
+	mustExecute(db, `CREATE TABLE bar (id INTEGER NOT NULL PRIMARY KEY)`)
+	mustExecute(db, `CREATE TRIGGER bar_trig AFTER INSERT ON bar BEGIN DELETE FROM foo; END`)
+	mustExecute(db, `INSERT INTO bar VALUES(1)`)
+	mustExecute(db, `INSERT INTO foo VALUES(1, 'fiona'), (2, NULL)`)
+
+	stmts, err := db.DumpTable("foo")
+	if err != nil {
+		t.Fatalf("failed to dump table: %s", err.Error())
+	}
+	exp := []string{
+		`CREATE TABLE foo (id INTEGER NOT NULL PRIMARY KEY, "it's" TEXT)`,
+		`INSERT INTO "foo" VALUES(1,'fiona')`,
+		`INSERT INTO "foo" VALUES(2,NULL)`,
+		`CREATE INDEX foo_idx ON foo("it's")`,
+	}
+	if !reflect.DeepEqual(exp, stmts) {
+		t.Fatalf("wrong statements for table\nexp: %v\ngot: %v", exp, stmts)
+	}
+
+	// The trigger is on bar, so is dumped with it, though it changes foo.
+	stmts, err = db.DumpTable("bar")
+	if err != nil {
+		t.Fatalf("failed to dump table: %s", err.Error())
+	}
+	if len(stmts) != 3 || !strings.HasPrefix(stmts[2], "CREATE TRIGGER bar_trig") {
+		t.Fatalf("wrong statements for table: %v", stmts)
+	}
+
+	for _, table := range []string{"qux", "sqlite_master"} {
+		if _, err := db.DumpTable(table); err != ErrTableNotFound {
+			t.Fatalf("dumping table %s returned wrong error: %v", table, err)
+		}
+	}
+}
+
 // Test_1GiBInMemory tests that in-memory databases larger than 1GiB,
 // but smaller than 2GiB, can be created without issue.
 func Test_1GiBInMemory(t *testing.T) {
@@ -2013,6 +2276,42 @@ func Test_DBSTAT_table(t *testing.T) {
 	}
 }
 
+func Test_JSONColumnType(t *testing.T) {
+	db := mustCreateInMemoryDatabase()
+	defer db.Close()
+
+	_, err := db.ExecuteStringStmt("CREATE TABLE doc (id INTEGER, body JSON, bin JSONB)")
+	if err != nil {
+		t.Fatalf("failed to create table: %s", err.Error())
+	}
+	_, err = db.ExecuteStringStmt(`INSERT INTO doc VALUES(1, json('{"a": [1, 2]}'), '{"b":1}')`)
+	if err != nil {
+		t.Fatalf("failed to insert JSON record: %s", err.Error())
+	}
+	q, err := db.QueryStringStmt("SELECT * FROM doc")
+	if err != nil {
+		t.Fatalf("failed to query JSON record: %s", err.Error())
+	}
+	if exp, got := `[{"columns":["id","body","bin"],"types":["integer","json","jsonb"],"values":[[1,"{\"a\":[1,2]}","{\"b\":1}"]]}]`, asJSON(q); exp != got {
+		t.Fatalf("unexpected results for JSON query, expected %s, got %s", exp, got)
+	}
+}
+
+func Test_BlobInTextColumn(t *testing.T) {
+	db := mustCreateInMemoryDatabase()
+	defer db.Close()
+
+	mustExecute(db, `CREATE TABLE foo (c0 TEXT, c1)`)
+	mustExecute(db, `INSERT INTO foo VALUES (x'6669', x'6f6e61')`)
+	r, err := db.QueryStringStmt(`SELECT * FROM foo`)
+	if err != nil {
+		t.Fatalf("failed to query table: %s", err.Error())
+	}
+	if exp, got := `[{"columns":["c0","c1"],"types":["text",""],"values":[["fi","ona"]]}]`, asJSON(r); exp != got {
+		t.Fatalf("unexpected results for query\nexp: %s\ngot: %s", exp, got)
+	}
+}
+
 func Test_JSON1(t *testing.T) {
 	db := mustCreateInMemoryDatabase()
 	defer db.Close()
@@ -2060,11 +2359,17 @@ func Test_TableCreationInMemoryLoadRaw(t *testing.T) {
 		t.Fatalf("failed to create table: %s", err.Error())
 	}
 
+	// The goroutine must have exited before the test returns, so its writes
+	// aren't seen by later tests.
 	done := make(chan struct{})
+	var wg sync.WaitGroup
+	defer wg.Wait()
 	defer close(done)
 
 	// Insert some records continually, as fast as possible. Do it from a goroutine.
+	wg.Add(1)
 	go func() {
+		defer wg.Done()
 		for {
 			select {
 			case <-done:
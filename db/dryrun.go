@@ -0,0 +1,78 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+
+	"github.com/rqlite/go-sqlite3"
+	"github.com/rqlite/rqlite/command"
+)
+
+// DryRun executes the statements of req within a transaction which is always
+// rolled back, returning the results they would have had, so that they can be
+// checked against the database without changing it. If req is a transaction,
+// and not partial, execution stops at the first statement which fails, as it
+// would otherwise.
+//
+// Statements whose effects a rollback would not undo -- those which control
+// transactions, set pragmas, or attach databases -- fail without executing.
+// The transaction holds the write lock on the database once any statement
+// writes, so that other writes wait until the dry run completes.
+func (db *DB) DryRun(req *command.Request, xTime bool) ([]*command.ExecuteResult, error) {
+	stats.Add(numDryRuns, 1)
+	conn, err := busyConn(db.rwDB, true)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	tx, err := conn.BeginTx(context.Background(), nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	// The authorizer must be removed before the rollback, which it would deny.
+	if err := setAuthorizer(conn, dryRunAuthorizer); err != nil {
+		return nil, err
+	}
+	defer setAuthorizer(conn, nil)
+
+	var allResults []*command.ExecuteResult
+	for _, stmt := range req.Statements {
+		if stmt.Sql == "" {
+			continue
+		}
+		result, err := db.executeStmtWithConn(stmt, xTime, tx)
+		allResults = append(allResults, result)
+		if err != nil && req.Transaction && !req.Partial {
+			break
+		}
+	}
+	if err := setAuthorizer(conn, nil); err != nil {
+		return nil, err
+	}
+	if err := tx.Rollback(); err != nil {
+		return nil, fmt.Errorf("failed to roll back dry run: %s", err.Error())
+	}
+	return allResults, nil
+}
+
+// dryRunAuthorizer denies the operations whose effects would outlast the
+// rollback of a dry run.
+func dryRunAuthorizer(op int, arg1, arg2, arg3 string) int {
+	switch op {
+	case sqlite3.SQLITE_TRANSACTION, sqlite3.SQLITE_PRAGMA, sqlite3.SQLITE_ATTACH, sqlite3.SQLITE_DETACH:
+		return sqlite3.SQLITE_DENY
+	}
+	return sqlite3.SQLITE_OK
+}
+
+// setAuthorizer sets the authorizer of conn, removing any if f is nil.
+func setAuthorizer(conn *sql.Conn, f func(int, string, string, string) int) error {
+	return conn.Raw(func(driverConn interface{}) error {
+		driverConn.(*sqlite3.SQLiteConn).RegisterAuthorizer(f)
+		return nil
+	})
+}
@@ -0,0 +1,80 @@
+package db
+
+import (
+	"os"
+	"testing"
+
+	"github.com/rqlite/rqlite/command"
+)
+
+func Test_DryRun(t *testing.T) {
+	for _, inmem := range []bool{false, true} {
+		var db *DB
+		if inmem {
+			db = mustCreateInMemoryDatabase()
+		} else {
+			var path string
+			db, path = mustCreateDatabase()
+			defer os.Remove(path)
+		}
+		defer db.Close()
+
+		mustExecute(db, `CREATE TABLE foo (id INTEGER NOT NULL PRIMARY KEY, name TEXT)`)
+		mustExecute(db, `INSERT INTO foo(id, name) VALUES(1, 'fiona'), (2, 'declan')`)
+
+		dryRun := func(tx bool, stmts ...string) []*command.ExecuteResult {
+			t.Helper()
+			req := &command.Request{Transaction: tx}
+			for _, s := range stmts {
+				req.Statements = append(req.Statements, &command.Statement{Sql: s})
+			}
+			results, err := db.DryRun(req, false)
+			if err != nil {
+				t.Fatalf("failed to dry run: %s", err.Error())
+			}
+			return results
+		}
+
+		results := dryRun(false,
+			`ALTER TABLE foo ADD COLUMN age INTEGER`,
+			`UPDATE foo SET age = 1`,
+			`INSERT INTO foo(id, name) VALUES(1, 'fiona')`,
+			`DELETE FROM foo`)
+		if exp, got := `[{"last_insert_id":2,"rows_affected":2},{"last_insert_id":2,"rows_affected":2},{"error":"UNIQUE constraint failed: foo.id"},{"last_insert_id":2,"rows_affected":2}]`, asJSON(results); exp != got {
+			t.Fatalf("wrong dry run results\nexp: %s\ngot: %s", exp, got)
+		}
+
+		// A transaction stops at the first failure.
+		results = dryRun(true, `INSERT INTO bar(id) VALUES(1)`, `DELETE FROM foo`)
+		if exp, got := `[{"error":"no such table: bar"}]`, asJSON(results); exp != got {
+			t.Fatalf("wrong dry run results\nexp: %s\ngot: %s", exp, got)
+		}
+
+		// Statements which would outlast the rollback are refused.
+		results = dryRun(false, `COMMIT`, `PRAGMA user_version = 7`, `DELETE FROM foo; COMMIT`)
+		for i, r := range results {
+			if r.Error != "not authorized" {
+				t.Fatalf("statement %d not refused: %v", i, r)
+			}
+		}
+
+		// Nothing changed.
+		r, err := db.QueryStringStmt(`SELECT * FROM foo`)
+		if err != nil {
+			t.Fatalf("failed to query table: %s", err.Error())
+		}
+		if exp, got := `[{"columns":["id","name"],"types":["integer","text"],"values":[[1,"fiona"],[2,"declan"]]}]`, asJSON(r); exp != got {
+			t.Fatalf("database changed by dry run\nexp: %s\ngot: %s", exp, got)
+		}
+		r, err = db.QueryStringStmt(`PRAGMA user_version`)
+		if err != nil {
+			t.Fatalf("failed to query user version: %s", err.Error())
+		}
+		if exp, got := `[{"columns":["user_version"],"types":[""],"values":[[0]]}]`, asJSON(r); exp != got {
+			t.Fatalf("user version changed by dry run\nexp: %s\ngot: %s", exp, got)
+		}
+
+		// The connection is usable as normal afterwards.
+		mustExecute(db, `BEGIN; DELETE FROM foo WHERE id = 2; COMMIT`)
+	}
+}
@@ -0,0 +1,311 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/rqlite/rqlite/command"
+)
+
+// remoteModule is the name of the virtual table module through which the
+// tables of remote databases are read.
+const remoteModule = "rqlite_remote"
+
+var (
+	// ErrRemoteTablesUnsupported is returned when remote databases are
+	// attached, but this build of rqlite does not support virtual tables.
+	ErrRemoteTablesUnsupported = errors.New("remote tables require rqlite built with the sqlite_vtable tag")
+
+	// ErrRemoteName is returned when the name of a remote database may not
+	// be used as the name of a schema.
+	ErrRemoteName = errors.New("invalid remote database name")
+)
+
+// remoteName matches the names permitted for the schemas of remote databases.
+var remoteName = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// IsValidRemoteName returns whether name may be used as the name of the
+// schema of a remote database.
+func IsValidRemoteName(name string) bool {
+	return remoteName.MatchString(name) && !strings.EqualFold(name, "main") && !strings.EqualFold(name, "temp")
+}
+
+// RemoteTable is a table of a remote database.
+type RemoteTable struct {
+	Name    string
+	Columns []string
+	Types   []string
+}
+
+// Remote is a remote database, such as another rqlite cluster, whose tables
+// may be read, but not written, through a schema of this database.
+type Remote interface {
+	// Tables returns the tables of the remote database.
+	Tables() ([]*RemoteTable, error)
+
+	// Scan returns every row of the named table, each holding the values of
+	// the given columns.
+	Scan(table string, columns []string) ([][]interface{}, error)
+}
+
+// remoteSchema is a remote database attached to the database.
+type remoteSchema struct {
+	remote Remote
+	tables map[string]*RemoteTable
+
+	// gen identifies this attachment, so that connections to the database
+	// attach the remote database again if it is replaced.
+	gen int
+}
+
+// AttachRemote attaches the remote database r, replacing any remote database
+// already attached under the same name, so that queries made with
+// QueryWithRemotes may read its tables as name.table. The tables of r are
+// read when it is attached.
+func (db *DB) AttachRemote(name string, r Remote) error {
+	if !RemoteTablesSupported {
+		return ErrRemoteTablesUnsupported
+	}
+	if !IsValidRemoteName(name) {
+		return fmt.Errorf("%w: %q", ErrRemoteName, name)
+	}
+	tables, err := r.Tables()
+	if err != nil {
+		return err
+	}
+	rs := &remoteSchema{
+		remote: r,
+		tables: make(map[string]*RemoteTable, len(tables)),
+	}
+	for _, t := range tables {
+		rs.tables[t.Name] = t
+	}
+
+	db.remotesMu.Lock()
+	defer db.remotesMu.Unlock()
+	if db.remotes == nil {
+		db.remotes = make(map[string]*remoteSchema)
+	}
+	db.remotesGen++
+	rs.gen = db.remotesGen
+	db.remotes[strings.ToLower(name)] = rs
+	return nil
+}
+
+// DetachRemote detaches the named remote database, if attached.
+func (db *DB) DetachRemote(name string) {
+	db.remotesMu.Lock()
+	defer db.remotesMu.Unlock()
+	delete(db.remotes, strings.ToLower(name))
+}
+
+// RemoteTables returns the tables of the named remote database, sorted by
+// name, or false if it is not attached.
+func (db *DB) RemoteTables(name string) ([]*RemoteTable, bool) {
+	db.remotesMu.RLock()
+	defer db.remotesMu.RUnlock()
+	rs, ok := db.remotes[strings.ToLower(name)]
+	if !ok {
+		return nil, false
+	}
+	tables := make([]*RemoteTable, 0, len(rs.tables))
+	for _, t := range rs.tables {
+		tables = append(tables, t)
+	}
+	sort.Slice(tables, func(i, j int) bool { return tables[i].Name < tables[j].Name })
+	return tables, true
+}
+
+// RemoteNames returns the names of the attached remote databases, sorted.
+func (db *DB) RemoteNames() []string {
+	db.remotesMu.RLock()
+	defer db.remotesMu.RUnlock()
+	names := make([]string, 0, len(db.remotes))
+	for name := range db.remotes {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// remoteTable returns the named table of the named remote database.
+func (db *DB) remoteTable(name, table string) (Remote, *RemoteTable, error) {
+	db.remotesMu.RLock()
+	defer db.remotesMu.RUnlock()
+	rs, ok := db.remotes[strings.ToLower(name)]
+	if !ok {
+		return nil, nil, fmt.Errorf("remote database %s is not attached", name)
+	}
+	t, ok := rs.tables[table]
+	if !ok {
+		return nil, nil, fmt.Errorf("no such table in remote database %s: %s", name, table)
+	}
+	return rs.remote, t, nil
+}
+
+// QueryWithRemotes executes queries, like Query, which may also read the
+// tables of the attached remote databases. Only the node which serves a query
+// reads the remote databases, so queries applied through the Raft log, which
+// every node applies, must not use it.
+func (db *DB) QueryWithRemotes(req *command.Request, xTime bool) ([]*command.QueryRows, error) {
+	pool, err := db.remotePool()
+	if err != nil {
+		return nil, err
+	}
+	if pool == nil {
+		return db.Query(req, xTime)
+	}
+
+	stats.Add(numQueries, int64(len(req.Statements)))
+	conn, err := busyConn(pool, false)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	if err := db.attachRemotes(conn); err != nil {
+		return nil, err
+	}
+	return db.queryWithConn(req, xTime, conn)
+}
+
+// remotePool returns the pool of read-only connections to which remote
+// databases are attached, opening it if need be, or nil if no remote
+// database has been attached. The connections are kept apart from those
+// used by other queries, which must not read remote databases.
+func (db *DB) remotePool() (*sql.DB, error) {
+	db.remotesMu.Lock()
+	defer db.remotesMu.Unlock()
+	if db.remDB != nil || len(db.remotes) == 0 {
+		return db.remDB, nil
+	}
+	remDB, err := sql.Open(driverName, db.roDSN)
+	if err != nil {
+		return nil, err
+	}
+	remDB.SetConnMaxIdleTime(30 * time.Second)
+	remDB.SetConnMaxLifetime(0)
+	db.remDB = remDB
+	return remDB, nil
+}
+
+// closeRemotePool closes the pool of connections to which remote databases
+// are attached, if open.
+func (db *DB) closeRemotePool() error {
+	db.remotesMu.Lock()
+	defer db.remotesMu.Unlock()
+	if db.remDB == nil {
+		return nil
+	}
+	err := db.remDB.Close()
+	db.remDB = nil
+	return err
+}
+
+// attachRemotes brings the schemas of the connection in line with the remote
+// databases attached to the database. Each remote database is attached to
+// the connection as an in-memory database holding a virtual table for each
+// remote table, stamped with the generation of the attachment.
+func (db *DB) attachRemotes(conn *sql.Conn) error {
+	db.remotesMu.RLock()
+	want := make(map[string]*remoteSchema, len(db.remotes))
+	for name, rs := range db.remotes {
+		want[name] = rs
+	}
+	db.remotesMu.RUnlock()
+
+	ctx := context.Background()
+	attached, err := connSchemas(ctx, conn)
+	if err != nil {
+		return err
+	}
+	if len(want) == 0 && len(attached) == 0 {
+		return nil
+	}
+
+	for name := range attached {
+		if _, ok := want[name]; ok {
+			continue
+		}
+		if _, err := conn.ExecContext(ctx, fmt.Sprintf(`DETACH DATABASE %s`, quoteIdent(name))); err != nil {
+			return err
+		}
+	}
+
+	for name, rs := range want {
+		if gen, ok := attached[name]; ok {
+			if gen == rs.gen {
+				continue
+			}
+			if _, err := conn.ExecContext(ctx, fmt.Sprintf(`DETACH DATABASE %s`, quoteIdent(name))); err != nil {
+				return err
+			}
+		}
+		if err := db.attachRemote(ctx, conn, name, rs); err != nil {
+			return fmt.Errorf("attaching remote database %s: %s", name, err.Error())
+		}
+	}
+	return nil
+}
+
+func (db *DB) attachRemote(ctx context.Context, conn *sql.Conn, name string, rs *remoteSchema) error {
+	if _, err := conn.ExecContext(ctx, fmt.Sprintf(`ATTACH DATABASE ':memory:' AS %s`, quoteIdent(name))); err != nil {
+		return err
+	}
+	for _, t := range rs.tables {
+		stmt := fmt.Sprintf(`CREATE VIRTUAL TABLE %s.%s USING %s(%s, %s)`,
+			quoteIdent(name), quoteIdent(t.Name), remoteModule, quoteIdent(name), quoteIdent(t.Name))
+		_, err := conn.ExecContext(ctx, stmt)
+		if err != nil && strings.Contains(err.Error(), "no such module") {
+			if err = registerRemoteModule(conn, db); err == nil {
+				_, err = conn.ExecContext(ctx, stmt)
+			}
+		}
+		if err != nil {
+			return err
+		}
+	}
+	_, err := conn.ExecContext(ctx, fmt.Sprintf(`PRAGMA %s.user_version = %d`, quoteIdent(name), rs.gen))
+	return err
+}
+
+// connSchemas returns the generation of each remote database attached to the
+// connection, keyed by the name of its schema.
+func connSchemas(ctx context.Context, conn *sql.Conn) (map[string]int, error) {
+	rows, err := conn.QueryContext(ctx, `SELECT name FROM pragma_database_list WHERE name NOT IN ('main', 'temp')`)
+	if err != nil {
+		return nil, err
+	}
+	var names []string
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		names = append(names, strings.ToLower(name))
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+
+	schemas := make(map[string]int, len(names))
+	for _, name := range names {
+		var gen int
+		if err := conn.QueryRowContext(ctx, fmt.Sprintf(`PRAGMA %s.user_version`, quoteIdent(name))).Scan(&gen); err != nil {
+			return nil, err
+		}
+		schemas[name] = gen
+	}
+	return schemas, nil
+}
+
+// quoteIdent returns s quoted as an SQLite identifier.
+func quoteIdent(s string) string {
+	return `"` + strings.ReplaceAll(s, `"`, `""`) + `"`
+}
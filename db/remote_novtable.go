@@ -0,0 +1,16 @@
+//go:build !sqlite_vtable
+
+package db
+
+import (
+	"database/sql"
+)
+
+// RemoteTablesSupported is whether this build supports remote tables. SQLite
+// virtual tables, through which remote tables are read, are only built with
+// the sqlite_vtable tag.
+const RemoteTablesSupported = false
+
+func registerRemoteModule(conn *sql.Conn, db *DB) error {
+	return ErrRemoteTablesUnsupported
+}
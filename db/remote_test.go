@@ -0,0 +1,140 @@
+package db
+
+import (
+	"errors"
+	"os"
+	"testing"
+
+	"github.com/rqlite/rqlite/command"
+)
+
+// mockRemote is a remote database holding fixed rows.
+type mockRemote struct {
+	tables []*RemoteTable
+	rows   map[string][][]interface{}
+	scans  int
+	err    error
+}
+
+func (m *mockRemote) Tables() ([]*RemoteTable, error) {
+	return m.tables, nil
+}
+
+func (m *mockRemote) Scan(table string, columns []string) ([][]interface{}, error) {
+	m.scans++
+	if m.err != nil {
+		return nil, m.err
+	}
+	return m.rows[table], nil
+}
+
+func Test_RemoteTables(t *testing.T) {
+	for _, inMem := range []bool{true, false} {
+		var db *DB
+		if inMem {
+			db = mustCreateInMemoryDatabase()
+		} else {
+			var path string
+			db, path = mustCreateDatabase()
+			defer os.Remove(path)
+		}
+		defer db.Close()
+
+		remote := &mockRemote{
+			tables: []*RemoteTable{
+				{Name: "users", Columns: []string{"id", "name", "score"}, Types: []string{"INTEGER", "TEXT", "REAL"}},
+				{Name: "it's", Columns: []string{"x"}},
+			},
+			rows: map[string][][]interface{}{
+				"users": {
+					{int64(1), "fiona", 2.5},
+					{int64(2), "declan", nil},
+				},
+				"it's": {{[]byte("blob")}},
+			},
+		}
+		err := db.AttachRemote("eu", remote)
+		if !RemoteTablesSupported {
+			if !errors.Is(err, ErrRemoteTablesUnsupported) {
+				t.Fatalf("wrong error attaching remote without virtual tables: %v", err)
+			}
+			return
+		}
+		if err != nil {
+			t.Fatalf("failed to attach remote: %s", err.Error())
+		}
+		mustExecute(db, `CREATE TABLE regions (id INTEGER, region TEXT)`)
+		mustExecute(db, `INSERT INTO regions VALUES (1, 'eu'), (2, 'us')`)
+
+		r, err := db.QueryWithRemotes(queryRequest(`SELECT u.name, r.region, u.score FROM eu.users AS u JOIN regions AS r ON u.id = r.id ORDER BY u.id`), false)
+		if err != nil {
+			t.Fatalf("failed to query remote table: %s", err.Error())
+		}
+		if exp, got := `[{"columns":["name","region","score"],"types":["text","text","real"],"values":[["fiona","eu",2.5],["declan","us",null]]}]`, asJSON(r); exp != got {
+			t.Fatalf("wrong results\nexp: %s\ngot: %s", exp, got)
+		}
+		r, err = db.QueryWithRemotes(queryRequest(`SELECT * FROM eu."it's"`), false)
+		if err != nil {
+			t.Fatalf("failed to query remote table: %s", err.Error())
+		}
+		if exp, got := `[{"columns":["x"],"types":[""],"values":[["blob"]]}]`, asJSON(r); exp != got {
+			t.Fatalf("wrong results\nexp: %s\ngot: %s", exp, got)
+		}
+
+		// Remote tables may not be written, nor read by other queries.
+		r, err = db.QueryWithRemotes(queryRequest(`DELETE FROM eu.users`), false)
+		if err != nil || r[0].Error == "" {
+			t.Fatalf("remote table written: %s", asJSON(r))
+		}
+		r, err = db.Query(queryRequest(`SELECT * FROM eu.users`), false)
+		if err != nil || r[0].Error == "" {
+			t.Fatalf("remote table read by plain query: %s", asJSON(r))
+		}
+		e, err := db.ExecuteStringStmt(`INSERT INTO regions SELECT id, name FROM eu.users`)
+		if err != nil || e[0].Error == "" {
+			t.Fatalf("remote table read by execute: %s", asJSON(e))
+		}
+
+		// Errors reading the remote database are reported by the query.
+		remote.err = errors.New("connection refused")
+		r, err = db.QueryWithRemotes(queryRequest(`SELECT * FROM eu.users`), false)
+		if err != nil || r[0].Error == "" {
+			t.Fatalf("remote error not reported: %s", asJSON(r))
+		}
+		remote.err = nil
+
+		// Attaching again replaces the tables on every connection.
+		remote.tables = remote.tables[:1]
+		if err := db.AttachRemote("eu", remote); err != nil {
+			t.Fatalf("failed to attach remote: %s", err.Error())
+		}
+		if tables, ok := db.RemoteTables("eu"); !ok || len(tables) != 1 {
+			t.Fatalf("wrong remote tables: %v", tables)
+		}
+		r, err = db.QueryWithRemotes(queryRequest(`SELECT * FROM eu."it's"`), false)
+		if err != nil || r[0].Error == "" {
+			t.Fatalf("dropped remote table read: %s", asJSON(r))
+		}
+
+		db.DetachRemote("eu")
+		r, err = db.QueryWithRemotes(queryRequest(`SELECT * FROM eu.users`), false)
+		if err != nil || r[0].Error == "" {
+			t.Fatalf("detached remote table read: %s", asJSON(r))
+		}
+		if _, ok := db.RemoteTables("eu"); ok {
+			t.Fatalf("detached remote still attached")
+		}
+
+		for _, name := range []string{"main", "TEMP", "eu-west", ""} {
+			if err := db.AttachRemote(name, remote); !errors.Is(err, ErrRemoteName) {
+				t.Fatalf("remote attached with name %q: %v", name, err)
+			}
+		}
+	}
+}
+
+func queryRequest(s string) *command.Request {
+	return &command.Request{
+		Statements: []*command.Statement{{Sql: s}},
+	}
+}
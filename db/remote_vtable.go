@@ -0,0 +1,164 @@
+//go:build sqlite_vtable
+
+package db
+
+import (
+	"database/sql"
+	"fmt"
+	"strings"
+
+	"github.com/rqlite/go-sqlite3"
+)
+
+// RemoteTablesSupported is whether this build supports remote tables.
+const RemoteTablesSupported = true
+
+// registerRemoteModule registers, on the connection, the virtual table module
+// through which the tables of the remote databases of db are read.
+func registerRemoteModule(conn *sql.Conn, db *DB) error {
+	return conn.Raw(func(driverConn interface{}) error {
+		return driverConn.(*sqlite3.SQLiteConn).CreateModule(remoteModule, &remoteTableModule{db: db})
+	})
+}
+
+// remoteTableModule is the virtual table module whose tables are the tables of
+// remote databases. Its arguments are the names of the remote database and of
+// the table.
+type remoteTableModule struct {
+	db *DB
+}
+
+// Create implements sqlite3.Module.
+func (m *remoteTableModule) Create(c *sqlite3.SQLiteConn, args []string) (sqlite3.VTab, error) {
+	if len(args) != 5 {
+		return nil, fmt.Errorf("%s takes a remote database and a table", remoteModule)
+	}
+	name, table := unquoteIdent(args[3]), unquoteIdent(args[4])
+	remote, t, err := m.db.remoteTable(name, table)
+	if err != nil {
+		return nil, err
+	}
+
+	cols := make([]string, len(t.Columns))
+	for i, col := range t.Columns {
+		cols[i] = quoteIdent(col)
+		if i < len(t.Types) && t.Types[i] != "" {
+			cols[i] += " " + t.Types[i]
+		}
+	}
+	if err := c.DeclareVTab(fmt.Sprintf("CREATE TABLE x(%s)", strings.Join(cols, ", "))); err != nil {
+		return nil, err
+	}
+	return &remoteVTab{remote: remote, table: t}, nil
+}
+
+// Connect implements sqlite3.Module.
+func (m *remoteTableModule) Connect(c *sqlite3.SQLiteConn, args []string) (sqlite3.VTab, error) {
+	return m.Create(c, args)
+}
+
+// DestroyModule implements sqlite3.Module.
+func (m *remoteTableModule) DestroyModule() {}
+
+// remoteVTab is a table of a remote database. It implements no updates, so
+// SQLite permits it only to be read.
+type remoteVTab struct {
+	remote Remote
+	table  *RemoteTable
+}
+
+// BestIndex implements sqlite3.VTab. Every read scans the whole of the remote
+// table, so no constraints are used, and the cost is high.
+func (v *remoteVTab) BestIndex(cst []sqlite3.InfoConstraint, ob []sqlite3.InfoOrderBy) (*sqlite3.IndexResult, error) {
+	return &sqlite3.IndexResult{
+		Used:          make([]bool, len(cst)),
+		EstimatedCost: 1e6,
+		EstimatedRows: 1e6,
+	}, nil
+}
+
+// Disconnect implements sqlite3.VTab.
+func (v *remoteVTab) Disconnect() error { return nil }
+
+// Destroy implements sqlite3.VTab.
+func (v *remoteVTab) Destroy() error { return nil }
+
+// Open implements sqlite3.VTab.
+func (v *remoteVTab) Open() (sqlite3.VTabCursor, error) {
+	return &remoteCursor{vtab: v}, nil
+}
+
+// remoteCursor reads the rows of a remote table.
+type remoteCursor struct {
+	vtab *remoteVTab
+	rows [][]interface{}
+	i    int
+}
+
+// Filter implements sqlite3.VTabCursor, reading every row of the table.
+func (c *remoteCursor) Filter(idxNum int, idxStr string, vals []interface{}) error {
+	rows, err := c.vtab.remote.Scan(c.vtab.table.Name, c.vtab.table.Columns)
+	if err != nil {
+		return err
+	}
+	stats.Add(numRemoteScans, 1)
+	stats.Add(numRemoteRows, int64(len(rows)))
+	c.rows, c.i = rows, 0
+	return nil
+}
+
+// Next implements sqlite3.VTabCursor.
+func (c *remoteCursor) Next() error {
+	c.i++
+	return nil
+}
+
+// EOF implements sqlite3.VTabCursor.
+func (c *remoteCursor) EOF() bool {
+	return c.i >= len(c.rows)
+}
+
+// Column implements sqlite3.VTabCursor.
+func (c *remoteCursor) Column(ctx *sqlite3.SQLiteContext, col int) error {
+	row := c.rows[c.i]
+	if col >= len(row) {
+		ctx.ResultNull()
+		return nil
+	}
+	switch v := row[col].(type) {
+	case nil:
+		ctx.ResultNull()
+	case int64:
+		ctx.ResultInt64(v)
+	case float64:
+		ctx.ResultDouble(v)
+	case bool:
+		ctx.ResultBool(v)
+	case string:
+		ctx.ResultText(v)
+	case []byte:
+		ctx.ResultBlob(v)
+	default:
+		return fmt.Errorf("unsupported type %T in remote table %s", v, c.vtab.table.Name)
+	}
+	return nil
+}
+
+// Rowid implements sqlite3.VTabCursor.
+func (c *remoteCursor) Rowid() (int64, error) {
+	return int64(c.i), nil
+}
+
+// Close implements sqlite3.VTabCursor.
+func (c *remoteCursor) Close() error {
+	c.rows = nil
+	return nil
+}
+
+// unquoteIdent returns the identifier s, which may be quoted.
+func unquoteIdent(s string) string {
+	if len(s) >= 2 && s[0] == '"' && s[len(s)-1] == '"' {
+		return strings.ReplaceAll(s[1:len(s)-1], `""`, `"`)
+	}
+	return s
+}
@@ -0,0 +1,135 @@
+package db
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+)
+
+// TableSize is the size of a single table.
+type TableSize struct {
+	Name string `json:"name"`
+	Rows int64  `json:"rows"`
+
+	// Bytes is the size of the pages holding the table's rows, and
+	// IndexBytes the size of the pages holding its indexes.
+	Bytes      int64 `json:"bytes"`
+	IndexBytes int64 `json:"index_bytes"`
+}
+
+// SizeStats is the size of the database, and of each of its tables.
+type SizeStats struct {
+	Size          int64        `json:"size"`
+	WALSize       int64        `json:"wal_size"`
+	PageSize      int64        `json:"page_size"`
+	FreelistPages int64        `json:"freelist_pages"`
+	Tables        []*TableSize `json:"tables"`
+}
+
+// SizeStats returns the size of the database, and of each of its tables,
+// sorted by table name. Byte sizes are those of the pages used, as reported
+// by the dbstat virtual table, so include any unused space in those pages.
+// Counting rows reads every table in full, so this may be expensive for
+// large databases.
+func (db *DB) SizeStats() (*SizeStats, error) {
+	ctx := context.Background()
+	conn, err := db.roDB.Conn(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	ss := &SizeStats{Tables: make([]*TableSize, 0)}
+	if err := conn.QueryRowContext(ctx, `PRAGMA page_size`).Scan(&ss.PageSize); err != nil {
+		return nil, err
+	}
+	if err := conn.QueryRowContext(ctx, `PRAGMA freelist_count`).Scan(&ss.FreelistPages); err != nil {
+		return nil, err
+	}
+	if ss.Size, err = db.Size(); err != nil {
+		return nil, err
+	}
+	if !db.memory {
+		fi, err := os.Stat(db.path + "-wal")
+		if err == nil {
+			ss.WALSize = fi.Size()
+		} else if !os.IsNotExist(err) {
+			return nil, err
+		}
+	}
+
+	// Each b-tree is a table or an index, and belongs to a table.
+	owners := make(map[string]*TableSize)
+	tables := make(map[string]*TableSize)
+	rows, err := conn.QueryContext(ctx, `SELECT "type", "name", "tbl_name" FROM "sqlite_master"
+		WHERE "type" IN ('table', 'index') AND "tbl_name" NOT LIKE 'sqlite_%'`)
+	if err != nil {
+		return nil, err
+	}
+	var indexes []string
+	for rows.Next() {
+		var typ, name, tbl string
+		if err := rows.Scan(&typ, &name, &tbl); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		if IsManagedTable(tbl) {
+			continue
+		}
+		if typ == "table" {
+			tables[name] = &TableSize{Name: name}
+			owners[name] = tables[name]
+		} else {
+			indexes = append(indexes, name, tbl)
+		}
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	for i := 0; i < len(indexes); i += 2 {
+		if t, ok := tables[indexes[i+1]]; ok {
+			owners[indexes[i]] = t
+		}
+	}
+
+	rows, err = conn.QueryContext(ctx, `SELECT "name", SUM("pgsize") FROM "dbstat" GROUP BY "name"`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read dbstat: %s", err.Error())
+	}
+	for rows.Next() {
+		var name string
+		var sz int64
+		if err := rows.Scan(&name, &sz); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		t, ok := owners[name]
+		if !ok {
+			continue
+		}
+		if t.Name == name {
+			t.Bytes += sz
+		} else {
+			t.IndexBytes += sz
+		}
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	for name, t := range tables {
+		q := fmt.Sprintf(`SELECT COUNT(*) FROM "%s"`, strings.Replace(name, `"`, `""`, -1))
+		if err := conn.QueryRowContext(ctx, q).Scan(&t.Rows); err != nil {
+			return nil, err
+		}
+		ss.Tables = append(ss.Tables, t)
+	}
+	sort.Slice(ss.Tables, func(i, j int) bool {
+		return ss.Tables[i].Name < ss.Tables[j].Name
+	})
+	return ss, nil
+}
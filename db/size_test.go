@@ -0,0 +1,55 @@
+package db
+
+import (
+	"os"
+	"testing"
+)
+
+func Test_SizeStats(t *testing.T) {
+	for _, inmem := range []bool{false, true} {
+		var db *DB
+		if inmem {
+			db = mustCreateInMemoryDatabase()
+		} else {
+			var path string
+			db, path = mustCreateDatabase()
+			defer os.Remove(path)
+		}
+		defer db.Close()
+
+		mustExecute(db, `CREATE TABLE foo (id INTEGER NOT NULL PRIMARY KEY, name TEXT)`)
+		mustExecute(db, `CREATE INDEX foo_name ON foo(name)`)
+		mustExecute(db, `CREATE TABLE "b""ar" (id INTEGER NOT NULL PRIMARY KEY)`)
+		mustExecute(db, `INSERT INTO foo(id, name) VALUES(1, 'fiona'), (2, 'declan'), (3, 'aoife')`)
+
+		ss, err := db.SizeStats()
+		if err != nil {
+			t.Fatalf("failed to get size stats: %s", err.Error())
+		}
+		if ss.PageSize <= 0 || ss.Size <= 0 || ss.Size%ss.PageSize != 0 {
+			t.Fatalf("wrong sizes, page size %d, size %d", ss.PageSize, ss.Size)
+		}
+		if len(ss.Tables) != 2 {
+			t.Fatalf("wrong number of tables: %d", len(ss.Tables))
+		}
+		bar, foo := ss.Tables[0], ss.Tables[1]
+		if bar.Name != `b"ar` || bar.Rows != 0 || bar.Bytes != ss.PageSize || bar.IndexBytes != 0 {
+			t.Fatalf("wrong size for bar: %+v", bar)
+		}
+		if foo.Name != "foo" || foo.Rows != 3 || foo.Bytes != ss.PageSize || foo.IndexBytes != ss.PageSize {
+			t.Fatalf("wrong size for foo: %+v", foo)
+		}
+
+		mustExecute(db, `DROP TABLE foo`)
+		ss, err = db.SizeStats()
+		if err != nil {
+			t.Fatalf("failed to get size stats: %s", err.Error())
+		}
+		if ss.FreelistPages != 2 {
+			t.Fatalf("wrong number of freelist pages: %d", ss.FreelistPages)
+		}
+		if len(ss.Tables) != 1 {
+			t.Fatalf("wrong number of tables after drop: %d", len(ss.Tables))
+		}
+	}
+}
@@ -0,0 +1,173 @@
+package db
+
+import (
+	"expvar"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/rqlite/rqlite/command"
+	"github.com/rqlite/sql"
+)
+
+const (
+	numTableInserts = "inserts"
+	numTableUpdates = "updates"
+	numTableDeletes = "deletes"
+	numTableBytes   = "bytes"
+)
+
+// tableStats captures per-table write statistics for the DB layer. Each
+// entry is itself a map, keyed by table name.
+var tableStats = expvar.NewMap("db_tables")
+
+// tableStatsMu serializes creation of per-table entries.
+var tableStatsMu sync.Mutex
+
+// TableStats are the write statistics for a single table.
+type TableStats struct {
+	Name    string `json:"name"`
+	Inserts int64  `json:"inserts"`
+	Updates int64  `json:"updates"`
+	Deletes int64  `json:"deletes"`
+	Bytes   int64  `json:"bytes"`
+}
+
+// Writes returns the total number of rows written to the table.
+func (t *TableStats) Writes() int64 {
+	return t.Inserts + t.Updates + t.Deletes
+}
+
+// AllTableStats returns the write statistics for every table written to
+// since the stats were last reset, sorted by table name.
+func AllTableStats() []*TableStats {
+	var all []*TableStats
+	tableStats.Do(func(kv expvar.KeyValue) {
+		m := kv.Value.(*expvar.Map)
+		all = append(all, &TableStats{
+			Name:    kv.Key,
+			Inserts: mapInt(m, numTableInserts),
+			Updates: mapInt(m, numTableUpdates),
+			Deletes: mapInt(m, numTableDeletes),
+			Bytes:   mapInt(m, numTableBytes),
+		})
+	})
+	return all
+}
+
+// HotTables returns the write statistics for, at most, the n tables with
+// the most rows written. Ties are broken by bytes written, then name.
+func HotTables(n int) []*TableStats {
+	all := AllTableStats()
+	sort.SliceStable(all, func(i, j int) bool {
+		if all[i].Writes() != all[j].Writes() {
+			return all[i].Writes() > all[j].Writes()
+		}
+		return all[i].Bytes > all[j].Bytes
+	})
+	if n >= 0 && len(all) > n {
+		all = all[:n]
+	}
+	return all
+}
+
+// tableWrite records a write to a table made by a single statement.
+type tableWrite struct {
+	table string
+	op    string
+	rows  int64
+	bytes int64
+}
+
+// newTableWrite returns the tableWrite for a statement which affected the
+// given number of rows. It returns false if the statement does not insert
+// into, update, or delete from a table.
+func newTableWrite(stmt *command.Statement, rows int64) (*tableWrite, bool) {
+	if rows == 0 {
+		return nil, false
+	}
+	s, err := sql.NewParser(strings.NewReader(stmt.Sql)).ParseStatement()
+	if err != nil {
+		return nil, false
+	}
+
+	tw := &tableWrite{
+		rows:  rows,
+		bytes: statementSize(stmt),
+	}
+	switch v := s.(type) {
+	case *sql.InsertStatement:
+		tw.table, tw.op = v.Table.Name, numTableInserts
+	case *sql.UpdateStatement:
+		tw.table, tw.op = v.Table.Name.Name, numTableUpdates
+	case *sql.DeleteStatement:
+		tw.table, tw.op = v.Table.Name.Name, numTableDeletes
+	default:
+		return nil, false
+	}
+	return tw, true
+}
+
+// recordTableWrites adds the given writes to the per-table statistics.
+func recordTableWrites(tws []*tableWrite) {
+	for _, tw := range tws {
+		m := tableMap(tw.table)
+		m.Add(tw.op, tw.rows)
+		m.Add(numTableBytes, tw.bytes)
+	}
+}
+
+// tableMap returns the stats map for the named table, creating it if necessary.
+func tableMap(table string) *expvar.Map {
+	if v := tableStats.Get(table); v != nil {
+		return v.(*expvar.Map)
+	}
+
+	tableStatsMu.Lock()
+	defer tableStatsMu.Unlock()
+	if v := tableStats.Get(table); v != nil {
+		return v.(*expvar.Map)
+	}
+	m := new(expvar.Map).Init()
+	m.Add(numTableInserts, 0)
+	m.Add(numTableUpdates, 0)
+	m.Add(numTableDeletes, 0)
+	m.Add(numTableBytes, 0)
+	tableStats.Set(table, m)
+	return m
+}
+
+// statementSize returns the size, in bytes, of the SQL and parameters of
+// the given statement.
+func statementSize(stmt *command.Statement) int64 {
+	sz := int64(len(stmt.Sql))
+	sz += parametersSize(stmt.Parameters)
+	for _, ps := range stmt.ParameterSets {
+		sz += parametersSize(ps.Parameters)
+	}
+	return sz
+}
+
+func parametersSize(params []*command.Parameter) int64 {
+	var sz int64
+	for _, p := range params {
+		switch v := p.GetValue().(type) {
+		case *command.Parameter_I, *command.Parameter_D:
+			sz += 8
+		case *command.Parameter_B:
+			sz++
+		case *command.Parameter_Y:
+			sz += int64(len(v.Y))
+		case *command.Parameter_S:
+			sz += int64(len(v.S))
+		}
+	}
+	return sz
+}
+
+func mapInt(m *expvar.Map, key string) int64 {
+	if v, ok := m.Get(key).(*expvar.Int); ok {
+		return v.Value()
+	}
+	return 0
+}
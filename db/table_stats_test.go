@@ -0,0 +1,96 @@
+package db
+
+import (
+	"os"
+	"testing"
+
+	"github.com/rqlite/rqlite/command"
+)
+
+func Test_TableStats(t *testing.T) {
+	ResetStats()
+	db, path := mustCreateDatabase()
+	defer db.Close()
+	defer os.Remove(path)
+
+	for _, s := range []string{
+		"CREATE TABLE foo (id INTEGER NOT NULL PRIMARY KEY, name TEXT)",
+		"CREATE TABLE bar (id INTEGER NOT NULL PRIMARY KEY, name TEXT)",
+		`INSERT INTO foo(name) VALUES("fiona")`,
+		`INSERT INTO foo(name) VALUES("sinead")`,
+		`INSERT INTO bar(name) VALUES("declan")`,
+		`UPDATE foo SET name="fiona2" WHERE name="fiona"`,
+		`DELETE FROM foo WHERE name="nobody"`,
+	} {
+		if _, err := db.ExecuteStringStmt(s); err != nil {
+			t.Fatalf("failed to execute statement: %s", err.Error())
+		}
+	}
+
+	all := AllTableStats()
+	if len(all) != 2 {
+		t.Fatalf("wrong number of tables, exp 2, got %d", len(all))
+	}
+	if all[0].Name != "bar" || all[0].Inserts != 1 || all[0].Writes() != 1 {
+		t.Fatalf("wrong stats for bar: %+v", all[0])
+	}
+	if all[1].Name != "foo" || all[1].Inserts != 2 || all[1].Updates != 1 || all[1].Deletes != 0 {
+		t.Fatalf("wrong stats for foo: %+v", all[1])
+	}
+	if all[1].Bytes == 0 {
+		t.Fatalf("expected non-zero bytes for foo")
+	}
+
+	hot := HotTables(1)
+	if len(hot) != 1 || hot[0].Name != "foo" {
+		t.Fatalf("wrong hot tables: %+v", hot)
+	}
+
+	// Writes in a rolled-back transaction should not be counted.
+	req := &command.Request{
+		Transaction: true,
+		Statements: []*command.Statement{
+			{Sql: `DELETE FROM foo`},
+			{Sql: `INSERT INTO bar(id, name) VALUES(1, "fiona")`},
+		},
+	}
+	if _, err := db.Execute(req, false); err != nil {
+		t.Fatalf("failed to execute request: %s", err.Error())
+	}
+	if _, err := db.Request(req, false); err != nil {
+		t.Fatalf("failed to execute request: %s", err.Error())
+	}
+	all = AllTableStats()
+	if all[1].Deletes != 0 {
+		t.Fatalf("rolled back deletes counted: %+v", all[1])
+	}
+
+	// Writes via the unified endpoint should be counted.
+	req.Transaction = false
+	req.Statements = req.Statements[:1]
+	if _, err := db.Request(req, false); err != nil {
+		t.Fatalf("failed to execute request: %s", err.Error())
+	}
+	all = AllTableStats()
+	if all[1].Deletes != 2 {
+		t.Fatalf("wrong deletes for foo, exp 2, got %d", all[1].Deletes)
+	}
+
+	ResetStats()
+	if n := len(AllTableStats()); n != 0 {
+		t.Fatalf("table stats not reset, got %d tables", n)
+	}
+}
+
+func Test_TableStatsStatementSize(t *testing.T) {
+	stmt := &command.Statement{
+		Sql: "INSERT INTO foo(name, age) VALUES(?, ?)",
+		Parameters: []*command.Parameter{
+			{Value: &command.Parameter_S{S: "fiona"}},
+			{Value: &command.Parameter_I{I: 20}},
+		},
+	}
+	if exp, got := int64(len(stmt.Sql)+5+8), statementSize(stmt); exp != got {
+		t.Fatalf("wrong statement size, exp %d, got %d", exp, got)
+	}
+}
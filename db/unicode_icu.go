@@ -0,0 +1,7 @@
+//go:build sqlite_icu
+
+package db
+
+// ICUSupported is whether this build of SQLite includes ICU, so that upper(),
+// lower(), LIKE, and REGEXP handle text beyond ASCII.
+const ICUSupported = true
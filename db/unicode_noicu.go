@@ -0,0 +1,8 @@
+//go:build !sqlite_icu
+
+package db
+
+// ICUSupported is whether this build of SQLite includes ICU, so that upper(),
+// lower(), LIKE, and REGEXP handle text beyond ASCII. ICU is only built with
+// the sqlite_icu tag.
+const ICUSupported = false
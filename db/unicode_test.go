@@ -0,0 +1,51 @@
+package db
+
+import (
+	"testing"
+)
+
+func Test_UnicodeFunctions(t *testing.T) {
+	db := mustCreateInMemoryDatabase()
+	defer db.Close()
+	mustExecute(db, `CREATE TABLE foo (id INTEGER NOT NULL PRIMARY KEY, name TEXT)`)
+	mustExecute(db, `INSERT INTO foo(id, name) VALUES(1, 'École'), (2, 'école'), (3, 'Straße'), (4, 'ecole')`)
+
+	// Without ICU, SQLite changes the case of ASCII letters only.
+	exp := map[string]string{
+		`SELECT upper(name), lower(name) FROM foo WHERE id = 3`:  `[["STRAßE","straße"]]`,
+		`SELECT id FROM foo WHERE name LIKE 'école' ORDER BY id`: `[[2]]`,
+		`SELECT id FROM foo WHERE name LIKE 'ECOLE' ORDER BY id`: `[[4]]`,
+	}
+	if ICUSupported {
+		exp = map[string]string{
+			`SELECT upper(name), lower(name) FROM foo WHERE id = 3`:             `[["STRASSE","straße"]]`,
+			`SELECT id FROM foo WHERE name LIKE 'école' ORDER BY id`:            `[[1],[2]]`,
+			`SELECT id FROM foo WHERE name LIKE 'ECOLE' ORDER BY id`:            `[[4]]`,
+			`SELECT id FROM foo WHERE name REGEXP '(?i)éc.*' ORDER BY id`:       `[[1],[2]]`,
+			`SELECT id FROM foo WHERE name REGEXP '.*\p{Lu}.*' ORDER BY id`:     `[[1],[3]]`,
+			`SELECT id FROM foo WHERE name REGEXP '^[[:alpha:]]+$' ORDER BY id`: `[[1],[2],[3],[4]]`,
+		}
+	}
+	for q, e := range exp {
+		r, err := db.QueryStringStmt(q)
+		if err != nil {
+			t.Fatalf("failed to query %s: %s", q, err.Error())
+		}
+		if r[0].Error != "" {
+			t.Fatalf("failed to query %s: %s", q, r[0].Error)
+		}
+		if got := asJSON(r[0].Values); got != e {
+			t.Fatalf("wrong results for %s\nexp: %s\ngot: %s", q, e, got)
+		}
+	}
+
+	if !ICUSupported {
+		r, err := db.QueryStringStmt(`SELECT id FROM foo WHERE name REGEXP 'x'`)
+		if err != nil {
+			t.Fatalf("failed to query: %s", err.Error())
+		}
+		if exp, got := "no such function: REGEXP", r[0].Error; exp != got {
+			t.Fatalf("wrong error for REGEXP without ICU, exp %s, got %s", exp, got)
+		}
+	}
+}
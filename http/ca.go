@@ -0,0 +1,127 @@
+package http
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/rqlite/rqlite/auth"
+	"github.com/rqlite/rqlite/store"
+)
+
+// CARotator is the interface the CA rotation endpoints use to rotate the CA
+// used for node-to-node encryption.
+type CARotator interface {
+	// BeginCARotation distributes the PEM-encoded CA certificate ca to every
+	// node, each of which then trusts it as well as the CA it already trusts.
+	BeginCARotation(ca []byte) error
+
+	// InstallCertificate replaces the certificate this node presents to other
+	// nodes with the given PEM-encoded certificate and key.
+	InstallCertificate(cert, key []byte) error
+
+	// RetireCA completes the CA rotation in progress, after which every node
+	// trusts only the new CA. Unless force is set, the CA is not retired until
+	// every node presents a certificate issued by the new CA.
+	RetireCA(force bool) error
+
+	// CancelCARotation cancels the CA rotation in progress.
+	CancelCARotation() error
+
+	// CAStatus returns the status of CA rotation across the cluster.
+	CAStatus() (map[string]interface{}, error)
+}
+
+// handleCA handles requests to rotate the CA used for node-to-node encryption.
+// Every request, other than installing a certificate on this node, must be
+// served by the leader.
+func (s *Service) handleCA(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+
+	perm := auth.PermCA
+	if r.Method == "GET" {
+		perm = auth.PermStatus
+	}
+	if !s.CheckRequestPerm(r, perm) {
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+	if s.CARotator == nil {
+		http.Error(w, "node-to-node encryption not enabled", http.StatusNotFound)
+		return
+	}
+
+	var err error
+	switch action := strings.TrimPrefix(r.URL.Path, "/ca"); {
+	case action == "" && r.Method == "GET":
+	case action == "/rotate" && r.Method == "POST":
+		var b []byte
+		b, err = io.ReadAll(r.Body)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		err = s.CARotator.BeginCARotation(b)
+	case action == "/retire" && r.Method == "POST":
+		var force bool
+		force, err = queryParam(r, "force")
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		err = s.CARotator.RetireCA(force)
+	case action == "/cancel" && r.Method == "POST":
+		err = s.CARotator.CancelCARotation()
+	case action == "/cert" && r.Method == "PUT":
+		var kp struct {
+			Cert string `json:"cert"`
+			Key  string `json:"key"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&kp); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		err = s.CARotator.InstallCertificate([]byte(kp.Cert), []byte(kp.Key))
+	case action == "" || action == "/rotate" || action == "/retire" || action == "/cancel" || action == "/cert":
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	default:
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+
+	if err != nil {
+		switch {
+		case errors.Is(err, store.ErrNotLeader):
+			leaderAPIAddr := s.LeaderAPIAddr()
+			if leaderAPIAddr == "" {
+				stats.Add(numLeaderNotFound, 1)
+				http.Error(w, ErrLeaderNotFound.Error(), http.StatusServiceUnavailable)
+				return
+			}
+			// Preserve the method and body of the request.
+			http.Redirect(w, r, s.FormRedirect(r, leaderAPIAddr), http.StatusTemporaryRedirect)
+		case errors.Is(err, store.ErrCARotationInProgress), errors.Is(err, store.ErrNoCARotation):
+			http.Error(w, err.Error(), http.StatusConflict)
+		default:
+			http.Error(w, err.Error(), http.StatusBadRequest)
+		}
+		return
+	}
+
+	status, err := s.CARotator.CAStatus()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	b, err := json.Marshal(status)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if _, err := w.Write(b); err != nil {
+		s.logger.Println("writing response failed:", err.Error())
+	}
+}
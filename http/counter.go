@@ -0,0 +1,350 @@
+package http
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/rqlite/rqlite/auth"
+	"github.com/rqlite/rqlite/command"
+	sql "github.com/rqlite/rqlite/db"
+	"github.com/rqlite/rqlite/queue"
+)
+
+// counterTable is the table, managed by rqlite, holding the value of each
+// counter.
+const counterTable = sql.ManagedTablePrefix + "counters"
+
+// counterChange is the change to a counter made by the updates of a batch.
+type counterChange struct {
+	reset bool  // Whether the counter is reset, before delta is added.
+	delta int64 // The sum of the deltas added to the counter.
+}
+
+// counterBatch is a batch of updates to counters, which are merged, so that
+// the batch is written as at most two statements per counter.
+type counterBatch struct {
+	names   []string // Counters in the order first updated, so statements are ordered.
+	changes map[string]*counterChange
+	done    queue.FlushChannel // Closed once the batch is committed.
+}
+
+// statements returns the statements applying the batch.
+func (b *counterBatch) statements() []*command.Statement {
+	stmts := []*command.Statement{
+		{
+			Sql: `CREATE TABLE IF NOT EXISTS ` + counterTable +
+				` (name TEXT NOT NULL PRIMARY KEY, value INTEGER NOT NULL) WITHOUT ROWID`,
+		},
+	}
+	for _, name := range b.names {
+		c := b.changes[name]
+		if c.reset {
+			stmts = append(stmts, &command.Statement{
+				Sql: `DELETE FROM ` + counterTable + ` WHERE name = ?`,
+				Parameters: []*command.Parameter{
+					{Value: &command.Parameter_S{S: name}},
+				},
+			})
+		}
+		if c.delta != 0 {
+			stmts = append(stmts, &command.Statement{
+				Sql: `INSERT INTO ` + counterTable + ` (name, value) VALUES (?, ?)` +
+					` ON CONFLICT(name) DO UPDATE SET value = value + excluded.value`,
+				Parameters: []*command.Parameter{
+					{Value: &command.Parameter_S{S: name}},
+					{Value: &command.Parameter_I{I: c.delta}},
+				},
+			})
+		}
+	}
+	return stmts
+}
+
+// counterBatcher merges updates to counters made within timeout of each
+// other, or until maxNames counters have been updated, writing each batch to
+// the execute queue. So however many times a counter is updated, each batch
+// costs a single statement for it, rather than one per update.
+type counterBatcher struct {
+	timeout  time.Duration
+	maxNames int
+	write    func(stmts []*command.Statement, fc queue.FlushChannel) error
+
+	mu    sync.Mutex
+	batch *counterBatch
+	timer *time.Timer
+}
+
+// newCounterBatcher returns a counterBatcher writing batches with write.
+func newCounterBatcher(timeout time.Duration, maxNames int,
+	write func(stmts []*command.Statement, fc queue.FlushChannel) error) *counterBatcher {
+	return &counterBatcher{
+		timeout:  timeout,
+		maxNames: maxNames,
+		write:    write,
+	}
+}
+
+// Add adds the given deltas to the named counters. It returns a channel
+// which is closed once the batch holding the update has been committed.
+func (c *counterBatcher) Add(deltas map[string]int64) (queue.FlushChannel, error) {
+	return c.update(deltas, false)
+}
+
+// Reset resets the named counters to zero, removing them. It returns a
+// channel which is closed once the batch holding the reset has been
+// committed.
+func (c *counterBatcher) Reset(names ...string) (queue.FlushChannel, error) {
+	deltas := make(map[string]int64, len(names))
+	for _, n := range names {
+		deltas[n] = 0
+	}
+	return c.update(deltas, true)
+}
+
+func (c *counterBatcher) update(deltas map[string]int64, reset bool) (queue.FlushChannel, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.batch == nil {
+		c.batch = &counterBatch{
+			changes: make(map[string]*counterChange),
+			done:    make(queue.FlushChannel),
+		}
+		c.timer = time.AfterFunc(c.timeout, func() {
+			c.Flush()
+		})
+	}
+
+	b := c.batch
+	for _, name := range sortedNames(deltas) {
+		ch, ok := b.changes[name]
+		if !ok {
+			ch = &counterChange{}
+			b.changes[name] = ch
+			b.names = append(b.names, name)
+		}
+		if reset {
+			ch.reset = true
+			ch.delta = 0
+		}
+		ch.delta += deltas[name]
+	}
+	stats.Add(numCounterUpdates, int64(len(deltas)))
+
+	if len(b.names) >= c.maxNames {
+		return b.done, c.flush()
+	}
+	return b.done, nil
+}
+
+// Flush writes any pending batch to the execute queue.
+func (c *counterBatcher) Flush() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.flush()
+}
+
+// flush writes any pending batch. c.mu must be held.
+func (c *counterBatcher) flush() error {
+	if c.batch == nil {
+		return nil
+	}
+	b := c.batch
+	c.batch = nil
+	c.timer.Stop()
+	stats.Add(numCounterFlushes, 1)
+	return c.write(b.statements(), b.done)
+}
+
+// sortedNames returns the names of the counters of deltas, sorted, so that
+// the order of statements does not depend on the iteration order of maps.
+func sortedNames(deltas map[string]int64) []string {
+	names := make([]string, 0, len(deltas))
+	for n := range deltas {
+		names = append(names, n)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// handleCounters handles requests to read, update and reset counters. A
+// request to /db/counters reads or updates any number of counters, and a
+// request to /db/counters/<name> a single counter. Updates are merged, and
+// written through the execute queue, so are cheap however often they are
+// made. Reading counters requires the query permission, and updating them
+// the execute permission.
+func (s *Service) handleCounters(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+
+	perm := auth.PermExecute
+	if r.Method == "GET" {
+		perm = auth.PermQuery
+	}
+	if !s.CheckRequestPerm(r, perm) {
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+
+	name := strings.TrimPrefix(strings.TrimPrefix(r.URL.Path, "/db/counters"), "/")
+	if strings.Contains(name, "/") {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+
+	switch r.Method {
+	case "GET":
+		s.readCounters(w, r, name)
+	case "POST", "DELETE":
+		s.updateCounters(w, r, name)
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
+
+// readCounters writes the value of the named counter, or of every counter
+// if name is empty, read at the requested consistency level. Counters never
+// updated, or reset, read as zero. Updates not yet committed are not read.
+func (s *Service) readCounters(w http.ResponseWriter, r *http.Request, name string) {
+	timeout, err := timeoutParam(r, defaultTimeout)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	lvl, err := level(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	lvl, ok := s.readLevel(w, r, lvl)
+	if !ok {
+		return
+	}
+
+	stmt := &command.Statement{Sql: `SELECT name, value FROM ` + counterTable + ` ORDER BY name`}
+	if name != "" {
+		stmt = &command.Statement{
+			Sql: `SELECT name, value FROM ` + counterTable + ` WHERE name = ?`,
+			Parameters: []*command.Parameter{
+				{Value: &command.Parameter_S{S: name}},
+			},
+		}
+	}
+	rows, err := s.queryOrForward(w, r, &command.QueryRequest{
+		Request: &command.Request{Statements: []*command.Statement{stmt}},
+		Level:   lvl,
+	}, timeout)
+	if err == nil && len(rows) != 1 {
+		err = fmt.Errorf("unexpected query result")
+	}
+	if err != nil {
+		http.Error(w, err.Error(), statusCodeForError(err))
+		return
+	}
+	if rows[0].Error != "" && !strings.Contains(rows[0].Error, "no such table") {
+		http.Error(w, rows[0].Error, http.StatusInternalServerError)
+		return
+	}
+
+	counters := make(map[string]int64)
+	for _, v := range rows[0].Values {
+		p := v.GetParameters()
+		if len(p) != 2 {
+			http.Error(w, "unexpected number of columns reading counters", http.StatusInternalServerError)
+			return
+		}
+		counters[p[0].GetS()] = p[1].GetI()
+	}
+
+	var resp interface{} = map[string]interface{}{"counters": counters}
+	if name != "" {
+		resp = map[string]interface{}{"name": name, "value": counters[name]}
+	}
+	s.writeCounterResponse(w, r, resp)
+}
+
+// updateCounters adds to, or with DELETE resets, counters. A request for a
+// single counter adds the delta parameter, 1 if not set, and a request for
+// many adds the deltas of the JSON object in its body. With the wait
+// parameter the response is sent once the update has been committed.
+func (s *Service) updateCounters(w http.ResponseWriter, r *http.Request, name string) {
+	wait, err := isWait(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	timeout, err := timeoutParam(r, defaultTimeout)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	deltas := make(map[string]int64)
+	if name != "" {
+		deltas[name] = 1
+		if v := r.URL.Query().Get("delta"); v != "" {
+			if deltas[name], err = strconv.ParseInt(v, 10, 64); err != nil {
+				http.Error(w, fmt.Sprintf("invalid delta %q", v), http.StatusBadRequest)
+				return
+			}
+		}
+	} else if err := json.NewDecoder(r.Body).Decode(&deltas); err != nil {
+		http.Error(w, fmt.Sprintf("invalid counter deltas: %s", err.Error()), http.StatusBadRequest)
+		return
+	}
+	if len(deltas) == 0 {
+		http.Error(w, "no counters", http.StatusBadRequest)
+		return
+	}
+	for n := range deltas {
+		if n == "" || strings.Contains(n, "/") {
+			http.Error(w, fmt.Sprintf("invalid counter name %q", n), http.StatusBadRequest)
+			return
+		}
+	}
+
+	var done queue.FlushChannel
+	if r.Method == "DELETE" {
+		done, err = s.counters.Reset(sortedNames(deltas)...)
+	} else {
+		done, err = s.counters.Add(deltas)
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	if wait {
+		tmr := time.NewTimer(timeout)
+		defer tmr.Stop()
+		select {
+		case <-done:
+		case <-tmr.C:
+			http.Error(w, "timeout", http.StatusRequestTimeout)
+			return
+		}
+	}
+	s.writeCounterResponse(w, r, map[string]interface{}{})
+}
+
+func (s *Service) writeCounterResponse(w http.ResponseWriter, r *http.Request, resp interface{}) {
+	var b []byte
+	var err error
+	pretty, _ := isPretty(r)
+	if pretty {
+		b, err = json.MarshalIndent(resp, "", "    ")
+	} else {
+		b, err = json.Marshal(resp)
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if _, err := w.Write(b); err != nil {
+		s.logger.Println("writing response failed:", err.Error())
+	}
+}
@@ -0,0 +1,104 @@
+package http
+
+import (
+	"testing"
+	"time"
+
+	"github.com/rqlite/rqlite/command"
+	"github.com/rqlite/rqlite/queue"
+)
+
+func Test_CounterBatcherMerges(t *testing.T) {
+	var batches [][]*command.Statement
+	c := newCounterBatcher(time.Hour, 4, func(stmts []*command.Statement, fc queue.FlushChannel) error {
+		batches = append(batches, stmts)
+		close(fc)
+		return nil
+	})
+
+	done, err := c.Add(map[string]int64{"hits": 1})
+	if err != nil {
+		t.Fatalf("failed to add to counter: %s", err.Error())
+	}
+	for i := 0; i < 99; i++ {
+		if _, err := c.Add(map[string]int64{"hits": 1}); err != nil {
+			t.Fatalf("failed to add to counter: %s", err.Error())
+		}
+	}
+	if _, err := c.Add(map[string]int64{"misses": 5, "hits": -10}); err != nil {
+		t.Fatalf("failed to add to counters: %s", err.Error())
+	}
+	if _, err := c.Reset("errors"); err != nil {
+		t.Fatalf("failed to reset counter: %s", err.Error())
+	}
+	if _, err := c.Add(map[string]int64{"errors": 2}); err != nil {
+		t.Fatalf("failed to add to counter: %s", err.Error())
+	}
+	if len(batches) != 0 {
+		t.Fatalf("batch written before it was full")
+	}
+
+	// The batch is written as one statement per counter, and two for the
+	// counter reset within it, after creating the table.
+	if err := c.Flush(); err != nil {
+		t.Fatalf("failed to flush counters: %s", err.Error())
+	}
+	if len(batches) != 1 {
+		t.Fatalf("wrong number of batches written: %d", len(batches))
+	}
+	select {
+	case <-done:
+	default:
+		t.Fatalf("batch not done once written")
+	}
+	stmts := batches[0]
+	if len(stmts) != 5 {
+		t.Fatalf("wrong number of statements: %d", len(stmts))
+	}
+	for i, exp := range []struct {
+		name  string
+		delta int64
+	}{{"hits", 90}, {"misses", 5}, {"errors", 0}, {"errors", 2}} {
+		stmt := stmts[i+1]
+		if got := stmt.Parameters[0].GetS(); got != exp.name {
+			t.Fatalf("wrong counter for statement %d, exp %s, got %s", i, exp.name, got)
+		}
+		if exp.delta != 0 && stmt.Parameters[1].GetI() != exp.delta {
+			t.Fatalf("wrong delta for counter %s, exp %d, got %d", exp.name, exp.delta, stmt.Parameters[1].GetI())
+		}
+	}
+
+	if err := c.Flush(); err != nil || len(batches) != 1 {
+		t.Fatalf("empty batch written")
+	}
+}
+
+func Test_CounterBatcherFull(t *testing.T) {
+	n := 0
+	c := newCounterBatcher(time.Hour, 2, func(stmts []*command.Statement, fc queue.FlushChannel) error {
+		n++
+		return nil
+	})
+	if _, err := c.Add(map[string]int64{"a": 1, "b": 1}); err != nil {
+		t.Fatalf("failed to add to counters: %s", err.Error())
+	}
+	if n != 1 {
+		t.Fatalf("full batch not written")
+	}
+}
+
+func Test_CounterBatcherTimeout(t *testing.T) {
+	written := make(chan struct{})
+	c := newCounterBatcher(10*time.Millisecond, 100, func(stmts []*command.Statement, fc queue.FlushChannel) error {
+		close(written)
+		return nil
+	})
+	if _, err := c.Add(map[string]int64{"a": 1}); err != nil {
+		t.Fatalf("failed to add to counter: %s", err.Error())
+	}
+	select {
+	case <-written:
+	case <-time.After(5 * time.Second):
+		t.Fatalf("batch not written after timeout")
+	}
+}
@@ -0,0 +1,81 @@
+package http
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/rqlite/rqlite/command"
+	"github.com/rqlite/rqlite/store"
+)
+
+// dryRunExecute handles requests to check statements which modify the
+// database, by executing them on the Leader within a transaction which is
+// always rolled back. Nothing is written to the Raft log. Dry runs are not
+// forwarded, so a request received by a Follower is always redirected to the
+// Leader.
+func (s *Service) dryRunExecute(w http.ResponseWriter, r *http.Request) {
+	resp := NewResponse()
+
+	_, isTx, timings, _, noRewriteRandom, err := reqParams(r, defaultTimeout)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	partial, err := isPartial(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	b, err := io.ReadAll(r.Body)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	r.Body.Close()
+
+	stmts, err := s.parseRequest(b)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if !s.checkRiskyWrites(w, r, stmts, resp, true) {
+		return
+	}
+	if err := command.Rewrite(stmts, !noRewriteRandom); err != nil {
+		http.Error(w, fmt.Sprintf("SQL rewrite: %s", err.Error()), http.StatusInternalServerError)
+		return
+	}
+
+	er := &command.ExecuteRequest{
+		Request: &command.Request{
+			Transaction: isTx,
+			Partial:     partial,
+			Statements:  stmts,
+		},
+		Timings: timings,
+	}
+
+	results, err := s.store.DryRun(er)
+	if err != nil {
+		if err == store.ErrNotLeader {
+			leaderAPIAddr := s.LeaderAPIAddr()
+			if leaderAPIAddr == "" {
+				stats.Add(numLeaderNotFound, 1)
+				http.Error(w, ErrLeaderNotFound.Error(), http.StatusServiceUnavailable)
+				return
+			}
+			loc := s.FormRedirect(r, leaderAPIAddr)
+			http.Redirect(w, r, loc, http.StatusMovedPermanently)
+			return
+		}
+		resp.Error = err.Error()
+	} else {
+		resp.Results.ExecuteResult = results
+	}
+	resp.end = time.Now()
+	s.writeResponse(w, r, resp)
+}
@@ -0,0 +1,65 @@
+package http
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"strings"
+
+	"github.com/rqlite/rqlite/command"
+	"google.golang.org/protobuf/proto"
+)
+
+// nonDeterministic are the SQL fragments which indicate that the results of a
+// statement may change even though the database has not.
+var nonDeterministic = []string{
+	"random", "now", "current_time", "current_date", "changes", "last_insert_rowid",
+}
+
+// queryETag returns the entity tag for the response to a query executed when
+// the applied index of the database was idx. The tag changes whenever the
+// database changes, or the statements, format, or redaction of the response,
+// differ.
+// False is returned if the results of the query may change independently of
+// the database, in which case no tag should be used.
+func queryETag(idx uint64, req *command.Request, assoc, pretty, jsonCols, redacted bool) (string, bool) {
+	for _, stmt := range req.Statements {
+		sql := strings.ToLower(stmt.Sql)
+		for _, nd := range nonDeterministic {
+			if strings.Contains(sql, nd) {
+				return "", false
+			}
+		}
+	}
+
+	b, err := proto.MarshalOptions{Deterministic: true}.Marshal(req)
+	if err != nil {
+		return "", false
+	}
+	h := sha256.New()
+	var buf [8]byte
+	binary.BigEndian.PutUint64(buf[:], idx)
+	h.Write(buf[:])
+	h.Write([]byte{boolByte(assoc), boolByte(pretty), boolByte(jsonCols), boolByte(redacted)})
+	h.Write(b)
+	return `"` + hex.EncodeToString(h.Sum(nil)[:16]) + `"`, true
+}
+
+// etagMatch returns whether the If-None-Match header value ifNoneMatch
+// matches etag. Weak comparison is used, as described in RFC 7232.
+func etagMatch(ifNoneMatch, etag string) bool {
+	for _, t := range strings.Split(ifNoneMatch, ",") {
+		t = strings.TrimSpace(t)
+		if t == "*" || strings.TrimPrefix(t, "W/") == etag {
+			return true
+		}
+	}
+	return false
+}
+
+func boolByte(b bool) byte {
+	if b {
+		return 1
+	}
+	return 0
+}
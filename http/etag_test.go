@@ -0,0 +1,69 @@
+package http
+
+import (
+	"testing"
+
+	"github.com/rqlite/rqlite/command"
+)
+
+func Test_QueryETag(t *testing.T) {
+	req := func(sql string, params ...*command.Parameter) *command.Request {
+		return &command.Request{
+			Statements: []*command.Statement{{Sql: sql, Parameters: params}},
+		}
+	}
+
+	e1, ok := queryETag(5, req("SELECT * FROM foo"), false, false, false, false)
+	if !ok {
+		t.Fatalf("no ETag for deterministic query")
+	}
+	if e, _ := queryETag(5, req("SELECT * FROM foo"), false, false, false, false); e != e1 {
+		t.Fatalf("ETag not stable, got %s and %s", e1, e)
+	}
+	for _, tt := range []struct {
+		idx    uint64
+		req    *command.Request
+		assoc    bool
+		pretty   bool
+		jsonCols bool
+		redacted bool
+	}{
+		{6, req("SELECT * FROM foo"), false, false, false, false},
+		{5, req("SELECT * FROM bar"), false, false, false, false},
+		{5, req("SELECT * FROM foo WHERE id=?", &command.Parameter{Value: &command.Parameter_I{I: 1}}), false, false, false, false},
+		{5, req("SELECT * FROM foo"), true, false, false, false},
+		{5, req("SELECT * FROM foo"), false, true, false, false},
+		{5, req("SELECT * FROM foo"), false, false, true, false},
+		{5, req("SELECT * FROM foo"), false, false, false, true},
+	} {
+		if e, _ := queryETag(tt.idx, tt.req, tt.assoc, tt.pretty, tt.jsonCols, tt.redacted); e == e1 {
+			t.Fatalf("ETag unchanged for %v", tt)
+		}
+	}
+
+	if _, ok := queryETag(5, req("SELECT random()"), false, false, false, false); ok {
+		t.Fatalf("got ETag for non-deterministic query")
+	}
+	if _, ok := queryETag(5, req("SELECT datetime('now')"), false, false, false, false); ok {
+		t.Fatalf("got ETag for non-deterministic query")
+	}
+}
+
+func Test_ETagMatch(t *testing.T) {
+	for _, tt := range []struct {
+		header string
+		match  bool
+	}{
+		{``, false},
+		{`"abc"`, true},
+		{`W/"abc"`, true},
+		{`"def", "abc"`, true},
+		{`*`, true},
+		{`"def"`, false},
+		{`abc`, false},
+	} {
+		if m := etagMatch(tt.header, `"abc"`); m != tt.match {
+			t.Fatalf("wrong match for %q, exp %v, got %v", tt.header, tt.match, m)
+		}
+	}
+}
@@ -0,0 +1,64 @@
+package http
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/rqlite/rqlite/auth"
+	"github.com/rqlite/rqlite/store"
+)
+
+// handleForeignKeys handles requests to enable, disable, and report on,
+// enforcement of foreign key constraints. The setting is replicated, so
+// changes to it must be served by the leader.
+func (s *Service) handleForeignKeys(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+
+	perm := auth.PermFK
+	if r.Method == "GET" {
+		perm = auth.PermStatus
+	}
+	if !s.CheckRequestPerm(r, perm) {
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+
+	var err error
+	switch r.Method {
+	case "GET":
+	case "POST":
+		err = s.store.SetForeignKeys(true)
+	case "DELETE":
+		err = s.store.SetForeignKeys(false)
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	if err != nil {
+		if errors.Is(err, store.ErrNotLeader) {
+			leaderAPIAddr := s.LeaderAPIAddr()
+			if leaderAPIAddr == "" {
+				stats.Add(numLeaderNotFound, 1)
+				http.Error(w, ErrLeaderNotFound.Error(), http.StatusServiceUnavailable)
+				return
+			}
+			http.Redirect(w, r, s.FormRedirect(r, leaderAPIAddr), http.StatusTemporaryRedirect)
+			return
+		}
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	b, err := json.Marshal(map[string]interface{}{
+		"enabled": s.store.ForeignKeys(),
+	})
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if _, err := w.Write(b); err != nil {
+		s.logger.Println("writing response failed:", err.Error())
+	}
+}
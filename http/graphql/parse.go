@@ -0,0 +1,585 @@
+// Package graphql implements the subset of GraphQL needed to query and modify
+// the tables of a SQLite database. Documents are parsed, and then translated
+// into parameterized SQL statements against the database schema. Fragments,
+// directives and subscriptions are not supported.
+package graphql
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// Operation types.
+const (
+	OperationQuery    = "query"
+	OperationMutation = "mutation"
+)
+
+// Document is a parsed GraphQL document.
+type Document struct {
+	Operations []*Operation
+}
+
+// Operation is a query or mutation within a document.
+type Operation struct {
+	Type       string
+	Name       string
+	Variables  []*VariableDefinition
+	Selections []*Field
+}
+
+// VariableDefinition declares a variable of an operation.
+type VariableDefinition struct {
+	Name       string
+	Default    interface{}
+	HasDefault bool
+}
+
+// Field is a selected field, with any arguments and sub-selections.
+type Field struct {
+	Alias      string
+	Name       string
+	Arguments  Object
+	Selections []*Field
+}
+
+// Key returns the key of the field in the response.
+func (f *Field) Key() string {
+	if f.Alias != "" {
+		return f.Alias
+	}
+	return f.Name
+}
+
+// Variable is a reference to a variable, within a value.
+type Variable string
+
+// Enum is an enum value.
+type Enum string
+
+// ObjectField is a single named value within an Object.
+type ObjectField struct {
+	Name  string
+	Value interface{}
+}
+
+// Object is an ordered set of named values. Other values are represented by
+// int64, float64, string, bool, nil, Enum, Variable and []interface{}.
+type Object []ObjectField
+
+// Get returns the value of the named field, and whether it is present.
+func (o Object) Get(name string) (interface{}, bool) {
+	for _, f := range o {
+		if f.Name == name {
+			return f.Value, true
+		}
+	}
+	return nil, false
+}
+
+// Operation returns the operation with the given name. If name is empty the
+// document must contain exactly one operation.
+func (d *Document) Operation(name string) (*Operation, error) {
+	if name == "" {
+		if len(d.Operations) != 1 {
+			return nil, errors.New("operation name required for document with multiple operations")
+		}
+		return d.Operations[0], nil
+	}
+	for _, op := range d.Operations {
+		if op.Name == name {
+			return op, nil
+		}
+	}
+	return nil, fmt.Errorf("unknown operation %s", name)
+}
+
+// Parse parses a GraphQL document.
+func Parse(src string) (*Document, error) {
+	p := &parser{lex: &lexer{src: src}}
+	if err := p.advance(); err != nil {
+		return nil, err
+	}
+
+	doc := &Document{}
+	for p.tok.kind != tokEOF {
+		op, err := p.parseOperation()
+		if err != nil {
+			return nil, err
+		}
+		doc.Operations = append(doc.Operations, op)
+	}
+	if len(doc.Operations) == 0 {
+		return nil, errors.New("document contains no operations")
+	}
+	return doc, nil
+}
+
+type tokenKind int
+
+const (
+	tokEOF tokenKind = iota
+	tokPunct
+	tokName
+	tokInt
+	tokFloat
+	tokString
+)
+
+type token struct {
+	kind tokenKind
+	val  string
+	pos  int
+}
+
+func (t token) String() string {
+	if t.kind == tokEOF {
+		return "end of document"
+	}
+	return fmt.Sprintf("'%s'", t.val)
+}
+
+type lexer struct {
+	src string
+	pos int
+}
+
+func (l *lexer) errorf(pos int, format string, a ...interface{}) error {
+	return fmt.Errorf("syntax error at offset %d: %s", pos, fmt.Sprintf(format, a...))
+}
+
+func (l *lexer) next() (token, error) {
+	for l.pos < len(l.src) {
+		c := l.src[l.pos]
+		if c == ' ' || c == '\t' || c == '\n' || c == '\r' || c == ',' {
+			l.pos++
+			continue
+		}
+		if c == '#' {
+			for l.pos < len(l.src) && l.src[l.pos] != '\n' && l.src[l.pos] != '\r' {
+				l.pos++
+			}
+			continue
+		}
+		break
+	}
+	if l.pos >= len(l.src) {
+		return token{kind: tokEOF, pos: l.pos}, nil
+	}
+
+	start := l.pos
+	c := l.src[l.pos]
+	switch {
+	case strings.IndexByte("!$()=:@[]{}|&", c) >= 0:
+		l.pos++
+		return token{kind: tokPunct, val: string(c), pos: start}, nil
+	case c == '.':
+		if strings.HasPrefix(l.src[l.pos:], "...") {
+			l.pos += 3
+			return token{kind: tokPunct, val: "...", pos: start}, nil
+		}
+	case c == '_' || isLetter(c):
+		for l.pos < len(l.src) && (l.src[l.pos] == '_' || isLetter(l.src[l.pos]) || isDigit(l.src[l.pos])) {
+			l.pos++
+		}
+		return token{kind: tokName, val: l.src[start:l.pos], pos: start}, nil
+	case c == '-' || isDigit(c):
+		return l.number()
+	case c == '"':
+		return l.string()
+	}
+	return token{}, l.errorf(start, "unexpected character %q", c)
+}
+
+func (l *lexer) number() (token, error) {
+	start := l.pos
+	kind := tokInt
+	if l.src[l.pos] == '-' {
+		l.pos++
+	}
+	if !l.digits() {
+		return token{}, l.errorf(start, "invalid number")
+	}
+	if l.pos < len(l.src) && l.src[l.pos] == '.' {
+		kind = tokFloat
+		l.pos++
+		if !l.digits() {
+			return token{}, l.errorf(start, "invalid number")
+		}
+	}
+	if l.pos < len(l.src) && (l.src[l.pos] == 'e' || l.src[l.pos] == 'E') {
+		kind = tokFloat
+		l.pos++
+		if l.pos < len(l.src) && (l.src[l.pos] == '+' || l.src[l.pos] == '-') {
+			l.pos++
+		}
+		if !l.digits() {
+			return token{}, l.errorf(start, "invalid number")
+		}
+	}
+	return token{kind: kind, val: l.src[start:l.pos], pos: start}, nil
+}
+
+func (l *lexer) digits() bool {
+	start := l.pos
+	for l.pos < len(l.src) && isDigit(l.src[l.pos]) {
+		l.pos++
+	}
+	return l.pos > start
+}
+
+func (l *lexer) string() (token, error) {
+	start := l.pos
+	if strings.HasPrefix(l.src[l.pos:], `"""`) {
+		end := strings.Index(l.src[l.pos+3:], `"""`)
+		if end < 0 {
+			return token{}, l.errorf(start, "unterminated string")
+		}
+		l.pos += 3 + end + 3
+		return token{kind: tokString, val: l.src[start+3 : start+3+end], pos: start}, nil
+	}
+
+	var b strings.Builder
+	l.pos++
+	for {
+		if l.pos >= len(l.src) || l.src[l.pos] == '\n' || l.src[l.pos] == '\r' {
+			return token{}, l.errorf(start, "unterminated string")
+		}
+		c := l.src[l.pos]
+		if c == '"' {
+			l.pos++
+			return token{kind: tokString, val: b.String(), pos: start}, nil
+		}
+		if c != '\\' {
+			b.WriteByte(c)
+			l.pos++
+			continue
+		}
+		if l.pos+1 >= len(l.src) {
+			return token{}, l.errorf(start, "unterminated string")
+		}
+		e := l.src[l.pos+1]
+		l.pos += 2
+		switch e {
+		case '"', '\\', '/':
+			b.WriteByte(e)
+		case 'b':
+			b.WriteByte('\b')
+		case 'f':
+			b.WriteByte('\f')
+		case 'n':
+			b.WriteByte('\n')
+		case 'r':
+			b.WriteByte('\r')
+		case 't':
+			b.WriteByte('\t')
+		case 'u':
+			if l.pos+4 > len(l.src) {
+				return token{}, l.errorf(l.pos, "invalid unicode escape")
+			}
+			r, err := strconv.ParseUint(l.src[l.pos:l.pos+4], 16, 32)
+			if err != nil {
+				return token{}, l.errorf(l.pos, "invalid unicode escape")
+			}
+			var buf [utf8.UTFMax]byte
+			b.Write(buf[:utf8.EncodeRune(buf[:], rune(r))])
+			l.pos += 4
+		default:
+			return token{}, l.errorf(l.pos-2, "invalid escape sequence \\%c", e)
+		}
+	}
+}
+
+func isLetter(c byte) bool {
+	return (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z')
+}
+
+func isDigit(c byte) bool {
+	return c >= '0' && c <= '9'
+}
+
+type parser struct {
+	lex *lexer
+	tok token
+}
+
+func (p *parser) advance() error {
+	t, err := p.lex.next()
+	if err != nil {
+		return err
+	}
+	p.tok = t
+	return nil
+}
+
+func (p *parser) is(punct string) bool {
+	return p.tok.kind == tokPunct && p.tok.val == punct
+}
+
+func (p *parser) unexpected() error {
+	return p.lex.errorf(p.tok.pos, "unexpected %s", p.tok)
+}
+
+func (p *parser) expect(punct string) error {
+	if !p.is(punct) {
+		return p.lex.errorf(p.tok.pos, "expected '%s', found %s", punct, p.tok)
+	}
+	return p.advance()
+}
+
+func (p *parser) name() (string, error) {
+	if p.tok.kind != tokName {
+		return "", p.lex.errorf(p.tok.pos, "expected name, found %s", p.tok)
+	}
+	n := p.tok.val
+	return n, p.advance()
+}
+
+func (p *parser) parseOperation() (*Operation, error) {
+	op := &Operation{Type: OperationQuery}
+	if p.tok.kind == tokName {
+		switch p.tok.val {
+		case OperationQuery, OperationMutation:
+			op.Type = p.tok.val
+		case "fragment":
+			return nil, errors.New("fragments are not supported")
+		case "subscription":
+			return nil, errors.New("subscriptions are not supported")
+		default:
+			return nil, p.unexpected()
+		}
+		if err := p.advance(); err != nil {
+			return nil, err
+		}
+		if p.tok.kind == tokName {
+			op.Name = p.tok.val
+			if err := p.advance(); err != nil {
+				return nil, err
+			}
+		}
+		if p.is("(") {
+			vars, err := p.parseVariableDefinitions()
+			if err != nil {
+				return nil, err
+			}
+			op.Variables = vars
+		}
+		if p.is("@") {
+			return nil, errors.New("directives are not supported")
+		}
+	}
+
+	sels, err := p.parseSelectionSet()
+	if err != nil {
+		return nil, err
+	}
+	op.Selections = sels
+	return op, nil
+}
+
+func (p *parser) parseVariableDefinitions() ([]*VariableDefinition, error) {
+	if err := p.expect("("); err != nil {
+		return nil, err
+	}
+	var vars []*VariableDefinition
+	for !p.is(")") {
+		if err := p.expect("$"); err != nil {
+			return nil, err
+		}
+		name, err := p.name()
+		if err != nil {
+			return nil, err
+		}
+		if err := p.expect(":"); err != nil {
+			return nil, err
+		}
+		if err := p.parseType(); err != nil {
+			return nil, err
+		}
+		v := &VariableDefinition{Name: name}
+		if p.is("=") {
+			if err := p.advance(); err != nil {
+				return nil, err
+			}
+			if v.Default, err = p.parseValue(true); err != nil {
+				return nil, err
+			}
+			v.HasDefault = true
+		}
+		vars = append(vars, v)
+	}
+	return vars, p.advance()
+}
+
+// parseType parses a variable type. Types are not checked, since values are
+// checked when they are bound to SQL statements.
+func (p *parser) parseType() error {
+	if p.is("[") {
+		if err := p.advance(); err != nil {
+			return err
+		}
+		if err := p.parseType(); err != nil {
+			return err
+		}
+		if err := p.expect("]"); err != nil {
+			return err
+		}
+	} else if _, err := p.name(); err != nil {
+		return err
+	}
+	if p.is("!") {
+		return p.advance()
+	}
+	return nil
+}
+
+func (p *parser) parseSelectionSet() ([]*Field, error) {
+	if err := p.expect("{"); err != nil {
+		return nil, err
+	}
+	var fields []*Field
+	for !p.is("}") {
+		if p.is("...") {
+			return nil, errors.New("fragments are not supported")
+		}
+		f, err := p.parseField()
+		if err != nil {
+			return nil, err
+		}
+		fields = append(fields, f)
+	}
+	if len(fields) == 0 {
+		return nil, p.lex.errorf(p.tok.pos, "empty selection set")
+	}
+	return fields, p.advance()
+}
+
+func (p *parser) parseField() (*Field, error) {
+	name, err := p.name()
+	if err != nil {
+		return nil, err
+	}
+	f := &Field{Name: name}
+	if p.is(":") {
+		if err := p.advance(); err != nil {
+			return nil, err
+		}
+		f.Alias = name
+		if f.Name, err = p.name(); err != nil {
+			return nil, err
+		}
+	}
+	if p.is("(") {
+		if err := p.advance(); err != nil {
+			return nil, err
+		}
+		for !p.is(")") {
+			n, err := p.name()
+			if err != nil {
+				return nil, err
+			}
+			if err := p.expect(":"); err != nil {
+				return nil, err
+			}
+			v, err := p.parseValue(false)
+			if err != nil {
+				return nil, err
+			}
+			f.Arguments = append(f.Arguments, ObjectField{Name: n, Value: v})
+		}
+		if err := p.advance(); err != nil {
+			return nil, err
+		}
+	}
+	if p.is("@") {
+		return nil, errors.New("directives are not supported")
+	}
+	if p.is("{") {
+		if f.Selections, err = p.parseSelectionSet(); err != nil {
+			return nil, err
+		}
+	}
+	return f, nil
+}
+
+func (p *parser) parseValue(isConst bool) (interface{}, error) {
+	t := p.tok
+	switch t.kind {
+	case tokInt:
+		i, err := strconv.ParseInt(t.val, 10, 64)
+		if err != nil {
+			return nil, p.lex.errorf(t.pos, "invalid integer %s", t.val)
+		}
+		return i, p.advance()
+	case tokFloat:
+		f, err := strconv.ParseFloat(t.val, 64)
+		if err != nil {
+			return nil, p.lex.errorf(t.pos, "invalid float %s", t.val)
+		}
+		return f, p.advance()
+	case tokString:
+		return t.val, p.advance()
+	case tokName:
+		var v interface{}
+		switch t.val {
+		case "true":
+			v = true
+		case "false":
+			v = false
+		case "null":
+			v = nil
+		default:
+			v = Enum(t.val)
+		}
+		return v, p.advance()
+	}
+
+	switch {
+	case p.is("$") && !isConst:
+		if err := p.advance(); err != nil {
+			return nil, err
+		}
+		n, err := p.name()
+		if err != nil {
+			return nil, err
+		}
+		return Variable(n), nil
+	case p.is("["):
+		if err := p.advance(); err != nil {
+			return nil, err
+		}
+		list := []interface{}{}
+		for !p.is("]") {
+			v, err := p.parseValue(isConst)
+			if err != nil {
+				return nil, err
+			}
+			list = append(list, v)
+		}
+		return list, p.advance()
+	case p.is("{"):
+		if err := p.advance(); err != nil {
+			return nil, err
+		}
+		obj := Object{}
+		for !p.is("}") {
+			n, err := p.name()
+			if err != nil {
+				return nil, err
+			}
+			if err := p.expect(":"); err != nil {
+				return nil, err
+			}
+			v, err := p.parseValue(isConst)
+			if err != nil {
+				return nil, err
+			}
+			obj = append(obj, ObjectField{Name: n, Value: v})
+		}
+		return obj, p.advance()
+	}
+	return nil, p.unexpected()
+}
@@ -0,0 +1,125 @@
+package graphql
+
+import (
+	"reflect"
+	"testing"
+)
+
+func Test_ParseQuery(t *testing.T) {
+	doc, err := Parse(`
+		# Fetch some users.
+		query Users($min: Int = 18, $names: [String!]) {
+			adults: users(where: {age: {gte: $min}, name: {in: $names}}, order_by: {name: asc}, limit: 10) {
+				id
+				name
+			}
+			pets { name }
+		}`)
+	if err != nil {
+		t.Fatalf("failed to parse query: %s", err.Error())
+	}
+	op, err := doc.Operation("")
+	if err != nil {
+		t.Fatalf("failed to get operation: %s", err.Error())
+	}
+	if op.Type != OperationQuery || op.Name != "Users" {
+		t.Fatalf("wrong operation, got %s %s", op.Type, op.Name)
+	}
+	if len(op.Variables) != 2 {
+		t.Fatalf("wrong number of variables, got %d", len(op.Variables))
+	}
+	if v := op.Variables[0]; v.Name != "min" || !v.HasDefault || v.Default != int64(18) {
+		t.Fatalf("wrong variable definition: %+v", v)
+	}
+	if v := op.Variables[1]; v.Name != "names" || v.HasDefault {
+		t.Fatalf("wrong variable definition: %+v", v)
+	}
+
+	if len(op.Selections) != 2 {
+		t.Fatalf("wrong number of selections, got %d", len(op.Selections))
+	}
+	f := op.Selections[0]
+	if f.Alias != "adults" || f.Name != "users" || f.Key() != "adults" {
+		t.Fatalf("wrong field: %+v", f)
+	}
+	exp := Object{
+		{Name: "where", Value: Object{
+			{Name: "age", Value: Object{{Name: "gte", Value: Variable("min")}}},
+			{Name: "name", Value: Object{{Name: "in", Value: Variable("names")}}},
+		}},
+		{Name: "order_by", Value: Object{{Name: "name", Value: Enum("asc")}}},
+		{Name: "limit", Value: int64(10)},
+	}
+	if !reflect.DeepEqual(f.Arguments, exp) {
+		t.Fatalf("wrong arguments, exp %+v, got %+v", exp, f.Arguments)
+	}
+	if len(f.Selections) != 2 || f.Selections[0].Name != "id" || f.Selections[1].Name != "name" {
+		t.Fatalf("wrong selections: %+v", f.Selections)
+	}
+	if op.Selections[1].Key() != "pets" {
+		t.Fatalf("wrong field: %+v", op.Selections[1])
+	}
+}
+
+func Test_ParseValues(t *testing.T) {
+	doc, err := Parse(`mutation { insert_t(objects: [{a: -1, b: 2.5e1, c: "x\"é\n", d: true, e: null, f: """raw "s" \n"""}]) }`)
+	if err != nil {
+		t.Fatalf("failed to parse mutation: %s", err.Error())
+	}
+	op := doc.Operations[0]
+	if op.Type != OperationMutation {
+		t.Fatalf("wrong operation type, got %s", op.Type)
+	}
+	exp := Object{{Name: "objects", Value: []interface{}{Object{
+		{Name: "a", Value: int64(-1)},
+		{Name: "b", Value: float64(25)},
+		{Name: "c", Value: "x\"é\n"},
+		{Name: "d", Value: true},
+		{Name: "e", Value: nil},
+		{Name: "f", Value: `raw "s" \n`},
+	}}}}
+	if got := op.Selections[0].Arguments; !reflect.DeepEqual(got, exp) {
+		t.Fatalf("wrong arguments, exp %+v, got %+v", exp, got)
+	}
+}
+
+func Test_ParseErrors(t *testing.T) {
+	for _, src := range []string{
+		``,
+		`{`,
+		`{ }`,
+		`{ users { id }`,
+		`{ users(id: ) { id } }`,
+		`{ users { ...UserFields } }`,
+		`fragment F on User { id }`,
+		`subscription { users { id } }`,
+		`{ users @include(if: true) { id } }`,
+		`query ($id: Int = $other) { users { id } }`,
+		`{ users(name: "unterminated) { id } }`,
+		`{ users(name: "\q") { id } }`,
+		`{ users(id: 1.) { id } }`,
+		`{ users(id: 99999999999999999999) { id } }`,
+		`{ users; }`,
+	} {
+		if _, err := Parse(src); err == nil {
+			t.Fatalf("parsing %q succeeded", src)
+		}
+	}
+}
+
+func Test_DocumentOperation(t *testing.T) {
+	doc, err := Parse(`query A { a { x } } query B { b { x } }`)
+	if err != nil {
+		t.Fatalf("failed to parse document: %s", err.Error())
+	}
+	if _, err := doc.Operation(""); err == nil {
+		t.Fatalf("got unnamed operation from document with multiple operations")
+	}
+	op, err := doc.Operation("B")
+	if err != nil || op.Selections[0].Name != "b" {
+		t.Fatalf("failed to get operation B")
+	}
+	if _, err := doc.Operation("C"); err == nil {
+		t.Fatalf("got nonexistent operation")
+	}
+}
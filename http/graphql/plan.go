@@ -0,0 +1,708 @@
+package graphql
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/rqlite/rqlite/command"
+	"github.com/rqlite/rqlite/command/encoding"
+)
+
+// Prefixes of mutation fields. The remainder of the field name is the table.
+const (
+	insertPrefix = "insert_"
+	updatePrefix = "update_"
+	deletePrefix = "delete_"
+)
+
+// Plan is a GraphQL operation translated into SQL, with one statement for
+// each top-level field of the operation.
+type Plan struct {
+	Mutation   bool
+	Statements []*command.Statement
+
+	fields []*Field
+}
+
+// NewPlan translates the named operation of doc into SQL against the given
+// schema. variables holds the values of the variables of the operation, as
+// decoded from JSON.
+//
+// Each field of a query is a table, or view, and selects its columns. It may
+// be filtered by a "where" argument, and ordered and paginated by "order_by",
+// "limit" and "offset" arguments. Each field of a mutation is one of
+// insert_<table>, taking the rows to insert as "objects", update_<table>,
+// taking "set" and "where", or delete_<table>, taking "where". A mutation
+// field may select "rows_affected" and "last_insert_id".
+func NewPlan(s *Schema, doc *Document, operationName string, variables map[string]interface{}) (*Plan, error) {
+	op, err := doc.Operation(operationName)
+	if err != nil {
+		return nil, err
+	}
+
+	b := &builder{
+		schema: s,
+		vars:   make(map[string]interface{}),
+	}
+	for _, v := range op.Variables {
+		if val, ok := variables[v.Name]; ok {
+			b.vars[v.Name] = val
+		} else if v.HasDefault {
+			b.vars[v.Name] = v.Default
+		}
+	}
+
+	p := &Plan{
+		Mutation: op.Type == OperationMutation,
+		fields:   op.Selections,
+	}
+	for _, f := range op.Selections {
+		b.sql.Reset()
+		b.params = nil
+
+		args, err := b.resolve(f.Arguments)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %s", f.Key(), err.Error())
+		}
+		if p.Mutation {
+			err = b.mutation(f, args.(Object))
+		} else {
+			err = b.query(f, args.(Object))
+		}
+		if err != nil {
+			return nil, fmt.Errorf("%s: %s", f.Key(), err.Error())
+		}
+		p.Statements = append(p.Statements, &command.Statement{
+			Sql:        b.sql.String(),
+			Parameters: b.params,
+		})
+	}
+	return p, nil
+}
+
+// Error is an error as reported in a GraphQL response.
+type Error struct {
+	Message string   `json:"message"`
+	Path    []string `json:"path,omitempty"`
+}
+
+// Response is a GraphQL response.
+type Response struct {
+	Data   interface{} `json:"data"`
+	Errors []*Error    `json:"errors,omitempty"`
+}
+
+// QueryResponse returns the response to a query, given the results of its
+// statements.
+func (p *Plan) QueryResponse(rows []*command.QueryRows) *Response {
+	resp := &Response{}
+	data := Object{}
+	for i, f := range p.fields {
+		var v interface{}
+		if i >= len(rows) {
+			resp.Errors = append(resp.Errors, &Error{Message: "no result", Path: []string{f.Key()}})
+		} else if rows[i].Error != "" {
+			resp.Errors = append(resp.Errors, &Error{Message: rows[i].Error, Path: []string{f.Key()}})
+		} else {
+			values := make([][]interface{}, len(rows[i].Values))
+			if err := encoding.NewValuesFromQueryValues(values, rows[i].Values); err != nil {
+				resp.Errors = append(resp.Errors, &Error{Message: err.Error(), Path: []string{f.Key()}})
+			} else {
+				list := make([]Object, len(values))
+				for j, row := range values {
+					list[j] = make(Object, len(f.Selections))
+					for k, sel := range f.Selections {
+						list[j][k] = ObjectField{Name: sel.Key(), Value: row[k]}
+					}
+				}
+				v = list
+			}
+		}
+		data = append(data, ObjectField{Name: f.Key(), Value: v})
+	}
+	resp.Data = data
+	return resp
+}
+
+// MutationResponse returns the response to a mutation, given the results of
+// its statements.
+func (p *Plan) MutationResponse(results []*command.ExecuteResult) *Response {
+	resp := &Response{}
+	data := Object{}
+	for i, f := range p.fields {
+		var v interface{}
+		if i >= len(results) {
+			resp.Errors = append(resp.Errors, &Error{Message: "no result", Path: []string{f.Key()}})
+		} else if results[i].Error != "" {
+			resp.Errors = append(resp.Errors, &Error{Message: results[i].Error, Path: []string{f.Key()}})
+		} else {
+			sels := f.Selections
+			if len(sels) == 0 {
+				sels = []*Field{{Name: "rows_affected"}, {Name: "last_insert_id"}}
+			}
+			obj := make(Object, len(sels))
+			for k, sel := range sels {
+				obj[k].Name = sel.Key()
+				if sel.Name == "rows_affected" {
+					obj[k].Value = results[i].RowsAffected
+				} else {
+					obj[k].Value = results[i].LastInsertId
+				}
+			}
+			v = obj
+		}
+		data = append(data, ObjectField{Name: f.Key(), Value: v})
+	}
+	resp.Data = data
+	return resp
+}
+
+// MarshalJSON implements json.Marshaler, preserving the order of fields.
+func (o Object) MarshalJSON() ([]byte, error) {
+	var buf bytes.Buffer
+	buf.WriteByte('{')
+	for i, f := range o {
+		if i > 0 {
+			buf.WriteByte(',')
+		}
+		k, err := json.Marshal(f.Name)
+		if err != nil {
+			return nil, err
+		}
+		v, err := json.Marshal(f.Value)
+		if err != nil {
+			return nil, err
+		}
+		buf.Write(k)
+		buf.WriteByte(':')
+		buf.Write(v)
+	}
+	buf.WriteByte('}')
+	return buf.Bytes(), nil
+}
+
+// builder builds the SQL statement for a single field.
+type builder struct {
+	schema *Schema
+	vars   map[string]interface{}
+
+	sql    strings.Builder
+	params []*command.Parameter
+}
+
+func (b *builder) query(f *Field, args Object) error {
+	t, ok := b.schema.Table(f.Name)
+	if !ok {
+		return fmt.Errorf("unknown table %s", f.Name)
+	}
+	if len(f.Selections) == 0 {
+		return fmt.Errorf("no columns selected")
+	}
+	if err := checkArguments(args, "where", "order_by", "limit", "offset"); err != nil {
+		return err
+	}
+
+	b.sql.WriteString("SELECT ")
+	for i, sel := range f.Selections {
+		if len(sel.Arguments) > 0 || len(sel.Selections) > 0 {
+			return fmt.Errorf("column %s may not have arguments or selections", sel.Name)
+		}
+		if !t.HasColumn(sel.Name) {
+			return fmt.Errorf("unknown column %s", sel.Name)
+		}
+		if i > 0 {
+			b.sql.WriteString(", ")
+		}
+		b.sql.WriteString(quote(sel.Name))
+	}
+	b.sql.WriteString(" FROM ")
+	b.sql.WriteString(quote(t.Name))
+
+	if where, ok := args.Get("where"); ok {
+		if err := b.where(t, where, true); err != nil {
+			return err
+		}
+	}
+	if orderBy, ok := args.Get("order_by"); ok {
+		if err := b.orderBy(t, orderBy); err != nil {
+			return err
+		}
+	}
+
+	limit, hasLimit := args.Get("limit")
+	offset, hasOffset := args.Get("offset")
+	if hasLimit || hasOffset {
+		b.sql.WriteString(" LIMIT ")
+		if hasLimit {
+			if err := b.count("limit", limit); err != nil {
+				return err
+			}
+		} else {
+			b.sql.WriteString("-1")
+		}
+		if hasOffset {
+			b.sql.WriteString(" OFFSET ")
+			if err := b.count("offset", offset); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func (b *builder) mutation(f *Field, args Object) error {
+	for _, sel := range f.Selections {
+		if sel.Name != "rows_affected" && sel.Name != "last_insert_id" {
+			return fmt.Errorf("unknown field %s, expected rows_affected or last_insert_id", sel.Name)
+		}
+	}
+
+	var name string
+	switch {
+	case strings.HasPrefix(f.Name, insertPrefix):
+		name = strings.TrimPrefix(f.Name, insertPrefix)
+	case strings.HasPrefix(f.Name, updatePrefix):
+		name = strings.TrimPrefix(f.Name, updatePrefix)
+	case strings.HasPrefix(f.Name, deletePrefix):
+		name = strings.TrimPrefix(f.Name, deletePrefix)
+	default:
+		return fmt.Errorf("unknown mutation %s", f.Name)
+	}
+	t, ok := b.schema.Table(name)
+	if !ok || t.View {
+		return fmt.Errorf("unknown table %s", name)
+	}
+
+	switch {
+	case strings.HasPrefix(f.Name, insertPrefix):
+		return b.insert(t, args)
+	case strings.HasPrefix(f.Name, updatePrefix):
+		return b.update(t, args)
+	default:
+		return b.delete(t, args)
+	}
+}
+
+func (b *builder) insert(t *Table, args Object) error {
+	if err := checkArguments(args, "objects"); err != nil {
+		return err
+	}
+	v, ok := args.Get("objects")
+	if !ok {
+		return fmt.Errorf("objects argument required")
+	}
+	var rows []Object
+	switch o := v.(type) {
+	case Object:
+		rows = []Object{o}
+	case []interface{}:
+		for _, r := range o {
+			obj, ok := r.(Object)
+			if !ok {
+				return fmt.Errorf("objects must be a list of objects")
+			}
+			rows = append(rows, obj)
+		}
+	default:
+		return fmt.Errorf("objects must be a list of objects")
+	}
+	if len(rows) == 0 {
+		return fmt.Errorf("no objects to insert")
+	}
+
+	b.sql.WriteString("INSERT INTO ")
+	b.sql.WriteString(quote(t.Name))
+	cols := rows[0]
+	if len(cols) == 0 {
+		if len(rows) > 1 {
+			return fmt.Errorf("only a single empty object may be inserted")
+		}
+		b.sql.WriteString(" DEFAULT VALUES")
+		return nil
+	}
+	b.sql.WriteString(" (")
+	for i, c := range cols {
+		if !t.HasColumn(c.Name) {
+			return fmt.Errorf("unknown column %s", c.Name)
+		}
+		if i > 0 {
+			b.sql.WriteString(", ")
+		}
+		b.sql.WriteString(quote(c.Name))
+	}
+	b.sql.WriteString(") VALUES ")
+	for i, r := range rows {
+		if len(r) != len(cols) {
+			return fmt.Errorf("all objects must have the same columns")
+		}
+		if i > 0 {
+			b.sql.WriteString(", ")
+		}
+		b.sql.WriteString("(")
+		for j, c := range cols {
+			v, ok := r.Get(c.Name)
+			if !ok {
+				return fmt.Errorf("all objects must have the same columns")
+			}
+			if j > 0 {
+				b.sql.WriteString(", ")
+			}
+			if err := b.bind(v); err != nil {
+				return err
+			}
+		}
+		b.sql.WriteString(")")
+	}
+	return nil
+}
+
+func (b *builder) update(t *Table, args Object) error {
+	if err := checkArguments(args, "set", "where"); err != nil {
+		return err
+	}
+	v, ok := args.Get("set")
+	set, isObj := v.(Object)
+	if !ok || !isObj || len(set) == 0 {
+		return fmt.Errorf("set argument must be a non-empty object")
+	}
+	where, ok := args.Get("where")
+	if !ok {
+		return fmt.Errorf("where argument required, use {} to update all rows")
+	}
+
+	b.sql.WriteString("UPDATE ")
+	b.sql.WriteString(quote(t.Name))
+	b.sql.WriteString(" SET ")
+	for i, c := range set {
+		if !t.HasColumn(c.Name) {
+			return fmt.Errorf("unknown column %s", c.Name)
+		}
+		if i > 0 {
+			b.sql.WriteString(", ")
+		}
+		b.sql.WriteString(quote(c.Name))
+		b.sql.WriteString(" = ")
+		if err := b.bind(c.Value); err != nil {
+			return err
+		}
+	}
+	return b.where(t, where, true)
+}
+
+func (b *builder) delete(t *Table, args Object) error {
+	if err := checkArguments(args, "where"); err != nil {
+		return err
+	}
+	where, ok := args.Get("where")
+	if !ok {
+		return fmt.Errorf("where argument required, use {} to delete all rows")
+	}
+	b.sql.WriteString("DELETE FROM ")
+	b.sql.WriteString(quote(t.Name))
+	return b.where(t, where, true)
+}
+
+// comparisons maps the operators which may be used in a filter to SQL.
+var comparisons = map[string]string{
+	"eq":   "=",
+	"neq":  "!=",
+	"gt":   ">",
+	"gte":  ">=",
+	"lt":   "<",
+	"lte":  "<=",
+	"like": "LIKE",
+}
+
+// where writes the filter v. If top is true it is written as a WHERE clause,
+// and omitted if empty, otherwise it is written as a parenthesized expression.
+func (b *builder) where(t *Table, v interface{}, top bool) error {
+	obj, ok := v.(Object)
+	if !ok {
+		return fmt.Errorf("filter must be an object")
+	}
+	if len(obj) == 0 {
+		if !top {
+			b.sql.WriteString("1")
+		}
+		return nil
+	}
+
+	if top {
+		b.sql.WriteString(" WHERE ")
+	}
+	b.sql.WriteString("(")
+	for i, f := range obj {
+		if i > 0 {
+			b.sql.WriteString(" AND ")
+		}
+		switch f.Name {
+		case "_and", "_or":
+			list, ok := f.Value.([]interface{})
+			if !ok {
+				return fmt.Errorf("%s must be a list of filters", f.Name)
+			}
+			if len(list) == 0 {
+				b.sql.WriteString(map[string]string{"_and": "1", "_or": "0"}[f.Name])
+				continue
+			}
+			b.sql.WriteString("(")
+			for j, c := range list {
+				if j > 0 {
+					b.sql.WriteString(map[string]string{"_and": " AND ", "_or": " OR "}[f.Name])
+				}
+				if err := b.where(t, c, false); err != nil {
+					return err
+				}
+			}
+			b.sql.WriteString(")")
+		case "_not":
+			b.sql.WriteString("NOT ")
+			if err := b.where(t, f.Value, false); err != nil {
+				return err
+			}
+		default:
+			if !t.HasColumn(f.Name) {
+				return fmt.Errorf("unknown column %s", f.Name)
+			}
+			ops, ok := f.Value.(Object)
+			if !ok {
+				ops = Object{{Name: "eq", Value: f.Value}}
+			}
+			if len(ops) == 0 {
+				b.sql.WriteString("1")
+			}
+			for j, op := range ops {
+				if j > 0 {
+					b.sql.WriteString(" AND ")
+				}
+				if err := b.comparison(f.Name, op); err != nil {
+					return err
+				}
+			}
+		}
+	}
+	b.sql.WriteString(")")
+	return nil
+}
+
+func (b *builder) comparison(col string, op ObjectField) error {
+	b.sql.WriteString(quote(col))
+	switch op.Name {
+	case "is_null":
+		isNull, ok := op.Value.(bool)
+		if !ok {
+			return fmt.Errorf("is_null must be a boolean")
+		}
+		if isNull {
+			b.sql.WriteString(" IS NULL")
+		} else {
+			b.sql.WriteString(" IS NOT NULL")
+		}
+		return nil
+	case "in":
+		list, ok := op.Value.([]interface{})
+		if !ok {
+			return fmt.Errorf("in must be a list")
+		}
+		if len(list) == 0 {
+			b.sql.WriteString(" IN ()")
+			return nil
+		}
+		b.sql.WriteString(" IN (")
+		for i, v := range list {
+			if i > 0 {
+				b.sql.WriteString(", ")
+			}
+			if err := b.bind(v); err != nil {
+				return err
+			}
+		}
+		b.sql.WriteString(")")
+		return nil
+	}
+
+	sqlOp, ok := comparisons[op.Name]
+	if !ok {
+		return fmt.Errorf("unknown operator %s", op.Name)
+	}
+	if op.Value == nil && (op.Name == "eq" || op.Name == "neq") {
+		if op.Name == "eq" {
+			b.sql.WriteString(" IS NULL")
+		} else {
+			b.sql.WriteString(" IS NOT NULL")
+		}
+		return nil
+	}
+	b.sql.WriteString(" ")
+	b.sql.WriteString(sqlOp)
+	b.sql.WriteString(" ")
+	return b.bind(op.Value)
+}
+
+func (b *builder) orderBy(t *Table, v interface{}) error {
+	var terms Object
+	switch o := v.(type) {
+	case Object:
+		terms = o
+	case []interface{}:
+		for _, e := range o {
+			obj, ok := e.(Object)
+			if !ok {
+				return fmt.Errorf("order_by must be an object, or list of objects")
+			}
+			terms = append(terms, obj...)
+		}
+	default:
+		return fmt.Errorf("order_by must be an object, or list of objects")
+	}
+	if len(terms) == 0 {
+		return nil
+	}
+
+	b.sql.WriteString(" ORDER BY ")
+	for i, term := range terms {
+		if !t.HasColumn(term.Name) {
+			return fmt.Errorf("unknown column %s", term.Name)
+		}
+		var dir string
+		switch d := term.Value.(type) {
+		case Enum:
+			dir = string(d)
+		case string:
+			dir = d
+		}
+		switch strings.ToLower(dir) {
+		case "asc":
+			dir = "ASC"
+		case "desc":
+			dir = "DESC"
+		default:
+			return fmt.Errorf("order of %s must be asc or desc", term.Name)
+		}
+		if i > 0 {
+			b.sql.WriteString(", ")
+		}
+		b.sql.WriteString(quote(term.Name))
+		b.sql.WriteString(" ")
+		b.sql.WriteString(dir)
+	}
+	return nil
+}
+
+func (b *builder) count(name string, v interface{}) error {
+	n, ok := v.(int64)
+	if !ok || n < 0 {
+		return fmt.Errorf("%s must be a non-negative integer", name)
+	}
+	return b.bind(n)
+}
+
+// bind writes a placeholder for v, and adds v to the statement parameters.
+func (b *builder) bind(v interface{}) error {
+	p := &command.Parameter{}
+	switch w := v.(type) {
+	case nil:
+	case int64:
+		p.Value = &command.Parameter_I{I: w}
+	case float64:
+		p.Value = &command.Parameter_D{D: w}
+	case string:
+		p.Value = &command.Parameter_S{S: w}
+	case bool:
+		p.Value = &command.Parameter_B{B: w}
+	default:
+		return fmt.Errorf("value of type %s cannot be bound", typeName(v))
+	}
+	b.sql.WriteString("?")
+	b.params = append(b.params, p)
+	return nil
+}
+
+// resolve returns v with all variables replaced by their values, and values
+// decoded from JSON converted to their GraphQL representation.
+func (b *builder) resolve(v interface{}) (interface{}, error) {
+	switch w := v.(type) {
+	case Variable:
+		val, ok := b.vars[string(w)]
+		if !ok {
+			return nil, fmt.Errorf("variable $%s not defined", w)
+		}
+		return b.resolve(val)
+	case Object:
+		obj := make(Object, len(w))
+		for i, f := range w {
+			r, err := b.resolve(f.Value)
+			if err != nil {
+				return nil, err
+			}
+			obj[i] = ObjectField{Name: f.Name, Value: r}
+		}
+		return obj, nil
+	case map[string]interface{}:
+		keys := make([]string, 0, len(w))
+		for k := range w {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		obj := make(Object, len(keys))
+		for i, k := range keys {
+			r, err := b.resolve(w[k])
+			if err != nil {
+				return nil, err
+			}
+			obj[i] = ObjectField{Name: k, Value: r}
+		}
+		return obj, nil
+	case []interface{}:
+		list := make([]interface{}, len(w))
+		for i, e := range w {
+			r, err := b.resolve(e)
+			if err != nil {
+				return nil, err
+			}
+			list[i] = r
+		}
+		return list, nil
+	case json.Number:
+		if i, err := w.Int64(); err == nil {
+			return i, nil
+		}
+		return w.Float64()
+	}
+	return v, nil
+}
+
+func checkArguments(args Object, allowed ...string) error {
+	for _, a := range args {
+		ok := false
+		for _, n := range allowed {
+			if a.Name == n {
+				ok = true
+				break
+			}
+		}
+		if !ok {
+			return fmt.Errorf("unknown argument %s", a.Name)
+		}
+	}
+	return nil
+}
+
+func quote(ident string) string {
+	return `"` + strings.ReplaceAll(ident, `"`, `""`) + `"`
+}
+
+func typeName(v interface{}) string {
+	switch v.(type) {
+	case Object:
+		return "object"
+	case []interface{}:
+		return "list"
+	case Enum:
+		return "enum"
+	}
+	return fmt.Sprintf("%T", v)
+}
@@ -0,0 +1,194 @@
+package graphql
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/rqlite/rqlite/command"
+	"github.com/rqlite/rqlite/db"
+)
+
+func mustOpenTestDB(t *testing.T) (*db.DB, *Schema) {
+	d, err := db.OpenInMemory(false)
+	if err != nil {
+		t.Fatalf("failed to open database: %s", err.Error())
+	}
+	_, err = d.ExecuteStringStmt(`CREATE TABLE users (id INTEGER PRIMARY KEY, name TEXT, age INTEGER);
+		CREATE VIEW adults AS SELECT * FROM users WHERE age >= 18`)
+	if err != nil {
+		t.Fatalf("failed to create schema: %s", err.Error())
+	}
+	rows, err := d.QueryStringStmt(SchemaSQL)
+	if err != nil {
+		t.Fatalf("failed to query schema: %s", err.Error())
+	}
+	s, err := NewSchema(rows[0])
+	if err != nil {
+		t.Fatalf("failed to create schema: %s", err.Error())
+	}
+	return d, s
+}
+
+func mustPlan(t *testing.T, s *Schema, src string, vars map[string]interface{}) *Plan {
+	doc, err := Parse(src)
+	if err != nil {
+		t.Fatalf("failed to parse %q: %s", src, err.Error())
+	}
+	p, err := NewPlan(s, doc, "", vars)
+	if err != nil {
+		t.Fatalf("failed to plan %q: %s", src, err.Error())
+	}
+	return p
+}
+
+func mustJSON(t *testing.T, v interface{}) string {
+	b, err := json.Marshal(v)
+	if err != nil {
+		t.Fatalf("failed to marshal JSON: %s", err.Error())
+	}
+	return string(b)
+}
+
+func Test_Schema(t *testing.T) {
+	d, s := mustOpenTestDB(t)
+	defer d.Close()
+
+	users, ok := s.Table("users")
+	if !ok || users.View || strings.Join(users.Columns, ",") != "id,name,age" {
+		t.Fatalf("wrong users table: %+v", users)
+	}
+	adults, ok := s.Table("adults")
+	if !ok || !adults.View || !adults.HasColumn("age") {
+		t.Fatalf("wrong adults view: %+v", adults)
+	}
+	if _, ok := s.Table("sqlite_master"); ok {
+		t.Fatalf("schema includes internal table")
+	}
+}
+
+func Test_PlanSQL(t *testing.T) {
+	d, s := mustOpenTestDB(t)
+	defer d.Close()
+
+	for _, tt := range []struct {
+		src string
+		sql string
+		n   int
+	}{
+		{`{ users { id name } }`, `SELECT "id", "name" FROM "users"`, 0},
+		{`{ users(where: {id: 1}) { id } }`, `SELECT "id" FROM "users" WHERE ("id" = ?)`, 1},
+		{`{ users(where: {name: null}) { id } }`, `SELECT "id" FROM "users" WHERE ("name" IS NULL)`, 0},
+		{`{ users(where: {age: {gt: 1, lte: 5}, name: {like: "f%"}}) { id } }`,
+			`SELECT "id" FROM "users" WHERE ("age" > ? AND "age" <= ? AND "name" LIKE ?)`, 3},
+		{`{ users(where: {_or: [{id: 1}, {_not: {name: {is_null: false}}}]}) { id } }`,
+			`SELECT "id" FROM "users" WHERE ((("id" = ?) OR (NOT ("name" IS NOT NULL))))`, 1},
+		{`{ users(where: {id: {in: [1, 2]}}) { id } }`, `SELECT "id" FROM "users" WHERE ("id" IN (?, ?))`, 2},
+		{`{ users(order_by: [{age: desc}, {name: asc}], limit: 10, offset: 5) { id } }`,
+			`SELECT "id" FROM "users" ORDER BY "age" DESC, "name" ASC LIMIT ? OFFSET ?`, 2},
+		{`{ users(offset: 5) { id } }`, `SELECT "id" FROM "users" LIMIT -1 OFFSET ?`, 1},
+		{`{ adults { name } }`, `SELECT "name" FROM "adults"`, 0},
+		{`mutation { insert_users(objects: [{name: "a", age: 1}, {age: 2, name: "b"}]) { last_insert_id } }`,
+			`INSERT INTO "users" ("name", "age") VALUES (?, ?), (?, ?)`, 4},
+		{`mutation { insert_users(objects: {}) { last_insert_id } }`, `INSERT INTO "users" DEFAULT VALUES`, 0},
+		{`mutation { update_users(set: {age: 3}, where: {id: 1}) { rows_affected } }`,
+			`UPDATE "users" SET "age" = ? WHERE ("id" = ?)`, 2},
+		{`mutation { delete_users(where: {}) { rows_affected } }`, `DELETE FROM "users"`, 0},
+	} {
+		p := mustPlan(t, s, tt.src, nil)
+		if len(p.Statements) != 1 {
+			t.Fatalf("%s: wrong number of statements, got %d", tt.src, len(p.Statements))
+		}
+		if got := p.Statements[0].Sql; got != tt.sql {
+			t.Fatalf("%s: wrong SQL\nexp: %s\ngot: %s", tt.src, tt.sql, got)
+		}
+		if got := len(p.Statements[0].Parameters); got != tt.n {
+			t.Fatalf("%s: wrong number of parameters, exp %d, got %d", tt.src, tt.n, got)
+		}
+	}
+}
+
+func Test_PlanErrors(t *testing.T) {
+	d, s := mustOpenTestDB(t)
+	defer d.Close()
+
+	for _, src := range []string{
+		`{ nonexistent { id } }`,
+		`{ users }`,
+		`{ users { nonexistent } }`,
+		`{ users { id(x: 1) } }`,
+		`{ users(bad: 1) { id } }`,
+		`{ users(where: {nonexistent: 1}) { id } }`,
+		`{ users(where: {id: {between: 1}}) { id } }`,
+		`{ users(where: {id: {a: 1}}) { id } }`,
+		`{ users(where: {id: {in: 1}}) { id } }`,
+		`{ users(where: {id: [1]}) { id } }`,
+		`{ users(where: 1) { id } }`,
+		`{ users(order_by: {id: sideways}) { id } }`,
+		`{ users(limit: -1) { id } }`,
+		`{ users(where: {id: $undefined}) { id } }`,
+		`mutation { insert_adults(objects: {name: "a"}) { last_insert_id } }`,
+		`mutation { insert_users(objects: []) { last_insert_id } }`,
+		`mutation { insert_users(objects: [{name: "a"}, {age: 1}]) { last_insert_id } }`,
+		`mutation { insert_users(objects: {name: "a"}) { nonexistent } }`,
+		`mutation { update_users(set: {age: 1}) { rows_affected } }`,
+		`mutation { update_users(set: {}, where: {}) { rows_affected } }`,
+		`mutation { delete_users { rows_affected } }`,
+		`mutation { drop_users { rows_affected } }`,
+	} {
+		doc, err := Parse(src)
+		if err != nil {
+			t.Fatalf("failed to parse %q: %s", src, err.Error())
+		}
+		if _, err := NewPlan(s, doc, "", nil); err == nil {
+			t.Fatalf("planning %q succeeded", src)
+		}
+	}
+}
+
+func Test_PlanExecute(t *testing.T) {
+	d, s := mustOpenTestDB(t)
+	defer d.Close()
+
+	p := mustPlan(t, s, `mutation ($rows: [UserInput!]!) {
+		insert_users(objects: $rows) { n: rows_affected last_insert_id }
+		update_users(set: {age: 40}, where: {name: "bob"}) { rows_affected }
+	}`, map[string]interface{}{
+		"rows": []interface{}{
+			map[string]interface{}{"name": "alice", "age": json.Number("30")},
+			map[string]interface{}{"name": "bob", "age": json.Number("12")},
+			map[string]interface{}{"name": "carol", "age": json.Number("17")},
+		},
+	})
+	if !p.Mutation {
+		t.Fatalf("plan not a mutation")
+	}
+	results, err := d.Execute(&command.Request{Statements: p.Statements}, false)
+	if err != nil {
+		t.Fatalf("failed to execute mutation: %s", err.Error())
+	}
+	exp := `{"data":{"insert_users":{"n":3,"last_insert_id":3},"update_users":{"rows_affected":1}}}`
+	if got := mustJSON(t, p.MutationResponse(results)); got != exp {
+		t.Fatalf("wrong mutation response\nexp: %s\ngot: %s", exp, got)
+	}
+
+	p = mustPlan(t, s, `query ($min: Int) {
+		adults(order_by: {name: desc}) { name age }
+		first: users(where: {age: {gte: $min}}, order_by: {id: asc}, limit: 1) { who: name }
+	}`, map[string]interface{}{"min": json.Number("15")})
+	rows, err := d.Query(&command.Request{Statements: p.Statements}, false)
+	if err != nil {
+		t.Fatalf("failed to execute query: %s", err.Error())
+	}
+	exp = `{"data":{"adults":[{"name":"bob","age":40},{"name":"alice","age":30}],"first":[{"who":"alice"}]}}`
+	if got := mustJSON(t, p.QueryResponse(rows)); got != exp {
+		t.Fatalf("wrong query response\nexp: %s\ngot: %s", exp, got)
+	}
+
+	// Errors are reported against the field.
+	resp := p.QueryResponse([]*command.QueryRows{{Error: "no such table"}})
+	exp = `{"data":{"adults":null,"first":null},"errors":[{"message":"no such table","path":["adults"]},{"message":"no result","path":["first"]}]}`
+	if got := mustJSON(t, resp); got != exp {
+		t.Fatalf("wrong error response\nexp: %s\ngot: %s", exp, got)
+	}
+}
@@ -0,0 +1,64 @@
+package graphql
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/rqlite/rqlite/command"
+)
+
+// SchemaSQL is the query which returns the schema of the database, as
+// expected by NewSchema.
+const SchemaSQL = `SELECT m.name, m.type, p.name FROM sqlite_master AS m JOIN pragma_table_info(m.name) AS p ` +
+	`WHERE m.type IN ('table', 'view') AND m.name NOT LIKE 'sqlite_%' ORDER BY m.name, p.cid`
+
+// Table is a table, or view, of the database.
+type Table struct {
+	Name    string
+	View    bool
+	Columns []string
+}
+
+// HasColumn returns whether the table has the named column.
+func (t *Table) HasColumn(name string) bool {
+	for _, c := range t.Columns {
+		if c == name {
+			return true
+		}
+	}
+	return false
+}
+
+// Schema describes the tables of the database which may be accessed.
+type Schema struct {
+	tables map[string]*Table
+}
+
+// NewSchema returns the Schema described by the results of SchemaSQL.
+func NewSchema(rows *command.QueryRows) (*Schema, error) {
+	if rows.Error != "" {
+		return nil, errors.New(rows.Error)
+	}
+
+	s := &Schema{tables: make(map[string]*Table)}
+	for _, v := range rows.Values {
+		params := v.GetParameters()
+		if len(params) != 3 {
+			return nil, fmt.Errorf("schema row has %d columns, expected 3", len(params))
+		}
+		name, typ, col := params[0].GetS(), params[1].GetS(), params[2].GetS()
+		t, ok := s.tables[name]
+		if !ok {
+			t = &Table{Name: name, View: typ == "view"}
+			s.tables[name] = t
+		}
+		t.Columns = append(t.Columns, col)
+	}
+	return s, nil
+}
+
+// Table returns the named table, if any.
+func (s *Schema) Table(name string) (*Table, bool) {
+	t, ok := s.tables[name]
+	return t, ok
+}
@@ -0,0 +1,146 @@
+package http
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/rqlite/rqlite/auth"
+	"github.com/rqlite/rqlite/command"
+	"github.com/rqlite/rqlite/store"
+)
+
+// defaultJoinTokenTTL is how long a join token is valid if the request to
+// create it does not say.
+const defaultJoinTokenTTL = 24 * time.Hour
+
+// joinToken is the JSON representation of a join token.
+type joinToken struct {
+	ID        string     `json:"id"`
+	Token     string     `json:"token,omitempty"`
+	Expires   *time.Time `json:"expires,omitempty"`
+	SingleUse bool       `json:"single_use"`
+	Used      bool       `json:"used,omitempty"`
+}
+
+func newJoinToken(t *command.JoinToken) *joinToken {
+	jt := &joinToken{
+		ID:        t.Id,
+		SingleUse: t.SingleUse,
+		Used:      t.Used,
+	}
+	if t.Expires != 0 {
+		e := time.Unix(0, t.Expires).UTC()
+		jt.Expires = &e
+	}
+	return jt
+}
+
+// handleJoinTokens handles requests to create, list, and revoke the tokens
+// which nodes present to join the cluster. Join tokens are replicated, so
+// changes to them must be served by the leader.
+func (s *Service) handleJoinTokens(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+
+	if !s.CheckRequestPerm(r, auth.PermJoinTokens) {
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+
+	var resp interface{}
+	var err error
+	switch r.Method {
+	case "GET":
+		tokens := make([]*joinToken, 0)
+		for _, t := range s.store.JoinTokens() {
+			tokens = append(tokens, newJoinToken(t))
+		}
+		resp = map[string]interface{}{"tokens": tokens}
+	case "POST":
+		ttl, ttlErr := joinTokenTTLParam(r)
+		if ttlErr != nil {
+			http.Error(w, ttlErr.Error(), http.StatusBadRequest)
+			return
+		}
+		singleUse, paramErr := queryParam(r, "single_use")
+		if paramErr != nil {
+			http.Error(w, paramErr.Error(), http.StatusBadRequest)
+			return
+		}
+		var token string
+		var t *command.JoinToken
+		token, t, err = s.store.CreateJoinToken(ttl, singleUse)
+		if err == nil {
+			jt := newJoinToken(t)
+			jt.Token = token
+			resp = jt
+		}
+	case "DELETE":
+		id := strings.TrimSpace(r.URL.Query().Get("id"))
+		if id == "" {
+			http.Error(w, "join token ID required", http.StatusBadRequest)
+			return
+		}
+		err = s.store.RevokeJoinToken(id)
+		resp = map[string]interface{}{}
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	if err != nil {
+		if errors.Is(err, store.ErrNotLeader) {
+			leaderAPIAddr := s.LeaderAPIAddr()
+			if leaderAPIAddr == "" {
+				stats.Add(numLeaderNotFound, 1)
+				http.Error(w, ErrLeaderNotFound.Error(), http.StatusServiceUnavailable)
+				return
+			}
+			http.Redirect(w, r, s.FormRedirect(r, leaderAPIAddr), http.StatusTemporaryRedirect)
+			return
+		}
+		if errors.Is(err, store.ErrJoinTokenNotFound) {
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
+		}
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	b, err := json.Marshal(resp)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if _, err := w.Write(b); err != nil {
+		s.logger.Println("writing response failed:", err.Error())
+	}
+}
+
+// joinTokenTTLParam returns how long a join token to be created is valid. Zero
+// means the token never expires.
+func joinTokenTTLParam(r *http.Request) (time.Duration, error) {
+	ttl := strings.TrimSpace(r.URL.Query().Get("ttl"))
+	if ttl == "" {
+		return defaultJoinTokenTTL, nil
+	}
+	d, err := time.ParseDuration(ttl)
+	if err != nil {
+		return 0, err
+	}
+	if d < 0 {
+		return 0, errors.New("join token TTL must not be negative")
+	}
+	return d, nil
+}
+
+// isJoinTokenError returns whether err is the refusal of a join request
+// because of its join token.
+func isJoinTokenError(err error) bool {
+	return errors.Is(err, store.ErrJoinTokenRequired) ||
+		errors.Is(err, store.ErrJoinTokenInvalid) ||
+		errors.Is(err, store.ErrJoinTokenExpired) ||
+		errors.Is(err, store.ErrJoinTokenUsed)
+}
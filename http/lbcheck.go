@@ -0,0 +1,99 @@
+package http
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/rqlite/rqlite/auth"
+	"github.com/rqlite/rqlite/store"
+)
+
+// handleLeaderCheck responds with 200 OK only if this node is the Leader, and
+// its leadership has been confirmed by a quorum, so that a load balancer may
+// route writes to it. A Leader which has been cut off from the rest of the
+// cluster fails the check, even before it steps down.
+func (s *Service) handleLeaderCheck(w http.ResponseWriter, r *http.Request) {
+	if !s.CheckRequestPerm(r, auth.PermReady) {
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+
+	if r.Method != "GET" && r.Method != "HEAD" {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	maxAge, err := leaderFreshness(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if !s.store.Ready() {
+		w.WriteHeader(http.StatusServiceUnavailable)
+		w.Write([]byte("[+]node ok\n[+]store not ready"))
+		return
+	}
+
+	if _, err := s.store.VerifyLeaderFreshness(maxAge); err != nil {
+		w.WriteHeader(http.StatusServiceUnavailable)
+		if errors.Is(err, store.ErrNotLeader) {
+			w.Write([]byte("[+]node ok\n[+]node is not leader"))
+			return
+		}
+		w.Write([]byte(fmt.Sprintf("[+]node ok\n[+]leadership not confirmed: %s", err.Error())))
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	w.Write([]byte("[+]node ok\n[+]leader ok"))
+}
+
+// handleFollowerCheck responds with 200 OK only if this node is a follower,
+// of a Leader it knows, and is ready to serve reads, so that a load balancer
+// may route reads to it.
+func (s *Service) handleFollowerCheck(w http.ResponseWriter, r *http.Request) {
+	if !s.CheckRequestPerm(r, auth.PermReady) {
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+
+	if r.Method != "GET" && r.Method != "HEAD" {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	if s.InMaintenance() {
+		w.WriteHeader(http.StatusServiceUnavailable)
+		w.Write([]byte("[+]node in maintenance"))
+		return
+	}
+
+	if !s.store.Ready() {
+		w.WriteHeader(http.StatusServiceUnavailable)
+		w.Write([]byte("[+]node ok\n[+]store not ready"))
+		return
+	}
+
+	if s.store.IsLeader() {
+		w.WriteHeader(http.StatusServiceUnavailable)
+		w.Write([]byte("[+]node ok\n[+]node is leader"))
+		return
+	}
+
+	lAddr, err := s.store.LeaderAddr()
+	if err != nil {
+		http.Error(w, fmt.Sprintf("leader address: %s", err.Error()),
+			http.StatusInternalServerError)
+		return
+	}
+	if lAddr == "" {
+		w.WriteHeader(http.StatusServiceUnavailable)
+		w.Write([]byte("[+]node ok\n[+]leader does not exist"))
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	w.Write([]byte("[+]node ok\n[+]follower ok"))
+}
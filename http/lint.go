@@ -0,0 +1,83 @@
+package http
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"github.com/rqlite/rqlite/auth"
+	"github.com/rqlite/rqlite/command"
+)
+
+const (
+	// RiskyWritesAllow executes risky writes without comment.
+	RiskyWritesAllow = "allow"
+
+	// RiskyWritesWarn executes risky writes, reporting them in the response.
+	RiskyWritesWarn = "warn"
+
+	// RiskyWritesConfirm refuses requests holding risky writes unless they
+	// are confirmed, by the confirm query parameter, by a user holding the
+	// risky-writes permission.
+	RiskyWritesConfirm = "confirm"
+)
+
+// riskyWritesRefusal is the response to a request refused because it holds
+// risky writes which have not been confirmed.
+type riskyWritesRefusal struct {
+	Error    string                `json:"error"`
+	Warnings []*command.RiskyWrite `json:"warnings"`
+}
+
+// checkRiskyWrites checks the statements of a request for risky writes, as
+// set by RiskyWrites, adding any to resp if they are to be reported. It returns
+// false, having written the response, if the request is refused. Dry runs
+// change nothing, so are never refused.
+func (s *Service) checkRiskyWrites(w http.ResponseWriter, r *http.Request, stmts []*command.Statement, resp *Response, dryRun bool) bool {
+	if s.RiskyWrites == "" || s.RiskyWrites == RiskyWritesAllow {
+		return true
+	}
+	risky := command.RiskyWrites(stmts)
+	if len(risky) == 0 {
+		return true
+	}
+	stats.Add(numRiskyWrites, int64(len(risky)))
+	if s.RiskyWrites != RiskyWritesConfirm || dryRun {
+		resp.Warnings = risky
+		return true
+	}
+
+	confirm, err := queryParam(r, "confirm")
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return false
+	}
+	refusal := &riskyWritesRefusal{Warnings: risky}
+	status := http.StatusPreconditionRequired
+	if !confirm {
+		refusal.Error = "request holds risky writes, add confirm to execute them"
+	} else if !s.CheckRequestPerm(r, auth.PermRiskyWrites) {
+		refusal.Error = fmt.Sprintf("confirming risky writes requires the %s permission", auth.PermRiskyWrites)
+		status = http.StatusForbidden
+	} else {
+		resp.Warnings = risky
+		return true
+	}
+
+	stats.Add(numRiskyWritesRefused, 1)
+	var b []byte
+	if pretty, _ := isPretty(r); pretty {
+		b, err = json.MarshalIndent(refusal, "", "    ")
+	} else {
+		b, err = json.Marshal(refusal)
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return false
+	}
+	w.WriteHeader(status)
+	if _, err := w.Write(b); err != nil {
+		s.logger.Println("writing response failed:", err.Error())
+	}
+	return false
+}
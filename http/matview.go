@@ -0,0 +1,166 @@
+package http
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/rqlite/rqlite/auth"
+	"github.com/rqlite/rqlite/store"
+)
+
+// materializedView is the JSON representation of a materialized view.
+type materializedView struct {
+	Name        string     `json:"name"`
+	Query       string     `json:"query"`
+	Sources     []string   `json:"sources,omitempty"`
+	OnWrite     bool       `json:"on_write"`
+	Interval    string     `json:"interval,omitempty"`
+	RefreshedAt *time.Time `json:"refreshed_at,omitempty"`
+}
+
+func newMaterializedView(mv *store.MaterializedView) *materializedView {
+	v := &materializedView{
+		Name:    mv.Name,
+		Query:   mv.Query,
+		Sources: mv.Sources,
+		OnWrite: mv.OnWrite,
+	}
+	if mv.Interval > 0 {
+		v.Interval = mv.Interval.String()
+	}
+	if !mv.RefreshedAt.IsZero() {
+		t := mv.RefreshedAt
+		v.RefreshedAt = &t
+	}
+	return v
+}
+
+// handleMaterializedViews handles requests to list, create, refresh and drop
+// materialized views. Listing views requires the query permission, and
+// changing them the execute permission. Changes are replicated, so must be
+// served by the leader.
+func (s *Service) handleMaterializedViews(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+
+	perm := auth.PermExecute
+	if r.Method == "GET" {
+		perm = auth.PermQuery
+	}
+	if !s.CheckRequestPerm(r, perm) {
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+
+	var resp interface{}
+	var err error
+	switch r.Method {
+	case "GET":
+		var mvs []*store.MaterializedView
+		mvs, err = s.store.MaterializedViews()
+		views := make([]*materializedView, 0, len(mvs))
+		for _, mv := range mvs {
+			views = append(views, newMaterializedView(mv))
+		}
+		resp = map[string]interface{}{"views": views}
+	case "POST":
+		refresh, paramErr := queryParam(r, "refresh")
+		if paramErr != nil {
+			http.Error(w, paramErr.Error(), http.StatusBadRequest)
+			return
+		}
+		if refresh {
+			name := strings.TrimSpace(r.URL.Query().Get("name"))
+			if name == "" {
+				http.Error(w, "materialized view name required", http.StatusBadRequest)
+				return
+			}
+			err = s.store.RefreshMaterializedView(name)
+			resp = map[string]interface{}{}
+			break
+		}
+
+		mv, parseErr := parseMaterializedView(r.Body)
+		if parseErr != nil {
+			http.Error(w, parseErr.Error(), http.StatusBadRequest)
+			return
+		}
+		if err = s.store.CreateMaterializedView(mv); err == nil {
+			resp = newMaterializedView(mv)
+		}
+	case "DELETE":
+		name := strings.TrimSpace(r.URL.Query().Get("name"))
+		if name == "" {
+			http.Error(w, "materialized view name required", http.StatusBadRequest)
+			return
+		}
+		err = s.store.DropMaterializedView(name)
+		resp = map[string]interface{}{}
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	if err != nil {
+		if errors.Is(err, store.ErrNotLeader) {
+			leaderAPIAddr := s.LeaderAPIAddr()
+			if leaderAPIAddr == "" {
+				stats.Add(numLeaderNotFound, 1)
+				http.Error(w, ErrLeaderNotFound.Error(), http.StatusServiceUnavailable)
+				return
+			}
+			http.Redirect(w, r, s.FormRedirect(r, leaderAPIAddr), http.StatusTemporaryRedirect)
+			return
+		}
+		if errors.Is(err, store.ErrMatViewNotFound) {
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
+		}
+		if errors.Is(err, store.ErrMatViewInvalid) {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	b, err := json.Marshal(resp)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if _, err := w.Write(b); err != nil {
+		s.logger.Println("writing response failed:", err.Error())
+	}
+}
+
+// parseMaterializedView parses the definition of a materialized view from the
+// body of a request to create it.
+func parseMaterializedView(r io.Reader) (*store.MaterializedView, error) {
+	var v materializedView
+	if err := json.NewDecoder(r).Decode(&v); err != nil {
+		return nil, err
+	}
+	mv := &store.MaterializedView{
+		Name:    strings.TrimSpace(v.Name),
+		Query:   strings.TrimSpace(v.Query),
+		OnWrite: v.OnWrite,
+	}
+	if mv.Name == "" || mv.Query == "" {
+		return nil, errors.New("materialized view name and query required")
+	}
+	if v.Interval != "" {
+		d, err := time.ParseDuration(v.Interval)
+		if err != nil {
+			return nil, err
+		}
+		if d <= 0 {
+			return nil, errors.New("materialized view interval must be positive")
+		}
+		mv.Interval = d
+	}
+	return mv, nil
+}
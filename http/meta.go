@@ -0,0 +1,101 @@
+package http
+
+import (
+	"net/http"
+
+	"github.com/rqlite/rqlite/command"
+)
+
+// ResponseMeta describes how a request was served. It is included in a
+// response if the request sets the meta query param, so that questions of
+// consistency can be answered without access to the logs of each node.
+type ResponseMeta struct {
+	// NodeID is the ID of the node which received the request.
+	NodeID string `json:"node_id,omitempty"`
+
+	// Forwarded is whether the request was forwarded to the leader, rather
+	// than served by the node which received it.
+	Forwarded bool `json:"forwarded"`
+
+	// ServedBy is the Raft address of the node which served the request, if
+	// it was forwarded.
+	ServedBy string `json:"served_by,omitempty"`
+
+	// RaftIndex is the index of the Raft log entry which carried the request,
+	// if any.
+	RaftIndex uint64 `json:"raft_index,omitempty"`
+
+	// AppliedIndex is the index of the last Raft log entry applied by the
+	// node which received the request, once the request was served.
+	AppliedIndex uint64 `json:"applied_index"`
+
+	// SchemaVersion is the version of the schema of the database of the
+	// node which received the request, once the request was served.
+	SchemaVersion int64 `json:"schema_version"`
+
+	// SQLiteTime is the time, in seconds, SQLite took to execute the
+	// statements of the request.
+	SQLiteTime float64 `json:"sqlite_time"`
+}
+
+// isMeta returns whether response metadata is requested.
+func isMeta(req *http.Request) (bool, error) {
+	return queryParam(req, "meta")
+}
+
+// newResponseMeta returns the metadata for a request served by the node at
+// servedBy, or by this node if servedBy is empty.
+func (s *Service) newResponseMeta(servedBy string, idx uint64) *ResponseMeta {
+	m := &ResponseMeta{
+		NodeID:       s.NodeID,
+		Forwarded:    servedBy != "",
+		ServedBy:     servedBy,
+		RaftIndex:    idx,
+		AppliedIndex: s.store.AppliedIndex(),
+	}
+	if v, err := s.store.SchemaVersion(); err == nil {
+		m.SchemaVersion = v
+	}
+	return m
+}
+
+// executeTime returns the total time taken to execute results, clearing the
+// time of each result unless keep is set.
+func executeTime(results []*command.ExecuteResult, keep bool) float64 {
+	var t float64
+	for _, r := range results {
+		t += r.Time
+		if !keep {
+			r.Time = 0
+		}
+	}
+	return t
+}
+
+// queryTime returns the total time taken to produce rows, clearing the time of
+// each set of rows unless keep is set.
+func queryTime(rows []*command.QueryRows, keep bool) float64 {
+	var t float64
+	for _, r := range rows {
+		t += r.Time
+		if !keep {
+			r.Time = 0
+		}
+	}
+	return t
+}
+
+// requestTime returns the total time taken to produce responses, clearing the
+// time of each response unless keep is set.
+func requestTime(responses []*command.ExecuteQueryResponse, keep bool) float64 {
+	var t float64
+	for _, r := range responses {
+		switch v := r.Result.(type) {
+		case *command.ExecuteQueryResponse_Q:
+			t += queryTime([]*command.QueryRows{v.Q}, keep)
+		case *command.ExecuteQueryResponse_E:
+			t += executeTime([]*command.ExecuteResult{v.E}, keep)
+		}
+	}
+	return t
+}
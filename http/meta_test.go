@@ -0,0 +1,115 @@
+package http
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/rqlite/rqlite/command"
+	"github.com/rqlite/rqlite/store"
+)
+
+func Test_ResponseMeta(t *testing.T) {
+	m := &MockStore{
+		leaderAddr:    "foo:1234",
+		raftIndex:     7,
+		appliedIndex:  5,
+		schemaVersion: 3,
+	}
+	var timings bool
+	var minSchema int64
+	m.queryFn = func(qr *command.QueryRequest) ([]*command.QueryRows, error) {
+		timings = qr.Timings
+		minSchema = qr.MinSchemaVersion
+		return []*command.QueryRows{{Columns: []string{"id"}, Types: []string{"integer"}, Time: 0.25}}, nil
+	}
+	m.executeFn = func(er *command.ExecuteRequest) ([]*command.ExecuteResult, error) {
+		return []*command.ExecuteResult{{RowsAffected: 1, Time: 0.5}, {RowsAffected: 1, Time: 0.25}}, nil
+	}
+	c := &mockClusterService{}
+	c.queryFn = func(qr *command.QueryRequest, addr string, t time.Duration) ([]*command.QueryRows, error) {
+		minSchema = qr.MinSchemaVersion
+		return []*command.QueryRows{{Columns: []string{"id"}, Types: []string{"integer"}, Time: 0.5}}, nil
+	}
+	s := New("127.0.0.1:0", m, c, nil)
+	s.NodeID = "node1"
+	if err := s.Start(); err != nil {
+		t.Fatalf("failed to start service")
+	}
+	defer s.Close()
+	host := fmt.Sprintf("http://%s", s.Addr().String())
+
+	decode := func(resp *http.Response, err error) map[string]interface{} {
+		if err != nil {
+			t.Fatalf("failed to make request: %s", err)
+		}
+		defer resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			t.Fatalf("wrong status code, exp 200, got %d", resp.StatusCode)
+		}
+		var r map[string]interface{}
+		if err := json.NewDecoder(resp.Body).Decode(&r); err != nil {
+			t.Fatalf("failed to decode response: %s", err)
+		}
+		return r
+	}
+	query := func(params string) map[string]interface{} {
+		return decode(http.Get(host + "/db/query?q=" + url.QueryEscape("SELECT * FROM foo") + params))
+	}
+	asJSON := func(v interface{}) string {
+		b, err := json.Marshal(v)
+		if err != nil {
+			t.Fatalf("failed to marshal: %s", err)
+		}
+		return string(b)
+	}
+
+	if r := query(""); r["meta"] != nil || timings {
+		t.Fatalf("metadata reported when not requested: %v", r)
+	}
+
+	r := query("&meta")
+	if !timings {
+		t.Fatalf("timings not requested from store for metadata")
+	}
+	if exp, got := `{"applied_index":5,"forwarded":false,"node_id":"node1","schema_version":3,"sqlite_time":0.25}`, asJSON(r["meta"]); exp != got {
+		t.Fatalf("wrong metadata, exp %s, got %s", exp, got)
+	}
+	if exp, got := `[{"columns":["id"],"types":["integer"]}]`, asJSON(r["results"]); exp != got {
+		t.Fatalf("timings reported when not requested, exp %s, got %s", exp, got)
+	}
+	if exp, got := `[{"columns":["id"],"time":0.25,"types":["integer"]}]`, asJSON(query("&meta&timings")["results"]); exp != got {
+		t.Fatalf("timings not reported when requested, exp %s, got %s", exp, got)
+	}
+
+	r = decode(http.Post(host+"/db/execute?meta", "application/json",
+		strings.NewReader(`["INSERT INTO foo VALUES(1)", "INSERT INTO foo VALUES(2)"]`)))
+	if exp, got := `{"applied_index":5,"forwarded":false,"node_id":"node1","raft_index":7,"schema_version":3,"sqlite_time":0.75}`, asJSON(r["meta"]); exp != got {
+		t.Fatalf("wrong metadata for execute, exp %s, got %s", exp, got)
+	}
+
+	m.queryFn = func(qr *command.QueryRequest) ([]*command.QueryRows, error) {
+		return nil, store.ErrNotLeader
+	}
+	r = query("&meta")
+	if exp, got := `{"applied_index":5,"forwarded":true,"node_id":"node1","schema_version":3,"served_by":"foo:1234","sqlite_time":0.5}`, asJSON(r["meta"]); exp != got {
+		t.Fatalf("wrong metadata for forwarded query, exp %s, got %s", exp, got)
+	}
+
+	query("&min_schema_version=2")
+	if minSchema != 2 {
+		t.Fatalf("minimum schema version not passed to leader, got %d", minSchema)
+	}
+	resp, err := http.Get(host + "/db/query?q=" + url.QueryEscape("SELECT * FROM foo") + "&min_schema_version=bad")
+	if err != nil {
+		t.Fatalf("failed to make request: %s", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusBadRequest {
+		t.Fatalf("wrong status code for invalid minimum schema version, exp %d, got %d", http.StatusBadRequest, resp.StatusCode)
+	}
+}
@@ -0,0 +1,121 @@
+package http
+
+import (
+	"container/list"
+	"crypto/sha256"
+	"expvar"
+	"sync"
+
+	"github.com/rqlite/rqlite/command"
+	"google.golang.org/protobuf/proto"
+)
+
+// parseCacheMaxBody is the size of the largest request body whose parsed
+// statements are cached. Larger bodies, such as bulk loads, are rarely
+// repeated, and would quickly fill the cache.
+const parseCacheMaxBody = 64 * 1024
+
+// parseCache caches the statements parsed from request bodies, keyed by the
+// hash of each body, so that identical requests, such as those repeated by
+// retrying clients and ORMs, are parsed only once. The least recently used
+// entries are evicted once the cache holds its maximum.
+type parseCache struct {
+	max int
+
+	mu      sync.Mutex
+	entries map[[sha256.Size]byte]*list.Element
+	lru     *list.List // Front is most recently used.
+}
+
+type parseCacheEntry struct {
+	key   [sha256.Size]byte
+	stmts []*command.Statement
+}
+
+// newParseCache returns a parseCache holding at most max request bodies.
+func newParseCache(max int) *parseCache {
+	return &parseCache{
+		max:     max,
+		entries: make(map[[sha256.Size]byte]*list.Element),
+		lru:     list.New(),
+	}
+}
+
+// Parse returns the statements of the request body b, as ParseRequest does.
+// The statements returned are always copies, so may be modified by the caller.
+func (p *parseCache) Parse(b []byte) ([]*command.Statement, error) {
+	if len(b) > parseCacheMaxBody {
+		return ParseRequest(b)
+	}
+	key := sha256.Sum256(b)
+
+	p.mu.Lock()
+	e, ok := p.entries[key]
+	if ok {
+		p.lru.MoveToFront(e)
+	}
+	p.mu.Unlock()
+	if ok {
+		stats.Add(numParseCacheHits, 1)
+		return cloneStatements(e.Value.(*parseCacheEntry).stmts), nil
+	}
+
+	stats.Add(numParseCacheMisses, 1)
+	stmts, err := ParseRequest(b)
+	if err != nil {
+		return nil, err
+	}
+	cached := cloneStatements(stmts)
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if _, ok := p.entries[key]; !ok {
+		p.entries[key] = p.lru.PushFront(&parseCacheEntry{key: key, stmts: cached})
+		for p.lru.Len() > p.max {
+			oldest := p.lru.Back()
+			p.lru.Remove(oldest)
+			delete(p.entries, oldest.Value.(*parseCacheEntry).key)
+			stats.Add(numParseCacheEvictions, 1)
+		}
+	}
+	return stmts, nil
+}
+
+// Len returns the number of request bodies cached.
+func (p *parseCache) Len() int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.lru.Len()
+}
+
+// parseRequest returns the statements of the request body b, using the parse
+// cache if enabled.
+func (s *Service) parseRequest(b []byte) ([]*command.Statement, error) {
+	if s.parseCache == nil {
+		return ParseRequest(b)
+	}
+	return s.parseCache.Parse(b)
+}
+
+// parseCacheStatus returns the status of the parse cache.
+func (s *Service) parseCacheStatus() map[string]interface{} {
+	hits := stats.Get(numParseCacheHits).(*expvar.Int).Value()
+	misses := stats.Get(numParseCacheMisses).(*expvar.Int).Value()
+	var hitRate float64
+	if hits+misses > 0 {
+		hitRate = float64(hits) / float64(hits+misses)
+	}
+	return map[string]interface{}{
+		"max_entries": s.ParseCacheSize,
+		"entries":     s.parseCache.Len(),
+		"hit_rate":    hitRate,
+	}
+}
+
+func cloneStatements(stmts []*command.Statement) []*command.Statement {
+	c := make([]*command.Statement, len(stmts))
+	for i := range stmts {
+		c[i] = proto.Clone(stmts[i]).(*command.Statement)
+	}
+	return c
+}
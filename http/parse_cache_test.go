@@ -0,0 +1,74 @@
+package http
+
+import (
+	"crypto/sha256"
+	"expvar"
+	"strings"
+	"testing"
+)
+
+func Test_ParseCache(t *testing.T) {
+	ResetStats()
+	defer ResetStats()
+	hits := func() int64 { return stats.Get(numParseCacheHits).(*expvar.Int).Value() }
+	misses := func() int64 { return stats.Get(numParseCacheMisses).(*expvar.Int).Value() }
+
+	p := newParseCache(2)
+	body := []byte(`[["INSERT INTO foo(name) VALUES(?)", "fiona"]]`)
+
+	stmts, err := p.Parse(body)
+	if err != nil {
+		t.Fatalf("failed to parse: %s", err.Error())
+	}
+	if hits() != 0 || misses() != 1 {
+		t.Fatalf("wrong stats after first parse, hits %d, misses %d", hits(), misses())
+	}
+
+	// Changes to the statements returned must not reach the cache.
+	stmts[0].Sql = "DELETE FROM foo"
+	stmts, err = p.Parse(body)
+	if err != nil {
+		t.Fatalf("failed to parse: %s", err.Error())
+	}
+	if hits() != 1 || misses() != 1 {
+		t.Fatalf("wrong stats after second parse, hits %d, misses %d", hits(), misses())
+	}
+	if exp, got := "INSERT INTO foo(name) VALUES(?)", stmts[0].Sql; exp != got {
+		t.Fatalf("cached statement modified, exp %s, got %s", exp, got)
+	}
+	if exp, got := "fiona", stmts[0].Parameters[0].GetS(); exp != got {
+		t.Fatalf("wrong cached parameter, exp %s, got %s", exp, got)
+	}
+
+	// The least recently used body is evicted.
+	if _, err := p.Parse([]byte(`["SELECT 1"]`)); err != nil {
+		t.Fatalf("failed to parse: %s", err.Error())
+	}
+	if _, err := p.Parse(body); err != nil {
+		t.Fatalf("failed to parse: %s", err.Error())
+	}
+	if _, err := p.Parse([]byte(`["SELECT 2"]`)); err != nil {
+		t.Fatalf("failed to parse: %s", err.Error())
+	}
+	if p.Len() != 2 {
+		t.Fatalf("wrong cache size, exp 2, got %d", p.Len())
+	}
+	if _, ok := p.entries[sha256.Sum256([]byte(`["SELECT 1"]`))]; ok {
+		t.Fatalf("least recently used body not evicted")
+	}
+	if _, ok := p.entries[sha256.Sum256(body)]; !ok {
+		t.Fatalf("recently used body evicted")
+	}
+
+	// Invalid bodies are not cached, and large bodies bypass the cache.
+	if _, err := p.Parse([]byte(`not JSON`)); err != ErrInvalidJSON {
+		t.Fatalf("wrong error for invalid body: %v", err)
+	}
+	large := []byte(`["SELECT '` + strings.Repeat("x", parseCacheMaxBody) + `'"]`)
+	if _, err := p.Parse(large); err != nil {
+		t.Fatalf("failed to parse large body: %s", err.Error())
+	}
+	if p.Len() != 2 {
+		t.Fatalf("wrong cache size after uncached bodies, exp 2, got %d", p.Len())
+	}
+}
@@ -0,0 +1,118 @@
+package http
+
+import (
+	"net/http"
+	"sync"
+	"time"
+)
+
+// queryLimiter limits the number of queries each user may have in flight, so
+// that no single user can occupy every connection available for reads. Queries
+// beyond the limit wait for one of the user's earlier queries to complete.
+type queryLimiter struct {
+	max  int
+	wait time.Duration
+
+	mu    sync.Mutex
+	users map[string]*userQueries
+}
+
+// userQueries tracks the queries of a single user.
+type userQueries struct {
+	slots chan struct{} // Holds a value for each query in flight.
+	refs  int           // Queries in flight or waiting.
+}
+
+// newQueryLimiter returns a queryLimiter which allows each user max queries
+// in flight, with further queries waiting at most wait for one to complete.
+func newQueryLimiter(max int, wait time.Duration) *queryLimiter {
+	return &queryLimiter{
+		max:   max,
+		wait:  wait,
+		users: make(map[string]*userQueries),
+	}
+}
+
+// Acquire waits until the user may make a query. It returns a function which
+// must be called once the query completes, or false if the user still had max
+// queries in flight after waiting.
+func (q *queryLimiter) Acquire(user string) (func(), bool) {
+	q.mu.Lock()
+	u, ok := q.users[user]
+	if !ok {
+		u = &userQueries{slots: make(chan struct{}, q.max)}
+		q.users[user] = u
+	}
+	u.refs++
+	q.mu.Unlock()
+
+	select {
+	case u.slots <- struct{}{}:
+	default:
+		tmr := time.NewTimer(q.wait)
+		defer tmr.Stop()
+		select {
+		case u.slots <- struct{}{}:
+		case <-tmr.C:
+			q.unref(user, u)
+			return nil, false
+		}
+	}
+
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			<-u.slots
+			q.unref(user, u)
+		})
+	}, true
+}
+
+// InFlight returns the number of queries in flight for each user with any.
+func (q *queryLimiter) InFlight() map[string]int {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	m := make(map[string]int)
+	for user, u := range q.users {
+		if n := len(u.slots); n > 0 {
+			m[user] = n
+		}
+	}
+	return m
+}
+
+// unref forgets u once it has no queries in flight or waiting.
+func (q *queryLimiter) unref(user string, u *userQueries) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if u.refs--; u.refs == 0 {
+		delete(q.users, user)
+	}
+}
+
+// acquireQuerySlot waits until the user of r may make a query, returning the
+// function to call once it completes. If the user has too many queries in
+// flight, an error is written to w and false is returned. Requests without
+// credentials are all limited as a single user.
+func (s *Service) acquireQuerySlot(w http.ResponseWriter, r *http.Request) (func(), bool) {
+	if s.queryLimiter == nil {
+		return func() {}, true
+	}
+	username, _, _ := r.BasicAuth()
+	release, ok := s.queryLimiter.Acquire(username)
+	if !ok {
+		stats.Add(numQueriesLimited, 1)
+		http.Error(w, ErrQueryLimit.Error(), http.StatusTooManyRequests)
+		return nil, false
+	}
+	return release, true
+}
+
+// queryLimiterStatus returns the status of the query limiter.
+func (s *Service) queryLimiterStatus() map[string]interface{} {
+	return map[string]interface{}{
+		"max_per_user": s.MaxUserQueries,
+		"wait":         s.UserQueryWait.String(),
+		"in_flight":    s.queryLimiter.InFlight(),
+	}
+}
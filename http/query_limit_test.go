@@ -0,0 +1,129 @@
+package http
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/rqlite/rqlite/auth"
+	"github.com/rqlite/rqlite/command"
+)
+
+func Test_QueryLimiter(t *testing.T) {
+	q := newQueryLimiter(2, 50*time.Millisecond)
+
+	r1, ok := q.Acquire("bob")
+	if !ok {
+		t.Fatalf("first query refused")
+	}
+	r2, ok := q.Acquire("bob")
+	if !ok {
+		t.Fatalf("second query refused")
+	}
+	if _, ok := q.Acquire("bob"); ok {
+		t.Fatalf("query beyond limit allowed")
+	}
+	r3, ok := q.Acquire("alice")
+	if !ok {
+		t.Fatalf("other user's query refused")
+	}
+	if exp, got := map[string]int{"alice": 1, "bob": 2}, q.InFlight(); !reflect.DeepEqual(exp, got) {
+		t.Fatalf("wrong in-flight queries, exp %v, got %v", exp, got)
+	}
+
+	// A waiting query proceeds once another completes.
+	go func() {
+		time.Sleep(10 * time.Millisecond)
+		r1()
+	}()
+	r4, ok := q.Acquire("bob")
+	if !ok {
+		t.Fatalf("waiting query refused")
+	}
+
+	// Releasing twice has no further effect.
+	r3()
+	r3()
+	r2()
+	r4()
+	if n := len(q.InFlight()); n != 0 {
+		t.Fatalf("queries still in flight: %d", n)
+	}
+	if n := len(q.users); n != 0 {
+		t.Fatalf("users still tracked: %d", n)
+	}
+}
+
+func Test_QueryLimiterService(t *testing.T) {
+	c := auth.NewCredentialsStore()
+	if err := c.Load(strings.NewReader(`[
+		{"username": "bob", "password": "secret1", "perms": ["query", "status"]},
+		{"username": "alice", "password": "secret2", "perms": ["query"]}
+	]`)); err != nil {
+		t.Fatalf("failed to load credentials: %s", err.Error())
+	}
+
+	unblock := make(chan struct{})
+	started := make(chan struct{})
+	m := &MockStore{}
+	m.queryFn = func(qr *command.QueryRequest) ([]*command.QueryRows, error) {
+		if qr.Request.Statements[0].Sql == "SELECT slow" {
+			started <- struct{}{}
+			<-unblock
+		}
+		return nil, nil
+	}
+	s := New("127.0.0.1:0", m, &mockClusterService{}, c)
+	s.MaxUserQueries = 1
+	s.UserQueryWait = 10 * time.Millisecond
+	if err := s.Start(); err != nil {
+		t.Fatalf("failed to start service")
+	}
+	defer s.Close()
+	host := fmt.Sprintf("http://%s", s.Addr().String())
+
+	client := &http.Client{}
+	query := func(username, password, q string) int {
+		t.Helper()
+		req, err := http.NewRequest("GET", host+"/db/query?q="+url.QueryEscape(q), nil)
+		if err != nil {
+			t.Fatalf("failed to create request: %s", err.Error())
+		}
+		req.SetBasicAuth(username, password)
+		resp, err := client.Do(req)
+		if err != nil {
+			t.Fatalf("failed to make request: %s", err.Error())
+		}
+		resp.Body.Close()
+		return resp.StatusCode
+	}
+
+	done := make(chan int)
+	go func() {
+		done <- query("bob", "secret1", "SELECT slow")
+	}()
+	<-started
+
+	if code := query("bob", "secret1", "SELECT 1"); code != http.StatusTooManyRequests {
+		t.Fatalf("query beyond limit not refused, got %d", code)
+	}
+	if code := query("alice", "secret2", "SELECT 1"); code != http.StatusOK {
+		t.Fatalf("other user's query refused, got %d", code)
+	}
+	status := s.queryLimiterStatus()
+	if exp, got := map[string]int{"bob": 1}, status["in_flight"]; !reflect.DeepEqual(exp, got) {
+		t.Fatalf("wrong in-flight queries, exp %v, got %v", exp, got)
+	}
+
+	close(unblock)
+	if code := <-done; code != http.StatusOK {
+		t.Fatalf("slow query failed, got %d", code)
+	}
+	if code := query("bob", "secret1", "SELECT 1"); code != http.StatusOK {
+		t.Fatalf("query after slow query refused, got %d", code)
+	}
+}
@@ -0,0 +1,133 @@
+package http
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/rqlite/rqlite/auth"
+	"github.com/rqlite/rqlite/command"
+)
+
+// redactedColumns returns the columns to strip from the query responses to r,
+// as set by RedactedColumns, keyed by lower-case name. It returns nil if no
+// columns are redacted, or the user of r holds the unredacted permission.
+// Whatever the statement which read them, columns are matched by the name
+// they have in the response, so a redacted column also names any other column
+// with the same name, in any table.
+func (s *Service) redactedColumns(r *http.Request) map[string]bool {
+	if len(s.RedactedColumns) == 0 {
+		return nil
+	}
+	if s.credentialStore != nil {
+		username, password, _ := r.BasicAuth()
+		if s.credentialStore.AA(username, password, auth.PermUnredacted) {
+			return nil
+		}
+	}
+	cols := make(map[string]bool, len(s.RedactedColumns))
+	for _, c := range s.RedactedColumns {
+		cols[strings.ToLower(c)] = true
+	}
+	return cols
+}
+
+// redactRows returns rows with the given columns stripped. If keepShape is
+// set the columns remain, but every value they hold is replaced by null, so
+// that the position of each column is unchanged. rows is not modified, since
+// it may be shared.
+func redactRows(rows []*command.QueryRows, cols map[string]bool, keepShape bool) []*command.QueryRows {
+	if len(cols) == 0 || rows == nil {
+		return rows
+	}
+	redacted := make([]*command.QueryRows, len(rows))
+	for i, r := range rows {
+		redacted[i] = redactQueryRows(r, cols, keepShape)
+	}
+	return redacted
+}
+
+// redactResponses is like redactRows, for the results of a request which may
+// hold both writes and queries.
+func redactResponses(resps []*command.ExecuteQueryResponse, cols map[string]bool) []*command.ExecuteQueryResponse {
+	if len(cols) == 0 || resps == nil {
+		return resps
+	}
+	redacted := make([]*command.ExecuteQueryResponse, len(resps))
+	for i, r := range resps {
+		q := r.GetQ()
+		if q == nil {
+			redacted[i] = r
+			continue
+		}
+		redacted[i] = &command.ExecuteQueryResponse{
+			Result: &command.ExecuteQueryResponse_Q{Q: redactQueryRows(q, cols, false)},
+		}
+	}
+	return redacted
+}
+
+// redactQueryRows returns r with the given columns redacted, or r itself if
+// it has none of them.
+func redactQueryRows(r *command.QueryRows, cols map[string]bool, keepShape bool) *command.QueryRows {
+	var keep []int
+	n := 0
+	for i, c := range r.Columns {
+		if cols[strings.ToLower(c)] {
+			n++
+			continue
+		}
+		keep = append(keep, i)
+	}
+	if n == 0 {
+		return r
+	}
+	stats.Add(numRedactedColumns, int64(n))
+
+	if keepShape {
+		values := make([]*command.Values, len(r.Values))
+		for j, v := range r.Values {
+			params := make([]*command.Parameter, len(v.Parameters))
+			for k, p := range v.Parameters {
+				if k < len(r.Columns) && cols[strings.ToLower(r.Columns[k])] {
+					params[k] = &command.Parameter{}
+				} else {
+					params[k] = p
+				}
+			}
+			values[j] = &command.Values{Parameters: params}
+		}
+		return &command.QueryRows{
+			Columns: r.Columns,
+			Types:   r.Types,
+			Values:  values,
+			Error:   r.Error,
+			Time:    r.Time,
+		}
+	}
+
+	redacted := &command.QueryRows{
+		Columns: make([]string, 0, len(keep)),
+		Values:  make([]*command.Values, len(r.Values)),
+		Error:   r.Error,
+		Time:    r.Time,
+	}
+	if r.Types != nil {
+		redacted.Types = make([]string, 0, len(keep))
+	}
+	for _, i := range keep {
+		redacted.Columns = append(redacted.Columns, r.Columns[i])
+		if i < len(r.Types) {
+			redacted.Types = append(redacted.Types, r.Types[i])
+		}
+	}
+	for j, v := range r.Values {
+		params := make([]*command.Parameter, 0, len(keep))
+		for _, i := range keep {
+			if i < len(v.Parameters) {
+				params = append(params, v.Parameters[i])
+			}
+		}
+		redacted.Values[j] = &command.Values{Parameters: params}
+	}
+	return redacted
+}
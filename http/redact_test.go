@@ -0,0 +1,144 @@
+package http
+
+import (
+	"expvar"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/rqlite/rqlite/auth"
+	"github.com/rqlite/rqlite/command"
+	"github.com/rqlite/rqlite/command/encoding"
+)
+
+func Test_RedactedColumns(t *testing.T) {
+	c := auth.NewCredentialsStore()
+	if err := c.Load(strings.NewReader(`[
+		{"username": "admin", "password": "password1", "perms": ["query", "unredacted"]},
+		{"username": "dev", "password": "password2", "perms": ["query", "execute"]}
+	]`)); err != nil {
+		t.Fatalf("failed to load credentials: %s", err.Error())
+	}
+
+	rows := func() *command.QueryRows {
+		return &command.QueryRows{
+			Columns: []string{"id", "Password_Hash", "name"},
+			Types:   []string{"integer", "text", "text"},
+			Values: []*command.Values{{
+				Parameters: []*command.Parameter{
+					{Value: &command.Parameter_I{I: 1}},
+					{Value: &command.Parameter_S{S: "secret"}},
+					{Value: &command.Parameter_S{S: "fiona"}},
+				},
+			}},
+		}
+	}
+	m := &MockStore{}
+	m.queryFn = func(qr *command.QueryRequest) ([]*command.QueryRows, error) {
+		return []*command.QueryRows{rows()}, nil
+	}
+	m.requestFn = func(eqr *command.ExecuteQueryRequest) ([]*command.ExecuteQueryResponse, error) {
+		return []*command.ExecuteQueryResponse{
+			{Result: &command.ExecuteQueryResponse_E{E: &command.ExecuteResult{RowsAffected: 1}}},
+			{Result: &command.ExecuteQueryResponse_Q{Q: rows()}},
+		}, nil
+	}
+	s := New("127.0.0.1:0", m, &mockClusterService{}, c)
+	s.RedactedColumns = []string{"password_hash", "ssn"}
+	if err := s.Start(); err != nil {
+		t.Fatalf("failed to start service")
+	}
+	defer s.Close()
+	host := fmt.Sprintf("http://%s", s.Addr().String())
+
+	client := &http.Client{}
+	get := func(path, username, password string) string {
+		t.Helper()
+		method, stmts := "GET", io.Reader(nil)
+		if strings.HasPrefix(path, "/db/request") {
+			method, stmts = "POST", strings.NewReader(`["SELECT * FROM foo"]`)
+		}
+		req, err := http.NewRequest(method, host+path, stmts)
+		if err != nil {
+			t.Fatalf("failed to create request: %s", err.Error())
+		}
+		req.SetBasicAuth(username, password)
+		resp, err := client.Do(req)
+		if err != nil {
+			t.Fatalf("failed to make request: %s", err.Error())
+		}
+		defer resp.Body.Close()
+		body, err := io.ReadAll(resp.Body)
+		if err != nil {
+			t.Fatalf("failed to read response body: %s", err.Error())
+		}
+		if resp.StatusCode != http.StatusOK {
+			t.Fatalf("wrong status code for %s, exp 200, got %d: %s", path, resp.StatusCode, body)
+		}
+		return string(body)
+	}
+
+	ResetStats()
+	defer ResetStats()
+	for _, tt := range []struct {
+		path     string
+		username string
+		password string
+		exp      string
+	}{
+		{
+			"/db/query?q=SELECT%20*%20FROM%20foo", "dev", "password2",
+			`{"results":[{"columns":["id","name"],"types":["integer","text"],"values":[[1,"fiona"]]}]}`,
+		},
+		{
+			"/db/query?associative&q=SELECT%20*%20FROM%20foo", "dev", "password2",
+			`{"results":[{"types":{"id":"integer","name":"text"},"rows":[{"id":1,"name":"fiona"}]}]}`,
+		},
+		{
+			"/db/request", "dev", "password2",
+			`{"results":[{"rows_affected":1},{"columns":["id","name"],"types":["integer","text"],"values":[[1,"fiona"]]}]}`,
+		},
+		{
+			"/db/query?q=SELECT%20*%20FROM%20foo", "admin", "password1",
+			`{"results":[{"columns":["id","Password_Hash","name"],"types":["integer","text","text"],"values":[[1,"secret","fiona"]]}]}`,
+		},
+	} {
+		if got := get(tt.path, tt.username, tt.password); got != tt.exp {
+			t.Fatalf("wrong response for %s as %s\nexp: %s\ngot: %s", tt.path, tt.username, tt.exp, got)
+		}
+	}
+	if exp, got := int64(3), stats.Get(numRedactedColumns).(*expvar.Int).Value(); exp != got {
+		t.Fatalf("wrong number of redacted columns, exp %d, got %d", exp, got)
+	}
+}
+
+func Test_RedactRowsKeepShape(t *testing.T) {
+	rows := []*command.QueryRows{{
+		Columns: []string{"id", "ssn"},
+		Types:   []string{"integer", "text"},
+		Values: []*command.Values{{
+			Parameters: []*command.Parameter{
+				{Value: &command.Parameter_I{I: 1}},
+				{Value: &command.Parameter_S{S: "123-45-6789"}},
+			},
+		}},
+	}}
+	asJSON := func(rows []*command.QueryRows) string {
+		enc := encoding.Encoder{}
+		b, err := enc.JSONMarshal(rows)
+		if err != nil {
+			t.Fatalf("failed to marshal rows: %s", err.Error())
+		}
+		return string(b)
+	}
+
+	redacted := redactRows(rows, map[string]bool{"ssn": true}, true)
+	if exp, got := `[{"columns":["id","ssn"],"types":["integer","text"],"values":[[1,null]]}]`, asJSON(redacted); exp != got {
+		t.Fatalf("wrong redacted rows\nexp: %s\ngot: %s", exp, got)
+	}
+	if exp, got := `[{"columns":["id","ssn"],"types":["integer","text"],"values":[[1,"123-45-6789"]]}]`, asJSON(rows); exp != got {
+		t.Fatalf("rows modified by redaction\nexp: %s\ngot: %s", exp, got)
+	}
+}
@@ -0,0 +1,154 @@
+package http
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/rqlite/rqlite/auth"
+	"github.com/rqlite/rqlite/command"
+	sql "github.com/rqlite/rqlite/db"
+	"github.com/rqlite/rqlite/store"
+)
+
+// remote is the JSON representation of a remote cluster.
+type remote struct {
+	Name   string   `json:"name"`
+	URL    string   `json:"url"`
+	Tables []string `json:"tables,omitempty"`
+	Error  string   `json:"error,omitempty"`
+}
+
+func newRemote(r *store.Remote) *remote {
+	v := &remote{
+		Name:   r.Name,
+		URL:    r.URL,
+		Tables: r.Tables,
+		Error:  r.Error,
+	}
+	// Never reveal the password of the remote cluster.
+	if u, err := url.Parse(r.URL); err == nil {
+		v.URL = u.Redacted()
+	}
+	return v
+}
+
+// handleRemotes handles requests to list, register and unregister remote
+// clusters, whose tables may then be queried, read-only, through this
+// cluster. Listing remote clusters requires the query permission, and
+// changing them the execute permission. Changes are replicated, so must be
+// served by the leader.
+func (s *Service) handleRemotes(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+
+	perm := auth.PermExecute
+	if r.Method == "GET" {
+		perm = auth.PermQuery
+	}
+	if !s.CheckRequestPerm(r, perm) {
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+
+	var resp interface{}
+	var err error
+	switch r.Method {
+	case "GET":
+		var rs []*store.Remote
+		rs, err = s.store.Remotes()
+		remotes := make([]*remote, 0, len(rs))
+		for _, r := range rs {
+			remotes = append(remotes, newRemote(r))
+		}
+		resp = map[string]interface{}{"remotes": remotes}
+	case "POST":
+		rm, parseErr := parseRemote(r.Body)
+		if parseErr != nil {
+			http.Error(w, parseErr.Error(), http.StatusBadRequest)
+			return
+		}
+		err = s.store.RegisterRemote(rm)
+		resp = map[string]interface{}{}
+	case "DELETE":
+		name := strings.TrimSpace(r.URL.Query().Get("name"))
+		if name == "" {
+			http.Error(w, "remote cluster name required", http.StatusBadRequest)
+			return
+		}
+		err = s.store.UnregisterRemote(name)
+		resp = map[string]interface{}{}
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	if err != nil {
+		if errors.Is(err, store.ErrNotLeader) {
+			leaderAPIAddr := s.LeaderAPIAddr()
+			if leaderAPIAddr == "" {
+				stats.Add(numLeaderNotFound, 1)
+				http.Error(w, ErrLeaderNotFound.Error(), http.StatusServiceUnavailable)
+				return
+			}
+			http.Redirect(w, r, s.FormRedirect(r, leaderAPIAddr), http.StatusTemporaryRedirect)
+			return
+		}
+		switch {
+		case errors.Is(err, store.ErrRemoteNotFound):
+			http.Error(w, err.Error(), http.StatusNotFound)
+		case errors.Is(err, store.ErrRemoteInvalid):
+			http.Error(w, err.Error(), http.StatusBadRequest)
+		case errors.Is(err, store.ErrRemoteUnavailable):
+			http.Error(w, err.Error(), http.StatusBadGateway)
+		case errors.Is(err, sql.ErrRemoteTablesUnsupported):
+			http.Error(w, err.Error(), http.StatusNotImplemented)
+		default:
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+		}
+		return
+	}
+
+	b, err := json.Marshal(resp)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if _, err := w.Write(b); err != nil {
+		s.logger.Println("writing response failed:", err.Error())
+	}
+}
+
+// readsRemote returns whether any of the statements of req may read the tables
+// of the named remote clusters, which it reports any statement mentioning
+// the name of a remote cluster may.
+func readsRemote(req *command.Request, names []string) bool {
+	for _, stmt := range req.Statements {
+		sql := strings.ToLower(stmt.Sql)
+		for _, name := range names {
+			if strings.Contains(sql, strings.ToLower(name)) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// parseRemote parses a remote cluster from the body of a request to register
+// it.
+func parseRemote(r io.Reader) (*store.Remote, error) {
+	var v remote
+	if err := json.NewDecoder(r).Decode(&v); err != nil {
+		return nil, err
+	}
+	rm := &store.Remote{
+		Name: strings.TrimSpace(v.Name),
+		URL:  strings.TrimSpace(v.URL),
+	}
+	if rm.Name == "" || rm.URL == "" {
+		return nil, errors.New("remote cluster name and url required")
+	}
+	return rm, nil
+}
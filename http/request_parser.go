@@ -74,29 +74,70 @@ func ParseRequest(b []byte) ([]*command.Statement, error) {
 			continue
 		}
 
-		stmts[i].Parameters = make([]*command.Parameter, 0)
-		for j := range parameterized[i][1:] {
-			m, ok := parameterized[i][j+1].(map[string]interface{})
-			if ok {
-				for k, v := range m {
-					p, err := makeParameter(k, v)
-					if err != nil {
-						return nil, err
-					}
-					stmts[i].Parameters = append(stmts[i].Parameters, p)
-				}
-			} else {
-				p, err := makeParameter("", parameterized[i][j+1])
+		// If every element after the SQL string is itself an array, each
+		// array is a set of parameters, and the SQL is executed once per set.
+		if sets, ok := parameterSets(parameterized[i][1:]); ok {
+			stmts[i].ParameterSets = make([]*command.Values, len(sets))
+			for j := range sets {
+				params, err := makeParameters(sets[j])
 				if err != nil {
 					return nil, err
 				}
-				stmts[i].Parameters = append(stmts[i].Parameters, p)
+				stmts[i].ParameterSets[j] = &command.Values{
+					Parameters: params,
+				}
 			}
+			continue
 		}
+
+		params, err := makeParameters(parameterized[i][1:])
+		if err != nil {
+			return nil, err
+		}
+		stmts[i].Parameters = params
 	}
 	return stmts, nil
 }
 
+// parameterSets returns the given values as a slice of parameter sets, if
+// every value is an array.
+func parameterSets(values []interface{}) ([][]interface{}, bool) {
+	sets := make([][]interface{}, len(values))
+	for i := range values {
+		set, ok := values[i].([]interface{})
+		if !ok {
+			return nil, false
+		}
+		sets[i] = set
+	}
+	return sets, true
+}
+
+// makeParameters converts the given values to Parameters. A value which is
+// a map is treated as a set of named parameters.
+func makeParameters(values []interface{}) ([]*command.Parameter, error) {
+	params := make([]*command.Parameter, 0)
+	for i := range values {
+		m, ok := values[i].(map[string]interface{})
+		if ok {
+			for k, v := range m {
+				p, err := makeParameter(k, v)
+				if err != nil {
+					return nil, err
+				}
+				params = append(params, p)
+			}
+		} else {
+			p, err := makeParameter("", values[i])
+			if err != nil {
+				return nil, err
+			}
+			params = append(params, p)
+		}
+	}
+	return params, nil
+}
+
 func makeParameter(name string, i interface{}) (*command.Parameter, error) {
 	// Check if the value is a JSON number, and if so, convert it to an int64 or float64.
 	// Then let the switch statement below handle it.
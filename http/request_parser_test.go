@@ -115,6 +115,53 @@ func Test_SingleParameterizedRequest(t *testing.T) {
 	}
 }
 
+func Test_SingleParameterSetsRequest(t *testing.T) {
+	s := "INSERT INTO foo(name, age) VALUES(?, ?)"
+	b := []byte(fmt.Sprintf(`[["%s", ["fiona", 20], ["sinead", 25], [{"name": "declan"}]]]`, s))
+
+	stmts, err := ParseRequest(b)
+	if err != nil {
+		t.Fatalf("failed to parse request: %s", err.Error())
+	}
+
+	if len(stmts) != 1 {
+		t.Fatalf("incorrect number of statements returned: %d", len(stmts))
+	}
+	if stmts[0].Sql != s {
+		t.Fatalf("incorrect statement parsed, exp %s, got %s", s, stmts[0].Sql)
+	}
+	if len(stmts[0].Parameters) != 0 {
+		t.Fatalf("incorrect number of parameters returned: %d", len(stmts[0].Parameters))
+	}
+
+	if len(stmts[0].ParameterSets) != 3 {
+		t.Fatalf("incorrect number of parameter sets returned: %d", len(stmts[0].ParameterSets))
+	}
+	ps := stmts[0].ParameterSets
+	if got := ps[0].Parameters[0].GetS(); got != "fiona" {
+		t.Fatalf("incorrect parameter, exp fiona, got %s", got)
+	}
+	if got := ps[0].Parameters[1].GetI(); got != 20 {
+		t.Fatalf("incorrect parameter, exp 20, got %d", got)
+	}
+	if got := ps[1].Parameters[0].GetS(); got != "sinead" {
+		t.Fatalf("incorrect parameter, exp sinead, got %s", got)
+	}
+	if got := ps[1].Parameters[1].GetI(); got != 25 {
+		t.Fatalf("incorrect parameter, exp 25, got %d", got)
+	}
+	if got := ps[2].Parameters[0]; got.GetS() != "declan" || got.Name != "name" {
+		t.Fatalf("incorrect named parameter, got %v", got)
+	}
+}
+
+func Test_MixedParameterSetsRequestFail(t *testing.T) {
+	b := []byte(`[["INSERT INTO foo(name) VALUES(?)", ["fiona"], "sinead"]]`)
+	if _, err := ParseRequest(b); err != ErrUnsupportedType {
+		t.Fatalf("expected ErrUnsupportedType, got %v", err)
+	}
+}
+
 func Test_SingleParameterizedRequestLargeNumber(t *testing.T) {
 	s := "SELECT * FROM ? WHERE bar=?"
 	p0 := "FOO"
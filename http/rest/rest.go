@@ -0,0 +1,447 @@
+// Package rest builds the SQL statements which implement REST-style access to
+// the tables of the database. Rows are selected by GET requests, filtered,
+// ordered and paged by URL parameters, inserted by POST requests, updated by
+// PATCH requests and deleted by DELETE requests.
+//
+// Each URL parameter which names a column filters the rows by that column,
+// its value taking the form <operator>.<value>, for example "age=gt.20".
+package rest
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/rqlite/rqlite/command"
+	"github.com/rqlite/rqlite/command/encoding"
+	"github.com/rqlite/rqlite/http/graphql"
+)
+
+// Parameters which control the rows selected, rather than filtering them.
+const (
+	ParamSelect = "select"
+	ParamOrder  = "order"
+	ParamLimit  = "limit"
+	ParamOffset = "offset"
+)
+
+// operators maps filter operators to their SQL comparison operators.
+var operators = map[string]string{
+	"eq":   "=",
+	"neq":  "!=",
+	"gt":   ">",
+	"gte":  ">=",
+	"lt":   "<",
+	"lte":  "<=",
+	"like": "LIKE",
+}
+
+// Select returns the statement selecting the rows of t described by params.
+func Select(t *graphql.Table, params url.Values) (*command.Statement, error) {
+	b := &builder{table: t}
+	b.sql.WriteString("SELECT ")
+	cols, err := b.columns(params.Get(ParamSelect))
+	if err != nil {
+		return nil, err
+	}
+	b.sql.WriteString(strings.Join(cols, ", "))
+	b.sql.WriteString(" FROM ")
+	b.sql.WriteString(quote(t.Name))
+	if err := b.where(params); err != nil {
+		return nil, err
+	}
+	if err := b.order(params.Get(ParamOrder)); err != nil {
+		return nil, err
+	}
+	if err := b.count(params, ParamLimit, " LIMIT "); err != nil {
+		return nil, err
+	}
+	if params.Get(ParamOffset) != "" {
+		if params.Get(ParamLimit) == "" {
+			b.sql.WriteString(" LIMIT -1")
+		}
+		if err := b.count(params, ParamOffset, " OFFSET "); err != nil {
+			return nil, err
+		}
+	}
+	return b.statement(), nil
+}
+
+// Insert returns the statement inserting into t the rows read from r, which
+// must be a JSON object, or an array of JSON objects with the same keys.
+func Insert(t *graphql.Table, r io.Reader) (*command.Statement, error) {
+	if t.View {
+		return nil, fmt.Errorf("%s is a view", t.Name)
+	}
+	rows, err := decodeRows(r)
+	if err != nil {
+		return nil, err
+	}
+	if len(rows) == 0 {
+		return nil, fmt.Errorf("no rows to insert")
+	}
+
+	cols := sortedKeys(rows[0])
+	if len(cols) == 0 {
+		return nil, fmt.Errorf("no columns to insert")
+	}
+	b := &builder{table: t}
+	b.sql.WriteString("INSERT INTO ")
+	b.sql.WriteString(quote(t.Name))
+	b.sql.WriteString(" (")
+	for i, c := range cols {
+		if !t.HasColumn(c) {
+			return nil, fmt.Errorf("unknown column %s", c)
+		}
+		if i > 0 {
+			b.sql.WriteString(", ")
+		}
+		b.sql.WriteString(quote(c))
+	}
+	b.sql.WriteString(") VALUES ")
+	for i, row := range rows {
+		if len(row) != len(cols) {
+			return nil, fmt.Errorf("all rows must have the same columns")
+		}
+		if i > 0 {
+			b.sql.WriteString(", ")
+		}
+		b.sql.WriteString("(")
+		for j, c := range cols {
+			v, ok := row[c]
+			if !ok {
+				return nil, fmt.Errorf("all rows must have the same columns")
+			}
+			if j > 0 {
+				b.sql.WriteString(", ")
+			}
+			if err := b.bind(v); err != nil {
+				return nil, fmt.Errorf("column %s: %s", c, err)
+			}
+		}
+		b.sql.WriteString(")")
+	}
+	return b.statement(), nil
+}
+
+// Update returns the statement setting the columns of the rows of t described
+// by params to the values read from r, which must be a JSON object. At least
+// one filter must be given, so that a table is not updated in its entirety
+// by mistake.
+func Update(t *graphql.Table, params url.Values, r io.Reader) (*command.Statement, error) {
+	if t.View {
+		return nil, fmt.Errorf("%s is a view", t.Name)
+	}
+	rows, err := decodeRows(r)
+	if err != nil {
+		return nil, err
+	}
+	if len(rows) != 1 {
+		return nil, fmt.Errorf("update requires a single JSON object")
+	}
+	cols := sortedKeys(rows[0])
+	if len(cols) == 0 {
+		return nil, fmt.Errorf("no columns to update")
+	}
+
+	b := &builder{table: t}
+	b.sql.WriteString("UPDATE ")
+	b.sql.WriteString(quote(t.Name))
+	b.sql.WriteString(" SET ")
+	for i, c := range cols {
+		if !t.HasColumn(c) {
+			return nil, fmt.Errorf("unknown column %s", c)
+		}
+		if i > 0 {
+			b.sql.WriteString(", ")
+		}
+		b.sql.WriteString(quote(c))
+		b.sql.WriteString(" = ")
+		if err := b.bind(rows[0][c]); err != nil {
+			return nil, fmt.Errorf("column %s: %s", c, err)
+		}
+	}
+	if err := b.requiredWhere(params); err != nil {
+		return nil, err
+	}
+	return b.statement(), nil
+}
+
+// Delete returns the statement deleting the rows of t described by params.
+// At least one filter must be given.
+func Delete(t *graphql.Table, params url.Values) (*command.Statement, error) {
+	if t.View {
+		return nil, fmt.Errorf("%s is a view", t.Name)
+	}
+	b := &builder{table: t}
+	b.sql.WriteString("DELETE FROM ")
+	b.sql.WriteString(quote(t.Name))
+	if err := b.requiredWhere(params); err != nil {
+		return nil, err
+	}
+	return b.statement(), nil
+}
+
+// Rows returns the rows of a query result as JSON objects, keyed by column.
+func Rows(rows *command.QueryRows) ([]graphql.Object, error) {
+	values := make([][]interface{}, len(rows.Values))
+	if err := encoding.NewValuesFromQueryValues(values, rows.Values); err != nil {
+		return nil, err
+	}
+	objs := make([]graphql.Object, len(values))
+	for i, row := range values {
+		objs[i] = make(graphql.Object, len(rows.Columns))
+		for j, c := range rows.Columns {
+			objs[i][j] = graphql.ObjectField{Name: c, Value: row[j]}
+		}
+	}
+	return objs, nil
+}
+
+type builder struct {
+	table  *graphql.Table
+	sql    strings.Builder
+	params []*command.Parameter
+}
+
+func (b *builder) statement() *command.Statement {
+	return &command.Statement{
+		Sql:        b.sql.String(),
+		Parameters: b.params,
+	}
+}
+
+// columns returns the quoted columns named by a comma-separated list, or all
+// columns of the table if the list is empty.
+func (b *builder) columns(list string) ([]string, error) {
+	if list == "" || list == "*" {
+		cols := make([]string, len(b.table.Columns))
+		for i, c := range b.table.Columns {
+			cols[i] = quote(c)
+		}
+		return cols, nil
+	}
+	var cols []string
+	for _, c := range strings.Split(list, ",") {
+		c = strings.TrimSpace(c)
+		if !b.table.HasColumn(c) {
+			return nil, fmt.Errorf("unknown column %s", c)
+		}
+		cols = append(cols, quote(c))
+	}
+	return cols, nil
+}
+
+func (b *builder) requiredWhere(params url.Values) error {
+	n := b.sql.Len()
+	if err := b.where(params); err != nil {
+		return err
+	}
+	if b.sql.Len() == n {
+		return fmt.Errorf("at least one filter is required")
+	}
+	return nil
+}
+
+// where writes the WHERE clause for the column filters of params. Filters
+// are combined with AND, in column order so that statements are stable.
+func (b *builder) where(params url.Values) error {
+	var names []string
+	for name := range params {
+		switch name {
+		case ParamSelect, ParamOrder, ParamLimit, ParamOffset:
+			continue
+		}
+		if !b.table.HasColumn(name) {
+			return fmt.Errorf("unknown column %s", name)
+		}
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	n := 0
+	for _, name := range names {
+		for _, f := range params[name] {
+			if n == 0 {
+				b.sql.WriteString(" WHERE ")
+			} else {
+				b.sql.WriteString(" AND ")
+			}
+			if err := b.filter(name, f); err != nil {
+				return err
+			}
+			n++
+		}
+	}
+	return nil
+}
+
+// filter writes the condition for a single filter of the form
+// <operator>.<value> on col. Any operator may be prefixed with "not.".
+func (b *builder) filter(col, f string) error {
+	not := false
+	if strings.HasPrefix(f, "not.") {
+		not = true
+		f = strings.TrimPrefix(f, "not.")
+	}
+	i := strings.IndexByte(f, '.')
+	if i < 0 {
+		return fmt.Errorf("filter on %s must take the form operator.value", col)
+	}
+	op, val := f[:i], f[i+1:]
+
+	if not {
+		b.sql.WriteString("NOT ")
+	}
+	b.sql.WriteString("(")
+	b.sql.WriteString(quote(col))
+	switch op {
+	case "is":
+		switch strings.ToLower(val) {
+		case "null":
+			b.sql.WriteString(" IS NULL")
+		case "true":
+			b.sql.WriteString(" IS TRUE")
+		case "false":
+			b.sql.WriteString(" IS FALSE")
+		default:
+			return fmt.Errorf("filter on %s: is requires null, true or false", col)
+		}
+	case "in":
+		if !strings.HasPrefix(val, "(") || !strings.HasSuffix(val, ")") {
+			return fmt.Errorf("filter on %s: in requires a parenthesized list", col)
+		}
+		b.sql.WriteString(" IN (")
+		for j, v := range strings.Split(val[1:len(val)-1], ",") {
+			if j > 0 {
+				b.sql.WriteString(", ")
+			}
+			b.bind(v)
+		}
+		b.sql.WriteString(")")
+	default:
+		sqlOp, ok := operators[op]
+		if !ok {
+			return fmt.Errorf("filter on %s: unknown operator %s", col, op)
+		}
+		b.sql.WriteString(" ")
+		b.sql.WriteString(sqlOp)
+		b.sql.WriteString(" ")
+		b.bind(val)
+	}
+	b.sql.WriteString(")")
+	return nil
+}
+
+// order writes the ORDER BY clause for a comma-separated list of columns,
+// each optionally suffixed with ".asc" or ".desc".
+func (b *builder) order(list string) error {
+	if list == "" {
+		return nil
+	}
+	b.sql.WriteString(" ORDER BY ")
+	for i, o := range strings.Split(list, ",") {
+		col, dir := strings.TrimSpace(o), ""
+		if j := strings.LastIndexByte(col, '.'); j >= 0 {
+			switch strings.ToLower(col[j+1:]) {
+			case "asc":
+				col, dir = col[:j], " ASC"
+			case "desc":
+				col, dir = col[:j], " DESC"
+			}
+		}
+		if !b.table.HasColumn(col) {
+			return fmt.Errorf("unknown column %s", col)
+		}
+		if i > 0 {
+			b.sql.WriteString(", ")
+		}
+		b.sql.WriteString(quote(col))
+		b.sql.WriteString(dir)
+	}
+	return nil
+}
+
+func (b *builder) count(params url.Values, name, clause string) error {
+	v := params.Get(name)
+	if v == "" {
+		return nil
+	}
+	n, err := strconv.ParseInt(v, 10, 64)
+	if err != nil || n < 0 {
+		return fmt.Errorf("%s must be a non-negative integer", name)
+	}
+	b.sql.WriteString(clause)
+	return b.bind(n)
+}
+
+// bind writes a placeholder for v, and adds v to the statement parameters.
+// Filter values are bound as text, and converted by SQLite according to the
+// affinity of the column they are compared with.
+func (b *builder) bind(v interface{}) error {
+	p := &command.Parameter{}
+	switch w := v.(type) {
+	case nil:
+	case int64:
+		p.Value = &command.Parameter_I{I: w}
+	case string:
+		p.Value = &command.Parameter_S{S: w}
+	case bool:
+		p.Value = &command.Parameter_B{B: w}
+	case json.Number:
+		if i, err := w.Int64(); err == nil {
+			p.Value = &command.Parameter_I{I: i}
+		} else if d, err := w.Float64(); err == nil {
+			p.Value = &command.Parameter_D{D: d}
+		} else {
+			return err
+		}
+	default:
+		return fmt.Errorf("value of type %T cannot be stored", v)
+	}
+	b.sql.WriteString("?")
+	b.params = append(b.params, p)
+	return nil
+}
+
+// decodeRows decodes a JSON object, or array of JSON objects, from r.
+func decodeRows(r io.Reader) ([]map[string]interface{}, error) {
+	body, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	body = bytes.TrimSpace(body)
+
+	dec := json.NewDecoder(bytes.NewReader(body))
+	dec.UseNumber()
+	var rows []map[string]interface{}
+	if len(body) > 0 && body[0] == '[' {
+		err = dec.Decode(&rows)
+	} else {
+		var row map[string]interface{}
+		err = dec.Decode(&row)
+		rows = append(rows, row)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("invalid JSON body: %s", err)
+	}
+	return rows, nil
+}
+
+func sortedKeys(m map[string]interface{}) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func quote(ident string) string {
+	return `"` + strings.ReplaceAll(ident, `"`, `""`) + `"`
+}
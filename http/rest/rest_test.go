@@ -0,0 +1,202 @@
+package rest
+
+import (
+	"encoding/json"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/rqlite/rqlite/command"
+	"github.com/rqlite/rqlite/db"
+	"github.com/rqlite/rqlite/http/graphql"
+)
+
+func mustOpenTestDB(t *testing.T) (*db.DB, *graphql.Schema) {
+	d, err := db.OpenInMemory(false)
+	if err != nil {
+		t.Fatalf("failed to open database: %s", err.Error())
+	}
+	_, err = d.ExecuteStringStmt(`CREATE TABLE users (id INTEGER PRIMARY KEY, name TEXT, age INTEGER);
+		CREATE VIEW adults AS SELECT * FROM users WHERE age >= 18`)
+	if err != nil {
+		t.Fatalf("failed to create schema: %s", err.Error())
+	}
+	rows, err := d.QueryStringStmt(graphql.SchemaSQL)
+	if err != nil {
+		t.Fatalf("failed to query schema: %s", err.Error())
+	}
+	s, err := graphql.NewSchema(rows[0])
+	if err != nil {
+		t.Fatalf("failed to create schema: %s", err.Error())
+	}
+	return d, s
+}
+
+func mustParseQuery(t *testing.T, q string) url.Values {
+	v, err := url.ParseQuery(q)
+	if err != nil {
+		t.Fatalf("failed to parse query %q: %s", q, err.Error())
+	}
+	return v
+}
+
+func Test_SelectSQL(t *testing.T) {
+	d, s := mustOpenTestDB(t)
+	defer d.Close()
+	users, _ := s.Table("users")
+
+	for _, tt := range []struct {
+		q   string
+		sql string
+		n   int
+	}{
+		{``, `SELECT "id", "name", "age" FROM "users"`, 0},
+		{`select=id,name`, `SELECT "id", "name" FROM "users"`, 0},
+		{`id=eq.1`, `SELECT "id", "name", "age" FROM "users" WHERE ("id" = ?)`, 1},
+		{`select=id&age=gte.18&age=lt.65&name=like.f%25`,
+			`SELECT "id" FROM "users" WHERE ("age" >= ?) AND ("age" < ?) AND ("name" LIKE ?)`, 3},
+		{`select=id&id=in.(1,2,3)`, `SELECT "id" FROM "users" WHERE ("id" IN (?, ?, ?))`, 3},
+		{`select=id&name=is.null`, `SELECT "id" FROM "users" WHERE ("name" IS NULL)`, 0},
+		{`select=id&name=not.eq.fiona`, `SELECT "id" FROM "users" WHERE NOT ("name" = ?)`, 1},
+		{`select=id&order=age.desc,id`, `SELECT "id" FROM "users" ORDER BY "age" DESC, "id"`, 0},
+		{`select=id&limit=10&offset=5`, `SELECT "id" FROM "users" LIMIT ? OFFSET ?`, 2},
+		{`select=id&offset=5`, `SELECT "id" FROM "users" LIMIT -1 OFFSET ?`, 1},
+	} {
+		stmt, err := Select(users, mustParseQuery(t, tt.q))
+		if err != nil {
+			t.Fatalf("failed to build select for %q: %s", tt.q, err.Error())
+		}
+		if stmt.Sql != tt.sql {
+			t.Fatalf("wrong SQL for %q\nexp: %s\ngot: %s", tt.q, tt.sql, stmt.Sql)
+		}
+		if len(stmt.Parameters) != tt.n {
+			t.Fatalf("wrong number of parameters for %q, exp %d, got %d", tt.q, tt.n, len(stmt.Parameters))
+		}
+		if _, err := d.Query(&command.Request{Statements: []*command.Statement{stmt}}, false); err != nil {
+			t.Fatalf("failed to execute %q: %s", stmt.Sql, err.Error())
+		}
+	}
+}
+
+func Test_SelectErrors(t *testing.T) {
+	d, s := mustOpenTestDB(t)
+	defer d.Close()
+	users, _ := s.Table("users")
+
+	for _, tt := range []struct {
+		q   string
+		err string
+	}{
+		{`select=bar`, "unknown column bar"},
+		{`bar=eq.1`, "unknown column bar"},
+		{`id=1`, "must take the form operator.value"},
+		{`id=foo.1`, "unknown operator foo"},
+		{`id=in.1,2`, "in requires a parenthesized list"},
+		{`name=is.foo`, "is requires null, true or false"},
+		{`order=bar.desc`, "unknown column bar"},
+		{`limit=-1`, "limit must be a non-negative integer"},
+	} {
+		_, err := Select(users, mustParseQuery(t, tt.q))
+		if err == nil || !strings.Contains(err.Error(), tt.err) {
+			t.Fatalf("wrong error for %q, exp %q, got %v", tt.q, tt.err, err)
+		}
+	}
+}
+
+func Test_WriteErrors(t *testing.T) {
+	d, s := mustOpenTestDB(t)
+	defer d.Close()
+	users, _ := s.Table("users")
+	adults, _ := s.Table("adults")
+
+	if _, err := Insert(users, strings.NewReader(`[{"name": "a"}, {"age": 1}]`)); err == nil {
+		t.Fatalf("insert of rows with different columns succeeded")
+	}
+	if _, err := Insert(users, strings.NewReader(`{"bar": 1}`)); err == nil {
+		t.Fatalf("insert of unknown column succeeded")
+	}
+	if _, err := Insert(users, strings.NewReader(`{"name": {"a": 1}}`)); err == nil {
+		t.Fatalf("insert of object value succeeded")
+	}
+	if _, err := Insert(adults, strings.NewReader(`{"name": "a"}`)); err == nil {
+		t.Fatalf("insert into view succeeded")
+	}
+	if _, err := Insert(users, strings.NewReader(``)); err == nil {
+		t.Fatalf("insert of empty body succeeded")
+	}
+	if _, err := Update(users, url.Values{}, strings.NewReader(`{"name": "a"}`)); err == nil {
+		t.Fatalf("update without filter succeeded")
+	}
+	if _, err := Update(users, mustParseQuery(t, "id=eq.1"), strings.NewReader(`[{"name": "a"}, {"name": "b"}]`)); err == nil {
+		t.Fatalf("update with multiple objects succeeded")
+	}
+	if _, err := Delete(users, mustParseQuery(t, "limit=1")); err == nil {
+		t.Fatalf("delete without filter succeeded")
+	}
+}
+
+func Test_Execute(t *testing.T) {
+	d, s := mustOpenTestDB(t)
+	defer d.Close()
+	users, _ := s.Table("users")
+
+	execute := func(stmt *command.Statement, err error) *command.ExecuteResult {
+		if err != nil {
+			t.Fatalf("failed to build statement: %s", err.Error())
+		}
+		results, err := d.Execute(&command.Request{Statements: []*command.Statement{stmt}}, false)
+		if err != nil {
+			t.Fatalf("failed to execute %q: %s", stmt.Sql, err.Error())
+		}
+		if results[0].Error != "" {
+			t.Fatalf("failed to execute %q: %s", stmt.Sql, results[0].Error)
+		}
+		return results[0]
+	}
+	query := func(q string) string {
+		stmt, err := Select(users, mustParseQuery(t, q))
+		if err != nil {
+			t.Fatalf("failed to build select: %s", err.Error())
+		}
+		rows, err := d.Query(&command.Request{Statements: []*command.Statement{stmt}}, false)
+		if err != nil {
+			t.Fatalf("failed to query: %s", err.Error())
+		}
+		objs, err := Rows(rows[0])
+		if err != nil {
+			t.Fatalf("failed to convert rows: %s", err.Error())
+		}
+		b, err := json.Marshal(objs)
+		if err != nil {
+			t.Fatalf("failed to marshal rows: %s", err.Error())
+		}
+		return string(b)
+	}
+
+	r := execute(Insert(users, strings.NewReader(`[{"name": "fiona", "age": 20}, {"name": "declan", "age": 12}]`)))
+	if r.RowsAffected != 2 || r.LastInsertId != 2 {
+		t.Fatalf("wrong insert result: %v", r)
+	}
+	if got, exp := query("order=id"), `[{"id":1,"name":"fiona","age":20},{"id":2,"name":"declan","age":12}]`; got != exp {
+		t.Fatalf("wrong rows\nexp: %s\ngot: %s", exp, got)
+	}
+	if got, exp := query("select=name&age=gt.18"), `[{"name":"fiona"}]`; got != exp {
+		t.Fatalf("wrong rows\nexp: %s\ngot: %s", exp, got)
+	}
+
+	r = execute(Update(users, mustParseQuery(t, "name=eq.declan"), strings.NewReader(`{"age": 13, "name": null}`)))
+	if r.RowsAffected != 1 {
+		t.Fatalf("wrong update result: %v", r)
+	}
+	if got, exp := query("select=id,age&name=is.null"), `[{"id":2,"age":13}]`; got != exp {
+		t.Fatalf("wrong rows\nexp: %s\ngot: %s", exp, got)
+	}
+
+	r = execute(Delete(users, mustParseQuery(t, "age=lt.18")))
+	if r.RowsAffected != 1 {
+		t.Fatalf("wrong delete result: %v", r)
+	}
+	if got, exp := query("select=id"), `[{"id":1}]`; got != exp {
+		t.Fatalf("wrong rows\nexp: %s\ngot: %s", exp, got)
+	}
+}
@@ -11,11 +11,13 @@ import (
 	"fmt"
 	"io"
 	"log"
+	"math"
 	"net"
 	"net/http"
 	"net/http/pprof"
 	"os"
 	"runtime"
+	"strconv"
 	"strings"
 	"sync"
 	"time"
@@ -25,14 +27,25 @@ import (
 	"github.com/rqlite/rqlite/command"
 	"github.com/rqlite/rqlite/command/encoding"
 	"github.com/rqlite/rqlite/db"
+	"github.com/rqlite/rqlite/http/graphql"
+	"github.com/rqlite/rqlite/http/rest"
 	"github.com/rqlite/rqlite/queue"
 	"github.com/rqlite/rqlite/rtls"
 	"github.com/rqlite/rqlite/store"
+	"github.com/rqlite/rqlite/tcp"
 )
 
 var (
 	// ErrLeaderNotFound is returned when a node cannot locate a leader
 	ErrLeaderNotFound = errors.New("leader not found")
+
+	// ErrMaintenance is returned when a read cannot be served because the
+	// node is in maintenance mode.
+	ErrMaintenance = errors.New("node in maintenance mode")
+
+	// ErrQueryLimit is returned when a query is refused because its user has
+	// too many queries in flight.
+	ErrQueryLimit = errors.New("too many queries in flight for user")
 )
 
 type ResultsError interface {
@@ -58,6 +71,14 @@ type Database interface {
 	// an Execute or Query request.
 	Request(eqr *command.ExecuteQueryRequest) ([]*command.ExecuteQueryResponse, error)
 
+	// ExecuteWithIndex is like Execute, but also returns the index of the
+	// Raft log entry which carried the request.
+	ExecuteWithIndex(er *command.ExecuteRequest) ([]*command.ExecuteResult, uint64, error)
+
+	// RequestWithIndex is like Request, but also returns the index of the
+	// Raft log entry which carried the request, or 0 if there was none.
+	RequestWithIndex(eqr *command.ExecuteQueryRequest) ([]*command.ExecuteQueryResponse, uint64, error)
+
 	// Load loads a SQLite file into the system
 	Load(lr *command.LoadRequest) error
 }
@@ -75,20 +96,111 @@ type Store interface {
 	// RemoveNode removes the node from the cluster.
 	Remove(rn *command.RemoveNodeRequest) error
 
+	// Demote demotes the voting node with the given ID to a non-voter.
+	Demote(id string) error
+
 	// LeaderAddr returns the Raft address of the leader of the cluster.
 	LeaderAddr() (string, error)
 
 	// Ready returns whether the Store is ready to service requests.
 	Ready() bool
 
+	// IsLeader returns whether this node is the Leader.
+	IsLeader() bool
+
+	// AppliedIndex returns the index of the last Raft log entry applied.
+	AppliedIndex() uint64
+
+	// SchemaVersion returns the version of the schema of the database,
+	// incremented by each batch of statements which changes the schema.
+	SchemaVersion() (int64, error)
+
+	// VerifyLeaderFreshness checks that this node's leadership was confirmed
+	// by a quorum no longer than maxAge ago, and returns the age of the
+	// confirmation.
+	VerifyLeaderFreshness(maxAge time.Duration) (time.Duration, error)
+
+	// WaitForAppliedIndex blocks until the given Raft log index has been
+	// applied, or the timeout expires.
+	WaitForAppliedIndex(idx uint64, timeout time.Duration) error
+
 	// Stats returns stats on the Store.
 	Stats() (map[string]interface{}, error)
 
 	// Nodes returns the slice of store.Servers in the cluster
 	Nodes() ([]*store.Server, error)
 
+	// DryRun executes the statements of the request within a transaction
+	// which is always rolled back, returning the results they would have had.
+	DryRun(er *command.ExecuteRequest) ([]*command.ExecuteResult, error)
+
+	// DBSize returns the size of the database, and of each of its tables,
+	// as last measured.
+	DBSize() (*store.DBSize, error)
+
+	// RestoreTable replaces a single table with that of the same name held
+	// in a backup, leaving all other tables untouched.
+	RestoreTable(backup []byte, table string) ([]*command.ExecuteResult, error)
+
 	// Backup wites backup of the node state to dst
 	Backup(br *command.BackupRequest, dst io.Writer) error
+
+	// SetForeignKeys enables or disables enforcement of foreign key
+	// constraints by every node in the cluster.
+	SetForeignKeys(enabled bool) error
+
+	// ForeignKeys returns whether foreign key constraints are enforced.
+	ForeignKeys() bool
+
+	// CreateJoinToken creates a token which allows a node to join the
+	// cluster, returning the token and its description.
+	CreateJoinToken(ttl time.Duration, singleUse bool) (string, *command.JoinToken, error)
+
+	// RevokeJoinToken revokes the join token with the given ID.
+	RevokeJoinToken(id string) error
+
+	// JoinTokens returns the join tokens which have not been revoked.
+	JoinTokens() []*command.JoinToken
+
+	// MaterializedViews returns every materialized view.
+	MaterializedViews() ([]*store.MaterializedView, error)
+
+	// CreateMaterializedView creates a materialized view.
+	CreateMaterializedView(mv *store.MaterializedView) error
+
+	// RefreshMaterializedView refreshes the named materialized view.
+	RefreshMaterializedView(name string) error
+
+	// DropMaterializedView drops the named materialized view.
+	DropMaterializedView(name string) error
+
+	// SpatialIndexes returns every spatial index.
+	SpatialIndexes() ([]*store.SpatialIndex, error)
+
+	// SpatialIndex returns the named spatial index.
+	SpatialIndex(name string) (*store.SpatialIndex, error)
+
+	// CreateSpatialIndex creates a spatial index.
+	CreateSpatialIndex(si *store.SpatialIndex) error
+
+	// DropSpatialIndex drops the named spatial index.
+	DropSpatialIndex(name string) error
+
+	// Triggers returns every trigger installed in the database.
+	Triggers() ([]*store.Trigger, error)
+
+	// Remotes returns every registered remote cluster.
+	Remotes() ([]*store.Remote, error)
+
+	// RegisterRemote registers a remote cluster.
+	RegisterRemote(r *store.Remote) error
+
+	// UnregisterRemote unregisters the named remote cluster.
+	UnregisterRemote(name string) error
+
+	// RemoteNames returns the names of the remote clusters attached by this
+	// node.
+	RemoteNames() []string
 }
 
 // Cluster is the interface node API services must provide
@@ -96,6 +208,9 @@ type Cluster interface {
 	// GetNodeAPIAddr returns the HTTP API URL for the node at the given Raft address.
 	GetNodeAPIAddr(nodeAddr string, timeout time.Duration) (string, error)
 
+	// GetNodeInfo returns information about the node at the given Raft address.
+	GetNodeInfo(nodeAddr string, timeout time.Duration) (*cluster.NodeInfo, error)
+
 	// Execute performs an Execute Request on a remote node.
 	Execute(er *command.ExecuteRequest, nodeAddr string, creds *cluster.Credentials, timeout time.Duration) ([]*command.ExecuteResult, error)
 
@@ -105,6 +220,14 @@ type Cluster interface {
 	// Request performs an ExecuteQuery Request on a remote node.
 	Request(eqr *command.ExecuteQueryRequest, nodeAddr string, creds *cluster.Credentials, timeout time.Duration) ([]*command.ExecuteQueryResponse, error)
 
+	// ExecuteWithIndex is like Execute, but also returns the index of the
+	// Raft log entry which carried the request on the remote node.
+	ExecuteWithIndex(er *command.ExecuteRequest, nodeAddr string, creds *cluster.Credentials, timeout time.Duration) ([]*command.ExecuteResult, uint64, error)
+
+	// RequestWithIndex is like Request, but also returns the index of the
+	// Raft log entry which carried the request on the remote node.
+	RequestWithIndex(eqr *command.ExecuteQueryRequest, nodeAddr string, creds *cluster.Credentials, timeout time.Duration) ([]*command.ExecuteQueryResponse, uint64, error)
+
 	// Backup retrieves a backup from a remote node and writes to the io.Writer.
 	Backup(br *command.BackupRequest, nodeAddr string, creds *cluster.Credentials, timeout time.Duration, w io.Writer) error
 
@@ -122,6 +245,13 @@ type Cluster interface {
 type CredentialStore interface {
 	// AA authenticates and checks authorization for the given perm.
 	AA(username, password, perm string) bool
+
+	// AAQuery authenticates and checks authorization for a query which
+	// reads the given tables. A nil tables means the query is not read-only.
+	AAQuery(username, password string, tables []string) bool
+
+	// Check returns whether the password is correct for the given username.
+	Check(username, password string) bool
 }
 
 // StatusReporter is the interface status providers must implement.
@@ -137,6 +267,7 @@ type DBResults struct {
 	ExecuteQueryResponse []*command.ExecuteQueryResponse
 
 	AssociativeJSON bool // Render in associative form
+	JSONColumns     bool // Render values of JSON columns as JSON
 }
 
 // Responser is the interface response objects must implement.
@@ -148,6 +279,7 @@ type Responser interface {
 func (d *DBResults) MarshalJSON() ([]byte, error) {
 	enc := encoding.Encoder{
 		Associative: d.AssociativeJSON,
+		JSONColumns: d.JSONColumns,
 	}
 
 	if d.ExecuteResult != nil {
@@ -160,12 +292,26 @@ func (d *DBResults) MarshalJSON() ([]byte, error) {
 	return json.Marshal(make([]interface{}, 0))
 }
 
+// LeaderCheck reports the outcome of confirming, before a weak read, that the
+// leader's belief in its leadership was fresh.
+type LeaderCheck struct {
+	Verified  bool    `json:"verified"`
+	MaxAge    float64 `json:"max_age"`
+	Age       float64 `json:"age,omitempty"`
+	Forwarded bool    `json:"forwarded,omitempty"`
+}
+
 // Response represents a response from the HTTP service.
 type Response struct {
-	Results     *DBResults `json:"results,omitempty"`
-	Error       string     `json:"error,omitempty"`
-	Time        float64    `json:"time,omitempty"`
-	SequenceNum int64      `json:"sequence_number,omitempty"`
+	Results     *DBResults    `json:"results,omitempty"`
+	Error       string        `json:"error,omitempty"`
+	Time        float64       `json:"time,omitempty"`
+	SequenceNum int64         `json:"sequence_number,omitempty"`
+	LeaderCheck *LeaderCheck  `json:"leader_check,omitempty"`
+	Meta        *ResponseMeta `json:"meta,omitempty"`
+
+	// Warnings are the risky writes in the request, if they are reported.
+	Warnings []*command.RiskyWrite `json:"warnings,omitempty"`
 
 	start time.Time
 	end   time.Time
@@ -193,6 +339,10 @@ const (
 	numExecutions                     = "executions"
 	numExecuteStmtsRx                 = "execute_stmts_rx"
 	numQueuedExecutions               = "queued_executions"
+	numDryRuns                        = "dry_runs"
+	numRiskyWrites                    = "risky_writes"
+	numRiskyWritesRefused             = "risky_writes_refused"
+	numRedactedColumns                = "redacted_columns"
 	numQueuedExecutionsOK             = "queued_executions_ok"
 	numQueuedExecutionsStmtsRx        = "queued_executions_num_stmts_rx"
 	numQueuedExecutionsStmtsTx        = "queued_executions_num_stmts_tx"
@@ -204,6 +354,8 @@ const (
 	numQueuedExecutionsWait           = "queued_executions_wait"
 	numQueries                        = "queries"
 	numQueryStmtsRx                   = "query_stmts_rx"
+	numQueriesNotModified             = "queries_not_modified"
+	numLeaderCheckRefusals            = "leader_check_refusals"
 	numRequests                       = "requests"
 	numRequestStmtsRx                 = "request_stmts_rx"
 	numRemoteExecutions               = "remote_executions"
@@ -216,6 +368,10 @@ const (
 	numRemoteLoads                    = "remote_loads"
 	numRemoteRemoveNode               = "remote_remove_node"
 	numReadyz                         = "num_readyz"
+	numLeaderCheck                    = "num_leader_check"
+	numFollowerCheck                  = "num_follower_check"
+	numDBSize                         = "num_db_size"
+	numTopology                       = "num_topology"
 	numStatus                         = "num_status"
 	numBackups                        = "backups"
 	numLoad                           = "loads"
@@ -223,10 +379,35 @@ const (
 	numNotifies                       = "notifies"
 	numAuthOK                         = "authOK"
 	numAuthFail                       = "authFail"
+	numAuthBadCredentials             = "auth_bad_credentials"
+	numAuthLockouts                   = "auth_lockouts"
+	numAuthThrottled                  = "auth_throttled"
+	numQueriesLimited                 = "queries_limited"
+	numApplyBacklogRefusals           = "apply_backlog_refusals"
+	numParseCacheHits                 = "parse_cache_hits"
+	numParseCacheMisses               = "parse_cache_misses"
+	numParseCacheEvictions            = "parse_cache_evictions"
+	numSessionReadsWaited             = "session_reads_waited"
+	numSessionReadsUpgraded           = "session_reads_upgraded"
+	numTemplates                      = "templates"
+	numGraphQL                        = "graphql"
+	numREST                           = "rest"
+	numMaintenanceReadsRefused        = "maintenance_reads_refused"
+	numMaintenanceReadsForwarded      = "maintenance_reads_forwarded"
+	numCounterUpdates                 = "counter_updates"
+	numCounterFlushes                 = "counter_flushes"
+	numQueuedExecutionsCoalesced      = "queued_executions_coalesced"
 
 	// Default timeout for cluster communications.
 	defaultTimeout = 30 * time.Second
 
+	// sessionWaitTimeout is how long a read at level none waits for this node
+	// to apply the last write of its session, before it is upgraded to weak.
+	sessionWaitTimeout = time.Second
+
+	// Default number of tables returned by the hot tables endpoint.
+	defaultHotTables = 10
+
 	// VersionHTTPHeader is the HTTP header key for the version.
 	VersionHTTPHeader = "X-RQLITE-VERSION"
 
@@ -234,6 +415,14 @@ const (
 	// node (by node Raft address) actually served the request if
 	// it wasn't served by this node.
 	ServedByHTTPHeader = "X-RQLITE-SERVED-BY"
+
+	// SessionIndexHTTPHeader is the HTTP header carrying the Raft index of
+	// the last write made in a client session.
+	SessionIndexHTTPHeader = "X-RQLITE-INDEX"
+
+	// SessionIndexCookie is the cookie carrying the Raft index of the last
+	// write made in a client session.
+	SessionIndexCookie = "rqlite_index"
 )
 
 func init() {
@@ -248,6 +437,10 @@ func ResetStats() {
 	stats.Add(numExecutions, 0)
 	stats.Add(numExecuteStmtsRx, 0)
 	stats.Add(numQueuedExecutions, 0)
+	stats.Add(numDryRuns, 0)
+	stats.Add(numRiskyWrites, 0)
+	stats.Add(numRiskyWritesRefused, 0)
+	stats.Add(numRedactedColumns, 0)
 	stats.Add(numQueuedExecutionsOK, 0)
 	stats.Add(numQueuedExecutionsStmtsRx, 0)
 	stats.Add(numQueuedExecutionsStmtsTx, 0)
@@ -259,6 +452,8 @@ func ResetStats() {
 	stats.Add(numQueuedExecutionsWait, 0)
 	stats.Add(numQueries, 0)
 	stats.Add(numQueryStmtsRx, 0)
+	stats.Add(numQueriesNotModified, 0)
+	stats.Add(numLeaderCheckRefusals, 0)
 	stats.Add(numRequests, 0)
 	stats.Add(numRequestStmtsRx, 0)
 	stats.Add(numRemoteExecutions, 0)
@@ -271,6 +466,10 @@ func ResetStats() {
 	stats.Add(numRemoteLoads, 0)
 	stats.Add(numRemoteRemoveNode, 0)
 	stats.Add(numReadyz, 0)
+	stats.Add(numLeaderCheck, 0)
+	stats.Add(numFollowerCheck, 0)
+	stats.Add(numDBSize, 0)
+	stats.Add(numTopology, 0)
 	stats.Add(numStatus, 0)
 	stats.Add(numBackups, 0)
 	stats.Add(numLoad, 0)
@@ -278,6 +477,24 @@ func ResetStats() {
 	stats.Add(numNotifies, 0)
 	stats.Add(numAuthOK, 0)
 	stats.Add(numAuthFail, 0)
+	stats.Add(numAuthBadCredentials, 0)
+	stats.Add(numAuthLockouts, 0)
+	stats.Add(numAuthThrottled, 0)
+	stats.Add(numQueriesLimited, 0)
+	stats.Add(numApplyBacklogRefusals, 0)
+	stats.Add(numParseCacheHits, 0)
+	stats.Add(numParseCacheMisses, 0)
+	stats.Add(numParseCacheEvictions, 0)
+	stats.Add(numSessionReadsWaited, 0)
+	stats.Add(numSessionReadsUpgraded, 0)
+	stats.Add(numTemplates, 0)
+	stats.Add(numGraphQL, 0)
+	stats.Add(numREST, 0)
+	stats.Add(numMaintenanceReadsRefused, 0)
+	stats.Add(numMaintenanceReadsForwarded, 0)
+	stats.Add(numCounterUpdates, 0)
+	stats.Add(numCounterFlushes, 0)
+	stats.Add(numQueuedExecutionsCoalesced, 0)
 }
 
 // Service provides HTTP service.
@@ -292,6 +509,8 @@ type Service struct {
 	queueDone chan struct{}
 	stmtQueue *queue.Queue // Queue for queued executes
 
+	counters *counterBatcher // Merges updates to counters, written to stmtQueue.
+
 	cluster Cluster // The Cluster service.
 
 	start      time.Time // Start up time.
@@ -300,6 +519,11 @@ type Service struct {
 	statusMu sync.RWMutex
 	statuses map[string]StatusReporter
 
+	maintenanceMu    sync.RWMutex
+	maintenance      bool      // Whether the node is in maintenance mode.
+	maintenanceProxy bool      // Whether reads at level none are forwarded during maintenance.
+	maintenanceStart time.Time // Time maintenance mode was entered.
+
 	CACertFile   string // Path to x509 CA certificate used to verify certificates.
 	CertFile     string // Path to server's own x509 certificate.
 	KeyFile      string // Path to server's own x509 private key.
@@ -312,16 +536,85 @@ type Service struct {
 	DefaultQueueTimeout time.Duration
 	DefaultQueueTx      bool
 
+	// QueueCoalesceTables names the tables whose idempotent upserts are
+	// coalesced within each batch of queued writes, so that only the last
+	// upsert of each row in a batch is written. Names are matched without
+	// regard to case.
+	QueueCoalesceTables []string
+
 	seqNumMu sync.Mutex
 	seqNum   int64 // Last sequence number written OK.
 
 	credentialStore CredentialStore
 
+	// AuthFailureThreshold is the number of consecutive authentication
+	// failures, by either a username or an IP address, after which requests
+	// presenting that username, or from that address, are refused for
+	// AuthLockout. Each further failure doubles the lockout, up to
+	// AuthMaxLockout. Zero disables the lockout.
+	AuthFailureThreshold int
+	AuthLockout          time.Duration
+	AuthMaxLockout       time.Duration
+	authThrottle         *authThrottle
+
+	// MaxUserQueries is the number of queries each user may have in flight.
+	// Further queries wait at most UserQueryWait for one to complete, before
+	// being refused. Zero disables the limit.
+	MaxUserQueries int
+	UserQueryWait  time.Duration
+	queryLimiter   *queryLimiter
+
+	// ParseCacheSize is the number of request bodies whose parsed statements
+	// are cached, so that repeated requests are not parsed again. Zero
+	// disables the cache.
+	ParseCacheSize int
+	parseCache     *parseCache
+
 	Expvar bool
 	Pprof  bool
 
+	// SessionConsistency enables read-your-writes consistency for client
+	// sessions. Each write response carries the Raft index of the write, as
+	// both a cookie and a header, and reads at level none presenting that
+	// index are not served until this node has applied the write.
+	SessionConsistency bool
+
+	// Templates are the query templates clients may invoke at /api/q/.
+	Templates *TemplateStore
+
+	// RestrictedAPI disables all database endpoints under /db/, and the
+	// GraphQL and REST endpoints, so that clients may access the database only by
+	// invoking query templates.
+	RestrictedAPI bool
+
+	// GraphQL enables the GraphQL endpoint at /graphql.
+	GraphQL bool
+
+	// REST enables the REST endpoints for each table, at /api/<table>.
+	REST bool
+
+	// RiskyWrites controls the handling of risky writes, such as a DELETE
+	// without a WHERE clause. It is one of RiskyWritesAllow, the default,
+	// RiskyWritesWarn, or RiskyWritesConfirm.
+	RiskyWrites string
+
+	// RedactedColumns names columns which are stripped from query responses,
+	// even when a query selects every column, unless the user holds the
+	// unredacted permission. Names are matched without regard to case.
+	RedactedColumns []string
+
+	// CARotator, if set, enables rotation of the CA used for node-to-node
+	// encryption through the endpoints under /ca.
+	CARotator CARotator
+
+	// IPFilter, if set, refuses connections from addresses it does not allow.
+	IPFilter *tcp.IPFilter
+
 	BuildInfo map[string]interface{}
 
+	// NodeID is the ID of this node, reported in response metadata.
+	NodeID string
+
 	logger *log.Logger
 }
 
@@ -348,22 +641,21 @@ func (s *Service) Start() error {
 		Handler: s,
 	}
 
-	var ln net.Listener
-	var err error
-	if s.CertFile == "" || s.KeyFile == "" {
-		ln, err = net.Listen("tcp", s.addr)
-		if err != nil {
-			return err
-		}
-	} else {
+	ln, err := net.Listen("tcp", s.addr)
+	if err != nil {
+		return err
+	}
+	if s.IPFilter != nil {
+		// Filter before any TLS handshake, so refused clients cost nothing more.
+		ln = s.IPFilter.Listener(ln)
+	}
+	if s.CertFile != "" && s.KeyFile != "" {
 		s.tlsConfig, err = rtls.CreateServerConfig(s.CertFile, s.KeyFile, s.CACertFile, !s.ClientVerify, s.TLS1011)
 		if err != nil {
+			ln.Close()
 			return err
 		}
-		ln, err = tls.Listen("tcp", s.addr, s.tlsConfig)
-		if err != nil {
-			return err
-		}
+		ln = tls.NewListener(ln, s.tlsConfig)
 		var b strings.Builder
 		b.WriteString(fmt.Sprintf("secure HTTPS server enabled with cert %s, key %s", s.CertFile, s.KeyFile))
 		if s.CACertFile != "" {
@@ -379,11 +671,31 @@ func (s *Service) Start() error {
 	}
 	s.ln = ln
 
+	if s.credentialStore != nil && s.AuthFailureThreshold > 0 {
+		s.authThrottle = newAuthThrottle(s.AuthFailureThreshold, s.AuthLockout, s.AuthMaxLockout)
+		s.logger.Printf("authentication lockout enabled after %d failures, for %s up to %s",
+			s.AuthFailureThreshold, s.AuthLockout, s.AuthMaxLockout)
+	}
+
+	if s.MaxUserQueries > 0 {
+		s.queryLimiter = newQueryLimiter(s.MaxUserQueries, s.UserQueryWait)
+		s.logger.Printf("queries limited to %d in flight per user, waiting up to %s",
+			s.MaxUserQueries, s.UserQueryWait)
+	}
+
+	if s.ParseCacheSize > 0 {
+		s.parseCache = newParseCache(s.ParseCacheSize)
+	}
+
 	s.closeCh = make(chan struct{})
 	s.queueDone = make(chan struct{})
 
 	s.stmtQueue = queue.New(s.DefaultQueueCap, s.DefaultQueueBatchSz, s.DefaultQueueTimeout)
 	go s.runQueue()
+	s.counters = newCounterBatcher(s.DefaultQueueTimeout, s.DefaultQueueBatchSz, func(stmts []*command.Statement, fc queue.FlushChannel) error {
+		_, err := s.stmtQueue.Write(stmts, fc)
+		return err
+	})
 	s.logger.Printf("execute queue processing started with capacity %d, batch size %d, timeout %s",
 		s.DefaultQueueCap, s.DefaultQueueBatchSz, s.DefaultQueueTimeout.String())
 
@@ -422,9 +734,38 @@ func (s *Service) HTTPS() bool {
 func (s *Service) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	s.addBuildVersion(w)
 
+	if !s.checkAuthThrottle(w, r) {
+		return
+	}
+
 	switch {
 	case r.URL.Path == "/" || r.URL.Path == "":
 		http.Redirect(w, r, "/status", http.StatusFound)
+	case s.RestrictedAPI && (strings.HasPrefix(r.URL.Path, "/db/") || r.URL.Path == "/graphql"):
+		w.WriteHeader(http.StatusForbidden)
+	case r.URL.Path == "/graphql" && s.GraphQL:
+		stats.Add(numGraphQL, 1)
+		s.handleGraphQL(w, r)
+	case strings.HasPrefix(r.URL.Path, "/api/q/"):
+		stats.Add(numTemplates, 1)
+		s.handleTemplate(w, r)
+	case s.RestrictedAPI && strings.HasPrefix(r.URL.Path, "/api/") && s.REST:
+		w.WriteHeader(http.StatusForbidden)
+	case strings.HasPrefix(r.URL.Path, "/api/") && s.REST:
+		stats.Add(numREST, 1)
+		s.handleREST(w, r)
+	case r.URL.Path == "/db/materialized-views":
+		s.handleMaterializedViews(w, r)
+	case r.URL.Path == "/db/spatial-indexes":
+		s.handleSpatialIndexes(w, r)
+	case strings.HasPrefix(r.URL.Path, "/db/spatial-indexes/"):
+		s.handleSpatialSearch(w, r)
+	case r.URL.Path == "/db/counters" || strings.HasPrefix(r.URL.Path, "/db/counters/"):
+		s.handleCounters(w, r)
+	case r.URL.Path == "/db/triggers":
+		s.handleTriggers(w, r)
+	case r.URL.Path == "/db/remotes":
+		s.handleRemotes(w, r)
 	case strings.HasPrefix(r.URL.Path, "/db/execute"):
 		stats.Add(numExecutions, 1)
 		s.handleExecute(w, r)
@@ -440,6 +781,11 @@ func (s *Service) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	case strings.HasPrefix(r.URL.Path, "/db/load"):
 		stats.Add(numLoad, 1)
 		s.handleLoad(w, r)
+	case r.URL.Path == "/db/size":
+		stats.Add(numDBSize, 1)
+		s.handleDBSize(w, r)
+	case r.URL.Path == "/join-tokens":
+		s.handleJoinTokens(w, r)
 	case strings.HasPrefix(r.URL.Path, "/join"):
 		stats.Add(numJoins, 1)
 		s.handleJoin(w, r)
@@ -448,14 +794,34 @@ func (s *Service) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		s.handleNotify(w, r)
 	case strings.HasPrefix(r.URL.Path, "/remove"):
 		s.handleRemove(w, r)
+	case strings.HasPrefix(r.URL.Path, "/demote"):
+		s.handleDemote(w, r)
+	case r.URL.Path == "/maintenance":
+		s.handleMaintenance(w, r)
+	case r.URL.Path == "/ca" || strings.HasPrefix(r.URL.Path, "/ca/"):
+		s.handleCA(w, r)
+	case r.URL.Path == "/fk":
+		s.handleForeignKeys(w, r)
+	case strings.HasPrefix(r.URL.Path, "/status/tables"):
+		stats.Add(numStatus, 1)
+		s.handleHotTables(w, r)
 	case strings.HasPrefix(r.URL.Path, "/status"):
 		stats.Add(numStatus, 1)
 		s.handleStatus(w, r)
+	case r.URL.Path == "/cluster/topology":
+		stats.Add(numTopology, 1)
+		s.handleTopology(w, r)
 	case strings.HasPrefix(r.URL.Path, "/nodes"):
 		s.handleNodes(w, r)
 	case strings.HasPrefix(r.URL.Path, "/readyz"):
 		stats.Add(numReadyz, 1)
 		s.handleReadyz(w, r)
+	case r.URL.Path == "/leader-check":
+		stats.Add(numLeaderCheck, 1)
+		s.handleLeaderCheck(w, r)
+	case r.URL.Path == "/follower-check":
+		stats.Add(numFollowerCheck, 1)
+		s.handleFollowerCheck(w, r)
 	case r.URL.Path == "/debug/vars" && s.Expvar:
 		s.handleExpvar(w, r)
 	case strings.HasPrefix(r.URL.Path, "/debug/pprof") && s.Pprof:
@@ -517,6 +883,16 @@ func (s *Service) handleJoin(w http.ResponseWriter, r *http.Request) {
 	if !ok {
 		voter = true
 	}
+	token, _ := md["token"].(string)
+	icu, _ := md["icu"].(bool)
+	var collations []string
+	if cc, ok := md["collations"].([]interface{}); ok {
+		for _, c := range cc {
+			if c, ok := c.(string); ok {
+				collations = append(collations, c)
+			}
+		}
+	}
 	if voter.(bool) && !s.CheckRequestPerm(r, auth.PermJoin) {
 		http.Error(w, "joining as voter not allowed", http.StatusUnauthorized)
 		return
@@ -539,9 +915,12 @@ func (s *Service) handleJoin(w http.ResponseWriter, r *http.Request) {
 	}
 
 	jr := &command.JoinRequest{
-		Id:      remoteID,
-		Address: remoteAddr,
-		Voter:   voter.(bool),
+		Id:         remoteID,
+		Address:    remoteAddr,
+		Voter:      voter.(bool),
+		Token:      token,
+		Collations: collations,
+		Icu:        icu,
 	}
 	if err := s.store.Join(jr); err != nil {
 		if err == store.ErrNotLeader {
@@ -556,6 +935,18 @@ func (s *Service) handleJoin(w http.ResponseWriter, r *http.Request) {
 			http.Redirect(w, r, redirect, http.StatusMovedPermanently)
 			return
 		}
+		if isJoinTokenError(err) {
+			http.Error(w, err.Error(), http.StatusForbidden)
+			return
+		}
+		if errors.Is(err, store.ErrCollationMissing) || errors.Is(err, store.ErrICUMismatch) {
+			http.Error(w, err.Error(), http.StatusForbidden)
+			return
+		}
+		if errors.Is(err, store.ErrNodeIDInUse) {
+			http.Error(w, err.Error(), http.StatusConflict)
+			return
+		}
 
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
@@ -619,6 +1010,81 @@ func (s *Service) handleNotify(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
+// InMaintenance returns whether the node is in maintenance mode.
+func (s *Service) InMaintenance() bool {
+	s.maintenanceMu.RLock()
+	defer s.maintenanceMu.RUnlock()
+	return s.maintenance
+}
+
+// handleMaintenance handles requests to enter, exit, and report on, maintenance
+// mode. While in maintenance mode the node reports itself as not ready, and
+// refuses reads at level none, or forwards them to the leader if proxy is set
+// when maintenance mode is entered. The node remains a member of the cluster
+// throughout.
+func (s *Service) handleMaintenance(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+
+	perm := auth.PermMaintenance
+	if r.Method == "GET" {
+		perm = auth.PermStatus
+	}
+	if !s.CheckRequestPerm(r, perm) {
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+
+	switch r.Method {
+	case "GET":
+	case "POST":
+		proxy, err := queryParam(r, "proxy")
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		s.maintenanceMu.Lock()
+		if !s.maintenance {
+			s.maintenance = true
+			s.maintenanceStart = time.Now()
+			s.logger.Printf("entering maintenance mode, forwarding reads at level none: %t", proxy)
+		}
+		s.maintenanceProxy = proxy
+		s.maintenanceMu.Unlock()
+	case "DELETE":
+		s.maintenanceMu.Lock()
+		if s.maintenance {
+			s.maintenance = false
+			s.logger.Printf("exiting maintenance mode after %s", time.Since(s.maintenanceStart))
+		}
+		s.maintenanceMu.Unlock()
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	b, err := json.Marshal(s.maintenanceStatus())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if _, err := w.Write(b); err != nil {
+		s.logger.Println("writing response failed:", err.Error())
+	}
+}
+
+func (s *Service) maintenanceStatus() map[string]interface{} {
+	s.maintenanceMu.RLock()
+	defer s.maintenanceMu.RUnlock()
+	m := map[string]interface{}{
+		"enabled": s.maintenance,
+	}
+	if s.maintenance {
+		m["proxy"] = s.maintenanceProxy
+		m["start_time"] = s.maintenanceStart
+	}
+	return m
+}
+
 // handleRemove handles cluster-remove requests.
 func (s *Service) handleRemove(w http.ResponseWriter, r *http.Request) {
 	if !s.CheckRequestPerm(r, auth.PermRemove) {
@@ -720,6 +1186,63 @@ func (s *Service) handleRemove(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
+// handleDemote handles requests to demote a voting node to a non-voter.
+func (s *Service) handleDemote(w http.ResponseWriter, r *http.Request) {
+	if !s.CheckRequestPerm(r, auth.PermRemove) {
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+
+	if r.Method != "POST" {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	b, err := io.ReadAll(r.Body)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	m := map[string]string{}
+	if err := json.Unmarshal(b, &m); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	if len(m) != 1 {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	remoteID, ok := m["id"]
+	if !ok {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	if err := s.store.Demote(remoteID); err != nil {
+		switch err {
+		case store.ErrNotLeader:
+			leaderAPIAddr := s.LeaderAPIAddr()
+			if leaderAPIAddr == "" {
+				stats.Add(numLeaderNotFound, 1)
+				http.Error(w, ErrLeaderNotFound.Error(), http.StatusServiceUnavailable)
+				return
+			}
+
+			redirect := s.FormRedirect(r, leaderAPIAddr)
+			http.Redirect(w, r, redirect, http.StatusMovedPermanently)
+		case store.ErrNodeNotFound:
+			http.Error(w, err.Error(), http.StatusNotFound)
+		case store.ErrNotVoter:
+			http.Error(w, err.Error(), http.StatusBadRequest)
+		default:
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+		}
+		return
+	}
+}
+
 // handleBackup returns the consistent database snapshot.
 func (s *Service) handleBackup(w http.ResponseWriter, r *http.Request) {
 	if !s.CheckRequestPerm(r, auth.PermBackup) {
@@ -853,7 +1376,32 @@ func (s *Service) handleLoad(w http.ResponseWriter, r *http.Request) {
 	}
 	r.Body.Close()
 
-	if db.IsValidSQLiteData(b) {
+	if table := strings.TrimSpace(r.URL.Query().Get("table")); table != "" {
+		// Restore just the one table from the backup, leaving all others as
+		// they are.
+		results, err := s.store.RestoreTable(b, table)
+		if err != nil {
+			if err == store.ErrNotLeader {
+				leaderAPIAddr := s.LeaderAPIAddr()
+				if leaderAPIAddr == "" {
+					stats.Add(numLeaderNotFound, 1)
+					http.Error(w, ErrLeaderNotFound.Error(), http.StatusServiceUnavailable)
+					return
+				}
+
+				redirect := s.FormRedirect(r, leaderAPIAddr)
+				http.Redirect(w, r, redirect, http.StatusMovedPermanently)
+				return
+			}
+			if err == db.ErrTableNotFound {
+				http.Error(w, fmt.Sprintf("table %s not found in backup", table), http.StatusNotFound)
+				return
+			}
+			resp.Error = err.Error()
+		}
+		resp.Results.ExecuteResult = results
+		resp.end = time.Now()
+	} else if db.IsValidSQLiteData(b) {
 		s.logger.Printf("SQLite database file detected as load data")
 		lr := &command.LoadRequest{
 			Data: b,
@@ -999,11 +1547,26 @@ func (s *Service) handleStatus(w http.ResponseWriter, r *http.Request) {
 		"_default": qs,
 	}
 	httpStatus := map[string]interface{}{
-		"bind_addr": s.Addr().String(),
-		"auth":      prettyEnabled(s.credentialStore != nil),
-		"cluster":   clusterStatus,
-		"queue":     queueStats,
-		"tls":       s.tlsStats(),
+		"bind_addr":   s.Addr().String(),
+		"auth":        prettyEnabled(s.credentialStore != nil),
+		"cluster":     clusterStatus,
+		"queue":       queueStats,
+		"tls":         s.tlsStats(),
+		"maintenance": s.maintenanceStatus(),
+	}
+	if s.authThrottle != nil {
+		httpStatus["auth_throttle"] = map[string]interface{}{
+			"failure_threshold": s.AuthFailureThreshold,
+			"lockout":           s.AuthLockout.String(),
+			"max_lockout":       s.AuthMaxLockout.String(),
+			"tracked_clients":   s.authThrottle.Len(),
+		}
+	}
+	if s.queryLimiter != nil {
+		httpStatus["query_limiter"] = s.queryLimiterStatus()
+	}
+	if s.parseCache != nil {
+		httpStatus["parse_cache"] = s.parseCacheStatus()
 	}
 
 	nodeStatus := map[string]interface{}{
@@ -1062,10 +1625,8 @@ func (s *Service) handleStatus(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
-// handleNodes returns status on the other voting nodes in the system.
-// This attempts to contact all the nodes in the cluster, so may take
-// some time to return.
-func (s *Service) handleNodes(w http.ResponseWriter, r *http.Request) {
+// handleHotTables returns write statistics for the most-written tables.
+func (s *Service) handleHotTables(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json; charset=utf-8")
 
 	if !s.CheckRequestPerm(r, auth.PermStatus) {
@@ -1078,55 +1639,144 @@ func (s *Service) handleNodes(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	timeout, err := timeoutParam(r, defaultTimeout)
+	n, err := countParam(r, defaultHotTables)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		http.Error(w, err.Error(), http.StatusBadRequest)
 		return
 	}
 
-	includeNonVoters, err := nonVoters(r)
+	tables := db.HotTables(n)
+	if tables == nil {
+		tables = make([]*db.TableStats, 0)
+	}
+
+	pretty, _ := isPretty(r)
+	var b []byte
+	if pretty {
+		b, err = json.MarshalIndent(tables, "", "    ")
+	} else {
+		b, err = json.Marshal(tables)
+	}
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		http.Error(w, fmt.Sprintf("JSON marshal: %s", err.Error()),
+			http.StatusInternalServerError)
 		return
 	}
-
-	// Get nodes in the cluster, and possibly filter out non-voters.
-	nodes, err := s.store.Nodes()
+	_, err = w.Write(b)
 	if err != nil {
-		statusCode := http.StatusInternalServerError
-		if err == store.ErrNotOpen {
-			statusCode = http.StatusServiceUnavailable
-		}
-		http.Error(w, fmt.Sprintf("store nodes: %s", err.Error()), statusCode)
+		http.Error(w, fmt.Sprintf("write: %s", err.Error()),
+			http.StatusInternalServerError)
 		return
 	}
+}
 
-	filteredNodes := make([]*store.Server, 0)
-	for _, n := range nodes {
-		if n.Suffrage != "Voter" && !includeNonVoters {
-			continue
-		}
-		filteredNodes = append(filteredNodes, n)
+// handleDBSize returns the size of the database, and of each of its tables, as
+// last measured by this node.
+func (s *Service) handleDBSize(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+
+	if !s.CheckRequestPerm(r, auth.PermStatus) {
+		w.WriteHeader(http.StatusUnauthorized)
+		return
 	}
 
-	lAddr, err := s.store.LeaderAddr()
+	if r.Method != "GET" {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	sz, err := s.store.DBSize()
 	if err != nil {
-		http.Error(w, fmt.Sprintf("leader address: %s", err.Error()),
+		http.Error(w, fmt.Sprintf("database size: %s", err.Error()),
 			http.StatusInternalServerError)
 		return
 	}
 
-	nodesResp, err := s.checkNodes(filteredNodes, timeout)
+	pretty, _ := isPretty(r)
+	var b []byte
+	if pretty {
+		b, err = json.MarshalIndent(sz, "", "    ")
+	} else {
+		b, err = json.Marshal(sz)
+	}
 	if err != nil {
-		http.Error(w, fmt.Sprintf("check nodes: %s", err.Error()),
+		http.Error(w, fmt.Sprintf("JSON marshal: %s", err.Error()),
 			http.StatusInternalServerError)
 		return
 	}
-
-	resp := make(map[string]struct {
-		APIAddr   string  `json:"api_addr,omitempty"`
-		Addr      string  `json:"addr,omitempty"`
-		Reachable bool    `json:"reachable"`
+	_, err = w.Write(b)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("write: %s", err.Error()),
+			http.StatusInternalServerError)
+		return
+	}
+}
+
+// handleNodes returns status on the other voting nodes in the system.
+// This attempts to contact all the nodes in the cluster, so may take
+// some time to return.
+func (s *Service) handleNodes(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+
+	if !s.CheckRequestPerm(r, auth.PermStatus) {
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+
+	if r.Method != "GET" {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	timeout, err := timeoutParam(r, defaultTimeout)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	includeNonVoters, err := nonVoters(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	// Get nodes in the cluster, and possibly filter out non-voters.
+	nodes, err := s.store.Nodes()
+	if err != nil {
+		statusCode := http.StatusInternalServerError
+		if err == store.ErrNotOpen {
+			statusCode = http.StatusServiceUnavailable
+		}
+		http.Error(w, fmt.Sprintf("store nodes: %s", err.Error()), statusCode)
+		return
+	}
+
+	filteredNodes := make([]*store.Server, 0)
+	for _, n := range nodes {
+		if n.Suffrage != "Voter" && !includeNonVoters {
+			continue
+		}
+		filteredNodes = append(filteredNodes, n)
+	}
+
+	lAddr, err := s.store.LeaderAddr()
+	if err != nil {
+		http.Error(w, fmt.Sprintf("leader address: %s", err.Error()),
+			http.StatusInternalServerError)
+		return
+	}
+
+	nodesResp, err := s.checkNodes(filteredNodes, timeout)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("check nodes: %s", err.Error()),
+			http.StatusInternalServerError)
+		return
+	}
+
+	resp := make(map[string]struct {
+		APIAddr   string  `json:"api_addr,omitempty"`
+		Addr      string  `json:"addr,omitempty"`
+		Reachable bool    `json:"reachable"`
 		Leader    bool    `json:"leader"`
 		Time      float64 `json:"time,omitempty"`
 		Error     string  `json:"error,omitempty"`
@@ -1173,6 +1823,12 @@ func (s *Service) handleReadyz(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	if s.InMaintenance() {
+		w.WriteHeader(http.StatusServiceUnavailable)
+		w.Write([]byte("[+]node in maintenance"))
+		return
+	}
+
 	noLeader, err := noLeader(r)
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
@@ -1240,7 +1896,16 @@ func (s *Service) handleExecute(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	if queue {
+	dryRun, err := isDryRun(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if dryRun {
+		stats.Add(numDryRuns, 1)
+		s.dryRunExecute(w, r)
+	} else if queue {
 		stats.Add(numQueuedExecutions, 1)
 		s.queuedExecute(w, r)
 	} else {
@@ -1281,13 +1946,16 @@ func (s *Service) queuedExecute(w http.ResponseWriter, r *http.Request) {
 	}
 	r.Body.Close()
 
-	stmts, err := ParseRequest(b)
+	stmts, err := s.parseRequest(b)
 	if err != nil {
 		if errors.Is(err, ErrNoStatements) && !wait {
 			http.Error(w, err.Error(), http.StatusBadRequest)
 			return
 		}
 	}
+	if !s.checkRiskyWrites(w, r, stmts, resp, false) {
+		return
+	}
 	noRewriteRandom, err := noRewriteRandom(r)
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusBadRequest)
@@ -1349,26 +2017,42 @@ func (s *Service) execute(w http.ResponseWriter, r *http.Request) {
 	}
 	r.Body.Close()
 
-	stmts, err := ParseRequest(b)
+	stmts, err := s.parseRequest(b)
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusBadRequest)
 		return
 	}
 	stats.Add(numExecuteStmtsRx, int64(len(stmts)))
+	if !s.checkRiskyWrites(w, r, stmts, resp, false) {
+		return
+	}
 	if err := command.Rewrite(stmts, !noRewriteRandom); err != nil {
 		http.Error(w, fmt.Sprintf("SQL rewrite: %s", err.Error()), http.StatusInternalServerError)
 		return
 	}
 
+	meta, err := isMeta(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	partial, err := isPartial(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
 	er := &command.ExecuteRequest{
 		Request: &command.Request{
 			Transaction: isTx,
+			Partial:     partial,
 			Statements:  stmts,
 		},
-		Timings: timings,
+		Timings: timings || meta,
 	}
 
-	results, resultsErr := s.store.Execute(er)
+	var servedBy string
+	results, idx, resultsErr := s.store.ExecuteWithIndex(er)
 	if resultsErr != nil && resultsErr == store.ErrNotLeader {
 		if redirect {
 			leaderAPIAddr := s.LeaderAPIAddr()
@@ -1400,7 +2084,8 @@ func (s *Service) execute(w http.ResponseWriter, r *http.Request) {
 		}
 
 		w.Header().Add(ServedByHTTPHeader, addr)
-		results, resultsErr = s.cluster.Execute(er, addr, makeCredentials(username, password), timeout)
+		servedBy = addr
+		results, idx, resultsErr = s.cluster.ExecuteWithIndex(er, addr, makeCredentials(username, password), timeout)
 		if resultsErr != nil {
 			stats.Add(numRemoteExecutionsFailed, 1)
 			if resultsErr.Error() == "unauthorized" {
@@ -1411,10 +2096,16 @@ func (s *Service) execute(w http.ResponseWriter, r *http.Request) {
 		stats.Add(numRemoteExecutions, 1)
 	}
 
+	if meta {
+		resp.Meta = s.newResponseMeta(servedBy, idx)
+		resp.Meta.SQLiteTime = executeTime(results, timings)
+	}
 	if resultsErr != nil {
 		resp.Error = resultsErr.Error()
+		writeApplyBacklogStatus(w, resultsErr)
 	} else {
 		resp.Results.ExecuteResult = results
+		s.setSessionIndex(w, r, idx)
 	}
 	resp.end = time.Now()
 	s.writeResponse(w, r, resp)
@@ -1424,7 +2115,10 @@ func (s *Service) execute(w http.ResponseWriter, r *http.Request) {
 func (s *Service) handleQuery(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json; charset=utf-8")
 
-	if !s.CheckRequestPerm(r, auth.PermQuery) {
+	// The request may be authorized by a query perm limited to certain tables,
+	// so only requests which cannot make any query are rejected before the
+	// queries are read.
+	if !s.CheckRequestQuery(r, nil) {
 		w.WriteHeader(http.StatusUnauthorized)
 		return
 	}
@@ -1439,13 +2133,33 @@ func (s *Service) handleQuery(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, err.Error(), http.StatusBadRequest)
 		return
 	}
+	leaderFrsh, err := leaderFreshness(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	minSchema, err := minSchemaVersion(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	meta, err := isMeta(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
 
 	// Get the query statement(s), and do tx if necessary.
-	queries, err := requestQueries(r)
+	queries, err := s.requestQueries(r)
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusBadRequest)
 		return
 	}
+
+	if !s.CheckRequestQuery(r, queries) {
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
 	stats.Add(numQueryStmtsRx, int64(len(queries)))
 
 	// No point rewriting queries if they don't go through the Raft log, since they
@@ -1459,18 +2173,55 @@ func (s *Service) handleQuery(w http.ResponseWriter, r *http.Request) {
 
 	resp := NewResponse()
 	resp.Results.AssociativeJSON = isAssoc
+	if resp.Results.JSONColumns, err = isJSONColumns(r); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	lvl, ok := s.readLevel(w, r, lvl)
+	if !ok {
+		return
+	}
+	release, ok := s.acquireQuerySlot(w, r)
+	if !ok {
+		return
+	}
+	defer release()
 
 	qr := &command.QueryRequest{
 		Request: &command.Request{
 			Transaction: isTx,
 			Statements:  queries,
 		},
-		Timings:   timings,
-		Level:     lvl,
-		Freshness: frsh.Nanoseconds(),
+		Timings:          timings || meta,
+		Level:            lvl,
+		Freshness:        frsh.Nanoseconds(),
+		MinSchemaVersion: minSchema,
+	}
+
+	// A weak read may require the leader to confirm its leadership is fresh.
+	// If this node is the leader, the check is made here so the age of the
+	// confirmation can be reported. Otherwise the leader makes the check.
+	if lvl == command.QueryRequest_QUERY_REQUEST_LEVEL_WEAK && leaderFrsh > 0 {
+		qr.LeaderFreshness = leaderFrsh.Nanoseconds()
+		resp.LeaderCheck = &LeaderCheck{MaxAge: leaderFrsh.Seconds()}
+		age, err := s.store.VerifyLeaderFreshness(leaderFrsh)
+		if err != nil && err != store.ErrNotLeader {
+			stats.Add(numLeaderCheckRefusals, 1)
+			resp.Error = err.Error()
+			resp.end = time.Now()
+			s.writeResponse(w, r, resp)
+			return
+		}
+		resp.LeaderCheck.Age = age.Seconds()
 	}
 
+	var servedBy string
+	appliedIdx := s.store.AppliedIndex()
 	results, resultsErr := s.store.Query(qr)
+	local := resultsErr != store.ErrNotLeader
+	if resp.LeaderCheck != nil {
+		resp.LeaderCheck.Forwarded = !local
+	}
 	if resultsErr != nil && resultsErr == store.ErrNotLeader {
 		if redirect {
 			leaderAPIAddr := s.LeaderAPIAddr()
@@ -1498,127 +2249,686 @@ func (s *Service) handleQuery(w http.ResponseWriter, r *http.Request) {
 		if !ok {
 			username = ""
 		}
-
-		w.Header().Add(ServedByHTTPHeader, addr)
-		results, resultsErr = s.cluster.Query(qr, addr, makeCredentials(username, password), timeout)
-		if resultsErr != nil {
-			stats.Add(numRemoteQueriesFailed, 1)
-			if resultsErr.Error() == "unauthorized" {
-				http.Error(w, "remote query not authorized", http.StatusUnauthorized)
-				return
-			}
+
+		w.Header().Add(ServedByHTTPHeader, addr)
+		servedBy = addr
+		results, resultsErr = s.cluster.Query(qr, addr, makeCredentials(username, password), timeout)
+		if resultsErr != nil {
+			stats.Add(numRemoteQueriesFailed, 1)
+			if resultsErr.Error() == "unauthorized" {
+				http.Error(w, "remote query not authorized", http.StatusUnauthorized)
+				return
+			}
+		}
+		stats.Add(numRemoteQueries, 1)
+	}
+
+	if resp.LeaderCheck != nil {
+		resp.LeaderCheck.Verified = resultsErr == nil
+		if resultsErr != nil && resultsErr.Error() == store.ErrStaleRead.Error() {
+			stats.Add(numLeaderCheckRefusals, 1)
+		}
+	}
+
+	if meta {
+		resp.Meta = s.newResponseMeta(servedBy, 0)
+		resp.Meta.SQLiteTime = queryTime(results, timings)
+	}
+	if resultsErr != nil {
+		resp.Error = resultsErr.Error()
+	} else {
+		redacted := s.redactedColumns(r)
+		resp.Results.QueryRows = redactRows(results, redacted, false)
+
+		// Results read locally, with no change to the database while they
+		// were read, are tagged with the applied index, so that clients may
+		// avoid transferring them again if nothing has changed. Strong reads
+		// change the applied index themselves, so are never tagged, nor are
+		// reads of remote clusters, which change independently.
+		if local && !timings && !meta && lvl != command.QueryRequest_QUERY_REQUEST_LEVEL_STRONG &&
+			s.store.AppliedIndex() == appliedIdx && !readsRemote(qr.Request, s.store.RemoteNames()) {
+			pretty, _ := isPretty(r)
+			if etag, ok := queryETag(appliedIdx, qr.Request, isAssoc, pretty, resp.Results.JSONColumns, redacted != nil); ok {
+				w.Header().Set("ETag", etag)
+				w.Header().Set("Cache-Control", "no-cache")
+				if etagMatch(r.Header.Get("If-None-Match"), etag) {
+					stats.Add(numQueriesNotModified, 1)
+					w.WriteHeader(http.StatusNotModified)
+					return
+				}
+			}
+		}
+	}
+	resp.end = time.Now()
+	s.writeResponse(w, r, resp)
+}
+
+func (s *Service) handleRequest(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+
+	if !s.CheckRequestPermAll(r, auth.PermQuery, auth.PermExecute) {
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+
+	if r.Method != "POST" {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	timeout, frsh, lvl, isTx, timings, redirect, noRewriteRandom, isAssoc, err := executeQueryReqParams(r, defaultTimeout)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	b, err := io.ReadAll(r.Body)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	r.Body.Close()
+
+	stmts, err := s.parseRequest(b)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	stats.Add(numRequestStmtsRx, int64(len(stmts)))
+	meta, err := isMeta(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if err := command.Rewrite(stmts, noRewriteRandom); err != nil {
+		http.Error(w, fmt.Sprintf("SQL rewrite: %s", err.Error()), http.StatusInternalServerError)
+		return
+	}
+
+	resp := NewResponse()
+	resp.Results.AssociativeJSON = isAssoc
+	if resp.Results.JSONColumns, err = isJSONColumns(r); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	lvl, ok := s.readLevel(w, r, lvl)
+	if !ok {
+		return
+	}
+	release, ok := s.acquireQuerySlot(w, r)
+	if !ok {
+		return
+	}
+	defer release()
+	if !s.checkRiskyWrites(w, r, stmts, resp, false) {
+		return
+	}
+
+	eqr := &command.ExecuteQueryRequest{
+		Request: &command.Request{
+			Transaction: isTx,
+			Statements:  stmts,
+		},
+		Timings:   timings || meta,
+		Level:     lvl,
+		Freshness: frsh.Nanoseconds(),
+	}
+
+	var servedBy string
+	results, idx, resultErr := s.store.RequestWithIndex(eqr)
+	if resultErr != nil && resultErr == store.ErrNotLeader {
+		if redirect {
+			leaderAPIAddr := s.LeaderAPIAddr()
+			if leaderAPIAddr == "" {
+				stats.Add(numLeaderNotFound, 1)
+				http.Error(w, ErrLeaderNotFound.Error(), http.StatusServiceUnavailable)
+				return
+			}
+			loc := s.FormRedirect(r, leaderAPIAddr)
+			http.Redirect(w, r, loc, http.StatusMovedPermanently)
+			return
+		}
+
+		addr, err := s.store.LeaderAddr()
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		if addr == "" {
+			stats.Add(numLeaderNotFound, 1)
+			http.Error(w, ErrLeaderNotFound.Error(), http.StatusServiceUnavailable)
+			return
+		}
+		username, password, ok := r.BasicAuth()
+		if !ok {
+			username = ""
+		}
+
+		w.Header().Add(ServedByHTTPHeader, addr)
+		servedBy = addr
+		results, idx, resultErr = s.cluster.RequestWithIndex(eqr, addr, makeCredentials(username, password), timeout)
+		if resultErr != nil {
+			stats.Add(numRemoteRequestsFailed, 1)
+			if resultErr.Error() == "unauthorized" {
+				http.Error(w, "remote request not authorized", http.StatusUnauthorized)
+				return
+			}
+		}
+		stats.Add(numRemoteRequests, 1)
+	}
+
+	if meta {
+		resp.Meta = s.newResponseMeta(servedBy, idx)
+		resp.Meta.SQLiteTime = requestTime(results, timings)
+	}
+	if resultErr != nil {
+		resp.Error = resultErr.Error()
+		writeApplyBacklogStatus(w, resultErr)
+	} else {
+		resp.Results.ExecuteQueryResponse = redactResponses(results, s.redactedColumns(r))
+		s.setSessionIndex(w, r, idx)
+	}
+	resp.end = time.Now()
+	s.writeResponse(w, r, resp)
+}
+
+// handleTemplate handles invocations of query templates.
+func (s *Service) handleTemplate(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+
+	if s.Templates == nil {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+	tmpl, ok := s.Templates.Get(strings.TrimPrefix(r.URL.Path, "/api/q/"))
+	if !ok {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+
+	perm := auth.PermQuery
+	if tmpl.Write {
+		perm = auth.PermExecute
+	}
+	if !s.CheckRequestPerm(r, perm) {
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+
+	if r.Method != "POST" && (tmpl.Write || r.Method != "GET") {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	stmt, err := tmpl.Statement(r.Form)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	timeout, err := timeoutParam(r, defaultTimeout)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	isAssoc, err := isAssociative(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	resp := NewResponse()
+	resp.Results.AssociativeJSON = isAssoc
+	if resp.Results.JSONColumns, err = isJSONColumns(r); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	req := &command.Request{
+		Statements: []*command.Statement{stmt},
+	}
+
+	var resultsErr error
+	if tmpl.Write {
+		var results []*command.ExecuteResult
+		var idx uint64
+		results, idx, resultsErr = s.executeOrForward(w, r, &command.ExecuteRequest{Request: req}, timeout)
+		if resultsErr == nil {
+			resp.Results.ExecuteResult = results
+			s.setSessionIndex(w, r, idx)
+		}
+	} else {
+		lvl, ok := s.readLevel(w, r, tmpl.level)
+		if !ok {
+			return
+		}
+		release, ok := s.acquireQuerySlot(w, r)
+		if !ok {
+			return
+		}
+		defer release()
+		qr := &command.QueryRequest{
+			Request: req,
+			Level:   lvl,
+		}
+		var results []*command.QueryRows
+		results, resultsErr = s.queryOrForward(w, r, qr, timeout)
+		if resultsErr == nil {
+			resp.Results.QueryRows = redactRows(results, s.redactedColumns(r), false)
+		}
+	}
+	if resultsErr == ErrLeaderNotFound {
+		http.Error(w, resultsErr.Error(), http.StatusServiceUnavailable)
+		return
+	}
+	if resultsErr != nil {
+		resp.Error = resultsErr.Error()
+	}
+	resp.end = time.Now()
+	s.writeResponse(w, r, resp)
+}
+
+// graphQLRequest is a GraphQL request, as sent in the body of a POST request.
+type graphQLRequest struct {
+	Query         string                 `json:"query"`
+	OperationName string                 `json:"operationName"`
+	Variables     map[string]interface{} `json:"variables"`
+}
+
+// handleGraphQL handles GraphQL queries and mutations of the database tables.
+func (s *Service) handleGraphQL(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+
+	if r.Method != "GET" && r.Method != "POST" {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	var gr graphQLRequest
+	if r.Method == "GET" {
+		q := r.URL.Query()
+		gr.Query = q.Get("query")
+		gr.OperationName = q.Get("operationName")
+		if v := q.Get("variables"); v != "" {
+			dec := json.NewDecoder(strings.NewReader(v))
+			dec.UseNumber()
+			if err := dec.Decode(&gr.Variables); err != nil {
+				s.writeGraphQLError(w, r, http.StatusBadRequest, err)
+				return
+			}
+		}
+	} else if strings.HasPrefix(r.Header.Get("Content-Type"), "application/graphql") {
+		b, err := io.ReadAll(r.Body)
+		if err != nil {
+			s.writeGraphQLError(w, r, http.StatusBadRequest, err)
+			return
+		}
+		gr.Query = string(b)
+	} else {
+		dec := json.NewDecoder(r.Body)
+		dec.UseNumber()
+		if err := dec.Decode(&gr); err != nil {
+			s.writeGraphQLError(w, r, http.StatusBadRequest, err)
+			return
+		}
+	}
+
+	doc, err := graphql.Parse(gr.Query)
+	if err != nil {
+		s.writeGraphQLError(w, r, http.StatusBadRequest, err)
+		return
+	}
+	op, err := doc.Operation(gr.OperationName)
+	if err != nil {
+		s.writeGraphQLError(w, r, http.StatusBadRequest, err)
+		return
+	}
+
+	perm := auth.PermQuery
+	if op.Type == graphql.OperationMutation {
+		perm = auth.PermExecute
+	}
+	if !s.CheckRequestPerm(r, perm) {
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+	if op.Type == graphql.OperationMutation && r.Method != "POST" {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	timeout, err := timeoutParam(r, defaultTimeout)
+	if err != nil {
+		s.writeGraphQLError(w, r, http.StatusBadRequest, err)
+		return
+	}
+	isTx, err := isTx(r)
+	if err != nil {
+		s.writeGraphQLError(w, r, http.StatusBadRequest, err)
+		return
+	}
+	lvl, err := level(r)
+	if err != nil {
+		s.writeGraphQLError(w, r, http.StatusBadRequest, err)
+		return
+	}
+	lvl, ok := s.readLevel(w, r, lvl)
+	if !ok {
+		return
+	}
+	release, ok := s.acquireQuerySlot(w, r)
+	if !ok {
+		return
+	}
+	defer release()
+
+	// The schema is read at the same consistency level as the operation.
+	schema, code, err := s.readSchema(w, r, lvl, timeout)
+	if err != nil {
+		s.writeGraphQLError(w, r, code, err)
+		return
+	}
+	plan, err := graphql.NewPlan(schema, doc, gr.OperationName, gr.Variables)
+	if err != nil {
+		s.writeGraphQLError(w, r, http.StatusBadRequest, err)
+		return
+	}
+
+	var resp *graphql.Response
+	req := &command.Request{
+		Transaction: isTx,
+		Statements:  plan.Statements,
+	}
+	if plan.Mutation {
+		results, idx, err := s.executeOrForward(w, r, &command.ExecuteRequest{Request: req}, timeout)
+		if err != nil {
+			s.writeGraphQLError(w, r, http.StatusOK, err)
+			return
+		}
+		resp = plan.MutationResponse(results)
+		s.setSessionIndex(w, r, idx)
+	} else {
+		rows, err := s.queryOrForward(w, r, &command.QueryRequest{Request: req, Level: lvl}, timeout)
+		if err != nil {
+			s.writeGraphQLError(w, r, http.StatusOK, err)
+			return
 		}
-		stats.Add(numRemoteQueries, 1)
+		// Fields are positional, so redacted fields remain, but are null.
+		resp = plan.QueryResponse(redactRows(rows, s.redactedColumns(r), true))
 	}
+	s.writeGraphQLResponse(w, r, http.StatusOK, resp)
+}
 
-	if resultsErr != nil {
-		resp.Error = resultsErr.Error()
+// writeGraphQLError writes a GraphQL response reporting err.
+func (s *Service) writeGraphQLError(w http.ResponseWriter, r *http.Request, code int, err error) {
+	s.writeGraphQLResponse(w, r, code, &graphql.Response{
+		Errors: []*graphql.Error{{Message: err.Error()}},
+	})
+}
+
+// writeGraphQLResponse writes a GraphQL response with the given status code.
+func (s *Service) writeGraphQLResponse(w http.ResponseWriter, r *http.Request, code int, resp *graphql.Response) {
+	var b []byte
+	var err error
+	pretty, _ := isPretty(r)
+	if pretty {
+		b, err = json.MarshalIndent(resp, "", "    ")
 	} else {
-		resp.Results.QueryRows = results
+		b, err = json.Marshal(resp)
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(code)
+	if _, err := w.Write(b); err != nil {
+		s.logger.Println("writing response failed:", err.Error())
 	}
-	resp.end = time.Now()
-	s.writeResponse(w, r, resp)
 }
 
-func (s *Service) handleRequest(w http.ResponseWriter, r *http.Request) {
+// restParams are the URL parameters interpreted by the service, rather than
+// as column filters, in requests to the REST endpoints.
+var restParams = []string{"level", "freshness", "timeout", "transaction", "pretty", "timings",
+	"redirect", "noleader", "associative"}
+
+// handleREST handles requests to the REST endpoint of a table.
+func (s *Service) handleREST(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json; charset=utf-8")
 
-	if !s.CheckRequestPermAll(r, auth.PermQuery, auth.PermExecute) {
-		w.WriteHeader(http.StatusUnauthorized)
+	name := strings.TrimPrefix(r.URL.Path, "/api/")
+	if name == "" || strings.Contains(name, "/") {
+		w.WriteHeader(http.StatusNotFound)
 		return
 	}
 
-	if r.Method != "POST" {
+	var perm string
+	switch r.Method {
+	case "GET":
+		perm = auth.PermQuery
+	case "POST", "PATCH", "DELETE":
+		perm = auth.PermExecute
+	default:
 		w.WriteHeader(http.StatusMethodNotAllowed)
 		return
 	}
+	if !s.CheckRequestPerm(r, perm) {
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
 
-	timeout, frsh, lvl, isTx, timings, redirect, noRewriteRandom, isAssoc, err := executeQueryReqParams(r, defaultTimeout)
+	timeout, err := timeoutParam(r, defaultTimeout)
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusBadRequest)
 		return
 	}
-
-	b, err := io.ReadAll(r.Body)
+	lvl, err := level(r)
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusBadRequest)
 		return
 	}
-	r.Body.Close()
+	lvl, ok := s.readLevel(w, r, lvl)
+	if !ok {
+		return
+	}
+	release, ok := s.acquireQuerySlot(w, r)
+	if !ok {
+		return
+	}
+	defer release()
 
-	stmts, err := ParseRequest(b)
+	schema, code, err := s.readSchema(w, r, lvl, timeout)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusBadRequest)
+		http.Error(w, err.Error(), code)
 		return
 	}
-	stats.Add(numRequestStmtsRx, int64(len(stmts)))
-
-	if err := command.Rewrite(stmts, noRewriteRandom); err != nil {
-		http.Error(w, fmt.Sprintf("SQL rewrite: %s", err.Error()), http.StatusInternalServerError)
+	table, ok := schema.Table(name)
+	if !ok {
+		w.WriteHeader(http.StatusNotFound)
 		return
 	}
 
-	resp := NewResponse()
-	resp.Results.AssociativeJSON = isAssoc
-
-	eqr := &command.ExecuteQueryRequest{
-		Request: &command.Request{
-			Transaction: isTx,
-			Statements:  stmts,
-		},
-		Timings:   timings,
-		Level:     lvl,
-		Freshness: frsh.Nanoseconds(),
+	params := r.URL.Query()
+	for _, p := range restParams {
+		params.Del(p)
+	}
+	var stmt *command.Statement
+	switch r.Method {
+	case "GET":
+		stmt, err = rest.Select(table, params)
+	case "POST":
+		stmt, err = rest.Insert(table, r.Body)
+	case "PATCH":
+		stmt, err = rest.Update(table, params, r.Body)
+	case "DELETE":
+		stmt, err = rest.Delete(table, params)
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	req := &command.Request{
+		Statements: []*command.Statement{stmt},
 	}
 
-	results, resultErr := s.store.Request(eqr)
-	if resultErr != nil && resultErr == store.ErrNotLeader {
-		if redirect {
-			leaderAPIAddr := s.LeaderAPIAddr()
-			if leaderAPIAddr == "" {
-				stats.Add(numLeaderNotFound, 1)
-				http.Error(w, ErrLeaderNotFound.Error(), http.StatusServiceUnavailable)
-				return
-			}
-			loc := s.FormRedirect(r, leaderAPIAddr)
-			http.Redirect(w, r, loc, http.StatusMovedPermanently)
-			return
+	var resp interface{}
+	code = http.StatusOK
+	if r.Method == "GET" {
+		rows, err := s.queryOrForward(w, r, &command.QueryRequest{Request: req, Level: lvl}, timeout)
+		if err == nil && len(rows) != 1 {
+			err = fmt.Errorf("unexpected query result")
 		}
-
-		addr, err := s.store.LeaderAddr()
 		if err != nil {
+			http.Error(w, err.Error(), statusCodeForError(err))
+			return
+		}
+		if rows[0].Error != "" {
+			http.Error(w, rows[0].Error, http.StatusBadRequest)
+			return
+		}
+		rows = redactRows(rows, s.redactedColumns(r), false)
+		if resp, err = rest.Rows(rows[0]); err != nil {
 			http.Error(w, err.Error(), http.StatusInternalServerError)
 			return
 		}
-		if addr == "" {
-			stats.Add(numLeaderNotFound, 1)
-			http.Error(w, ErrLeaderNotFound.Error(), http.StatusServiceUnavailable)
+	} else {
+		results, idx, err := s.executeOrForward(w, r, &command.ExecuteRequest{Request: req}, timeout)
+		if err == nil && len(results) != 1 {
+			err = fmt.Errorf("unexpected execute result")
+		}
+		if err != nil {
+			http.Error(w, err.Error(), statusCodeForError(err))
 			return
 		}
-		username, password, ok := r.BasicAuth()
-		if !ok {
-			username = ""
+		if results[0].Error != "" {
+			http.Error(w, results[0].Error, http.StatusBadRequest)
+			return
 		}
-
-		w.Header().Add(ServedByHTTPHeader, addr)
-		results, resultErr = s.cluster.Request(eqr, addr, makeCredentials(username, password), timeout)
-		if resultErr != nil {
-			stats.Add(numRemoteRequestsFailed, 1)
-			if resultErr.Error() == "unauthorized" {
-				http.Error(w, "remote request not authorized", http.StatusUnauthorized)
-				return
+		s.setSessionIndex(w, r, idx)
+		if r.Method == "POST" {
+			code = http.StatusCreated
+			resp = map[string]int64{
+				"last_insert_id": results[0].LastInsertId,
+				"rows_affected":  results[0].RowsAffected,
 			}
+		} else {
+			resp = map[string]int64{"rows_affected": results[0].RowsAffected}
 		}
-		stats.Add(numRemoteRequests, 1)
 	}
 
-	if resultErr != nil {
-		resp.Error = resultErr.Error()
+	var b []byte
+	pretty, _ := isPretty(r)
+	if pretty {
+		b, err = json.MarshalIndent(resp, "", "    ")
 	} else {
-		resp.Results.ExecuteQueryResponse = results
+		b, err = json.Marshal(resp)
 	}
-	resp.end = time.Now()
-	s.writeResponse(w, r, resp)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(code)
+	if _, err := w.Write(b); err != nil {
+		s.logger.Println("writing response failed:", err.Error())
+	}
+}
+
+// statusCodeForError returns the HTTP status code for an error returned by
+// queryOrForward or executeOrForward.
+func statusCodeForError(err error) int {
+	if err == ErrLeaderNotFound {
+		return http.StatusServiceUnavailable
+	}
+	return http.StatusInternalServerError
+}
+
+// readSchema reads the schema of the database, at the given consistency
+// level. If the schema cannot be read, the HTTP status code to return to
+// the client is also returned.
+func (s *Service) readSchema(w http.ResponseWriter, r *http.Request, lvl command.QueryRequest_Level,
+	timeout time.Duration) (*graphql.Schema, int, error) {
+	rows, err := s.queryOrForward(w, r, &command.QueryRequest{
+		Request: &command.Request{
+			Statements: []*command.Statement{{Sql: graphql.SchemaSQL}},
+		},
+		Level: lvl,
+	}, timeout)
+	if err != nil {
+		return nil, statusCodeForError(err), err
+	}
+	if len(rows) != 1 {
+		return nil, http.StatusInternalServerError, fmt.Errorf("unexpected schema result")
+	}
+	schema, err := graphql.NewSchema(rows[0])
+	if err != nil {
+		return nil, http.StatusInternalServerError, err
+	}
+	return schema, http.StatusOK, nil
+}
+
+// leaderAddr returns the Raft address of the leader, or ErrLeaderNotFound if
+// there is no leader.
+func (s *Service) leaderAddr() (string, error) {
+	addr, err := s.store.LeaderAddr()
+	if err != nil {
+		return "", err
+	}
+	if addr == "" {
+		stats.Add(numLeaderNotFound, 1)
+		return "", ErrLeaderNotFound
+	}
+	return addr, nil
+}
+
+// queryOrForward performs the query on this node, forwarding it to the leader
+// if this node cannot serve it.
+func (s *Service) queryOrForward(w http.ResponseWriter, r *http.Request, qr *command.QueryRequest, timeout time.Duration) ([]*command.QueryRows, error) {
+	results, err := s.store.Query(qr)
+	if err != store.ErrNotLeader {
+		return results, err
+	}
+	addr, err := s.leaderAddr()
+	if err != nil {
+		return nil, err
+	}
+	username, password, ok := r.BasicAuth()
+	if !ok {
+		username = ""
+	}
+	w.Header().Add(ServedByHTTPHeader, addr)
+	results, err = s.cluster.Query(qr, addr, makeCredentials(username, password), timeout)
+	if err != nil {
+		stats.Add(numRemoteQueriesFailed, 1)
+	}
+	stats.Add(numRemoteQueries, 1)
+	return results, err
+}
+
+// executeOrForward performs the execute on this node, forwarding it to the
+// leader if this node is not the leader. The Raft index of the write is also
+// returned.
+func (s *Service) executeOrForward(w http.ResponseWriter, r *http.Request, er *command.ExecuteRequest, timeout time.Duration) ([]*command.ExecuteResult, uint64, error) {
+	results, idx, err := s.store.ExecuteWithIndex(er)
+	if err != store.ErrNotLeader {
+		return results, idx, err
+	}
+	addr, err := s.leaderAddr()
+	if err != nil {
+		return nil, 0, err
+	}
+	username, password, ok := r.BasicAuth()
+	if !ok {
+		username = ""
+	}
+	w.Header().Add(ServedByHTTPHeader, addr)
+	results, idx, err = s.cluster.ExecuteWithIndex(er, addr, makeCredentials(username, password), timeout)
+	if err != nil {
+		stats.Add(numRemoteExecutionsFailed, 1)
+	}
+	stats.Add(numRemoteExecutions, 1)
+	return results, idx, err
 }
 
 // handleExpvar serves registered expvar information over HTTP.
@@ -1681,6 +2991,38 @@ func (s *Service) FormRedirect(r *http.Request, url string) string {
 // CheckRequestPerm checks if the request is authenticated and authorized
 // with the given Perm.
 func (s *Service) CheckRequestPerm(r *http.Request, perm string) (b bool) {
+	return s.checkRequest(r, func(username, password string) bool {
+		return s.credentialStore.AA(username, password, perm)
+	})
+}
+
+// CheckRequestPermAll checksif the request is authenticated and authorized
+// with all the given Perms.
+func (s *Service) CheckRequestPermAll(r *http.Request, perms ...string) (b bool) {
+	return s.checkRequest(r, func(username, password string) bool {
+		for _, perm := range perms {
+			if !s.credentialStore.AA(username, password, perm) {
+				return false
+			}
+		}
+		return true
+	})
+}
+
+// CheckRequestQuery checks if the request is authenticated and authorized
+// to execute the given queries, either through the query Perm, or through
+// a query Perm limited to the tables the queries read.
+func (s *Service) CheckRequestQuery(r *http.Request, queries []*command.Statement) (b bool) {
+	return s.checkRequest(r, func(username, password string) bool {
+		tables, _ := command.ReadTables(queries)
+		return s.credentialStore.AAQuery(username, password, tables)
+	})
+}
+
+// checkRequest checks the request using aa, which is passed the credentials
+// of the request, and records whether the credentials are valid with the
+// authentication throttle.
+func (s *Service) checkRequest(r *http.Request, aa func(username, password string) bool) (b bool) {
 	defer func() {
 		if b {
 			stats.Add(numAuthOK, 1)
@@ -1699,36 +3041,43 @@ func (s *Service) CheckRequestPerm(r *http.Request, perm string) (b bool) {
 		username = ""
 	}
 
-	return s.credentialStore.AA(username, password, perm)
-}
-
-// CheckRequestPermAll checksif the request is authenticated and authorized
-// with all the given Perms.
-func (s *Service) CheckRequestPermAll(r *http.Request, perms ...string) (b bool) {
-	defer func() {
-		if b {
-			stats.Add(numAuthOK, 1)
+	b = aa(username, password)
+	if s.authThrottle != nil && username != "" {
+		// The request may have been authorized without its credentials being
+		// checked, or refused despite valid credentials, so check them.
+		keys := throttleKeys(r, username)
+		if s.credentialStore.Check(username, password) {
+			s.authThrottle.Succeed(keys[0])
 		} else {
-			stats.Add(numAuthFail, 1)
+			stats.Add(numAuthBadCredentials, 1)
+			if s.authThrottle.Fail(keys...) {
+				stats.Add(numAuthLockouts, 1)
+				s.logger.Printf("locking out user %s at %s after repeated authentication failures", username, r.RemoteAddr)
+			}
 		}
-	}()
+	}
+	return b
+}
 
-	// No auth store set, so no checking required.
-	if s.credentialStore == nil {
+// checkAuthThrottle returns false, having written a response to w, if the
+// client of r is locked out for repeatedly failing authentication. Requests
+// without credentials are never refused, since they cannot guess passwords.
+func (s *Service) checkAuthThrottle(w http.ResponseWriter, r *http.Request) bool {
+	if s.authThrottle == nil {
 		return true
 	}
-
-	username, password, ok := r.BasicAuth()
+	username, _, ok := r.BasicAuth()
 	if !ok {
-		username = ""
+		return true
 	}
-
-	for _, perm := range perms {
-		if !s.credentialStore.AA(username, password, perm) {
-			return false
-		}
+	d := s.authThrottle.Locked(throttleKeys(r, username)...)
+	if d == 0 {
+		return true
 	}
-	return true
+	stats.Add(numAuthThrottled, 1)
+	w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(d.Seconds()))))
+	http.Error(w, "too many failed authentication attempts", http.StatusTooManyRequests)
+	return false
 }
 
 // LeaderAPIAddr returns the API address of the leader, as known by this node.
@@ -1750,6 +3099,11 @@ func (s *Service) runQueue() {
 	defer close(s.queueDone)
 	retryDelay := time.Second
 
+	coalesce := make(map[string]bool, len(s.QueueCoalesceTables))
+	for _, t := range s.QueueCoalesceTables {
+		coalesce[strings.ToLower(t)] = true
+	}
+
 	var err error
 	for {
 		select {
@@ -1763,6 +3117,11 @@ func (s *Service) runQueue() {
 				},
 			}
 			stats.Add(numQueuedExecutionsStmtsRx, int64(len(req.Statements)))
+			if len(coalesce) > 0 && len(req.Statements) > 1 {
+				var n int
+				er.Request.Statements, n = command.CoalesceUpserts(req.Statements, coalesce)
+				stats.Add(numQueuedExecutionsCoalesced, int64(n))
+			}
 
 			// Nil statements are valid, as clients may want to just send
 			// a "checkpoint" through the queue.
@@ -1910,7 +3269,7 @@ func (s *Service) writeResponse(w http.ResponseWriter, r *http.Request, j Respon
 	}
 }
 
-func requestQueries(r *http.Request) ([]*command.Statement, error) {
+func (s *Service) requestQueries(r *http.Request) ([]*command.Statement, error) {
 	if r.Method == "GET" {
 		query, err := stmtParam(r)
 		if err != nil || query == "" {
@@ -1929,7 +3288,7 @@ func requestQueries(r *http.Request) ([]*command.Statement, error) {
 	}
 	r.Body.Close()
 
-	return ParseRequest(b)
+	return s.parseRequest(b)
 }
 
 // queryParam returns whether the given query param is present.
@@ -1988,6 +3347,21 @@ func timeoutParam(req *http.Request, def time.Duration) (time.Duration, error) {
 	return t, nil
 }
 
+// countParam returns the value, if any, set for n. If not set, it
+// returns the value passed in as a default.
+func countParam(req *http.Request, def int) (int, error) {
+	q := req.URL.Query()
+	n := strings.TrimSpace(q.Get("n"))
+	if n == "" {
+		return def, nil
+	}
+	i, err := strconv.Atoi(n)
+	if err != nil || i < 0 {
+		return 0, fmt.Errorf("invalid count %s", n)
+	}
+	return i, nil
+}
+
 // isTx returns whether the HTTP request is requesting a transaction.
 func isTx(req *http.Request) (bool, error) {
 	return queryParam(req, "transaction")
@@ -1998,6 +3372,17 @@ func isQueue(req *http.Request) (bool, error) {
 	return queryParam(req, "queue")
 }
 
+// isPartial returns whether the HTTP request is requesting that each statement
+// is applied under its own savepoint.
+func isPartial(req *http.Request) (bool, error) {
+	return queryParam(req, "partial")
+}
+
+// isDryRun returns whether the HTTP request is requesting a dry run.
+func isDryRun(req *http.Request) (bool, error) {
+	return queryParam(req, "dry_run")
+}
+
 // reqParams is a convenience function to get a bunch of query params
 // in one function call.
 func reqParams(req *http.Request, def time.Duration) (timeout time.Duration, tx, timings, redirect, noRwRandom bool, err error) {
@@ -2077,6 +3462,12 @@ func isWait(req *http.Request) (bool, error) {
 	return queryParam(req, "wait")
 }
 
+// isJSONColumns returns whether the values of JSON columns should be
+// rendered as JSON, rather than as strings.
+func isJSONColumns(req *http.Request) (bool, error) {
+	return queryParam(req, "jsoncolumns")
+}
+
 func isAssociative(req *http.Request) (bool, error) {
 	return queryParam(req, "associative")
 }
@@ -2103,6 +3494,126 @@ func level(req *http.Request) (command.QueryRequest_Level, error) {
 	}
 }
 
+// sessionIndex returns the Raft index of the last write made in the session
+// of the request, or 0 if it is not known. The header takes precedence over
+// the cookie.
+func sessionIndex(r *http.Request) uint64 {
+	v := r.Header.Get(SessionIndexHTTPHeader)
+	if v == "" {
+		c, err := r.Cookie(SessionIndexCookie)
+		if err != nil {
+			return 0
+		}
+		v = c.Value
+	}
+	idx, err := strconv.ParseUint(v, 10, 64)
+	if err != nil {
+		return 0
+	}
+	return idx
+}
+
+// setSessionIndex records idx in the response as the Raft index of the last
+// write made in the session of the request, if session consistency is enabled.
+func (s *Service) setSessionIndex(w http.ResponseWriter, r *http.Request, idx uint64) {
+	if !s.SessionConsistency || idx == 0 {
+		return
+	}
+	if cur := sessionIndex(r); cur > idx {
+		idx = cur
+	}
+	v := strconv.FormatUint(idx, 10)
+	w.Header().Set(SessionIndexHTTPHeader, v)
+	http.SetCookie(w, &http.Cookie{
+		Name:     SessionIndexCookie,
+		Value:    v,
+		Path:     "/",
+		HttpOnly: true,
+		SameSite: http.SameSiteLaxMode,
+	})
+}
+
+// writeApplyBacklogStatus writes 503 Service Unavailable, and a hint of when
+// to retry, if err shows a write was refused because the Leader had too many
+// writes waiting to be applied. The error may have come from another node, so
+// is compared by its text.
+func writeApplyBacklogStatus(w http.ResponseWriter, err error) {
+	if err.Error() != store.ErrApplyBacklog.Error() {
+		return
+	}
+	stats.Add(numApplyBacklogRefusals, 1)
+	w.Header().Set("Retry-After", "1")
+	w.WriteHeader(http.StatusServiceUnavailable)
+}
+
+// readLevel returns the level at which a read requested at lvl is performed,
+// accounting for maintenance mode and the session of the client. If the read
+// cannot be served, an error is written to w and false is returned.
+func (s *Service) readLevel(w http.ResponseWriter, r *http.Request, lvl command.QueryRequest_Level) (command.QueryRequest_Level, bool) {
+	if lvl == command.QueryRequest_QUERY_REQUEST_LEVEL_NONE {
+		s.maintenanceMu.RLock()
+		maintenance, proxy := s.maintenance, s.maintenanceProxy
+		s.maintenanceMu.RUnlock()
+		if maintenance {
+			if !proxy {
+				stats.Add(numMaintenanceReadsRefused, 1)
+				w.Header().Set("Retry-After", "1")
+				http.Error(w, ErrMaintenance.Error(), http.StatusServiceUnavailable)
+				return lvl, false
+			}
+			stats.Add(numMaintenanceReadsForwarded, 1)
+			return command.QueryRequest_QUERY_REQUEST_LEVEL_WEAK, true
+		}
+	}
+	return s.sessionLevel(r, lvl), true
+}
+
+// sessionLevel returns the read consistency level to use for a request, such
+// that it reflects every write made earlier in its session. A read at level
+// none waits for this node to apply the last write of the session, and if that
+// does not happen promptly the read is upgraded to level weak.
+func (s *Service) sessionLevel(r *http.Request, lvl command.QueryRequest_Level) command.QueryRequest_Level {
+	if !s.SessionConsistency || lvl != command.QueryRequest_QUERY_REQUEST_LEVEL_NONE {
+		return lvl
+	}
+	idx := sessionIndex(r)
+	if idx == 0 || s.store.AppliedIndex() >= idx {
+		return lvl
+	}
+	if err := s.store.WaitForAppliedIndex(idx, sessionWaitTimeout); err != nil {
+		stats.Add(numSessionReadsUpgraded, 1)
+		return command.QueryRequest_QUERY_REQUEST_LEVEL_WEAK
+	}
+	stats.Add(numSessionReadsWaited, 1)
+	return lvl
+}
+
+// leaderFreshness returns any bound requested with a weak read on the age of
+// the leader's confirmation of its leadership.
+func leaderFreshness(req *http.Request) (time.Duration, error) {
+	q := req.URL.Query()
+	f := strings.TrimSpace(q.Get("leader_freshness"))
+	if f == "" {
+		return 0, nil
+	}
+	return time.ParseDuration(f)
+}
+
+// minSchemaVersion returns the minimum schema version required by a query,
+// or 0 if none is.
+func minSchemaVersion(req *http.Request) (int64, error) {
+	q := req.URL.Query()
+	v := strings.TrimSpace(q.Get("min_schema_version"))
+	if v == "" {
+		return 0, nil
+	}
+	n, err := strconv.ParseInt(v, 10, 64)
+	if err != nil || n < 0 {
+		return 0, fmt.Errorf("invalid min_schema_version %q", v)
+	}
+	return n, nil
+}
+
 // freshness returns any freshness requested with a query.
 func freshness(req *http.Request) (time.Duration, error) {
 	q := req.URL.Query()
@@ -0,0 +1,290 @@
+package http
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/rqlite/rqlite/auth"
+	"github.com/rqlite/rqlite/command"
+	"github.com/rqlite/rqlite/http/rest"
+	"github.com/rqlite/rqlite/store"
+)
+
+// spatialIndex is the JSON representation of a spatial index.
+type spatialIndex struct {
+	Name  string `json:"name"`
+	Table string `json:"table"`
+	MinX  string `json:"min_x"`
+	MinY  string `json:"min_y"`
+	MaxX  string `json:"max_x,omitempty"`
+	MaxY  string `json:"max_y,omitempty"`
+}
+
+func newSpatialIndex(si *store.SpatialIndex) *spatialIndex {
+	return &spatialIndex{
+		Name:  si.Name,
+		Table: si.Table,
+		MinX:  si.MinX,
+		MinY:  si.MinY,
+		MaxX:  si.MaxX,
+		MaxY:  si.MaxY,
+	}
+}
+
+// handleSpatialIndexes handles requests to list, create and drop spatial
+// indexes. Listing indexes requires the query permission, and changing them
+// the execute permission. Changes are replicated, so must be served by the
+// leader.
+func (s *Service) handleSpatialIndexes(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+
+	perm := auth.PermExecute
+	if r.Method == "GET" {
+		perm = auth.PermQuery
+	}
+	if !s.CheckRequestPerm(r, perm) {
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+
+	var resp interface{}
+	var err error
+	switch r.Method {
+	case "GET":
+		var sis []*store.SpatialIndex
+		sis, err = s.store.SpatialIndexes()
+		indexes := make([]*spatialIndex, 0, len(sis))
+		for _, si := range sis {
+			indexes = append(indexes, newSpatialIndex(si))
+		}
+		resp = map[string]interface{}{"indexes": indexes}
+	case "POST":
+		si, parseErr := parseSpatialIndex(r.Body)
+		if parseErr != nil {
+			http.Error(w, parseErr.Error(), http.StatusBadRequest)
+			return
+		}
+		if err = s.store.CreateSpatialIndex(si); err == nil {
+			resp = newSpatialIndex(si)
+		}
+	case "DELETE":
+		name := strings.TrimSpace(r.URL.Query().Get("name"))
+		if name == "" {
+			http.Error(w, "spatial index name required", http.StatusBadRequest)
+			return
+		}
+		err = s.store.DropSpatialIndex(name)
+		resp = map[string]interface{}{}
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	if err != nil {
+		if errors.Is(err, store.ErrNotLeader) {
+			leaderAPIAddr := s.LeaderAPIAddr()
+			if leaderAPIAddr == "" {
+				stats.Add(numLeaderNotFound, 1)
+				http.Error(w, ErrLeaderNotFound.Error(), http.StatusServiceUnavailable)
+				return
+			}
+			http.Redirect(w, r, s.FormRedirect(r, leaderAPIAddr), http.StatusTemporaryRedirect)
+			return
+		}
+		if errors.Is(err, store.ErrSpatialIndexNotFound) {
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
+		}
+		if errors.Is(err, store.ErrSpatialIndexInvalid) {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	b, err := json.Marshal(resp)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if _, err := w.Write(b); err != nil {
+		s.logger.Println("writing response failed:", err.Error())
+	}
+}
+
+// handleSpatialSearch handles requests to search the named spatial index,
+// for the rows of its table within a box, given by the bbox parameter, or
+// within a radius, in metres, of a point, given by the near and radius
+// parameters. The rows are returned as by the REST endpoints, and the query
+// is made at the requested read consistency level. The definition of the
+// index is read from the database of this node.
+func (s *Service) handleSpatialSearch(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+
+	if r.Method != "GET" {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	if !s.CheckRequestQuery(r, nil) {
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+
+	timeout, err := timeoutParam(r, defaultTimeout)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	lvl, err := level(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	si, err := s.store.SpatialIndex(strings.TrimPrefix(r.URL.Path, "/db/spatial-indexes/"))
+	if err != nil {
+		if errors.Is(err, store.ErrSpatialIndexNotFound) {
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
+		}
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	stmt, err := spatialSearch(si, r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if !s.CheckRequestQuery(r, []*command.Statement{stmt}) {
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+
+	lvl, ok := s.readLevel(w, r, lvl)
+	if !ok {
+		return
+	}
+	release, ok := s.acquireQuerySlot(w, r)
+	if !ok {
+		return
+	}
+	defer release()
+
+	rows, err := s.queryOrForward(w, r, &command.QueryRequest{
+		Request: &command.Request{Statements: []*command.Statement{stmt}},
+		Level:   lvl,
+	}, timeout)
+	if err == nil && len(rows) != 1 {
+		err = fmt.Errorf("unexpected query result")
+	}
+	if err != nil {
+		http.Error(w, err.Error(), statusCodeForError(err))
+		return
+	}
+	if rows[0].Error != "" {
+		http.Error(w, rows[0].Error, http.StatusBadRequest)
+		return
+	}
+	rows = redactRows(rows, s.redactedColumns(r), false)
+	objs, err := rest.Rows(rows[0])
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	var b []byte
+	pretty, _ := isPretty(r)
+	if pretty {
+		b, err = json.MarshalIndent(objs, "", "    ")
+	} else {
+		b, err = json.Marshal(objs)
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if _, err := w.Write(b); err != nil {
+		s.logger.Println("writing response failed:", err.Error())
+	}
+}
+
+// spatialSearch returns the statement searching si as requested by the
+// bbox, near, radius and limit parameters of r.
+func spatialSearch(si *store.SpatialIndex, r *http.Request) (*command.Statement, error) {
+	q := r.URL.Query()
+	limit := 0
+	if v := q.Get("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n <= 0 {
+			return nil, fmt.Errorf("invalid limit %q", v)
+		}
+		limit = n
+	}
+
+	if v := q.Get("bbox"); v != "" {
+		b, err := parseFloats(v, 4)
+		if err != nil {
+			return nil, fmt.Errorf("invalid bbox: %s", err.Error())
+		}
+		if b[0] > b[2] || b[1] > b[3] {
+			return nil, errors.New("invalid bbox: minimum exceeds maximum")
+		}
+		return si.BoxQuery(b[0], b[1], b[2], b[3], limit), nil
+	}
+	if v := q.Get("near"); v != "" {
+		p, err := parseFloats(v, 2)
+		if err != nil {
+			return nil, fmt.Errorf("invalid near: %s", err.Error())
+		}
+		radius, err := strconv.ParseFloat(q.Get("radius"), 64)
+		if err != nil || radius <= 0 {
+			return nil, errors.New("positive radius required")
+		}
+		return si.RadiusQuery(p[0], p[1], radius, limit), nil
+	}
+	return nil, errors.New("bbox, or near and radius, required")
+}
+
+// parseFloats parses exactly n comma-separated numbers from s.
+func parseFloats(s string, n int) ([]float64, error) {
+	parts := strings.Split(s, ",")
+	if len(parts) != n {
+		return nil, fmt.Errorf("%d comma-separated numbers required", n)
+	}
+	fs := make([]float64, n)
+	for i, p := range parts {
+		f, err := strconv.ParseFloat(strings.TrimSpace(p), 64)
+		if err != nil {
+			return nil, err
+		}
+		fs[i] = f
+	}
+	return fs, nil
+}
+
+// parseSpatialIndex parses the definition of a spatial index from the body
+// of a request to create it.
+func parseSpatialIndex(r io.Reader) (*store.SpatialIndex, error) {
+	var v spatialIndex
+	if err := json.NewDecoder(r).Decode(&v); err != nil {
+		return nil, err
+	}
+	si := &store.SpatialIndex{
+		Name:  strings.TrimSpace(v.Name),
+		Table: strings.TrimSpace(v.Table),
+		MinX:  strings.TrimSpace(v.MinX),
+		MinY:  strings.TrimSpace(v.MinY),
+		MaxX:  strings.TrimSpace(v.MaxX),
+		MaxY:  strings.TrimSpace(v.MaxY),
+	}
+	if si.Name == "" || si.Table == "" || si.MinX == "" || si.MinY == "" {
+		return nil, errors.New("spatial index name, table, min_x and min_y required")
+	}
+	return si, nil
+}
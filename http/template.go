@@ -0,0 +1,159 @@
+package http
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/rqlite/rqlite/command"
+)
+
+// Types of query template parameters.
+const (
+	TemplateParamText    = "text"
+	TemplateParamInteger = "integer"
+	TemplateParamReal    = "real"
+	TemplateParamBool    = "bool"
+)
+
+var templateNameRe = regexp.MustCompile(`^[A-Za-z0-9_-]+$`)
+
+// TemplateParam describes a parameter of a query template.
+type TemplateParam struct {
+	Name string `json:"name"`
+	Type string `json:"type,omitempty"`
+}
+
+// QueryTemplate is a named, parameterized SQL statement. Clients invoke a
+// template by name, supplying only the values of its parameters, which are
+// bound to the named parameters of the statement.
+type QueryTemplate struct {
+	Name   string          `json:"name"`
+	SQL    string          `json:"sql"`
+	Params []TemplateParam `json:"params,omitempty"`
+
+	// Write is whether the statement modifies the database.
+	Write bool `json:"write,omitempty"`
+
+	// Level is the read consistency level used for the statement, if it
+	// does not modify the database. Defaults to "weak".
+	Level string `json:"level,omitempty"`
+
+	level command.QueryRequest_Level
+}
+
+// Statement returns the statement of the template, with its parameters bound
+// to the given values. All parameters must be supplied.
+func (q *QueryTemplate) Statement(values url.Values) (*command.Statement, error) {
+	stmt := &command.Statement{
+		Sql: q.SQL,
+	}
+	for _, p := range q.Params {
+		if _, ok := values[p.Name]; !ok {
+			return nil, fmt.Errorf("missing parameter %s", p.Name)
+		}
+		v := values.Get(p.Name)
+		param := &command.Parameter{Name: p.Name}
+		switch p.Type {
+		case TemplateParamInteger:
+			i, err := strconv.ParseInt(v, 10, 64)
+			if err != nil {
+				return nil, fmt.Errorf("parameter %s is not an integer", p.Name)
+			}
+			param.Value = &command.Parameter_I{I: i}
+		case TemplateParamReal:
+			d, err := strconv.ParseFloat(v, 64)
+			if err != nil {
+				return nil, fmt.Errorf("parameter %s is not a real", p.Name)
+			}
+			param.Value = &command.Parameter_D{D: d}
+		case TemplateParamBool:
+			b, err := strconv.ParseBool(v)
+			if err != nil {
+				return nil, fmt.Errorf("parameter %s is not a bool", p.Name)
+			}
+			param.Value = &command.Parameter_B{B: b}
+		default:
+			param.Value = &command.Parameter_S{S: v}
+		}
+		stmt.Parameters = append(stmt.Parameters, param)
+	}
+	return stmt, nil
+}
+
+// TemplateStore stores the query templates which may be invoked.
+type TemplateStore struct {
+	templates map[string]*QueryTemplate
+}
+
+// NewTemplateStore returns a new, empty, TemplateStore.
+func NewTemplateStore() *TemplateStore {
+	return &TemplateStore{
+		templates: make(map[string]*QueryTemplate),
+	}
+}
+
+// NewTemplateStoreFromFile returns a new TemplateStore loaded from a file.
+func NewTemplateStoreFromFile(path string) (*TemplateStore, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	t := NewTemplateStore()
+	return t, t.Load(f)
+}
+
+// Load loads a JSON array of query templates from r.
+func (t *TemplateStore) Load(r io.Reader) error {
+	var templates []*QueryTemplate
+	if err := json.NewDecoder(r).Decode(&templates); err != nil {
+		return err
+	}
+
+	for _, q := range templates {
+		if !templateNameRe.MatchString(q.Name) {
+			return fmt.Errorf("invalid template name '%s'", q.Name)
+		}
+		if _, ok := t.templates[q.Name]; ok {
+			return fmt.Errorf("duplicate template '%s'", q.Name)
+		}
+		if strings.TrimSpace(q.SQL) == "" {
+			return fmt.Errorf("template '%s' has no SQL", q.Name)
+		}
+		for _, p := range q.Params {
+			if p.Name == "" {
+				return fmt.Errorf("template '%s' has unnamed parameter", q.Name)
+			}
+			switch p.Type {
+			case "", TemplateParamText, TemplateParamInteger, TemplateParamReal, TemplateParamBool:
+			default:
+				return fmt.Errorf("template '%s' parameter %s has unknown type '%s'", q.Name, p.Name, p.Type)
+			}
+		}
+		switch strings.ToLower(q.Level) {
+		case "", "weak":
+			q.level = command.QueryRequest_QUERY_REQUEST_LEVEL_WEAK
+		case "none":
+			q.level = command.QueryRequest_QUERY_REQUEST_LEVEL_NONE
+		case "strong":
+			q.level = command.QueryRequest_QUERY_REQUEST_LEVEL_STRONG
+		default:
+			return fmt.Errorf("template '%s' has unknown level '%s'", q.Name, q.Level)
+		}
+		t.templates[q.Name] = q
+	}
+	return nil
+}
+
+// Get returns the template with the given name, if any.
+func (t *TemplateStore) Get(name string) (*QueryTemplate, bool) {
+	q, ok := t.templates[name]
+	return q, ok
+}
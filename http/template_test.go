@@ -0,0 +1,110 @@
+package http
+
+import (
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/rqlite/rqlite/command"
+)
+
+func Test_TemplateStoreLoad(t *testing.T) {
+	ts := NewTemplateStore()
+	err := ts.Load(strings.NewReader(`[
+		{
+			"name": "user_by_id",
+			"sql": "SELECT * FROM users WHERE id = :id",
+			"params": [{"name": "id", "type": "integer"}],
+			"level": "none"
+		},
+		{
+			"name": "add_user",
+			"sql": "INSERT INTO users(name, score, active) VALUES(:name, :score, :active)",
+			"params": [{"name": "name"}, {"name": "score", "type": "real"}, {"name": "active", "type": "bool"}],
+			"write": true
+		}
+	]`))
+	if err != nil {
+		t.Fatalf("failed to load templates: %s", err.Error())
+	}
+
+	q, ok := ts.Get("user_by_id")
+	if !ok {
+		t.Fatalf("template user_by_id not found")
+	}
+	if q.Write || q.level != command.QueryRequest_QUERY_REQUEST_LEVEL_NONE {
+		t.Fatalf("template user_by_id loaded incorrectly")
+	}
+	q, ok = ts.Get("add_user")
+	if !ok {
+		t.Fatalf("template add_user not found")
+	}
+	if !q.Write || q.level != command.QueryRequest_QUERY_REQUEST_LEVEL_WEAK {
+		t.Fatalf("template add_user loaded incorrectly")
+	}
+	if _, ok := ts.Get("nonexistent"); ok {
+		t.Fatalf("nonexistent template found")
+	}
+}
+
+func Test_TemplateStoreLoadInvalid(t *testing.T) {
+	for _, tt := range []struct {
+		name string
+		json string
+	}{
+		{"bad name", `[{"name": "a/b", "sql": "SELECT 1"}]`},
+		{"duplicate", `[{"name": "a", "sql": "SELECT 1"}, {"name": "a", "sql": "SELECT 2"}]`},
+		{"no SQL", `[{"name": "a", "sql": " "}]`},
+		{"unnamed param", `[{"name": "a", "sql": "SELECT :x", "params": [{"type": "text"}]}]`},
+		{"bad param type", `[{"name": "a", "sql": "SELECT :x", "params": [{"name": "x", "type": "date"}]}]`},
+		{"bad level", `[{"name": "a", "sql": "SELECT 1", "level": "linearizable"}]`},
+		{"bad JSON", `{"name": "a"}`},
+	} {
+		if err := NewTemplateStore().Load(strings.NewReader(tt.json)); err == nil {
+			t.Fatalf("loading template with %s succeeded", tt.name)
+		}
+	}
+}
+
+func Test_TemplateStatement(t *testing.T) {
+	q := &QueryTemplate{
+		Name: "t",
+		SQL:  "SELECT * FROM foo WHERE a = :a AND b = :b AND c = :c AND d = :d",
+		Params: []TemplateParam{
+			{Name: "a", Type: TemplateParamInteger},
+			{Name: "b", Type: TemplateParamReal},
+			{Name: "c", Type: TemplateParamBool},
+			{Name: "d"},
+		},
+	}
+
+	stmt, err := q.Statement(url.Values{"a": {"5"}, "b": {"1.5"}, "c": {"true"}, "d": {"fiona"}, "e": {"ignored"}})
+	if err != nil {
+		t.Fatalf("failed to create statement: %s", err.Error())
+	}
+	if stmt.Sql != q.SQL {
+		t.Fatalf("wrong SQL, got %s", stmt.Sql)
+	}
+	if len(stmt.Parameters) != 4 {
+		t.Fatalf("wrong number of parameters, exp 4, got %d", len(stmt.Parameters))
+	}
+	if p := stmt.Parameters[0]; p.Name != "a" || p.GetI() != 5 {
+		t.Fatalf("wrong parameter a: %v", p)
+	}
+	if p := stmt.Parameters[1]; p.Name != "b" || p.GetD() != 1.5 {
+		t.Fatalf("wrong parameter b: %v", p)
+	}
+	if p := stmt.Parameters[2]; p.Name != "c" || !p.GetB() {
+		t.Fatalf("wrong parameter c: %v", p)
+	}
+	if p := stmt.Parameters[3]; p.Name != "d" || p.GetS() != "fiona" {
+		t.Fatalf("wrong parameter d: %v", p)
+	}
+
+	if _, err := q.Statement(url.Values{"a": {"5"}, "b": {"1.5"}, "c": {"true"}}); err == nil {
+		t.Fatalf("created statement with missing parameter")
+	}
+	if _, err := q.Statement(url.Values{"a": {"five"}, "b": {"1.5"}, "c": {"true"}, "d": {"x"}}); err == nil {
+		t.Fatalf("created statement with invalid integer parameter")
+	}
+}
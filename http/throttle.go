@@ -0,0 +1,137 @@
+package http
+
+import (
+	"net"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// authThrottle locks out clients which repeatedly fail authentication. A
+// client is identified both by the username it presents and by its IP
+// address, so that neither guessing the password of one user from many
+// addresses, nor guessing the passwords of many users from one address,
+// escapes the throttle.
+type authThrottle struct {
+	threshold  int
+	lockout    time.Duration
+	maxLockout time.Duration
+
+	mu        sync.Mutex
+	entries   map[string]*throttleEntry
+	lastSweep time.Time
+
+	now func() time.Time
+}
+
+// throttleEntry tracks the authentication failures of a single client.
+type throttleEntry struct {
+	failures int       // Consecutive failures.
+	last     time.Time // Time of the last failure.
+	until    time.Time // End of the lockout, if any.
+}
+
+// newAuthThrottle returns an authThrottle which, once a client has failed
+// authentication threshold times in a row, locks it out for lockout. Each
+// further failure doubles the lockout, up to maxLockout.
+func newAuthThrottle(threshold int, lockout, maxLockout time.Duration) *authThrottle {
+	if maxLockout < lockout {
+		maxLockout = lockout
+	}
+	return &authThrottle{
+		threshold:  threshold,
+		lockout:    lockout,
+		maxLockout: maxLockout,
+		entries:    make(map[string]*throttleEntry),
+		now:        time.Now,
+	}
+}
+
+// Locked returns how much longer any of the given clients are locked out.
+// It returns zero if none are.
+func (a *authThrottle) Locked(keys ...string) time.Duration {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	now := a.now()
+	var d time.Duration
+	for _, k := range keys {
+		if e, ok := a.entries[k]; ok && e.until.After(now) {
+			if r := e.until.Sub(now); r > d {
+				d = r
+			}
+		}
+	}
+	return d
+}
+
+// Fail records an authentication failure by each of the given clients. It
+// returns true if any of them is locked out as a result.
+func (a *authThrottle) Fail(keys ...string) bool {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	now := a.now()
+	a.sweep(now)
+
+	locked := false
+	for _, k := range keys {
+		e, ok := a.entries[k]
+		if !ok {
+			e = &throttleEntry{}
+			a.entries[k] = e
+		}
+		e.failures++
+		e.last = now
+		if e.failures < a.threshold {
+			continue
+		}
+		d := a.lockout
+		for i := a.threshold; i < e.failures && d < a.maxLockout; i++ {
+			d *= 2
+		}
+		if d > a.maxLockout {
+			d = a.maxLockout
+		}
+		e.until = now.Add(d)
+		locked = true
+	}
+	return locked
+}
+
+// Succeed forgets the failures of the given clients.
+func (a *authThrottle) Succeed(keys ...string) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	for _, k := range keys {
+		delete(a.entries, k)
+	}
+}
+
+// Len returns the number of clients with failures being tracked.
+func (a *authThrottle) Len() int {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return len(a.entries)
+}
+
+// sweep forgets clients which are not locked out, and which have not failed
+// authentication for the maximum lockout. It runs at most once a minute.
+func (a *authThrottle) sweep(now time.Time) {
+	if now.Sub(a.lastSweep) < time.Minute {
+		return
+	}
+	a.lastSweep = now
+	for k, e := range a.entries {
+		if !e.until.After(now) && now.Sub(e.last) > a.maxLockout {
+			delete(a.entries, k)
+		}
+	}
+}
+
+// throttleKeys returns the keys identifying the client of r to the throttle.
+func throttleKeys(r *http.Request, username string) []string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	return []string{"user:" + username, "ip:" + host}
+}
@@ -0,0 +1,135 @@
+package http
+
+import (
+	"expvar"
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/rqlite/rqlite/auth"
+)
+
+func Test_AuthThrottle(t *testing.T) {
+	now := time.Unix(0, 0)
+	a := newAuthThrottle(3, time.Second, 5*time.Second)
+	a.now = func() time.Time { return now }
+
+	for i := 0; i < 2; i++ {
+		if a.Fail("user:bob", "ip:1.2.3.4") {
+			t.Fatalf("locked out after %d failures", i+1)
+		}
+	}
+	if d := a.Locked("user:bob"); d != 0 {
+		t.Fatalf("locked out before threshold, for %s", d)
+	}
+	if !a.Fail("user:bob", "ip:1.2.3.4") {
+		t.Fatalf("not locked out at threshold")
+	}
+	if d := a.Locked("user:bob"); d != time.Second {
+		t.Fatalf("wrong lockout, exp 1s, got %s", d)
+	}
+	if d := a.Locked("user:alice", "ip:1.2.3.4"); d != time.Second {
+		t.Fatalf("address not locked out, got %s", d)
+	}
+	if d := a.Locked("user:alice", "ip:5.6.7.8"); d != 0 {
+		t.Fatalf("other client locked out, for %s", d)
+	}
+
+	// Each further failure doubles the lockout, up to the maximum.
+	for _, exp := range []time.Duration{2 * time.Second, 4 * time.Second, 5 * time.Second, 5 * time.Second} {
+		a.Fail("user:bob")
+		if d := a.Locked("user:bob"); d != exp {
+			t.Fatalf("wrong lockout, exp %s, got %s", exp, d)
+		}
+	}
+	now = now.Add(5 * time.Second)
+	if d := a.Locked("user:bob"); d != 0 {
+		t.Fatalf("lockout did not expire, %s remaining", d)
+	}
+
+	a.Succeed("user:bob")
+	if a.Fail("user:bob") {
+		t.Fatalf("failures not forgotten after success")
+	}
+
+	// Clients which have not failed for the maximum lockout are forgotten.
+	if exp, got := 2, a.Len(); exp != got {
+		t.Fatalf("wrong number of tracked clients, exp %d, got %d", exp, got)
+	}
+	now = now.Add(time.Hour)
+	a.Fail("user:alice")
+	if exp, got := 1, a.Len(); exp != got {
+		t.Fatalf("wrong number of tracked clients after sweep, exp %d, got %d", exp, got)
+	}
+}
+
+func Test_AuthLockout(t *testing.T) {
+	c := auth.NewCredentialsStore()
+	if err := c.Load(strings.NewReader(`[
+		{"username": "bob", "password": "secret", "perms": ["status"]},
+		{"username": "*", "perms": ["ready"]}
+	]`)); err != nil {
+		t.Fatalf("failed to load credentials: %s", err.Error())
+	}
+
+	m := &MockStore{}
+	n := &mockClusterService{}
+	s := New("127.0.0.1:0", m, n, c)
+	s.AuthFailureThreshold = 2
+	s.AuthLockout = time.Minute
+	s.AuthMaxLockout = time.Hour
+	if err := s.Start(); err != nil {
+		t.Fatalf("failed to start service")
+	}
+	defer s.Close()
+	host := fmt.Sprintf("http://%s", s.Addr().String())
+
+	client := &http.Client{}
+	get := func(path, username, password string) *http.Response {
+		req, err := http.NewRequest("GET", host+path, nil)
+		if err != nil {
+			t.Fatalf("failed to create request: %s", err.Error())
+		}
+		if username != "" {
+			req.SetBasicAuth(username, password)
+		}
+		resp, err := client.Do(req)
+		if err != nil {
+			t.Fatalf("failed to make request: %s", err.Error())
+		}
+		resp.Body.Close()
+		return resp
+	}
+
+	// Endpoints open to all users do not check credentials, but failures
+	// are counted all the same.
+	if resp := get("/readyz?noleader", "bob", "wrong"); resp.StatusCode != http.StatusOK {
+		t.Fatalf("wrong status code for /readyz, exp 200, got %d", resp.StatusCode)
+	}
+	if resp := get("/status", "bob", "wrong"); resp.StatusCode != http.StatusUnauthorized {
+		t.Fatalf("wrong status code for bad password, exp 401, got %d", resp.StatusCode)
+	}
+
+	// Locked out, even with the correct password.
+	resp := get("/status", "bob", "secret")
+	if resp.StatusCode != http.StatusTooManyRequests {
+		t.Fatalf("wrong status code when locked out, exp 429, got %d", resp.StatusCode)
+	}
+	if exp, got := "60", resp.Header.Get("Retry-After"); exp != got {
+		t.Fatalf("wrong Retry-After, exp %s, got %s", exp, got)
+	}
+	if resp := get("/status", "alice", "secret"); resp.StatusCode != http.StatusTooManyRequests {
+		t.Fatalf("wrong status code for other user from locked out address, exp 429, got %d", resp.StatusCode)
+	}
+
+	// Requests without credentials are not refused.
+	if resp := get("/readyz?noleader", "", ""); resp.StatusCode != http.StatusOK {
+		t.Fatalf("wrong status code for anonymous request, exp 200, got %d", resp.StatusCode)
+	}
+
+	if got := stats.Get(numAuthLockouts).(*expvar.Int).Value(); got < 1 {
+		t.Fatalf("lockout not counted, got %d", got)
+	}
+}
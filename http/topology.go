@@ -0,0 +1,193 @@
+package http
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/rqlite/rqlite/auth"
+	"github.com/rqlite/rqlite/cluster"
+	"github.com/rqlite/rqlite/store"
+)
+
+const (
+	roleLeader   = "leader"
+	roleVoter    = "voter"
+	roleNonVoter = "non-voter"
+)
+
+// Topology is the topology of the cluster, as nodes and the links between
+// them, for rendering as a graph.
+type Topology struct {
+	Leader string          `json:"leader,omitempty"`
+	Nodes  []*TopologyNode `json:"nodes"`
+	Links  []*TopologyLink `json:"links"`
+}
+
+// TopologyNode is a single node of the cluster. Lag is the number of log
+// entries the node has yet to apply, relative to the Leader.
+type TopologyNode struct {
+	ID            string `json:"id"`
+	Addr          string `json:"addr"`
+	Role          string `json:"role"`
+	Reachable     bool   `json:"reachable"`
+	Error         string `json:"error,omitempty"`
+	APIAddr       string `json:"api_addr,omitempty"`
+	Locality      string `json:"locality,omitempty"`
+	Version       string `json:"version,omitempty"`
+	SQLiteVersion string `json:"sqlite_version,omitempty"`
+	AppliedIndex  uint64 `json:"applied_index,omitempty"`
+	Lag           *int64 `json:"lag,omitempty"`
+}
+
+// TopologyLink is the round-trip time, in seconds, from one node to another,
+// and the bandwidth available between them, in bytes per second, as last
+// measured by the first node. Bandwidth is only measured if enabled.
+type TopologyLink struct {
+	From      string  `json:"from"`
+	To        string  `json:"to"`
+	Latency   float64 `json:"latency"`
+	Bandwidth int64   `json:"bandwidth,omitempty"`
+}
+
+// handleTopology returns the topology of the cluster. Every node is contacted
+// for its details, so this may take some time to return.
+func (s *Service) handleTopology(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+
+	if !s.CheckRequestPerm(r, auth.PermStatus) {
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+
+	if r.Method != "GET" {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	timeout, err := timeoutParam(r, defaultTimeout)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	nodes, err := s.store.Nodes()
+	if err != nil {
+		statusCode := http.StatusInternalServerError
+		if err == store.ErrNotOpen {
+			statusCode = http.StatusServiceUnavailable
+		}
+		http.Error(w, fmt.Sprintf("store nodes: %s", err.Error()), statusCode)
+		return
+	}
+	lAddr, err := s.store.LeaderAddr()
+	if err != nil {
+		http.Error(w, fmt.Sprintf("leader address: %s", err.Error()),
+			http.StatusInternalServerError)
+		return
+	}
+
+	topo := s.topology(nodes, lAddr, timeout)
+	pretty, _ := isPretty(r)
+	var b []byte
+	if pretty {
+		b, err = json.MarshalIndent(topo, "", "    ")
+	} else {
+		b, err = json.Marshal(topo)
+	}
+	if err != nil {
+		http.Error(w, fmt.Sprintf("JSON marshal: %s", err.Error()),
+			http.StatusInternalServerError)
+		return
+	}
+	_, err = w.Write(b)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("write: %s", err.Error()),
+			http.StatusInternalServerError)
+		return
+	}
+}
+
+// topology contacts each of the nodes, concurrently, and returns the topology
+// they form.
+func (s *Service) topology(nodes []*store.Server, leaderAddr string, timeout time.Duration) *Topology {
+	infos := make([]*cluster.NodeInfo, len(nodes))
+	errs := make([]error, len(nodes))
+	var wg sync.WaitGroup
+	for i := range nodes {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			infos[i], errs[i] = s.cluster.GetNodeInfo(nodes[i].Addr, timeout)
+		}(i)
+	}
+	wg.Wait()
+
+	topo := &Topology{
+		Nodes: make([]*TopologyNode, len(nodes)),
+		Links: make([]*TopologyLink, 0),
+	}
+	ids := make(map[string]string, len(nodes)) // Raft address to node ID.
+	var leaderIdx uint64
+	for i, n := range nodes {
+		ids[n.Addr] = n.ID
+		tn := &TopologyNode{
+			ID:   n.ID,
+			Addr: n.Addr,
+			Role: roleVoter,
+		}
+		if n.Suffrage != "Voter" {
+			tn.Role = roleNonVoter
+		}
+		if n.Addr == leaderAddr {
+			tn.Role = roleLeader
+			topo.Leader = n.ID
+		}
+		if errs[i] != nil {
+			tn.Error = errs[i].Error()
+		} else {
+			tn.Reachable = true
+			tn.APIAddr = infos[i].ApiUrl
+			tn.Locality = infos[i].Locality
+			tn.Version = infos[i].Version
+			tn.SQLiteVersion = infos[i].SqliteVersion
+			tn.AppliedIndex = infos[i].AppliedIndex
+			if tn.Role == roleLeader {
+				leaderIdx = tn.AppliedIndex
+			}
+		}
+		topo.Nodes[i] = tn
+	}
+
+	for i, tn := range topo.Nodes {
+		if !tn.Reachable {
+			continue
+		}
+		if leaderIdx > 0 {
+			lag := int64(leaderIdx) - int64(tn.AppliedIndex)
+			tn.Lag = &lag
+		}
+		for _, l := range infos[i].Latencies {
+			if to, ok := ids[l.Addr]; ok {
+				topo.Links = append(topo.Links, &TopologyLink{
+					From:      tn.ID,
+					To:        to,
+					Latency:   time.Duration(l.Rtt).Seconds(),
+					Bandwidth: l.Bandwidth,
+				})
+			}
+		}
+	}
+
+	sort.Slice(topo.Nodes, func(i, j int) bool { return topo.Nodes[i].ID < topo.Nodes[j].ID })
+	sort.Slice(topo.Links, func(i, j int) bool {
+		if topo.Links[i].From != topo.Links[j].From {
+			return topo.Links[i].From < topo.Links[j].From
+		}
+		return topo.Links[i].To < topo.Links[j].To
+	})
+	return topo
+}
@@ -0,0 +1,96 @@
+package http
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/rqlite/rqlite/cluster"
+	"github.com/rqlite/rqlite/store"
+)
+
+func Test_Topology(t *testing.T) {
+	c := &mockClusterService{}
+	c.nodeInfoFn = func(addr string, timeout time.Duration) (*cluster.NodeInfo, error) {
+		switch addr {
+		case "node1:4002":
+			return &cluster.NodeInfo{
+				ApiUrl:        "http://node1:4001",
+				Version:       "v7.0.0",
+				SqliteVersion: "3.42.0",
+				Locality:      "us-east-1a",
+				AppliedIndex:  100,
+				Latencies: []*cluster.NodeLatency{
+					{Addr: "node3:4002", Rtt: int64(2 * time.Millisecond)},
+					{Addr: "node2:4002", Rtt: int64(time.Millisecond), Bandwidth: 125000000},
+					{Addr: "gone:4002", Rtt: int64(time.Millisecond)},
+				},
+			}, nil
+		case "node2:4002":
+			return &cluster.NodeInfo{
+				ApiUrl:       "http://node2:4001",
+				Locality:     "us-east-1b",
+				AppliedIndex: 97,
+			}, nil
+		}
+		return nil, errors.New("connection refused")
+	}
+	s := New("127.0.0.1:0", &MockStore{}, c, nil)
+
+	topo := s.topology([]*store.Server{
+		{ID: "node3", Addr: "node3:4002", Suffrage: "Nonvoter"},
+		{ID: "node2", Addr: "node2:4002", Suffrage: "Voter"},
+		{ID: "node1", Addr: "node1:4002", Suffrage: "Voter"},
+	}, "node1:4002", time.Second)
+
+	b, err := json.Marshal(topo)
+	if err != nil {
+		t.Fatalf("failed to marshal topology: %s", err.Error())
+	}
+	exp := `{"leader":"node1","nodes":[` +
+		`{"id":"node1","addr":"node1:4002","role":"leader","reachable":true,"api_addr":"http://node1:4001","locality":"us-east-1a","version":"v7.0.0","sqlite_version":"3.42.0","applied_index":100,"lag":0},` +
+		`{"id":"node2","addr":"node2:4002","role":"voter","reachable":true,"api_addr":"http://node2:4001","locality":"us-east-1b","applied_index":97,"lag":3},` +
+		`{"id":"node3","addr":"node3:4002","role":"non-voter","reachable":false,"error":"connection refused"}],` +
+		`"links":[{"from":"node1","to":"node2","latency":0.001,"bandwidth":125000000},{"from":"node1","to":"node3","latency":0.002}]}`
+	if got := string(b); exp != got {
+		t.Fatalf("wrong topology\nexp: %s\ngot: %s", exp, got)
+	}
+}
+
+func Test_TopologyEndpoint(t *testing.T) {
+	s := New("127.0.0.1:0", &MockStore{}, &mockClusterService{}, nil)
+	if err := s.Start(); err != nil {
+		t.Fatalf("failed to start service")
+	}
+	defer s.Close()
+	host := fmt.Sprintf("http://%s", s.Addr().String())
+
+	resp, err := http.Get(host + "/cluster/topology")
+	if err != nil {
+		t.Fatalf("failed to make topology request: %s", err.Error())
+	}
+	body, err := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		t.Fatalf("failed to read response body: %s", err.Error())
+	}
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("wrong status code, exp 200, got %d", resp.StatusCode)
+	}
+	if exp, got := `{"nodes":[],"links":[]}`, string(body); exp != got {
+		t.Fatalf("wrong topology, exp %s, got %s", exp, got)
+	}
+
+	resp, err = http.Post(host+"/cluster/topology", "", nil)
+	if err != nil {
+		t.Fatalf("failed to make topology request: %s", err.Error())
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusMethodNotAllowed {
+		t.Fatalf("wrong status code, exp 405, got %d", resp.StatusCode)
+	}
+}
@@ -0,0 +1,58 @@
+package http
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/rqlite/rqlite/auth"
+)
+
+// trigger is the JSON representation of a trigger installed in the database.
+type trigger struct {
+	Name          string   `json:"name"`
+	Table         string   `json:"table"`
+	SQL           string   `json:"sql"`
+	Deterministic bool     `json:"deterministic"`
+	Reasons       []string `json:"reasons,omitempty"`
+}
+
+// handleTriggers handles requests to list the triggers installed in the
+// database, with an assessment of whether the effects of each are the same
+// on every node. The triggers are read from the database of this node.
+func (s *Service) handleTriggers(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+
+	if !s.CheckRequestPerm(r, auth.PermQuery) {
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+	if r.Method != "GET" {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	ts, err := s.store.Triggers()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	triggers := make([]*trigger, 0, len(ts))
+	for _, t := range ts {
+		triggers = append(triggers, &trigger{
+			Name:          t.Name,
+			Table:         t.Table,
+			SQL:           t.SQL,
+			Deterministic: len(t.Reasons) == 0,
+			Reasons:       t.Reasons,
+		})
+	}
+
+	b, err := json.Marshal(map[string]interface{}{"triggers": triggers})
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if _, err := w.Write(b); err != nil {
+		s.logger.Println("writing response failed:", err.Error())
+	}
+}
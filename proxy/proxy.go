@@ -0,0 +1,397 @@
+// Package proxy provides an HTTP proxy which fronts several rqlite clusters,
+// so that many small clusters may be reached through a single endpoint.
+//
+// Each cluster is reached under a prefix of its name, so a request to
+// /tenant1/db/query is served by the /db/query endpoint of cluster tenant1.
+// GET /status returns the status of every cluster.
+package proxy
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"expvar"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// maxRedirects is the number of redirects, from followers to the Leader,
+	// followed for a single request.
+	maxRedirects = 3
+
+	defaultTimeout = 30 * time.Second
+)
+
+const (
+	numRequests       = "num_requests"
+	numUnknownCluster = "num_unknown_cluster"
+	numFailovers      = "num_failovers"
+	numRedirects      = "num_redirects"
+	numUnavailable    = "num_unavailable"
+	numStatus         = "num_status"
+)
+
+var (
+	// ErrClusterName is returned when a cluster name may not be used as a
+	// URL prefix.
+	ErrClusterName = errors.New("invalid cluster name")
+
+	// ErrNoAddresses is returned when a cluster has no node addresses.
+	ErrNoAddresses = errors.New("cluster has no node addresses")
+
+	// ErrDuplicateCluster is returned when two clusters share a name.
+	ErrDuplicateCluster = errors.New("duplicate cluster name")
+)
+
+// stats captures stats for the proxy.
+var stats *expvar.Map
+
+func init() {
+	stats = expvar.NewMap("proxy")
+	ResetStats()
+}
+
+// ResetStats resets the expvar stats for this module. Mostly for test purposes.
+func ResetStats() {
+	stats.Init()
+	stats.Add(numRequests, 0)
+	stats.Add(numUnknownCluster, 0)
+	stats.Add(numFailovers, 0)
+	stats.Add(numRedirects, 0)
+	stats.Add(numUnavailable, 0)
+	stats.Add(numStatus, 0)
+}
+
+// clusterName matches the names permitted for clusters.
+var clusterName = regexp.MustCompile(`^[A-Za-z0-9_-]+$`)
+
+// hopHeaders are the headers which apply to a single connection, and so are
+// not passed on by the proxy.
+var hopHeaders = []string{
+	"Connection",
+	"Keep-Alive",
+	"Proxy-Authenticate",
+	"Proxy-Authorization",
+	"Te",
+	"Trailer",
+	"Transfer-Encoding",
+	"Upgrade",
+}
+
+// Cluster is an rqlite cluster fronted by the proxy.
+type Cluster struct {
+	// Name is the prefix under which the cluster is reached.
+	Name string
+
+	// Addrs are the HTTP API URLs of the nodes of the cluster, such as
+	// http://localhost:4001.
+	Addrs []string
+
+	mu   sync.Mutex
+	next int // index of the node which last served a request
+}
+
+// ParseCluster parses a cluster of the form name=addr[,addr...], where each
+// address is a URL or host:port of the HTTP API of a node. Addresses without
+// a scheme are reached over HTTP.
+func ParseCluster(s string) (*Cluster, error) {
+	i := strings.Index(s, "=")
+	if i < 0 {
+		return nil, fmt.Errorf("cluster %q is not of the form name=addr[,addr...]", s)
+	}
+	c := &Cluster{Name: strings.TrimSpace(s[:i])}
+	for _, a := range strings.Split(s[i+1:], ",") {
+		a = strings.TrimSpace(a)
+		if a == "" {
+			continue
+		}
+		if !strings.Contains(a, "://") {
+			a = "http://" + a
+		}
+		u, err := url.Parse(a)
+		if err != nil {
+			return nil, fmt.Errorf("cluster %s: %s", c.Name, err.Error())
+		}
+		if (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return nil, fmt.Errorf("cluster %s: invalid node address %q", c.Name, a)
+		}
+		c.Addrs = append(c.Addrs, strings.TrimSuffix(a, "/"))
+	}
+	return c, c.validate()
+}
+
+func (c *Cluster) validate() error {
+	if !clusterName.MatchString(c.Name) {
+		return fmt.Errorf("%w: %q", ErrClusterName, c.Name)
+	}
+	if len(c.Addrs) == 0 {
+		return fmt.Errorf("%w: %s", ErrNoAddresses, c.Name)
+	}
+	return nil
+}
+
+// addrs returns the addresses of the nodes of the cluster, starting with the
+// node which last served a request.
+func (c *Cluster) addrs() []string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	addrs := make([]string, 0, len(c.Addrs))
+	for i := range c.Addrs {
+		addrs = append(addrs, c.Addrs[(c.next+i)%len(c.Addrs)])
+	}
+	return addrs
+}
+
+// served records that the node at addr served a request.
+func (c *Cluster) served(addr string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for i, a := range c.Addrs {
+		if a == addr {
+			c.next = i
+			return
+		}
+	}
+}
+
+// Proxy routes HTTP requests to the clusters it fronts, by the first element
+// of the request path.
+type Proxy struct {
+	clusters map[string]*Cluster
+
+	client *http.Client
+	logger *log.Logger
+}
+
+// New returns a proxy fronting the given clusters. If client is nil, clusters
+// are reached using a default client.
+func New(clusters []*Cluster, client *http.Client) (*Proxy, error) {
+	p := &Proxy{
+		clusters: make(map[string]*Cluster, len(clusters)),
+		logger:   log.New(os.Stderr, "[proxy] ", log.LstdFlags),
+	}
+	for _, c := range clusters {
+		if err := c.validate(); err != nil {
+			return nil, err
+		}
+		if _, ok := p.clusters[c.Name]; ok {
+			return nil, fmt.Errorf("%w: %s", ErrDuplicateCluster, c.Name)
+		}
+		p.clusters[c.Name] = c
+	}
+
+	if client == nil {
+		client = &http.Client{Timeout: defaultTimeout}
+	}
+	// Redirects to the Leader are followed by the proxy itself, as the
+	// client would otherwise resend a POST as a GET.
+	cl := *client
+	cl.CheckRedirect = func(req *http.Request, via []*http.Request) error {
+		return http.ErrUseLastResponse
+	}
+	p.client = &cl
+	return p, nil
+}
+
+// ServeHTTP routes the request to the cluster named by the first element of
+// its path, or serves the status of every cluster.
+func (p *Proxy) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path == "/status" {
+		p.handleStatus(w, r)
+		return
+	}
+
+	stats.Add(numRequests, 1)
+	path := strings.TrimPrefix(r.URL.Path, "/")
+	name, rest := path, "/"
+	if i := strings.Index(path, "/"); i >= 0 {
+		name, rest = path[:i], path[i:]
+	}
+	c, ok := p.clusters[name]
+	if !ok {
+		stats.Add(numUnknownCluster, 1)
+		http.Error(w, fmt.Sprintf("no such cluster: %s", name), http.StatusNotFound)
+		return
+	}
+	p.forward(w, r, c, rest)
+}
+
+// forward sends the request to a node of the cluster, trying each node in
+// turn until one responds, and following any redirect to the Leader.
+func (p *Proxy) forward(w http.ResponseWriter, r *http.Request, c *Cluster, path string) {
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	r.Body.Close()
+
+	var lastErr error
+	for i, addr := range c.addrs() {
+		if i > 0 {
+			stats.Add(numFailovers, 1)
+		}
+		u := addr + path
+		if r.URL.RawQuery != "" {
+			u += "?" + r.URL.RawQuery
+		}
+		resp, err := p.do(r, u, body)
+		if err != nil {
+			lastErr = err
+			continue
+		}
+		defer resp.Body.Close()
+		c.served(addr)
+
+		copyHeader(w.Header(), resp.Header)
+		w.WriteHeader(resp.StatusCode)
+		io.Copy(w, resp.Body)
+		return
+	}
+	stats.Add(numUnavailable, 1)
+	p.logger.Printf("cluster %s unavailable: %s", c.Name, lastErr.Error())
+	http.Error(w, fmt.Sprintf("cluster %s unavailable: %s", c.Name, lastErr.Error()), http.StatusBadGateway)
+}
+
+// do sends a copy of the request r, with the given body, to the URL u,
+// following redirects.
+func (p *Proxy) do(r *http.Request, u string, body []byte) (*http.Response, error) {
+	for n := 0; ; n++ {
+		req, err := http.NewRequest(r.Method, u, bytes.NewReader(body))
+		if err != nil {
+			return nil, err
+		}
+		copyHeader(req.Header, r.Header)
+		if host := r.RemoteAddr; host != "" {
+			if i := strings.LastIndex(host, ":"); i >= 0 {
+				host = host[:i]
+			}
+			if prior := r.Header.Get("X-Forwarded-For"); prior != "" {
+				host = prior + ", " + host
+			}
+			req.Header.Set("X-Forwarded-For", host)
+		}
+
+		resp, err := p.client.Do(req)
+		if err != nil {
+			return nil, err
+		}
+		loc := resp.Header.Get("Location")
+		if !isRedirect(resp.StatusCode) || loc == "" || n == maxRedirects {
+			return resp, nil
+		}
+		resp.Body.Close()
+		next, err := req.URL.Parse(loc)
+		if err != nil {
+			return nil, err
+		}
+		stats.Add(numRedirects, 1)
+		u = next.String()
+	}
+}
+
+// clusterStatus is the status of a cluster, as returned by one of its nodes.
+type clusterStatus struct {
+	Addr   string          `json:"addr,omitempty"`
+	Status json.RawMessage `json:"status,omitempty"`
+	Error  string          `json:"error,omitempty"`
+}
+
+// handleStatus serves the status of every cluster, each as returned by the
+// first of its nodes to respond.
+func (p *Proxy) handleStatus(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "GET" {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	stats.Add(numStatus, 1)
+
+	statuses := make(map[string]*clusterStatus, len(p.clusters))
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	for _, c := range p.clusters {
+		wg.Add(1)
+		go func(c *Cluster) {
+			defer wg.Done()
+			cs := p.status(r, c)
+			mu.Lock()
+			statuses[c.Name] = cs
+			mu.Unlock()
+		}(c)
+	}
+	wg.Wait()
+
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	b, err := json.Marshal(map[string]interface{}{
+		"clusters": statuses,
+	})
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Write(b)
+}
+
+// status returns the status of the cluster, as returned by the first of its
+// nodes to respond.
+func (p *Proxy) status(r *http.Request, c *Cluster) *clusterStatus {
+	var lastErr error
+	for _, addr := range c.addrs() {
+		u := addr + "/status"
+		if r.URL.RawQuery != "" {
+			u += "?" + r.URL.RawQuery
+		}
+		resp, err := p.do(r, u, nil)
+		if err != nil {
+			lastErr = err
+			continue
+		}
+		b, err := ioutil.ReadAll(resp.Body)
+		resp.Body.Close()
+		if err != nil {
+			lastErr = err
+			continue
+		}
+		if resp.StatusCode != http.StatusOK {
+			lastErr = fmt.Errorf("%s: %s", addr, resp.Status)
+			continue
+		}
+		if !json.Valid(b) {
+			lastErr = fmt.Errorf("%s: invalid status response", addr)
+			continue
+		}
+		return &clusterStatus{Addr: addr, Status: b}
+	}
+	return &clusterStatus{Error: lastErr.Error()}
+}
+
+func isRedirect(code int) bool {
+	switch code {
+	case http.StatusMovedPermanently, http.StatusFound, http.StatusTemporaryRedirect, http.StatusPermanentRedirect:
+		return true
+	}
+	return false
+}
+
+// copyHeader copies the headers in src to dst, but for those which apply to
+// a single connection.
+func copyHeader(dst, src http.Header) {
+	for k, vv := range src {
+		for _, v := range vv {
+			dst.Add(k, v)
+		}
+	}
+	for _, h := range hopHeaders {
+		dst.Del(h)
+	}
+}
@@ -0,0 +1,174 @@
+package proxy
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func Test_ParseCluster(t *testing.T) {
+	c, err := ParseCluster("tenant1=localhost:4001, https://10.0.0.2:4001/,")
+	if err != nil {
+		t.Fatalf("failed to parse cluster: %s", err.Error())
+	}
+	if c.Name != "tenant1" {
+		t.Fatalf("wrong cluster name: %s", c.Name)
+	}
+	if exp, got := "http://localhost:4001,https://10.0.0.2:4001", strings.Join(c.Addrs, ","); exp != got {
+		t.Fatalf("wrong addresses, exp %s, got %s", exp, got)
+	}
+
+	for s, exp := range map[string]error{
+		"tenant/1=localhost:4001": ErrClusterName,
+		"=localhost:4001":         ErrClusterName,
+		"status=":                 ErrNoAddresses,
+	} {
+		if _, err := ParseCluster(s); !errors.Is(err, exp) {
+			t.Fatalf("wrong error parsing %s, exp %v, got %v", s, exp, err)
+		}
+	}
+	for _, s := range []string{"tenant1", "tenant1=ftp://localhost:4001"} {
+		if _, err := ParseCluster(s); err == nil {
+			t.Fatalf("invalid cluster %s parsed", s)
+		}
+	}
+
+	if _, err := New([]*Cluster{
+		{Name: "a", Addrs: []string{"http://localhost:4001"}},
+		{Name: "a", Addrs: []string{"http://localhost:4003"}},
+	}, nil); !errors.Is(err, ErrDuplicateCluster) {
+		t.Fatalf("wrong error for duplicate clusters: %v", err)
+	}
+}
+
+func Test_ProxyRouting(t *testing.T) {
+	ResetStats()
+
+	// The Leader echoes each request, and the follower redirects to it.
+	leader := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/status" {
+			fmt.Fprintf(w, `{"store":{"leader":true}}`)
+			return
+		}
+		b, _ := ioutil.ReadAll(r.Body)
+		user, _, _ := r.BasicAuth()
+		w.Header().Set("X-Test", "leader")
+		fmt.Fprintf(w, "%s %s?%s %s %s", r.Method, r.URL.Path, r.URL.RawQuery, user, b)
+	}))
+	defer leader.Close()
+	follower := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, leader.URL+r.URL.RequestURI(), http.StatusMovedPermanently)
+	}))
+	defer follower.Close()
+	down := mustClosedAddr(t)
+
+	p, err := New([]*Cluster{
+		{Name: "tenant1", Addrs: []string{down, follower.URL}},
+		{Name: "tenant2", Addrs: []string{leader.URL}},
+		{Name: "tenant3", Addrs: []string{down}},
+	}, nil)
+	if err != nil {
+		t.Fatalf("failed to create proxy: %s", err.Error())
+	}
+	srv := httptest.NewServer(p)
+	defer srv.Close()
+
+	req, err := http.NewRequest("POST", srv.URL+"/tenant1/db/execute?timings", strings.NewReader(`["INSERT INTO foo VALUES(1)"]`))
+	if err != nil {
+		t.Fatalf("failed to create request: %s", err.Error())
+	}
+	req.SetBasicAuth("fiona", "secret")
+	resp, body := mustDo(t, req)
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("wrong status code, exp 200, got %d", resp.StatusCode)
+	}
+	if exp, got := `POST /db/execute?timings fiona ["INSERT INTO foo VALUES(1)"]`, body; exp != got {
+		t.Fatalf("wrong body\nexp: %s\ngot: %s", exp, got)
+	}
+	if resp.Header.Get("X-Test") != "leader" {
+		t.Fatalf("response headers not passed on")
+	}
+	if stats.Get(numFailovers).String() != "1" || stats.Get(numRedirects).String() != "1" {
+		t.Fatalf("wrong stats: %s", stats.String())
+	}
+
+	// The node which served the last request is tried first.
+	mustDo(t, mustNewRequest(t, "GET", srv.URL+"/tenant1/db/query?q=SELECT%201"))
+	if stats.Get(numFailovers).String() != "1" {
+		t.Fatalf("failed node retried: %s", stats.String())
+	}
+
+	resp, _ = mustDo(t, mustNewRequest(t, "GET", srv.URL+"/tenant4/db/query"))
+	if resp.StatusCode != http.StatusNotFound {
+		t.Fatalf("wrong status code for unknown cluster, exp 404, got %d", resp.StatusCode)
+	}
+	resp, _ = mustDo(t, mustNewRequest(t, "GET", srv.URL+"/tenant3/db/query"))
+	if resp.StatusCode != http.StatusBadGateway {
+		t.Fatalf("wrong status code for unavailable cluster, exp 502, got %d", resp.StatusCode)
+	}
+
+	resp, body = mustDo(t, mustNewRequest(t, "GET", srv.URL+"/status"))
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("wrong status code for status, exp 200, got %d", resp.StatusCode)
+	}
+	var status struct {
+		Clusters map[string]struct {
+			Addr   string
+			Status map[string]interface{}
+			Error  string
+		}
+	}
+	if err := json.Unmarshal([]byte(body), &status); err != nil {
+		t.Fatalf("failed to decode status %s: %s", body, err.Error())
+	}
+	if len(status.Clusters) != 3 {
+		t.Fatalf("wrong number of clusters in status: %s", body)
+	}
+	if c := status.Clusters["tenant1"]; c.Addr != follower.URL || c.Status["store"] == nil {
+		t.Fatalf("wrong status for tenant1: %s", body)
+	}
+	if c := status.Clusters["tenant2"]; c.Addr != leader.URL || c.Status["store"] == nil {
+		t.Fatalf("wrong status for tenant2: %s", body)
+	}
+	if c := status.Clusters["tenant3"]; c.Error == "" || c.Status != nil {
+		t.Fatalf("wrong status for tenant3: %s", body)
+	}
+}
+
+// mustClosedAddr returns the URL of an address on which nothing listens.
+func mustClosedAddr(t *testing.T) string {
+	ln, err := net.Listen("tcp", "localhost:0")
+	if err != nil {
+		t.Fatalf("failed to listen: %s", err.Error())
+	}
+	addr := ln.Addr().String()
+	ln.Close()
+	return "http://" + addr
+}
+
+func mustNewRequest(t *testing.T, method, u string) *http.Request {
+	req, err := http.NewRequest(method, u, nil)
+	if err != nil {
+		t.Fatalf("failed to create request: %s", err.Error())
+	}
+	return req
+}
+
+func mustDo(t *testing.T, req *http.Request) (*http.Response, string) {
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("request failed: %s", err.Error())
+	}
+	defer resp.Body.Close()
+	b, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatalf("failed to read response: %s", err.Error())
+	}
+	return resp, string(b)
+}
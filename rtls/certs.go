@@ -6,6 +6,8 @@ import (
 	"crypto/x509"
 	"crypto/x509/pkix"
 	"encoding/pem"
+	"errors"
+	"fmt"
 	"math/big"
 	"net"
 	"time"
@@ -193,3 +195,82 @@ func GenerateSelfSignedCertIPSAN(subject pkix.Name, validFor time.Duration, keyS
 
 	return certPEM, keyPEM, nil
 }
+
+// GenerateCertWithSANs generates a new x509 certificate, signed by the given parent certificate
+// and key, and returns the cert and key as PEM-encoded bytes. The certificate is valid for the
+// given DNS names and IP addresses, and for the given extended key usages. Each certificate is
+// assigned a random serial number, so that certificates issued by the same parent are distinct.
+func GenerateCertWithSANs(subject pkix.Name, validFor time.Duration, keySize int, parent *x509.Certificate,
+	parentKey interface{}, dnsNames []string, ips []net.IP, usage []x509.ExtKeyUsage) ([]byte, []byte, error) {
+	// generate a new private key
+	key, err := rsa.GenerateKey(rand.Reader, keySize)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	serial, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+	if err != nil {
+		return nil, nil, err
+	}
+
+	// generate a new certificate
+	template := x509.Certificate{
+		SerialNumber: serial,
+		Subject:      subject,
+		NotBefore:    time.Now(),
+		NotAfter:     time.Now().Add(validFor),
+		KeyUsage:     x509.KeyUsageKeyEncipherment | x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  usage,
+		DNSNames:     dnsNames,
+		IPAddresses:  ips,
+	}
+
+	cert, err := x509.CreateCertificate(rand.Reader, &template, parent, &key.PublicKey, parentKey)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	// encode the certificate and private key
+	certPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: cert})
+	keyPEM := pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(key)})
+
+	return certPEM, keyPEM, nil
+}
+
+// ParseCertAndKey parses a PEM-encoded certificate and PEM-encoded RSA private key,
+// such as those returned by GenerateCACert.
+func ParseCertAndKey(certPEM, keyPEM []byte) (*x509.Certificate, *rsa.PrivateKey, error) {
+	certBlock, _ := pem.Decode(certPEM)
+	if certBlock == nil || certBlock.Type != "CERTIFICATE" {
+		return nil, nil, errors.New("failed to decode PEM certificate")
+	}
+	cert, err := x509.ParseCertificate(certBlock.Bytes)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	keyBlock, _ := pem.Decode(keyPEM)
+	if keyBlock == nil {
+		return nil, nil, errors.New("failed to decode PEM private key")
+	}
+	switch keyBlock.Type {
+	case "RSA PRIVATE KEY":
+		key, err := x509.ParsePKCS1PrivateKey(keyBlock.Bytes)
+		if err != nil {
+			return nil, nil, err
+		}
+		return cert, key, nil
+	case "PRIVATE KEY":
+		k, err := x509.ParsePKCS8PrivateKey(keyBlock.Bytes)
+		if err != nil {
+			return nil, nil, err
+		}
+		key, ok := k.(*rsa.PrivateKey)
+		if !ok {
+			return nil, nil, errors.New("private key is not an RSA key")
+		}
+		return cert, key, nil
+	default:
+		return nil, nil, fmt.Errorf("unsupported PEM private key type %s", keyBlock.Type)
+	}
+}
@@ -216,6 +216,70 @@ func Test_GenerateSelfSignedCert(t *testing.T) {
 }
 
 // mustGenerateCACert generates a new CA certificate and private key.
+func Test_GenerateCertWithSANs(t *testing.T) {
+	caCertPEM, caKeyPEM, err := GenerateCACert(pkix.Name{CommonName: "ca.rqlite"}, time.Hour, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	caCert, caKey, err := ParseCertAndKey(caCertPEM, caKeyPEM)
+	if err != nil {
+		t.Fatalf("failed to parse CA cert and key: %s", err.Error())
+	}
+
+	usage := []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth}
+	certPEM, keyPEM, err := GenerateCertWithSANs(pkix.Name{CommonName: "node1"}, time.Hour, 2048, caCert, caKey,
+		[]string{"node1.rqlite", "localhost"}, []net.IP{net.ParseIP("10.0.0.1")}, usage)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, _, err := ParseCertAndKey(certPEM, keyPEM)
+	if err != nil {
+		t.Fatalf("failed to parse cert and key: %s", err.Error())
+	}
+
+	roots := x509.NewCertPool()
+	roots.AddCert(caCert)
+	for _, name := range []string{"node1.rqlite", "localhost", "10.0.0.1"} {
+		if _, err := cert.Verify(x509.VerifyOptions{DNSName: name, Roots: roots}); err != nil {
+			t.Fatalf("failed to verify certificate for %s: %s", name, err.Error())
+		}
+	}
+	if _, err := cert.Verify(x509.VerifyOptions{DNSName: "node2.rqlite", Roots: roots}); err == nil {
+		t.Fatal("certificate verified for name not in SANs")
+	}
+	if _, err := cert.Verify(x509.VerifyOptions{Roots: roots,
+		KeyUsages: []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth}}); err == nil {
+		t.Fatal("server certificate verified for client authentication")
+	}
+
+	// certificates issued by the same CA must have distinct serial numbers
+	certPEM2, keyPEM2, err := GenerateCertWithSANs(pkix.Name{CommonName: "node1"}, time.Hour, 2048, caCert, caKey,
+		nil, nil, usage)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert2, _, err := ParseCertAndKey(certPEM2, keyPEM2)
+	if err != nil {
+		t.Fatalf("failed to parse cert and key: %s", err.Error())
+	}
+	if cert.SerialNumber.Cmp(cert2.SerialNumber) == 0 {
+		t.Fatal("certificates have the same serial number")
+	}
+}
+
+func Test_ParseCertAndKeyInvalid(t *testing.T) {
+	certPEM, keyPEM, err := GenerateCACert(pkix.Name{CommonName: "ca.rqlite"}, time.Hour, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := ParseCertAndKey(keyPEM, keyPEM); err == nil {
+		t.Fatal("parsed key as certificate")
+	}
+	if _, _, err := ParseCertAndKey(certPEM, []byte("not a key")); err == nil {
+		t.Fatal("parsed invalid key")
+	}
+}
+
 func mustGenerateCACert(name pkix.Name) (*x509.Certificate, *rsa.PrivateKey) {
 	certPEM, keyPEM, err := GenerateCACert(name, time.Hour, 2048)
 	if err != nil {
@@ -0,0 +1,212 @@
+package rtls
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+)
+
+// Rotator holds the certificate a node presents to other nodes, and the CA
+// certificates it trusts. Either may be changed while connections are being
+// made, allowing the CA used for node-to-node encryption to be rotated without
+// restarting the node.
+type Rotator struct {
+	mu         sync.RWMutex
+	cert       *tls.Certificate
+	configured []*x509.Certificate
+	cas        []*x509.Certificate
+	pool       *x509.CertPool // Nil means the system CAs are trusted.
+}
+
+// NewRotator returns a Rotator which presents the certificate and key in
+// certFile and keyFile, and trusts the CA certificates in caCertFile. If
+// caCertFile is empty the CAs of the system are trusted.
+func NewRotator(certFile, keyFile, caCertFile string) (*Rotator, error) {
+	r := &Rotator{}
+	if certFile != "" && keyFile != "" {
+		certPEM, err := os.ReadFile(certFile)
+		if err != nil {
+			return nil, err
+		}
+		keyPEM, err := os.ReadFile(keyFile)
+		if err != nil {
+			return nil, err
+		}
+		if err := r.SetCertificate(certPEM, keyPEM); err != nil {
+			return nil, err
+		}
+	}
+	if caCertFile != "" {
+		b, err := os.ReadFile(caCertFile)
+		if err != nil {
+			return nil, err
+		}
+		r.configured, err = ParseCerts(b)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load CA certificate(s) in %q: %s", caCertFile, err)
+		}
+	}
+	r.SetCAs(nil)
+	return r, nil
+}
+
+// ParseCerts parses all the PEM-encoded certificates in b.
+func ParseCerts(b []byte) ([]*x509.Certificate, error) {
+	var certs []*x509.Certificate
+	for {
+		var block *pem.Block
+		block, b = pem.Decode(b)
+		if block == nil {
+			break
+		}
+		if block.Type != "CERTIFICATE" {
+			continue
+		}
+		cert, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			return nil, err
+		}
+		certs = append(certs, cert)
+	}
+	if len(certs) == 0 {
+		return nil, errors.New("no PEM certificates found")
+	}
+	return certs, nil
+}
+
+// SetCertificate sets the PEM-encoded certificate and key presented by the node.
+func (r *Rotator) SetCertificate(certPEM, keyPEM []byte) error {
+	cert, err := tls.X509KeyPair(certPEM, keyPEM)
+	if err != nil {
+		return err
+	}
+	cert.Leaf, err = x509.ParseCertificate(cert.Certificate[0])
+	if err != nil {
+		return err
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.cert = &cert
+	return nil
+}
+
+// Certificate returns the certificate presented by the node, or nil if the
+// node presents no certificate.
+func (r *Rotator) Certificate() *x509.Certificate {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	if r.cert == nil {
+		return nil
+	}
+	return r.cert.Leaf
+}
+
+// ConfiguredCAs returns the CA certificates the Rotator was created with.
+func (r *Rotator) ConfiguredCAs() []*x509.Certificate {
+	return append([]*x509.Certificate(nil), r.configured...)
+}
+
+// SetCAs sets the CA certificates trusted by the node. If cas is nil the
+// CA certificates the Rotator was created with are trusted.
+func (r *Rotator) SetCAs(cas []*x509.Certificate) {
+	if cas == nil {
+		cas = r.configured
+	}
+	var pool *x509.CertPool
+	if len(cas) > 0 {
+		pool = x509.NewCertPool()
+		for _, ca := range cas {
+			pool.AddCert(ca)
+		}
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.cas = cas
+	r.pool = pool
+}
+
+// CAs returns the CA certificates trusted by the node. If none are returned
+// the CAs of the system are trusted.
+func (r *Rotator) CAs() []*x509.Certificate {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.cas
+}
+
+// Verify verifies that cert was issued by a CA trusted by the node, for the
+// given usage.
+func (r *Rotator) Verify(cert *x509.Certificate, usage x509.ExtKeyUsage) error {
+	r.mu.RLock()
+	pool := r.pool
+	r.mu.RUnlock()
+	_, err := cert.Verify(x509.VerifyOptions{
+		Roots:     pool,
+		KeyUsages: []x509.ExtKeyUsage{usage},
+	})
+	return err
+}
+
+// Config returns a copy of base which presents the certificate, and trusts
+// the CAs, held by the Rotator at the time each connection is made. Any
+// certificates and CAs set in base are ignored.
+func (r *Rotator) Config(base *tls.Config) *tls.Config {
+	config := base.Clone()
+	config.Certificates = nil
+	config.GetCertificate = func(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+		r.mu.RLock()
+		defer r.mu.RUnlock()
+		if r.cert == nil {
+			return nil, errors.New("no certificate")
+		}
+		return r.cert, nil
+	}
+	config.GetClientCertificate = func(*tls.CertificateRequestInfo) (*tls.Certificate, error) {
+		r.mu.RLock()
+		defer r.mu.RUnlock()
+		if r.cert == nil {
+			return &tls.Certificate{}, nil
+		}
+		return r.cert, nil
+	}
+
+	// Servers verify clients against the CAs trusted when the connection is
+	// accepted.
+	config.GetConfigForClient = func(*tls.ClientHelloInfo) (*tls.Config, error) {
+		c := config.Clone()
+		c.GetConfigForClient = nil
+		c.VerifyConnection = nil
+		r.mu.RLock()
+		c.ClientCAs = r.pool
+		r.mu.RUnlock()
+		return c, nil
+	}
+
+	// The trusted CAs of clients cannot change once a config is in use, so
+	// clients verify servers themselves.
+	if !base.InsecureSkipVerify {
+		config.InsecureSkipVerify = true
+		config.VerifyConnection = func(cs tls.ConnectionState) error {
+			if len(cs.PeerCertificates) == 0 {
+				return errors.New("no server certificate")
+			}
+			r.mu.RLock()
+			pool := r.pool
+			r.mu.RUnlock()
+			opts := x509.VerifyOptions{
+				Roots:         pool,
+				DNSName:       cs.ServerName,
+				Intermediates: x509.NewCertPool(),
+			}
+			for _, cert := range cs.PeerCertificates[1:] {
+				opts.Intermediates.AddCert(cert)
+			}
+			_, err := cs.PeerCertificates[0].Verify(opts)
+			return err
+		}
+	}
+	return config
+}
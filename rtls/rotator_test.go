@@ -0,0 +1,159 @@
+package rtls
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func Test_ParseCerts(t *testing.T) {
+	ca1, _, err := GenerateCACert(pkix.Name{CommonName: "ca1"}, time.Hour, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ca2, _, err := GenerateCACert(pkix.Name{CommonName: "ca2"}, time.Hour, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	certs, err := ParseCerts(append(ca1, ca2...))
+	if err != nil {
+		t.Fatalf("failed to parse certificates: %s", err.Error())
+	}
+	if len(certs) != 2 || certs[0].Subject.CommonName != "ca1" || certs[1].Subject.CommonName != "ca2" {
+		t.Fatalf("wrong certificates parsed")
+	}
+	if _, err := ParseCerts([]byte("not a certificate")); err == nil {
+		t.Fatalf("parsed invalid certificate")
+	}
+}
+
+func Test_RotatorRotation(t *testing.T) {
+	ca1Cert, ca1Key := mustGenerateCACert(pkix.Name{CommonName: "ca1"})
+	ca2Cert, ca2Key := mustGenerateCACert(pkix.Name{CommonName: "ca2"})
+	usage := []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth}
+	mustCert := func(ca *x509.Certificate, key interface{}) ([]byte, []byte) {
+		certPEM, keyPEM, err := GenerateCertWithSANs(pkix.Name{CommonName: "node"}, time.Hour, 2048,
+			ca, key, nil, []net.IP{net.ParseIP("127.0.0.1")}, usage)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return certPEM, keyPEM
+	}
+
+	// Both nodes start with certificates issued by the first CA.
+	dir := t.TempDir()
+	certPEM, keyPEM := mustCert(ca1Cert, ca1Key)
+	certFile := mustWriteFile(t, filepath.Join(dir, "node.crt"), certPEM)
+	keyFile := mustWriteFile(t, filepath.Join(dir, "node.key"), keyPEM)
+	caFile := mustWriteFile(t, filepath.Join(dir, "ca.crt"), pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: ca1Cert.Raw}))
+	server, err := NewRotator(certFile, keyFile, caFile)
+	if err != nil {
+		t.Fatalf("failed to create server rotator: %s", err.Error())
+	}
+	client, err := NewRotator(certFile, keyFile, caFile)
+	if err != nil {
+		t.Fatalf("failed to create client rotator: %s", err.Error())
+	}
+	if len(server.CAs()) != 1 || !server.CAs()[0].Equal(ca1Cert) {
+		t.Fatalf("server does not trust configured CA")
+	}
+
+	base, err := CreateConfig(certFile, keyFile, caFile, false, true, false)
+	if err != nil {
+		t.Fatalf("failed to create base config: %s", err.Error())
+	}
+	ln, err := tls.Listen("tcp", "127.0.0.1:0", server.Config(base))
+	if err != nil {
+		t.Fatalf("failed to listen: %s", err.Error())
+	}
+	defer ln.Close()
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				conn.(*tls.Conn).Handshake()
+			}()
+		}
+	}()
+	clientConfig := client.Config(base)
+	dial := func() error {
+		conn, err := tls.Dial("tcp", ln.Addr().String(), clientConfig)
+		if err != nil {
+			return err
+		}
+		defer conn.Close()
+		// The server's verdict on the client certificate arrives after the
+		// client's handshake completes.
+		conn.SetReadDeadline(time.Now().Add(time.Second))
+		_, err = conn.Read(make([]byte, 1))
+		if ne, ok := err.(net.Error); ok && ne.Timeout() {
+			return nil
+		}
+		if err == io.EOF {
+			return nil
+		}
+		return err
+	}
+	if err := dial(); err != nil {
+		t.Fatalf("failed to connect with first CA: %s", err.Error())
+	}
+
+	// A certificate issued by the second CA is not trusted, until the
+	// second CA is.
+	certPEM, keyPEM = mustCert(ca2Cert, ca2Key)
+	if err := server.SetCertificate(certPEM, keyPEM); err != nil {
+		t.Fatalf("failed to set server certificate: %s", err.Error())
+	}
+	if err := dial(); err == nil {
+		t.Fatalf("connected to server with untrusted certificate")
+	}
+	if err := client.Verify(server.Certificate(), x509.ExtKeyUsageServerAuth); err == nil {
+		t.Fatalf("verified server certificate issued by untrusted CA")
+	}
+	client.SetCAs(append(client.ConfiguredCAs(), ca2Cert))
+	server.SetCAs(append(server.ConfiguredCAs(), ca2Cert))
+	if err := dial(); err != nil {
+		t.Fatalf("failed to connect during transition: %s", err.Error())
+	}
+	if err := client.Verify(server.Certificate(), x509.ExtKeyUsageServerAuth); err != nil {
+		t.Fatalf("failed to verify server certificate: %s", err.Error())
+	}
+
+	// Once the first CA is retired, the client certificate it issued is
+	// rejected.
+	server.SetCAs([]*x509.Certificate{ca2Cert})
+	if err := dial(); err == nil {
+		t.Fatalf("connected to server with client certificate issued by retired CA")
+	}
+	if err := client.SetCertificate(certPEM, keyPEM); err != nil {
+		t.Fatalf("failed to set client certificate: %s", err.Error())
+	}
+	client.SetCAs([]*x509.Certificate{ca2Cert})
+	if err := dial(); err != nil {
+		t.Fatalf("failed to connect with second CA: %s", err.Error())
+	}
+
+	// Reverting to the configured CAs restores the original trust.
+	client.SetCAs(nil)
+	if err := dial(); err == nil {
+		t.Fatalf("connected to server with certificate issued by untrusted CA")
+	}
+}
+
+func mustWriteFile(t *testing.T, path string, b []byte) string {
+	if err := os.WriteFile(path, b, 0600); err != nil {
+		t.Fatalf("failed to write %s: %s", path, err.Error())
+	}
+	return path
+}
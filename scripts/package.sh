@@ -25,6 +25,7 @@ copy_binaries () {
 	cp $2/rqlited $1
 	cp $2/rqlite $1
 	cp $2/rqbench $1
+	cp $2/rqproxy $1
 }
 
 # upload_asset <path> <release ID> <API token>
@@ -84,7 +85,7 @@ rm -f $GOPATH/bin/*
 if [ "$kernel" = "Linux" ]; then
 	STATIC="-extldflags=-static"
 fi
-CGO_ENABLED=1 go install -a -tags osusergo,netgo,sqlite_omit_load_extension -ldflags="$STATIC $LDFLAGS" ./...
+CGO_ENABLED=1 go install -a -tags osusergo,netgo,sqlite_omit_load_extension,sqlite_vtable -ldflags="$STATIC $LDFLAGS" ./...
 if [ "$kernel" = "Linux" ]; then
 	ldd $GOPATH/bin/rqlited >/dev/null 2>&1
 	if [ $? -ne 1 ]; then
@@ -132,7 +133,7 @@ for arch in "${!archs[@]}"; do
   compiler=${archs[$arch]}
 
   cd $tmp_build/src/github.com/rqlite/rqlite
-  CGO_ENABLED=1 GOARCH=$arch CC=$compiler go install -a -tags sqlite_omit_load_extension -ldflags="$LDFLAGS" ./...
+  CGO_ENABLED=1 GOARCH=$arch CC=$compiler go install -a -tags sqlite_omit_load_extension,sqlite_vtable -ldflags="$LDFLAGS" ./...
 
   if [ "$compiler" == "musl-gcc" ]; then
     release=`echo rqlite-$VERSION-$kernel-$arch-musl | tr '[:upper:]' '[:lower:]'`
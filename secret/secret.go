@@ -0,0 +1,183 @@
+// Package secret resolves references to secrets held outside of rqlite's
+// configuration, so that secrets need not appear in command lines or
+// configuration files.
+package secret
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/rqlite/rqlite/aws"
+)
+
+const (
+	// SchemeEnv references the value of an environment variable, for
+	// example env://RQLITE_PASSWORD.
+	SchemeEnv = "env://"
+
+	// SchemeFile references the contents of a file, for example
+	// file:///etc/rqlite/password. A single trailing newline is removed.
+	SchemeFile = "file://"
+
+	// SchemeVault references a key of a secret held by HashiCorp Vault, for
+	// example vault://secret/data/rqlite#password. The Vault server and
+	// token are taken from VAULT_ADDR and VAULT_TOKEN. If no key is given,
+	// the key "value" is used.
+	SchemeVault = "vault://"
+
+	// SchemeAWSKMS references a ciphertext, base64-encoded, to be decrypted by
+	// AWS KMS, for example awskms://AQICAHh...?region=us-east-1. If no region
+	// is given, the region is taken from the environment.
+	SchemeAWSKMS = "awskms://"
+)
+
+// defaultVaultKey is the key of a Vault secret used if a reference does not
+// specify one.
+const defaultVaultKey = "value"
+
+// resolveTimeout bounds the time taken to resolve a secret held remotely.
+const resolveTimeout = 30 * time.Second
+
+// kmsDecrypt decrypts ciphertext using AWS KMS. It may be replaced by tests.
+var kmsDecrypt = aws.KMSDecrypt
+
+// IsReference returns whether s is a reference to a secret.
+func IsReference(s string) bool {
+	for _, scheme := range []string{SchemeEnv, SchemeFile, SchemeVault, SchemeAWSKMS} {
+		if strings.HasPrefix(s, scheme) {
+			return true
+		}
+	}
+	return false
+}
+
+// Resolve returns the secret referenced by s. If s is not a reference to a
+// secret, s itself is returned.
+func Resolve(s string) (string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), resolveTimeout)
+	defer cancel()
+
+	var v string
+	var err error
+	switch {
+	case strings.HasPrefix(s, SchemeEnv):
+		v, err = resolveEnv(strings.TrimPrefix(s, SchemeEnv))
+	case strings.HasPrefix(s, SchemeFile):
+		v, err = resolveFile(strings.TrimPrefix(s, SchemeFile))
+	case strings.HasPrefix(s, SchemeVault):
+		v, err = resolveVault(ctx, strings.TrimPrefix(s, SchemeVault))
+	case strings.HasPrefix(s, SchemeAWSKMS):
+		v, err = resolveAWSKMS(ctx, strings.TrimPrefix(s, SchemeAWSKMS))
+	default:
+		return s, nil
+	}
+	if err != nil {
+		// The reference itself is not secret, so can be reported.
+		return "", fmt.Errorf("failed to resolve secret %s: %s", s, err.Error())
+	}
+	return v, nil
+}
+
+func resolveEnv(name string) (string, error) {
+	v, ok := os.LookupEnv(name)
+	if !ok {
+		return "", errors.New("environment variable not set")
+	}
+	return v, nil
+}
+
+func resolveFile(path string) (string, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return "", err
+	}
+	v := strings.TrimSuffix(string(b), "\n")
+	return strings.TrimSuffix(v, "\r"), nil
+}
+
+func resolveVault(ctx context.Context, ref string) (string, error) {
+	path, key := ref, defaultVaultKey
+	if i := strings.LastIndex(ref, "#"); i >= 0 {
+		path, key = ref[:i], ref[i+1:]
+	}
+	addr := os.Getenv("VAULT_ADDR")
+	if addr == "" {
+		return "", errors.New("VAULT_ADDR not set")
+	}
+	token := os.Getenv("VAULT_TOKEN")
+	if token == "" {
+		return "", errors.New("VAULT_TOKEN not set")
+	}
+
+	u := strings.TrimSuffix(addr, "/") + "/v1/" + strings.TrimPrefix(path, "/")
+	req, err := http.NewRequestWithContext(ctx, "GET", u, nil)
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("X-Vault-Token", token)
+	if ns := os.Getenv("VAULT_NAMESPACE"); ns != "" {
+		req.Header.Set("X-Vault-Namespace", ns)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("vault responded with %s", resp.Status)
+	}
+
+	var body struct {
+		Data map[string]json.RawMessage `json:"data"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		return "", fmt.Errorf("failed to decode vault response: %s", err.Error())
+	}
+	data := body.Data
+
+	// Secrets in version 2 of the KV secrets engine are nested under a
+	// second data field, alongside their metadata.
+	if raw, ok := data["data"]; ok && data["metadata"] != nil {
+		if err := json.Unmarshal(raw, &data); err != nil {
+			return "", fmt.Errorf("failed to decode vault secret: %s", err.Error())
+		}
+	}
+	raw, ok := data[key]
+	if !ok {
+		return "", fmt.Errorf("key %q not found", key)
+	}
+	var v string
+	if err := json.Unmarshal(raw, &v); err != nil {
+		return "", fmt.Errorf("key %q is not a string", key)
+	}
+	return v, nil
+}
+
+func resolveAWSKMS(ctx context.Context, ref string) (string, error) {
+	ciphertext, region := ref, ""
+	if i := strings.Index(ref, "?"); i >= 0 {
+		ciphertext = ref[:i]
+		q, err := url.ParseQuery(ref[i+1:])
+		if err != nil {
+			return "", err
+		}
+		region = q.Get("region")
+	}
+	b, err := base64.StdEncoding.DecodeString(ciphertext)
+	if err != nil {
+		return "", fmt.Errorf("ciphertext is not base64-encoded: %s", err.Error())
+	}
+	v, err := kmsDecrypt(ctx, region, b)
+	if err != nil {
+		return "", err
+	}
+	return string(v), nil
+}
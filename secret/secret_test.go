@@ -0,0 +1,143 @@
+package secret
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func Test_ResolveLiteral(t *testing.T) {
+	for _, s := range []string{"", "secret", "http://example.com", "env:/FOO"} {
+		if IsReference(s) {
+			t.Fatalf("%q considered a reference", s)
+		}
+		v, err := Resolve(s)
+		if err != nil {
+			t.Fatalf("failed to resolve %q: %s", s, err.Error())
+		}
+		if v != s {
+			t.Fatalf("literal %q resolved to %q", s, v)
+		}
+	}
+}
+
+func Test_ResolveEnv(t *testing.T) {
+	os.Setenv("RQLITE_TEST_SECRET", "secret1")
+	defer os.Unsetenv("RQLITE_TEST_SECRET")
+
+	if !IsReference("env://RQLITE_TEST_SECRET") {
+		t.Fatalf("env reference not considered a reference")
+	}
+	v, err := Resolve("env://RQLITE_TEST_SECRET")
+	if err != nil {
+		t.Fatalf("failed to resolve env reference: %s", err.Error())
+	}
+	if v != "secret1" {
+		t.Fatalf("wrong secret, exp secret1, got %s", v)
+	}
+	if _, err := Resolve("env://RQLITE_TEST_SECRET_UNSET"); err == nil {
+		t.Fatalf("resolved unset environment variable")
+	}
+}
+
+func Test_ResolveFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "secret")
+	if err := os.WriteFile(path, []byte("secret1\n"), 0600); err != nil {
+		t.Fatalf("failed to write secret: %s", err.Error())
+	}
+	v, err := Resolve("file://" + path)
+	if err != nil {
+		t.Fatalf("failed to resolve file reference: %s", err.Error())
+	}
+	if v != "secret1" {
+		t.Fatalf("wrong secret, exp secret1, got %q", v)
+	}
+	if _, err := Resolve("file://" + path + "-missing"); err == nil {
+		t.Fatalf("resolved missing file")
+	}
+}
+
+func Test_ResolveVault(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("X-Vault-Token") != "token1" {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		switch r.URL.Path {
+		case "/v1/secret/data/rqlite":
+			fmt.Fprint(w, `{"data": {"data": {"password": "secret2", "value": "secret3"}, "metadata": {"version": 1}}}`)
+		case "/v1/kv/rqlite":
+			fmt.Fprint(w, `{"data": {"password": "secret1", "count": 1}}`)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer ts.Close()
+	os.Setenv("VAULT_ADDR", ts.URL)
+	defer os.Unsetenv("VAULT_ADDR")
+	os.Setenv("VAULT_TOKEN", "token1")
+	defer os.Unsetenv("VAULT_TOKEN")
+
+	for ref, exp := range map[string]string{
+		"vault://kv/rqlite#password":          "secret1",
+		"vault://secret/data/rqlite#password": "secret2",
+		"vault://secret/data/rqlite":          "secret3",
+	} {
+		v, err := Resolve(ref)
+		if err != nil {
+			t.Fatalf("failed to resolve %s: %s", ref, err.Error())
+		}
+		if v != exp {
+			t.Fatalf("wrong secret for %s, exp %s, got %s", ref, exp, v)
+		}
+	}
+
+	for _, ref := range []string{
+		"vault://kv/rqlite#missing",
+		"vault://kv/rqlite#count",
+		"vault://kv/missing#password",
+	} {
+		if _, err := Resolve(ref); err == nil {
+			t.Fatalf("resolved %s", ref)
+		}
+	}
+
+	os.Setenv("VAULT_TOKEN", "token2")
+	if _, err := Resolve("vault://kv/rqlite#password"); err == nil {
+		t.Fatalf("resolved secret with wrong token")
+	}
+}
+
+func Test_ResolveAWSKMS(t *testing.T) {
+	defer func(f func(context.Context, string, []byte) ([]byte, error)) { kmsDecrypt = f }(kmsDecrypt)
+	kmsDecrypt = func(ctx context.Context, region string, ciphertext []byte) ([]byte, error) {
+		if string(ciphertext) != "ciphertext" {
+			return nil, errors.New("bad ciphertext")
+		}
+		return []byte("secret-" + region), nil
+	}
+
+	b64 := base64.StdEncoding.EncodeToString([]byte("ciphertext"))
+	v, err := Resolve("awskms://" + b64 + "?region=us-west-2")
+	if err != nil {
+		t.Fatalf("failed to resolve KMS reference: %s", err.Error())
+	}
+	if v != "secret-us-west-2" {
+		t.Fatalf("wrong secret, exp secret-us-west-2, got %s", v)
+	}
+	if v, err := Resolve("awskms://" + b64); err != nil || v != "secret-" {
+		t.Fatalf("failed to resolve KMS reference without region: %v", err)
+	}
+	if _, err := Resolve("awskms://not-base64!"); err == nil {
+		t.Fatalf("resolved invalid ciphertext")
+	}
+	if _, err := Resolve("awskms://" + base64.StdEncoding.EncodeToString([]byte("other"))); err == nil {
+		t.Fatalf("resolved ciphertext KMS failed to decrypt")
+	}
+}
@@ -0,0 +1,37 @@
+package store
+
+import (
+	"sync/atomic"
+
+	"github.com/hashicorp/raft"
+)
+
+// admitWrite returns ErrApplyBacklog if this node has more log entries
+// waiting to be applied than MaxApplyBacklog allows, so that writes arriving
+// faster than they can be applied are refused rather than queued in memory.
+func (s *Store) admitWrite() error {
+	if s.MaxApplyBacklog <= 0 {
+		return nil
+	}
+	if atomic.LoadInt64(&s.applyBacklog) >= int64(s.MaxApplyBacklog) {
+		stats.Add(numApplyBacklogRefusals, 1)
+		return ErrApplyBacklog
+	}
+	return nil
+}
+
+// applyWait applies b to the Raft log, and waits until it is applied, or
+// fails. The entry counts towards the apply backlog while it waits.
+func (s *Store) applyWait(b []byte) raft.ApplyFuture {
+	atomic.AddInt64(&s.applyBacklog, 1)
+	defer atomic.AddInt64(&s.applyBacklog, -1)
+	af := s.raft.Apply(b, s.ApplyTimeout)
+	af.Error()
+	return af
+}
+
+// ApplyBacklog returns the number of log entries submitted by this node
+// which are waiting to be applied.
+func (s *Store) ApplyBacklog() int64 {
+	return atomic.LoadInt64(&s.applyBacklog)
+}
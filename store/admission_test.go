@@ -0,0 +1,53 @@
+package store
+
+import (
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/rqlite/rqlite/command"
+)
+
+func Test_SingleNodeApplyBacklog(t *testing.T) {
+	s, ln := mustNewStore(t, true)
+	defer ln.Close()
+	s.MaxApplyBacklog = 2
+
+	if err := s.Open(); err != nil {
+		t.Fatalf("failed to open single-node store: %s", err.Error())
+	}
+	defer s.Close(true)
+	if err := s.Bootstrap(NewServer(s.ID(), s.Addr(), true)); err != nil {
+		t.Fatalf("failed to bootstrap single-node store: %s", err.Error())
+	}
+	if _, err := s.WaitForLeader(10 * time.Second); err != nil {
+		t.Fatalf("Error waiting for leader: %s", err)
+	}
+
+	er := executeRequestFromString(`CREATE TABLE foo (id INTEGER NOT NULL PRIMARY KEY, name TEXT)`, false, false)
+	if _, err := s.Execute(er); err != nil {
+		t.Fatalf("failed to execute: %s", err.Error())
+	}
+	if n := s.ApplyBacklog(); n != 0 {
+		t.Fatalf("backlog not drained after write, got %d", n)
+	}
+
+	// Simulate writes waiting to be applied.
+	atomic.AddInt64(&s.applyBacklog, 2)
+	er = executeRequestFromString(`INSERT INTO foo(id, name) VALUES(1, "fiona")`, false, false)
+	if _, err := s.Execute(er); err != ErrApplyBacklog {
+		t.Fatalf("write not refused with backlog, got %v", err)
+	}
+	if _, err := s.Request(executeQueryRequestFromString(`INSERT INTO foo(id, name) VALUES(1, "fiona")`,
+		command.QueryRequest_QUERY_REQUEST_LEVEL_WEAK, false, false)); err != ErrApplyBacklog {
+		t.Fatalf("request not refused with backlog, got %v", err)
+	}
+	if _, err := s.Query(queryRequestFromString(`SELECT * FROM foo`, false, false)); err != nil {
+		t.Fatalf("query refused with backlog: %s", err.Error())
+	}
+
+	atomic.AddInt64(&s.applyBacklog, -1)
+	if _, err := s.Execute(er); err != nil {
+		t.Fatalf("write refused below backlog limit: %s", err.Error())
+	}
+}
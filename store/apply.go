@@ -0,0 +1,262 @@
+package store
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"syscall"
+	"time"
+
+	"github.com/hashicorp/raft"
+	"github.com/rqlite/rqlite/command"
+	sql "github.com/rqlite/rqlite/db"
+)
+
+const (
+	defaultApplyRetries    = 5
+	defaultApplyRetryDelay = 100 * time.Millisecond
+	maxApplyRetryDelay     = 5 * time.Second
+	quarantineDir          = "quarantine"
+)
+
+var (
+	// ErrFSMHalted is returned when a log entry is not applied because the
+	// FSM has halted after failing to apply an earlier entry.
+	ErrFSMHalted = errors.New("FSM halted")
+)
+
+// FSMHalt describes the failure to apply a log entry which halted the FSM.
+// The FSM applies no further entries until the node installs a snapshot from
+// the Leader, or is restarted, so that it never goes on from a state which
+// differs from that of the other nodes.
+type FSMHalt struct {
+	Index uint64    `json:"index"`
+	Term  uint64    `json:"term"`
+	Error string    `json:"error"`
+	Time  time.Time `json:"time"`
+
+	// Quarantine is the path of the file holding the data of the entry, if
+	// it could be written.
+	Quarantine string `json:"quarantine,omitempty"`
+}
+
+// String returns a string representation of the FSMHalt.
+func (h *FSMHalt) String() string {
+	return fmt.Sprintf("FSM halted at index %d: %s", h.Index, h.Error)
+}
+
+// haltError is the error with which a log entry fails to apply if the failure
+// leaves the database in a state which differs from that of nodes which did
+// apply the entry, or if the entry cannot be applied by any node.
+type haltError struct {
+	err error
+}
+
+func (e *haltError) Error() string {
+	return e.err.Error()
+}
+
+func (e *haltError) Unwrap() error {
+	return e.err
+}
+
+// applyRetryPolicy controls the retrying of log entries whose application
+// fails with a transient error, such as the disk being full.
+type applyRetryPolicy struct {
+	maxRetries int
+	delay      time.Duration
+}
+
+// do calls f for as long as it fails transiently, retrying with exponential
+// backoff up to the maximum number of retries. f returns whether it failed
+// transiently, and whether it may then be retried. do returns whether the
+// final call to f failed transiently. A nil policy never retries.
+func (p *applyRetryPolicy) do(f func() (transient, retriable bool)) bool {
+	var delay time.Duration
+	if p != nil {
+		delay = p.delay
+	}
+	for retries := 0; ; retries++ {
+		transient, retriable := f()
+		if !transient || !retriable || p == nil || retries >= p.maxRetries {
+			return transient
+		}
+		stats.Add(numApplyRetries, 1)
+		time.Sleep(delay)
+		if delay *= 2; delay > maxApplyRetryDelay {
+			delay = maxApplyRetryDelay
+		}
+	}
+}
+
+// isTransient returns whether err may not recur if the operation which failed
+// is retried.
+func isTransient(err error) bool {
+	return sql.IsTransientError(err) || errors.Is(err, syscall.ENOSPC) || errors.Is(err, syscall.EIO)
+}
+
+// retriableRequest returns whether a request, whose execution failed part way
+// through, may be executed again. That is only so if it is a transaction, as
+// it was then rolled back, or if it has a single statement, as otherwise
+// statements which succeeded would be executed again.
+func retriableRequest(req *command.Request) bool {
+	if req.Transaction {
+		return true
+	}
+	n := 0
+	for _, stmt := range req.Statements {
+		if stmt.Sql != "" {
+			n++
+		}
+	}
+	return n <= 1
+}
+
+// executeTransient returns whether the execution of a request failed
+// transiently, and whether it may then be retried.
+func executeTransient(req *command.Request, results []*command.ExecuteResult, err error) (bool, bool) {
+	if err != nil {
+		// Nothing was executed, or the transaction was rolled back.
+		return isTransient(err), true
+	}
+	for _, r := range results {
+		if sql.IsTransientErrorMessage(r.Error) {
+			return true, retriableRequest(req)
+		}
+	}
+	return false, false
+}
+
+// queryTransient returns whether a query failed transiently. A query may
+// always be retried.
+func queryTransient(rows []*command.QueryRows, err error) bool {
+	if err != nil {
+		return isTransient(err)
+	}
+	for _, r := range rows {
+		if sql.IsTransientErrorMessage(r.Error) {
+			return true
+		}
+	}
+	return false
+}
+
+// requestTransient returns whether the execution of a request holding both
+// queries and writes failed transiently, and whether it may then be retried.
+func requestTransient(req *command.Request, results []*command.ExecuteQueryResponse, err error) (bool, bool) {
+	if err != nil {
+		return isTransient(err), true
+	}
+	for _, r := range results {
+		msg := r.GetError()
+		if q := r.GetQ(); q != nil {
+			msg = q.Error
+		} else if e := r.GetE(); e != nil {
+			msg = e.Error
+		}
+		if sql.IsTransientErrorMessage(msg) {
+			return true, retriableRequest(req)
+		}
+	}
+	return false, false
+}
+
+// FSMHalt returns the failure which halted the FSM, or nil if the FSM is
+// applying log entries.
+func (s *Store) FSMHalt() *FSMHalt {
+	s.fsmHaltMu.RLock()
+	defer s.fsmHaltMu.RUnlock()
+	return s.fsmHalt
+}
+
+// haltFSM halts the FSM at the log entry l, which failed to apply with err.
+// The data of the entry is quarantined, so it can be examined once the cause
+// of the failure is addressed.
+func (s *Store) haltFSM(l *raft.Log, err error) {
+	h := &FSMHalt{
+		Index: l.Index,
+		Term:  l.Term,
+		Error: err.Error(),
+		Time:  time.Now(),
+	}
+	path, qErr := s.quarantine(l)
+	if qErr != nil {
+		s.logger.Printf("failed to quarantine log entry at index %d: %s", l.Index, qErr)
+	} else {
+		h.Quarantine = path
+	}
+
+	s.fsmHaltMu.Lock()
+	defer s.fsmHaltMu.Unlock()
+	s.fsmHalt = h
+	stats.Add(numFSMHalts, 1)
+	s.logger.Printf("%s, no further log entries will be applied", h)
+}
+
+// resumeFSM clears any halt of the FSM, as its state is to be replaced by
+// that of a snapshot.
+func (s *Store) resumeFSM() {
+	s.fsmHaltMu.Lock()
+	defer s.fsmHaltMu.Unlock()
+	if s.fsmHalt != nil {
+		s.logger.Printf("resuming FSM halted at index %d", s.fsmHalt.Index)
+		s.fsmHalt = nil
+	}
+}
+
+// quarantine writes the data of the log entry l to the quarantine directory,
+// returning the path of the file written.
+func (s *Store) quarantine(l *raft.Log) (string, error) {
+	dir := filepath.Join(s.raftDir, quarantineDir)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return "", err
+	}
+	path := filepath.Join(dir, fmt.Sprintf("%d-%d.entry", l.Index, l.Term))
+	return path, ioutil.WriteFile(path, l.Data, 0640)
+}
+
+// responseError returns the error of a response of the FSM, if any.
+func responseError(r interface{}) error {
+	switch v := r.(type) {
+	case *fsmExecuteResponse:
+		return v.error
+	case *fsmQueryResponse:
+		return v.error
+	case *fsmExecuteQueryResponse:
+		return v.error
+	case *fsmGenericResponse:
+		return v.error
+	}
+	return nil
+}
+
+// transientFailure returns the error describing a request which failed
+// transiently. err is the error of the request, nil if only the results of
+// its statements hold errors.
+func transientFailure(err error, msg string) error {
+	if err != nil {
+		return err
+	}
+	return errors.New(msg + " with a transient error")
+}
+
+// haltedResponse returns the response to a log entry which is not applied
+// because the FSM has halted, of the type expected by the writer of the entry.
+func haltedResponse(data []byte) interface{} {
+	var c command.Command
+	if err := command.Unmarshal(data, &c); err != nil {
+		return &fsmGenericResponse{error: ErrFSMHalted}
+	}
+	switch c.Type {
+	case command.Command_COMMAND_TYPE_QUERY:
+		return &fsmQueryResponse{error: ErrFSMHalted}
+	case command.Command_COMMAND_TYPE_EXECUTE, command.Command_COMMAND_TYPE_EXECUTE_CHUNK:
+		return &fsmExecuteResponse{error: ErrFSMHalted}
+	case command.Command_COMMAND_TYPE_EXECUTE_QUERY:
+		return &fsmExecuteQueryResponse{error: ErrFSMHalted}
+	default:
+		return &fsmGenericResponse{error: ErrFSMHalted}
+	}
+}
@@ -0,0 +1,166 @@
+package store
+
+import (
+	"bytes"
+	"errors"
+	"io/ioutil"
+	"testing"
+	"time"
+
+	"github.com/rqlite/rqlite/command"
+)
+
+func Test_SingleNodeFSMHalt(t *testing.T) {
+	s, ln := mustNewStore(t, true)
+	defer ln.Close()
+
+	if err := s.Open(); err != nil {
+		t.Fatalf("failed to open single-node store: %s", err.Error())
+	}
+	defer s.Close(true)
+	if err := s.Bootstrap(NewServer(s.ID(), s.Addr(), true)); err != nil {
+		t.Fatalf("failed to bootstrap single-node store: %s", err.Error())
+	}
+	if _, err := s.WaitForLeader(10 * time.Second); err != nil {
+		t.Fatalf("Error waiting for leader: %s", err)
+	}
+	if _, err := s.Execute(executeRequestFromString(`CREATE TABLE foo (id INTEGER NOT NULL PRIMARY KEY, name TEXT)`, false, false)); err != nil {
+		t.Fatalf("failed to create table: %s", err.Error())
+	}
+	if s.FSMHalt() != nil {
+		t.Fatalf("FSM halted before any failure")
+	}
+
+	// A command of a type this version does not know cannot be applied.
+	b, err := command.Marshal(&command.Command{Type: command.Command_Type(1000)})
+	if err != nil {
+		t.Fatalf("failed to marshal command: %s", err.Error())
+	}
+	af := s.raft.Apply(b, s.ApplyTimeout)
+	if af.Error() != nil {
+		t.Fatalf("failed to apply command: %s", af.Error())
+	}
+	if err := af.Response().(*fsmGenericResponse).error; err == nil {
+		t.Fatalf("unknown command applied without error")
+	}
+
+	h := s.FSMHalt()
+	if h == nil {
+		t.Fatalf("FSM not halted by unknown command")
+	}
+	if exp, got := af.Index(), h.Index; exp != got {
+		t.Fatalf("wrong halt index, exp %d, got %d", exp, got)
+	}
+	q, err := ioutil.ReadFile(h.Quarantine)
+	if err != nil {
+		t.Fatalf("failed to read quarantined entry: %s", err.Error())
+	}
+	if !bytes.Equal(q, b) {
+		t.Fatalf("quarantined entry has wrong data")
+	}
+	if s.Ready() {
+		t.Fatalf("store ready while FSM halted")
+	}
+	stats, err := s.Stats()
+	if err != nil {
+		t.Fatalf("failed to get stats: %s", err.Error())
+	}
+	if stats["fsm_halt"] != h {
+		t.Fatalf("halt not reported in stats")
+	}
+	if stats["fsm_index"].(uint64) >= h.Index {
+		t.Fatalf("FSM index advanced to halted entry")
+	}
+
+	// No further requests are accepted, no further entries are applied, and
+	// no snapshot is taken.
+	er := executeRequestFromString(`INSERT INTO foo(id, name) VALUES(1, "fiona")`, false, false)
+	if _, err := s.Execute(er); err != ErrNotReady {
+		t.Fatalf("execute on halted FSM returned wrong error: %v", err)
+	}
+	b, compressed, err := s.reqMarshaller.Marshal(er)
+	if err != nil {
+		t.Fatalf("failed to marshal request: %s", err.Error())
+	}
+	b, err = command.Marshal(&command.Command{
+		Type:       command.Command_COMMAND_TYPE_EXECUTE,
+		SubCommand: b,
+		Compressed: compressed,
+	})
+	if err != nil {
+		t.Fatalf("failed to marshal command: %s", err.Error())
+	}
+	af = s.raft.Apply(b, s.ApplyTimeout)
+	if af.Error() != nil {
+		t.Fatalf("failed to apply command: %s", af.Error())
+	}
+	if err := af.Response().(*fsmExecuteResponse).error; err != ErrFSMHalted {
+		t.Fatalf("entry applied to halted FSM returned wrong error: %v", err)
+	}
+	if _, err := s.Snapshot(); !errors.Is(err, ErrFSMHalted) {
+		t.Fatalf("snapshot of halted FSM returned wrong error: %v", err)
+	}
+}
+
+func Test_ApplyRetryPolicy(t *testing.T) {
+	p := &applyRetryPolicy{maxRetries: 3, delay: time.Millisecond}
+
+	// call returns a function, for passing to do, which fails transiently
+	// until it has been called n times.
+	var calls int
+	call := func(n int, retriable bool) func() (bool, bool) {
+		calls = 0
+		return func() (bool, bool) {
+			calls++
+			return calls < n, retriable
+		}
+	}
+
+	if p.do(call(1, true)) || calls != 1 {
+		t.Fatalf("successful call retried, %d calls", calls)
+	}
+	if p.do(call(3, true)) || calls != 3 {
+		t.Fatalf("transient failure not retried until success, %d calls", calls)
+	}
+	if !p.do(call(10, true)) || calls != 4 {
+		t.Fatalf("transient failure not retried up to maximum, %d calls", calls)
+	}
+	if !p.do(call(10, false)) || calls != 1 {
+		t.Fatalf("non-retriable failure retried, %d calls", calls)
+	}
+
+	var nilPolicy *applyRetryPolicy
+	if !nilPolicy.do(call(10, true)) || calls != 1 {
+		t.Fatalf("nil policy retried, %d calls", calls)
+	}
+}
+
+func Test_ExecuteTransient(t *testing.T) {
+	full := []*command.ExecuteResult{{RowsAffected: 1}, {Error: "database or disk is full"}}
+	constraint := []*command.ExecuteResult{{Error: "UNIQUE constraint failed: foo.id"}}
+	stmts := func(tx bool, sql ...string) *command.Request {
+		req := &command.Request{Transaction: tx}
+		for _, s := range sql {
+			req.Statements = append(req.Statements, &command.Statement{Sql: s})
+		}
+		return req
+	}
+
+	for i, tt := range []struct {
+		req       *command.Request
+		results   []*command.ExecuteResult
+		transient bool
+		retriable bool
+	}{
+		{stmts(false, "INSERT 1"), constraint, false, false},
+		{stmts(false, "INSERT 1"), full[1:], true, true},
+		{stmts(true, "INSERT 1", "INSERT 2"), full, true, true},
+		{stmts(false, "INSERT 1", "INSERT 2"), full, true, false},
+	} {
+		transient, retriable := executeTransient(tt.req, tt.results, nil)
+		if transient != tt.transient || retriable != tt.retriable {
+			t.Fatalf("test %d: exp transient %v retriable %v, got %v %v",
+				i, tt.transient, tt.retriable, transient, retriable)
+		}
+	}
+}
@@ -0,0 +1,235 @@
+package store
+
+import (
+	"encoding/json"
+	"fmt"
+	"hash/crc64"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/hashicorp/raft"
+)
+
+const (
+	archiveMetaFile  = "meta.json"
+	archiveStateFile = "state.bin"
+	archiveTmpSuffix = ".tmp"
+)
+
+// SnapshotArchiver is the interface an object must support to archive copies
+// of Raft snapshots away from the node.
+type SnapshotArchiver interface {
+	// Archive archives the snapshot described by meta, the contents of which
+	// are read from r.
+	Archive(meta *raft.SnapshotMeta, r io.Reader) error
+	fmt.Stringer
+}
+
+// DirSnapshotArchiver archives snapshots to a directory, which may be on
+// network-attached storage. The layout of the directory is that of a Raft
+// file snapshot store, so archived snapshots may be copied back into the
+// snapshot directory of a node to recover it.
+type DirSnapshotArchiver struct {
+	dir    string
+	retain int
+}
+
+// NewDirSnapshotArchiver returns a DirSnapshotArchiver which archives
+// snapshots to dir. If retain is non-zero, only the most recent retain
+// snapshots are kept in dir.
+func NewDirSnapshotArchiver(dir string, retain int) (*DirSnapshotArchiver, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+	return &DirSnapshotArchiver{
+		dir:    dir,
+		retain: retain,
+	}, nil
+}
+
+// archiveMeta is the metadata written alongside each archived snapshot. It
+// matches the metadata written by the Raft file snapshot store.
+type archiveMeta struct {
+	raft.SnapshotMeta
+	CRC []byte
+}
+
+// Archive implements SnapshotArchiver.
+func (d *DirSnapshotArchiver) Archive(meta *raft.SnapshotMeta, r io.Reader) error {
+	tmpDir := filepath.Join(d.dir, meta.ID+archiveTmpSuffix)
+	if err := os.RemoveAll(tmpDir); err != nil {
+		return err
+	}
+	if err := os.MkdirAll(tmpDir, 0755); err != nil {
+		return err
+	}
+	if err := d.write(tmpDir, meta, r); err != nil {
+		os.RemoveAll(tmpDir)
+		return err
+	}
+	if err := os.Rename(tmpDir, filepath.Join(d.dir, meta.ID)); err != nil {
+		os.RemoveAll(tmpDir)
+		return err
+	}
+	return d.reap()
+}
+
+// String implements fmt.Stringer.
+func (d *DirSnapshotArchiver) String() string {
+	return d.dir
+}
+
+// List returns the metadata of the archived snapshots, oldest first.
+func (d *DirSnapshotArchiver) List() ([]*raft.SnapshotMeta, error) {
+	entries, err := os.ReadDir(d.dir)
+	if err != nil {
+		return nil, err
+	}
+	var metas []*raft.SnapshotMeta
+	for _, e := range entries {
+		if !e.IsDir() || strings.HasSuffix(e.Name(), archiveTmpSuffix) {
+			continue
+		}
+		b, err := os.ReadFile(filepath.Join(d.dir, e.Name(), archiveMetaFile))
+		if err != nil {
+			return nil, err
+		}
+		var m archiveMeta
+		if err := json.Unmarshal(b, &m); err != nil {
+			return nil, fmt.Errorf("snapshot %s: %s", e.Name(), err)
+		}
+		metas = append(metas, &m.SnapshotMeta)
+	}
+	sort.Slice(metas, func(i, j int) bool {
+		if metas[i].Term != metas[j].Term {
+			return metas[i].Term < metas[j].Term
+		}
+		if metas[i].Index != metas[j].Index {
+			return metas[i].Index < metas[j].Index
+		}
+		return metas[i].ID < metas[j].ID
+	})
+	return metas, nil
+}
+
+func (d *DirSnapshotArchiver) write(dir string, meta *raft.SnapshotMeta, r io.Reader) error {
+	fd, err := os.Create(filepath.Join(dir, archiveStateFile))
+	if err != nil {
+		return err
+	}
+	defer fd.Close()
+	h := crc64.New(crc64.MakeTable(crc64.ECMA))
+	n, err := io.Copy(io.MultiWriter(fd, h), r)
+	if err != nil {
+		return err
+	}
+	if err := fd.Sync(); err != nil {
+		return err
+	}
+
+	m := archiveMeta{SnapshotMeta: *meta, CRC: h.Sum(nil)}
+	m.Size = n
+	b, err := json.Marshal(m)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(filepath.Join(dir, archiveMetaFile), b, 0644)
+}
+
+func (d *DirSnapshotArchiver) reap() error {
+	if d.retain <= 0 {
+		return nil
+	}
+	metas, err := d.List()
+	if err != nil {
+		return err
+	}
+	for i := 0; i < len(metas)-d.retain; i++ {
+		if err := os.RemoveAll(filepath.Join(d.dir, metas[i].ID)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// archivingSnapshotStore is a Raft snapshot store which archives a copy of
+// each snapshot once it has been successfully persisted.
+type archivingSnapshotStore struct {
+	raft.SnapshotStore
+	archiver SnapshotArchiver
+	logger   *log.Logger
+	wg       sync.WaitGroup
+	mu       sync.Mutex // Serializes archiving.
+}
+
+func newArchivingSnapshotStore(ss raft.SnapshotStore, a SnapshotArchiver, logger *log.Logger) *archivingSnapshotStore {
+	return &archivingSnapshotStore{
+		SnapshotStore: ss,
+		archiver:      a,
+		logger:        logger,
+	}
+}
+
+// Create implements raft.SnapshotStore.
+func (a *archivingSnapshotStore) Create(version raft.SnapshotVersion, index, term uint64,
+	configuration raft.Configuration, configurationIndex uint64, trans raft.Transport) (raft.SnapshotSink, error) {
+	sink, err := a.SnapshotStore.Create(version, index, term, configuration, configurationIndex, trans)
+	if err != nil {
+		return nil, err
+	}
+	return &archivingSnapshotSink{SnapshotSink: sink, store: a}, nil
+}
+
+// Wait waits for any archiving in progress to complete.
+func (a *archivingSnapshotStore) Wait() {
+	a.wg.Wait()
+}
+
+// archive copies the snapshot with the given ID to the archiver. Snapshots
+// are archived in the background, so that Raft is not blocked by slow
+// secondary storage.
+func (a *archivingSnapshotStore) archive(id string) {
+	a.wg.Add(1)
+	go func() {
+		defer a.wg.Done()
+		if err := a.archiveSnapshot(id); err != nil {
+			stats.Add(numSnapshotArchiveFailures, 1)
+			a.logger.Printf("failed to archive snapshot %s to %s: %s", id, a.archiver, err.Error())
+			return
+		}
+		stats.Add(numSnapshotsArchived, 1)
+		a.logger.Printf("archived snapshot %s to %s", id, a.archiver)
+	}()
+}
+
+func (a *archivingSnapshotStore) archiveSnapshot(id string) error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	meta, rc, err := a.SnapshotStore.Open(id)
+	if err != nil {
+		return err
+	}
+	defer rc.Close()
+	return a.archiver.Archive(meta, rc)
+}
+
+// archivingSnapshotSink archives the snapshot written to it when it is
+// successfully closed.
+type archivingSnapshotSink struct {
+	raft.SnapshotSink
+	store *archivingSnapshotStore
+}
+
+// Close implements raft.SnapshotSink.
+func (s *archivingSnapshotSink) Close() error {
+	if err := s.SnapshotSink.Close(); err != nil {
+		return err
+	}
+	s.store.archive(s.ID())
+	return nil
+}
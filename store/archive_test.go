@@ -0,0 +1,55 @@
+package store
+
+import (
+	"bytes"
+	"io"
+	"path/filepath"
+	"testing"
+
+	"github.com/hashicorp/raft"
+)
+
+func Test_DirSnapshotArchiver(t *testing.T) {
+	parent := t.TempDir()
+	a, err := NewDirSnapshotArchiver(filepath.Join(parent, "snapshots"), 2)
+	if err != nil {
+		t.Fatalf("failed to create archiver: %s", err.Error())
+	}
+
+	for _, m := range []*raft.SnapshotMeta{
+		{ID: "2-10-1000", Term: 2, Index: 10},
+		{ID: "2-9-900", Term: 2, Index: 9},
+		{ID: "3-11-1100", Term: 3, Index: 11},
+	} {
+		m.Version = raft.SnapshotVersionMax
+		if err := a.Archive(m, bytes.NewReader([]byte(m.ID))); err != nil {
+			t.Fatalf("failed to archive snapshot %s: %s", m.ID, err.Error())
+		}
+	}
+
+	metas, err := a.List()
+	if err != nil {
+		t.Fatalf("failed to list archived snapshots: %s", err.Error())
+	}
+	if len(metas) != 2 || metas[0].ID != "2-10-1000" || metas[1].ID != "3-11-1100" {
+		t.Fatalf("wrong archived snapshots retained: %v", metas)
+	}
+
+	// The archive must be readable by the Raft file snapshot store.
+	fss, err := raft.NewFileSnapshotStore(parent, 2, io.Discard)
+	if err != nil {
+		t.Fatalf("failed to create file snapshot store: %s", err.Error())
+	}
+	meta, rc, err := fss.Open("3-11-1100")
+	if err != nil {
+		t.Fatalf("failed to open archived snapshot: %s", err.Error())
+	}
+	defer rc.Close()
+	b, err := io.ReadAll(rc)
+	if err != nil {
+		t.Fatalf("failed to read archived snapshot: %s", err.Error())
+	}
+	if string(b) != "3-11-1100" || meta.Size != int64(len(b)) || meta.Index != 11 {
+		t.Fatalf("wrong archived snapshot, meta %v, contents %s", meta, b)
+	}
+}
@@ -0,0 +1,148 @@
+package store
+
+import (
+	"errors"
+
+	"github.com/hashicorp/raft"
+	"github.com/rqlite/rqlite/command"
+	"google.golang.org/protobuf/proto"
+)
+
+var (
+	// ErrCARotationInProgress is returned when a CA rotation is requested
+	// while another is in progress.
+	ErrCARotationInProgress = errors.New("CA rotation already in progress")
+
+	// ErrNoCARotation is returned when a CA rotation must be in progress,
+	// but is not.
+	ErrNoCARotation = errors.New("no CA rotation in progress")
+)
+
+// BeginCARotation begins rotation of the CA used for node-to-node encryption
+// to the PEM-encoded CA certificate ca. Once the request is applied every node
+// trusts both the CA it currently trusts, and the new CA.
+func (s *Store) BeginCARotation(ca []byte) error {
+	return s.rotateCA(&command.CARotationRequest{
+		Action: command.CARotationRequest_ACTION_BEGIN,
+		Ca:     ca,
+	})
+}
+
+// RetireCA completes the CA rotation in progress. Once the request is applied
+// every node trusts only the new CA.
+func (s *Store) RetireCA() error {
+	return s.rotateCA(&command.CARotationRequest{
+		Action: command.CARotationRequest_ACTION_RETIRE,
+	})
+}
+
+// CancelCARotation cancels the CA rotation in progress. Once the request is
+// applied every node trusts only the CA it trusted before the rotation began.
+func (s *Store) CancelCARotation() error {
+	return s.rotateCA(&command.CARotationRequest{
+		Action: command.CARotationRequest_ACTION_CANCEL,
+	})
+}
+
+// CARotation returns the state of the rotation of the CA used for node-to-node
+// encryption. The returned value must not be modified.
+func (s *Store) CARotation() *command.CARotation {
+	s.caRotationMu.RLock()
+	defer s.caRotationMu.RUnlock()
+	return s.caRotation
+}
+
+func (s *Store) rotateCA(cr *command.CARotationRequest) error {
+	b, err := proto.Marshal(cr)
+	if err != nil {
+		return err
+	}
+	b, err = command.Marshal(&command.Command{
+		Type:       command.Command_COMMAND_TYPE_CA_ROTATION,
+		SubCommand: b,
+	})
+	if err != nil {
+		return err
+	}
+
+	af := s.raft.Apply(b, s.ApplyTimeout)
+	if af.Error() != nil {
+		if af.Error() == raft.ErrNotLeader {
+			return ErrNotLeader
+		}
+		return af.Error()
+	}
+	r := af.Response().(*fsmGenericResponse)
+	return r.error
+}
+
+// applyCARotation applies a CA rotation request to the FSM.
+func (s *Store) applyCARotation(cr *command.CARotationRequest) *fsmGenericResponse {
+	s.caRotationMu.Lock()
+	r, err := nextCARotation(s.caRotation, cr)
+	if err == nil {
+		s.caRotation = r
+	}
+	s.caRotationMu.Unlock()
+	if err != nil {
+		return &fsmGenericResponse{error: err}
+	}
+	s.notifyCARotation(r)
+	return &fsmGenericResponse{}
+}
+
+// setCARotation sets the state of CA rotation, as restored from a snapshot.
+func (s *Store) setCARotation(r *command.CARotation) {
+	s.caRotationMu.Lock()
+	s.caRotation = r
+	s.caRotationMu.Unlock()
+	s.notifyCARotation(r)
+}
+
+func (s *Store) notifyCARotation(r *command.CARotation) {
+	if s.CARotationFunc != nil {
+		s.CARotationFunc(r)
+	}
+}
+
+// nextCARotation returns the state of CA rotation which results from applying
+// cr to cur. A nil state means no CA has ever been rotated.
+func nextCARotation(cur *command.CARotation, cr *command.CARotationRequest) (*command.CARotation, error) {
+	phase := cur.GetPhase()
+	switch cr.Action {
+	case command.CARotationRequest_ACTION_BEGIN:
+		if phase == command.CARotation_PHASE_TRANSITION {
+			return nil, ErrCARotationInProgress
+		}
+		if len(cr.Ca) == 0 {
+			return nil, errors.New("CA certificate required")
+		}
+		// The CA in use after a completed rotation is retired by the next.
+		return &command.CARotation{
+			Phase:      command.CARotation_PHASE_TRANSITION,
+			Ca:         cr.Ca,
+			RetiringCa: cur.GetCa(),
+		}, nil
+	case command.CARotationRequest_ACTION_RETIRE:
+		if phase != command.CARotation_PHASE_TRANSITION {
+			return nil, ErrNoCARotation
+		}
+		return &command.CARotation{
+			Phase: command.CARotation_PHASE_COMPLETE,
+			Ca:    cur.Ca,
+		}, nil
+	case command.CARotationRequest_ACTION_CANCEL:
+		if phase != command.CARotation_PHASE_TRANSITION {
+			return nil, ErrNoCARotation
+		}
+		if len(cur.RetiringCa) == 0 {
+			return &command.CARotation{Phase: command.CARotation_PHASE_NONE}, nil
+		}
+		return &command.CARotation{
+			Phase: command.CARotation_PHASE_COMPLETE,
+			Ca:    cur.RetiringCa,
+		}, nil
+	default:
+		return nil, errors.New("unknown CA rotation action")
+	}
+}
@@ -0,0 +1,149 @@
+package store
+
+import (
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/rqlite/rqlite/command"
+)
+
+func Test_NextCARotation(t *testing.T) {
+	begin := func(ca string) *command.CARotationRequest {
+		return &command.CARotationRequest{Action: command.CARotationRequest_ACTION_BEGIN, Ca: []byte(ca)}
+	}
+	retire := &command.CARotationRequest{Action: command.CARotationRequest_ACTION_RETIRE}
+	cancel := &command.CARotationRequest{Action: command.CARotationRequest_ACTION_CANCEL}
+
+	mustNext := func(cur *command.CARotation, cr *command.CARotationRequest) *command.CARotation {
+		r, err := nextCARotation(cur, cr)
+		if err != nil {
+			t.Fatalf("failed to apply %s: %s", cr.Action, err.Error())
+		}
+		return r
+	}
+
+	// No rotation in progress.
+	if _, err := nextCARotation(nil, retire); err != ErrNoCARotation {
+		t.Fatalf("wrong error retiring without rotation: %v", err)
+	}
+	if _, err := nextCARotation(nil, cancel); err != ErrNoCARotation {
+		t.Fatalf("wrong error cancelling without rotation: %v", err)
+	}
+	if _, err := nextCARotation(nil, begin("")); err == nil {
+		t.Fatalf("began rotation without CA")
+	}
+
+	// First rotation retires the configured CA.
+	r := mustNext(nil, begin("ca1"))
+	if r.Phase != command.CARotation_PHASE_TRANSITION || string(r.Ca) != "ca1" || r.RetiringCa != nil {
+		t.Fatalf("wrong state after begin: %v", r)
+	}
+	if _, err := nextCARotation(r, begin("ca2")); err != ErrCARotationInProgress {
+		t.Fatalf("wrong error beginning rotation during rotation: %v", err)
+	}
+	if c := mustNext(r, cancel); c.Phase != command.CARotation_PHASE_NONE || c.Ca != nil {
+		t.Fatalf("wrong state after cancel: %v", c)
+	}
+	r = mustNext(r, retire)
+	if r.Phase != command.CARotation_PHASE_COMPLETE || string(r.Ca) != "ca1" {
+		t.Fatalf("wrong state after retire: %v", r)
+	}
+
+	// Later rotations retire the CA of the previous rotation.
+	r = mustNext(r, begin("ca2"))
+	if r.Phase != command.CARotation_PHASE_TRANSITION || string(r.Ca) != "ca2" || string(r.RetiringCa) != "ca1" {
+		t.Fatalf("wrong state after second begin: %v", r)
+	}
+	if c := mustNext(r, cancel); c.Phase != command.CARotation_PHASE_COMPLETE || string(c.Ca) != "ca1" {
+		t.Fatalf("wrong state after second cancel: %v", c)
+	}
+}
+
+func Test_SingleNodeCARotation(t *testing.T) {
+	s, ln := mustNewStore(t, true)
+	defer ln.Close()
+
+	var mu sync.Mutex
+	var notified []*command.CARotation
+	s.CARotationFunc = func(r *command.CARotation) {
+		mu.Lock()
+		defer mu.Unlock()
+		notified = append(notified, r)
+	}
+
+	if err := s.Open(); err != nil {
+		t.Fatalf("failed to open single-node store: %s", err.Error())
+	}
+	defer s.Close(true)
+	if err := s.Bootstrap(NewServer(s.ID(), s.Addr(), true)); err != nil {
+		t.Fatalf("failed to bootstrap single-node store: %s", err.Error())
+	}
+	if _, err := s.WaitForLeader(10 * time.Second); err != nil {
+		t.Fatalf("Error waiting for leader: %s", err)
+	}
+
+	if err := s.RetireCA(); err != ErrNoCARotation {
+		t.Fatalf("wrong error retiring CA without rotation: %v", err)
+	}
+	if err := s.BeginCARotation([]byte("ca1")); err != nil {
+		t.Fatalf("failed to begin CA rotation: %s", err.Error())
+	}
+	if err := s.BeginCARotation([]byte("ca2")); err != ErrCARotationInProgress {
+		t.Fatalf("wrong error beginning second CA rotation: %v", err)
+	}
+	if r := s.CARotation(); r.Phase != command.CARotation_PHASE_TRANSITION || string(r.Ca) != "ca1" {
+		t.Fatalf("wrong CA rotation state: %v", r)
+	}
+	stats, err := s.Stats()
+	if err != nil {
+		t.Fatalf("failed to get stats: %s", err.Error())
+	}
+	if exp, got := "PHASE_TRANSITION", stats["ca_rotation"]; exp != got {
+		t.Fatalf("wrong CA rotation stat, exp %s, got %v", exp, got)
+	}
+
+	// The state of CA rotation must survive snapshotting.
+	f, err := s.Snapshot()
+	if err != nil {
+		t.Fatalf("failed to snapshot node: %s", err.Error())
+	}
+	snapFile, err := os.Create(filepath.Join(t.TempDir(), "snapshot"))
+	if err != nil {
+		t.Fatalf("failed to create snapshot file: %s", err.Error())
+	}
+	defer snapFile.Close()
+	if err := f.Persist(&mockSnapshotSink{snapFile}); err != nil {
+		t.Fatalf("failed to persist snapshot to disk: %s", err.Error())
+	}
+
+	if err := s.RetireCA(); err != nil {
+		t.Fatalf("failed to retire CA: %s", err.Error())
+	}
+	if r := s.CARotation(); r.Phase != command.CARotation_PHASE_COMPLETE || string(r.Ca) != "ca1" {
+		t.Fatalf("wrong CA rotation state: %v", r)
+	}
+
+	snapFile, err = os.Open(snapFile.Name())
+	if err != nil {
+		t.Fatalf("failed to open snapshot file: %s", err.Error())
+	}
+	defer snapFile.Close()
+	if err := s.Restore(snapFile); err != nil {
+		t.Fatalf("failed to restore snapshot from disk: %s", err.Error())
+	}
+	if r := s.CARotation(); r.Phase != command.CARotation_PHASE_TRANSITION || string(r.Ca) != "ca1" {
+		t.Fatalf("wrong CA rotation state after restore: %v", r)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	if len(notified) != 3 {
+		t.Fatalf("wrong number of CA rotation notifications, exp 3, got %d", len(notified))
+	}
+	if notified[2].Phase != command.CARotation_PHASE_TRANSITION {
+		t.Fatalf("wrong CA rotation notified after restore: %v", notified[2])
+	}
+}
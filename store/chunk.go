@@ -0,0 +1,117 @@
+package store
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/rqlite/rqlite/command"
+	"google.golang.org/protobuf/proto"
+)
+
+// chunkOverhead is the space reserved in each chunk for everything but its
+// statements.
+const chunkOverhead = 256
+
+var (
+	// ErrStatementTooLarge is returned when a single statement is larger
+	// than the maximum size of a Raft log entry.
+	ErrStatementTooLarge = errors.New("statement exceeds maximum Raft entry size")
+
+	// ErrChunkedRequestPending is returned when a snapshot is requested
+	// while a chunked request is partially applied.
+	ErrChunkedRequestPending = errors.New("chunked request pending")
+)
+
+// chunkStatements splits stmts into groups, each of which may be written to a
+// Raft log entry of at most maxSize bytes.
+func chunkStatements(stmts []*command.Statement, maxSize int) ([][]*command.Statement, error) {
+	limit := maxSize - chunkOverhead
+	var chunks [][]*command.Statement
+	var chunk []*command.Statement
+	sz := 0
+	for _, stmt := range stmts {
+		// Allow for the tag and length prefix of each statement.
+		n := proto.Size(stmt) + 16
+		if n > limit {
+			return nil, ErrStatementTooLarge
+		}
+		if sz+n > limit {
+			chunks = append(chunks, chunk)
+			chunk, sz = nil, 0
+		}
+		chunk = append(chunk, stmt)
+		sz += n
+	}
+	if len(chunk) > 0 {
+		chunks = append(chunks, chunk)
+	}
+	return chunks, nil
+}
+
+// chunkBuffer accumulates the chunks of an execute request which was too
+// large to be written to a single Raft log entry. No statement is executed
+// until the final chunk has been applied, so the request is applied to the
+// database as a whole, exactly as if it had been written to a single entry.
+//
+// At most one chunked request is in progress at any time, since the Leader
+// serializes them. A partial request is discarded if it is aborted, if a new
+// chunked request starts, or if the Raft term changes, as a new Leader will
+// never complete it.
+type chunkBuffer struct {
+	id      string
+	term    uint64
+	nextSeq uint64
+	req     *command.ExecuteRequest
+}
+
+// pending returns whether a chunked request is partially applied.
+func (c *chunkBuffer) pending() bool {
+	return c.req != nil
+}
+
+func (c *chunkBuffer) reset() {
+	*c = chunkBuffer{}
+}
+
+// expire discards any partial request started in a term earlier than term.
+func (c *chunkBuffer) expire(term uint64) {
+	if c.pending() && term > c.term {
+		c.reset()
+	}
+}
+
+// add adds a chunk, applied at the given term, to the buffer. If the chunk is
+// the final chunk of its request, the complete request is returned.
+func (c *chunkBuffer) add(term uint64, ch *command.ExecuteChunk) (*command.ExecuteRequest, error) {
+	if ch.Abort {
+		if ch.Id == c.id {
+			c.reset()
+		}
+		return nil, nil
+	}
+
+	if ch.Seq == 0 {
+		c.reset()
+		c.id = ch.Id
+		c.term = term
+		c.req = &command.ExecuteRequest{
+			Request: &command.Request{
+				Transaction: ch.GetRequest().GetTransaction(),
+				Partial:     ch.GetRequest().GetPartial(),
+			},
+			Timings: ch.Timings,
+		}
+	} else if !c.pending() || ch.Id != c.id || ch.Seq != c.nextSeq {
+		c.reset()
+		return nil, fmt.Errorf("chunk %d of request %s out of sequence", ch.Seq, ch.Id)
+	}
+
+	c.req.Request.Statements = append(c.req.Request.Statements, ch.GetRequest().GetStatements()...)
+	c.nextSeq = ch.Seq + 1
+	if !ch.Final {
+		return nil, nil
+	}
+	req := c.req
+	c.reset()
+	return req, nil
+}
@@ -0,0 +1,100 @@
+package store
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/rqlite/rqlite/command"
+)
+
+func Test_ChunkStatements(t *testing.T) {
+	var stmts []*command.Statement
+	for i := 0; i < 100; i++ {
+		stmts = append(stmts, &command.Statement{Sql: strings.Repeat("x", 100)})
+	}
+	chunks, err := chunkStatements(stmts, 1024)
+	if err != nil {
+		t.Fatalf("failed to chunk statements: %s", err.Error())
+	}
+	if len(chunks) < 2 {
+		t.Fatalf("statements not chunked, got %d chunks", len(chunks))
+	}
+	n := 0
+	for _, c := range chunks {
+		n += len(c)
+	}
+	if n != len(stmts) {
+		t.Fatalf("wrong number of chunked statements, exp %d, got %d", len(stmts), n)
+	}
+
+	_, err = chunkStatements([]*command.Statement{{Sql: strings.Repeat("x", 2048)}}, 1024)
+	if err != ErrStatementTooLarge {
+		t.Fatalf("wrong error for oversized statement, got %v", err)
+	}
+}
+
+func Test_ChunkBuffer(t *testing.T) {
+	chunk := func(id string, seq uint64, final bool, sql string) *command.ExecuteChunk {
+		return &command.ExecuteChunk{
+			Id:    id,
+			Seq:   seq,
+			Final: final,
+			Request: &command.Request{
+				Transaction: true,
+				Statements:  []*command.Statement{{Sql: sql}},
+			},
+		}
+	}
+
+	var c chunkBuffer
+	if er, err := c.add(1, chunk("a", 0, false, "s0")); er != nil || err != nil {
+		t.Fatalf("unexpected result for first chunk: %v %v", er, err)
+	}
+	if !c.pending() {
+		t.Fatalf("chunked request not pending")
+	}
+	er, err := c.add(1, chunk("a", 1, true, "s1"))
+	if err != nil || er == nil {
+		t.Fatalf("unexpected result for final chunk: %v %v", er, err)
+	}
+	if !er.Request.Transaction || len(er.Request.Statements) != 2 || er.Request.Statements[1].Sql != "s1" {
+		t.Fatalf("wrong request assembled: %v", er)
+	}
+	if c.pending() {
+		t.Fatalf("chunked request pending after final chunk")
+	}
+
+	// Out of sequence.
+	c.add(1, chunk("a", 0, false, "s0"))
+	if _, err := c.add(1, chunk("a", 2, true, "s2")); err == nil {
+		t.Fatalf("out of sequence chunk accepted")
+	}
+	if c.pending() {
+		t.Fatalf("chunked request pending after out of sequence chunk")
+	}
+
+	// Abort.
+	c.add(1, chunk("a", 0, false, "s0"))
+	c.add(1, &command.ExecuteChunk{Id: "a", Abort: true})
+	if c.pending() {
+		t.Fatalf("chunked request pending after abort")
+	}
+
+	// New request replaces a partial one.
+	c.add(1, chunk("a", 0, false, "s0"))
+	c.add(1, chunk("b", 0, false, "t0"))
+	if er, err := c.add(1, chunk("b", 1, true, "t1")); err != nil || len(er.Request.Statements) != 2 {
+		t.Fatalf("wrong result for replacing request: %v %v", er, err)
+	}
+
+	// Term change discards a partial request.
+	c.add(1, chunk("a", 0, false, "s0"))
+	c.expire(1)
+	if !c.pending() {
+		t.Fatalf("chunked request expired in same term")
+	}
+	c.expire(2)
+	if c.pending() {
+		t.Fatalf("chunked request not expired by new term")
+	}
+}
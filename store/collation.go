@@ -0,0 +1,98 @@
+package store
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/rqlite/rqlite/command"
+	sql "github.com/rqlite/rqlite/db"
+)
+
+var (
+	// ErrCollationMissing is returned when a node joining the cluster lacks a
+	// collation registered with the Leader.
+	ErrCollationMissing = errors.New("joining node lacks collation")
+
+	// ErrICUMismatch is returned when a node joining the cluster does not
+	// match the Leader in whether it supports ICU.
+	ErrICUMismatch = errors.New("joining node does not match the Leader in ICU support")
+
+	// ErrCollationLoad is returned when a write calls icu_load_collation().
+	ErrCollationLoad = errors.New("icu_load_collation() may not be used, as the collation is registered with a single connection")
+)
+
+// checkCollations returns ErrCollationMissing if a joining node, reporting
+// the given collations, lacks any collation registered with this node. Such
+// a node would fail to apply DDL naming the collation, or would order, and
+// index, data differently. Nodes of earlier versions of rqlite report no
+// collations, and are checked only against the collations of the schema.
+func (s *Store) checkCollations(collations []string) error {
+	required := sql.Collations()
+	if len(collations) == 0 {
+		var err error
+		if required, err = s.schemaCollations(); err != nil {
+			return err
+		}
+	}
+
+	has := make(map[string]bool, len(collations))
+	for _, c := range collations {
+		has[strings.ToUpper(c)] = true
+	}
+	var missing []string
+	for _, c := range required {
+		if !has[c] {
+			missing = append(missing, c)
+		}
+	}
+	if len(missing) == 0 {
+		return nil
+	}
+	return fmt.Errorf("%w: %s", ErrCollationMissing, strings.Join(missing, ", "))
+}
+
+// schemaCollations returns the collations named by the schema, other than
+// those built into SQLite.
+func (s *Store) schemaCollations() ([]string, error) {
+	rows, err := s.db.QueryStringStmt(`SELECT sql FROM sqlite_master WHERE sql IS NOT NULL`)
+	if err != nil {
+		return nil, err
+	}
+	if len(rows) != 1 {
+		return nil, fmt.Errorf("unexpected number of results querying schema: %d", len(rows))
+	}
+	if rows[0].Error != "" {
+		return nil, errors.New(rows[0].Error)
+	}
+	var stmts []string
+	for _, v := range rows[0].Values {
+		stmts = append(stmts, v.GetParameters()[0].GetS())
+	}
+	return command.Collations(strings.Join(stmts, ";\n")), nil
+}
+
+// checkICU returns ErrICUMismatch unless the joining node, reporting whether
+// it supports ICU, matches this node. With ICU, upper(), lower(), LIKE, and
+// REGEXP treat text beyond ASCII differently, so nodes which differ would
+// apply the same writes differently. Nodes of earlier versions of rqlite
+// report no ICU support.
+func (s *Store) checkICU(icu bool) error {
+	if icu == sql.ICUSupported {
+		return nil
+	}
+	if sql.ICUSupported {
+		return fmt.Errorf("%w: Leader has ICU, joining node does not", ErrICUMismatch)
+	}
+	return fmt.Errorf("%w: joining node has ICU, Leader does not", ErrICUMismatch)
+}
+
+// checkCollationLoads returns ErrCollationLoad if any of the statements calls
+// icu_load_collation(). The collation would be lost as each node reopens its
+// connections, or restores from a snapshot, so any DDL naming it would fail.
+func (s *Store) checkCollationLoads(stmts []*command.Statement) error {
+	if command.LoadsCollation(stmts) {
+		return ErrCollationLoad
+	}
+	return nil
+}
@@ -0,0 +1,84 @@
+package store
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/rqlite/rqlite/command"
+	sql "github.com/rqlite/rqlite/db"
+)
+
+func Test_SingleNodeJoinCollations(t *testing.T) {
+	s, ln := mustNewStore(t, true)
+	defer ln.Close()
+	if err := s.Open(); err != nil {
+		t.Fatalf("failed to open single-node store: %s", err.Error())
+	}
+	if err := s.Bootstrap(NewServer(s.ID(), s.Addr(), true)); err != nil {
+		t.Fatalf("failed to bootstrap single-node store: %s", err.Error())
+	}
+	defer s.Close(true)
+	if _, err := s.WaitForLeader(10 * time.Second); err != nil {
+		t.Fatalf("Error waiting for leader: %s", err)
+	}
+
+	// A node lacking any collation registered with the Leader may not join.
+	jr := &command.JoinRequest{Id: "id1", Address: "localhost:4002", Voter: true, Collations: []string{"UNICODE"}, Icu: sql.ICUSupported}
+	if err := s.Join(jr); !errors.Is(err, ErrCollationMissing) {
+		t.Fatalf("wrong error joining node lacking collations: %v", err)
+	}
+	if exp, got := "joining node lacks collation: UNICODE_CI, UNICODE_CI_AI", s.Join(jr).Error(); exp != got {
+		t.Fatalf("wrong error, exp %s, got %s", exp, got)
+	}
+
+	// A node reporting no collations, of an earlier version, may join unless
+	// the schema names a collation.
+	if err := s.checkCollations(nil); err != nil {
+		t.Fatalf("node reporting no collations refused with empty schema: %s", err.Error())
+	}
+	if _, err := s.Execute(executeRequestFromString(`CREATE TABLE foo (id INTEGER NOT NULL PRIMARY KEY, name TEXT COLLATE unicode_ci)`, false, false)); err != nil {
+		t.Fatalf("failed to execute on single node: %s", err.Error())
+	}
+	if err := s.checkCollations(nil); !errors.Is(err, ErrCollationMissing) {
+		t.Fatalf("wrong error for node reporting no collations: %v", err)
+	}
+
+	// Nor may a node which differs from the Leader in ICU support.
+	jr.Collations = sql.Collations()
+	jr.Icu = !sql.ICUSupported
+	if err := s.Join(jr); !errors.Is(err, ErrICUMismatch) {
+		t.Fatalf("wrong error joining node differing in ICU support: %v", err)
+	}
+
+	jr.Icu = sql.ICUSupported
+	if err := s.Join(jr); err != nil {
+		t.Fatalf("failed to join node with every collation: %s", err.Error())
+	}
+}
+
+func Test_SingleNodeCollationLoad(t *testing.T) {
+	s, ln := mustNewStore(t, true)
+	defer ln.Close()
+	if err := s.Open(); err != nil {
+		t.Fatalf("failed to open single-node store: %s", err.Error())
+	}
+	if err := s.Bootstrap(NewServer(s.ID(), s.Addr(), true)); err != nil {
+		t.Fatalf("failed to bootstrap single-node store: %s", err.Error())
+	}
+	defer s.Close(true)
+	if _, err := s.WaitForLeader(10 * time.Second); err != nil {
+		t.Fatalf("Error waiting for leader: %s", err)
+	}
+
+	load := `SELECT icu_load_collation('de_DE', 'german')`
+	if _, err := s.Execute(executeRequestFromString(load, false, false)); !errors.Is(err, ErrCollationLoad) {
+		t.Fatalf("collation load not rejected by execute: %v", err)
+	}
+	if _, err := s.Request(executeQueryRequestFromString(load, command.QueryRequest_QUERY_REQUEST_LEVEL_WEAK, false, false)); !errors.Is(err, ErrCollationLoad) {
+		t.Fatalf("collation load not rejected by request: %v", err)
+	}
+	if _, err := s.DryRun(executeRequestFromString(load, false, false)); !errors.Is(err, ErrCollationLoad) {
+		t.Fatalf("collation load not rejected by dry run: %v", err)
+	}
+}
@@ -0,0 +1,82 @@
+package store
+
+import (
+	"time"
+
+	sql "github.com/rqlite/rqlite/db"
+)
+
+const defaultDBSizeInterval = time.Minute
+
+// DBSize is the size of the database, and of each of its tables, as
+// measured at a point in time.
+type DBSize struct {
+	*sql.SizeStats
+	MeasuredAt time.Time `json:"measured_at"`
+}
+
+// DBSize returns the size of the database, and of each of its tables, as
+// last measured. The size is measured every DBSizeInterval, as measuring it
+// reads every table in full.
+func (s *Store) DBSize() (*DBSize, error) {
+	if !s.open {
+		return nil, ErrNotOpen
+	}
+	if s.DBSizeInterval == 0 {
+		return s.updateDBSize()
+	}
+
+	s.dbSizeMu.RLock()
+	sz := s.dbSize
+	s.dbSizeMu.RUnlock()
+	if sz != nil {
+		return sz, nil
+	}
+	// Not yet measured, so measure it now.
+	return s.updateDBSize()
+}
+
+// updateDBSize measures the size of the database, recording it for DBSize.
+func (s *Store) updateDBSize() (*DBSize, error) {
+	s.queryTxMu.RLock()
+	ss, err := s.db.SizeStats()
+	s.queryTxMu.RUnlock()
+	if err != nil {
+		return nil, err
+	}
+	stats.Add(numDBSizeMeasurements, 1)
+
+	sz := &DBSize{SizeStats: ss, MeasuredAt: time.Now()}
+	s.dbSizeMu.Lock()
+	s.dbSize = sz
+	s.dbSizeMu.Unlock()
+	return sz, nil
+}
+
+// measureDBSize measures the size of the database every DBSizeInterval,
+// until closeCh is closed.
+func (s *Store) measureDBSize() (closeCh, doneCh chan struct{}) {
+	closeCh = make(chan struct{})
+	doneCh = make(chan struct{})
+	if s.DBSizeInterval == 0 {
+		close(doneCh)
+		return closeCh, doneCh
+	}
+
+	go func() {
+		defer close(doneCh)
+		tck := time.NewTicker(s.DBSizeInterval)
+		defer tck.Stop()
+		for {
+			select {
+			case <-tck.C:
+				if _, err := s.updateDBSize(); err != nil {
+					s.logger.Printf("failed to measure database size: %s", err.Error())
+				}
+			case <-closeCh:
+				return
+			}
+		}
+	}()
+	return closeCh, doneCh
+}
@@ -0,0 +1,51 @@
+package store
+
+import (
+	"testing"
+	"time"
+)
+
+func Test_SingleNodeDBSize(t *testing.T) {
+	s, ln := mustNewStore(t, true)
+	defer ln.Close()
+	s.DBSizeInterval = 100 * time.Millisecond
+
+	if err := s.Open(); err != nil {
+		t.Fatalf("failed to open single-node store: %s", err.Error())
+	}
+	defer s.Close(true)
+	if err := s.Bootstrap(NewServer(s.ID(), s.Addr(), true)); err != nil {
+		t.Fatalf("failed to bootstrap single-node store: %s", err.Error())
+	}
+	if _, err := s.WaitForLeader(10 * time.Second); err != nil {
+		t.Fatalf("Error waiting for leader: %s", err)
+	}
+
+	for _, stmt := range []string{
+		`CREATE TABLE foo (id INTEGER NOT NULL PRIMARY KEY, name TEXT)`,
+		`INSERT INTO foo(id, name) VALUES(1, "fiona")`,
+	} {
+		if _, err := s.Execute(executeRequestFromString(stmt, false, false)); err != nil {
+			t.Fatalf("failed to execute %s: %s", stmt, err.Error())
+		}
+	}
+
+	// The size is measured periodically, so eventually reflects the writes.
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		sz, err := s.DBSize()
+		if err != nil {
+			t.Fatalf("failed to get database size: %s", err.Error())
+		}
+		if len(sz.Tables) == 1 && sz.Tables[0].Name == "foo" && sz.Tables[0].Rows == 1 {
+			if sz.Size == 0 || sz.MeasuredAt.IsZero() {
+				t.Fatalf("wrong database size: %+v", sz)
+			}
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("database size not updated: %+v", sz.SizeStats)
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+}
@@ -0,0 +1,272 @@
+package store
+
+import (
+	"expvar"
+	"os"
+	"runtime"
+	"sync"
+	"time"
+
+	"github.com/hashicorp/raft"
+	rlog "github.com/rqlite/rqlite/log"
+)
+
+// Subsystems whose writes to disk are accounted.
+const (
+	diskIORaftLog  = "raft_log"
+	diskIOSQLite   = "sqlite"
+	diskIOSnapshot = "snapshot"
+	diskIOBackup   = "backup"
+)
+
+const diskIOSampleInterval = 10 * time.Second
+
+var diskIOSubsystems = []string{diskIORaftLog, diskIOSQLite, diskIOSnapshot, diskIOBackup}
+
+// diskIOStats counts, for each subsystem, the bytes written to disk, and the
+// syncs which made those writes durable. A sync is counted for each commit
+// to the Raft log, each write transaction on an on-disk SQLite database, and
+// each snapshot and backup file, each of which requires at least one fsync.
+var diskIOStats *expvar.Map
+
+func init() {
+	diskIOStats = expvar.NewMap("disk_io")
+	resetDiskIOStats()
+}
+
+func resetDiskIOStats() {
+	diskIOStats.Init()
+	for _, ss := range diskIOSubsystems {
+		m := new(expvar.Map).Init()
+		m.Add("bytes_written", 0)
+		m.Add("syncs", 0)
+		diskIOStats.Set(ss, m)
+	}
+}
+
+// addDiskIO accounts n bytes written to disk by the subsystem ss, and syncs.
+func addDiskIO(ss string, n, syncs int64) {
+	m := diskIOStats.Get(ss).(*expvar.Map)
+	m.Add("bytes_written", n)
+	m.Add("syncs", syncs)
+}
+
+// diskIO returns the bytes written, and syncs, by the subsystem ss.
+func diskIO(ss string) (int64, int64) {
+	m := diskIOStats.Get(ss).(*expvar.Map)
+	return m.Get("bytes_written").(*expvar.Int).Value(), m.Get("syncs").(*expvar.Int).Value()
+}
+
+// diskIORate is the rate at which a subsystem wrote to disk, over the most
+// recent sample interval.
+type diskIORate struct {
+	BytesPerSec float64 `json:"bytes_per_sec"`
+	SyncsPerSec float64 `json:"syncs_per_sec"`
+}
+
+// diskIOSampler samples the disk I/O of each subsystem, to calculate rates.
+type diskIOSampler struct {
+	mu    sync.RWMutex
+	at    time.Time
+	bytes map[string]int64
+	syncs map[string]int64
+	rates map[string]diskIORate
+}
+
+func newDiskIOSampler() *diskIOSampler {
+	d := &diskIOSampler{rates: make(map[string]diskIORate)}
+	d.sample()
+	return d
+}
+
+// sample records the disk I/O of each subsystem, calculating the rate of
+// each since the last sample.
+func (d *diskIOSampler) sample() {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	now := time.Now()
+	bytes := make(map[string]int64, len(diskIOSubsystems))
+	syncs := make(map[string]int64, len(diskIOSubsystems))
+	for _, ss := range diskIOSubsystems {
+		bytes[ss], syncs[ss] = diskIO(ss)
+		if d.bytes != nil {
+			secs := now.Sub(d.at).Seconds()
+			d.rates[ss] = diskIORate{
+				BytesPerSec: float64(bytes[ss]-d.bytes[ss]) / secs,
+				SyncsPerSec: float64(syncs[ss]-d.syncs[ss]) / secs,
+			}
+		}
+	}
+	d.at, d.bytes, d.syncs = now, bytes, syncs
+}
+
+// Stats returns the total disk I/O of each subsystem, and its rate.
+func (d *diskIOSampler) Stats() map[string]interface{} {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	m := make(map[string]interface{}, len(diskIOSubsystems))
+	for _, ss := range diskIOSubsystems {
+		bytes, syncs := diskIO(ss)
+		m[ss] = map[string]interface{}{
+			"bytes_written": bytes,
+			"syncs":         syncs,
+			"bytes_per_sec": d.rates[ss].BytesPerSec,
+			"syncs_per_sec": d.rates[ss].SyncsPerSec,
+		}
+	}
+	return m
+}
+
+// sampleDiskIO samples the disk I/O of each subsystem every
+// diskIOSampleInterval, until closeCh is closed.
+func (s *Store) sampleDiskIO() (closeCh, doneCh chan struct{}) {
+	closeCh = make(chan struct{})
+	doneCh = make(chan struct{})
+	go func() {
+		defer close(doneCh)
+		tck := time.NewTicker(diskIOSampleInterval)
+		defer tck.Stop()
+		for {
+			select {
+			case <-tck.C:
+				s.diskIO.sample()
+			case <-closeCh:
+				return
+			}
+		}
+	}()
+	return closeCh, doneCh
+}
+
+// diskIOLogStore is the Raft log and stable store. It accounts the pages
+// written by each commit to the underlying BoltDB database.
+type diskIOLogStore struct {
+	*rlog.Log
+
+	mu        sync.Mutex
+	pageAlloc int64
+}
+
+func newDiskIOLogStore(l *rlog.Log) *diskIOLogStore {
+	return &diskIOLogStore{
+		Log:       l,
+		pageAlloc: pageAlloc(l),
+	}
+}
+
+// StoreLog implements the raft.LogStore interface.
+func (d *diskIOLogStore) StoreLog(l *raft.Log) error {
+	defer d.account()
+	return d.Log.StoreLog(l)
+}
+
+// StoreLogs implements the raft.LogStore interface.
+func (d *diskIOLogStore) StoreLogs(logs []*raft.Log) error {
+	defer d.account()
+	return d.Log.StoreLogs(logs)
+}
+
+// DeleteRange implements the raft.LogStore interface.
+func (d *diskIOLogStore) DeleteRange(min, max uint64) error {
+	defer d.account()
+	return d.Log.DeleteRange(min, max)
+}
+
+// Set implements the raft.StableStore interface.
+func (d *diskIOLogStore) Set(k, v []byte) error {
+	defer d.account()
+	return d.Log.Set(k, v)
+}
+
+// SetUint64 implements the raft.StableStore interface.
+func (d *diskIOLogStore) SetUint64(key []byte, val uint64) error {
+	defer d.account()
+	return d.Log.SetUint64(key, val)
+}
+
+// account accounts the pages allocated, and so written, by BoltDB since it
+// was last called, and a single commit.
+func (d *diskIOLogStore) account() {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	pa := pageAlloc(d.Log)
+	addDiskIO(diskIORaftLog, pa-d.pageAlloc, 1)
+	d.pageAlloc = pa
+}
+
+// pageAlloc returns the bytes allocated, over its lifetime, by write
+// transactions on the BoltDB database underlying l.
+func pageAlloc(l *rlog.Log) int64 {
+	st := l.Stats()
+	return st.TxStats.GetPageAlloc()
+}
+
+// diskIOSnapshotStore is a raft.SnapshotStore which accounts the bytes
+// written to each snapshot it creates.
+type diskIOSnapshotStore struct {
+	raft.SnapshotStore
+}
+
+// Create implements the raft.SnapshotStore interface.
+func (d *diskIOSnapshotStore) Create(version raft.SnapshotVersion, index, term uint64, configuration raft.Configuration,
+	configurationIndex uint64, trans raft.Transport) (raft.SnapshotSink, error) {
+	sink, err := d.SnapshotStore.Create(version, index, term, configuration, configurationIndex, trans)
+	if err != nil {
+		return nil, err
+	}
+	return &diskIOSnapshotSink{SnapshotSink: sink}, nil
+}
+
+// diskIOSnapshotSink is a raft.SnapshotSink which accounts the bytes written
+// to it, once it is closed.
+type diskIOSnapshotSink struct {
+	raft.SnapshotSink
+	n int64
+}
+
+// Write implements the io.Writer interface.
+func (d *diskIOSnapshotSink) Write(p []byte) (int, error) {
+	n, err := d.SnapshotSink.Write(p)
+	d.n += int64(n)
+	return n, err
+}
+
+// Close implements the raft.SnapshotSink interface.
+func (d *diskIOSnapshotSink) Close() error {
+	if err := d.SnapshotSink.Close(); err != nil {
+		return err
+	}
+	addDiskIO(diskIOSnapshot, d.n, 1)
+	return nil
+}
+
+// accountSQLiteWrites returns a function which, once called, accounts the
+// bytes written by this goroutine to an on-disk SQLite database since
+// accountSQLiteWrites was called. Until then the goroutine is locked to its
+// OS thread, so that the thread's write counter measures only its own writes.
+// Bytes written are only accounted where the operating system provides such
+// a counter.
+func (s *Store) accountSQLiteWrites() func() {
+	if s.db.InMemory() {
+		return func() {}
+	}
+	runtime.LockOSThread()
+	before, ok := threadBytesWritten()
+	return func() {
+		defer runtime.UnlockOSThread()
+		if !ok {
+			return
+		}
+		after, ok := threadBytesWritten()
+		if ok && after > before {
+			addDiskIO(diskIOSQLite, after-before, 1)
+		}
+	}
+}
+
+// accountBackup accounts the writing of the backup file at path.
+func accountBackup(path string) {
+	if fi, err := os.Stat(path); err == nil {
+		addDiskIO(diskIOBackup, fi.Size(), 1)
+	}
+}
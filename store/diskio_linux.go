@@ -0,0 +1,33 @@
+package store
+
+import (
+	"bufio"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// threadBytesWritten returns the number of bytes the calling OS thread has
+// passed to write system calls, as reported by the kernel. The caller must be
+// locked to its thread.
+func threadBytesWritten() (int64, bool) {
+	f, err := os.Open("/proc/thread-self/io")
+	if err != nil {
+		return 0, false
+	}
+	defer f.Close()
+
+	sc := bufio.NewScanner(f)
+	for sc.Scan() {
+		line := sc.Text()
+		if !strings.HasPrefix(line, "wchar:") {
+			continue
+		}
+		n, err := strconv.ParseInt(strings.TrimSpace(strings.TrimPrefix(line, "wchar:")), 10, 64)
+		if err != nil {
+			return 0, false
+		}
+		return n, true
+	}
+	return 0, false
+}
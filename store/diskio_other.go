@@ -0,0 +1,8 @@
+//go:build !linux
+
+package store
+
+// threadBytesWritten is unsupported on this platform.
+func threadBytesWritten() (int64, bool) {
+	return 0, false
+}
@@ -0,0 +1,117 @@
+package store
+
+import (
+	"io/ioutil"
+	"os"
+	"runtime"
+	"testing"
+	"time"
+)
+
+func Test_DiskIOSampler(t *testing.T) {
+	d := newDiskIOSampler()
+	time.Sleep(100 * time.Millisecond)
+	addDiskIO(diskIOBackup, 1000, 1)
+	d.sample()
+
+	m := d.Stats()[diskIOBackup].(map[string]interface{})
+	if m["bytes_written"].(int64) < 1000 {
+		t.Fatalf("backup bytes not accounted, got %d", m["bytes_written"])
+	}
+	if m["syncs"].(int64) < 1 {
+		t.Fatalf("backup syncs not accounted, got %d", m["syncs"])
+	}
+	if m["bytes_per_sec"].(float64) <= 0 {
+		t.Fatalf("backup write rate not calculated, got %f", m["bytes_per_sec"])
+	}
+	if m["syncs_per_sec"].(float64) <= 0 {
+		t.Fatalf("backup sync rate not calculated, got %f", m["syncs_per_sec"])
+	}
+}
+
+func Test_ThreadBytesWritten(t *testing.T) {
+	runtime.LockOSThread()
+	defer runtime.UnlockOSThread()
+	before, ok := threadBytesWritten()
+	if !ok {
+		t.Skip("per-thread write accounting not supported")
+	}
+	f, err := ioutil.TempFile("", "rqlite-diskio-")
+	if err != nil {
+		t.Fatalf("failed to create temp file: %s", err.Error())
+	}
+	defer os.Remove(f.Name())
+	defer f.Close()
+
+	if _, err := f.Write(make([]byte, 4096)); err != nil {
+		t.Fatalf("failed to write temp file: %s", err.Error())
+	}
+	if after, _ := threadBytesWritten(); after-before < 4096 {
+		t.Fatalf("write not counted, got %d bytes", after-before)
+	}
+}
+
+func Test_SingleNodeDiskIO(t *testing.T) {
+	s, ln := mustNewStore(t, false)
+	defer ln.Close()
+
+	if err := s.Open(); err != nil {
+		t.Fatalf("failed to open single-node store: %s", err.Error())
+	}
+	if err := s.Bootstrap(NewServer(s.ID(), s.Addr(), true)); err != nil {
+		t.Fatalf("failed to bootstrap single-node store: %s", err.Error())
+	}
+	defer s.Close(true)
+	if _, err := s.WaitForLeader(10 * time.Second); err != nil {
+		t.Fatalf("Error waiting for leader: %s", err)
+	}
+
+	raftBytes, raftSyncs := diskIO(diskIORaftLog)
+	snapBytes, snapSyncs := diskIO(diskIOSnapshot)
+	bkpBytes, bkpSyncs := diskIO(diskIOBackup)
+	sqliteBytes, _ := diskIO(diskIOSQLite)
+
+	er := executeRequestFromStrings([]string{
+		`CREATE TABLE foo (id INTEGER NOT NULL PRIMARY KEY, name TEXT)`,
+		`INSERT INTO foo(id, name) VALUES(1, "fiona")`,
+	}, false, false)
+	if _, err := s.Execute(er); err != nil {
+		t.Fatalf("failed to execute on single node: %s", err.Error())
+	}
+	if b, n := diskIO(diskIORaftLog); b <= raftBytes || n <= raftSyncs {
+		t.Fatalf("Raft log writes not accounted")
+	}
+	if _, ok := threadBytesWritten(); ok {
+		if b, _ := diskIO(diskIOSQLite); b <= sqliteBytes {
+			t.Fatalf("SQLite writes not accounted")
+		}
+	}
+
+	if err := s.raft.Snapshot().Error(); err != nil {
+		t.Fatalf("failed to snapshot: %s", err.Error())
+	}
+	if b, n := diskIO(diskIOSnapshot); b <= snapBytes || n <= snapSyncs {
+		t.Fatalf("snapshot writes not accounted")
+	}
+
+	f, err := ioutil.TempFile("", "rqlite-baktest-")
+	if err != nil {
+		t.Fatalf("Backup Failed: unable to create temp file, %s", err.Error())
+	}
+	defer os.Remove(f.Name())
+	defer f.Close()
+	if err := s.Backup(backupRequestBinary(true), f); err != nil {
+		t.Fatalf("Backup failed %s", err.Error())
+	}
+	if b, n := diskIO(diskIOBackup); b <= bkpBytes || n <= bkpSyncs {
+		t.Fatalf("backup writes not accounted")
+	}
+
+	status, err := s.Stats()
+	if err != nil {
+		t.Fatalf("failed to get store stats: %s", err.Error())
+	}
+	if _, ok := status["disk_io"].(map[string]interface{})[diskIOSQLite]; !ok {
+		t.Fatalf("SQLite disk I/O missing from stats")
+	}
+}
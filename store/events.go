@@ -0,0 +1,107 @@
+package store
+
+import (
+	"fmt"
+	"time"
+)
+
+// EventType is the type of storage operation an Event describes.
+type EventType string
+
+const (
+	// EventSnapshot is the creation and persisting of a Raft snapshot.
+	EventSnapshot EventType = "snapshot"
+
+	// EventSnapshotInstall is the installation of a Raft snapshot, either
+	// at startup or because one was received from the Leader.
+	EventSnapshotInstall EventType = "snapshot_install"
+
+	// EventLoad is the restoring of the database from a SQLite file.
+	EventLoad EventType = "load"
+
+	// EventBackup is the backing up of the database.
+	EventBackup EventType = "backup"
+)
+
+// EventPhase indicates whether an Event marks the start or finish of an
+// operation.
+type EventPhase string
+
+const (
+	// EventStart is emitted when an operation starts.
+	EventStart EventPhase = "start"
+
+	// EventFinish is emitted when an operation finishes, successfully or not.
+	EventFinish EventPhase = "finish"
+)
+
+// Event describes a storage operation performed by the Store.
+type Event struct {
+	Type  EventType  `json:"type"`
+	Phase EventPhase `json:"phase"`
+	Time  time.Time  `json:"time"`
+
+	// The following are only set for EventFinish events.
+	Duration time.Duration `json:"duration,omitempty"` // In nanoseconds.
+	Size     int64         `json:"size,omitempty"`     // In bytes, if known.
+	Error    string        `json:"error,omitempty"`
+}
+
+// String returns a string representation of the Event.
+func (e *Event) String() string {
+	if e.Phase == EventStart {
+		return fmt.Sprintf("%s started", e.Type)
+	}
+	if e.Error != "" {
+		return fmt.Sprintf("%s failed after %s: %s", e.Type, e.Duration, e.Error)
+	}
+	return fmt.Sprintf("%s finished in %s (%d bytes)", e.Type, e.Duration, e.Size)
+}
+
+// RegisterEventChannel registers the given channel which will receive an
+// Event each time a storage operation starts and finishes. Events are
+// dropped if the channel is not ready to receive.
+func (s *Store) RegisterEventChannel(c chan<- *Event) {
+	s.eventObserversMu.Lock()
+	defer s.eventObserversMu.Unlock()
+	s.eventObservers = append(s.eventObservers, c)
+}
+
+// startEvent emits a start Event of the given type, and returns a function
+// which must be called to emit the corresponding finish Event.
+func (s *Store) startEvent(t EventType) func(size int64, err error) {
+	startT := time.Now()
+	s.emitEvent(&Event{
+		Type:  t,
+		Phase: EventStart,
+		Time:  startT,
+	})
+
+	return func(size int64, err error) {
+		e := &Event{
+			Type:     t,
+			Phase:    EventFinish,
+			Time:     time.Now(),
+			Duration: time.Since(startT),
+			Size:     size,
+		}
+		if err != nil {
+			e.Error = err.Error()
+		}
+		s.logger.Print(e.String())
+		s.emitEvent(e)
+	}
+}
+
+func (s *Store) emitEvent(e *Event) {
+	stats.Add(eventsEmitted, 1)
+	s.eventObserversMu.RLock()
+	defer s.eventObserversMu.RUnlock()
+	for i := range s.eventObservers {
+		select {
+		case s.eventObservers[i] <- e:
+		default:
+			stats.Add(eventsDropped, 1)
+		}
+	}
+}
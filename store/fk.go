@@ -0,0 +1,76 @@
+package store
+
+import (
+	"github.com/hashicorp/raft"
+	"github.com/rqlite/rqlite/command"
+	"google.golang.org/protobuf/proto"
+)
+
+// SetForeignKeys enables or disables enforcement of foreign key constraints.
+// The setting is replicated, so once the request is applied every node
+// enforces the constraints, or does not, regardless of the setting it was
+// started with.
+func (s *Store) SetForeignKeys(enabled bool) error {
+	b, err := proto.Marshal(&command.ForeignKeys{Enabled: enabled})
+	if err != nil {
+		return err
+	}
+	b, err = command.Marshal(&command.Command{
+		Type:       command.Command_COMMAND_TYPE_FOREIGN_KEYS,
+		SubCommand: b,
+	})
+	if err != nil {
+		return err
+	}
+
+	af := s.raft.Apply(b, s.ApplyTimeout)
+	if af.Error() != nil {
+		if af.Error() == raft.ErrNotLeader {
+			return ErrNotLeader
+		}
+		return af.Error()
+	}
+	r := af.Response().(*fsmGenericResponse)
+	return r.error
+}
+
+// ForeignKeys returns whether foreign key constraints are enforced. Until a
+// setting is replicated, that is the setting the node was started with.
+func (s *Store) ForeignKeys() bool {
+	s.foreignKeysMu.RLock()
+	defer s.foreignKeysMu.RUnlock()
+	if s.foreignKeys != nil {
+		return s.foreignKeys.Enabled
+	}
+	return s.dbConf.FKConstraints
+}
+
+// foreignKeysState returns the replicated foreign key setting, nil if none
+// has been replicated. The returned value must not be modified.
+func (s *Store) foreignKeysState() *command.ForeignKeys {
+	s.foreignKeysMu.RLock()
+	defer s.foreignKeysMu.RUnlock()
+	return s.foreignKeys
+}
+
+// applyForeignKeys applies a foreign key setting to the FSM.
+func (s *Store) applyForeignKeys(fk *command.ForeignKeys) *fsmGenericResponse {
+	s.setForeignKeys(fk)
+
+	// Queries in a transaction must not be using the connections as they
+	// are replaced.
+	s.queryTxMu.Lock()
+	defer s.queryTxMu.Unlock()
+	if err := s.db.SetFKEnabled(fk.Enabled); err != nil {
+		return &fsmGenericResponse{error: err}
+	}
+	return &fsmGenericResponse{}
+}
+
+// setForeignKeys sets the replicated foreign key setting, as restored from a
+// snapshot.
+func (s *Store) setForeignKeys(fk *command.ForeignKeys) {
+	s.foreignKeysMu.Lock()
+	defer s.foreignKeysMu.Unlock()
+	s.foreignKeys = fk
+}
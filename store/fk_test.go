@@ -0,0 +1,93 @@
+package store
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func Test_SingleNodeForeignKeys(t *testing.T) {
+	s, ln := mustNewStore(t, true)
+	defer ln.Close()
+
+	if err := s.Open(); err != nil {
+		t.Fatalf("failed to open single-node store: %s", err.Error())
+	}
+	defer s.Close(true)
+	if err := s.Bootstrap(NewServer(s.ID(), s.Addr(), true)); err != nil {
+		t.Fatalf("failed to bootstrap single-node store: %s", err.Error())
+	}
+	if _, err := s.WaitForLeader(10 * time.Second); err != nil {
+		t.Fatalf("Error waiting for leader: %s", err)
+	}
+
+	// insert inserts a row referencing a missing row, returning whether the
+	// constraint was enforced.
+	insert := func(id int) bool {
+		stmt := fmt.Sprintf(`INSERT INTO bar(fooid) VALUES(%d)`, id)
+		r, err := s.Execute(executeRequestFromString(stmt, false, false))
+		if err != nil {
+			t.Fatalf("failed to insert record: %s", err.Error())
+		}
+		return r[0].Error == "FOREIGN KEY constraint failed"
+	}
+
+	if _, err := s.Execute(executeRequestFromStrings([]string{
+		`CREATE TABLE foo (id INTEGER NOT NULL PRIMARY KEY, name TEXT)`,
+		`CREATE TABLE bar (fooid INTEGER NOT NULL PRIMARY KEY, FOREIGN KEY(fooid) REFERENCES foo(id))`,
+	}, false, false)); err != nil {
+		t.Fatalf("failed to create tables: %s", err.Error())
+	}
+	if s.ForeignKeys() || insert(1) {
+		t.Fatalf("foreign key constraints enforced by default")
+	}
+
+	if err := s.SetForeignKeys(true); err != nil {
+		t.Fatalf("failed to enable foreign key constraints: %s", err.Error())
+	}
+	if !s.ForeignKeys() || !insert(2) {
+		t.Fatalf("foreign key constraints not enforced once enabled")
+	}
+	stats, err := s.Stats()
+	if err != nil {
+		t.Fatalf("failed to get stats: %s", err.Error())
+	}
+	if exp, got := true, stats["fk_constraints"]; exp != got {
+		t.Fatalf("wrong foreign keys stat, exp %v, got %v", exp, got)
+	}
+
+	// The setting must survive snapshotting.
+	f, err := s.Snapshot()
+	if err != nil {
+		t.Fatalf("failed to snapshot node: %s", err.Error())
+	}
+	snapFile, err := os.Create(filepath.Join(t.TempDir(), "snapshot"))
+	if err != nil {
+		t.Fatalf("failed to create snapshot file: %s", err.Error())
+	}
+	defer snapFile.Close()
+	if err := f.Persist(&mockSnapshotSink{snapFile}); err != nil {
+		t.Fatalf("failed to persist snapshot to disk: %s", err.Error())
+	}
+
+	if err := s.SetForeignKeys(false); err != nil {
+		t.Fatalf("failed to disable foreign key constraints: %s", err.Error())
+	}
+	if s.ForeignKeys() || insert(3) {
+		t.Fatalf("foreign key constraints enforced once disabled")
+	}
+
+	snapFile, err = os.Open(snapFile.Name())
+	if err != nil {
+		t.Fatalf("failed to open snapshot file: %s", err.Error())
+	}
+	defer snapFile.Close()
+	if err := s.Restore(snapFile); err != nil {
+		t.Fatalf("failed to restore snapshot from disk: %s", err.Error())
+	}
+	if !s.ForeignKeys() || !insert(4) {
+		t.Fatalf("foreign key constraints not enforced after restore")
+	}
+}
@@ -0,0 +1,113 @@
+package store
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/hashicorp/raft"
+)
+
+// identityFile is the file, within the data directory, holding the identity
+// of the node to which the directory belongs.
+const identityFile = "node-identity.json"
+
+var (
+	// ErrNodeIDInUse is returned when a node asks to join the cluster with the
+	// ID of another member which is still running at a different address.
+	ErrNodeIDInUse = errors.New("node ID is in use by another live node")
+)
+
+// Identity is the persisted identity of a node.
+type Identity struct {
+	ID        string    `json:"id"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// IdentityPath returns the path of the identity file in the data directory dir.
+func IdentityPath(dir string) string {
+	return filepath.Join(dir, identityFile)
+}
+
+// ReadIdentity returns the identity persisted in the data directory dir, or
+// nil if none has been.
+func ReadIdentity(dir string) (*Identity, error) {
+	b, err := os.ReadFile(IdentityPath(dir))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	var id Identity
+	if err := json.Unmarshal(b, &id); err != nil {
+		return nil, fmt.Errorf("invalid identity file: %s", err.Error())
+	}
+	if id.ID == "" {
+		return nil, errors.New("invalid identity file: no node ID")
+	}
+	return &id, nil
+}
+
+// WriteIdentity persists the node ID id in the data directory dir, creating
+// the directory if necessary. The file is readable only by its owner, and is
+// written in full, or not at all.
+func WriteIdentity(dir, id string) (*Identity, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+	ident := &Identity{ID: id, CreatedAt: time.Now().UTC()}
+	b, err := json.Marshal(ident)
+	if err != nil {
+		return nil, err
+	}
+
+	f, err := os.CreateTemp(dir, identityFile+".tmp")
+	if err != nil {
+		return nil, err
+	}
+	defer os.Remove(f.Name())
+	if err := f.Chmod(0600); err != nil {
+		f.Close()
+		return nil, err
+	}
+	if _, err := f.Write(b); err != nil {
+		f.Close()
+		return nil, err
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return nil, err
+	}
+	if err := f.Close(); err != nil {
+		return nil, err
+	}
+	if err := os.Rename(f.Name(), IdentityPath(dir)); err != nil {
+		return nil, err
+	}
+	return ident, nil
+}
+
+// checkNodeIDInUse returns ErrNodeIDInUse if srv, a member with the ID of a
+// node asking to join from addr, is still running at its own address. Such a
+// node is either misconfigured with another's ID, or running from a copy of
+// its data directory, and admitting it would remove the live member.
+func (s *Store) checkNodeIDInUse(srv raft.Server, addr string) error {
+	if s.NodeIDAt == nil {
+		return nil
+	}
+	id, err := s.NodeIDAt(string(srv.Address))
+	if err != nil || id != string(srv.ID) {
+		// The member is gone, or its address now belongs to another node,
+		// so the joining node has simply moved.
+		return nil
+	}
+	stats.Add(numJoinsDuplicateID, 1)
+	s.logger.Printf("refused join request from node %s at %s, as node %s is still live at %s",
+		srv.ID, addr, srv.ID, srv.Address)
+	return fmt.Errorf("%w: node %s is live at %s, so a node at %s cannot join with the same ID",
+		ErrNodeIDInUse, srv.ID, srv.Address, addr)
+}
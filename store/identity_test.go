@@ -0,0 +1,96 @@
+package store
+
+import (
+	"errors"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/rqlite/rqlite/command"
+	sql "github.com/rqlite/rqlite/db"
+)
+
+func Test_Identity(t *testing.T) {
+	dir := t.TempDir()
+	ident, err := ReadIdentity(dir)
+	if err != nil {
+		t.Fatalf("failed to read missing identity: %s", err.Error())
+	}
+	if ident != nil {
+		t.Fatalf("identity read from new data directory: %v", ident)
+	}
+
+	if _, err := WriteIdentity(dir, "node1"); err != nil {
+		t.Fatalf("failed to write identity: %s", err.Error())
+	}
+	ident, err = ReadIdentity(dir)
+	if err != nil {
+		t.Fatalf("failed to read identity: %s", err.Error())
+	}
+	if ident == nil || ident.ID != "node1" || ident.CreatedAt.IsZero() {
+		t.Fatalf("wrong identity read: %v", ident)
+	}
+	fi, err := os.Stat(IdentityPath(dir))
+	if err != nil {
+		t.Fatalf("failed to stat identity file: %s", err.Error())
+	}
+	if fi.Mode().Perm() != 0600 {
+		t.Fatalf("identity file has wrong permissions: %s", fi.Mode().Perm())
+	}
+
+	if err := os.WriteFile(IdentityPath(dir), []byte(`{"id":""}`), 0600); err != nil {
+		t.Fatalf("failed to write identity file: %s", err.Error())
+	}
+	if _, err := ReadIdentity(dir); err == nil {
+		t.Fatalf("identity without node ID read without error")
+	}
+}
+
+func Test_SingleNodeJoinDuplicateID(t *testing.T) {
+	s, ln := mustNewStore(t, true)
+	defer ln.Close()
+
+	if err := s.Open(); err != nil {
+		t.Fatalf("failed to open single-node store: %s", err.Error())
+	}
+	defer s.Close(true)
+	if err := s.Bootstrap(NewServer(s.ID(), s.Addr(), true)); err != nil {
+		t.Fatalf("failed to bootstrap single-node store: %s", err.Error())
+	}
+	if _, err := s.WaitForLeader(10 * time.Second); err != nil {
+		t.Fatalf("Error waiting for leader: %s", err)
+	}
+
+	live := map[string]string{"localhost:1": "node1"}
+	s.NodeIDAt = func(addr string) (string, error) {
+		if id, ok := live[addr]; ok {
+			return id, nil
+		}
+		return "", errors.New("connection refused")
+	}
+	join := func(addr string) error {
+		return s.Join(&command.JoinRequest{Id: "node1", Address: addr, Icu: sql.ICUSupported})
+	}
+
+	if err := join("localhost:1"); err != nil {
+		t.Fatalf("failed to join: %s", err.Error())
+	}
+	if err := join("localhost:2"); !errors.Is(err, ErrNodeIDInUse) {
+		t.Fatalf("join with ID of live node returned wrong error: %v", err)
+	}
+
+	// Once the first node is gone, the node has simply moved.
+	delete(live, "localhost:1")
+	if err := join("localhost:2"); err != nil {
+		t.Fatalf("failed to join at new address: %s", err.Error())
+	}
+	nodes, err := s.Nodes()
+	if err != nil {
+		t.Fatalf("failed to get nodes: %s", err.Error())
+	}
+	for _, n := range nodes {
+		if n.ID == "node1" && n.Addr != "localhost:2" {
+			t.Fatalf("node has wrong address after moving: %s", n.Addr)
+		}
+	}
+}
@@ -0,0 +1,303 @@
+package store
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/hashicorp/raft"
+	"github.com/rqlite/rqlite/command"
+	"google.golang.org/protobuf/proto"
+)
+
+const (
+	joinTokenIDLen  = 8
+	joinTokenKeyLen = 32
+)
+
+var (
+	// ErrJoinTokenRequired is returned when a node asks to join the cluster
+	// without a join token, but one is required.
+	ErrJoinTokenRequired = errors.New("join token required")
+
+	// ErrJoinTokenInvalid is returned when a join token was not issued by
+	// the cluster, or has been revoked.
+	ErrJoinTokenInvalid = errors.New("join token is invalid")
+
+	// ErrJoinTokenExpired is returned when a join token has expired.
+	ErrJoinTokenExpired = errors.New("join token has expired")
+
+	// ErrJoinTokenUsed is returned when a single-use join token has already
+	// been used.
+	ErrJoinTokenUsed = errors.New("join token has already been used")
+
+	// ErrJoinTokenNotFound is returned when a join token to be revoked does
+	// not exist.
+	ErrJoinTokenNotFound = errors.New("join token not found")
+)
+
+// CreateJoinToken creates a token which a node must present to join the
+// cluster, if join tokens are required. The token expires after ttl, unless
+// ttl is zero, and may be used only once if singleUse is set. It returns the
+// token, and its description.
+func (s *Store) CreateJoinToken(ttl time.Duration, singleUse bool) (string, *command.JoinToken, error) {
+	id := make([]byte, joinTokenIDLen)
+	if _, err := rand.Read(id); err != nil {
+		return "", nil, err
+	}
+	key := make([]byte, joinTokenKeyLen)
+	if _, err := rand.Read(key); err != nil {
+		return "", nil, err
+	}
+
+	now := time.Now()
+	t := &command.JoinToken{
+		Id:        hex.EncodeToString(id),
+		SingleUse: singleUse,
+	}
+	if ttl > 0 {
+		t.Expires = now.Add(ttl).UnixNano()
+	}
+
+	// The key is used only if the cluster does not already have one.
+	if err := s.changeJoinTokens(&command.JoinTokenRequest{
+		Action: command.JoinTokenRequest_ACTION_CREATE,
+		Token:  t,
+		Key:    key,
+		Now:    now.UnixNano(),
+	}); err != nil {
+		return "", nil, err
+	}
+	token, err := signJoinToken(s.joinTokensState().GetKey(), t)
+	if err != nil {
+		return "", nil, err
+	}
+	return token, t, nil
+}
+
+// RevokeJoinToken revokes the join token with the given ID, so that no node
+// may join the cluster with it.
+func (s *Store) RevokeJoinToken(id string) error {
+	return s.changeJoinTokens(&command.JoinTokenRequest{
+		Action: command.JoinTokenRequest_ACTION_REVOKE,
+		Token:  &command.JoinToken{Id: id},
+		Now:    time.Now().UnixNano(),
+	})
+}
+
+// JoinTokens returns the join tokens which have not been revoked. Tokens which
+// have expired, or have been used, are included until they are pruned. The
+// returned values must not be modified.
+func (s *Store) JoinTokens() []*command.JoinToken {
+	return s.joinTokensState().GetTokens()
+}
+
+// checkJoinToken checks that token allows a node to join the cluster, and if
+// it is a single-use token, records its use.
+func (s *Store) checkJoinToken(token string) error {
+	if token == "" {
+		return ErrJoinTokenRequired
+	}
+	t, err := verifyJoinToken(s.joinTokensState(), token, time.Now())
+	if err != nil {
+		return err
+	}
+	if !t.SingleUse {
+		return nil
+	}
+	return s.changeJoinTokens(&command.JoinTokenRequest{
+		Action: command.JoinTokenRequest_ACTION_USE,
+		Token:  &command.JoinToken{Id: t.Id},
+		Now:    time.Now().UnixNano(),
+	})
+}
+
+func (s *Store) changeJoinTokens(jr *command.JoinTokenRequest) error {
+	b, err := proto.Marshal(jr)
+	if err != nil {
+		return err
+	}
+	b, err = command.Marshal(&command.Command{
+		Type:       command.Command_COMMAND_TYPE_JOIN_TOKENS,
+		SubCommand: b,
+	})
+	if err != nil {
+		return err
+	}
+
+	af := s.raft.Apply(b, s.ApplyTimeout)
+	if af.Error() != nil {
+		if af.Error() == raft.ErrNotLeader {
+			return ErrNotLeader
+		}
+		return af.Error()
+	}
+	r := af.Response().(*fsmGenericResponse)
+	return r.error
+}
+
+// joinTokensState returns the join tokens of the cluster, nil if none has
+// ever been created. The returned value must not be modified.
+func (s *Store) joinTokensState() *command.JoinTokens {
+	s.joinTokensMu.RLock()
+	defer s.joinTokensMu.RUnlock()
+	return s.joinTokens
+}
+
+// applyJoinTokens applies a join token request to the FSM.
+func (s *Store) applyJoinTokens(jr *command.JoinTokenRequest) *fsmGenericResponse {
+	s.joinTokensMu.Lock()
+	defer s.joinTokensMu.Unlock()
+	jt, err := nextJoinTokens(s.joinTokens, jr)
+	if err != nil {
+		return &fsmGenericResponse{error: err}
+	}
+	s.joinTokens = jt
+	return &fsmGenericResponse{}
+}
+
+// setJoinTokens sets the join tokens of the cluster, as restored from a
+// snapshot.
+func (s *Store) setJoinTokens(jt *command.JoinTokens) {
+	s.joinTokensMu.Lock()
+	defer s.joinTokensMu.Unlock()
+	s.joinTokens = jt
+}
+
+// nextJoinTokens returns the join tokens which result from applying jr to cur.
+// A nil cur means no token has ever been created. Expired and used tokens are
+// pruned whenever a token is created, according to the time of the request,
+// so every node prunes the same tokens.
+func nextJoinTokens(cur *command.JoinTokens, jr *command.JoinTokenRequest) (*command.JoinTokens, error) {
+	if jr.Token == nil {
+		return nil, errors.New("join token required")
+	}
+	next := &command.JoinTokens{Key: cur.GetKey()}
+	switch jr.Action {
+	case command.JoinTokenRequest_ACTION_CREATE:
+		if len(next.Key) == 0 {
+			if len(jr.Key) == 0 {
+				return nil, errors.New("join token key required")
+			}
+			next.Key = jr.Key
+		}
+		for _, t := range cur.GetTokens() {
+			if !t.Used && !joinTokenExpired(t, jr.Now) {
+				next.Tokens = append(next.Tokens, t)
+			}
+		}
+		next.Tokens = append(next.Tokens, jr.Token)
+	case command.JoinTokenRequest_ACTION_REVOKE:
+		found := false
+		for _, t := range cur.GetTokens() {
+			if t.Id == jr.Token.Id {
+				found = true
+				continue
+			}
+			next.Tokens = append(next.Tokens, t)
+		}
+		if !found {
+			return nil, ErrJoinTokenNotFound
+		}
+	case command.JoinTokenRequest_ACTION_USE:
+		found := false
+		for _, t := range cur.GetTokens() {
+			if t.Id == jr.Token.Id {
+				found = true
+				if t.Used {
+					return nil, ErrJoinTokenUsed
+				}
+				if joinTokenExpired(t, jr.Now) {
+					return nil, ErrJoinTokenExpired
+				}
+				t = proto.Clone(t).(*command.JoinToken)
+				t.Used = true
+			}
+			next.Tokens = append(next.Tokens, t)
+		}
+		if !found {
+			return nil, ErrJoinTokenInvalid
+		}
+	default:
+		return nil, errors.New("unknown join token action")
+	}
+	return next, nil
+}
+
+// joinTokenExpired returns whether t has expired at now, given in nanoseconds
+// since the Unix epoch.
+func joinTokenExpired(t *command.JoinToken, now int64) bool {
+	return t.Expires != 0 && now >= t.Expires
+}
+
+// signJoinToken returns the token which a node presents to join the cluster,
+// describing t, signed with key.
+func signJoinToken(key []byte, t *command.JoinToken) (string, error) {
+	p, err := proto.Marshal(&command.JoinToken{
+		Id:        t.Id,
+		Expires:   t.Expires,
+		SingleUse: t.SingleUse,
+	})
+	if err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(p) + "." +
+		base64.RawURLEncoding.EncodeToString(joinTokenMAC(key, p)), nil
+}
+
+// verifyJoinToken checks that token was signed with the key of jt, and that
+// it describes a token of jt which has been neither used nor revoked, and has
+// not expired at now. It returns the token of jt.
+func verifyJoinToken(jt *command.JoinTokens, token string, now time.Time) (*command.JoinToken, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 2 || len(jt.GetKey()) == 0 {
+		return nil, ErrJoinTokenInvalid
+	}
+	p, err := base64.RawURLEncoding.DecodeString(parts[0])
+	if err != nil {
+		return nil, ErrJoinTokenInvalid
+	}
+	mac, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil {
+		return nil, ErrJoinTokenInvalid
+	}
+	if !hmac.Equal(mac, joinTokenMAC(jt.Key, p)) {
+		return nil, ErrJoinTokenInvalid
+	}
+	var claimed command.JoinToken
+	if err := proto.Unmarshal(p, &claimed); err != nil {
+		return nil, ErrJoinTokenInvalid
+	}
+
+	if joinTokenExpired(&claimed, now.UnixNano()) {
+		return nil, ErrJoinTokenExpired
+	}
+
+	for _, t := range jt.Tokens {
+		if t.Id != claimed.Id {
+			continue
+		}
+		if t.Expires != claimed.Expires || t.SingleUse != claimed.SingleUse {
+			return nil, ErrJoinTokenInvalid
+		}
+		if joinTokenExpired(t, now.UnixNano()) {
+			return nil, ErrJoinTokenExpired
+		}
+		if t.Used {
+			return nil, ErrJoinTokenUsed
+		}
+		return t, nil
+	}
+	return nil, ErrJoinTokenInvalid
+}
+
+func joinTokenMAC(key, p []byte) []byte {
+	h := hmac.New(sha256.New, key)
+	h.Write(p)
+	return h.Sum(nil)
+}
@@ -0,0 +1,180 @@
+package store
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/rqlite/rqlite/command"
+	sql "github.com/rqlite/rqlite/db"
+)
+
+func Test_SingleNodeJoinTokens(t *testing.T) {
+	s, ln := mustNewStore(t, true)
+	defer ln.Close()
+	s.JoinTokenRequired = true
+
+	if err := s.Open(); err != nil {
+		t.Fatalf("failed to open single-node store: %s", err.Error())
+	}
+	defer s.Close(true)
+	if err := s.Bootstrap(NewServer(s.ID(), s.Addr(), true)); err != nil {
+		t.Fatalf("failed to bootstrap single-node store: %s", err.Error())
+	}
+	if _, err := s.WaitForLeader(10 * time.Second); err != nil {
+		t.Fatalf("Error waiting for leader: %s", err)
+	}
+
+	// Nodes join as non-voters, so the single node remains a quorum.
+	join := func(id, token string) error {
+		return s.Join(&command.JoinRequest{
+			Id:      id,
+			Address: "localhost:" + strings.TrimPrefix(id, "node"),
+			Token:   token,
+			Icu:     sql.ICUSupported,
+		})
+	}
+
+	if err := join("node1", ""); err != ErrJoinTokenRequired {
+		t.Fatalf("join without token returned wrong error: %v", err)
+	}
+	if err := join("node1", "garbage"); err != ErrJoinTokenInvalid {
+		t.Fatalf("join with invalid token returned wrong error: %v", err)
+	}
+
+	token, jt, err := s.CreateJoinToken(time.Hour, true)
+	if err != nil {
+		t.Fatalf("failed to create join token: %s", err.Error())
+	}
+	if !jt.SingleUse || jt.Expires == 0 {
+		t.Fatalf("join token has wrong description: %v", jt)
+	}
+	if err := join("node1", token+"x"); err != ErrJoinTokenInvalid {
+		t.Fatalf("join with altered token returned wrong error: %v", err)
+	}
+	if err := join("node1", token); err != nil {
+		t.Fatalf("failed to join with token: %s", err.Error())
+	}
+	if err := join("node2", token); err != ErrJoinTokenUsed {
+		t.Fatalf("join with used token returned wrong error: %v", err)
+	}
+	// A node which is already a member need not present a token.
+	if err := join("node1", ""); err != nil {
+		t.Fatalf("failed to rejoin without token: %s", err.Error())
+	}
+
+	// A token which is not single-use may be used by many nodes, until it
+	// is revoked.
+	multiToken, multi, err := s.CreateJoinToken(0, false)
+	if err != nil {
+		t.Fatalf("failed to create join token: %s", err.Error())
+	}
+	if multi.Expires != 0 {
+		t.Fatalf("join token without TTL expires")
+	}
+	if err := join("node2", multiToken); err != nil {
+		t.Fatalf("failed to join with token: %s", err.Error())
+	}
+	if err := join("node3", multiToken); err != nil {
+		t.Fatalf("failed to join with token: %s", err.Error())
+	}
+	if err := s.RevokeJoinToken(multi.Id); err != nil {
+		t.Fatalf("failed to revoke join token: %s", err.Error())
+	}
+	if err := s.RevokeJoinToken(multi.Id); err != ErrJoinTokenNotFound {
+		t.Fatalf("revoking unknown token returned wrong error: %v", err)
+	}
+	if err := join("node4", multiToken); err != ErrJoinTokenInvalid {
+		t.Fatalf("join with revoked token returned wrong error: %v", err)
+	}
+
+	expiringToken, _, err := s.CreateJoinToken(time.Millisecond, false)
+	if err != nil {
+		t.Fatalf("failed to create join token: %s", err.Error())
+	}
+	time.Sleep(10 * time.Millisecond)
+	if err := join("node4", expiringToken); err != ErrJoinTokenExpired {
+		t.Fatalf("join with expired token returned wrong error: %v", err)
+	}
+
+	// Tokens must survive snapshotting.
+	liveToken, _, err := s.CreateJoinToken(time.Hour, false)
+	if err != nil {
+		t.Fatalf("failed to create join token: %s", err.Error())
+	}
+	if n := len(s.JoinTokens()); n != 1 {
+		t.Fatalf("expired and used tokens not pruned, have %d tokens", n)
+	}
+	f, err := s.Snapshot()
+	if err != nil {
+		t.Fatalf("failed to snapshot node: %s", err.Error())
+	}
+	snapFile, err := os.Create(filepath.Join(t.TempDir(), "snapshot"))
+	if err != nil {
+		t.Fatalf("failed to create snapshot file: %s", err.Error())
+	}
+	defer snapFile.Close()
+	if err := f.Persist(&mockSnapshotSink{snapFile}); err != nil {
+		t.Fatalf("failed to persist snapshot to disk: %s", err.Error())
+	}
+	s.setJoinTokens(nil)
+	if err := join("node4", liveToken); err != ErrJoinTokenInvalid {
+		t.Fatalf("join with token after reset returned wrong error: %v", err)
+	}
+	snapFile, err = os.Open(snapFile.Name())
+	if err != nil {
+		t.Fatalf("failed to open snapshot file: %s", err.Error())
+	}
+	defer snapFile.Close()
+	if err := s.Restore(snapFile); err != nil {
+		t.Fatalf("failed to restore snapshot: %s", err.Error())
+	}
+	if err := join("node4", liveToken); err != nil {
+		t.Fatalf("failed to join with token restored from snapshot: %s", err.Error())
+	}
+}
+
+func Test_VerifyJoinToken(t *testing.T) {
+	now := time.Now()
+	jt := &command.JoinTokens{
+		Key: []byte("0123456789abcdef"),
+		Tokens: []*command.JoinToken{
+			{Id: "a", Expires: now.Add(time.Hour).UnixNano()},
+		},
+	}
+	token, err := signJoinToken(jt.Key, jt.Tokens[0])
+	if err != nil {
+		t.Fatalf("failed to sign join token: %s", err.Error())
+	}
+	if _, err := verifyJoinToken(jt, token, now); err != nil {
+		t.Fatalf("failed to verify join token: %s", err.Error())
+	}
+	if _, err := verifyJoinToken(jt, token, now.Add(2*time.Hour)); err != ErrJoinTokenExpired {
+		t.Fatalf("expired join token returned wrong error: %v", err)
+	}
+
+	// A token signed with another key is invalid, even if it describes a
+	// token of the cluster.
+	forged, err := signJoinToken([]byte("fedcba9876543210"), jt.Tokens[0])
+	if err != nil {
+		t.Fatalf("failed to sign join token: %s", err.Error())
+	}
+	if _, err := verifyJoinToken(jt, forged, now); err != ErrJoinTokenInvalid {
+		t.Fatalf("forged join token returned wrong error: %v", err)
+	}
+
+	// So is a token whose expiry does not match that of the cluster.
+	extended, err := signJoinToken(jt.Key, &command.JoinToken{Id: "a"})
+	if err != nil {
+		t.Fatalf("failed to sign join token: %s", err.Error())
+	}
+	if _, err := verifyJoinToken(jt, extended, now); err != ErrJoinTokenInvalid {
+		t.Fatalf("join token with wrong expiry returned wrong error: %v", err)
+	}
+
+	if _, err := verifyJoinToken(nil, token, now); err != ErrJoinTokenInvalid {
+		t.Fatalf("join token verified without tokens returned wrong error: %v", err)
+	}
+}
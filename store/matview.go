@@ -0,0 +1,325 @@
+package store
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/rqlite/rqlite/command"
+	sql "github.com/rqlite/rqlite/db"
+)
+
+// defaultMatViewCheckInterval is the interval at which the Leader checks
+// whether any materialized view is due to be refreshed.
+const defaultMatViewCheckInterval = time.Second
+
+// matViewTable is the table, managed by rqlite, holding the definition of
+// each materialized view.
+const matViewTable = sql.ManagedTablePrefix + "materialized_views"
+
+var (
+	// ErrMatViewNotFound is returned when a materialized view does not exist.
+	ErrMatViewNotFound = errors.New("materialized view not found")
+
+	// ErrMatViewInvalid is returned when the definition of a materialized
+	// view is invalid.
+	ErrMatViewInvalid = errors.New("invalid materialized view")
+)
+
+// matViewName matches the names permitted for materialized views.
+var matViewName = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// MaterializedView is a table holding the results of a query, which the
+// Leader recomputes when the tables the query reads are written to, at a
+// fixed interval, or both.
+type MaterializedView struct {
+	Name  string
+	Query string
+
+	// Sources are the tables read by Query.
+	Sources []string
+
+	// OnWrite is whether the view is refreshed once any of its sources has
+	// been written to.
+	OnWrite bool
+
+	// Interval, if not zero, is the interval at which the view is refreshed.
+	Interval time.Duration
+
+	// RefreshedAt is when the view was last refreshed, zero if it has not
+	// been refreshed since it was created.
+	RefreshedAt time.Time
+}
+
+// CreateMaterializedView creates the materialized view mv, and its table,
+// holding the current results of its query, setting the sources of mv. The
+// view is replicated, like any other write, so the Leader must create it.
+func (s *Store) CreateMaterializedView(mv *MaterializedView) error {
+	if !matViewName.MatchString(mv.Name) || sql.IsManagedTable(mv.Name) {
+		return fmt.Errorf("%w: name %q is not permitted", ErrMatViewInvalid, mv.Name)
+	}
+	if mv.Interval < 0 {
+		return fmt.Errorf("%w: interval must not be negative", ErrMatViewInvalid)
+	}
+	sources, err := matViewSources(mv.Name, mv.Query)
+	if err != nil {
+		return err
+	}
+
+	err = s.executeManaged(&command.Request{
+		Transaction: true,
+		Statements: []*command.Statement{
+			{
+				Sql: `CREATE TABLE IF NOT EXISTS ` + matViewTable +
+					` (name TEXT NOT NULL PRIMARY KEY, query TEXT NOT NULL, on_write INTEGER NOT NULL,` +
+					` interval INTEGER NOT NULL, refreshed_at INTEGER NOT NULL) WITHOUT ROWID`,
+			},
+			{
+				Sql: `INSERT INTO ` + matViewTable + ` (name, query, on_write, interval, refreshed_at) VALUES (?, ?, ?, ?, 0)`,
+				Parameters: []*command.Parameter{
+					{Value: &command.Parameter_S{S: mv.Name}},
+					{Value: &command.Parameter_S{S: mv.Query}},
+					{Value: &command.Parameter_B{B: mv.OnWrite}},
+					{Value: &command.Parameter_I{I: int64(mv.Interval)}},
+				},
+			},
+			{
+				Sql: `CREATE TABLE "` + mv.Name + `" AS ` + mv.Query,
+			},
+		},
+	})
+	if err != nil {
+		return err
+	}
+	mv.Sources = sources
+	return nil
+}
+
+// DropMaterializedView drops the named materialized view, and its table.
+func (s *Store) DropMaterializedView(name string) error {
+	if _, err := s.materializedView(name); err != nil {
+		return err
+	}
+	return s.executeManaged(&command.Request{
+		Transaction: true,
+		Statements: []*command.Statement{
+			{
+				Sql: `DELETE FROM ` + matViewTable + ` WHERE name = ?`,
+				Parameters: []*command.Parameter{
+					{Value: &command.Parameter_S{S: name}},
+				},
+			},
+			{
+				Sql: `DROP TABLE "` + name + `"`,
+			},
+		},
+	})
+}
+
+// RefreshMaterializedView replaces the contents of the table of the named
+// materialized view with the current results of its query. The statements
+// refreshing the view are written to the Raft log, so every node recomputes
+// exactly the same results.
+func (s *Store) RefreshMaterializedView(name string) error {
+	mv, err := s.materializedView(name)
+	if err != nil {
+		return err
+	}
+	return s.refreshMatView(mv)
+}
+
+func (s *Store) refreshMatView(mv *MaterializedView) error {
+	stmts := []*command.Statement{
+		{
+			Sql: `DELETE FROM "` + mv.Name + `"`,
+		},
+		{
+			Sql: `INSERT INTO "` + mv.Name + `" SELECT * FROM (` + mv.Query + `)`,
+		},
+		{
+			Sql: `UPDATE ` + matViewTable + ` SET refreshed_at = ? WHERE name = ?`,
+			Parameters: []*command.Parameter{
+				{Value: &command.Parameter_I{I: time.Now().UnixNano()}},
+				{Value: &command.Parameter_S{S: mv.Name}},
+			},
+		},
+	}
+	if err := command.Rewrite(stmts, true); err != nil {
+		return err
+	}
+	if err := s.executeManaged(&command.Request{Transaction: true, Statements: stmts}); err != nil {
+		stats.Add(numMatViewRefreshFailures, 1)
+		return err
+	}
+	stats.Add(numMatViewRefreshes, 1)
+	return nil
+}
+
+// executeManaged executes req, returning the first error reported by any of
+// its statements.
+func (s *Store) executeManaged(req *command.Request) error {
+	results, err := s.Execute(&command.ExecuteRequest{Request: req})
+	if err != nil {
+		return err
+	}
+	for _, r := range results {
+		if r.Error != "" {
+			return errors.New(r.Error)
+		}
+	}
+	return nil
+}
+
+// MaterializedViews returns every materialized view, sorted by name.
+func (s *Store) MaterializedViews() ([]*MaterializedView, error) {
+	return s.queryMatViews(`SELECT name, query, on_write, interval, refreshed_at FROM ` + matViewTable + ` ORDER BY name`)
+}
+
+// materializedView returns the named materialized view.
+func (s *Store) materializedView(name string) (*MaterializedView, error) {
+	mvs, err := s.queryMatViews(`SELECT name, query, on_write, interval, refreshed_at FROM `+matViewTable+` WHERE name = ?`,
+		&command.Parameter{Value: &command.Parameter_S{S: name}})
+	if err != nil {
+		return nil, err
+	}
+	if len(mvs) == 0 {
+		return nil, ErrMatViewNotFound
+	}
+	return mvs[0], nil
+}
+
+func (s *Store) queryMatViews(query string, params ...*command.Parameter) ([]*MaterializedView, error) {
+	rows, err := s.db.Query(&command.Request{
+		Statements: []*command.Statement{{Sql: query, Parameters: params}},
+	}, false)
+	if err != nil {
+		return nil, err
+	}
+	if len(rows) != 1 {
+		return nil, fmt.Errorf("unexpected number of results querying materialized views: %d", len(rows))
+	}
+	if rows[0].Error != "" {
+		if strings.Contains(rows[0].Error, "no such table") {
+			return nil, nil
+		}
+		return nil, errors.New(rows[0].Error)
+	}
+
+	var mvs []*MaterializedView
+	for _, v := range rows[0].Values {
+		p := v.GetParameters()
+		if len(p) != 5 {
+			return nil, fmt.Errorf("unexpected number of columns querying materialized views: %d", len(p))
+		}
+		mv := &MaterializedView{
+			Name:     p[0].GetS(),
+			Query:    p[1].GetS(),
+			OnWrite:  p[2].GetI() != 0,
+			Interval: time.Duration(p[3].GetI()),
+		}
+		if ns := p[4].GetI(); ns != 0 {
+			mv.RefreshedAt = time.Unix(0, ns).UTC()
+		}
+		mv.Sources, _ = matViewSources(mv.Name, mv.Query)
+		mvs = append(mvs, mv)
+	}
+	return mvs, nil
+}
+
+// matViewSources returns the tables read by query, the query of the named
+// materialized view, or an error if query is not a single SELECT which may
+// define the view.
+func matViewSources(name, query string) ([]string, error) {
+	tables, ok := command.ReadTables([]*command.Statement{{Sql: query}})
+	if !ok {
+		return nil, fmt.Errorf("%w: query must be a single SELECT statement", ErrMatViewInvalid)
+	}
+	for _, t := range tables {
+		if strings.EqualFold(t, name) {
+			return nil, fmt.Errorf("%w: query must not read the view itself", ErrMatViewInvalid)
+		}
+		if sql.IsManagedTable(t) {
+			return nil, fmt.Errorf("%w: query must not read table %s", ErrMatViewInvalid, t)
+		}
+	}
+	return tables, nil
+}
+
+// matViewWrites returns the number of rows written to the given tables, as
+// counted by the database layer of this node.
+func matViewWrites(tables []string) int64 {
+	var n int64
+	for _, ts := range sql.AllTableStats() {
+		for _, t := range tables {
+			if strings.EqualFold(ts.Name, t) {
+				n += ts.Writes()
+			}
+		}
+	}
+	return n
+}
+
+// refreshMatViews refreshes, while this node is the Leader, each materialized
+// view which is due to be refreshed, checking every MatViewCheckInterval. So
+// writes to the sources of a view made within one interval are coalesced into
+// a single refresh.
+func (s *Store) refreshMatViews() (closeCh, doneCh chan struct{}) {
+	closeCh = make(chan struct{})
+	doneCh = make(chan struct{})
+	if s.MatViewCheckInterval == 0 {
+		close(doneCh)
+		return closeCh, doneCh
+	}
+
+	go func() {
+		defer close(doneCh)
+		tck := time.NewTicker(s.MatViewCheckInterval)
+		defer tck.Stop()
+
+		// The writes to the sources of each view when it was last refreshed
+		// by this node, and the last error refreshing it.
+		writes := make(map[string]int64)
+		failures := make(map[string]string)
+		for {
+			select {
+			case <-tck.C:
+				if !s.IsLeader() || !s.Ready() {
+					// Writes may be made elsewhere, so each view is refreshed
+					// once should this node become Leader again.
+					writes = make(map[string]int64)
+					continue
+				}
+				mvs, err := s.MaterializedViews()
+				if err != nil {
+					s.logger.Printf("failed to read materialized views: %s", err.Error())
+					continue
+				}
+				for _, mv := range mvs {
+					n := matViewWrites(mv.Sources)
+					last, ok := writes[mv.Name]
+					due := mv.OnWrite && (!ok || n != last)
+					if mv.Interval > 0 && time.Since(mv.RefreshedAt) >= mv.Interval {
+						due = true
+					}
+					if !due {
+						continue
+					}
+					if err := s.refreshMatView(mv); err != nil {
+						if failures[mv.Name] != err.Error() {
+							s.logger.Printf("failed to refresh materialized view %s: %s", mv.Name, err.Error())
+						}
+						failures[mv.Name] = err.Error()
+						continue
+					}
+					delete(failures, mv.Name)
+					writes[mv.Name] = n
+				}
+			case <-closeCh:
+				return
+			}
+		}
+	}()
+	return closeCh, doneCh
+}
@@ -0,0 +1,155 @@
+package store
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func Test_SingleNodeMaterializedView(t *testing.T) {
+	s, ln := mustNewStore(t, true)
+	defer ln.Close()
+	s.MatViewCheckInterval = 0
+
+	if err := s.Open(); err != nil {
+		t.Fatalf("failed to open single-node store: %s", err.Error())
+	}
+	if err := s.Bootstrap(NewServer(s.ID(), s.Addr(), true)); err != nil {
+		t.Fatalf("failed to bootstrap single-node store: %s", err.Error())
+	}
+	defer s.Close(true)
+	if _, err := s.WaitForLeader(10 * time.Second); err != nil {
+		t.Fatalf("Error waiting for leader: %s", err)
+	}
+
+	er := executeRequestFromStrings([]string{
+		`CREATE TABLE foo (id INTEGER NOT NULL PRIMARY KEY, name TEXT)`,
+		`INSERT INTO foo(id, name) VALUES(1, "fiona")`,
+		`INSERT INTO foo(id, name) VALUES(2, "fiona")`,
+		`INSERT INTO foo(id, name) VALUES(3, "declan")`,
+	}, false, false)
+	if _, err := s.Execute(er); err != nil {
+		t.Fatalf("failed to execute on single node: %s", err.Error())
+	}
+
+	checkView := func(exp string) {
+		t.Helper()
+		r, err := s.Query(queryRequestFromString("SELECT * FROM names ORDER BY name", false, false))
+		if err != nil {
+			t.Fatalf("failed to query view: %s", err.Error())
+		}
+		if got := asJSON(r); got != exp {
+			t.Fatalf("wrong view contents\nexp: %s\ngot: %s", exp, got)
+		}
+	}
+
+	mv := &MaterializedView{
+		Name:    "names",
+		Query:   "SELECT name, COUNT(*) AS n FROM foo GROUP BY name",
+		OnWrite: true,
+	}
+	if err := s.CreateMaterializedView(mv); err != nil {
+		t.Fatalf("failed to create materialized view: %s", err.Error())
+	}
+	checkView(`[{"columns":["name","n"],"types":["text",""],"values":[["declan",1],["fiona",2]]}]`)
+
+	mvs, err := s.MaterializedViews()
+	if err != nil {
+		t.Fatalf("failed to list materialized views: %s", err.Error())
+	}
+	if len(mvs) != 1 || mvs[0].Name != "names" || !mvs[0].OnWrite || len(mvs[0].Sources) != 1 || mvs[0].Sources[0] != "foo" {
+		t.Fatalf("wrong materialized views: %s", asJSON(mvs))
+	}
+	if !mvs[0].RefreshedAt.IsZero() {
+		t.Fatalf("view refreshed before any refresh")
+	}
+
+	// The view is unchanged by writes until it is refreshed.
+	if _, err := s.Execute(executeRequestFromString(`INSERT INTO foo(id, name) VALUES(4, "declan")`, false, false)); err != nil {
+		t.Fatalf("failed to execute on single node: %s", err.Error())
+	}
+	checkView(`[{"columns":["name","n"],"types":["text",""],"values":[["declan",1],["fiona",2]]}]`)
+	if err := s.RefreshMaterializedView("names"); err != nil {
+		t.Fatalf("failed to refresh materialized view: %s", err.Error())
+	}
+	checkView(`[{"columns":["name","n"],"types":["text",""],"values":[["declan",2],["fiona",2]]}]`)
+	if mvs, err = s.MaterializedViews(); err != nil || mvs[0].RefreshedAt.IsZero() {
+		t.Fatalf("refresh time not recorded")
+	}
+
+	if err := s.CreateMaterializedView(mv); err == nil {
+		t.Fatalf("created materialized view twice")
+	}
+	for _, bad := range []*MaterializedView{
+		{Name: "bad name", Query: "SELECT * FROM foo"},
+		{Name: "_rqlite_bad", Query: "SELECT * FROM foo"},
+		{Name: "bad", Query: "DELETE FROM foo"},
+		{Name: "bad", Query: "SELECT * FROM foo; SELECT * FROM foo"},
+		{Name: "bad", Query: "SELECT * FROM bad"},
+		{Name: "bad", Query: "SELECT * FROM " + matViewTable},
+	} {
+		if err := s.CreateMaterializedView(bad); !errors.Is(err, ErrMatViewInvalid) {
+			t.Fatalf("wrong error creating invalid view %s (%s): %v", bad.Name, bad.Query, err)
+		}
+	}
+
+	if err := s.DropMaterializedView("names"); err != nil {
+		t.Fatalf("failed to drop materialized view: %s", err.Error())
+	}
+	if err := s.DropMaterializedView("names"); !errors.Is(err, ErrMatViewNotFound) {
+		t.Fatalf("wrong error dropping missing view: %v", err)
+	}
+	if err := s.RefreshMaterializedView("names"); !errors.Is(err, ErrMatViewNotFound) {
+		t.Fatalf("wrong error refreshing missing view: %v", err)
+	}
+	r, err := s.Query(queryRequestFromString("SELECT * FROM names", false, false))
+	if err != nil {
+		t.Fatalf("failed to query: %s", err.Error())
+	}
+	if exp, got := `[{"error":"no such table: names"}]`, asJSON(r); exp != got {
+		t.Fatalf("view table not dropped\nexp: %s\ngot: %s", exp, got)
+	}
+}
+
+func Test_SingleNodeMaterializedViewRefresh(t *testing.T) {
+	s, ln := mustNewStore(t, true)
+	defer ln.Close()
+	s.MatViewCheckInterval = 50 * time.Millisecond
+
+	if err := s.Open(); err != nil {
+		t.Fatalf("failed to open single-node store: %s", err.Error())
+	}
+	if err := s.Bootstrap(NewServer(s.ID(), s.Addr(), true)); err != nil {
+		t.Fatalf("failed to bootstrap single-node store: %s", err.Error())
+	}
+	defer s.Close(true)
+	if _, err := s.WaitForLeader(10 * time.Second); err != nil {
+		t.Fatalf("Error waiting for leader: %s", err)
+	}
+
+	er := executeRequestFromStrings([]string{
+		`CREATE TABLE mv_refresh_src (id INTEGER NOT NULL PRIMARY KEY)`,
+		`INSERT INTO mv_refresh_src(id) VALUES(1)`,
+	}, false, false)
+	if _, err := s.Execute(er); err != nil {
+		t.Fatalf("failed to execute on single node: %s", err.Error())
+	}
+	for _, mv := range []*MaterializedView{
+		{Name: "on_write", Query: "SELECT COUNT(*) AS n FROM mv_refresh_src", OnWrite: true},
+		{Name: "on_interval", Query: "SELECT COUNT(*) AS n FROM mv_refresh_src", Interval: 200 * time.Millisecond},
+	} {
+		if err := s.CreateMaterializedView(mv); err != nil {
+			t.Fatalf("failed to create materialized view: %s", err.Error())
+		}
+	}
+	if _, err := s.Execute(executeRequestFromString(`INSERT INTO mv_refresh_src(id) VALUES(2)`, false, false)); err != nil {
+		t.Fatalf("failed to execute on single node: %s", err.Error())
+	}
+
+	for _, name := range []string{"on_write", "on_interval"} {
+		testPoll(t, func() bool {
+			r, err := s.Query(queryRequestFromString("SELECT n FROM "+name, false, false))
+			return err == nil && asJSON(r) == `[{"columns":["n"],"types":[""],"values":[[2]]}]`
+		}, 50*time.Millisecond, 5*time.Second)
+	}
+}
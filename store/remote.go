@@ -0,0 +1,439 @@
+package store
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/rqlite/rqlite/command"
+	sql "github.com/rqlite/rqlite/db"
+)
+
+const (
+	// defaultRemoteCheckInterval is the interval at which each node checks
+	// for changes to the remote clusters registered with the cluster.
+	defaultRemoteCheckInterval = time.Second
+
+	// remoteSchemaInterval is the interval at which each node reads the tables
+	// of each remote cluster again.
+	remoteSchemaInterval = time.Minute
+
+	// remoteRetryInterval is the interval at which each node tries again to
+	// attach a remote cluster it failed to attach.
+	remoteRetryInterval = 10 * time.Second
+
+	// remoteTimeout is the time allowed for each request to a remote cluster.
+	remoteTimeout = 10 * time.Second
+)
+
+// remoteTable is the table, managed by rqlite, holding the remote clusters
+// registered with the cluster.
+const remoteTable = sql.ManagedTablePrefix + "remotes"
+
+var (
+	// ErrRemoteNotFound is returned when a remote cluster is not registered.
+	ErrRemoteNotFound = errors.New("remote cluster not found")
+
+	// ErrRemoteInvalid is returned when the registration of a remote cluster
+	// is invalid.
+	ErrRemoteInvalid = errors.New("invalid remote cluster")
+
+	// ErrRemoteUnavailable is returned when a remote cluster cannot be read.
+	ErrRemoteUnavailable = errors.New("remote cluster unavailable")
+)
+
+// Remote is a remote rqlite cluster registered with the cluster, whose tables
+// each node serves, read-only, as the tables of the schema Name.
+type Remote struct {
+	Name string
+
+	// URL is the HTTP API URL of a node of the remote cluster, which may hold
+	// credentials for the remote cluster.
+	URL string
+
+	// Tables are the tables of the remote cluster attached by this node.
+	Tables []string
+
+	// Error is why this node could not attach the remote cluster, if it
+	// could not.
+	Error string
+}
+
+// RegisterRemote registers, or registers again, the remote cluster r. The
+// remote cluster must be readable by the Leader. The registration is
+// replicated, like any other write, and each node then attaches the remote
+// cluster itself.
+func (s *Store) RegisterRemote(r *Remote) error {
+	if !sql.RemoteTablesSupported {
+		return sql.ErrRemoteTablesUnsupported
+	}
+	if !sql.IsValidRemoteName(r.Name) {
+		return fmt.Errorf("%w: name %q is not permitted", ErrRemoteInvalid, r.Name)
+	}
+	rc, err := newRemoteCluster(r.URL)
+	if err != nil {
+		return err
+	}
+	if !s.IsLeader() {
+		return ErrNotLeader
+	}
+	if _, err := rc.Tables(); err != nil {
+		return err
+	}
+	return s.executeManaged(&command.Request{
+		Transaction: true,
+		Statements: []*command.Statement{
+			{
+				Sql: `CREATE TABLE IF NOT EXISTS ` + remoteTable +
+					` (name TEXT NOT NULL PRIMARY KEY, url TEXT NOT NULL) WITHOUT ROWID`,
+			},
+			{
+				Sql: `INSERT OR REPLACE INTO ` + remoteTable + ` (name, url) VALUES (?, ?)`,
+				Parameters: []*command.Parameter{
+					{Value: &command.Parameter_S{S: strings.ToLower(r.Name)}},
+					{Value: &command.Parameter_S{S: r.URL}},
+				},
+			},
+		},
+	})
+}
+
+// UnregisterRemote unregisters the named remote cluster.
+func (s *Store) UnregisterRemote(name string) error {
+	remotes, err := s.registeredRemotes()
+	if err != nil {
+		return err
+	}
+	if _, ok := remotes[strings.ToLower(name)]; !ok {
+		return ErrRemoteNotFound
+	}
+	return s.executeManaged(&command.Request{
+		Statements: []*command.Statement{
+			{
+				Sql: `DELETE FROM ` + remoteTable + ` WHERE name = ?`,
+				Parameters: []*command.Parameter{
+					{Value: &command.Parameter_S{S: strings.ToLower(name)}},
+				},
+			},
+		},
+	})
+}
+
+// Remotes returns every remote cluster registered with the cluster, sorted by
+// name, and whether this node has attached each.
+func (s *Store) Remotes() ([]*Remote, error) {
+	rows, err := s.db.QueryStringStmt(`SELECT name, url FROM ` + remoteTable + ` ORDER BY name`)
+	if err != nil {
+		return nil, err
+	}
+	s.remotesMu.Lock()
+	defer s.remotesMu.Unlock()
+	var remotes []*Remote
+	for _, r := range remotesFromRows(rows) {
+		r.Error = s.remoteErrors[r.Name]
+		if tables, ok := s.db.RemoteTables(r.Name); ok {
+			for _, t := range tables {
+				r.Tables = append(r.Tables, t.Name)
+			}
+		}
+		remotes = append(remotes, r)
+	}
+	return remotes, nil
+}
+
+// RemoteNames returns the names of the remote clusters attached by this node.
+func (s *Store) RemoteNames() []string {
+	return s.db.RemoteNames()
+}
+
+// registeredRemotes returns the URL of every registered remote cluster, keyed
+// by name.
+func (s *Store) registeredRemotes() (map[string]string, error) {
+	rows, err := s.db.QueryStringStmt(`SELECT name, url FROM ` + remoteTable)
+	if err != nil {
+		return nil, err
+	}
+	remotes := make(map[string]string)
+	for _, r := range remotesFromRows(rows) {
+		remotes[r.Name] = r.URL
+	}
+	return remotes, nil
+}
+
+func remotesFromRows(rows []*command.QueryRows) []*Remote {
+	// The table does not exist until a remote cluster is first registered.
+	if len(rows) != 1 || rows[0].Error != "" {
+		return nil
+	}
+	var remotes []*Remote
+	for _, v := range rows[0].Values {
+		p := v.GetParameters()
+		if len(p) != 2 {
+			continue
+		}
+		remotes = append(remotes, &Remote{Name: p[0].GetS(), URL: p[1].GetS()})
+	}
+	return remotes
+}
+
+// attachRemotes keeps the remote clusters attached to the database of this
+// node in line with those registered, checking every RemoteCheckInterval.
+// Each remote cluster is attached again, so its tables are read again, every
+// remoteSchemaInterval, or every remoteRetryInterval while attaching it fails.
+func (s *Store) attachRemotes() (closeCh, doneCh chan struct{}) {
+	closeCh = make(chan struct{})
+	doneCh = make(chan struct{})
+	if s.RemoteCheckInterval == 0 {
+		close(doneCh)
+		return closeCh, doneCh
+	}
+
+	go func() {
+		defer close(doneCh)
+		tck := time.NewTicker(s.RemoteCheckInterval)
+		defer tck.Stop()
+
+		// The database, and the URL of each remote cluster this node last
+		// tried to attach to it, when, and whether it failed.
+		var db *sql.DB
+		var urls map[string]string
+		var attempted map[string]time.Time
+		var failed map[string]bool
+		for {
+			select {
+			case <-tck.C:
+				if s.db != db {
+					db = s.db
+					urls = make(map[string]string)
+					attempted = make(map[string]time.Time)
+					failed = make(map[string]bool)
+				}
+				remotes, err := s.registeredRemotes()
+				if err != nil {
+					s.logger.Printf("failed to read remote clusters: %s", err.Error())
+					continue
+				}
+				for name := range urls {
+					if _, ok := remotes[name]; !ok {
+						db.DetachRemote(name)
+						delete(urls, name)
+						delete(attempted, name)
+						delete(failed, name)
+						s.setRemoteError(name, nil)
+					}
+				}
+				for name, u := range remotes {
+					interval := remoteSchemaInterval
+					if failed[name] {
+						interval = remoteRetryInterval
+					}
+					if urls[name] == u && time.Since(attempted[name]) < interval {
+						continue
+					}
+					err := s.attachRemote(db, name, u)
+					if err != nil && urls[name] != u {
+						// Tables attached from the remote cluster at its
+						// old URL must not be read.
+						db.DetachRemote(name)
+					}
+					urls[name] = u
+					attempted[name] = time.Now()
+					failed[name] = err != nil
+					s.setRemoteError(name, err)
+				}
+			case <-closeCh:
+				return
+			}
+		}
+	}()
+	return closeCh, doneCh
+}
+
+func (s *Store) attachRemote(db *sql.DB, name, u string) error {
+	rc, err := newRemoteCluster(u)
+	if err != nil {
+		return err
+	}
+	if err := db.AttachRemote(name, rc); err != nil {
+		stats.Add(numRemoteAttachFailures, 1)
+		return err
+	}
+	stats.Add(numRemoteAttaches, 1)
+	return nil
+}
+
+// setRemoteError records err, the outcome of attaching the named remote
+// cluster, logging it if it differs from the last outcome.
+func (s *Store) setRemoteError(name string, err error) {
+	s.remotesMu.Lock()
+	defer s.remotesMu.Unlock()
+	if err == nil {
+		delete(s.remoteErrors, name)
+		return
+	}
+	if s.remoteErrors[name] != err.Error() {
+		s.logger.Printf("failed to attach remote cluster %s: %s", name, err.Error())
+	}
+	s.remoteErrors[name] = err.Error()
+}
+
+// remoteCluster reads the tables of a remote rqlite cluster through its HTTP
+// API. It implements db.Remote.
+type remoteCluster struct {
+	url    *url.URL
+	client *http.Client
+}
+
+func newRemoteCluster(u string) (*remoteCluster, error) {
+	parsed, err := url.Parse(u)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s", ErrRemoteInvalid, err.Error())
+	}
+	if (parsed.Scheme != "http" && parsed.Scheme != "https") || parsed.Host == "" {
+		return nil, fmt.Errorf("%w: URL must be an http or https URL", ErrRemoteInvalid)
+	}
+	return &remoteCluster{
+		url:    parsed,
+		client: &http.Client{Timeout: remoteTimeout},
+	}, nil
+}
+
+// remoteRows are the results of a query of a remote cluster.
+type remoteRows struct {
+	Columns []string        `json:"columns"`
+	Types   []string        `json:"types"`
+	Values  [][]interface{} `json:"values"`
+	Error   string          `json:"error"`
+}
+
+// query executes the query q against the remote cluster.
+func (r *remoteCluster) query(q string) (*remoteRows, error) {
+	body, err := json.Marshal([]string{q})
+	if err != nil {
+		return nil, err
+	}
+	u := *r.url
+	u.Path = strings.TrimRight(u.Path, "/") + "/db/query"
+	resp, err := r.client.Post(u.String(), "application/json", bytes.NewReader(body))
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s", ErrRemoteUnavailable, err.Error())
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		b, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return nil, fmt.Errorf("%w: %s: %s", ErrRemoteUnavailable, resp.Status, strings.TrimSpace(string(b)))
+	}
+
+	var qr struct {
+		Results []*remoteRows `json:"results"`
+		Error   string        `json:"error"`
+	}
+	dec := json.NewDecoder(resp.Body)
+	dec.UseNumber()
+	if err := dec.Decode(&qr); err != nil {
+		return nil, fmt.Errorf("%w: %s", ErrRemoteUnavailable, err.Error())
+	}
+	if qr.Error != "" {
+		return nil, fmt.Errorf("%w: %s", ErrRemoteUnavailable, qr.Error)
+	}
+	if len(qr.Results) != 1 {
+		return nil, fmt.Errorf("%w: unexpected number of results: %d", ErrRemoteUnavailable, len(qr.Results))
+	}
+	if qr.Results[0].Error != "" {
+		return nil, errors.New(qr.Results[0].Error)
+	}
+	return qr.Results[0], nil
+}
+
+// Tables implements db.Remote, returning the tables and views of the remote
+// cluster, other than those managed by SQLite or rqlite.
+func (r *remoteCluster) Tables() ([]*sql.RemoteTable, error) {
+	rows, err := r.query(`SELECT m.name, p.name, p.type FROM sqlite_master AS m JOIN pragma_table_info(m.name) AS p` +
+		` WHERE m.type IN ('table', 'view') AND m.name NOT LIKE 'sqlite\_%' ESCAPE '\'` +
+		` AND m.name NOT LIKE '` + strings.ReplaceAll(sql.ManagedTablePrefix, "_", `\_`) + `%' ESCAPE '\'` +
+		` ORDER BY m.name, p.cid`)
+	if err != nil {
+		return nil, err
+	}
+
+	var tables []*sql.RemoteTable
+	for _, v := range rows.Values {
+		if len(v) != 3 {
+			return nil, fmt.Errorf("%w: unexpected number of columns reading tables: %d", ErrRemoteUnavailable, len(v))
+		}
+		name, _ := v[0].(string)
+		col, _ := v[1].(string)
+		typ, _ := v[2].(string)
+		if len(tables) == 0 || tables[len(tables)-1].Name != name {
+			tables = append(tables, &sql.RemoteTable{Name: name})
+		}
+		t := tables[len(tables)-1]
+		t.Columns = append(t.Columns, col)
+		t.Types = append(t.Types, typ)
+	}
+	return tables, nil
+}
+
+// Scan implements db.Remote, reading every row of the table.
+func (r *remoteCluster) Scan(table string, columns []string) ([][]interface{}, error) {
+	cols := make([]string, len(columns))
+	for i, c := range columns {
+		cols[i] = quoteIdent(c)
+	}
+	rows, err := r.query(fmt.Sprintf(`SELECT %s FROM %s`, strings.Join(cols, ", "), quoteIdent(table)))
+	if err != nil {
+		return nil, err
+	}
+
+	values := make([][]interface{}, len(rows.Values))
+	for i, row := range rows.Values {
+		values[i] = make([]interface{}, len(row))
+		for j, v := range row {
+			var typ string
+			if j < len(rows.Types) {
+				typ = rows.Types[j]
+			}
+			values[i][j] = remoteValue(v, typ)
+		}
+	}
+	return values, nil
+}
+
+// remoteValue returns the value v, read from a column of the given type in a
+// response of a remote cluster, as the value SQLite would hold.
+func remoteValue(v interface{}, typ string) interface{} {
+	switch val := v.(type) {
+	case json.Number:
+		if i, err := val.Int64(); err == nil {
+			return i
+		}
+		f, _ := val.Float64()
+		return f
+	case string:
+		// rqlite encodes blobs in base64.
+		if strings.EqualFold(typ, "blob") {
+			if b, err := base64.StdEncoding.DecodeString(val); err == nil {
+				return b
+			}
+		}
+		return val
+	case bool, nil:
+		return val
+	default:
+		// Values of other types, such as JSON, are passed on as JSON.
+		b, _ := json.Marshal(val)
+		return string(b)
+	}
+}
+
+// quoteIdent returns s quoted as an SQLite identifier.
+func quoteIdent(s string) string {
+	return `"` + strings.ReplaceAll(s, `"`, `""`) + `"`
+}
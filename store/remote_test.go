@@ -0,0 +1,156 @@
+package store
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/rqlite/rqlite/command"
+	sql "github.com/rqlite/rqlite/db"
+)
+
+// mustNewRemoteServer returns a server serving queries of the store s as an
+// rqlite node does.
+func mustNewRemoteServer(s *Store) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != "POST" || r.URL.Path != "/db/query" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		var stmts []string
+		if err := json.NewDecoder(r.Body).Decode(&stmts); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		rows, err := s.Query(queryRequestFromStrings(stmts, false, false))
+		if err != nil {
+			fmt.Fprintf(w, `{"error":%q}`, err.Error())
+			return
+		}
+		fmt.Fprintf(w, `{"results":%s}`, asJSON(rows))
+	}))
+}
+
+func Test_SingleNodeRemote(t *testing.T) {
+	s, ln := mustNewStore(t, true)
+	defer ln.Close()
+	s.RemoteCheckInterval = 100 * time.Millisecond
+	if err := s.Open(); err != nil {
+		t.Fatalf("failed to open single-node store: %s", err.Error())
+	}
+	if err := s.Bootstrap(NewServer(s.ID(), s.Addr(), true)); err != nil {
+		t.Fatalf("failed to bootstrap single-node store: %s", err.Error())
+	}
+	defer s.Close(true)
+	if _, err := s.WaitForLeader(10 * time.Second); err != nil {
+		t.Fatalf("Error waiting for leader: %s", err)
+	}
+
+	if !sql.RemoteTablesSupported {
+		if err := s.RegisterRemote(&Remote{Name: "eu", URL: "http://localhost:4001"}); !errors.Is(err, sql.ErrRemoteTablesUnsupported) {
+			t.Fatalf("wrong error registering remote without virtual tables: %v", err)
+		}
+		return
+	}
+
+	rs, rln := mustNewStore(t, true)
+	defer rln.Close()
+	if err := rs.Open(); err != nil {
+		t.Fatalf("failed to open remote store: %s", err.Error())
+	}
+	if err := rs.Bootstrap(NewServer(rs.ID(), rs.Addr(), true)); err != nil {
+		t.Fatalf("failed to bootstrap remote store: %s", err.Error())
+	}
+	defer rs.Close(true)
+	if _, err := rs.WaitForLeader(10 * time.Second); err != nil {
+		t.Fatalf("Error waiting for leader: %s", err)
+	}
+	_, err := rs.Execute(executeRequestFromStrings([]string{
+		`CREATE TABLE users (id INTEGER NOT NULL PRIMARY KEY, name TEXT, avatar BLOB)`,
+		`INSERT INTO users(id, name, avatar) VALUES(1, "fiona", x'0102')`,
+		`INSERT INTO users(id, name) VALUES(2, "declan")`,
+	}, false, false))
+	if err != nil {
+		t.Fatalf("failed to execute on remote store: %s", err.Error())
+	}
+	srv := mustNewRemoteServer(rs)
+	defer srv.Close()
+
+	if _, err := s.Execute(executeRequestFromStrings([]string{
+		`CREATE TABLE orders (user_id INTEGER, amount INTEGER)`,
+		`INSERT INTO orders VALUES(1, 10)`,
+		`INSERT INTO orders VALUES(1, 15)`,
+		`INSERT INTO orders VALUES(2, 7)`,
+	}, false, false)); err != nil {
+		t.Fatalf("failed to execute on single node: %s", err.Error())
+	}
+
+	for _, r := range []*Remote{
+		{Name: "eu-west", URL: srv.URL},
+		{Name: "main", URL: srv.URL},
+		{Name: "eu", URL: "ftp://example.com"},
+		{Name: "eu", URL: "not a URL"},
+	} {
+		if err := s.RegisterRemote(r); !errors.Is(err, ErrRemoteInvalid) {
+			t.Fatalf("invalid remote %+v registered: %v", r, err)
+		}
+	}
+	if err := s.RegisterRemote(&Remote{Name: "eu", URL: "http://" + ln.Addr().String()}); !errors.Is(err, ErrRemoteUnavailable) {
+		t.Fatalf("unavailable remote registered: %v", err)
+	}
+	if err := s.RegisterRemote(&Remote{Name: "eu", URL: srv.URL}); err != nil {
+		t.Fatalf("failed to register remote: %s", err.Error())
+	}
+
+	testPoll(t, func() bool {
+		remotes, err := s.Remotes()
+		return err == nil && len(remotes) == 1 && len(remotes[0].Tables) == 1
+	}, 100*time.Millisecond, 5*time.Second)
+	remotes, err := s.Remotes()
+	if err != nil {
+		t.Fatalf("failed to list remotes: %s", err.Error())
+	}
+	if exp, got := fmt.Sprintf(`[{"Name":"eu","URL":"%s","Tables":["users"],"Error":""}]`, srv.URL), asJSON(remotes); exp != got {
+		t.Fatalf("wrong remotes\nexp: %s\ngot: %s", exp, got)
+	}
+
+	qr := queryRequestFromString(`SELECT u.name, SUM(o.amount), u.avatar FROM orders AS o JOIN eu.users AS u ON o.user_id = u.id GROUP BY u.id ORDER BY u.id`, false, false)
+	qr.Level = command.QueryRequest_QUERY_REQUEST_LEVEL_NONE
+	r, err := s.Query(qr)
+	if err != nil {
+		t.Fatalf("failed to query remote table: %s", err.Error())
+	}
+	if exp, got := `[{"columns":["name","SUM(o.amount)","avatar"],"types":["text","","blob"],"values":[["fiona",25,"AQI="],["declan",7,null]]}]`, asJSON(r); exp != got {
+		t.Fatalf("wrong results\nexp: %s\ngot: %s", exp, got)
+	}
+
+	// Reads through the Raft log, and writes, may not read remote tables, as
+	// every node would read the remote cluster at a different time.
+	qr.Level = command.QueryRequest_QUERY_REQUEST_LEVEL_STRONG
+	if r, err = s.Query(qr); err != nil || r[0].Error == "" {
+		t.Fatalf("remote table read by strong query: %s", asJSON(r))
+	}
+	e, err := s.Execute(executeRequestFromString(`INSERT INTO orders SELECT id, 0 FROM eu.users`, false, false))
+	if err != nil || e[0].Error == "" {
+		t.Fatalf("remote table read by execute: %s", asJSON(e))
+	}
+
+	if err := s.UnregisterRemote("nothere"); !errors.Is(err, ErrRemoteNotFound) {
+		t.Fatalf("wrong error unregistering missing remote: %v", err)
+	}
+	if err := s.UnregisterRemote("eu"); err != nil {
+		t.Fatalf("failed to unregister remote: %s", err.Error())
+	}
+	qr.Level = command.QueryRequest_QUERY_REQUEST_LEVEL_NONE
+	testPoll(t, func() bool {
+		r, err := s.Query(qr)
+		return err == nil && r[0].Error != ""
+	}, 100*time.Millisecond, 5*time.Second)
+	if remotes, err := s.Remotes(); err != nil || len(remotes) != 0 {
+		t.Fatalf("remote still registered: %s", asJSON(remotes))
+	}
+}
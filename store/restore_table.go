@@ -0,0 +1,88 @@
+package store
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/hashicorp/raft"
+	"github.com/rqlite/rqlite/command"
+	sql "github.com/rqlite/rqlite/db"
+)
+
+// RestoreTable replaces a single table of the database with the table of the
+// same name held in a backup, leaving all other tables untouched. The backup
+// may be either a SQLite database file, or a SQL text dump. The table, with
+// its rows, indexes, and triggers, is extracted from the backup on this node,
+// and then dropped and recreated in a single replicated transaction, so every
+// node either restores the whole table or none of it.
+func (s *Store) RestoreTable(backup []byte, table string) ([]*command.ExecuteResult, error) {
+	if !s.open {
+		return nil, ErrNotOpen
+	}
+	// Extracting the table may be expensive, so check leadership first.
+	if s.raft.State() != raft.Leader {
+		return nil, ErrNotLeader
+	}
+
+	stmts, err := backupTableStatements(backup, table)
+	if err != nil {
+		return nil, err
+	}
+
+	req := &command.Request{
+		Transaction: true,
+		Statements: []*command.Statement{
+			{Sql: fmt.Sprintf(`DROP TABLE IF EXISTS "%s"`, strings.Replace(table, `"`, `""`, -1))},
+		},
+	}
+	for _, stmt := range stmts {
+		req.Statements = append(req.Statements, &command.Statement{Sql: stmt})
+	}
+	results, err := s.Execute(&command.ExecuteRequest{Request: req})
+	if err != nil {
+		return nil, err
+	}
+	for _, r := range results {
+		if r.Error != "" {
+			return results, fmt.Errorf("failed to restore table %s: %s", table, r.Error)
+		}
+	}
+	stats.Add(numTableRestores, 1)
+	s.logger.Printf("restored table %s from backup, %d statements", table, len(stmts))
+	return results, nil
+}
+
+// backupTableStatements returns the SQL statements which recreate table, as
+// held in backup.
+func backupTableStatements(backup []byte, table string) ([]string, error) {
+	var bdb *sql.DB
+	var err error
+	if sql.IsValidSQLiteData(backup) {
+		bdb, err = sql.DeserializeIntoMemory(backup, false)
+		if err != nil {
+			return nil, err
+		}
+	} else {
+		bdb, err = sql.OpenInMemory(false)
+		if err != nil {
+			return nil, err
+		}
+		results, err := bdb.ExecuteStringStmt(string(backup))
+		if err == nil {
+			for _, r := range results {
+				if r.Error != "" {
+					err = errors.New(r.Error)
+					break
+				}
+			}
+		}
+		if err != nil {
+			bdb.Close()
+			return nil, fmt.Errorf("failed to read SQL backup: %s", err.Error())
+		}
+	}
+	defer bdb.Close()
+
+	return bdb.DumpTable(table)
+}
@@ -0,0 +1,89 @@
+package store
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	sql "github.com/rqlite/rqlite/db"
+)
+
+func Test_SingleNodeRestoreTable(t *testing.T) {
+	s, ln := mustNewStore(t, true)
+	defer ln.Close()
+
+	if err := s.Open(); err != nil {
+		t.Fatalf("failed to open single-node store: %s", err.Error())
+	}
+	defer s.Close(true)
+	if err := s.Bootstrap(NewServer(s.ID(), s.Addr(), true)); err != nil {
+		t.Fatalf("failed to bootstrap single-node store: %s", err.Error())
+	}
+	if _, err := s.WaitForLeader(10 * time.Second); err != nil {
+		t.Fatalf("Error waiting for leader: %s", err)
+	}
+
+	mustExec := func(stmt string) {
+		t.Helper()
+		results, err := s.Execute(executeRequestFromString(stmt, false, false))
+		if err != nil {
+			t.Fatalf("failed to execute %s: %s", stmt, err.Error())
+		}
+		if results[0].Error != "" {
+			t.Fatalf("failed to execute %s: %s", stmt, results[0].Error)
+		}
+	}
+	query := func(q string) string {
+		t.Helper()
+		r, err := s.Query(queryRequestFromString(q, false, false))
+		if err != nil {
+			t.Fatalf("failed to query %s: %s", q, err.Error())
+		}
+		return asJSON(r)
+	}
+
+	mustExec(`CREATE TABLE foo (id INTEGER NOT NULL PRIMARY KEY, name TEXT)`)
+	mustExec(`CREATE INDEX foo_name ON foo(name)`)
+	mustExec(`CREATE TABLE bar (id INTEGER NOT NULL PRIMARY KEY)`)
+	mustExec(`INSERT INTO foo(id, name) VALUES(1, "fiona")`)
+	mustExec(`INSERT INTO bar(id) VALUES(1)`)
+
+	var binary, text bytes.Buffer
+	if err := s.Backup(backupRequestBinary(true), &binary); err != nil {
+		t.Fatalf("failed to backup node: %s", err.Error())
+	}
+	if err := s.Backup(backupRequestSQL(true), &text); err != nil {
+		t.Fatalf("failed to backup node: %s", err.Error())
+	}
+
+	for name, backup := range map[string][]byte{"binary": binary.Bytes(), "text": text.Bytes()} {
+		// Fat-finger foo, and change bar.
+		mustExec(`DROP INDEX foo_name`)
+		mustExec(`DELETE FROM foo`)
+		mustExec(`INSERT INTO bar(id) VALUES(2)`)
+
+		if _, err := s.RestoreTable(backup, "foo"); err != nil {
+			t.Fatalf("failed to restore table from %s backup: %s", name, err.Error())
+		}
+		if exp, got := `[{"columns":["id","name"],"types":["integer","text"],"values":[[1,"fiona"]]}]`,
+			query(`SELECT * FROM foo`); exp != got {
+			t.Fatalf("table not restored from %s backup\nexp: %s\ngot: %s", name, exp, got)
+		}
+		if exp, got := `[{"columns":["COUNT(*)"],"types":[""],"values":[[1]]}]`,
+			query(`SELECT COUNT(*) FROM sqlite_master WHERE name = 'foo_name'`); exp != got {
+			t.Fatalf("index not restored from %s backup\nexp: %s\ngot: %s", name, exp, got)
+		}
+		if exp, got := `[{"columns":["id"],"types":["integer"],"values":[[1],[2]]}]`,
+			query(`SELECT * FROM bar`); exp != got {
+			t.Fatalf("other table changed by restore from %s backup\nexp: %s\ngot: %s", name, exp, got)
+		}
+		mustExec(`DELETE FROM bar WHERE id = 2`)
+	}
+
+	if _, err := s.RestoreTable(binary.Bytes(), "qux"); err != sql.ErrTableNotFound {
+		t.Fatalf("restoring missing table returned wrong error: %v", err)
+	}
+	if _, err := s.RestoreTable([]byte("not SQL"), "foo"); err == nil {
+		t.Fatalf("restoring from invalid backup succeeded")
+	}
+}
@@ -0,0 +1,132 @@
+package store
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/rqlite/rqlite/command"
+	sql "github.com/rqlite/rqlite/db"
+)
+
+// schemaVersionTable is the table, managed by rqlite, holding the version of
+// the schema of the database.
+const schemaVersionTable = sql.ManagedTablePrefix + "schema_version"
+
+var (
+	// ErrSchemaVersion is returned when a query requires a schema version
+	// newer than that of the database.
+	ErrSchemaVersion = errors.New("schema version older than required")
+)
+
+// schemaVersionStmts are appended to each batch of statements which changes
+// the schema, incrementing the schema version in the same transaction. SQLite
+// reports the last row inserted, and the number of rows changed, by each
+// connection, and reports them again for DDL statements. So the table has no
+// rowid, and a final statement changing no rows resets the count, so that
+// neither is seen by later requests.
+var schemaVersionStmts = []*command.Statement{
+	{
+		Sql: `CREATE TABLE IF NOT EXISTS ` + schemaVersionTable +
+			` (id INTEGER NOT NULL PRIMARY KEY CHECK (id = 1), version INTEGER NOT NULL) WITHOUT ROWID`,
+	},
+	{
+		Sql: `INSERT INTO ` + schemaVersionTable + ` (id, version) VALUES (1, 1)` +
+			` ON CONFLICT (id) DO UPDATE SET version = version + 1`,
+	},
+	{
+		Sql: `DELETE FROM ` + schemaVersionTable + ` WHERE 0`,
+	},
+}
+
+// stampSchemaVersion returns, if any of the statements of req changes the
+// schema, a request which also increments the schema version. Otherwise it
+// returns req. If atomic is set, the statements are applied in a single
+// transaction, whether or not req requests one. If the statements control
+// transactions themselves, as a dump does, the version is incremented within
+// their final transaction where possible. The statements stamping the version
+// are written to the Raft log, so that every node applies exactly the same
+// change, whatever its version of rqlite.
+func stampSchemaVersion(req *command.Request, atomic bool) (*command.Request, bool) {
+	stmts := req.GetStatements()
+	if !command.ContainsDDL(stmts) {
+		return req, false
+	}
+
+	if command.ContainsTransactionControl(stmts) {
+		last := stmts[len(stmts)-1]
+		if s, ok := command.InsertBeforeCommit(last.Sql, schemaVersionSQL()); ok {
+			stamped := make([]*command.Statement, len(stmts))
+			copy(stamped, stmts)
+			stamped[len(stmts)-1] = &command.Statement{
+				Sql:           s,
+				Parameters:    last.Parameters,
+				ParameterSets: last.ParameterSets,
+			}
+			return &command.Request{
+				Transaction: req.Transaction,
+				Partial:     req.Partial,
+				Statements:  stamped,
+			}, true
+		}
+	}
+
+	stamped := make([]*command.Statement, 0, len(stmts)+len(schemaVersionStmts))
+	stamped = append(stamped, stmts...)
+	stamped = append(stamped, schemaVersionStmts...)
+	return &command.Request{
+		Transaction: req.Transaction || (atomic && !command.ContainsTransactionControl(stmts)),
+		Partial:     req.Partial,
+		Statements:  stamped,
+	}, true
+}
+
+// schemaVersionSQL returns the statements stamping the schema version, as a
+// single string.
+func schemaVersionSQL() string {
+	sqls := make([]string, len(schemaVersionStmts))
+	for i, stmt := range schemaVersionStmts {
+		sqls[i] = stmt.Sql
+	}
+	return strings.Join(sqls, ";\n")
+}
+
+// SchemaVersion returns the version of the schema of the database, which is
+// incremented by each batch of statements which changes the schema. It is 0
+// if the schema has never been changed through rqlite.
+func (s *Store) SchemaVersion() (int64, error) {
+	rows, err := s.db.QueryStringStmt(`SELECT version FROM ` + schemaVersionTable + ` WHERE id = 1`)
+	if err != nil {
+		return 0, err
+	}
+	if len(rows) != 1 {
+		return 0, fmt.Errorf("unexpected number of results querying schema version: %d", len(rows))
+	}
+	if rows[0].Error != "" {
+		if strings.Contains(rows[0].Error, "no such table") {
+			return 0, nil
+		}
+		return 0, errors.New(rows[0].Error)
+	}
+	if len(rows[0].Values) == 0 || len(rows[0].Values[0].Parameters) == 0 {
+		return 0, nil
+	}
+	return rows[0].Values[0].Parameters[0].GetI(), nil
+}
+
+// checkSchemaVersion returns ErrSchemaVersion if the schema version of the
+// database is older than min.
+func (s *Store) checkSchemaVersion(min int64) error {
+	if min <= 0 {
+		return nil
+	}
+	v, err := s.SchemaVersion()
+	if err != nil {
+		return err
+	}
+	if v < min {
+		stats.Add(numSchemaVersionRejected, 1)
+		return fmt.Errorf("%w: version is %d, %d required", ErrSchemaVersion, v, min)
+	}
+	return nil
+}
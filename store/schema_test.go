@@ -0,0 +1,162 @@
+package store
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/rqlite/rqlite/command"
+)
+
+func Test_StampSchemaVersion(t *testing.T) {
+	req := &command.Request{
+		Statements: []*command.Statement{{Sql: `INSERT INTO foo(name) VALUES("fiona")`}},
+	}
+	if r, stamped := stampSchemaVersion(req, true); stamped || r != req {
+		t.Fatalf("request without DDL stamped")
+	}
+
+	req.Statements = append(req.Statements, &command.Statement{Sql: `CREATE TABLE bar (id INTEGER)`})
+	r, stamped := stampSchemaVersion(req, true)
+	if !stamped {
+		t.Fatalf("request with DDL not stamped")
+	}
+	if !r.Transaction {
+		t.Fatalf("stamped request not applied in a transaction")
+	}
+	if exp, got := 2+len(schemaVersionStmts), len(r.Statements); exp != got {
+		t.Fatalf("wrong number of statements, exp %d, got %d", exp, got)
+	}
+	if len(req.Statements) != 2 {
+		t.Fatalf("original request modified")
+	}
+
+	if r, _ := stampSchemaVersion(req, false); r.Transaction {
+		t.Fatalf("non-atomic request applied in a transaction")
+	}
+
+	// A dump is stamped within its own transaction.
+	req.Statements = []*command.Statement{{Sql: "BEGIN TRANSACTION;\nCREATE TABLE foo (id INTEGER);\nCOMMIT;\n"}}
+	r, stamped = stampSchemaVersion(req, true)
+	if !stamped {
+		t.Fatalf("dump not stamped")
+	}
+	if r.Transaction || len(r.Statements) != 1 {
+		t.Fatalf("dump not stamped within its own transaction: %s", asJSON(r))
+	}
+	if exp, got := "BEGIN TRANSACTION;\nCREATE TABLE foo (id INTEGER);\n"+schemaVersionSQL()+";\nCOMMIT;\n", r.Statements[0].Sql; exp != got {
+		t.Fatalf("wrong stamped dump\nexp: %s\ngot: %s", exp, got)
+	}
+}
+
+func Test_SingleNodeSchemaVersion(t *testing.T) {
+	s, ln := mustNewStore(t, true)
+	defer ln.Close()
+
+	if err := s.Open(); err != nil {
+		t.Fatalf("failed to open single-node store: %s", err.Error())
+	}
+	if err := s.Bootstrap(NewServer(s.ID(), s.Addr(), true)); err != nil {
+		t.Fatalf("failed to bootstrap single-node store: %s", err.Error())
+	}
+	defer s.Close(true)
+	if _, err := s.WaitForLeader(10 * time.Second); err != nil {
+		t.Fatalf("Error waiting for leader: %s", err)
+	}
+
+	checkVersion := func(exp int64) {
+		t.Helper()
+		v, err := s.SchemaVersion()
+		if err != nil {
+			t.Fatalf("failed to get schema version: %s", err.Error())
+		}
+		if v != exp {
+			t.Fatalf("wrong schema version, exp %d, got %d", exp, v)
+		}
+	}
+	checkVersion(0)
+
+	er := executeRequestFromStrings([]string{
+		`CREATE TABLE foo (id INTEGER NOT NULL PRIMARY KEY, name TEXT)`,
+		`INSERT INTO foo(id, name) VALUES(1, "fiona")`,
+	}, false, false)
+	r, err := s.Execute(er)
+	if err != nil {
+		t.Fatalf("failed to execute on single node: %s", err.Error())
+	}
+	if exp, got := `[{},{"last_insert_id":1,"rows_affected":1}]`, asJSON(r); exp != got {
+		t.Fatalf("unexpected results for execute\nexp: %s\ngot: %s", exp, got)
+	}
+	checkVersion(1)
+
+	// Writes which leave the schema unchanged leave the version unchanged.
+	er = executeRequestFromString(`INSERT INTO foo(id, name) VALUES(2, "fiona")`, false, false)
+	if _, err := s.Execute(er); err != nil {
+		t.Fatalf("failed to execute on single node: %s", err.Error())
+	}
+	checkVersion(1)
+
+	// A DDL batch which fails is rolled back in full, leaving the version
+	// unchanged.
+	er = executeRequestFromStrings([]string{
+		`ALTER TABLE foo ADD COLUMN age INTEGER`,
+		`CREATE TABLE foo (id INTEGER)`,
+	}, false, false)
+	r, err = s.Execute(er)
+	if err != nil {
+		t.Fatalf("failed to execute on single node: %s", err.Error())
+	}
+	if len(r) != 2 || r[1].Error == "" {
+		t.Fatalf("expected failure of DDL batch, got %s", asJSON(r))
+	}
+	checkVersion(1)
+	qr := queryRequestFromString("SELECT * FROM foo", false, false)
+	rows, err := s.Query(qr)
+	if err != nil {
+		t.Fatalf("failed to query single node: %s", err.Error())
+	}
+	if exp, got := `["id","name"]`, asJSON(rows[0].Columns); exp != got {
+		t.Fatalf("failed DDL batch not rolled back\nexp: %s\ngot: %s", exp, got)
+	}
+
+	eqr := &command.ExecuteQueryRequest{
+		Request: &command.Request{
+			Statements: []*command.Statement{
+				{Sql: `ALTER TABLE foo ADD COLUMN age INTEGER`},
+				{Sql: `SELECT * FROM foo`},
+			},
+		},
+	}
+	resps, err := s.Request(eqr)
+	if err != nil {
+		t.Fatalf("failed to request on single node: %s", err.Error())
+	}
+	if len(resps) != 2 {
+		t.Fatalf("wrong number of responses, exp 2, got %d", len(resps))
+	}
+	if exp, got := `{"columns":["id","name","age"],"types":["integer","text","integer"],"values":[[1,"fiona",null],[2,"fiona",null]]}`, asJSON(resps[1].GetQ()); exp != got {
+		t.Fatalf("unexpected results for request\nexp: %s\ngot: %s", exp, got)
+	}
+	checkVersion(2)
+
+	qr.MinSchemaVersion = 2
+	if _, err := s.Query(qr); err != nil {
+		t.Fatalf("query requiring current schema version failed: %s", err.Error())
+	}
+	qr.MinSchemaVersion = 3
+	if _, err := s.Query(qr); !errors.Is(err, ErrSchemaVersion) {
+		t.Fatalf("query requiring newer schema version did not fail correctly, got %v", err)
+	}
+	qr.Level = command.QueryRequest_QUERY_REQUEST_LEVEL_STRONG
+	if _, err := s.Query(qr); !errors.Is(err, ErrSchemaVersion) {
+		t.Fatalf("strong query requiring newer schema version did not fail correctly, got %v", err)
+	}
+
+	status, err := s.Stats()
+	if err != nil {
+		t.Fatalf("failed to get store stats: %s", err.Error())
+	}
+	if exp, got := int64(2), status["schema_version"]; exp != got {
+		t.Fatalf("wrong schema version in stats, exp %d, got %v", exp, got)
+	}
+}
@@ -0,0 +1,121 @@
+package store
+
+import (
+	"io"
+	"sync/atomic"
+	"time"
+
+	"github.com/hashicorp/raft"
+)
+
+// snapshotSendTransport is the network transport provided to Raft, which
+// limits the number of snapshots sent to other nodes concurrently, and the
+// rate at which each is sent, so that nodes catching up cannot saturate this
+// node's disk and network, and cause it to miss heartbeats.
+type snapshotSendTransport struct {
+	*raft.NetworkTransport
+
+	slots    chan struct{} // Holds a value for each send in progress, nil if unlimited.
+	rate     int64         // Bytes per second for each send, 0 if unlimited.
+	inFlight int64
+}
+
+// newSnapshotSendTransport returns a snapshotSendTransport wrapping tn, which
+// sends at most max snapshots concurrently, each at most rate bytes per second.
+// A zero max or rate means no limit.
+func newSnapshotSendTransport(tn *raft.NetworkTransport, max int, rate int64) *snapshotSendTransport {
+	t := &snapshotSendTransport{
+		NetworkTransport: tn,
+		rate:             rate,
+	}
+	if max > 0 {
+		t.slots = make(chan struct{}, max)
+	}
+	if rate > 0 {
+		// The transport allows a send its timeout for each TimeoutScale bytes,
+		// so ensure a rate-limited send has time to complete, with headroom.
+		scale := rate * int64(connectionTimeout/time.Second) / 2
+		if scale < 1 {
+			scale = 1
+		}
+		if scale < int64(tn.TimeoutScale) {
+			tn.TimeoutScale = int(scale)
+		}
+	}
+	return t
+}
+
+// InstallSnapshot implements the raft.Transport interface. It waits until
+// fewer than the maximum number of snapshots are being sent.
+func (t *snapshotSendTransport) InstallSnapshot(id raft.ServerID, target raft.ServerAddress,
+	args *raft.InstallSnapshotRequest, resp *raft.InstallSnapshotResponse, data io.Reader) error {
+	if t.slots != nil {
+		select {
+		case t.slots <- struct{}{}:
+		default:
+			stats.Add(numSnapshotSendWaits, 1)
+			t.slots <- struct{}{}
+		}
+		defer func() { <-t.slots }()
+	}
+	atomic.AddInt64(&t.inFlight, 1)
+	defer atomic.AddInt64(&t.inFlight, -1)
+
+	stats.Add(numSnapshotSends, 1)
+	if t.rate > 0 {
+		data = newRateLimitedReader(data, t.rate)
+	}
+	return t.NetworkTransport.InstallSnapshot(id, target, args, resp, data)
+}
+
+// InFlight returns the number of snapshots being sent.
+func (t *snapshotSendTransport) InFlight() int64 {
+	return atomic.LoadInt64(&t.inFlight)
+}
+
+// rateLimitedReader is an io.Reader which reads no faster than a given rate.
+type rateLimitedReader struct {
+	r     io.Reader
+	rate  int64 // Bytes per second.
+	chunk int   // Most bytes returned by each read.
+	start time.Time
+	n     int64
+}
+
+// newRateLimitedReader returns a reader which reads from r at most rate bytes
+// per second.
+func newRateLimitedReader(r io.Reader, rate int64) *rateLimitedReader {
+	// Read in chunks of at most a tenth of a second's worth, so that the
+	// rate is smooth rather than bursty.
+	chunk := rate / 10
+	if chunk < 1 {
+		chunk = 1
+	}
+	if chunk > 1<<20 {
+		chunk = 1 << 20
+	}
+	return &rateLimitedReader{
+		r:     r,
+		rate:  rate,
+		chunk: int(chunk),
+	}
+}
+
+// Read implements the io.Reader interface. It sleeps, if necessary, so that
+// the bytes read so far have taken at least as long as the rate allows.
+func (l *rateLimitedReader) Read(p []byte) (int, error) {
+	if l.start.IsZero() {
+		l.start = time.Now()
+	}
+	if len(p) > l.chunk {
+		p = p[:l.chunk]
+	}
+	n, err := l.r.Read(p)
+	l.n += int64(n)
+
+	due := l.start.Add(time.Duration(float64(l.n) / float64(l.rate) * float64(time.Second)))
+	if d := time.Until(due); d > 0 {
+		time.Sleep(d)
+	}
+	return n, err
+}
@@ -0,0 +1,120 @@
+package store
+
+import (
+	"bytes"
+	"expvar"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/raft"
+	"github.com/rqlite/rqlite/command"
+)
+
+func Test_RateLimitedReader(t *testing.T) {
+	data := make([]byte, 100*1024)
+	r := newRateLimitedReader(bytes.NewReader(data), 1024*1024)
+
+	start := time.Now()
+	b, err := io.ReadAll(r)
+	if err != nil {
+		t.Fatalf("failed to read: %s", err.Error())
+	}
+	if len(b) != len(data) {
+		t.Fatalf("wrong number of bytes read, exp %d, got %d", len(data), len(b))
+	}
+	if d := time.Since(start); d < 90*time.Millisecond {
+		t.Fatalf("read 100KB at 1MB/s too quickly, took %s", d)
+	}
+}
+
+func Test_SnapshotSendTransportTimeoutScale(t *testing.T) {
+	tn := raft.NewNetworkTransport(NewTransport(mustMockLister("localhost:0")), 1, connectionTimeout, nil)
+	defer tn.Close()
+	newSnapshotSendTransport(tn, 1, 0)
+	if tn.TimeoutScale != raft.DefaultTimeoutScale {
+		t.Fatalf("timeout scale changed without rate limit, got %d", tn.TimeoutScale)
+	}
+
+	// A send limited to 1KB per second must be allowed its timeout for each
+	// 5KB, rather than each 256KB.
+	newSnapshotSendTransport(tn, 1, 1024)
+	if exp, got := 5*1024, tn.TimeoutScale; exp != got {
+		t.Fatalf("wrong timeout scale, exp %d, got %d", exp, got)
+	}
+}
+
+func Test_MultiNodeSnapshotSendLimited(t *testing.T) {
+	s0, ln0 := mustNewStore(t, true)
+	defer ln0.Close()
+	s0.SnapshotThreshold = 4
+	s0.SnapshotInterval = 100 * time.Millisecond
+	s0.SnapshotSendMax = 1
+	s0.SnapshotSendRate = 1024 * 1024
+	if err := s0.Open(); err != nil {
+		t.Fatalf("failed to open single-node store: %s", err.Error())
+	}
+	defer s0.Close(true)
+	if err := s0.Bootstrap(NewServer(s0.ID(), s0.Addr(), true)); err != nil {
+		t.Fatalf("failed to bootstrap single-node store: %s", err.Error())
+	}
+	if _, err := s0.WaitForLeader(10 * time.Second); err != nil {
+		t.Fatalf("Error waiting for leader: %s", err)
+	}
+
+	er := executeRequestFromStrings([]string{
+		`CREATE TABLE foo (id INTEGER NOT NULL PRIMARY KEY, name TEXT)`,
+	}, false, false)
+	if _, err := s0.Execute(er); err != nil {
+		t.Fatalf("failed to execute on single node: %s", err.Error())
+	}
+	for i := 0; i < 10; i++ {
+		er := executeRequestFromStrings([]string{
+			`INSERT INTO foo(name) VALUES("fiona")`,
+		}, false, false)
+		if _, err := s0.Execute(er); err != nil {
+			t.Fatalf("failed to execute on single node: %s", err.Error())
+		}
+	}
+
+	// Wait for a snapshot, so a joining node must be sent it.
+	for {
+		time.Sleep(100 * time.Millisecond)
+		s0.numSnapshotsMu.Lock()
+		ns := s0.numSnapshots
+		s0.numSnapshotsMu.Unlock()
+		if ns > 0 {
+			break
+		}
+	}
+
+	sends := stats.Get(numSnapshotSends).(*expvar.Int).Value()
+	s1, ln1 := mustNewStore(t, true)
+	defer ln1.Close()
+	if err := s1.Open(); err != nil {
+		t.Fatalf("failed to open single-node store: %s", err.Error())
+	}
+	defer s1.Close(true)
+	if err := s0.Join(joinRequest(s1.ID(), s1.Addr(), true)); err != nil {
+		t.Fatalf("failed to join to node at %s: %s", s0.Addr(), err.Error())
+	}
+	if _, err := s1.WaitForLeader(10 * time.Second); err != nil {
+		t.Fatalf("failed to get leader address on follower: %s", err.Error())
+	}
+	if err := s1.WaitForAppliedIndex(s0.raft.AppliedIndex(), 10*time.Second); err != nil {
+		t.Fatalf("follower failed to catch up: %s", err.Error())
+	}
+
+	qr := queryRequestFromString("SELECT COUNT(*) FROM foo", false, false)
+	qr.Level = command.QueryRequest_QUERY_REQUEST_LEVEL_NONE
+	r, err := s1.Query(qr)
+	if err != nil {
+		t.Fatalf("failed to query follower: %s", err.Error())
+	}
+	if exp, got := `[[10]]`, asJSON(r[0].Values); exp != got {
+		t.Fatalf("unexpected results for query\nexp: %s\ngot: %s", exp, got)
+	}
+	if stats.Get(numSnapshotSends).(*expvar.Int).Value() <= sends {
+		t.Fatalf("snapshot not sent to joining node")
+	}
+}
@@ -0,0 +1,289 @@
+package store
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"regexp"
+	"strings"
+
+	"github.com/rqlite/rqlite/command"
+	sql "github.com/rqlite/rqlite/db"
+)
+
+// spatialIndexTable is the table, managed by rqlite, holding the definition
+// of each spatial index.
+const spatialIndexTable = sql.ManagedTablePrefix + "spatial_indexes"
+
+// metresPerDegree is the length, in metres, of one degree of latitude, on a
+// sphere of the mean radius of the Earth.
+const metresPerDegree = 6371008.8 * math.Pi / 180
+
+var (
+	// ErrSpatialIndexNotFound is returned when a spatial index does not exist.
+	ErrSpatialIndexNotFound = errors.New("spatial index not found")
+
+	// ErrSpatialIndexInvalid is returned when the definition of a spatial
+	// index is invalid.
+	ErrSpatialIndexInvalid = errors.New("invalid spatial index")
+)
+
+// spatialIdent matches the names permitted for spatial indexes, and the
+// tables and columns they index.
+var spatialIdent = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// SpatialIndex is an R*Tree table indexing the rows of a table by a bounding
+// box, read from columns of the table. Triggers, managed by rqlite, keep the
+// index in sync with the table as it is written to. Rows with any of these
+// columns NULL are not indexed.
+type SpatialIndex struct {
+	Name  string
+	Table string
+
+	// MinX and MinY are the columns holding the lower bounds of the box of
+	// each row, or the position of each row if MaxX and MaxY are empty.
+	MinX string
+	MinY string
+
+	// MaxX and MaxY are the columns holding the upper bounds of the box of
+	// each row, both empty for an index of points.
+	MaxX string
+	MaxY string
+}
+
+// bounds returns the columns holding the minimum X, maximum X, minimum Y
+// and maximum Y of each row, quoted, prefixed by prefix.
+func (si *SpatialIndex) bounds(prefix string) []string {
+	maxX, maxY := si.MaxX, si.MaxY
+	if maxX == "" {
+		maxX, maxY = si.MinX, si.MinY
+	}
+	return []string{
+		prefix + `"` + si.MinX + `"`, prefix + `"` + maxX + `"`,
+		prefix + `"` + si.MinY + `"`, prefix + `"` + maxY + `"`,
+	}
+}
+
+// indexed returns a condition true when every column of the box of a row,
+// prefixed by prefix, is not NULL.
+func (si *SpatialIndex) indexed(prefix string) string {
+	var conds []string
+	for _, c := range si.bounds(prefix) {
+		conds = append(conds, c+" IS NOT NULL")
+	}
+	return strings.Join(conds, " AND ")
+}
+
+// triggerNames returns the names of the triggers keeping the index in sync
+// with its table, on insert, update and delete.
+func (si *SpatialIndex) triggerNames() []string {
+	prefix := sql.ManagedTablePrefix + "spatial_" + si.Name
+	return []string{prefix + "_insert", prefix + "_update", prefix + "_delete"}
+}
+
+func (si *SpatialIndex) validate() error {
+	if !spatialIdent.MatchString(si.Name) || sql.IsManagedTable(si.Name) {
+		return fmt.Errorf("%w: name %q is not permitted", ErrSpatialIndexInvalid, si.Name)
+	}
+	if !spatialIdent.MatchString(si.Table) || sql.IsManagedTable(si.Table) || strings.EqualFold(si.Table, si.Name) {
+		return fmt.Errorf("%w: table %q is not permitted", ErrSpatialIndexInvalid, si.Table)
+	}
+	if (si.MaxX == "") != (si.MaxY == "") {
+		return fmt.Errorf("%w: both or neither of the maximum X and Y columns must be set", ErrSpatialIndexInvalid)
+	}
+	for _, c := range []string{si.MinX, si.MinY, si.MaxX, si.MaxY} {
+		if c != "" && !spatialIdent.MatchString(c) {
+			return fmt.Errorf("%w: column %q is not permitted", ErrSpatialIndexInvalid, c)
+		}
+	}
+	if si.MinX == "" || si.MinY == "" {
+		return fmt.Errorf("%w: X and Y columns required", ErrSpatialIndexInvalid)
+	}
+	return nil
+}
+
+// CreateSpatialIndex creates the spatial index si, indexing the existing rows
+// of its table, and the triggers keeping it in sync with the table. The
+// table must have a rowid, which identifies each row in the index. The index
+// is replicated, like any other write, so the Leader must create it.
+func (s *Store) CreateSpatialIndex(si *SpatialIndex) error {
+	if err := si.validate(); err != nil {
+		return err
+	}
+
+	tbl := `"` + si.Table + `"`
+	idx := `"` + si.Name + `"`
+	newBounds := strings.Join(si.bounds("NEW."), ", ")
+	newIndexed := si.indexed("NEW.")
+	triggers := si.triggerNames()
+
+	return s.executeManaged(&command.Request{
+		Transaction: true,
+		Statements: []*command.Statement{
+			{
+				Sql: `CREATE TABLE IF NOT EXISTS ` + spatialIndexTable +
+					` (name TEXT NOT NULL PRIMARY KEY, tbl TEXT NOT NULL, min_x TEXT NOT NULL, min_y TEXT NOT NULL,` +
+					` max_x TEXT NOT NULL, max_y TEXT NOT NULL) WITHOUT ROWID`,
+			},
+			{
+				Sql: `INSERT INTO ` + spatialIndexTable + ` (name, tbl, min_x, min_y, max_x, max_y) VALUES (?, ?, ?, ?, ?, ?)`,
+				Parameters: []*command.Parameter{
+					{Value: &command.Parameter_S{S: si.Name}},
+					{Value: &command.Parameter_S{S: si.Table}},
+					{Value: &command.Parameter_S{S: si.MinX}},
+					{Value: &command.Parameter_S{S: si.MinY}},
+					{Value: &command.Parameter_S{S: si.MaxX}},
+					{Value: &command.Parameter_S{S: si.MaxY}},
+				},
+			},
+			{
+				Sql: `CREATE VIRTUAL TABLE ` + idx + ` USING rtree(id, min_x, max_x, min_y, max_y)`,
+			},
+			{
+				Sql: `INSERT INTO ` + idx + ` SELECT rowid, ` + strings.Join(si.bounds(""), ", ") + ` FROM ` + tbl +
+					` WHERE ` + si.indexed(""),
+			},
+			{
+				Sql: `CREATE TRIGGER "` + triggers[0] + `" AFTER INSERT ON ` + tbl + ` WHEN ` + newIndexed +
+					` BEGIN INSERT INTO ` + idx + ` VALUES (NEW.rowid, ` + newBounds + `); END`,
+			},
+			{
+				Sql: `CREATE TRIGGER "` + triggers[1] + `" AFTER UPDATE ON ` + tbl +
+					` BEGIN DELETE FROM ` + idx + ` WHERE id = OLD.rowid;` +
+					` INSERT INTO ` + idx + ` SELECT NEW.rowid, ` + newBounds + ` WHERE ` + newIndexed + `; END`,
+			},
+			{
+				Sql: `CREATE TRIGGER "` + triggers[2] + `" AFTER DELETE ON ` + tbl +
+					` BEGIN DELETE FROM ` + idx + ` WHERE id = OLD.rowid; END`,
+			},
+		},
+	})
+}
+
+// DropSpatialIndex drops the named spatial index, and its triggers.
+func (s *Store) DropSpatialIndex(name string) error {
+	si, err := s.SpatialIndex(name)
+	if err != nil {
+		return err
+	}
+	stmts := []*command.Statement{
+		{
+			Sql: `DELETE FROM ` + spatialIndexTable + ` WHERE name = ?`,
+			Parameters: []*command.Parameter{
+				{Value: &command.Parameter_S{S: name}},
+			},
+		},
+	}
+	for _, t := range si.triggerNames() {
+		stmts = append(stmts, &command.Statement{Sql: `DROP TRIGGER IF EXISTS "` + t + `"`})
+	}
+	stmts = append(stmts, &command.Statement{Sql: `DROP TABLE "` + si.Name + `"`})
+	return s.executeManaged(&command.Request{Transaction: true, Statements: stmts})
+}
+
+// SpatialIndexes returns every spatial index, sorted by name.
+func (s *Store) SpatialIndexes() ([]*SpatialIndex, error) {
+	return s.querySpatialIndexes(`SELECT name, tbl, min_x, min_y, max_x, max_y FROM ` + spatialIndexTable + ` ORDER BY name`)
+}
+
+// SpatialIndex returns the named spatial index, as defined in the database
+// of this node.
+func (s *Store) SpatialIndex(name string) (*SpatialIndex, error) {
+	sis, err := s.querySpatialIndexes(`SELECT name, tbl, min_x, min_y, max_x, max_y FROM `+spatialIndexTable+` WHERE name = ?`,
+		&command.Parameter{Value: &command.Parameter_S{S: name}})
+	if err != nil {
+		return nil, err
+	}
+	if len(sis) == 0 {
+		return nil, ErrSpatialIndexNotFound
+	}
+	return sis[0], nil
+}
+
+func (s *Store) querySpatialIndexes(query string, params ...*command.Parameter) ([]*SpatialIndex, error) {
+	rows, err := s.db.Query(&command.Request{
+		Statements: []*command.Statement{{Sql: query, Parameters: params}},
+	}, false)
+	if err != nil {
+		return nil, err
+	}
+	if len(rows) != 1 {
+		return nil, fmt.Errorf("unexpected number of results querying spatial indexes: %d", len(rows))
+	}
+	if rows[0].Error != "" {
+		if strings.Contains(rows[0].Error, "no such table") {
+			return nil, nil
+		}
+		return nil, errors.New(rows[0].Error)
+	}
+
+	var sis []*SpatialIndex
+	for _, v := range rows[0].Values {
+		p := v.GetParameters()
+		if len(p) != 6 {
+			return nil, fmt.Errorf("unexpected number of columns querying spatial indexes: %d", len(p))
+		}
+		sis = append(sis, &SpatialIndex{
+			Name:  p[0].GetS(),
+			Table: p[1].GetS(),
+			MinX:  p[2].GetS(),
+			MinY:  p[3].GetS(),
+			MaxX:  p[4].GetS(),
+			MaxY:  p[5].GetS(),
+		})
+	}
+	return sis, nil
+}
+
+// BoxQuery returns a statement selecting the rows of the table of the index
+// whose boxes intersect the given box, at most limit rows if limit is
+// positive.
+func (si *SpatialIndex) BoxQuery(minX, minY, maxX, maxY float64, limit int) *command.Statement {
+	stmt := &command.Statement{
+		Sql: `SELECT t.* FROM "` + si.Name + `" AS r JOIN "` + si.Table + `" AS t ON t.rowid = r.id` +
+			` WHERE r.min_x <= ? AND r.max_x >= ? AND r.min_y <= ? AND r.max_y >= ?`,
+		Parameters: []*command.Parameter{
+			{Value: &command.Parameter_D{D: maxX}},
+			{Value: &command.Parameter_D{D: minX}},
+			{Value: &command.Parameter_D{D: maxY}},
+			{Value: &command.Parameter_D{D: minY}},
+		},
+	}
+	if limit > 0 {
+		stmt.Sql += fmt.Sprintf(` LIMIT %d`, limit)
+	}
+	return stmt
+}
+
+// RadiusQuery returns a statement selecting the rows of the table of the
+// index whose centres lie within radius metres of the point at longitude x
+// and latitude y, nearest first, at most limit rows if limit is positive.
+// X and Y are taken to be longitude and latitude, in degrees. Distances are
+// approximated by projecting the surroundings of the point onto a plane, so
+// are accurate for radii of up to some hundreds of kilometres, and searches
+// do not cross the antimeridian.
+func (si *SpatialIndex) RadiusQuery(x, y, radius float64, limit int) *command.Statement {
+	dy := radius / metresPerDegree
+	k := math.Cos(y * math.Pi / 180)
+	dx := 180.0
+	if k > 1e-9 {
+		dx = math.Min(dy/k, 180)
+	}
+
+	b := si.bounds("t.")
+	cx := `((` + b[0] + ` + ` + b[1] + `) / 2.0 - ?)`
+	cy := `((` + b[2] + ` + ` + b[3] + `) / 2.0 - ?)`
+	distance := cx + ` * ` + cx + ` * ? + ` + cy + ` * ` + cy
+	stmt := &command.Statement{
+		Sql: `SELECT t.* FROM "` + si.Name + `" AS r JOIN "` + si.Table + `" AS t ON t.rowid = r.id` +
+			` WHERE r.min_x <= ? AND r.max_x >= ? AND r.min_y <= ? AND r.max_y >= ?` +
+			` AND ` + distance + ` <= ? ORDER BY ` + distance,
+	}
+	for _, v := range []float64{x + dx, x - dx, y + dy, y - dy, x, x, k * k, y, y, dy * dy, x, x, k * k, y, y} {
+		stmt.Parameters = append(stmt.Parameters, &command.Parameter{Value: &command.Parameter_D{D: v}})
+	}
+	if limit > 0 {
+		stmt.Sql += fmt.Sprintf(` LIMIT %d`, limit)
+	}
+	return stmt
+}
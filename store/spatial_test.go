@@ -0,0 +1,152 @@
+package store
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/rqlite/rqlite/command"
+)
+
+func Test_SingleNodeSpatialIndex(t *testing.T) {
+	s, ln := mustNewStore(t, true)
+	defer ln.Close()
+	if err := s.Open(); err != nil {
+		t.Fatalf("failed to open single-node store: %s", err.Error())
+	}
+	if err := s.Bootstrap(NewServer(s.ID(), s.Addr(), true)); err != nil {
+		t.Fatalf("failed to bootstrap single-node store: %s", err.Error())
+	}
+	defer s.Close(true)
+	if _, err := s.WaitForLeader(10 * time.Second); err != nil {
+		t.Fatalf("Error waiting for leader: %s", err)
+	}
+
+	er := executeRequestFromStrings([]string{
+		`CREATE TABLE places (id INTEGER NOT NULL PRIMARY KEY, name TEXT, lon REAL, lat REAL)`,
+		`INSERT INTO places(id, name, lon, lat) VALUES(1, "london", -0.1276, 51.5072)`,
+		`INSERT INTO places(id, name, lon, lat) VALUES(2, "paris", 2.3522, 48.8566)`,
+		`INSERT INTO places(id, name, lon, lat) VALUES(3, "nowhere", NULL, NULL)`,
+	}, false, false)
+	if _, err := s.Execute(er); err != nil {
+		t.Fatalf("failed to execute on single node: %s", err.Error())
+	}
+
+	for _, bad := range []*SpatialIndex{
+		{Name: "bad name", Table: "places", MinX: "lon", MinY: "lat"},
+		{Name: "_rqlite_places", Table: "places", MinX: "lon", MinY: "lat"},
+		{Name: "places", Table: "places", MinX: "lon", MinY: "lat"},
+		{Name: "places_geo", Table: "places", MinX: "lon"},
+		{Name: "places_geo", Table: "places", MinX: "lon", MinY: "lat", MaxX: "lon"},
+	} {
+		if err := s.CreateSpatialIndex(bad); !errors.Is(err, ErrSpatialIndexInvalid) {
+			t.Fatalf("wrong error creating invalid spatial index %v: %v", bad, err)
+		}
+	}
+	si := &SpatialIndex{Name: "places_geo", Table: "places", MinX: "lon", MinY: "lat"}
+	if err := s.CreateSpatialIndex(si); err != nil {
+		t.Fatalf("failed to create spatial index: %s", err.Error())
+	}
+
+	// Rows written after the index is created are indexed by the triggers.
+	er = executeRequestFromStrings([]string{
+		`INSERT INTO places(id, name, lon, lat) VALUES(4, "greenwich", 0.0, 51.4769)`,
+		`INSERT INTO places(id, name, lon, lat) VALUES(5, "berlin", 13.405, 52.52)`,
+		`UPDATE places SET lon = -3.1883, lat = 55.9533, name = "edinburgh" WHERE id = 2`,
+		`UPDATE places SET lon = 2.3522, lat = 48.8566, name = "paris" WHERE id = 3`,
+		`DELETE FROM places WHERE id = 5`,
+	}, false, false)
+	if _, err := s.Execute(er); err != nil {
+		t.Fatalf("failed to execute on single node: %s", err.Error())
+	}
+
+	// Rows within a box are returned in no particular order, so are sorted,
+	// and rows within a radius are returned nearest first.
+	check := func(stmt *command.Statement, sorted bool, exp string) {
+		t.Helper()
+		query := `SELECT name FROM (` + stmt.Sql + `)`
+		if sorted {
+			query = `SELECT name FROM (` + stmt.Sql + `) ORDER BY name`
+		}
+		r, err := s.Query(&command.QueryRequest{
+			Request: &command.Request{
+				Statements: []*command.Statement{{Sql: query, Parameters: stmt.Parameters}},
+			},
+		})
+		if err != nil {
+			t.Fatalf("failed to query spatial index: %s", err.Error())
+		}
+		if got := asJSON(r); got != exp {
+			t.Fatalf("wrong results\nexp: %s\ngot: %s", exp, got)
+		}
+	}
+	check(si.BoxQuery(-1, 48, 3, 52, 0), true, `[{"columns":["name"],"types":["text"],"values":[["greenwich"],["london"],["paris"]]}]`)
+	check(si.BoxQuery(10, 50, 20, 60, 0), true, `[{"columns":["name"],"types":["text"]}]`)
+	check(si.RadiusQuery(0.0, 51.4769, 20000, 0), false, `[{"columns":["name"],"types":["text"],"values":[["greenwich"],["london"]]}]`)
+	check(si.RadiusQuery(0.0, 51.4769, 400000, 0), false, `[{"columns":["name"],"types":["text"],"values":[["greenwich"],["london"],["paris"]]}]`)
+	check(si.RadiusQuery(0.0, 51.4769, 400000, 2), false, `[{"columns":["name"],"types":["text"],"values":[["greenwich"],["london"]]}]`)
+	check(si.RadiusQuery(-0.1276, 51.5072, 5000, 0), false, `[{"columns":["name"],"types":["text"],"values":[["london"]]}]`)
+
+	sis, err := s.SpatialIndexes()
+	if err != nil {
+		t.Fatalf("failed to list spatial indexes: %s", err.Error())
+	}
+	if len(sis) != 1 || *sis[0] != *si {
+		t.Fatalf("wrong spatial indexes: %v", sis)
+	}
+
+	if err := s.DropSpatialIndex("places_geo"); err != nil {
+		t.Fatalf("failed to drop spatial index: %s", err.Error())
+	}
+	if err := s.DropSpatialIndex("places_geo"); !errors.Is(err, ErrSpatialIndexNotFound) {
+		t.Fatalf("wrong error dropping missing spatial index: %v", err)
+	}
+	r, err := s.Query(queryRequestFromString(`SELECT COUNT(*) FROM sqlite_master WHERE name LIKE '%places_geo%'`, false, false))
+	if err != nil {
+		t.Fatalf("failed to query schema: %s", err.Error())
+	}
+	if exp, got := `[{"columns":["COUNT(*)"],"types":[""],"values":[[0]]}]`, asJSON(r); exp != got {
+		t.Fatalf("spatial index not fully dropped\nexp: %s\ngot: %s", exp, got)
+	}
+	if _, err := s.Execute(executeRequestFromString(`INSERT INTO places(id, name, lon, lat) VALUES(6, "oslo", 10.75, 59.91)`, false, false)); err != nil {
+		t.Fatalf("failed to write table of dropped index: %s", err.Error())
+	}
+}
+
+func Test_SpatialIndexBoxes(t *testing.T) {
+	s, ln := mustNewStore(t, true)
+	defer ln.Close()
+	if err := s.Open(); err != nil {
+		t.Fatalf("failed to open single-node store: %s", err.Error())
+	}
+	if err := s.Bootstrap(NewServer(s.ID(), s.Addr(), true)); err != nil {
+		t.Fatalf("failed to bootstrap single-node store: %s", err.Error())
+	}
+	defer s.Close(true)
+	if _, err := s.WaitForLeader(10 * time.Second); err != nil {
+		t.Fatalf("Error waiting for leader: %s", err)
+	}
+
+	er := executeRequestFromStrings([]string{
+		`CREATE TABLE zones (id INTEGER NOT NULL PRIMARY KEY, name TEXT, x1 REAL, y1 REAL, x2 REAL, y2 REAL)`,
+		`INSERT INTO zones VALUES(1, "a", 0, 0, 10, 10)`,
+		`INSERT INTO zones VALUES(2, "b", 20, 20, 30, 30)`,
+	}, false, false)
+	if _, err := s.Execute(er); err != nil {
+		t.Fatalf("failed to execute on single node: %s", err.Error())
+	}
+	si := &SpatialIndex{Name: "zones_geo", Table: "zones", MinX: "x1", MinY: "y1", MaxX: "x2", MaxY: "y2"}
+	if err := s.CreateSpatialIndex(si); err != nil {
+		t.Fatalf("failed to create spatial index: %s", err.Error())
+	}
+
+	r, err := s.Query(&command.QueryRequest{
+		Request: &command.Request{Statements: []*command.Statement{si.BoxQuery(5, 5, 25, 6, 0)}},
+	})
+	if err != nil {
+		t.Fatalf("failed to query spatial index: %s", err.Error())
+	}
+	if exp, got := `[{"columns":["id","name","x1","y1","x2","y2"],"types":["integer","text","real","real","real","real"],"values":[[1,"a",0,0,10,10]]}]`, asJSON(r); exp != got {
+		t.Fatalf("wrong results\nexp: %s\ngot: %s", exp, got)
+	}
+}
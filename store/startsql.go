@@ -0,0 +1,124 @@
+package store
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/rqlite/rqlite/command"
+	sql "github.com/rqlite/rqlite/db"
+)
+
+const (
+	// startSQLTable records that the start SQL has been executed. Its single
+	// row is inserted in the same transaction as the start SQL, so the start
+	// SQL is executed at most once, whichever nodes attempt it.
+	startSQLTable = sql.ManagedTablePrefix + "start_sql"
+
+	startSQLCheckInterval = 250 * time.Millisecond
+)
+
+// StartSQLExecutedAt returns when the start SQL was executed by the cluster,
+// or false if it has not been.
+func (s *Store) StartSQLExecutedAt() (time.Time, bool, error) {
+	rows, err := s.db.QueryStringStmt(`SELECT COUNT(*) FROM sqlite_master WHERE type = 'table' AND name = '` + startSQLTable + `'`)
+	if err != nil {
+		return time.Time{}, false, err
+	}
+	if len(rows) != 1 {
+		return time.Time{}, false, fmt.Errorf("unexpected number of results checking for %s: %d", startSQLTable, len(rows))
+	}
+	if rows[0].Error != "" {
+		return time.Time{}, false, errors.New(rows[0].Error)
+	}
+	if len(rows[0].Values) != 1 {
+		return time.Time{}, false, fmt.Errorf("unexpected number of rows checking for %s: %d", startSQLTable, len(rows[0].Values))
+	}
+	if rows[0].Values[0].GetParameters()[0].GetI() == 0 {
+		return time.Time{}, false, nil
+	}
+
+	rows, err = s.db.QueryStringStmt(`SELECT executed_at FROM ` + startSQLTable)
+	if err != nil {
+		return time.Time{}, false, err
+	}
+	if len(rows) != 1 {
+		return time.Time{}, false, fmt.Errorf("unexpected number of results querying %s: %d", startSQLTable, len(rows))
+	}
+	if rows[0].Error != "" {
+		return time.Time{}, false, errors.New(rows[0].Error)
+	}
+	if len(rows[0].Values) == 0 {
+		return time.Time{}, false, nil
+	}
+	return time.Unix(0, rows[0].Values[0].GetParameters()[0].GetI()).UTC(), true, nil
+}
+
+// executeStartSQL executes the start SQL, once this node is the Leader,
+// unless the cluster has already executed it. Should the start SQL fail, it
+// is attempted again only when this node restarts, or by another node.
+func (s *Store) executeStartSQL() (closeCh, doneCh chan struct{}) {
+	closeCh = make(chan struct{})
+	doneCh = make(chan struct{})
+	if s.StartSQL == "" {
+		close(doneCh)
+		return closeCh, doneCh
+	}
+
+	go func() {
+		defer close(doneCh)
+		tck := time.NewTicker(startSQLCheckInterval)
+		defer tck.Stop()
+		for {
+			select {
+			case <-tck.C:
+				if !s.IsLeader() || !s.Ready() {
+					continue
+				}
+				if _, ok, err := s.StartSQLExecutedAt(); err != nil {
+					s.logger.Printf("failed to check whether start SQL was executed: %s", err.Error())
+					continue
+				} else if ok {
+					return
+				}
+
+				err := s.executeManaged(&command.Request{
+					Transaction: true,
+					Statements: []*command.Statement{
+						{
+							Sql: `CREATE TABLE IF NOT EXISTS ` + startSQLTable +
+								` (id INTEGER NOT NULL PRIMARY KEY CHECK (id = 1), executed_at INTEGER NOT NULL)`,
+						},
+						{
+							Sql: `INSERT INTO ` + startSQLTable + ` (id, executed_at) VALUES (1, ?)`,
+							Parameters: []*command.Parameter{
+								{Value: &command.Parameter_I{I: time.Now().UnixNano()}},
+							},
+						},
+						{
+							Sql: s.StartSQL,
+						},
+					},
+				})
+				if err == ErrNotLeader {
+					continue
+				}
+				if err != nil {
+					if _, ok, _ := s.StartSQLExecutedAt(); ok {
+						// Another Leader executed the start SQL first.
+						return
+					}
+					stats.Add(numStartSQLFailures, 1)
+					s.logger.Printf("failed to execute start SQL: %s", err.Error())
+					return
+				}
+				stats.Add(numStartSQLExecutions, 1)
+				s.logger.Printf("start SQL executed")
+				return
+			case <-closeCh:
+				return
+			}
+		}
+	}()
+	return closeCh, doneCh
+}
@@ -0,0 +1,112 @@
+package store
+
+import (
+	"expvar"
+	"testing"
+	"time"
+
+	"github.com/rqlite/rqlite/command"
+)
+
+func Test_MultiNodeStartSQL(t *testing.T) {
+	executions := stats.Get(numStartSQLExecutions).(*expvar.Int).Value()
+	startSQL := `CREATE TABLE foo (id INTEGER NOT NULL PRIMARY KEY, name TEXT);
+INSERT INTO foo(id, name) VALUES(1, 'fiona');`
+
+	s0, ln0 := mustNewStore(t, true)
+	defer ln0.Close()
+	s0.StartSQL = startSQL
+	if err := s0.Open(); err != nil {
+		t.Fatalf("failed to open single-node store: %s", err.Error())
+	}
+	defer s0.Close(true)
+	if err := s0.Bootstrap(NewServer(s0.ID(), s0.Addr(), true)); err != nil {
+		t.Fatalf("failed to bootstrap single-node store: %s", err.Error())
+	}
+	if _, err := s0.WaitForLeader(10 * time.Second); err != nil {
+		t.Fatalf("Error waiting for leader: %s", err)
+	}
+
+	s1, ln1 := mustNewStore(t, true)
+	defer ln1.Close()
+	s1.StartSQL = startSQL
+	if err := s1.Open(); err != nil {
+		t.Fatalf("failed to open node for multi-node test: %s", err.Error())
+	}
+	defer s1.Close(true)
+	if err := s0.Join(joinRequest(s1.ID(), s1.Addr(), true)); err != nil {
+		t.Fatalf("failed to join to node at %s: %s", s0.Addr(), err.Error())
+	}
+
+	testPoll(t, func() bool {
+		_, ok, err := s1.StartSQLExecutedAt()
+		return err == nil && ok
+	}, 100*time.Millisecond, 5*time.Second)
+
+	// The start SQL is never executed a second time, even should another
+	// node, as Leader, attempt it.
+	close(s0.startSQLClose)
+	<-s0.startSQLDone
+	s0.startSQLClose, s0.startSQLDone = s0.executeStartSQL()
+	time.Sleep(2 * startSQLCheckInterval)
+	if err := s0.executeManaged(&command.Request{
+		Transaction: true,
+		Statements: []*command.Statement{
+			{Sql: `INSERT INTO ` + startSQLTable + ` (id, executed_at) VALUES (1, 0)`},
+			{Sql: startSQL},
+		},
+	}); err == nil {
+		t.Fatalf("start SQL executed a second time")
+	}
+	if _, err := s0.WaitForAppliedFSM(5 * time.Second); err != nil {
+		t.Fatalf("failed to wait for fsmIndex: %s", err.Error())
+	}
+
+	qr := queryRequestFromString(`SELECT * FROM foo`, false, false)
+	qr.Level = command.QueryRequest_QUERY_REQUEST_LEVEL_NONE
+	for _, s := range []*Store{s0, s1} {
+		r, err := s.Query(qr)
+		if err != nil {
+			t.Fatalf("failed to query node: %s", err.Error())
+		}
+		if exp, got := `[{"columns":["id","name"],"types":["integer","text"],"values":[[1,"fiona"]]}]`, asJSON(r); exp != got {
+			t.Fatalf("wrong results\nexp: %s\ngot: %s", exp, got)
+		}
+	}
+	if n := stats.Get(numStartSQLExecutions).(*expvar.Int).Value() - executions; n != 1 {
+		t.Fatalf("wrong number of start SQL executions, exp 1, got %d", n)
+	}
+}
+
+func Test_SingleNodeStartSQLFails(t *testing.T) {
+	s, ln := mustNewStore(t, true)
+	defer ln.Close()
+	s.StartSQL = `CREATE TABLE foo (id INTEGER NOT NULL PRIMARY KEY); INSERT INTO nothere VALUES(1);`
+	if err := s.Open(); err != nil {
+		t.Fatalf("failed to open single-node store: %s", err.Error())
+	}
+	if err := s.Bootstrap(NewServer(s.ID(), s.Addr(), true)); err != nil {
+		t.Fatalf("failed to bootstrap single-node store: %s", err.Error())
+	}
+	defer s.Close(true)
+	if _, err := s.WaitForLeader(10 * time.Second); err != nil {
+		t.Fatalf("Error waiting for leader: %s", err)
+	}
+
+	// A failed start SQL is not retried by the node, and leaves no trace.
+	select {
+	case <-s.startSQLDone:
+	case <-time.After(5 * time.Second):
+		t.Fatalf("timed out waiting for start SQL to fail")
+	}
+	if _, ok, err := s.StartSQLExecutedAt(); err != nil || ok {
+		t.Fatalf("failed start SQL recorded as executed: %v", err)
+	}
+	r, err := s.db.QueryStringStmt(`SELECT name FROM sqlite_master WHERE name = 'foo'`)
+	if err != nil {
+		t.Fatalf("failed to query: %s", err.Error())
+	}
+	if exp, got := `[{"columns":["name"],"types":["text"]}]`, asJSON(r); exp != got {
+		t.Fatalf("failed start SQL not rolled back\nexp: %s\ngot: %s", exp, got)
+	}
+}
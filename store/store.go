@@ -28,6 +28,7 @@ import (
 	"github.com/rqlite/rqlite/command"
 	sql "github.com/rqlite/rqlite/db"
 	rlog "github.com/rqlite/rqlite/log"
+	"google.golang.org/protobuf/proto"
 )
 
 var (
@@ -63,6 +64,18 @@ var (
 	// ErrInvalidBackupFormat is returned when the requested backup format
 	// is not valid.
 	ErrInvalidBackupFormat = errors.New("invalid backup format")
+
+	// ErrNodeNotFound is returned when a node is not present in the
+	// cluster configuration.
+	ErrNodeNotFound = errors.New("node not found")
+
+	// ErrNotVoter is returned when an operation requires a voting node,
+	// but the node is not a voter.
+	ErrNotVoter = errors.New("node is not a voter")
+
+	// ErrApplyBacklog is returned when a write is refused because too many
+	// earlier writes are still waiting to be applied.
+	ErrApplyBacklog = errors.New("too many writes waiting to be applied")
 )
 
 const (
@@ -83,29 +96,58 @@ const (
 )
 
 const (
-	numSnaphots              = "num_snapshots"
-	numProvides              = "num_provides"
-	numBackups               = "num_backups"
-	numLoads                 = "num_loads"
-	numRestores              = "num_restores"
-	numAutoRestores          = "num_auto_restores"
-	numAutoRestoresSkipped   = "num_auto_restores_skipped"
-	numAutoRestoresFailed    = "num_auto_restores_failed"
-	numRecoveries            = "num_recoveries"
-	numUncompressedCommands  = "num_uncompressed_commands"
-	numCompressedCommands    = "num_compressed_commands"
-	numJoins                 = "num_joins"
-	numIgnoredJoins          = "num_ignored_joins"
-	numRemovedBeforeJoins    = "num_removed_before_joins"
-	snapshotCreateDuration   = "snapshot_create_duration"
-	snapshotPersistDuration  = "snapshot_persist_duration"
-	snapshotDBSerializedSize = "snapshot_db_serialized_size"
-	snapshotDBOnDiskSize     = "snapshot_db_ondisk_size"
-	leaderChangesObserved    = "leader_changes_observed"
-	leaderChangesDropped     = "leader_changes_dropped"
-	failedHeartbeatObserved  = "failed_heartbeat_observed"
-	nodesReapedOK            = "nodes_reaped_ok"
-	nodesReapedFailed        = "nodes_reaped_failed"
+	numSnaphots                = "num_snapshots"
+	numProvides                = "num_provides"
+	numBackups                 = "num_backups"
+	numLoads                   = "num_loads"
+	numRestores                = "num_restores"
+	numAutoRestores            = "num_auto_restores"
+	numAutoRestoresSkipped     = "num_auto_restores_skipped"
+	numAutoRestoresFailed      = "num_auto_restores_failed"
+	numRecoveries              = "num_recoveries"
+	numUncompressedCommands    = "num_uncompressed_commands"
+	numCompressedCommands      = "num_compressed_commands"
+	numJoins                   = "num_joins"
+	numIgnoredJoins            = "num_ignored_joins"
+	numRemovedBeforeJoins      = "num_removed_before_joins"
+	numJoinsRejected           = "num_joins_rejected"
+	numJoinsDuplicateID        = "num_joins_duplicate_id"
+	numSnapshotSends           = "num_snapshot_sends"
+	numSnapshotSendWaits       = "num_snapshot_send_waits"
+	numPromotions              = "num_promotions"
+	numDemotions               = "num_demotions"
+	snapshotCreateDuration     = "snapshot_create_duration"
+	snapshotPersistDuration    = "snapshot_persist_duration"
+	snapshotDBSerializedSize   = "snapshot_db_serialized_size"
+	snapshotDBOnDiskSize       = "snapshot_db_ondisk_size"
+	leaderChangesObserved      = "leader_changes_observed"
+	leaderChangesDropped       = "leader_changes_dropped"
+	failedHeartbeatObserved    = "failed_heartbeat_observed"
+	nodesReapedOK              = "nodes_reaped_ok"
+	nodesReapedFailed          = "nodes_reaped_failed"
+	eventsEmitted              = "events_emitted"
+	eventsDropped              = "events_dropped"
+	numSnapshotsArchived       = "num_snapshots_archived"
+	numChunkedExecutes         = "num_chunked_executes"
+	numSnapshotArchiveFailures = "num_snapshot_archive_failures"
+	numLeaderVerifications     = "num_leader_verifications"
+	numLeaderVerifyFailures    = "num_leader_verify_failures"
+	numDDLRejected             = "num_ddl_rejected"
+	numDDLBatches              = "num_ddl_batches"
+	numSchemaVersionRejected   = "num_schema_version_rejected"
+	numApplyRetries            = "num_apply_retries"
+	numFSMHalts                = "num_fsm_halts"
+	numTableRestores           = "num_table_restores"
+	numDryRuns                 = "num_dry_runs"
+	numDBSizeMeasurements      = "num_db_size_measurements"
+	numApplyBacklogRefusals    = "num_apply_backlog_refusals"
+	numMatViewRefreshes        = "num_materialized_view_refreshes"
+	numMatViewRefreshFailures  = "num_materialized_view_refresh_failures"
+	numTriggersRejected        = "num_nondeterministic_triggers_rejected"
+	numRemoteAttaches          = "num_remote_attaches"
+	numRemoteAttachFailures    = "num_remote_attach_failures"
+	numStartSQLExecutions      = "num_start_sql_executions"
+	numStartSQLFailures        = "num_start_sql_failures"
 )
 
 // stats captures stats for the Store.
@@ -132,6 +174,12 @@ func ResetStats() {
 	stats.Add(numJoins, 0)
 	stats.Add(numIgnoredJoins, 0)
 	stats.Add(numRemovedBeforeJoins, 0)
+	stats.Add(numJoinsRejected, 0)
+	stats.Add(numJoinsDuplicateID, 0)
+	stats.Add(numSnapshotSends, 0)
+	stats.Add(numSnapshotSendWaits, 0)
+	stats.Add(numPromotions, 0)
+	stats.Add(numDemotions, 0)
 	stats.Add(snapshotCreateDuration, 0)
 	stats.Add(snapshotPersistDuration, 0)
 	stats.Add(snapshotDBSerializedSize, 0)
@@ -141,6 +189,29 @@ func ResetStats() {
 	stats.Add(failedHeartbeatObserved, 0)
 	stats.Add(nodesReapedOK, 0)
 	stats.Add(nodesReapedFailed, 0)
+	stats.Add(eventsEmitted, 0)
+	stats.Add(eventsDropped, 0)
+	stats.Add(numSnapshotsArchived, 0)
+	stats.Add(numChunkedExecutes, 0)
+	stats.Add(numSnapshotArchiveFailures, 0)
+	stats.Add(numLeaderVerifications, 0)
+	stats.Add(numLeaderVerifyFailures, 0)
+	stats.Add(numDDLRejected, 0)
+	stats.Add(numDDLBatches, 0)
+	stats.Add(numSchemaVersionRejected, 0)
+	stats.Add(numMatViewRefreshes, 0)
+	stats.Add(numMatViewRefreshFailures, 0)
+	stats.Add(numTriggersRejected, 0)
+	stats.Add(numRemoteAttaches, 0)
+	stats.Add(numRemoteAttachFailures, 0)
+	stats.Add(numStartSQLExecutions, 0)
+	stats.Add(numStartSQLFailures, 0)
+	stats.Add(numApplyRetries, 0)
+	stats.Add(numFSMHalts, 0)
+	stats.Add(numTableRestores, 0)
+	stats.Add(numDryRuns, 0)
+	stats.Add(numDBSizeMeasurements, 0)
+	stats.Add(numApplyBacklogRefusals, 0)
 }
 
 // ClusterState defines the possible Raft states the current node can be in
@@ -157,6 +228,10 @@ const (
 
 // Store is a SQLite database, where all changes are made via Raft consensus.
 type Store struct {
+	// Log entries submitted by this node, but not yet applied. Accessed
+	// atomically, so first in the struct to be 64-bit aligned.
+	applyBacklog int64
+
 	open          bool
 	raftDir       string
 	peersPath     string
@@ -173,11 +248,49 @@ type Store struct {
 	dbPath string    // Path to underlying SQLite file, if not in-memory.
 	db     *sql.DB   // The underlying SQLite store.
 
+	// Wraps raftTn, limiting the snapshots sent to other nodes.
+	snapTn *snapshotSendTransport
+
 	queryTxMu sync.RWMutex
 
+	chunks  chunkBuffer // Partially-applied chunked request, accessed only by the FSM.
+	chunkMu sync.Mutex  // Serializes writing of chunked requests.
+
+	caRotationMu sync.RWMutex
+	caRotation   *command.CARotation // State of node-to-node CA rotation.
+
+	foreignKeysMu sync.RWMutex
+	foreignKeys   *command.ForeignKeys // Replicated foreign key setting, if any.
+
+	joinTokensMu sync.RWMutex
+	joinTokens   *command.JoinTokens // Tokens allowing nodes to join, if any.
+
+	dbSizeMu    sync.RWMutex
+	dbSize      *DBSize // Size of the database, as last measured.
+	dbSizeClose chan struct{}
+	dbSizeDone  chan struct{}
+
+	diskIO      *diskIOSampler // Rates at which each subsystem writes to disk.
+	diskIOClose chan struct{}
+	diskIODone  chan struct{}
+
+	matViewClose chan struct{}
+	matViewDone  chan struct{}
+
+	remotesMu    sync.Mutex
+	remoteErrors map[string]string // Why each remote cluster is not attached.
+	remoteClose  chan struct{}
+	remoteDone   chan struct{}
+
+	startSQLClose chan struct{}
+	startSQLDone  chan struct{}
+
 	dbAppliedIndexMu sync.RWMutex
 	dbAppliedIndex   uint64
 
+	leaderVerifiedMu sync.Mutex
+	leaderVerified   time.Time // When a quorum last confirmed this node's leadership.
+
 	// Channels that must be closed for the Store to be considered ready.
 	readyChans             []<-chan struct{}
 	numClosedReadyChannels int
@@ -188,6 +301,9 @@ type Store struct {
 	fsmIndex   uint64
 	fsmIndexMu sync.RWMutex
 
+	fsmHaltMu sync.RWMutex
+	fsmHalt   *FSMHalt // Failure which halted the FSM, if any.
+
 	reqMarshaller *command.RequestMarshaler // Request marshaler for writing to log.
 	raftLog       raft.LogStore             // Persistent log store.
 	raftStable    raft.StableStore          // Persistent k-v store.
@@ -201,6 +317,10 @@ type Store struct {
 	observerChan      chan raft.Observation
 	observer          *raft.Observer
 
+	// Storage events observers
+	eventObserversMu sync.RWMutex
+	eventObservers   []chan<- *Event
+
 	onDiskCreated        bool      // On disk database actually created?
 	snapsExistOnOpen     bool      // Any snaps present when store opens?
 	firstIdxOnOpen       uint64    // First index on log when Store opens.
@@ -225,13 +345,109 @@ type Store struct {
 	// flag allows control of the optimization.
 	StartupOnDisk bool
 
+	// RecoveryMode forces recovery of the node's Raft state at Open, salvaging
+	// as much as possible. Any unreadable entries at the tail of the Raft log
+	// are discarded, and if the most recent snapshot cannot be read, older
+	// snapshots are tried. Cluster membership is set from the peers file if
+	// present, otherwise the node is recovered as a single-node cluster.
+	RecoveryMode bool
+
+	// MaxEntrySize is the maximum size, in bytes, of an execute request
+	// written to a single Raft log entry. Larger requests are split across
+	// multiple entries, and applied once the last entry is committed. Zero
+	// means there is no maximum.
+	MaxEntrySize int
+
+	// MinSQLiteVersion is the oldest version of SQLite run by any node in
+	// the cluster, such as 3.31.0. If set, requests using features of SQLite
+	// DDL which that version does not support, such as STRICT tables, are
+	// rejected before they are written to the Raft log, so older nodes never
+	// fail to apply a log entry the others applied.
+	MinSQLiteVersion string
+
+	// AllowNonDeterministicTriggers allows requests to create triggers whose
+	// effects may differ from node to node, such as those which call random()
+	// or read the current time. By default such requests are rejected before
+	// they are written to the Raft log.
+	AllowNonDeterministicTriggers bool
+
+	// JoinTokenRequired requires that a node present a join token, created
+	// by CreateJoinToken, to join the cluster. Nodes which are already
+	// members of the cluster may rejoin without a token. It must be set on
+	// every node which may become the Leader.
+	JoinTokenRequired bool
+
+	// SnapshotRetain is the number of Raft snapshots retained by the node.
+	// Zero means the default number is retained.
+	SnapshotRetain int
+
+	// SnapshotArchiver, if set, receives a copy of each Raft snapshot once
+	// it has been persisted.
+	SnapshotArchiver SnapshotArchiver
+	archivingSnaps   *archivingSnapshotStore
+
+	// ApplyRetries is the number of times the FSM retries applying a log
+	// entry which failed with a transient error, such as the disk being full.
+	// If the entry still fails, or fails in a way no retry can fix, the FSM
+	// halts rather than continue from a state which differs from that of the
+	// other nodes.
+	ApplyRetries int
+
+	// ApplyRetryDelay is the delay before the first retry of a log entry. It
+	// doubles with each subsequent retry.
+	ApplyRetryDelay time.Duration
+
+	// CARotationFunc, if set, is called with the state of the rotation of the
+	// CA used for node-to-node encryption whenever that state changes. It is
+	// called by the FSM, so must not block.
+	CARotationFunc func(r *command.CARotation)
+
+	// NodeIDAt, if set, returns the ID of the node answering at the given
+	// Raft address. It is used to refuse joins by nodes claiming the ID of a
+	// member which is still live.
+	NodeIDAt func(addr string) (string, error)
+
+	// SnapshotSendMax is the number of snapshots this node may send to other
+	// nodes concurrently. Further sends wait. Zero means no limit.
+	SnapshotSendMax int
+
+	// SnapshotSendRate is the rate, in bytes per second, at which each
+	// snapshot is sent to another node. Zero means no limit.
+	SnapshotSendRate int64
+
+	// MaxApplyBacklog is the number of log entries which this node, as Leader,
+	// may have waiting to be applied. Further writes are refused with
+	// ErrApplyBacklog until the backlog drains. Zero disables the limit.
+	MaxApplyBacklog int
+
+	// DBSizeInterval is the interval at which the size of the database, and
+	// of each of its tables, is measured. If 0, it is measured each time it
+	// is requested.
+	DBSizeInterval time.Duration
+
+	// MatViewCheckInterval is the interval at which the Leader checks whether
+	// any materialized view is due to be refreshed. If 0, views are refreshed
+	// only on request.
+	MatViewCheckInterval time.Duration
+
+	// RemoteCheckInterval is the interval at which this node checks for
+	// changes to the remote clusters registered with the cluster. If 0,
+	// remote clusters are not attached.
+	RemoteCheckInterval time.Duration
+
+	// StartSQL is SQL executed once by the cluster, by the first node to be
+	// Leader with it set, when the cluster first forms. May not be set.
+	StartSQL string
+
 	ShutdownOnRemove   bool
 	SnapshotThreshold  uint64
 	SnapshotInterval   time.Duration
 	LeaderLeaseTimeout time.Duration
 	HeartbeatTimeout   time.Duration
 	ElectionTimeout    time.Duration
+	CommitTimeout      time.Duration
 	ApplyTimeout       time.Duration
+	MaxAppendEntries   int
 	RaftLogLevel       string
 	NoFreeListSync     bool
 
@@ -278,19 +494,25 @@ func New(ln Listener, c *Config) *Store {
 	}
 
 	return &Store{
-		ln:              ln,
-		raftDir:         c.Dir,
-		peersPath:       filepath.Join(c.Dir, peersPath),
-		peersInfoPath:   filepath.Join(c.Dir, peersInfoPath),
-		restoreDoneCh:   make(chan struct{}),
-		raftID:          c.ID,
-		dbConf:          c.DBConf,
-		dbPath:          dbPath,
-		leaderObservers: make([]chan<- struct{}, 0),
-		reqMarshaller:   command.NewRequestMarshaler(),
-		logger:          logger,
-		notifyingNodes:  make(map[string]*Server),
-		ApplyTimeout:    applyTimeout,
+		ln:                   ln,
+		raftDir:              c.Dir,
+		peersPath:            filepath.Join(c.Dir, peersPath),
+		peersInfoPath:        filepath.Join(c.Dir, peersInfoPath),
+		restoreDoneCh:        make(chan struct{}),
+		raftID:               c.ID,
+		dbConf:               c.DBConf,
+		dbPath:               dbPath,
+		leaderObservers:      make([]chan<- struct{}, 0),
+		reqMarshaller:        command.NewRequestMarshaler(),
+		logger:               logger,
+		notifyingNodes:       make(map[string]*Server),
+		ApplyTimeout:         applyTimeout,
+		ApplyRetries:         defaultApplyRetries,
+		ApplyRetryDelay:      defaultApplyRetryDelay,
+		DBSizeInterval:       defaultDBSizeInterval,
+		MatViewCheckInterval: defaultMatViewCheckInterval,
+		RemoteCheckInterval:  defaultRemoteCheckInterval,
+		remoteErrors:         make(map[string]string),
 	}
 }
 
@@ -354,6 +576,7 @@ func (s *Store) Open() (retErr error) {
 
 	// Create Raft-compatible network layer.
 	s.raftTn = raft.NewNetworkTransport(NewTransport(s.ln), connectionPoolCount, connectionTimeout, nil)
+	s.snapTn = newSnapshotSendTransport(s.raftTn, s.SnapshotSendMax, s.SnapshotSendRate)
 
 	// Don't allow control over trailing logs directly, just implement a policy.
 	s.numTrailingLogs = uint64(float64(s.SnapshotThreshold) * trailingScale)
@@ -362,10 +585,21 @@ func (s *Store) Open() (retErr error) {
 	config.LocalID = raft.ServerID(s.raftID)
 
 	// Create the snapshot store. This allows Raft to truncate the log.
-	snapshots, err := raft.NewFileSnapshotStore(s.raftDir, retainSnapshotCount, os.Stderr)
+	retain := retainSnapshotCount
+	if s.SnapshotRetain > 0 {
+		retain = s.SnapshotRetain
+	}
+	fileSnapshots, err := raft.NewFileSnapshotStore(s.raftDir, retain, os.Stderr)
 	if err != nil {
 		return fmt.Errorf("file snapshot store: %s", err)
 	}
+	var snapshots raft.SnapshotStore = fileSnapshots
+	if s.SnapshotArchiver != nil {
+		s.archivingSnaps = newArchivingSnapshotStore(fileSnapshots, s.SnapshotArchiver, s.logger)
+		snapshots = s.archivingSnaps
+		s.logger.Printf("archiving snapshots to %s", s.SnapshotArchiver)
+	}
+	snapshots = &diskIOSnapshotStore{SnapshotStore: snapshots}
 	snaps, err := snapshots.List()
 	if err != nil {
 		return fmt.Errorf("list snapshots: %s", err)
@@ -378,8 +612,9 @@ func (s *Store) Open() (retErr error) {
 	if err != nil {
 		return fmt.Errorf("new log store: %s", err)
 	}
-	s.raftStable = s.boltStore
-	s.raftLog, err = raft.NewLogCache(raftLogCacheSize, s.boltStore)
+	logStore := newDiskIOLogStore(s.boltStore)
+	s.raftStable = logStore
+	s.raftLog, err = raft.NewLogCache(raftLogCacheSize, logStore)
 	if err != nil {
 		return fmt.Errorf("new cached store: %s", err)
 	}
@@ -391,7 +626,7 @@ func (s *Store) Open() (retErr error) {
 		if err != nil {
 			return fmt.Errorf("failed to read peers file: %s", err.Error())
 		}
-		if err = RecoverNode(s.raftDir, s.logger, s.raftLog, s.raftStable, snapshots, s.raftTn, config); err != nil {
+		if err = RecoverNode(s.raftDir, s.logger, s.raftLog, s.raftStable, snapshots, s.raftTn, config, s.RecoveryMode); err != nil {
 			return fmt.Errorf("failed to recover node: %s", err.Error())
 		}
 		if err := os.Rename(s.peersPath, s.peersInfoPath); err != nil {
@@ -399,6 +634,22 @@ func (s *Store) Open() (retErr error) {
 		}
 		s.logger.Printf("node recovered successfully using %s", s.peersPath)
 		stats.Add(numRecoveries, 1)
+	} else if s.RecoveryMode {
+		s.logger.Printf("attempting node recovery as a single-node cluster")
+		config := raft.Configuration{
+			Servers: []raft.Server{
+				{
+					ID:       raft.ServerID(s.raftID),
+					Address:  s.raftTn.LocalAddr(),
+					Suffrage: raft.Voter,
+				},
+			},
+		}
+		if err = RecoverNode(s.raftDir, s.logger, s.raftLog, s.raftStable, snapshots, s.raftTn, config, true); err != nil {
+			return fmt.Errorf("failed to recover node: %s", err.Error())
+		}
+		s.logger.Printf("node recovered successfully as a single-node cluster")
+		stats.Add(numRecoveries, 1)
 	}
 
 	// Get some info about the log, before any more entries are committed.
@@ -414,7 +665,7 @@ func (s *Store) Open() (retErr error) {
 	// can also happen if the user explicitly disables the startup optimization of
 	// building the SQLite database in memory, before switching to disk.
 	if s.StartupOnDisk || (!s.dbConf.Memory && !s.snapsExistOnOpen && s.lastCommandIdxOnOpen == 0) {
-		s.db, err = createOnDisk(nil, s.dbPath, s.dbConf.FKConstraints)
+		s.db, err = createOnDisk(nil, s.dbPath, s.ForeignKeys())
 		if err != nil {
 			return fmt.Errorf("failed to create on-disk database")
 		}
@@ -422,7 +673,7 @@ func (s *Store) Open() (retErr error) {
 		s.logger.Printf("created on-disk database at open")
 	} else {
 		// We need an in-memory database, at least for bootstrapping purposes.
-		s.db, err = createInMemory(nil, s.dbConf.FKConstraints)
+		s.db, err = createInMemory(nil, s.ForeignKeys())
 		if err != nil {
 			return fmt.Errorf("failed to create in-memory database")
 		}
@@ -430,7 +681,7 @@ func (s *Store) Open() (retErr error) {
 	}
 
 	// Instantiate the Raft system.
-	ra, err := raft.NewRaft(config, s, s.raftLog, s.raftStable, snapshots, s.raftTn)
+	ra, err := raft.NewRaft(config, s, s.raftLog, s.raftStable, snapshots, s.snapTn)
 	if err != nil {
 		return fmt.Errorf("new raft: %s", err)
 	}
@@ -447,6 +698,12 @@ func (s *Store) Open() (retErr error) {
 	// Register and listen for leader changes.
 	s.raft.RegisterObserver(s.observer)
 	s.observerClose, s.observerDone = s.observe()
+	s.dbSizeClose, s.dbSizeDone = s.measureDBSize()
+	s.diskIO = newDiskIOSampler()
+	s.diskIOClose, s.diskIODone = s.sampleDiskIO()
+	s.matViewClose, s.matViewDone = s.refreshMatViews()
+	s.remoteClose, s.remoteDone = s.attachRemotes()
+	s.startSQLClose, s.startSQLDone = s.executeStartSQL()
 
 	return nil
 }
@@ -494,9 +751,12 @@ func (s *Store) RegisterReadyChannel(ch <-chan struct{}) {
 }
 
 // Ready returns true if the store is ready to serve requests. Ready is
-// defined as having no open channels registered via RegisterReadyChannel
-// and having a Leader.
+// defined as having no open channels registered via RegisterReadyChannel,
+// having a Leader, and the FSM not having halted.
 func (s *Store) Ready() bool {
+	if s.FSMHalt() != nil {
+		return false
+	}
 	l, err := s.LeaderAddr()
 	if err != nil || l == "" {
 		return false
@@ -528,6 +788,16 @@ func (s *Store) Close(wait bool) (retErr error) {
 
 	close(s.observerClose)
 	<-s.observerDone
+	close(s.dbSizeClose)
+	<-s.dbSizeDone
+	close(s.diskIOClose)
+	<-s.diskIODone
+	close(s.matViewClose)
+	<-s.matViewDone
+	close(s.remoteClose)
+	<-s.remoteDone
+	close(s.startSQLClose)
+	<-s.startSQLDone
 
 	f := s.raft.Shutdown()
 	if wait {
@@ -535,6 +805,9 @@ func (s *Store) Close(wait bool) (retErr error) {
 			return f.Error()
 		}
 	}
+	if s.archivingSnaps != nil {
+		s.archivingSnaps.Wait()
+	}
 	// Only shutdown Bolt and SQLite when Raft is done.
 	if err := s.db.Close(); err != nil {
 		return err
@@ -595,6 +868,12 @@ func (s *Store) WaitForAppliedIndex(idx uint64, timeout time.Duration) error {
 	}
 }
 
+// AppliedIndex returns the index of the last Raft log entry applied to the
+// state machine.
+func (s *Store) AppliedIndex() uint64 {
+	return s.raft.AppliedIndex()
+}
+
 // IsLeader is used to determine if the current node is cluster leader
 func (s *Store) IsLeader() bool {
 	return s.raft.State() == raft.Leader
@@ -864,11 +1143,13 @@ func (s *Store) Stats() (map[string]interface{}, error) {
 	if err != nil {
 		return nil, err
 	}
+	raftConf := s.raftConfig()
 	status := map[string]interface{}{
 		"open":             s.open,
 		"node_id":          s.raftID,
 		"raft":             raftStats,
 		"fsm_index":        fsmIdx,
+		"fsm_halt":         s.FSMHalt(),
 		"db_applied_index": dbAppliedIdx,
 		"addr":             s.Addr(),
 		"leader": map[string]string{
@@ -882,8 +1163,13 @@ func (s *Store) Stats() (map[string]interface{}, error) {
 		},
 		"startup_on_disk":        s.StartupOnDisk,
 		"apply_timeout":          s.ApplyTimeout.String(),
-		"heartbeat_timeout":      s.HeartbeatTimeout.String(),
-		"election_timeout":       s.ElectionTimeout.String(),
+		"heartbeat_timeout":      raftConf.HeartbeatTimeout.String(),
+		"election_timeout":       raftConf.ElectionTimeout.String(),
+		"commit_timeout":         raftConf.CommitTimeout.String(),
+		"leader_lease_timeout":   raftConf.LeaderLeaseTimeout.String(),
+		"max_append_entries":     raftConf.MaxAppendEntries,
+		"max_entry_size":         s.MaxEntrySize,
+		"min_sqlite_version":     s.MinSQLiteVersion,
 		"snapshot_threshold":     s.SnapshotThreshold,
 		"snapshot_interval":      s.SnapshotInterval.String(),
 		"reap_timeout":           s.ReapTimeout.String(),
@@ -897,11 +1183,83 @@ func (s *Store) Stats() (map[string]interface{}, error) {
 		"sqlite3":                dbStatus,
 		"db_conf":                s.dbConf,
 	}
+	if s.SnapshotArchiver != nil {
+		status["snapshot_archive"] = s.SnapshotArchiver.String()
+	}
+	if r := s.CARotation(); r != nil {
+		status["ca_rotation"] = r.Phase.String()
+	}
+	status["fk_constraints"] = s.ForeignKeys()
+	status["join_token_required"] = s.JoinTokenRequired
+	status["apply_backlog"] = map[string]interface{}{
+		"entries": s.ApplyBacklog(),
+		"max":     s.MaxApplyBacklog,
+	}
+	status["snapshot_send"] = map[string]interface{}{
+		"in_flight":      s.snapTn.InFlight(),
+		"max_concurrent": s.SnapshotSendMax,
+		"rate":           s.SnapshotSendRate,
+	}
+	status["disk_io"] = s.diskIO.Stats()
+	if v, err := s.SchemaVersion(); err == nil {
+		status["schema_version"] = v
+	}
 	return status, nil
 }
 
 // Execute executes queries that return no rows, but do modify the database.
 func (s *Store) Execute(ex *command.ExecuteRequest) ([]*command.ExecuteResult, error) {
+	results, _, err := s.ExecuteWithIndex(ex)
+	return results, err
+}
+
+// ExecuteWithIndex is like Execute, but also returns the index of the Raft
+// log entry which carried the request.
+func (s *Store) ExecuteWithIndex(ex *command.ExecuteRequest) ([]*command.ExecuteResult, uint64, error) {
+	if !s.open {
+		return nil, 0, ErrNotOpen
+	}
+
+	if s.raft.State() != raft.Leader {
+		return nil, 0, ErrNotLeader
+	}
+	if !s.Ready() {
+		return nil, 0, ErrNotReady
+	}
+	if err := s.checkSQLiteVersion(ex.GetRequest().GetStatements()); err != nil {
+		return nil, 0, err
+	}
+	if err := s.checkTriggers(ex.GetRequest().GetStatements()); err != nil {
+		return nil, 0, err
+	}
+	if err := s.checkCollationLoads(ex.GetRequest().GetStatements()); err != nil {
+		return nil, 0, err
+	}
+	if err := s.admitWrite(); err != nil {
+		return nil, 0, err
+	}
+
+	n := len(ex.GetRequest().GetStatements())
+	req, stamped := stampSchemaVersion(ex.GetRequest(), true)
+	if stamped {
+		ex = &command.ExecuteRequest{Request: req, Timings: ex.Timings}
+	}
+	results, idx, err := s.execute(ex)
+	if stamped {
+		stats.Add(numDDLBatches, 1)
+		if len(results) > n {
+			// Hide the results of stamping the schema version.
+			results = results[:n]
+		}
+	}
+	return results, idx, err
+}
+
+// DryRun executes the statements of the request within a transaction which
+// is always rolled back, returning the results they would have had, without
+// writing anything to the Raft log. It runs only on the Leader, so that the
+// statements are checked against the latest state of the database.
+func (s *Store) DryRun(ex *command.ExecuteRequest) ([]*command.ExecuteResult, error) {
 	if !s.open {
 		return nil, ErrNotOpen
 	}
@@ -912,14 +1270,41 @@ func (s *Store) Execute(ex *command.ExecuteRequest) ([]*command.ExecuteResult, e
 	if !s.Ready() {
 		return nil, ErrNotReady
 	}
+	if err := s.checkSQLiteVersion(ex.GetRequest().GetStatements()); err != nil {
+		return nil, err
+	}
+	if err := s.checkTriggers(ex.GetRequest().GetStatements()); err != nil {
+		return nil, err
+	}
+	if err := s.checkCollationLoads(ex.GetRequest().GetStatements()); err != nil {
+		return nil, err
+	}
 
-	return s.execute(ex)
+	// The dry run holds a transaction open, so block any database
+	// serialization while it runs.
+	s.queryTxMu.RLock()
+	defer s.queryTxMu.RUnlock()
+	stats.Add(numDryRuns, 1)
+	return s.db.DryRun(ex.Request, ex.Timings)
 }
 
-func (s *Store) execute(ex *command.ExecuteRequest) ([]*command.ExecuteResult, error) {
+// checkSQLiteVersion returns an error if any of the statements cannot be
+// applied by the oldest version of SQLite in the cluster.
+func (s *Store) checkSQLiteVersion(stmts []*command.Statement) error {
+	if s.MinSQLiteVersion == "" {
+		return nil
+	}
+	if err := command.CheckSQLiteVersion(stmts, s.MinSQLiteVersion); err != nil {
+		stats.Add(numDDLRejected, 1)
+		return err
+	}
+	return nil
+}
+
+func (s *Store) execute(ex *command.ExecuteRequest) ([]*command.ExecuteResult, uint64, error) {
 	b, compressed, err := s.tryCompress(ex)
 	if err != nil {
-		return nil, err
+		return nil, 0, err
 	}
 
 	c := &command.Command{
@@ -930,22 +1315,96 @@ func (s *Store) execute(ex *command.ExecuteRequest) ([]*command.ExecuteResult, e
 
 	b, err = command.Marshal(c)
 	if err != nil {
-		return nil, err
+		return nil, 0, err
+	}
+	if s.MaxEntrySize > 0 && len(b) > s.MaxEntrySize {
+		return s.executeChunked(ex)
 	}
 
-	af := s.raft.Apply(b, s.ApplyTimeout)
+	af := s.applyWait(b)
 	if af.Error() != nil {
 		if af.Error() == raft.ErrNotLeader {
-			return nil, ErrNotLeader
+			return nil, 0, ErrNotLeader
 		}
-		return nil, af.Error()
+		return nil, 0, af.Error()
 	}
 
 	s.dbAppliedIndexMu.Lock()
 	s.dbAppliedIndex = af.Index()
 	s.dbAppliedIndexMu.Unlock()
 	r := af.Response().(*fsmExecuteResponse)
-	return r.results, r.error
+	return r.results, af.Index(), r.error
+}
+
+// executeChunked writes an execute request, which is too large for a single
+// Raft log entry, as a sequence of chunks. The request is applied once the
+// final chunk is committed.
+func (s *Store) executeChunked(ex *command.ExecuteRequest) ([]*command.ExecuteResult, uint64, error) {
+	groups, err := chunkStatements(ex.GetRequest().GetStatements(), s.MaxEntrySize)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	s.chunkMu.Lock()
+	defer s.chunkMu.Unlock()
+	stats.Add(numChunkedExecutes, 1)
+	id := fmt.Sprintf("%s-%d", s.raftID, time.Now().UnixNano())
+	for i, stmts := range groups {
+		ch := &command.ExecuteChunk{
+			Id:    id,
+			Seq:   uint64(i),
+			Final: i == len(groups)-1,
+			Request: &command.Request{
+				Transaction: ex.GetRequest().GetTransaction(),
+				Partial:     ex.GetRequest().GetPartial(),
+				Statements:  stmts,
+			},
+			Timings: ex.Timings,
+		}
+		af, err := s.applyChunk(ch)
+		if err == nil {
+			r := af.Response().(*fsmExecuteResponse)
+			if ch.Final {
+				s.dbAppliedIndexMu.Lock()
+				s.dbAppliedIndex = af.Index()
+				s.dbAppliedIndexMu.Unlock()
+				return r.results, af.Index(), r.error
+			}
+			err = r.error
+		}
+		if err != nil {
+			if i > 0 {
+				// Best effort, the partial request is otherwise discarded
+				// when the next chunked request starts, or the term changes.
+				s.applyChunk(&command.ExecuteChunk{Id: id, Abort: true, Request: &command.Request{}})
+			}
+			return nil, 0, err
+		}
+	}
+	return nil, 0, nil
+}
+
+func (s *Store) applyChunk(ch *command.ExecuteChunk) (raft.ApplyFuture, error) {
+	b, compressed, err := s.tryCompress(ch)
+	if err != nil {
+		return nil, err
+	}
+	b, err = command.Marshal(&command.Command{
+		Type:       command.Command_COMMAND_TYPE_EXECUTE_CHUNK,
+		SubCommand: b,
+		Compressed: compressed,
+	})
+	if err != nil {
+		return nil, err
+	}
+	af := s.applyWait(b)
+	if af.Error() != nil {
+		if af.Error() == raft.ErrNotLeader {
+			return nil, ErrNotLeader
+		}
+		return nil, af.Error()
+	}
+	return af, nil
 }
 
 // Query executes queries that return rows, and do not modify the database.
@@ -962,6 +1421,9 @@ func (s *Store) Query(qr *command.QueryRequest) ([]*command.QueryRows, error) {
 		if !s.Ready() {
 			return nil, ErrNotReady
 		}
+		if err := s.checkSchemaVersion(qr.MinSchemaVersion); err != nil {
+			return nil, err
+		}
 
 		b, compressed, err := s.tryCompress(qr)
 		if err != nil {
@@ -978,7 +1440,7 @@ func (s *Store) Query(qr *command.QueryRequest) ([]*command.QueryRows, error) {
 			return nil, err
 		}
 
-		af := s.raft.Apply(b, s.ApplyTimeout)
+		af := s.applyWait(b)
 		if af.Error() != nil {
 			if af.Error() == raft.ErrNotLeader {
 				return nil, ErrNotLeader
@@ -997,10 +1459,19 @@ func (s *Store) Query(qr *command.QueryRequest) ([]*command.QueryRows, error) {
 		return nil, ErrNotLeader
 	}
 
+	if qr.Level == command.QueryRequest_QUERY_REQUEST_LEVEL_WEAK && qr.LeaderFreshness > 0 {
+		if _, err := s.VerifyLeaderFreshness(time.Duration(qr.LeaderFreshness)); err != nil {
+			return nil, err
+		}
+	}
+
 	if s.raft.State() != raft.Leader && qr.Level == command.QueryRequest_QUERY_REQUEST_LEVEL_NONE &&
 		qr.Freshness > 0 && time.Since(s.raft.LastContact()).Nanoseconds() > qr.Freshness {
 		return nil, ErrStaleRead
 	}
+	if err := s.checkSchemaVersion(qr.MinSchemaVersion); err != nil {
+		return nil, err
+	}
 
 	if qr.Request.Transaction {
 		// Transaction requested during query, but not going through consensus. This means
@@ -1009,19 +1480,27 @@ func (s *Store) Query(qr *command.QueryRequest) ([]*command.QueryRows, error) {
 		defer s.queryTxMu.RUnlock()
 	}
 
-	return s.db.Query(qr.Request, qr.Timings)
+	return s.db.QueryWithRemotes(qr.Request, qr.Timings)
 }
 
 // Request processes a request that may contain both Executes and Queries.
 func (s *Store) Request(eqr *command.ExecuteQueryRequest) ([]*command.ExecuteQueryResponse, error) {
+	results, _, err := s.RequestWithIndex(eqr)
+	return results, err
+}
+
+// RequestWithIndex is like Request, but also returns the index of the Raft
+// log entry which carried the request. The index is 0 if the request did not
+// go through the Raft log.
+func (s *Store) RequestWithIndex(eqr *command.ExecuteQueryRequest) ([]*command.ExecuteQueryResponse, uint64, error) {
 	if !s.open {
-		return nil, ErrNotOpen
+		return nil, 0, ErrNotOpen
 	}
 
 	if !s.RequiresLeader(eqr) {
 		if eqr.Level == command.QueryRequest_QUERY_REQUEST_LEVEL_NONE && eqr.Freshness > 0 &&
 			time.Since(s.raft.LastContact()).Nanoseconds() > eqr.Freshness {
-			return nil, ErrStaleRead
+			return nil, 0, ErrStaleRead
 		}
 		if eqr.Request.Transaction {
 			// Transaction requested during query, but not going through consensus. This means
@@ -1029,20 +1508,46 @@ func (s *Store) Request(eqr *command.ExecuteQueryRequest) ([]*command.ExecuteQue
 			s.queryTxMu.RLock()
 			defer s.queryTxMu.RUnlock()
 		}
-		return s.db.Request(eqr.Request, eqr.Timings)
+		results, err := s.db.Request(eqr.Request, eqr.Timings)
+		return results, 0, err
 	}
 
 	if s.raft.State() != raft.Leader {
-		return nil, ErrNotLeader
+		return nil, 0, ErrNotLeader
 	}
 
 	if !s.Ready() {
-		return nil, ErrNotReady
+		return nil, 0, ErrNotReady
+	}
+	if err := s.checkSQLiteVersion(eqr.GetRequest().GetStatements()); err != nil {
+		return nil, 0, err
+	}
+	if err := s.checkTriggers(eqr.GetRequest().GetStatements()); err != nil {
+		return nil, 0, err
+	}
+	if err := s.checkCollationLoads(eqr.GetRequest().GetStatements()); err != nil {
+		return nil, 0, err
+	}
+	if err := s.admitWrite(); err != nil {
+		return nil, 0, err
+	}
+
+	// Requests which may also hold queries keep their transaction setting.
+	n := len(eqr.GetRequest().GetStatements())
+	req, stamped := stampSchemaVersion(eqr.GetRequest(), false)
+	if stamped {
+		stats.Add(numDDLBatches, 1)
+		eqr = &command.ExecuteQueryRequest{
+			Request:   req,
+			Timings:   eqr.Timings,
+			Level:     eqr.Level,
+			Freshness: eqr.Freshness,
+		}
 	}
 
 	b, compressed, err := s.tryCompress(eqr)
 	if err != nil {
-		return nil, err
+		return nil, 0, err
 	}
 
 	c := &command.Command{
@@ -1053,22 +1558,26 @@ func (s *Store) Request(eqr *command.ExecuteQueryRequest) ([]*command.ExecuteQue
 
 	b, err = command.Marshal(c)
 	if err != nil {
-		return nil, err
+		return nil, 0, err
 	}
 
-	af := s.raft.Apply(b, s.ApplyTimeout)
+	af := s.applyWait(b)
 	if af.Error() != nil {
 		if af.Error() == raft.ErrNotLeader {
-			return nil, ErrNotLeader
+			return nil, 0, ErrNotLeader
 		}
-		return nil, af.Error()
+		return nil, 0, af.Error()
 	}
 
 	s.dbAppliedIndexMu.Lock()
 	s.dbAppliedIndex = af.Index()
 	s.dbAppliedIndexMu.Unlock()
 	r := af.Response().(*fsmExecuteQueryResponse)
-	return r.results, r.error
+	if stamped && len(r.results) > n {
+		// Hide the results of stamping the schema version.
+		r.results = r.results[:n]
+	}
+	return r.results, af.Index(), r.error
 }
 
 // Backup writes a snapshot of the underlying database to dst
@@ -1081,18 +1590,20 @@ func (s *Store) Backup(br *command.BackupRequest, dst io.Writer) (retErr error)
 		return ErrNotOpen
 	}
 
-	startT := time.Now()
+	if br.Leader && s.raft.State() != raft.Leader {
+		return ErrNotLeader
+	}
+
+	cw := &countingWriter{w: dst}
+	dst = cw
+	finish := s.startEvent(EventBackup)
 	defer func() {
 		if retErr == nil {
 			stats.Add(numBackups, 1)
-			s.logger.Printf("database backed up in %s", time.Since(startT))
 		}
+		finish(cw.n, retErr)
 	}()
 
-	if br.Leader && s.raft.State() != raft.Leader {
-		return ErrNotLeader
-	}
-
 	if br.Format == command.BackupRequest_BACKUP_REQUEST_FORMAT_BINARY {
 		f, err := os.CreateTemp("", "rqlite-snap-")
 		if err != nil {
@@ -1106,6 +1617,7 @@ func (s *Store) Backup(br *command.BackupRequest, dst io.Writer) (retErr error)
 		if err := s.db.Backup(f.Name()); err != nil {
 			return err
 		}
+		accountBackup(f.Name())
 
 		of, err := os.Open(f.Name())
 		if err != nil {
@@ -1123,10 +1635,20 @@ func (s *Store) Backup(br *command.BackupRequest, dst io.Writer) (retErr error)
 
 // Provide implements the uploader Provider interface, allowing the
 // Store to be used as a DataProvider for an uploader.
-func (s *Store) Provide(path string) error {
+func (s *Store) Provide(path string) (retErr error) {
+	var size int64
+	finish := s.startEvent(EventBackup)
+	defer func() {
+		finish(size, retErr)
+	}()
+
 	if err := s.db.Backup(path); err != nil {
 		return err
 	}
+	if fi, err := os.Stat(path); err == nil {
+		size = fi.Size()
+		addDiskIO(diskIOBackup, size, 1)
+	}
 	stats.Add(numProvides, 1)
 	return nil
 }
@@ -1151,8 +1673,11 @@ func (s *Store) Load(lr *command.LoadRequest) error {
 
 // load loads an entire SQLite file into the database, and is for internal use
 // only. It does not check for readiness, and does not update statistics.
-func (s *Store) load(lr *command.LoadRequest) error {
-	startT := time.Now()
+func (s *Store) load(lr *command.LoadRequest) (retErr error) {
+	finish := s.startEvent(EventLoad)
+	defer func() {
+		finish(int64(len(lr.Data)), retErr)
+	}()
 
 	b, err := command.MarshalLoadRequest(lr)
 	if err != nil {
@@ -1170,7 +1695,7 @@ func (s *Store) load(lr *command.LoadRequest) error {
 		return err
 	}
 
-	af := s.raft.Apply(b, s.ApplyTimeout)
+	af := s.applyWait(b)
 	if af.Error() != nil {
 		if af.Error() == raft.ErrNotLeader {
 			return ErrNotLeader
@@ -1182,8 +1707,6 @@ func (s *Store) load(lr *command.LoadRequest) error {
 	s.dbAppliedIndexMu.Lock()
 	s.dbAppliedIndex = af.Index()
 	s.dbAppliedIndexMu.Unlock()
-	s.logger.Printf("node loaded in %s (%d bytes)", time.Since(startT), len(b))
-
 	return nil
 }
 
@@ -1258,19 +1781,49 @@ func (s *Store) Join(jr *command.JoinRequest) error {
 		return err
 	}
 
+	if s.JoinTokenRequired && !isMember(configFuture.Configuration(), id, addr) {
+		if err := s.checkJoinToken(jr.Token); err != nil {
+			stats.Add(numJoinsRejected, 1)
+			s.logger.Printf("rejected join request from node %s at %s: %s", id, addr, err)
+			return err
+		}
+	}
+	if !isMember(configFuture.Configuration(), id, addr) {
+		if err := s.checkCollations(jr.Collations); err != nil {
+			stats.Add(numJoinsRejected, 1)
+			s.logger.Printf("rejected join request from node %s at %s: %s", id, addr, err)
+			return err
+		}
+		if err := s.checkICU(jr.Icu); err != nil {
+			stats.Add(numJoinsRejected, 1)
+			s.logger.Printf("rejected join request from node %s at %s: %s", id, addr, err)
+			return err
+		}
+	}
+
 	for _, srv := range configFuture.Configuration().Servers {
 		// If a node already exists with either the joining node's ID or address,
 		// that node may need to be removed from the config first.
 		if srv.ID == raft.ServerID(id) || srv.Address == raft.ServerAddress(addr) {
 			// However, if *both* the ID and the address are the same, then no
-			// join is actually needed.
+			// join is actually needed -- unless a non-voting node is requesting
+			// promotion to voter.
 			if srv.Address == raft.ServerAddress(addr) && srv.ID == raft.ServerID(id) {
+				if voter && srv.Suffrage == raft.Nonvoter {
+					return s.promote(id, addr)
+				}
 				stats.Add(numIgnoredJoins, 1)
 				s.numIgnoredJoins++
 				s.logger.Printf("node %s at %s already member of cluster, ignoring join request", id, addr)
 				return nil
 			}
 
+			if srv.ID == raft.ServerID(id) {
+				if err := s.checkNodeIDInUse(srv, addr); err != nil {
+					return err
+				}
+			}
+
 			if err := s.remove(id); err != nil {
 				s.logger.Printf("failed to remove node %s: %v", id, err)
 				return err
@@ -1298,6 +1851,78 @@ func (s *Store) Join(jr *command.JoinRequest) error {
 	return nil
 }
 
+// promote promotes the non-voting node with the given ID to a voter.
+func (s *Store) promote(id, addr string) error {
+	f := s.raft.AddVoter(raft.ServerID(id), raft.ServerAddress(addr), 0, 0)
+	if f.Error() != nil {
+		if f.Error() == raft.ErrNotLeader {
+			return ErrNotLeader
+		}
+		return f.Error()
+	}
+	stats.Add(numPromotions, 1)
+	s.logger.Printf("node with ID %s, at %s, promoted to voter", id, addr)
+	return nil
+}
+
+// Demote demotes the voting node with the given ID to a non-voter. The
+// node remains a member of the cluster, and continues to receive log
+// entries, but no longer counts towards quorum.
+func (s *Store) Demote(id string) error {
+	if !s.open {
+		return ErrNotOpen
+	}
+
+	if s.raft.State() != raft.Leader {
+		return ErrNotLeader
+	}
+
+	configFuture := s.raft.GetConfiguration()
+	if err := configFuture.Error(); err != nil {
+		return err
+	}
+	found := false
+	for _, srv := range configFuture.Configuration().Servers {
+		if srv.ID == raft.ServerID(id) {
+			if srv.Suffrage != raft.Voter {
+				return ErrNotVoter
+			}
+			found = true
+		}
+	}
+	if !found {
+		return ErrNodeNotFound
+	}
+
+	f := s.raft.DemoteVoter(raft.ServerID(id), 0, 0)
+	if f.Error() != nil {
+		if f.Error() == raft.ErrNotLeader {
+			return ErrNotLeader
+		}
+		return f.Error()
+	}
+	stats.Add(numDemotions, 1)
+	s.logger.Printf("node %s demoted to non-voter", id)
+	return nil
+}
+
+// CaughtUp returns whether this node has applied every log entry the Leader
+// has reported as committed, and has heard from the Leader within the
+// given duration.
+func (s *Store) CaughtUp(contact time.Duration) bool {
+	if !s.open {
+		return false
+	}
+	if time.Since(s.raft.LastContact()) > contact {
+		return false
+	}
+	commitIdx, err := strconv.ParseUint(s.raft.Stats()["commit_index"], 10, 64)
+	if err != nil || commitIdx == 0 {
+		return false
+	}
+	return s.raft.AppliedIndex() >= commitIdx
+}
+
 // Remove removes a node from the store.
 func (s *Store) Remove(rn *command.RemoveNodeRequest) error {
 	if !s.open {
@@ -1345,6 +1970,42 @@ func (s *Store) Noop(id string) error {
 	return nil
 }
 
+// VerifyLeaderFreshness checks that a quorum of the cluster confirmed this
+// node's leadership no longer than maxAge ago. If the last confirmation is
+// older, a fresh one is sought, and if that fails ErrNotLeader or ErrStaleRead
+// is returned. It returns the age of the confirmation relied upon.
+//
+// As long as maxAge is shorter than the election timeout, no other node can
+// have become leader since the confirmation, so a read served after a
+// successful check is not stale.
+func (s *Store) VerifyLeaderFreshness(maxAge time.Duration) (time.Duration, error) {
+	if s.raft.State() != raft.Leader {
+		return 0, ErrNotLeader
+	}
+
+	s.leaderVerifiedMu.Lock()
+	defer s.leaderVerifiedMu.Unlock()
+	if !s.leaderVerified.IsZero() {
+		if age := time.Since(s.leaderVerified); age <= maxAge {
+			return age, nil
+		}
+	}
+
+	// Leadership is confirmed as of the moment verification starts, since
+	// a quorum acknowledges heartbeats sent after this point.
+	start := time.Now()
+	stats.Add(numLeaderVerifications, 1)
+	if err := s.raft.VerifyLeader().Error(); err != nil {
+		stats.Add(numLeaderVerifyFailures, 1)
+		if err == raft.ErrNotLeader || err == raft.ErrLeadershipLost {
+			return 0, ErrNotLeader
+		}
+		return 0, ErrStaleRead
+	}
+	s.leaderVerified = start
+	return time.Since(start), nil
+}
+
 // RequiresLeader returns whether the given ExecuteQueryRequest must be
 // processed on the cluster Leader.
 func (s *Store) RequiresLeader(eqr *command.ExecuteQueryRequest) bool {
@@ -1413,6 +2074,12 @@ func (s *Store) raftConfig() *raft.Config {
 	if s.ElectionTimeout != 0 {
 		config.ElectionTimeout = s.ElectionTimeout
 	}
+	if s.CommitTimeout != 0 {
+		config.CommitTimeout = s.CommitTimeout
+	}
+	if s.MaxAppendEntries != 0 {
+		config.MaxAppendEntries = s.MaxAppendEntries
+	}
 	return config
 }
 
@@ -1431,13 +2098,34 @@ type fsmExecuteQueryResponse struct {
 	error   error
 }
 
+type fsmCARotationResponse struct {
+	request *command.CARotationRequest
+}
+
+type fsmForeignKeysResponse struct {
+	request *command.ForeignKeys
+}
+
+type fsmJoinTokensResponse struct {
+	request *command.JoinTokenRequest
+}
+
 type fsmGenericResponse struct {
 	error error
 }
 
 // Apply applies a Raft log entry to the database.
 func (s *Store) Apply(l *raft.Log) (e interface{}) {
+	if s.FSMHalt() != nil {
+		return haltedResponse(l.Data)
+	}
+
 	defer func() {
+		if s.FSMHalt() != nil {
+			// The entry was not applied.
+			return
+		}
+
 		s.fsmIndexMu.Lock()
 		defer s.fsmIndexMu.Unlock()
 		s.fsmIndex = l.Index
@@ -1471,7 +2159,7 @@ func (s *Store) Apply(l *raft.Log) (e interface{}) {
 						return
 					}
 					// Open a new on-disk database.
-					s.db, err = createOnDisk(b, s.dbPath, s.dbConf.FKConstraints)
+					s.db, err = createOnDisk(b, s.dbPath, s.ForeignKeys())
 					if err != nil {
 						e = &fsmGenericResponse{error: fmt.Errorf("open on-disk failed: %s", err)}
 						return
@@ -1487,10 +2175,28 @@ func (s *Store) Apply(l *raft.Log) (e interface{}) {
 		s.firstLogAppliedT = time.Now()
 	}
 
-	typ, r := applyCommand(l.Data, &s.db)
+	s.chunks.expire(l.Term)
+	retry := &applyRetryPolicy{maxRetries: s.ApplyRetries, delay: s.ApplyRetryDelay}
+	accountWrites := s.accountSQLiteWrites()
+	typ, r := applyCommand(l.Data, l.Term, &s.db, &s.chunks, retry)
+	accountWrites()
 	if typ == command.Command_COMMAND_TYPE_NOOP {
 		s.numNoops++
 	}
+	var he *haltError
+	if errors.As(responseError(r), &he) {
+		s.haltFSM(l, he.err)
+		return r
+	}
+	if cr, ok := r.(*fsmCARotationResponse); ok {
+		return s.applyCARotation(cr.request)
+	}
+	if fr, ok := r.(*fsmForeignKeysResponse); ok {
+		return s.applyForeignKeys(fr.request)
+	}
+	if jr, ok := r.(*fsmJoinTokensResponse); ok {
+		return s.applyJoinTokens(jr.request)
+	}
 	return r
 }
 
@@ -1520,6 +2226,18 @@ func (s *Store) Database(leader bool) ([]byte, error) {
 // http://sqlite.org/howtocorrupt.html states it is safe to copy or serialize the
 // database as long as no writes to the database are in progress.
 func (s *Store) Snapshot() (raft.FSMSnapshot, error) {
+	// The log entries of a partially-applied chunked request must not be
+	// truncated, as the database does not yet reflect them.
+	if s.chunks.pending() {
+		return nil, ErrChunkedRequestPending
+	}
+
+	// The log entries from that at which the FSM halted must not be
+	// truncated, as the database does not reflect them.
+	if s.FSMHalt() != nil {
+		return nil, ErrFSMHalted
+	}
+
 	defer func() {
 		s.numSnapshotsMu.Lock()
 		defer s.numSnapshotsMu.Unlock()
@@ -1528,12 +2246,34 @@ func (s *Store) Snapshot() (raft.FSMSnapshot, error) {
 
 	s.queryTxMu.Lock()
 	defer s.queryTxMu.Unlock()
+	finish := s.startEvent(EventSnapshot)
 	fsm := newFSMSnapshot(s.db, s.logger)
+	fsm.finish = finish
+	if r := s.CARotation(); r != nil {
+		b, err := proto.Marshal(r)
+		if err != nil {
+			return nil, err
+		}
+		fsm.caRotation = b
+	}
+	if fk := s.foreignKeysState(); fk != nil {
+		b, err := proto.Marshal(fk)
+		if err != nil {
+			return nil, err
+		}
+		fsm.foreignKeys = b
+	}
+	if jt := s.joinTokensState(); jt != nil {
+		b, err := proto.Marshal(jt)
+		if err != nil {
+			return nil, err
+		}
+		fsm.joinTokens = b
+	}
 	dur := time.Since(fsm.startT)
 	stats.Add(numSnaphots, 1)
 	stats.Get(snapshotCreateDuration).(*expvar.Int).Set(dur.Milliseconds())
 	stats.Get(snapshotDBSerializedSize).(*expvar.Int).Set(int64(len(fsm.database)))
-	s.logger.Printf("node snapshot created in %s", dur)
 	return fsm, nil
 }
 
@@ -1541,19 +2281,32 @@ func (s *Store) Snapshot() (raft.FSMSnapshot, error) {
 // will not be called concurrently with Apply(), so synchronization with Execute()
 // is not necessary. To prevent problems during queries, which may not go through
 // the log, it blocks all query requests.
-func (s *Store) Restore(rc io.ReadCloser) error {
-	startT := time.Now()
-	b, err := dbBytesFromSnapshot(rc)
+func (s *Store) Restore(rc io.ReadCloser) (retErr error) {
+	var size int64
+	finish := s.startEvent(EventSnapshotInstall)
+	defer func() {
+		finish(size, retErr)
+	}()
+
+	b, state, err := readSnapshot(rc)
 	if err != nil {
 		return fmt.Errorf("restore failed: %s", err.Error())
 	}
 	if b == nil {
 		s.logger.Println("no database data present in restored snapshot")
 	}
+	size = int64(len(b))
 
 	if err := s.db.Close(); err != nil {
 		return fmt.Errorf("failed to close pre-restore database: %s", err)
 	}
+	s.chunks.reset()
+	s.resumeFSM()
+
+	// The database must be created with the foreign key setting in force
+	// when the snapshot was taken.
+	s.setForeignKeys(state.foreignKeys)
+	s.setJoinTokens(state.joinTokens)
 
 	var db *sql.DB
 	if s.StartupOnDisk || (!s.dbConf.Memory && s.lastCommandIdxOnOpen == 0) {
@@ -1562,7 +2315,7 @@ func (s *Store) Restore(rc io.ReadCloser) error {
 		// Therefore, this is the last opportunity to create the on-disk database
 		// before Raft starts. This could also happen because the user has explicitly
 		// disabled the build-on-disk-database-in-memory-first optimization.
-		db, err = createOnDisk(b, s.dbPath, s.dbConf.FKConstraints)
+		db, err = createOnDisk(b, s.dbPath, s.ForeignKeys())
 		if err != nil {
 			return fmt.Errorf("open on-disk file during restore: %s", err)
 		}
@@ -1574,15 +2327,15 @@ func (s *Store) Restore(rc io.ReadCloser) error {
 		// command entries in the log. So by sticking with an in-memory database
 		// those entries will be applied in the fastest possible manner. We will
 		// defer creation of any database on disk until the Apply function.
-		db, err = createInMemory(b, s.dbConf.FKConstraints)
+		db, err = createInMemory(b, s.ForeignKeys())
 		if err != nil {
 			return fmt.Errorf("createInMemory: %s", err)
 		}
 	}
 	s.db = db
+	s.setCARotation(state.caRotation)
 
 	stats.Add(numRestores, 1)
-	s.logger.Printf("node restored in %s", time.Since(startT))
 	return nil
 }
 
@@ -1656,6 +2409,11 @@ func (s *Store) observe() (closeCh, doneCh chan struct{}) {
 						}
 					}
 					s.leaderObserversMu.RUnlock()
+
+					// Confirmations of any earlier leadership no longer count.
+					s.leaderVerifiedMu.Lock()
+					s.leaderVerified = time.Time{}
+					s.leaderVerifiedMu.Unlock()
 					s.selfLeaderChange(signal.LeaderID == raft.ServerID(s.raftID))
 				}
 
@@ -1741,11 +2499,34 @@ func (s *Store) tryCompress(rq command.Requester) ([]byte, bool, error) {
 	return b, compressed, nil
 }
 
+const (
+	// snapshotCARotationMarker precedes the state of CA rotation in a snapshot.
+	snapshotCARotationMarker = math.MaxUint64 - 1
+
+	// snapshotForeignKeysMarker precedes the replicated foreign key setting
+	// in a snapshot.
+	snapshotForeignKeysMarker = math.MaxUint64 - 2
+
+	// snapshotJoinTokensMarker precedes the join tokens in a snapshot.
+	snapshotJoinTokensMarker = math.MaxUint64 - 3
+)
+
+// snapshotState is the state, other than the database, held by a snapshot.
+type snapshotState struct {
+	caRotation  *command.CARotation
+	foreignKeys *command.ForeignKeys
+	joinTokens  *command.JoinTokens
+}
+
 type fsmSnapshot struct {
 	startT time.Time
 	logger *log.Logger
+	finish func(size int64, err error) // Called once persisted, if set.
 
-	database []byte
+	database    []byte
+	caRotation  []byte // State of CA rotation, if any, written after the database.
+	foreignKeys []byte // Foreign key setting, if any, written after the database.
+	joinTokens  []byte // Join tokens, if any, written after the database.
 }
 
 func newFSMSnapshot(db *sql.DB, logger *log.Logger) *fsmSnapshot {
@@ -1761,11 +2542,16 @@ func newFSMSnapshot(db *sql.DB, logger *log.Logger) *fsmSnapshot {
 }
 
 // Persist writes the snapshot to the given sink.
-func (f *fsmSnapshot) Persist(sink raft.SnapshotSink) error {
+func (f *fsmSnapshot) Persist(sink raft.SnapshotSink) (retErr error) {
+	var size int64
 	defer func() {
 		dur := time.Since(f.startT)
 		stats.Get(snapshotPersistDuration).(*expvar.Int).Set(dur.Milliseconds())
-		f.logger.Printf("snapshot and persist took %s", dur)
+		if f.finish != nil {
+			f.finish(size, retErr)
+		} else {
+			f.logger.Printf("snapshot and persist took %s", dur)
+		}
 	}()
 
 	err := func() error {
@@ -1804,6 +2590,7 @@ func (f *fsmSnapshot) Persist(sink raft.SnapshotSink) error {
 				return err
 			}
 			stats.Get(snapshotDBOnDiskSize).(*expvar.Int).Set(int64(len(cdb)))
+			size = int64(len(cdb))
 		} else {
 			f.logger.Println("no database data available for snapshot")
 			err = writeUint64(b, uint64(0))
@@ -1816,6 +2603,34 @@ func (f *fsmSnapshot) Persist(sink raft.SnapshotSink) error {
 			stats.Get(snapshotDBOnDiskSize).(*expvar.Int).Set(0)
 		}
 
+		// Any state other than the database follows it, so that earlier
+		// versions can still read the snapshot.
+		for _, st := range []struct {
+			marker uint64
+			data   []byte
+		}{
+			{snapshotCARotationMarker, f.caRotation},
+			{snapshotForeignKeysMarker, f.foreignKeys},
+			{snapshotJoinTokensMarker, f.joinTokens},
+		} {
+			if st.data == nil {
+				continue
+			}
+			b.Reset()
+			if err := writeUint64(b, st.marker); err != nil {
+				return err
+			}
+			if err := writeUint64(b, uint64(len(st.data))); err != nil {
+				return err
+			}
+			if _, err := sink.Write(b.Bytes()); err != nil {
+				return err
+			}
+			if _, err := sink.Write(st.data); err != nil {
+				return err
+			}
+		}
+
 		// Close the sink.
 		return sink.Close()
 	}()
@@ -1853,9 +2668,11 @@ func (f *fsmSnapshot) Release() {}
 
 // RecoverNode is used to manually force a new configuration, in the event that
 // quorum cannot be restored. This borrows heavily from RecoverCluster functionality
-// of the Hashicorp Raft library, but has been customized for rqlite use.
+// of the Hashicorp Raft library, but has been customized for rqlite use. If salvage
+// is true, recovery continues past unreadable Raft log entries, discarding them and
+// every later entry, rather than failing.
 func RecoverNode(dataDir string, logger *log.Logger, logs raft.LogStore, stable raft.StableStore,
-	snaps raft.SnapshotStore, tn raft.Transport, conf raft.Configuration) error {
+	snaps raft.SnapshotStore, tn raft.Transport, conf raft.Configuration, salvage bool) error {
 	logPrefix := logger.Prefix()
 	logger.SetPrefix(fmt.Sprintf("%s[recovery] ", logPrefix))
 	defer logger.SetPrefix(logPrefix)
@@ -1876,42 +2693,53 @@ func RecoverNode(dataDir string, logger *log.Logger, logs raft.LogStore, stable
 	}
 	logger.Printf("recovery detected %d snapshots", len(snapshots))
 
-	var b []byte
+	// Create an in-memory database for temporary use, so we can generate new
+	// snapshots later.
+	var db *sql.DB
 	for _, snapshot := range snapshots {
 		var source io.ReadCloser
 		_, source, err = snaps.Open(snapshot.ID)
 		if err != nil {
 			// Skip this one and try the next. We will detect if we
 			// couldn't open any snapshots.
+			logger.Printf("failed to open snapshot %s: %s", snapshot.ID, err.Error())
 			continue
 		}
 
+		var b []byte
 		b, err = dbBytesFromSnapshot(source)
 		// Close the source after the restore has completed
 		source.Close()
 		if err != nil {
 			// Same here, skip and try the next one.
+			logger.Printf("failed to read snapshot %s: %s", snapshot.ID, err.Error())
 			continue
 		}
 
+		if len(b) == 0 {
+			db, err = sql.OpenInMemory(false)
+		} else {
+			db, err = sql.DeserializeIntoMemory(b, false)
+		}
+		if err != nil {
+			logger.Printf("failed to load database from snapshot %s: %s", snapshot.ID, err.Error())
+			db = nil
+			continue
+		}
+
+		logger.Printf("recovering from snapshot %s", snapshot.ID)
 		snapshotIndex = snapshot.Index
 		snapshotTerm = snapshot.Term
 		break
 	}
-	if len(snapshots) > 0 && (snapshotIndex == 0 || snapshotTerm == 0) {
+	if len(snapshots) > 0 && db == nil {
 		return fmt.Errorf("failed to restore any of the available snapshots")
 	}
-
-	// Now, create an in-memory database for temporary use, so we can generate new
-	// snapshots later.
-	var db *sql.DB
-	if len(b) == 0 {
+	if db == nil {
 		db, err = sql.OpenInMemory(false)
-	} else {
-		db, err = sql.DeserializeIntoMemory(b, false)
-	}
-	if err != nil {
-		return fmt.Errorf("create in-memory database failed: %s", err)
+		if err != nil {
+			return fmt.Errorf("create in-memory database failed: %s", err)
+		}
 	}
 	defer db.Close()
 
@@ -1927,13 +2755,33 @@ func RecoverNode(dataDir string, logger *log.Logger, logs raft.LogStore, stable
 	}
 	logger.Printf("recovery snapshot index is %d, last index is %d", snapshotIndex, lastLogIndex)
 
+	var chunks chunkBuffer
 	for index := snapshotIndex + 1; index <= lastLogIndex; index++ {
 		var entry raft.Log
-		if err = logs.GetLog(index, &entry); err != nil {
-			return fmt.Errorf("failed to get log at index %d: %v", index, err)
+		err = logs.GetLog(index, &entry)
+		if err == nil && entry.Type == raft.LogCommand {
+			err = command.Unmarshal(entry.Data, &command.Command{})
+		}
+		if err != nil {
+			if !salvage {
+				return fmt.Errorf("failed to get log at index %d: %v", index, err)
+			}
+			logger.Printf("log at index %d is unreadable (%s), discarding log entries %d to %d",
+				index, err.Error(), index, lastLogIndex)
+			break
 		}
+		chunks.expire(entry.Term)
 		if entry.Type == raft.LogCommand {
-			applyCommand(entry.Data, &db)
+			_, r := applyCommand(entry.Data, entry.Term, &db, &chunks, nil)
+			var he *haltError
+			if errors.As(responseError(r), &he) {
+				if !salvage {
+					return fmt.Errorf("failed to apply log at index %d: %v", index, he.err)
+				}
+				logger.Printf("log at index %d cannot be applied (%s), discarding log entries %d to %d",
+					index, he.err.Error(), index, lastLogIndex)
+				break
+			}
 		}
 		lastIndex = entry.Index
 		lastTerm = entry.Term
@@ -1968,6 +2816,13 @@ func RecoverNode(dataDir string, logger *log.Logger, logs raft.LogStore, stable
 }
 
 func dbBytesFromSnapshot(rc io.ReadCloser) ([]byte, error) {
+	database, _, err := readSnapshot(rc)
+	return database, err
+}
+
+// readSnapshot returns the database, and any other state, contained in a
+// snapshot.
+func readSnapshot(rc io.ReadCloser) ([]byte, snapshotState, error) {
 	var uint64Size uint64
 	inc := int64(unsafe.Sizeof(uint64Size))
 
@@ -1976,43 +2831,53 @@ func dbBytesFromSnapshot(rc io.ReadCloser) ([]byte, error) {
 	var offset int64
 	b, err := ioutil.ReadAll(rc)
 	if err != nil {
-		return nil, fmt.Errorf("readall: %s", err)
+		return nil, snapshotState{}, fmt.Errorf("readall: %s", err)
 	}
 
 	// Get size of database, checking for compression.
 	compressed := false
+	if int64(len(b)) < offset+inc {
+		return nil, snapshotState{}, fmt.Errorf("snapshot too short: %d bytes", len(b))
+	}
 	sz, err := readUint64(b[offset : offset+inc])
 	if err != nil {
-		return nil, fmt.Errorf("read compression check: %s", err)
+		return nil, snapshotState{}, fmt.Errorf("read compression check: %s", err)
 	}
 	offset = offset + inc
 
 	if sz == math.MaxUint64 {
 		compressed = true
 		// Database is actually compressed, read actual size next.
+		if int64(len(b)) < offset+inc {
+			return nil, snapshotState{}, fmt.Errorf("snapshot too short: %d bytes", len(b))
+		}
 		sz, err = readUint64(b[offset : offset+inc])
 		if err != nil {
-			return nil, fmt.Errorf("read compressed size: %s", err)
+			return nil, snapshotState{}, fmt.Errorf("read compressed size: %s", err)
 		}
 		offset = offset + inc
 	}
 
 	// Now read in the database file data, decompress if necessary, and restore.
 	var database []byte
+	if sz > uint64(int64(len(b))-offset) {
+		return nil, snapshotState{}, fmt.Errorf("snapshot truncated: expected %d bytes of database, have %d",
+			sz, int64(len(b))-offset)
+	}
 	if sz > 0 {
 		if compressed {
 			buf := new(bytes.Buffer)
 			gz, err := gzip.NewReader(bytes.NewReader(b[offset : offset+int64(sz)]))
 			if err != nil {
-				return nil, err
+				return nil, snapshotState{}, err
 			}
 
 			if _, err := io.Copy(buf, gz); err != nil {
-				return nil, fmt.Errorf("SQLite database decompress: %s", err)
+				return nil, snapshotState{}, fmt.Errorf("SQLite database decompress: %s", err)
 			}
 
 			if err := gz.Close(); err != nil {
-				return nil, err
+				return nil, snapshotState{}, err
 			}
 			database = buf.Bytes()
 		} else {
@@ -2021,57 +2886,133 @@ func dbBytesFromSnapshot(rc io.ReadCloser) ([]byte, error) {
 	} else {
 		database = nil
 	}
-	return database, nil
+	offset = offset + int64(sz)
+
+	// Snapshots written by earlier versions have no state following the
+	// database, though some have other data there.
+	var state snapshotState
+	for int64(len(b)) >= offset+2*inc {
+		marker, err := readUint64(b[offset : offset+inc])
+		if err != nil {
+			return nil, snapshotState{}, fmt.Errorf("read state marker: %s", err)
+		}
+		var m proto.Message
+		switch marker {
+		case snapshotCARotationMarker:
+			state.caRotation = &command.CARotation{}
+			m = state.caRotation
+		case snapshotForeignKeysMarker:
+			state.foreignKeys = &command.ForeignKeys{}
+			m = state.foreignKeys
+		case snapshotJoinTokensMarker:
+			state.joinTokens = &command.JoinTokens{}
+			m = state.joinTokens
+		default:
+			return database, state, nil
+		}
+		offset = offset + inc
+		sz, err = readUint64(b[offset : offset+inc])
+		if err != nil {
+			return nil, snapshotState{}, fmt.Errorf("read state size: %s", err)
+		}
+		offset = offset + inc
+		if sz > uint64(int64(len(b))-offset) {
+			return nil, snapshotState{}, fmt.Errorf("snapshot truncated: expected %d bytes of state, have %d",
+				sz, int64(len(b))-offset)
+		}
+		if err := proto.Unmarshal(b[offset:offset+int64(sz)], m); err != nil {
+			return nil, snapshotState{}, fmt.Errorf("unmarshal state: %s", err)
+		}
+		offset = offset + int64(sz)
+	}
+	return database, state, nil
 }
 
-func applyCommand(data []byte, pDB **sql.DB) (command.Command_Type, interface{}) {
+// applyCommand applies the command held by a log entry to the database. Failures
+// which mean the node cannot go on applying entries, such as an entry which
+// cannot be decoded, or a write which failed transiently even once retried
+// according to the retry policy, are returned as a haltError.
+func applyCommand(data []byte, term uint64, pDB **sql.DB, chunks *chunkBuffer, retry *applyRetryPolicy) (command.Command_Type, interface{}) {
 	var c command.Command
 	db := *pDB
 
 	if err := command.Unmarshal(data, &c); err != nil {
-		panic(fmt.Sprintf("failed to unmarshal cluster command: %s", err.Error()))
+		return c.Type, &fsmGenericResponse{error: &haltError{fmt.Errorf("failed to unmarshal cluster command: %s", err.Error())}}
 	}
 
 	switch c.Type {
 	case command.Command_COMMAND_TYPE_QUERY:
 		var qr command.QueryRequest
 		if err := command.UnmarshalSubCommand(&c, &qr); err != nil {
-			panic(fmt.Sprintf("failed to unmarshal query subcommand: %s", err.Error()))
+			return c.Type, &fsmQueryResponse{error: &haltError{fmt.Errorf("failed to unmarshal query subcommand: %s", err.Error())}}
 		}
-		r, err := db.Query(qr.Request, qr.Timings)
+		var r []*command.QueryRows
+		var err error
+		retry.do(func() (bool, bool) {
+			r, err = db.Query(qr.Request, qr.Timings)
+			return queryTransient(r, err), true
+		})
+		// A query which failed leaves the database as it was, so the FSM
+		// need not halt.
 		return c.Type, &fsmQueryResponse{rows: r, error: err}
 	case command.Command_COMMAND_TYPE_EXECUTE:
 		var er command.ExecuteRequest
 		if err := command.UnmarshalSubCommand(&c, &er); err != nil {
-			panic(fmt.Sprintf("failed to unmarshal execute subcommand: %s", err.Error()))
+			return c.Type, &fsmExecuteResponse{error: &haltError{fmt.Errorf("failed to unmarshal execute subcommand: %s", err.Error())}}
 		}
-		r, err := db.Execute(er.Request, er.Timings)
+		r, err := executeWithRetry(db, er.Request, er.Timings, retry)
+		return c.Type, &fsmExecuteResponse{results: r, error: err}
+	case command.Command_COMMAND_TYPE_EXECUTE_CHUNK:
+		var ch command.ExecuteChunk
+		if err := command.UnmarshalSubCommand(&c, &ch); err != nil {
+			return c.Type, &fsmExecuteResponse{error: &haltError{fmt.Errorf("failed to unmarshal execute chunk subcommand: %s", err.Error())}}
+		}
+		er, err := chunks.add(term, &ch)
+		if err != nil || er == nil {
+			return c.Type, &fsmExecuteResponse{error: err}
+		}
+		r, err := executeWithRetry(db, er.Request, er.Timings, retry)
 		return c.Type, &fsmExecuteResponse{results: r, error: err}
 	case command.Command_COMMAND_TYPE_EXECUTE_QUERY:
 		var eqr command.ExecuteQueryRequest
 		if err := command.UnmarshalSubCommand(&c, &eqr); err != nil {
-			panic(fmt.Sprintf("failed to unmarshal execute-query subcommand: %s", err.Error()))
+			return c.Type, &fsmExecuteQueryResponse{error: &haltError{fmt.Errorf("failed to unmarshal execute-query subcommand: %s", err.Error())}}
+		}
+		var r []*command.ExecuteQueryResponse
+		var err error
+		if retry.do(func() (bool, bool) {
+			r, err = db.Request(eqr.Request, eqr.Timings)
+			return requestTransient(eqr.Request, r, err)
+		}) {
+			err = &haltError{transientFailure(err, "execute-query request failed")}
 		}
-		r, err := db.Request(eqr.Request, eqr.Timings)
 		return c.Type, &fsmExecuteQueryResponse{results: r, error: err}
 	case command.Command_COMMAND_TYPE_LOAD:
 		var lr command.LoadRequest
 		if err := command.UnmarshalLoadRequest(c.SubCommand, &lr); err != nil {
-			panic(fmt.Sprintf("failed to unmarshal load subcommand: %s", err.Error()))
+			return c.Type, &fsmGenericResponse{error: &haltError{fmt.Errorf("failed to unmarshal load subcommand: %s", err.Error())}}
 		}
 
 		var newDB *sql.DB
 		var err error
-		if db.InMemory() {
-			newDB, err = createInMemory(lr.Data, db.FKEnabled())
-			if err != nil {
-				return c.Type, &fsmGenericResponse{error: fmt.Errorf("failed to create in-memory database: %s", err)}
+		transient := retry.do(func() (bool, bool) {
+			if db.InMemory() {
+				newDB, err = createInMemory(lr.Data, db.FKEnabled())
+			} else {
+				newDB, err = createOnDisk(lr.Data, db.Path(), db.FKEnabled())
 			}
-		} else {
-			newDB, err = createOnDisk(lr.Data, db.Path(), db.FKEnabled())
-			if err != nil {
-				return c.Type, &fsmGenericResponse{error: fmt.Errorf("failed to create on-disk database: %s", err)}
+			return isTransient(err), true
+		})
+		if err != nil {
+			if db.InMemory() {
+				err = fmt.Errorf("failed to create in-memory database: %s", err)
+			} else {
+				err = fmt.Errorf("failed to create on-disk database: %s", err)
 			}
+			if transient {
+				err = &haltError{err}
+			}
+			return c.Type, &fsmGenericResponse{error: err}
 		}
 
 		// Swap the underlying database to the new one.
@@ -2082,9 +3023,48 @@ func applyCommand(data []byte, pDB **sql.DB) (command.Command_Type, interface{})
 		return c.Type, &fsmGenericResponse{}
 	case command.Command_COMMAND_TYPE_NOOP:
 		return c.Type, &fsmGenericResponse{}
+	case command.Command_COMMAND_TYPE_CA_ROTATION:
+		// The state of CA rotation is held by the Store, which applies the
+		// request itself.
+		var cr command.CARotationRequest
+		if err := command.UnmarshalSubCommand(&c, &cr); err != nil {
+			return c.Type, &fsmGenericResponse{error: &haltError{fmt.Errorf("failed to unmarshal CA rotation subcommand: %s", err.Error())}}
+		}
+		return c.Type, &fsmCARotationResponse{request: &cr}
+	case command.Command_COMMAND_TYPE_FOREIGN_KEYS:
+		// The foreign key setting is held by the Store, which applies the
+		// request itself.
+		var fk command.ForeignKeys
+		if err := command.UnmarshalSubCommand(&c, &fk); err != nil {
+			return c.Type, &fsmGenericResponse{error: &haltError{fmt.Errorf("failed to unmarshal foreign keys subcommand: %s", err.Error())}}
+		}
+		return c.Type, &fsmForeignKeysResponse{request: &fk}
+	case command.Command_COMMAND_TYPE_JOIN_TOKENS:
+		// Join tokens are held by the Store, which applies the request itself.
+		var jr command.JoinTokenRequest
+		if err := command.UnmarshalSubCommand(&c, &jr); err != nil {
+			return c.Type, &fsmGenericResponse{error: &haltError{fmt.Errorf("failed to unmarshal join tokens subcommand: %s", err.Error())}}
+		}
+		return c.Type, &fsmJoinTokensResponse{request: &jr}
 	default:
-		return c.Type, &fsmGenericResponse{error: fmt.Errorf("unhandled command: %v", c.Type)}
+		// The entry was written by a newer version of rqlite.
+		return c.Type, &fsmGenericResponse{error: &haltError{fmt.Errorf("unhandled command: %v", c.Type)}}
+	}
+}
+
+// executeWithRetry executes the request, retrying it according to the retry
+// policy if it fails transiently. If it still fails transiently the error is
+// a haltError, as the database then differs from that of the other nodes.
+func executeWithRetry(db *sql.DB, req *command.Request, timings bool, retry *applyRetryPolicy) ([]*command.ExecuteResult, error) {
+	var r []*command.ExecuteResult
+	var err error
+	if retry.do(func() (bool, bool) {
+		r, err = db.Execute(req, timings)
+		return executeTransient(req, r, err)
+	}) {
+		err = &haltError{transientFailure(err, "execute request failed")}
 	}
+	return r, err
 }
 
 // checkRaftConfiguration tests a cluster membership configuration for common
@@ -2163,6 +3143,18 @@ func writeUint64(w io.Writer, v uint64) error {
 	return binary.Write(w, binary.LittleEndian, v)
 }
 
+// countingWriter counts the bytes written to the underlying writer.
+type countingWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (c *countingWriter) Write(p []byte) (int, error) {
+	n, err := c.w.Write(p)
+	c.n += int64(n)
+	return n, err
+}
+
 // enabledFromBool converts bool to "enabled" or "disabled".
 func enabledFromBool(b bool) string {
 	if b {
@@ -2179,6 +3171,17 @@ func prettyVoter(v bool) string {
 	return "non-voter"
 }
 
+// isMember returns whether the node with the given ID and address is a member
+// of the cluster with the given configuration.
+func isMember(conf raft.Configuration, id, addr string) bool {
+	for _, srv := range conf.Servers {
+		if srv.ID == raft.ServerID(id) && srv.Address == raft.ServerAddress(addr) {
+			return true
+		}
+	}
+	return false
+}
+
 // pathExists returns true if the given path exists.
 func pathExists(p string) bool {
 	if _, err := os.Lstat(p); err != nil && os.IsNotExist(err) {
@@ -5,6 +5,7 @@ import (
 	"errors"
 	"expvar"
 	"fmt"
+	"io"
 	"io/ioutil"
 	"math/rand"
 	"net"
@@ -15,8 +16,11 @@ import (
 	"testing"
 	"time"
 
+	"github.com/hashicorp/raft"
 	"github.com/rqlite/rqlite/command"
 	"github.com/rqlite/rqlite/command/encoding"
+	sql "github.com/rqlite/rqlite/db"
+	rlog "github.com/rqlite/rqlite/log"
 	"github.com/rqlite/rqlite/testdata/chinook"
 )
 
@@ -820,6 +824,12 @@ COMMIT;
 		t.Fatalf("Backup Failed: unable to read source SQLite file, %s", err.Error())
 	}
 
+	// SQLite gives the backup its own schema cookie, counting the changes to
+	// the schema of the backup rather than of the source, so ignore it.
+	if len(bkp) < 44 || len(dbFile) < 44 {
+		t.Fatalf("Backup Failed: backup or source too short")
+	}
+	copy(bkp[40:44], dbFile[40:44])
 	if ret := bytes.Compare(bkp, dbFile); ret != 0 {
 		t.Fatalf("Backup Failed: backup bytes are not same")
 	}
@@ -1470,6 +1480,87 @@ func Test_SingleNodeRecoverNetworkChange(t *testing.T) {
 	}
 }
 
+// Test_SingleNodeRecoveryMode tests that a node can be recovered, without a
+// peers file, even when the tail of its Raft log is unreadable.
+func Test_SingleNodeRecoveryMode(t *testing.T) {
+	s0, ln0 := mustNewStore(t, true)
+	defer ln0.Close()
+	if err := s0.Open(); err != nil {
+		t.Fatalf("failed to open single-node store: %s", err.Error())
+	}
+	if err := s0.Bootstrap(NewServer(s0.ID(), s0.Addr(), true)); err != nil {
+		t.Fatalf("failed to bootstrap single-node store: %s", err.Error())
+	}
+	if _, err := s0.WaitForLeader(10 * time.Second); err != nil {
+		t.Fatalf("Error waiting for leader: %s", err)
+	}
+
+	er := executeRequestFromStrings([]string{
+		`CREATE TABLE foo (id INTEGER NOT NULL PRIMARY KEY, name TEXT)`,
+		`INSERT INTO foo(id, name) VALUES(1, "fiona")`,
+	}, false, false)
+	if _, err := s0.Execute(er); err != nil {
+		t.Fatalf("failed to execute on single node: %s", err.Error())
+	}
+	id := s0.ID()
+	if err := s0.Close(true); err != nil {
+		t.Fatalf("failed to close single-node store: %s", err.Error())
+	}
+
+	// Append an entry which cannot be decoded, as if the log had been torn.
+	ls, err := rlog.New(filepath.Join(s0.Path(), "raft", raftDBPath), false)
+	if err != nil {
+		t.Fatalf("failed to open Raft log: %s", err.Error())
+	}
+	li, err := ls.LastIndex()
+	if err != nil {
+		t.Fatalf("failed to get last index: %s", err.Error())
+	}
+	if err := ls.StoreLog(&raft.Log{
+		Index: li + 1,
+		Term:  1,
+		Type:  raft.LogCommand,
+		Data:  []byte("garbage"),
+	}); err != nil {
+		t.Fatalf("failed to store log: %s", err.Error())
+	}
+	if err := ls.Close(); err != nil {
+		t.Fatalf("failed to close Raft log: %s", err.Error())
+	}
+
+	// Recover at a new Raft network address, without a peers file.
+	sR, srLn := mustNewStoreAtPathsLn(id, s0.Path(), "", true, false)
+	defer srLn.Close()
+	sR.RecoveryMode = true
+	if err := sR.Open(); err != nil {
+		t.Fatalf("failed to open store in recovery mode: %s", err.Error())
+	}
+	if _, err := sR.WaitForLeader(10 * time.Second); err != nil {
+		t.Fatalf("Error waiting for leader on recovered node: %s", err)
+	}
+
+	nodes, err := sR.Nodes()
+	if err != nil {
+		t.Fatalf("failed to get nodes: %s", err.Error())
+	}
+	if len(nodes) != 1 || nodes[0].ID != id || nodes[0].Addr != srLn.Addr().String() {
+		t.Fatalf("unexpected cluster membership after recovery: %v", nodes)
+	}
+
+	qr := queryRequestFromString("SELECT * FROM foo", false, false)
+	qr.Level = command.QueryRequest_QUERY_REQUEST_LEVEL_NONE
+	r, err := sR.Query(qr)
+	if err != nil {
+		t.Fatalf("failed to query recovered node: %s", err.Error())
+	}
+	if exp, got := `[[1,"fiona"]]`, asJSON(r[0].Values); exp != got {
+		t.Fatalf("unexpected results for query\nexp: %s\ngot: %s", exp, got)
+	}
+	if err := sR.Close(true); err != nil {
+		t.Fatalf("failed to close recovered store: %s", err.Error())
+	}
+}
+
 // Test_SingleNodeRecoverNetworkChangeSnapshot tests a node recovery that
 // involves a changed-network address, with snapshots underneath.
 func Test_SingleNodeRecoverNetworkChangeSnapshot(t *testing.T) {
@@ -2023,6 +2114,120 @@ func Test_MultiNodeJoinNonVoterRemove(t *testing.T) {
 	}
 }
 
+func Test_MultiNodePromoteDemote(t *testing.T) {
+	s0, ln0 := mustNewStore(t, true)
+	defer ln0.Close()
+	if err := s0.Open(); err != nil {
+		t.Fatalf("failed to open single-node store: %s", err.Error())
+	}
+	defer s0.Close(true)
+	if err := s0.Bootstrap(NewServer(s0.ID(), s0.Addr(), true)); err != nil {
+		t.Fatalf("failed to bootstrap single-node store: %s", err.Error())
+	}
+	if _, err := s0.WaitForLeader(10 * time.Second); err != nil {
+		t.Fatalf("Error waiting for leader: %s", err)
+	}
+
+	s1, ln1 := mustNewStore(t, true)
+	defer ln1.Close()
+	if err := s1.Open(); err != nil {
+		t.Fatalf("failed to open single-node store: %s", err.Error())
+	}
+	defer s1.Close(true)
+
+	if err := s0.Join(joinRequest(s1.ID(), s1.Addr(), false)); err != nil {
+		t.Fatalf("failed to join to node at %s: %s", s0.Addr(), err.Error())
+	}
+	if _, err := s1.WaitForLeader(10 * time.Second); err != nil {
+		t.Fatalf("Error waiting for leader: %s", err)
+	}
+	testPoll(t, func() bool {
+		return s1.CaughtUp(10 * time.Second)
+	}, 100*time.Millisecond, 10*time.Second)
+
+	isVoter := func() bool {
+		v, err := s1.IsVoter()
+		if err != nil {
+			t.Fatalf("failed to check voter status: %s", err.Error())
+		}
+		return v
+	}
+	if isVoter() {
+		t.Fatalf("non-voting node reported as voter")
+	}
+	if err := s0.Demote(s1.ID()); err != ErrNotVoter {
+		t.Fatalf("expected ErrNotVoter demoting non-voter, got %v", err)
+	}
+
+	// Rejoining as a voter should promote the node.
+	if err := s0.Join(joinRequest(s1.ID(), s1.Addr(), true)); err != nil {
+		t.Fatalf("failed to promote node %s: %s", s1.ID(), err.Error())
+	}
+	testPoll(t, isVoter, 100*time.Millisecond, 10*time.Second)
+
+	// Now demote it again.
+	if err := s1.Demote(s1.ID()); err != ErrNotLeader {
+		t.Fatalf("expected ErrNotLeader demoting via follower, got %v", err)
+	}
+	if err := s0.Demote("nonexistent"); err != ErrNodeNotFound {
+		t.Fatalf("expected ErrNodeNotFound demoting unknown node, got %v", err)
+	}
+	if err := s0.Demote(s1.ID()); err != nil {
+		t.Fatalf("failed to demote node %s: %s", s1.ID(), err.Error())
+	}
+	testPoll(t, func() bool { return !isVoter() }, 100*time.Millisecond, 10*time.Second)
+}
+
+func Test_SingleNodeDryRun(t *testing.T) {
+	s, ln := mustNewStore(t, true)
+	defer ln.Close()
+
+	if err := s.Open(); err != nil {
+		t.Fatalf("failed to open single-node store: %s", err.Error())
+	}
+	defer s.Close(true)
+	if err := s.Bootstrap(NewServer(s.ID(), s.Addr(), true)); err != nil {
+		t.Fatalf("failed to bootstrap single-node store: %s", err.Error())
+	}
+	if _, err := s.WaitForLeader(10 * time.Second); err != nil {
+		t.Fatalf("Error waiting for leader: %s", err)
+	}
+
+	er := executeRequestFromStrings([]string{
+		`CREATE TABLE foo (id INTEGER NOT NULL PRIMARY KEY, name TEXT)`,
+		`INSERT INTO foo(id, name) VALUES(1, "fiona")`,
+	}, false, false)
+	if _, err := s.Execute(er); err != nil {
+		t.Fatalf("failed to execute on single node: %s", err.Error())
+	}
+	idx := s.raft.LastIndex()
+
+	er = executeRequestFromStrings([]string{
+		`INSERT INTO foo(id, name) VALUES(2, "declan")`,
+		`INSERT INTO bar(id) VALUES(1)`,
+	}, false, false)
+	results, err := s.DryRun(er)
+	if err != nil {
+		t.Fatalf("failed to dry run on single node: %s", err.Error())
+	}
+	if exp, got := `[{"last_insert_id":2,"rows_affected":1},{"error":"no such table: bar"}]`, asJSON(results); exp != got {
+		t.Fatalf("unexpected results for dry run\nexp: %s\ngot: %s", exp, got)
+	}
+	if s.raft.LastIndex() != idx {
+		t.Fatalf("dry run written to the Raft log")
+	}
+
+	qr := queryRequestFromString("SELECT * FROM foo", false, false)
+	qr.Level = command.QueryRequest_QUERY_REQUEST_LEVEL_NONE
+	r, err := s.Query(qr)
+	if err != nil {
+		t.Fatalf("failed to query single node: %s", err.Error())
+	}
+	if exp, got := `[[1,"fiona"]]`, asJSON(r[0].Values); exp != got {
+		t.Fatalf("database changed by dry run\nexp: %s\ngot: %s", exp, got)
+	}
+}
+
 func Test_MultiNodeExecuteQuery(t *testing.T) {
 	s0, ln0 := mustNewStore(t, true)
 	defer ln0.Close()
@@ -2187,6 +2392,51 @@ func Test_SingleNodeExecuteQueryFreshness(t *testing.T) {
 	}
 }
 
+func Test_SingleNodeVerifyLeaderFreshness(t *testing.T) {
+	s0, ln0 := mustNewStore(t, true)
+	defer ln0.Close()
+	if err := s0.Open(); err != nil {
+		t.Fatalf("failed to open single-node store: %s", err.Error())
+	}
+	defer s0.Close(true)
+	if err := s0.Bootstrap(NewServer(s0.ID(), s0.Addr(), true)); err != nil {
+		t.Fatalf("failed to bootstrap single-node store: %s", err.Error())
+	}
+	if _, err := s0.WaitForLeader(10 * time.Second); err != nil {
+		t.Fatalf("Error waiting for leader: %s", err)
+	}
+
+	n := stats.Get(numLeaderVerifications).(*expvar.Int).Value()
+	if _, err := s0.VerifyLeaderFreshness(time.Minute); err != nil {
+		t.Fatalf("failed to verify leadership: %s", err.Error())
+	}
+	if exp, got := n+1, stats.Get(numLeaderVerifications).(*expvar.Int).Value(); exp != got {
+		t.Fatalf("wrong number of verifications, exp %d, got %d", exp, got)
+	}
+
+	// A confirmation within the bound is relied upon.
+	age, err := s0.VerifyLeaderFreshness(time.Minute)
+	if err != nil {
+		t.Fatalf("failed to verify leadership: %s", err.Error())
+	}
+	if age <= 0 || age > time.Minute {
+		t.Fatalf("wrong age of confirmation: %s", age)
+	}
+	if exp, got := n+1, stats.Get(numLeaderVerifications).(*expvar.Int).Value(); exp != got {
+		t.Fatalf("leadership verified again within bound, exp %d, got %d", exp, got)
+	}
+
+	qr := queryRequestFromString("SELECT 1", false, false)
+	qr.Level = command.QueryRequest_QUERY_REQUEST_LEVEL_WEAK
+	qr.LeaderFreshness = time.Nanosecond.Nanoseconds()
+	if _, err := s0.Query(qr); err != nil {
+		t.Fatalf("failed to query with leader freshness: %s", err.Error())
+	}
+	if exp, got := n+2, stats.Get(numLeaderVerifications).(*expvar.Int).Value(); exp != got {
+		t.Fatalf("leadership not verified again after bound, exp %d, got %d", exp, got)
+	}
+}
+
 func Test_MultiNodeExecuteQueryFreshness(t *testing.T) {
 	s0, ln0 := mustNewStore(t, true)
 	defer ln0.Close()
@@ -2337,6 +2587,42 @@ func Test_MultiNodeExecuteQueryFreshness(t *testing.T) {
 	}
 }
 
+func Test_SingleNodeRaftTiming(t *testing.T) {
+	s, ln := mustNewStore(t, true)
+	defer ln.Close()
+	s.HeartbeatTimeout = 2 * time.Second
+	s.ElectionTimeout = 2 * time.Second
+	s.CommitTimeout = 100 * time.Millisecond
+	s.MaxAppendEntries = 128
+
+	if err := s.Open(); err != nil {
+		t.Fatalf("failed to open single-node store: %s", err.Error())
+	}
+	defer s.Close(true)
+	if err := s.Bootstrap(NewServer(s.ID(), s.Addr(), true)); err != nil {
+		t.Fatalf("failed to bootstrap single-node store: %s", err.Error())
+	}
+	if _, err := s.WaitForLeader(10 * time.Second); err != nil {
+		t.Fatalf("Error waiting for leader: %s", err)
+	}
+
+	st, err := s.Stats()
+	if err != nil {
+		t.Fatalf("failed to get store stats: %s", err.Error())
+	}
+	for k, exp := range map[string]interface{}{
+		"heartbeat_timeout":    "2s",
+		"election_timeout":     "2s",
+		"commit_timeout":       "100ms",
+		"leader_lease_timeout": "500ms",
+		"max_append_entries":   128,
+	} {
+		if got := st[k]; got != exp {
+			t.Fatalf("wrong value for %s, got %v, exp %v", k, got, exp)
+		}
+	}
+}
+
 func Test_StoreLogTruncationMultinode(t *testing.T) {
 	s0, ln0 := mustNewStore(t, true)
 	defer ln0.Close()
@@ -2420,6 +2706,194 @@ func Test_StoreLogTruncationMultinode(t *testing.T) {
 	}
 }
 
+func Test_SingleNodeExecuteChunked(t *testing.T) {
+	s, ln := mustNewStore(t, true)
+	defer ln.Close()
+	s.MaxEntrySize = 1024
+	if err := s.Open(); err != nil {
+		t.Fatalf("failed to open single-node store: %s", err.Error())
+	}
+	if err := s.Bootstrap(NewServer(s.ID(), s.Addr(), true)); err != nil {
+		t.Fatalf("failed to bootstrap single-node store: %s", err.Error())
+	}
+	if _, err := s.WaitForLeader(10 * time.Second); err != nil {
+		t.Fatalf("Error waiting for leader: %s", err)
+	}
+
+	stmts := []string{`CREATE TABLE foo (id INTEGER NOT NULL PRIMARY KEY, name TEXT)`}
+	for i := 0; i < 100; i++ {
+		stmts = append(stmts, fmt.Sprintf(`INSERT INTO foo(id, name) VALUES(%d, "%s")`, i, randomString()))
+	}
+	before := stats.Get(numChunkedExecutes).(*expvar.Int).Value()
+	results, err := s.Execute(executeRequestFromStrings(stmts, false, true))
+	if err != nil {
+		t.Fatalf("failed to execute chunked request: %s", err.Error())
+	}
+	if len(results) != len(stmts) {
+		t.Fatalf("wrong number of results, exp %d, got %d", len(stmts), len(results))
+	}
+	if stats.Get(numChunkedExecutes).(*expvar.Int).Value() != before+1 {
+		t.Fatalf("request was not chunked")
+	}
+
+	queryCount := func(s *Store) {
+		qr := queryRequestFromString("SELECT COUNT(*) FROM foo", false, false)
+		qr.Level = command.QueryRequest_QUERY_REQUEST_LEVEL_NONE
+		r, err := s.Query(qr)
+		if err != nil {
+			t.Fatalf("failed to query single node: %s", err.Error())
+		}
+		if exp, got := `[[100]]`, asJSON(r[0].Values); exp != got {
+			t.Fatalf("unexpected results for query\nexp: %s\ngot: %s", exp, got)
+		}
+	}
+	queryCount(s)
+
+	var long strings.Builder
+	for i := 0; i < 100; i++ {
+		long.WriteString(randomString())
+	}
+	_, err = s.Execute(executeRequestFromString(fmt.Sprintf(`INSERT INTO foo(name) VALUES("%s")`,
+		long.String()), false, false))
+	if err != ErrStatementTooLarge {
+		t.Fatalf("wrong error for oversized statement: %v", err)
+	}
+
+	// The chunks must be reassembled when the log is replayed.
+	if err := s.Close(true); err != nil {
+		t.Fatalf("failed to close single-node store: %s", err.Error())
+	}
+	if err := s.Open(); err != nil {
+		t.Fatalf("failed to reopen single-node store: %s", err.Error())
+	}
+	defer s.Close(true)
+	if _, err := s.WaitForLeader(10 * time.Second); err != nil {
+		t.Fatalf("Error waiting for leader: %s", err)
+	}
+	testPoll(t, func() bool {
+		qr := queryRequestFromString("SELECT COUNT(*) FROM foo", false, false)
+		qr.Level = command.QueryRequest_QUERY_REQUEST_LEVEL_NONE
+		r, err := s.Query(qr)
+		return err == nil && len(r) == 1 && asJSON(r[0].Values) == `[[100]]`
+	}, 100*time.Millisecond, 5*time.Second)
+	queryCount(s)
+}
+
+func Test_SingleNodeMinSQLiteVersion(t *testing.T) {
+	s, ln := mustNewStore(t, true)
+	defer ln.Close()
+	s.MinSQLiteVersion = "3.31.0"
+	if err := s.Open(); err != nil {
+		t.Fatalf("failed to open single-node store: %s", err.Error())
+	}
+	defer s.Close(true)
+	if err := s.Bootstrap(NewServer(s.ID(), s.Addr(), true)); err != nil {
+		t.Fatalf("failed to bootstrap single-node store: %s", err.Error())
+	}
+	if _, err := s.WaitForLeader(10 * time.Second); err != nil {
+		t.Fatalf("Error waiting for leader: %s", err)
+	}
+
+	_, err := s.Execute(executeRequestFromString(`CREATE TABLE foo (a INTEGER, b INTEGER AS (a*2))`, false, false))
+	if err != nil {
+		t.Fatalf("failed to create table with generated column: %s", err.Error())
+	}
+
+	before := stats.Get(numDDLRejected).(*expvar.Int).Value()
+	_, err = s.Execute(executeRequestFromString(`CREATE TABLE bar (id INTEGER) STRICT`, false, false))
+	if err == nil {
+		t.Fatalf("STRICT table was not rejected")
+	}
+	_, _, err = s.RequestWithIndex(executeQueryRequestFromString(`ALTER TABLE foo DROP COLUMN b`,
+		command.QueryRequest_QUERY_REQUEST_LEVEL_WEAK, false, false))
+	if err == nil {
+		t.Fatalf("DROP COLUMN was not rejected")
+	}
+	if exp, got := before+2, stats.Get(numDDLRejected).(*expvar.Int).Value(); exp != got {
+		t.Fatalf("wrong number of rejected requests, exp %d, got %d", exp, got)
+	}
+
+	qr := queryRequestFromString(`SELECT name FROM sqlite_master WHERE name="bar"`, false, false)
+	r, err := s.Query(qr)
+	if err != nil {
+		t.Fatalf("failed to query single node: %s", err.Error())
+	}
+	if r[0].Values != nil {
+		t.Fatalf("rejected table was created: %s", asJSON(r[0].Values))
+	}
+}
+
+func Test_SingleNodeSnapshotArchive(t *testing.T) {
+	s, ln := mustNewStore(t, true)
+	defer ln.Close()
+	archiveDir := filepath.Join(t.TempDir(), "snapshots")
+	a, err := NewDirSnapshotArchiver(archiveDir, 0)
+	if err != nil {
+		t.Fatalf("failed to create archiver: %s", err.Error())
+	}
+	s.SnapshotArchiver = a
+	s.SnapshotRetain = 1
+	s.SnapshotThreshold = 4
+	s.SnapshotInterval = 100 * time.Millisecond
+	if err := s.Open(); err != nil {
+		t.Fatalf("failed to open single-node store: %s", err.Error())
+	}
+	if err := s.Bootstrap(NewServer(s.ID(), s.Addr(), true)); err != nil {
+		t.Fatalf("failed to bootstrap single-node store: %s", err.Error())
+	}
+	if _, err := s.WaitForLeader(10 * time.Second); err != nil {
+		t.Fatalf("Error waiting for leader: %s", err)
+	}
+
+	er := executeRequestFromStrings([]string{
+		`CREATE TABLE foo (id INTEGER NOT NULL PRIMARY KEY, name TEXT)`,
+	}, false, false)
+	if _, err := s.Execute(er); err != nil {
+		t.Fatalf("failed to execute on single node: %s", err.Error())
+	}
+	for i := 0; i < 9; i++ {
+		er := executeRequestFromStrings([]string{
+			`INSERT INTO foo(name) VALUES("fiona")`,
+		}, false, false)
+		if _, err := s.Execute(er); err != nil {
+			t.Fatalf("failed to execute on single node: %s", err.Error())
+		}
+	}
+
+	// Wait for a snapshot to take place.
+	for {
+		time.Sleep(100 * time.Millisecond)
+		s.numSnapshotsMu.Lock()
+		ns := s.numSnapshots
+		s.numSnapshotsMu.Unlock()
+		if ns > 0 {
+			break
+		}
+	}
+	if err := s.Close(true); err != nil {
+		t.Fatalf("failed to close single-node store: %s", err.Error())
+	}
+
+	metas, err := a.List()
+	if err != nil {
+		t.Fatalf("failed to list archived snapshots: %s", err.Error())
+	}
+	if len(metas) == 0 {
+		t.Fatalf("no snapshots archived")
+	}
+
+	// The archive must be usable to recover a node.
+	fss, err := raft.NewFileSnapshotStore(filepath.Dir(archiveDir), 1, io.Discard)
+	if err != nil {
+		t.Fatalf("failed to create file snapshot store: %s", err.Error())
+	}
+	_, rc, err := fss.Open(metas[len(metas)-1].ID)
+	if err != nil {
+		t.Fatalf("failed to open archived snapshot: %s", err.Error())
+	}
+	rc.Close()
+}
+
 func Test_SingleNodeSnapshotOnDisk(t *testing.T) {
 	s, ln := mustNewStore(t, false)
 	defer ln.Close()
@@ -2488,6 +2962,91 @@ func Test_SingleNodeSnapshotOnDisk(t *testing.T) {
 	}
 }
 
+func Test_SingleNodeStorageEvents(t *testing.T) {
+	s, ln := mustNewStore(t, true)
+	defer ln.Close()
+
+	ch := make(chan *Event, 10)
+	s.RegisterEventChannel(ch)
+
+	if err := s.Open(); err != nil {
+		t.Fatalf("failed to open single-node store: %s", err.Error())
+	}
+	defer s.Close(true)
+	if err := s.Bootstrap(NewServer(s.ID(), s.Addr(), true)); err != nil {
+		t.Fatalf("failed to bootstrap single-node store: %s", err.Error())
+	}
+	if _, err := s.WaitForLeader(10 * time.Second); err != nil {
+		t.Fatalf("Error waiting for leader: %s", err)
+	}
+
+	queries := []string{
+		`CREATE TABLE foo (id INTEGER NOT NULL PRIMARY KEY, name TEXT)`,
+		`INSERT INTO foo(id, name) VALUES(1, "fiona")`,
+	}
+	_, err := s.Execute(executeRequestFromStrings(queries, false, false))
+	if err != nil {
+		t.Fatalf("failed to execute on single node: %s", err.Error())
+	}
+
+	expectEvent := func(typ EventType, phase EventPhase) *Event {
+		select {
+		case e := <-ch:
+			if e.Type != typ || e.Phase != phase {
+				t.Fatalf("unexpected event, exp %s %s, got %s %s", typ, phase, e.Type, e.Phase)
+			}
+			return e
+		case <-time.After(5 * time.Second):
+			t.Fatalf("timeout waiting for %s %s event", typ, phase)
+		}
+		return nil
+	}
+
+	// Snapshot the node, and persist the snapshot.
+	f, err := s.Snapshot()
+	if err != nil {
+		t.Fatalf("failed to snapshot node: %s", err.Error())
+	}
+	expectEvent(EventSnapshot, EventStart)
+	snapFile, err := os.Create(filepath.Join(t.TempDir(), "snapshot"))
+	if err != nil {
+		t.Fatalf("failed to create snapshot file: %s", err.Error())
+	}
+	defer snapFile.Close()
+	if err := f.Persist(&mockSnapshotSink{snapFile}); err != nil {
+		t.Fatalf("failed to persist snapshot to disk: %s", err.Error())
+	}
+	e := expectEvent(EventSnapshot, EventFinish)
+	if e.Size == 0 || e.Error != "" {
+		t.Fatalf("unexpected snapshot finish event: %s", e)
+	}
+
+	// Back up the node.
+	var buf bytes.Buffer
+	br := &command.BackupRequest{
+		Format: command.BackupRequest_BACKUP_REQUEST_FORMAT_SQL,
+	}
+	if err := s.Backup(br, &buf); err != nil {
+		t.Fatalf("failed to backup node: %s", err.Error())
+	}
+	expectEvent(EventBackup, EventStart)
+	e = expectEvent(EventBackup, EventFinish)
+	if exp, got := int64(buf.Len()), e.Size; exp != got {
+		t.Fatalf("wrong backup size in event, exp %d, got %d", exp, got)
+	}
+
+	// A failed backup should be reported too.
+	br.Format = command.BackupRequest_BACKUP_REQUEST_FORMAT_NONE
+	if err := s.Backup(br, &buf); err != ErrInvalidBackupFormat {
+		t.Fatalf("expected ErrInvalidBackupFormat, got %v", err)
+	}
+	expectEvent(EventBackup, EventStart)
+	e = expectEvent(EventBackup, EventFinish)
+	if e.Error != ErrInvalidBackupFormat.Error() {
+		t.Fatalf("wrong error in event, got %s", e.Error)
+	}
+}
+
 func Test_SingleNodeSnapshotInMem(t *testing.T) {
 	s, ln := mustNewStore(t, true)
 	defer ln.Close()
@@ -3009,6 +3568,7 @@ func joinRequest(id, addr string, voter bool) *command.JoinRequest {
 		Id:      id,
 		Address: addr,
 		Voter:   voter,
+		Icu:     sql.ICUSupported,
 	}
 }
 
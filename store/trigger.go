@@ -0,0 +1,76 @@
+package store
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/rqlite/rqlite/command"
+)
+
+var (
+	// ErrNonDeterministicTrigger is returned when a request creates a trigger
+	// whose effects may differ from node to node.
+	ErrNonDeterministicTrigger = errors.New("non-deterministic trigger")
+)
+
+// Trigger is a trigger installed in the database.
+type Trigger struct {
+	Name  string
+	Table string
+	SQL   string
+
+	// Reasons are why the effects of the trigger may differ from node to
+	// node. The trigger is deterministic if there are none.
+	Reasons []string
+}
+
+// Triggers returns every trigger installed in the database, sorted by name,
+// with an assessment of whether its effects are the same on every node.
+// Triggers created before rqlite rejected non-deterministic triggers, or
+// restored from a backup, may not be.
+func (s *Store) Triggers() ([]*Trigger, error) {
+	rows, err := s.db.QueryStringStmt(`SELECT name, tbl_name, sql FROM sqlite_master WHERE type = 'trigger' ORDER BY name`)
+	if err != nil {
+		return nil, err
+	}
+	if len(rows) != 1 {
+		return nil, fmt.Errorf("unexpected number of results querying triggers: %d", len(rows))
+	}
+	if rows[0].Error != "" {
+		return nil, errors.New(rows[0].Error)
+	}
+
+	var triggers []*Trigger
+	for _, v := range rows[0].Values {
+		p := v.GetParameters()
+		if len(p) != 3 {
+			return nil, fmt.Errorf("unexpected number of columns querying triggers: %d", len(p))
+		}
+		t := &Trigger{
+			Name:  p[0].GetS(),
+			Table: p[1].GetS(),
+			SQL:   p[2].GetS(),
+		}
+		t.Reasons = command.TriggerNonDeterminism(t.SQL)
+		triggers = append(triggers, t)
+	}
+	return triggers, nil
+}
+
+// checkTriggers returns ErrNonDeterministicTrigger if any of the statements
+// creates a trigger whose effects may differ from node to node, unless such
+// triggers are allowed. Each node fires triggers as it applies writes, so
+// such a trigger would leave the nodes holding different data.
+func (s *Store) checkTriggers(stmts []*command.Statement) error {
+	if s.AllowNonDeterministicTriggers {
+		return nil
+	}
+	triggers := command.NonDeterministicTriggers(stmts)
+	if len(triggers) == 0 {
+		return nil
+	}
+	stats.Add(numTriggersRejected, 1)
+	t := triggers[0]
+	return fmt.Errorf("%w: trigger %s %s", ErrNonDeterministicTrigger, t.Name, strings.Join(t.Reasons, ", and "))
+}
@@ -0,0 +1,152 @@
+package store
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/rqlite/rqlite/command"
+)
+
+func Test_SingleNodeTriggers(t *testing.T) {
+	s, ln := mustNewStore(t, true)
+	defer ln.Close()
+
+	if err := s.Open(); err != nil {
+		t.Fatalf("failed to open single-node store: %s", err.Error())
+	}
+	if err := s.Bootstrap(NewServer(s.ID(), s.Addr(), true)); err != nil {
+		t.Fatalf("failed to bootstrap single-node store: %s", err.Error())
+	}
+	defer s.Close(true)
+	if _, err := s.WaitForLeader(10 * time.Second); err != nil {
+		t.Fatalf("Error waiting for leader: %s", err)
+	}
+
+	er := executeRequestFromStrings([]string{
+		`CREATE TABLE foo (id INTEGER NOT NULL PRIMARY KEY, name TEXT)`,
+		`CREATE TABLE audit (id INTEGER, name TEXT, at TEXT)`,
+		`CREATE TRIGGER foo_audit AFTER INSERT ON foo BEGIN INSERT INTO audit VALUES (NEW.id, NEW.name, NULL); END`,
+	}, false, false)
+	if _, err := s.Execute(er); err != nil {
+		t.Fatalf("failed to execute on single node: %s", err.Error())
+	}
+
+	// Non-deterministic triggers are rejected, by every path which writes.
+	unsafe := `CREATE TRIGGER foo_stamp AFTER INSERT ON foo BEGIN UPDATE audit SET at = datetime('now') WHERE id = NEW.id; END`
+	if _, err := s.Execute(executeRequestFromString(unsafe, false, false)); !errors.Is(err, ErrNonDeterministicTrigger) {
+		t.Fatalf("non-deterministic trigger not rejected by execute: %v", err)
+	}
+	if _, err := s.Request(executeQueryRequestFromString(unsafe, command.QueryRequest_QUERY_REQUEST_LEVEL_WEAK, false, false)); !errors.Is(err, ErrNonDeterministicTrigger) {
+		t.Fatalf("non-deterministic trigger not rejected by request: %v", err)
+	}
+	if _, err := s.DryRun(executeRequestFromString(unsafe, false, false)); !errors.Is(err, ErrNonDeterministicTrigger) {
+		t.Fatalf("non-deterministic trigger not rejected by dry run: %v", err)
+	}
+
+	triggers, err := s.Triggers()
+	if err != nil {
+		t.Fatalf("failed to list triggers: %s", err.Error())
+	}
+	if len(triggers) != 1 || triggers[0].Name != "foo_audit" || triggers[0].Table != "foo" || len(triggers[0].Reasons) != 0 {
+		t.Fatalf("wrong triggers: %s", asJSON(triggers))
+	}
+
+	// Once allowed, non-deterministic triggers are created, and reported.
+	s.AllowNonDeterministicTriggers = true
+	if _, err := s.Execute(executeRequestFromString(unsafe, false, false)); err != nil {
+		t.Fatalf("failed to create allowed non-deterministic trigger: %s", err.Error())
+	}
+	triggers, err = s.Triggers()
+	if err != nil {
+		t.Fatalf("failed to list triggers: %s", err.Error())
+	}
+	if len(triggers) != 2 || triggers[1].Name != "foo_stamp" || len(triggers[1].Reasons) != 1 {
+		t.Fatalf("wrong triggers: %s", asJSON(triggers))
+	}
+	if exp, got := "calls datetime() with the current time of each node", triggers[1].Reasons[0]; exp != got {
+		t.Fatalf("wrong reason, exp %s, got %s", exp, got)
+	}
+}
+
+func Test_MultiNodeTriggerSideEffects(t *testing.T) {
+	s0, ln0 := mustNewStore(t, true)
+	defer ln0.Close()
+	if err := s0.Open(); err != nil {
+		t.Fatalf("failed to open single-node store: %s", err.Error())
+	}
+	defer s0.Close(true)
+	if err := s0.Bootstrap(NewServer(s0.ID(), s0.Addr(), true)); err != nil {
+		t.Fatalf("failed to bootstrap single-node store: %s", err.Error())
+	}
+	if _, err := s0.WaitForLeader(10 * time.Second); err != nil {
+		t.Fatalf("Error waiting for leader: %s", err)
+	}
+
+	s1, ln1 := mustNewStore(t, true)
+	defer ln1.Close()
+	if err := s1.Open(); err != nil {
+		t.Fatalf("failed to open node for multi-node test: %s", err.Error())
+	}
+	defer s1.Close(true)
+	if err := s0.Join(joinRequest(s1.ID(), s1.Addr(), true)); err != nil {
+		t.Fatalf("failed to join to node at %s: %s", s0.Addr(), err.Error())
+	}
+
+	// The triggers cascade, and update rows other than those written.
+	er := executeRequestFromStrings([]string{
+		`CREATE TABLE foo (id INTEGER NOT NULL PRIMARY KEY, name TEXT)`,
+		`CREATE TABLE audit (seq INTEGER PRIMARY KEY AUTOINCREMENT, op TEXT, id INTEGER, name TEXT)`,
+		`CREATE TABLE counts (name TEXT PRIMARY KEY, n INTEGER NOT NULL)`,
+		`CREATE TRIGGER foo_insert AFTER INSERT ON foo BEGIN INSERT INTO audit (op, id, name) VALUES ('insert', NEW.id, NEW.name); END`,
+		`CREATE TRIGGER foo_update AFTER UPDATE ON foo BEGIN INSERT INTO audit (op, id, name) VALUES ('update', NEW.id, NEW.name); END`,
+		`CREATE TRIGGER foo_delete BEFORE DELETE ON foo BEGIN INSERT INTO audit (op, id, name) VALUES ('delete', OLD.id, OLD.name); END`,
+		`CREATE TRIGGER audit_count AFTER INSERT ON audit BEGIN INSERT OR IGNORE INTO counts VALUES (NEW.op, 0); UPDATE counts SET n = n + 1 WHERE name = NEW.op; END`,
+		`INSERT INTO foo(id, name) VALUES(1, "fiona")`,
+		`INSERT INTO foo(id, name) VALUES(2, "declan")`,
+		`UPDATE foo SET name = 'fiona2' WHERE id = 1`,
+		`DELETE FROM foo WHERE id = 2`,
+		`INSERT INTO foo(id, name) VALUES(3, "aoife")`,
+	}, false, true)
+	if _, err := s0.Execute(er); err != nil {
+		t.Fatalf("failed to execute on leader: %s", err.Error())
+	}
+	idx, err := s0.WaitForAppliedFSM(5 * time.Second)
+	if err != nil {
+		t.Fatalf("failed to wait for fsmIndex: %s", err.Error())
+	}
+	if _, err := s1.WaitForFSMIndex(idx, 5*time.Second); err != nil {
+		t.Fatalf("error waiting for follower to apply index: %s:", err.Error())
+	}
+
+	for _, q := range []string{
+		`SELECT * FROM audit ORDER BY seq`,
+		`SELECT * FROM counts ORDER BY name`,
+		`SELECT * FROM sqlite_sequence`,
+	} {
+		qr := queryRequestFromString(q, false, false)
+		qr.Level = command.QueryRequest_QUERY_REQUEST_LEVEL_NONE
+		r0, err := s0.Query(qr)
+		if err != nil {
+			t.Fatalf("failed to query leader: %s", err.Error())
+		}
+		r1, err := s1.Query(qr)
+		if err != nil {
+			t.Fatalf("failed to query follower: %s", err.Error())
+		}
+		if asJSON(r0) != asJSON(r1) {
+			t.Fatalf("trigger side effects differ for %s\nleader:   %s\nfollower: %s", q, asJSON(r0), asJSON(r1))
+		}
+		if len(r0[0].Values) == 0 {
+			t.Fatalf("no trigger side effects for %s", q)
+		}
+	}
+
+	triggers, err := s1.Triggers()
+	if err != nil {
+		t.Fatalf("failed to list triggers on follower: %s", err.Error())
+	}
+	if len(triggers) != 4 {
+		t.Fatalf("wrong number of triggers on follower, exp 4, got %d", len(triggers))
+	}
+}
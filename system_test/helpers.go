@@ -1003,6 +1003,10 @@ func (m *mockCredentialStore) AA(username, password, perm string) bool {
 	return m.HasPermOK
 }
 
+func (m *mockCredentialStore) AAQuery(username, password string, tables []string) bool {
+	return m.AA(username, password, "query")
+}
+
 func mustNewMockCredentialStore() *mockCredentialStore {
 	return &mockCredentialStore{HasPermOK: true}
 }
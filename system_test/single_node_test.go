@@ -189,8 +189,10 @@ func Test_SingleNodeRequest(t *testing.T) {
 			expected: `{"results":[{"error":"no such table: bar"}]}`,
 		},
 		{
+			// The failed DROP TABLE above still incremented the schema
+			// version, leaving no rows changed on the connection.
 			stmt:     `DROP TABLE foo`,
-			expected: `{"results":[{"last_insert_id":1,"rows_affected":1}]}`,
+			expected: `{"results":[{"last_insert_id":1}]}`,
 		},
 	}
 
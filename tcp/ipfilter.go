@@ -0,0 +1,185 @@
+package tcp
+
+import (
+	"expvar"
+	"fmt"
+	"log"
+	"net"
+	"os"
+	"strings"
+	"sync"
+)
+
+// filterStats captures stats for the IP filters, keyed by filter name.
+var filterStats *expvar.Map
+
+func init() {
+	filterStats = expvar.NewMap("ip_filter")
+}
+
+// IPFilter decides, from lists of CIDR blocks, whether connections from a
+// remote IP address are accepted. An address within a denied block is always
+// refused. Otherwise, if any blocks are allowed, the address must be within one
+// of them. A filter without blocks accepts all connections. The lists may be
+// replaced while the filter is in use.
+type IPFilter struct {
+	name string
+
+	mu    sync.RWMutex
+	allow []*net.IPNet
+	deny  []*net.IPNet
+
+	logger *log.Logger
+}
+
+// NewIPFilter returns a filter, which accepts all connections until its
+// lists are set. name identifies the filter in stats and logs.
+func NewIPFilter(name string) *IPFilter {
+	filterStats.Add(rejectedStat(name), 0)
+	return &IPFilter{
+		name:   name,
+		logger: log.New(os.Stderr, fmt.Sprintf("[ip-filter:%s] ", name), log.LstdFlags),
+	}
+}
+
+// Set replaces the allow and deny lists of the filter. Each entry is a CIDR
+// block, or a single IP address. The lists are left unchanged if any entry is
+// invalid.
+func (f *IPFilter) Set(allow, deny []string) error {
+	a, err := parseCIDRs(allow)
+	if err != nil {
+		return err
+	}
+	d, err := parseCIDRs(deny)
+	if err != nil {
+		return err
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.allow, f.deny = a, d
+	return nil
+}
+
+// ValidateIPLists returns an error if any entry of allow or deny is neither a
+// CIDR block nor an IP address.
+func ValidateIPLists(allow, deny []string) error {
+	if _, err := parseCIDRs(allow); err != nil {
+		return err
+	}
+	_, err := parseCIDRs(deny)
+	return err
+}
+
+// Allowed returns whether connections from ip are accepted.
+func (f *IPFilter) Allowed(ip net.IP) bool {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+	for _, n := range f.deny {
+		if n.Contains(ip) {
+			return false
+		}
+	}
+	if len(f.allow) == 0 {
+		return true
+	}
+	for _, n := range f.allow {
+		if n.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// AllowedAddr returns whether connections from addr are accepted. Connections
+// which are not from an IP address, such as over Unix sockets, always are.
+func (f *IPFilter) AllowedAddr(addr net.Addr) bool {
+	var ip net.IP
+	switch a := addr.(type) {
+	case *net.TCPAddr:
+		ip = a.IP
+	case *net.UDPAddr:
+		ip = a.IP
+	case *net.IPAddr:
+		ip = a.IP
+	default:
+		return true
+	}
+	return f.Allowed(ip)
+}
+
+// Stats returns the lists of the filter, and the number of connections it
+// has rejected.
+func (f *IPFilter) Stats() (map[string]interface{}, error) {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+	return map[string]interface{}{
+		"allow":    cidrStrings(f.allow),
+		"deny":     cidrStrings(f.deny),
+		"rejected": filterStats.Get(rejectedStat(f.name)).(*expvar.Int).Value(),
+	}, nil
+}
+
+// Listener returns a listener which accepts connections from ln, closing
+// those which the filter does not allow as soon as they are accepted.
+func (f *IPFilter) Listener(ln net.Listener) net.Listener {
+	return &filteredListener{Listener: ln, filter: f}
+}
+
+type filteredListener struct {
+	net.Listener
+	filter *IPFilter
+}
+
+// Accept waits for, and returns, the next connection which the filter allows.
+func (l *filteredListener) Accept() (net.Conn, error) {
+	for {
+		conn, err := l.Listener.Accept()
+		if err != nil {
+			return nil, err
+		}
+		if l.filter.AllowedAddr(conn.RemoteAddr()) {
+			return conn, nil
+		}
+		filterStats.Add(rejectedStat(l.filter.name), 1)
+		l.filter.logger.Printf("rejected connection from %s", conn.RemoteAddr())
+		conn.Close()
+	}
+}
+
+func parseCIDRs(l []string) ([]*net.IPNet, error) {
+	var nets []*net.IPNet
+	for _, s := range l {
+		s = strings.TrimSpace(s)
+		if !strings.Contains(s, "/") {
+			ip := net.ParseIP(s)
+			if ip == nil {
+				return nil, fmt.Errorf("invalid IP address %q", s)
+			}
+			bits := 8 * net.IPv6len
+			if ip4 := ip.To4(); ip4 != nil {
+				ip, bits = ip4, 8*net.IPv4len
+			}
+			nets = append(nets, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+			continue
+		}
+		_, n, err := net.ParseCIDR(s)
+		if err != nil {
+			return nil, fmt.Errorf("invalid CIDR block %q", s)
+		}
+		nets = append(nets, n)
+	}
+	return nets, nil
+}
+
+func cidrStrings(nets []*net.IPNet) []string {
+	l := make([]string, 0, len(nets))
+	for _, n := range nets {
+		l = append(l, n.String())
+	}
+	return l
+}
+
+func rejectedStat(name string) string {
+	return name + "_rejected"
+}
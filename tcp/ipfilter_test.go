@@ -0,0 +1,110 @@
+package tcp
+
+import (
+	"net"
+	"testing"
+	"time"
+)
+
+func Test_IPFilterAllowed(t *testing.T) {
+	f := NewIPFilter("test_allowed")
+	if !f.Allowed(net.ParseIP("192.168.0.1")) {
+		t.Fatalf("filter without lists refused address")
+	}
+
+	if err := f.Set([]string{"10.0.0.0/8", "192.168.1.1", "fd00::/8"}, []string{"10.1.0.0/16"}); err != nil {
+		t.Fatalf("failed to set filter lists: %s", err.Error())
+	}
+	for _, tt := range []struct {
+		ip      string
+		allowed bool
+	}{
+		{"10.0.0.1", true},
+		{"10.1.0.1", false},
+		{"192.168.1.1", true},
+		{"192.168.1.2", false},
+		{"fd00::1", true},
+		{"fe80::1", false},
+	} {
+		if got := f.Allowed(net.ParseIP(tt.ip)); got != tt.allowed {
+			t.Fatalf("address %s: exp allowed %v, got %v", tt.ip, tt.allowed, got)
+		}
+	}
+
+	if err := f.Set([]string{"10.0.0.0/33"}, nil); err == nil {
+		t.Fatalf("invalid CIDR block accepted")
+	}
+	if f.Allowed(net.ParseIP("10.1.0.1")) {
+		t.Fatalf("lists changed by invalid update")
+	}
+
+	if err := f.Set(nil, []string{"10.1.0.0/16"}); err != nil {
+		t.Fatalf("failed to set filter lists: %s", err.Error())
+	}
+	if !f.Allowed(net.ParseIP("192.168.1.2")) || f.Allowed(net.ParseIP("10.1.0.1")) {
+		t.Fatalf("deny-only filter applied incorrectly")
+	}
+}
+
+func Test_IPFilterListener(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("failed to listen: %s", err.Error())
+	}
+	f := NewIPFilter("test_listener")
+	fln := f.Listener(ln)
+	defer fln.Close()
+
+	accepted := make(chan net.Conn, 1)
+	go func() {
+		for {
+			conn, err := fln.Accept()
+			if err != nil {
+				return
+			}
+			accepted <- conn
+		}
+	}()
+
+	// dial connects to the listener, returning whether the connection was
+	// accepted, rather than closed by the filter.
+	dial := func() bool {
+		conn, err := net.Dial("tcp", ln.Addr().String())
+		if err != nil {
+			t.Fatalf("failed to dial listener: %s", err.Error())
+		}
+		defer conn.Close()
+		select {
+		case c := <-accepted:
+			c.Close()
+			return true
+		case <-time.After(100 * time.Millisecond):
+			return false
+		}
+	}
+
+	if !dial() {
+		t.Fatalf("connection not accepted by filter without lists")
+	}
+	if err := f.Set(nil, []string{"127.0.0.0/8"}); err != nil {
+		t.Fatalf("failed to set filter lists: %s", err.Error())
+	}
+	if dial() {
+		t.Fatalf("denied connection accepted")
+	}
+	stats, err := f.Stats()
+	if err != nil {
+		t.Fatalf("failed to get filter stats: %s", err.Error())
+	}
+	if n := stats["rejected"].(int64); n != 1 {
+		t.Fatalf("wrong number of rejected connections, exp 1, got %d", n)
+	}
+
+	// Changes to the lists apply to connections accepted afterwards.
+	if err := f.Set([]string{"127.0.0.1"}, nil); err != nil {
+		t.Fatalf("failed to set filter lists: %s", err.Error())
+	}
+	if !dial() {
+		t.Fatalf("allowed connection not accepted")
+	}
+}